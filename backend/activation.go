@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor systemd passes sockets from
+const listenFDsStart = 3
+
+// namedListener is a socket passed by systemd, named by the
+// FileDescriptorName= of its socket unit, the name of the unit by default
+type namedListener struct {
+	net.Listener
+	name string
+}
+
+// activatedListeners returns the sockets systemd passed the process when
+// started by a socket unit, as sd_listen_fds does, or nil otherwise. The
+// socket stays open while the service restarts, queueing the connections
+// until the next process accepts them, so restarts drop none.
+func activatedListeners() ([]namedListener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", os.Getenv("LISTEN_FDS"))
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	// the sockets aren't for the processes this one starts
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	listeners := make([]namedListener, 0, count)
+	for i := 0; i < count; i++ {
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(listenFDsStart+i), name)
+		// the listener has a descriptor of its own, closed on exec
+		l, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("socket %d (%s): %w", i+1, name, err)
+		}
+		listeners = append(listeners, namedListener{l, name})
+	}
+	return listeners, nil
+}
@@ -0,0 +1,383 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"api/internal/breaker"
+	"api/internal/mailer"
+	"api/internal/model"
+	"api/internal/pii"
+	"api/internal/report"
+	"api/internal/repository"
+	"api/internal/search"
+	"api/internal/service"
+	"api/internal/usercsv"
+)
+
+// command is a CLI subcommand, run with the arguments following its name
+type command struct {
+	name        string
+	args        string
+	description string
+	run         func(cfg Config, args []string) error
+}
+
+// commands lists the subcommands of the binary; the first one is the default
+var commands = []command{
+	{"serve", "", "start the API server (default)", runServe},
+	{"migrate", "[tenants] up|down [steps]|status", "manage schema migrations", runMigrateCommand},
+	{"seed", "[--count N] [--truncate]", "insert fake users", runSeed},
+	{"export", "[--format csv|json] [--output FILE] [--search TEXT]", "export users", runExport},
+	{"reindex", "", "rebuild the search index from the database", runReindex},
+	{"report", "[--to EMAIL] [--print]", "email the user report to its recipients now", runReport},
+	{"pii-key", "", "print a new data or index key wrapped by the PII master key", runPIIKey},
+	{"encrypt-pii", "[--batch N]", "encrypt the emails, revisions and event payloads stored in plaintext or under older data keys", runEncryptPII},
+	{"canonical-emails", "[--batch N]", "set the canonical emails of the users stored before REJECT_EMAIL_ALIASES was", runCanonicalEmails},
+	{"version", "", "print the version, commit and build time of the binary", runVersion},
+}
+
+// runCLI picks the subcommand named by the first argument and runs it
+func runCLI(cfg Config, args []string) error {
+	name := commands[0].name
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		printUsage()
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(cfg, args)
+		}
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command %q", name)
+}
+
+// printUsage lists the available subcommands
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\nCommands:\n", os.Args[0])
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-60s %s\n", cmd.name+" "+cmd.args, cmd.description)
+	}
+}
+
+// connectRepository opens the configured store and logs the connection
+func connectRepository(cfg Config) (repository.UserRepository, error) {
+	if cfg.TenantIsolation != "row" && cfg.TenantIsolation != "schema" {
+		return nil, fmt.Errorf("unknown TENANT_ISOLATION %q (expected row or schema)", cfg.TenantIsolation)
+	}
+
+	cipher, note, err := cfg.openPII()
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up PII encryption: %w", err)
+	}
+	if cipher != nil {
+		log.Printf("PII encryption: %s", note)
+	}
+
+	// Database connection using the configured store and connection string from environment variable
+	repo, err := repository.Open(repository.Config{
+		Driver:  cfg.Store,
+		DSN:     cfg.DatabaseURL,
+		ReadDSN: cfg.DatabaseReadURL,
+		Pool: repository.PoolConfig{
+			MaxConns:          cfg.DBMaxConns,
+			MinConns:          cfg.DBMinConns,
+			MaxConnLifetime:   cfg.DBMaxConnLifetime,
+			HealthCheckPeriod: cfg.DBHealthCheckPeriod,
+			StartupWait:       cfg.DBStartupWait,
+			StartupBackoff:    cfg.DBStartupBackoff,
+			CurrentDSN:        func() string { return cfg.latest().DatabaseURL },
+			CurrentReadDSN:    func() string { return cfg.latest().DatabaseReadURL },
+		},
+		Queries: repository.QueryConfig{
+			SlowThreshold: cfg.SlowQueryThreshold,
+			ReadTimeout:   cfg.QueryReadTimeout,
+			WriteTimeout:  cfg.QueryWriteTimeout,
+			ExportTimeout: cfg.QueryExportTimeout,
+
+			MaxAttempts:     cfg.DBRetryAttempts,
+			RetryBackoff:    cfg.DBRetryBackoff,
+			RetryMaxBackoff: cfg.DBRetryMaxBackoff,
+
+			Breaker: breaker.Options{
+				FailureRate:   cfg.DBBreakerFailureRate,
+				MinCalls:      cfg.DBBreakerMinCalls,
+				Window:        cfg.DBBreakerWindow,
+				ProbeInterval: cfg.DBBreakerProbeInterval,
+			},
+		},
+		SchemaPerTenant: cfg.TenantIsolation == "schema",
+		PII:             cipher,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DB: %w", err)
+	}
+	log.Printf("Successfully connected to the %s database!", cfg.Store)
+	return repo, nil
+}
+
+// runMigrateCommand runs schema migrations and exits
+func runMigrateCommand(cfg Config, args []string) error {
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	return runMigrate(repo, args)
+}
+
+// runSeed fills the database with fake users
+func runSeed(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("seed", flag.ExitOnError)
+	count := flags.Int("count", 50, "number of fake users to insert")
+	truncate := flags.Bool("truncate", false, "delete all users before seeding")
+	flags.Parse(args)
+
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	if err := migrateOnStart(repo, cfg.MigrateOnStart); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+
+	return seedUsers(repo, *count, *truncate)
+}
+
+// runExport writes users as CSV or JSON to a file or stdout
+func runExport(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "csv", "output format: csv or json")
+	output := flags.String("output", "", "file to write to (default stdout)")
+	search := flags.String("search", "", "only export users matching this search")
+	flags.Parse(args)
+
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("unknown export format %q (expected csv or json)", *format)
+	}
+
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	ctx := repository.WithReplica(repository.WithExport(context.Background()))
+	users, err := repo.List(ctx, model.ListParams{Search: *search, Sort: "name"})
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if *format == "json" {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(users)
+	} else {
+		err = usercsv.Write(w, users)
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[export] Exported %d users as %s", len(users), *format)
+	return nil
+}
+
+// runReindex recreates the search index and fills it with every user
+func runReindex(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("reindex", flag.ExitOnError)
+	flags.Parse(args)
+
+	if cfg.SearchURL == "" {
+		return fmt.Errorf("SEARCH_URL is not set")
+	}
+
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	ctx := repository.WithReplica(repository.WithExport(context.Background()))
+	users, err := repo.List(ctx, model.ListParams{})
+	if err != nil {
+		return err
+	}
+
+	if err := search.NewClient(cfg.searchConfig()).Reindex(ctx, users); err != nil {
+		return err
+	}
+
+	log.Printf("[reindex] Indexed %d users into %s", len(users), cfg.SearchIndex)
+	return nil
+}
+
+// runReport sends the user report immediately, to --to or every configured
+// recipient, or prints it with --print
+func runReport(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("report", flag.ExitOnError)
+	to := flags.String("to", "", "send the report to this address only")
+	printOnly := flags.Bool("print", false, "write the report to stdout instead of emailing it")
+	flags.Parse(args)
+
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	templates, err := mailer.NewTemplates(cfg.MailTemplatesDir, cfg.MailLocale)
+	if err != nil {
+		return err
+	}
+
+	ctx := repository.WithReplica(repository.WithExport(context.Background()))
+	if *printOnly {
+		summary, err := report.Build(ctx, repo, time.Now())
+		if err != nil {
+			return err
+		}
+		msg, err := templates.Render("report", nil, summary)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Subject: %s\n\n%s", msg.Subject, msg.Text)
+		return nil
+	}
+
+	sender, _, err := cfg.openMailer()
+	if err != nil {
+		return err
+	}
+	if sender == nil {
+		return fmt.Errorf("MAIL_PROVIDER and SMTP_ADDR are not set")
+	}
+	emails := []string{*to}
+	if *to == "" {
+		recipients, err := report.ParseRecipients(cfg.ReportRecipients, cfg.ReportSchedule)
+		if err != nil {
+			return err
+		}
+		if len(recipients) == 0 {
+			return fmt.Errorf("REPORT_RECIPIENTS is not set")
+		}
+		emails = emails[:0]
+		for _, recipient := range recipients {
+			emails = append(emails, recipient.Email)
+		}
+	}
+
+	reporter := &report.Reporter{Stats: repo, Sender: sender, Templates: templates, Clock: time.Now, Logger: log.Default()}
+	return reporter.Send(ctx, emails...)
+}
+
+// runPIIKey prints a new key wrapped by the master key, for PII_DATA_KEYS or PII_INDEX_KEY
+func runPIIKey(cfg Config, args []string) error {
+	wrapper, _, err := cfg.piiWrapper()
+	if err != nil {
+		return err
+	}
+	if wrapper == nil {
+		return fmt.Errorf("set PII_MASTER_KEY or PII_VAULT_KEY first")
+	}
+	wrapped, err := pii.GenerateKey(context.Background(), wrapper)
+	if err != nil {
+		return err
+	}
+	fmt.Println(base64.StdEncoding.EncodeToString(wrapped))
+	return nil
+}
+
+// runEncryptPII encrypts the emails, revisions and event payloads left in
+// plaintext, or under a data key that is being retired, with the current
+// data key
+func runEncryptPII(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("encrypt-pii", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "number of rows encrypted per query")
+	flags.Parse(args)
+
+	if len(cfg.PIIDataKeys) == 0 {
+		return fmt.Errorf("PII_DATA_KEYS is not set")
+	}
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	encrypter, ok := repo.(repository.PIIEncrypter)
+	if !ok {
+		return fmt.Errorf("the %s store keeps nothing to encrypt", cfg.Store)
+	}
+	if err := migrateOnStart(repo, cfg.MigrateOnStart); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	encrypted, err := encrypter.EncryptPII(context.Background(), *batch)
+	if err != nil {
+		return fmt.Errorf("encrypted %d values before failing: %w", encrypted, err)
+	}
+	log.Printf("Encrypted %d emails, revisions and event payloads", encrypted)
+	return nil
+}
+
+// runCanonicalEmails sets the canonical emails of the users stored before
+// REJECT_EMAIL_ALIASES was set, which aliases are looked for among
+func runCanonicalEmails(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("canonical-emails", flag.ExitOnError)
+	batch := flags.Int("batch", 500, "number of users updated per query")
+	flags.Parse(args)
+
+	if !cfg.RejectEmailAliases {
+		return fmt.Errorf("REJECT_EMAIL_ALIASES is not set")
+	}
+	repo, err := connectRepository(cfg)
+	if err != nil {
+		return err
+	}
+	defer repo.Close()
+
+	filler, ok := repo.(repository.CanonicalEmailFiller)
+	if !ok {
+		return fmt.Errorf("the %s store keeps nothing to fill", cfg.Store)
+	}
+	if err := migrateOnStart(repo, cfg.MigrateOnStart); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
+	}
+	filled, duplicates, err := filler.FillCanonicalEmails(context.Background(), service.CanonicalEmail, *batch)
+	if err != nil {
+		return fmt.Errorf("set the canonical emails of %d users before failing: %w", filled, err)
+	}
+	log.Printf("Set the canonical emails of %d users", filled)
+	if len(duplicates) > 0 {
+		return fmt.Errorf("the emails of users %v are aliases of others, change them and run canonical-emails again", duplicates)
+	}
+	return nil
+}
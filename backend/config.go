@@ -0,0 +1,1123 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/internal/events"
+	"api/internal/flags"
+	"api/internal/handler"
+	"api/internal/mailer"
+	"api/internal/model"
+	"api/internal/pii"
+	"api/internal/sanitize"
+	"api/internal/search"
+	"api/internal/secrets"
+	"api/internal/service"
+	"api/internal/sms"
+	"api/internal/storage"
+)
+
+// Config holds the runtime settings of the API, read from environment variables
+type Config struct {
+	// Store selects the database backend: postgres, sqlite, mysql or memory
+	Store       string
+	DatabaseURL string
+	// DatabaseReadURL, when set, connects to a read replica serving the
+	// reads of GET requests and exports
+	DatabaseReadURL string
+
+	// Connection pool settings; zero keeps the driver defaults
+	DBMaxConns          int32
+	DBMinConns          int32
+	DBMaxConnLifetime   time.Duration
+	DBHealthCheckPeriod time.Duration
+	// DBStartupWait is how long to wait at startup for the database to
+	// accept connections, pinging it from every DBStartupBackoff; zero
+	// fails at once
+	DBStartupWait    time.Duration
+	DBStartupBackoff time.Duration
+	// SlowQueryThreshold is the duration past which queries are logged as
+	// slow; zero logs none
+	SlowQueryThreshold time.Duration
+	// Timeouts of each query that reads, writes or is part of an export;
+	// zero leaves it to the deadline of the request
+	QueryReadTimeout   time.Duration
+	QueryWriteTimeout  time.Duration
+	QueryExportTimeout time.Duration
+	// DBRetryAttempts bounds the attempts at an operation failing with a
+	// transient database error, waiting from DBRetryBackoff, doubled each
+	// time up to DBRetryMaxBackoff
+	DBRetryAttempts   int
+	DBRetryBackoff    time.Duration
+	DBRetryMaxBackoff time.Duration
+	// Once DBBreakerFailureRate of at least DBBreakerMinCalls queries within
+	// DBBreakerWindow fail to reach the database, queries are rejected until
+	// a probe every DBBreakerProbeInterval reaches it again; a zero rate
+	// never rejects them
+	DBBreakerFailureRate   float64
+	DBBreakerMinCalls      int
+	DBBreakerWindow        time.Duration
+	DBBreakerProbeInterval time.Duration
+
+	// MigrateOnStart applies pending schema migrations when the server boots
+	MigrateOnStart bool
+
+	// HealthCheckTimeout is how long /health waits for each dependency
+	HealthCheckTimeout time.Duration
+	// Metrics exposes the metrics at /metrics in the Prometheus format
+	Metrics bool
+
+	// RequestTimeout is the deadline of every request; zero disables it
+	RequestTimeout time.Duration
+
+	// MaxBodyBytes caps the size of request bodies; zero disables the limit
+	MaxBodyBytes int64
+
+	// CORS policy: the origins whose scripts may call the API, "*" for any,
+	// the methods and headers they may use, the response headers they may
+	// read, whether they may send cookies, and how long browsers cache
+	// preflights; empty methods and headers keep the handler defaults
+	CORSAllowedOrigins   []string
+	CORSAllowedMethods   []string
+	CORSAllowedHeaders   []string
+	CORSExposedHeaders   []string
+	CORSAllowCredentials bool
+	CORSMaxAge           time.Duration
+
+	// IP filtering: IPAllow and IPDeny list the networks allowed to reach,
+	// or denied, a group of routes, as entries such as "admin=10.0.0.0/8",
+	// the group "*" covering every route. Client IPs are read from
+	// X-Forwarded-For behind TrustedProxies.
+	IPAllow        []string
+	IPDeny         []string
+	TrustedProxies []string
+
+	// Load shedding: MaxInFlight caps the requests served at once, and
+	// MaxInFlightGroups those of route groups, as entries such as
+	// "users=50"; requests past a cap get a 503 telling them to retry after
+	// LoadShedRetryAfter. Zero caps nothing.
+	MaxInFlight        int
+	MaxInFlightGroups  []string
+	LoadShedRetryAfter time.Duration
+
+	// TeamScope limits the users that callers without one of the
+	// TeamScopeExemptRoles list to themselves and their teammates
+	TeamScope            bool
+	TeamScopeExemptRoles []string
+
+	// FieldRules hide fields of other users from the callers without one of
+	// their roles, as entries of a field, "=", omit or mask, and optionally
+	// ":" and the roles seeing it separated by "|", FieldRuleRoles otherwise
+	FieldRules     []string
+	FieldRuleRoles []string
+
+	// Gzip compression of responses for clients that accept it
+	GzipEnabled bool
+	GzipMinSize int
+	GzipTypes   []string
+
+	// RejectEmailAliases treats plus-addressed emails (ann+news@example.com) as duplicates
+	RejectEmailAliases bool
+
+	// Sanitization of the HTML in stored text: SanitizeMode (keep, strip or
+	// escape) applies to every field but those SanitizeFields gives another,
+	// as entries such as "users.metadata=escape"
+	SanitizeMode   string
+	SanitizeFields []string
+
+	// Encryption of the emails of users: PIIDataKeys are entries of a key
+	// ID, ":" and a data key wrapped by the master key, base64 encoded, the
+	// first encrypting, and PIIIndexKey the wrapped key of the blind index.
+	// The master key is PIIMasterKey, base64 encoded, or the transit key
+	// PIIVaultKey of the Vault at VaultAddr, mounted at PIIVaultMount.
+	PIIDataKeys   []string
+	PIIIndexKey   string
+	PIIMasterKey  string
+	PIIVaultKey   string
+	PIIVaultMount string
+	VaultAddr     string
+	VaultToken    string
+
+	// Settings whose value is "secret:" and a reference such as
+	// "app/database#password" are read from SecretsProvider: "vault", the KV
+	// engine mounted at SecretsVaultMount of the Vault at VaultAddr, or
+	// "aws", AWS Secrets Manager. They are read at startup and again every
+	// SecretsRefreshInterval, zero reading them at startup only.
+	SecretsProvider        string
+	SecretsVaultMount      string
+	SecretsAWSEndpoint     string
+	SecretsAWSRegion       string
+	SecretsAWSAccessKey    string
+	SecretsAWSSecretKey    string
+	SecretsAWSSessionToken string
+	SecretsRefreshInterval time.Duration
+
+	// ServeFrontend serves the web app on the paths of no route when the
+	// binary was built with it, see the frontend package
+	ServeFrontend bool
+
+	// APIPreview serves the versions of the API that are still changing,
+	// such as /api/go/v2, for trying them out before their release
+	APIPreview bool
+
+	// LogPII writes the personal data in log output as is, and the
+	// queries run with their arguments, for local debugging; by default
+	// emails, phones, names, birth dates and addresses are masked
+	LogPII bool
+
+	// IdempotencyWindow is how long Idempotency-Key responses are replayed; zero disables them
+	IdempotencyWindow time.Duration
+
+	// ErrorFormat is "envelope" (APIResponse) or "problem" (RFC 7807 problem+json)
+	ErrorFormat string
+
+	// Search settings; without SEARCH_URL users aren't mirrored into a search index
+	SearchURL      string
+	SearchIndex    string
+	SearchUsername string
+	SearchPassword string
+
+	// File storage for uploads such as avatars: "local" keeps them in
+	// StorageDir, "s3" in an S3-compatible bucket
+	StorageBackend string
+	StorageDir     string
+	AvatarMaxBytes int64
+	AvatarSizes    []int
+	// AvatarMaxPixels caps the width times the height of avatars
+	AvatarMaxPixels int
+	S3Endpoint      string
+	S3Region        string
+	S3Bucket        string
+	S3AccessKey     string
+	S3SecretKey     string
+	S3PathStyle     bool
+	S3PresignTTL    time.Duration
+
+	// Provider sending emails from MailFrom: "smtp" through the SMTP server,
+	// "sendgrid" or "ses" through their APIs, or "log" to only log them.
+	// It defaults to "smtp" when SMTPAddr is set; otherwise emails are off.
+	// Emails are rendered from the embedded templates, or those of
+	// MailTemplatesDir overriding them, in MailLocale unless the client
+	// prefers another locale there are templates in.
+	MailProvider     string
+	MailFrom         string
+	MailTemplatesDir string
+	MailLocale       string
+	SMTPAddr         string
+	SMTPUsername     string
+	SMTPPassword     string
+	SendGridAPIKey   string
+	SESEndpoint      string
+	SESRegion        string
+	SESAccessKey     string
+	SESSecretKey     string
+
+	// Provider sending text messages from SMSFrom: "twilio" or "vonage"
+	// through their APIs, or "log" to only log them. It defaults to the
+	// provider whose credentials are set; otherwise text messages are off.
+	// At most SMSRateLimit messages go to each country within SMSRateWindow,
+	// unless SMSCountryLimits, such as "ID=500,NG=0", sets another limit for
+	// it, zero blocking the country.
+	SMSProvider      string
+	SMSFrom          string
+	SMSRateLimit     int
+	SMSRateWindow    time.Duration
+	SMSCountryLimits []string
+	TwilioAccountSID string
+	TwilioAuthToken  string
+	VonageAPIKey     string
+	VonageAPISecret  string
+
+	// Invitations emailed through the mail provider; without a secret to sign
+	// their links they are disabled. InviteURL is the link sent, in which
+	// {token} is replaced by the invitation token.
+	InviteSecret string
+	InviteTTL    time.Duration
+	InviteURL    string
+
+	// Authentication with access tokens signed with AuthSecret; without it
+	// logging in and registration are disabled. Self-registered users get
+	// SignupRole and verify their email through VerifyURL, in which {token}
+	// is replaced by the verification token. Forgotten passwords are reset
+	// through ResetURL, with at most PasswordResetEmailLimit emails per
+	// address and PasswordResetIPLimit requests per client IP within
+	// PasswordResetWindow. Logging in is refused after LoginAccountLimit
+	// failures to an account, or LoginIPLimit from a client IP, within
+	// LoginWindow. Cookie sessions last SessionTTL, in the
+	// SessionCookie cookie, marked Secure unless SessionCookieSecure is off,
+	// and their CSRF token is in the CSRFCookie cookie.
+	// Admins, the users with one of AdminRoles, impersonate users with
+	// tokens lasting ImpersonationTTL.
+	AuthSecret              string
+	AccessTokenTTL          time.Duration
+	VerifyTTL               time.Duration
+	VerifyURL               string
+	SignupRole              string
+	PasswordResetTTL        time.Duration
+	ResetURL                string
+	PasswordResetEmailLimit int
+	PasswordResetIPLimit    int
+	PasswordResetWindow     time.Duration
+	LoginAccountLimit       int
+	LoginIPLimit            int
+	LoginWindow             time.Duration
+	SessionTTL              time.Duration
+	SessionCookie           string
+	SessionCookieSecure     bool
+	CSRFCookie              string
+	ImpersonationTTL        time.Duration
+	AdminRoles              []string
+
+	// AuditLog records the requests changing something, and those made
+	// while impersonating, in the audit_log table
+	AuditLog bool
+
+	// Background job queue in the jobs table, run by JobWorkers workers per
+	// instance; without it emails are sent while serving the request and
+	// CSV imports, of at most ImportMaxBytes, are disabled
+	JobQueue             bool
+	JobWorkers           int
+	JobPollInterval      time.Duration
+	JobVisibilityTimeout time.Duration
+	JobMaxAttempts       int
+	JobBackoff           time.Duration
+	JobMaxBackoff        time.Duration
+	ImportMaxBytes       int64
+
+	// Recurring tasks, each enabled on its own, run on a cron schedule and
+	// delayed by up to TaskJitter: birthday greetings emailed to users, and
+	// the cleanup of expired sessions, and of imports and dead jobs older
+	// than TaskCleanupAfter
+	TaskJitter                    time.Duration
+	TaskBirthdayGreetings         bool
+	TaskBirthdayGreetingsSchedule string
+	TaskCleanup                   bool
+	TaskCleanupSchedule           string
+	TaskCleanupAfter              time.Duration
+
+	// Retention purges audit log entries older than RetentionAuditDays for
+	// good, or only logs what it would purge in dry-run mode; 0 keeps them
+	RetentionAuditDays int
+	RetentionDryRun    bool
+	RetentionSchedule  string
+
+	// Domain events recorded in the outbox with the changes of users, and
+	// published by a relay on every instance through EventPublisher: "kafka"
+	// to KafkaTopic, as JSON or Avro, "nats" to the JetStream subjects
+	// starting with NATSSubjectPrefix, "rabbitmq" to RabbitMQExchange, or
+	// "log" to only log them. It defaults to "kafka" when KafkaBrokers are
+	// set, "nats" when NATSURL is and "rabbitmq" when RabbitMQURL is;
+	// otherwise events stay in the outbox.
+	EventPublisher      string
+	EventPollInterval   time.Duration
+	EventBatchSize      int
+	EventLockTimeout    time.Duration
+	EventBackoff        time.Duration
+	EventMaxBackoff     time.Duration
+	KafkaBrokers        []string
+	KafkaTopic          string
+	KafkaFormat         string
+	KafkaSchemaRegistry string
+	KafkaUsername       string
+	KafkaPassword       string
+	KafkaTLS            bool
+	NATSURL             string
+	NATSSubjectPrefix   string
+	NATSStream          string
+	RabbitMQURL         string
+	RabbitMQExchange    string
+
+	// Scheduled user reports; without recipients no reports are sent
+	ReportRecipients string
+	ReportSchedule   string
+
+	// ListenAddr is the address plain HTTP is served on, HOST and PORT
+	// unless LISTEN_ADDR is set; HTTPS is served on TLSAddr instead
+	ListenAddr string
+	// UnixSocket, when set, is the path of a unix socket plain HTTP is
+	// served on too, for a reverse proxy of the same host, with the
+	// permissions of UnixSocketMode, in octal, and the group UnixSocketGroup
+	// when set. An empty LISTEN_ADDR serves on the socket alone.
+	UnixSocket      string
+	UnixSocketMode  string
+	UnixSocketGroup string
+	// ListenReusePort sets SO_REUSEPORT on the TCP listeners, so that the
+	// next binary can listen on the same address before this one stops
+	ListenReusePort bool
+	// ShutdownTimeout is how long the server waits for the requests in
+	// flight on SIGTERM before cutting them off
+	ShutdownTimeout time.Duration
+	// Limits of the HTTP server, so that clients trickling requests in or
+	// leaving connections open, as slowloris does, can't hold connections
+	// forever; zero disables a timeout
+	HTTPReadHeaderTimeout time.Duration
+	HTTPReadTimeout       time.Duration
+	HTTPWriteTimeout      time.Duration
+	HTTPIdleTimeout       time.Duration
+	HTTPMaxHeaderBytes    int
+
+	// TLS settings; leaving both the cert/key pair and autocert unset serves plain HTTP
+	TLSCertFile      string
+	TLSKeyFile       string
+	TLSAddr          string
+	TLSRedirectAddr  string
+	AutocertEnabled  bool
+	AutocertHosts    []string
+	AutocertCacheDir string
+	AutocertEmail    string
+
+	// Authorization policy settings; with no files, bundle URL or database
+	// permissions the policy engine is disabled
+	PolicyFiles            []string
+	PolicyBundleURL        string
+	PolicyBundleInterval   time.Duration
+	PolicyDatabase         bool
+	PolicyDatabaseInterval time.Duration
+	PolicyMode             string
+	PolicyDecisionLog      bool
+
+	// FeatureFlags changes the defaults of feature flags, as entries such
+	// as "search_full_text=false"; the overrides stored in the database are
+	// reloaded every FeatureFlagsInterval
+	FeatureFlags         []string
+	FeatureFlagsInterval time.Duration
+
+	// MultiTenant scopes every request to the organization in its token or
+	// X-Org-ID header; TenantIsolation is "row" to share tables filtered by
+	// org_id, or "schema" to give each organization a Postgres schema
+	MultiTenant     bool
+	TenantIsolation string
+}
+
+// loadConfig reads the configuration from the environment, applying defaults
+func loadConfig() Config {
+	return Config{
+		Store:           getEnv("STORE", "postgres"),
+		DatabaseURL:     os.Getenv("DATABASE_URL"),
+		DatabaseReadURL: os.Getenv("DATABASE_READ_URL"),
+
+		DBMaxConns:          int32(getEnvInt("DB_MAX_CONNS", 0)),
+		DBMinConns:          int32(getEnvInt("DB_MIN_CONNS", 0)),
+		DBMaxConnLifetime:   getEnvDuration("DB_MAX_CONN_LIFETIME", 0),
+		DBHealthCheckPeriod: getEnvDuration("DB_HEALTH_CHECK_PERIOD", 0),
+		DBStartupWait:       getEnvDuration("DB_STARTUP_WAIT", 30*time.Second),
+		DBStartupBackoff:    getEnvDuration("DB_STARTUP_BACKOFF", 500*time.Millisecond),
+		SlowQueryThreshold:  getEnvDuration("SLOW_QUERY_THRESHOLD", 500*time.Millisecond),
+		QueryReadTimeout:    getEnvDuration("QUERY_READ_TIMEOUT", 10*time.Second),
+		QueryWriteTimeout:   getEnvDuration("QUERY_WRITE_TIMEOUT", 10*time.Second),
+		QueryExportTimeout:  getEnvDuration("QUERY_EXPORT_TIMEOUT", 5*time.Minute),
+		DBRetryAttempts:     getEnvInt("DB_RETRY_ATTEMPTS", 3),
+		DBRetryBackoff:      getEnvDuration("DB_RETRY_BACKOFF", 50*time.Millisecond),
+		DBRetryMaxBackoff:   getEnvDuration("DB_RETRY_MAX_BACKOFF", time.Second),
+
+		DBBreakerFailureRate:   getEnvFloat("DB_BREAKER_FAILURE_RATE", 0.5),
+		DBBreakerMinCalls:      getEnvInt("DB_BREAKER_MIN_CALLS", 10),
+		DBBreakerWindow:        getEnvDuration("DB_BREAKER_WINDOW", 10*time.Second),
+		DBBreakerProbeInterval: getEnvDuration("DB_BREAKER_PROBE_INTERVAL", 5*time.Second),
+
+		MigrateOnStart: getEnvBool("MIGRATE_ON_START", true),
+
+		HealthCheckTimeout: getEnvDuration("HEALTH_CHECK_TIMEOUT", 2*time.Second),
+		Metrics:            getEnvBool("METRICS", true),
+
+		RequestTimeout: getEnvDuration("REQUEST_TIMEOUT", 30*time.Second),
+
+		MaxBodyBytes: int64(getEnvInt("MAX_BODY_BYTES", 1<<20)),
+
+		CORSAllowedOrigins:   getEnvStrings("CORS_ALLOWED_ORIGINS", []string{"*"}),
+		CORSAllowedMethods:   getEnvList("CORS_ALLOWED_METHODS"),
+		CORSAllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS"),
+		CORSExposedHeaders:   getEnvList("CORS_EXPOSED_HEADERS"),
+		CORSAllowCredentials: getEnvBool("CORS_ALLOW_CREDENTIALS", false),
+		CORSMaxAge:           getEnvDuration("CORS_MAX_AGE", 10*time.Minute),
+
+		IPAllow:        getEnvList("IP_ALLOW"),
+		IPDeny:         getEnvList("IP_DENY"),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+
+		MaxInFlight:        getEnvInt("MAX_IN_FLIGHT", 0),
+		MaxInFlightGroups:  getEnvList("MAX_IN_FLIGHT_GROUPS"),
+		LoadShedRetryAfter: getEnvDuration("LOAD_SHED_RETRY_AFTER", time.Second),
+
+		TeamScope:            getEnvBool("TEAM_SCOPE", true),
+		TeamScopeExemptRoles: getEnvStrings("TEAM_SCOPE_EXEMPT_ROLES", []string{"admin"}),
+
+		FieldRules:     getEnvStrings("FIELD_RULES", []string{"email=mask", "birth=omit"}),
+		FieldRuleRoles: getEnvStrings("FIELD_RULE_ROLES", []string{"admin"}),
+
+		GzipEnabled: getEnvBool("GZIP_ENABLED", true),
+		GzipMinSize: getEnvInt("GZIP_MIN_SIZE", 1024),
+		GzipTypes:   getEnvList("GZIP_TYPES"),
+
+		RejectEmailAliases: getEnvBool("REJECT_EMAIL_ALIASES", false),
+
+		SanitizeMode:   getEnv("SANITIZE_MODE", "strip"),
+		SanitizeFields: getEnvList("SANITIZE_FIELDS"),
+
+		PIIDataKeys:   getEnvList("PII_DATA_KEYS"),
+		PIIIndexKey:   os.Getenv("PII_INDEX_KEY"),
+		PIIMasterKey:  os.Getenv("PII_MASTER_KEY"),
+		PIIVaultKey:   os.Getenv("PII_VAULT_KEY"),
+		PIIVaultMount: getEnv("PII_VAULT_MOUNT", "transit"),
+		VaultAddr:     getEnv("VAULT_ADDR", "http://127.0.0.1:8200"),
+		VaultToken:    os.Getenv("VAULT_TOKEN"),
+
+		SecretsProvider:        os.Getenv("SECRETS_PROVIDER"),
+		SecretsVaultMount:      getEnv("SECRETS_VAULT_MOUNT", "secret"),
+		SecretsAWSEndpoint:     os.Getenv("SECRETS_AWS_ENDPOINT"),
+		SecretsAWSRegion:       getEnv("SECRETS_AWS_REGION", getEnv("AWS_REGION", "us-east-1")),
+		SecretsAWSAccessKey:    getEnv("SECRETS_AWS_ACCESS_KEY_ID", os.Getenv("AWS_ACCESS_KEY_ID")),
+		SecretsAWSSecretKey:    getEnv("SECRETS_AWS_SECRET_ACCESS_KEY", os.Getenv("AWS_SECRET_ACCESS_KEY")),
+		SecretsAWSSessionToken: getEnv("SECRETS_AWS_SESSION_TOKEN", os.Getenv("AWS_SESSION_TOKEN")),
+		SecretsRefreshInterval: getEnvDuration("SECRETS_REFRESH_INTERVAL", 5*time.Minute),
+
+		ServeFrontend: getEnvBool("SERVE_FRONTEND", true),
+
+		APIPreview: getEnvBool("API_PREVIEW", false),
+
+		LogPII: getEnvBool("LOG_PII", false),
+
+		IdempotencyWindow: getEnvDuration("IDEMPOTENCY_WINDOW", 24*time.Hour),
+
+		ErrorFormat: getEnv("ERROR_FORMAT", "envelope"),
+
+		SearchURL:      os.Getenv("SEARCH_URL"),
+		SearchIndex:    getEnv("SEARCH_INDEX", "users"),
+		SearchUsername: os.Getenv("SEARCH_USERNAME"),
+		SearchPassword: os.Getenv("SEARCH_PASSWORD"),
+
+		StorageBackend:  getEnv("STORAGE_BACKEND", "local"),
+		StorageDir:      getEnv("STORAGE_DIR", "uploads"),
+		AvatarMaxBytes:  int64(getEnvInt("AVATAR_MAX_BYTES", 2<<20)),
+		AvatarSizes:     getEnvInts("AVATAR_SIZES", []int{64, 256}),
+		AvatarMaxPixels: getEnvInt("AVATAR_MAX_PIXELS", 4096*4096),
+		S3Endpoint:      os.Getenv("S3_ENDPOINT"),
+		S3Region:        getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:        os.Getenv("S3_BUCKET"),
+		S3AccessKey:     os.Getenv("S3_ACCESS_KEY_ID"),
+		S3SecretKey:     os.Getenv("S3_SECRET_ACCESS_KEY"),
+		S3PathStyle:     getEnvBool("S3_PATH_STYLE", false),
+		S3PresignTTL:    getEnvDuration("S3_PRESIGN_TTL", 15*time.Minute),
+
+		MailProvider:     os.Getenv("MAIL_PROVIDER"),
+		MailFrom:         getEnv("MAIL_FROM", getEnv("SMTP_FROM", "no-reply@localhost")),
+		MailTemplatesDir: os.Getenv("MAIL_TEMPLATES_DIR"),
+		MailLocale:       getEnv("MAIL_LOCALE", mailer.DefaultLocale),
+		SMTPAddr:         os.Getenv("SMTP_ADDR"),
+		SMTPUsername:     os.Getenv("SMTP_USERNAME"),
+		SMTPPassword:     os.Getenv("SMTP_PASSWORD"),
+		SendGridAPIKey:   os.Getenv("SENDGRID_API_KEY"),
+		SESEndpoint:      os.Getenv("SES_ENDPOINT"),
+		SESRegion:        getEnv("SES_REGION", "us-east-1"),
+		SESAccessKey:     os.Getenv("SES_ACCESS_KEY_ID"),
+		SESSecretKey:     os.Getenv("SES_SECRET_ACCESS_KEY"),
+
+		SMSProvider:      os.Getenv("SMS_PROVIDER"),
+		SMSFrom:          os.Getenv("SMS_FROM"),
+		SMSRateLimit:     getEnvInt("SMS_RATE_LIMIT", 100),
+		SMSRateWindow:    getEnvDuration("SMS_RATE_WINDOW", time.Hour),
+		SMSCountryLimits: getEnvList("SMS_COUNTRY_LIMITS"),
+		TwilioAccountSID: os.Getenv("TWILIO_ACCOUNT_SID"),
+		TwilioAuthToken:  os.Getenv("TWILIO_AUTH_TOKEN"),
+		VonageAPIKey:     os.Getenv("VONAGE_API_KEY"),
+		VonageAPISecret:  os.Getenv("VONAGE_API_SECRET"),
+
+		InviteSecret: os.Getenv("INVITE_SECRET"),
+		InviteTTL:    getEnvDuration("INVITE_TTL", 7*24*time.Hour),
+		InviteURL:    getEnv("INVITE_URL", "http://localhost:3000/invitations/{token}"),
+
+		AuthSecret:              os.Getenv("AUTH_SECRET"),
+		AccessTokenTTL:          getEnvDuration("AUTH_TOKEN_TTL", time.Hour),
+		VerifyTTL:               getEnvDuration("VERIFY_TTL", 24*time.Hour),
+		VerifyURL:               getEnv("VERIFY_URL", "http://localhost:8000/api/go/verify?token={token}"),
+		SignupRole:              getEnv("SIGNUP_ROLE", "user"),
+		PasswordResetTTL:        getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		ResetURL:                getEnv("RESET_URL", "http://localhost:3000/reset-password?token={token}"),
+		PasswordResetEmailLimit: getEnvInt("PASSWORD_RESET_EMAIL_LIMIT", 3),
+		PasswordResetIPLimit:    getEnvInt("PASSWORD_RESET_IP_LIMIT", 10),
+		PasswordResetWindow:     getEnvDuration("PASSWORD_RESET_WINDOW", time.Hour),
+		LoginAccountLimit:       getEnvInt("LOGIN_ACCOUNT_LIMIT", 5),
+		LoginIPLimit:            getEnvInt("LOGIN_IP_LIMIT", 20),
+		LoginWindow:             getEnvDuration("LOGIN_WINDOW", 15*time.Minute),
+		SessionTTL:              getEnvDuration("SESSION_TTL", 24*time.Hour),
+		SessionCookie:           getEnv("SESSION_COOKIE", "session"),
+		SessionCookieSecure:     getEnvBool("SESSION_COOKIE_SECURE", true),
+		CSRFCookie:              getEnv("CSRF_COOKIE", "csrf_token"),
+		ImpersonationTTL:        getEnvDuration("IMPERSONATION_TTL", 15*time.Minute),
+		AdminRoles:              getEnvStrings("ADMIN_ROLES", []string{"admin"}),
+		AuditLog:                getEnvBool("AUDIT_LOG", true),
+
+		JobQueue:             getEnvBool("JOB_QUEUE", true),
+		JobWorkers:           getEnvInt("JOB_WORKERS", 2),
+		JobPollInterval:      getEnvDuration("JOB_POLL_INTERVAL", time.Second),
+		JobVisibilityTimeout: getEnvDuration("JOB_VISIBILITY_TIMEOUT", 5*time.Minute),
+		JobMaxAttempts:       getEnvInt("JOB_MAX_ATTEMPTS", 5),
+		JobBackoff:           getEnvDuration("JOB_BACKOFF", 30*time.Second),
+		JobMaxBackoff:        getEnvDuration("JOB_MAX_BACKOFF", time.Hour),
+		ImportMaxBytes:       int64(getEnvInt("IMPORT_MAX_BYTES", 10<<20)),
+
+		TaskJitter:                    getEnvDuration("TASK_JITTER", time.Minute),
+		TaskBirthdayGreetings:         getEnvBool("TASK_BIRTHDAY_GREETINGS", false),
+		TaskBirthdayGreetingsSchedule: getEnv("TASK_BIRTHDAY_GREETINGS_SCHEDULE", "0 9 * * *"),
+		TaskCleanup:                   getEnvBool("TASK_CLEANUP", true),
+		TaskCleanupSchedule:           getEnv("TASK_CLEANUP_SCHEDULE", "0 3 * * *"),
+		TaskCleanupAfter:              getEnvDuration("TASK_CLEANUP_AFTER", 30*24*time.Hour),
+
+		RetentionAuditDays: getEnvInt("RETENTION_AUDIT_DAYS", 0),
+		RetentionDryRun:    getEnvBool("RETENTION_DRY_RUN", false),
+		RetentionSchedule:  getEnv("RETENTION_SCHEDULE", "30 3 * * *"),
+
+		EventPublisher:      os.Getenv("EVENT_PUBLISHER"),
+		EventPollInterval:   getEnvDuration("EVENT_POLL_INTERVAL", time.Second),
+		EventBatchSize:      getEnvInt("EVENT_BATCH_SIZE", 100),
+		EventLockTimeout:    getEnvDuration("EVENT_LOCK_TIMEOUT", 30*time.Second),
+		EventBackoff:        getEnvDuration("EVENT_BACKOFF", 5*time.Second),
+		EventMaxBackoff:     getEnvDuration("EVENT_MAX_BACKOFF", 5*time.Minute),
+		KafkaBrokers:        getEnvList("KAFKA_BROKERS"),
+		KafkaTopic:          getEnv("KAFKA_TOPIC", "user-events"),
+		KafkaFormat:         getEnv("KAFKA_FORMAT", "json"),
+		KafkaSchemaRegistry: os.Getenv("KAFKA_SCHEMA_REGISTRY_URL"),
+		KafkaUsername:       os.Getenv("KAFKA_USERNAME"),
+		KafkaPassword:       os.Getenv("KAFKA_PASSWORD"),
+		KafkaTLS:            getEnvBool("KAFKA_TLS", false),
+		NATSURL:             os.Getenv("NATS_URL"),
+		NATSSubjectPrefix:   getEnv("NATS_SUBJECT_PREFIX", "events"),
+		NATSStream:          os.Getenv("NATS_STREAM"),
+		RabbitMQURL:         os.Getenv("RABBITMQ_URL"),
+		RabbitMQExchange:    getEnv("RABBITMQ_EXCHANGE", "user-events"),
+
+		ReportRecipients: os.Getenv("REPORT_RECIPIENTS"),
+		ReportSchedule:   getEnv("REPORT_SCHEDULE", "0 8 * * 1"),
+
+		ListenAddr:            getEnv("LISTEN_ADDR", net.JoinHostPort(os.Getenv("HOST"), getEnv("PORT", "8000"))),
+		UnixSocket:            os.Getenv("UNIX_SOCKET"),
+		UnixSocketMode:        getEnv("UNIX_SOCKET_MODE", "0660"),
+		UnixSocketGroup:       os.Getenv("UNIX_SOCKET_GROUP"),
+		ListenReusePort:       getEnvBool("LISTEN_REUSE_PORT", false),
+		ShutdownTimeout:       getEnvDuration("SHUTDOWN_TIMEOUT", 30*time.Second),
+		HTTPReadHeaderTimeout: getEnvDuration("HTTP_READ_HEADER_TIMEOUT", 10*time.Second),
+		HTTPReadTimeout:       getEnvDuration("HTTP_READ_TIMEOUT", time.Minute),
+		HTTPWriteTimeout:      getEnvDuration("HTTP_WRITE_TIMEOUT", 2*time.Minute),
+		HTTPIdleTimeout:       getEnvDuration("HTTP_IDLE_TIMEOUT", 2*time.Minute),
+		HTTPMaxHeaderBytes:    getEnvInt("HTTP_MAX_HEADER_BYTES", 1<<20),
+
+		TLSCertFile:      os.Getenv("TLS_CERT_FILE"),
+		TLSKeyFile:       os.Getenv("TLS_KEY_FILE"),
+		TLSAddr:          getEnv("TLS_ADDR", ":443"),
+		TLSRedirectAddr:  getEnv("TLS_REDIRECT_ADDR", ":80"),
+		AutocertEnabled:  getEnvBool("AUTOCERT_ENABLED", false),
+		AutocertHosts:    getEnvList("AUTOCERT_HOSTS"),
+		AutocertCacheDir: getEnv("AUTOCERT_CACHE_DIR", "certs"),
+		AutocertEmail:    os.Getenv("AUTOCERT_EMAIL"),
+
+		PolicyFiles:            getEnvList("POLICY_FILES"),
+		PolicyBundleURL:        os.Getenv("POLICY_BUNDLE_URL"),
+		PolicyBundleInterval:   getEnvDuration("POLICY_BUNDLE_INTERVAL", time.Minute),
+		PolicyDatabase:         getEnvBool("POLICY_DATABASE", false),
+		PolicyDatabaseInterval: getEnvDuration("POLICY_DATABASE_INTERVAL", 30*time.Second),
+		PolicyMode:             getEnv("POLICY_MODE", "enforce"),
+		PolicyDecisionLog:      getEnvBool("POLICY_DECISION_LOG", false),
+
+		FeatureFlags:         getEnvList("FEATURE_FLAGS"),
+		FeatureFlagsInterval: getEnvDuration("FEATURE_FLAGS_INTERVAL", 30*time.Second),
+
+		MultiTenant:     getEnvBool("MULTI_TENANT", false),
+		TenantIsolation: getEnv("TENANT_ISOLATION", "row"),
+	}
+}
+
+// searchConfig returns the settings of the search client
+func (c Config) searchConfig() search.Config {
+	return search.Config{URL: c.SearchURL, Index: c.SearchIndex, Username: c.SearchUsername, Password: c.SearchPassword}
+}
+
+// openStorage opens the configured file storage, with a note describing it
+func (c Config) openStorage() (storage.Store, string, error) {
+	switch c.StorageBackend {
+	case "local":
+		store, err := storage.NewLocal(c.StorageDir)
+		return store, "local directory " + c.StorageDir, err
+	case "s3":
+		store, err := storage.NewS3(storage.S3Config{
+			Endpoint:  c.S3Endpoint,
+			Region:    c.S3Region,
+			Bucket:    c.S3Bucket,
+			AccessKey: c.S3AccessKey,
+			SecretKey: c.S3SecretKey,
+			PathStyle: c.S3PathStyle,
+		})
+		return store, "S3 bucket " + c.S3Bucket, err
+	default:
+		return nil, "", fmt.Errorf("unknown STORAGE_BACKEND %q (expected local or s3)", c.StorageBackend)
+	}
+}
+
+// openMailer returns the configured mail provider, with a note describing
+// it, or nil when none is
+func (c Config) openMailer() (mailer.Sender, string, error) {
+	provider := c.MailProvider
+	if provider == "" && c.SMTPAddr != "" {
+		provider = "smtp"
+	}
+	switch provider {
+	case "":
+		return nil, "", nil
+	case "smtp":
+		if c.SMTPAddr == "" {
+			return nil, "", fmt.Errorf("SMTP_ADDR is not set")
+		}
+		return mailer.SMTP{
+			Addr:            c.SMTPAddr,
+			Username:        c.SMTPUsername,
+			Password:        c.SMTPPassword,
+			From:            c.MailFrom,
+			CurrentPassword: func() string { return c.latest().SMTPPassword },
+		}, "SMTP server " + c.SMTPAddr, nil
+	case "sendgrid":
+		if c.SendGridAPIKey == "" {
+			return nil, "", fmt.Errorf("SENDGRID_API_KEY is not set")
+		}
+		return mailer.SendGrid{APIKey: c.SendGridAPIKey, From: c.MailFrom}, "SendGrid", nil
+	case "ses":
+		if c.SESAccessKey == "" || c.SESSecretKey == "" {
+			return nil, "", fmt.Errorf("SES_ACCESS_KEY_ID and SES_SECRET_ACCESS_KEY are required")
+		}
+		return mailer.SES{
+			Endpoint:  c.SESEndpoint,
+			Region:    c.SESRegion,
+			AccessKey: c.SESAccessKey,
+			SecretKey: c.SESSecretKey,
+			From:      c.MailFrom,
+		}, "SES in " + c.SESRegion, nil
+	case "log":
+		return mailer.Log{Logger: log.Default()}, "log only, nothing is sent", nil
+	default:
+		return nil, "", fmt.Errorf("unknown MAIL_PROVIDER %q (expected smtp, sendgrid, ses or log)", c.MailProvider)
+	}
+}
+
+// openSMS returns the configured SMS provider, limited per country, with a
+// note describing it, or nil when none is
+func (c Config) openSMS() (sms.Sender, string, error) {
+	provider := c.SMSProvider
+	if provider == "" && c.TwilioAccountSID != "" {
+		provider = "twilio"
+	} else if provider == "" && c.VonageAPIKey != "" {
+		provider = "vonage"
+	}
+
+	var sender sms.Sender
+	var note string
+	switch provider {
+	case "":
+		return nil, "", nil
+	case "twilio":
+		if c.TwilioAccountSID == "" || c.TwilioAuthToken == "" || c.SMSFrom == "" {
+			return nil, "", fmt.Errorf("TWILIO_ACCOUNT_SID, TWILIO_AUTH_TOKEN and SMS_FROM are required")
+		}
+		sender, note = sms.Twilio{AccountSID: c.TwilioAccountSID, AuthToken: c.TwilioAuthToken, From: c.SMSFrom}, "Twilio"
+	case "vonage":
+		if c.VonageAPIKey == "" || c.VonageAPISecret == "" || c.SMSFrom == "" {
+			return nil, "", fmt.Errorf("VONAGE_API_KEY, VONAGE_API_SECRET and SMS_FROM are required")
+		}
+		sender, note = sms.Vonage{APIKey: c.VonageAPIKey, APISecret: c.VonageAPISecret, From: c.SMSFrom}, "Vonage"
+	case "log":
+		sender, note = sms.Log{Logger: log.Default()}, "log only, nothing is sent"
+	default:
+		return nil, "", fmt.Errorf("unknown SMS_PROVIDER %q (expected twilio, vonage or log)", c.SMSProvider)
+	}
+
+	limits := sms.Limits{Default: c.SMSRateLimit, Countries: map[string]int{}, Window: c.SMSRateWindow}
+	for _, item := range c.SMSCountryLimits {
+		country, value, _ := strings.Cut(item, "=")
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || limit < 0 || len(strings.TrimSpace(country)) != 2 {
+			return nil, "", fmt.Errorf("invalid SMS_COUNTRY_LIMITS entry %q (expected a country code, = and a limit)", item)
+		}
+		limits.Countries[strings.ToUpper(strings.TrimSpace(country))] = limit
+	}
+	return sms.NewLimited(sender, limits, time.Now), fmt.Sprintf("%s, %d messages per country every %s", note, c.SMSRateLimit, c.SMSRateWindow), nil
+}
+
+// openPublisher returns the configured event publisher, with a note
+// describing it, or nil when none is
+func (c Config) openPublisher() (events.Publisher, string, error) {
+	publisher := c.EventPublisher
+	if publisher == "" && len(c.KafkaBrokers) > 0 {
+		publisher = "kafka"
+	} else if publisher == "" && c.NATSURL != "" {
+		publisher = "nats"
+	} else if publisher == "" && c.RabbitMQURL != "" {
+		publisher = "rabbitmq"
+	}
+	switch publisher {
+	case "":
+		return nil, "", nil
+	case "kafka":
+		if len(c.KafkaBrokers) == 0 {
+			return nil, "", fmt.Errorf("KAFKA_BROKERS is not set")
+		}
+		if c.KafkaFormat == "avro" && c.KafkaSchemaRegistry == "" {
+			return nil, "", fmt.Errorf("KAFKA_SCHEMA_REGISTRY_URL is required for KAFKA_FORMAT=avro")
+		}
+		kafka, err := events.NewKafka(events.KafkaConfig{
+			Brokers:           c.KafkaBrokers,
+			Topic:             c.KafkaTopic,
+			Format:            c.KafkaFormat,
+			SchemaRegistryURL: c.KafkaSchemaRegistry,
+			Username:          c.KafkaUsername,
+			Password:          c.KafkaPassword,
+			TLS:               c.KafkaTLS,
+		})
+		return kafka, "Kafka topic " + c.KafkaTopic + " as " + c.KafkaFormat, err
+	case "nats":
+		if c.NATSURL == "" {
+			return nil, "", fmt.Errorf("NATS_URL is not set")
+		}
+		nats, err := events.NewNATS(events.NATSConfig{URL: c.NATSURL, SubjectPrefix: c.NATSSubjectPrefix, Stream: c.NATSStream})
+		return nats, "NATS JetStream subjects " + c.NATSSubjectPrefix + ".>", err
+	case "rabbitmq":
+		if c.RabbitMQURL == "" {
+			return nil, "", fmt.Errorf("RABBITMQ_URL is not set")
+		}
+		rabbitmq, err := events.NewRabbitMQ(events.RabbitMQConfig{URL: c.RabbitMQURL, Exchange: c.RabbitMQExchange})
+		return rabbitmq, "RabbitMQ exchange " + c.RabbitMQExchange, err
+	case "log":
+		return events.Log{Logger: log.Default()}, "log only, nothing is published", nil
+	default:
+		return nil, "", fmt.Errorf("unknown EVENT_PUBLISHER %q (expected kafka, nats, rabbitmq or log)", c.EventPublisher)
+	}
+}
+
+// secretsProvider returns the secrets manager settings refer to, or nil
+// when none is configured
+func (c Config) secretsProvider() (secrets.Provider, error) {
+	switch c.SecretsProvider {
+	case "":
+		return nil, nil
+	case "vault":
+		if c.VaultToken == "" {
+			return nil, fmt.Errorf("VAULT_TOKEN is not set")
+		}
+		return secrets.Vault{Addr: c.VaultAddr, Token: c.VaultToken, Mount: c.SecretsVaultMount}, nil
+	case "aws":
+		if c.SecretsAWSAccessKey == "" || c.SecretsAWSSecretKey == "" {
+			return nil, fmt.Errorf("SECRETS_AWS_ACCESS_KEY_ID and SECRETS_AWS_SECRET_ACCESS_KEY must be set")
+		}
+		return secrets.AWSSecretsManager{
+			Endpoint:     c.SecretsAWSEndpoint,
+			Region:       c.SecretsAWSRegion,
+			AccessKey:    c.SecretsAWSAccessKey,
+			SecretKey:    c.SecretsAWSSecretKey,
+			SessionToken: c.SecretsAWSSessionToken,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown SECRETS_PROVIDER %q (expected vault or aws)", c.SecretsProvider)
+	}
+}
+
+// piiWrapper returns the master key wrapping the data keys, with a note
+// describing it, or nil when none is configured
+func (c Config) piiWrapper() (pii.Wrapper, string, error) {
+	switch {
+	case c.PIIVaultKey != "":
+		if c.VaultToken == "" {
+			return nil, "", fmt.Errorf("VAULT_TOKEN is not set")
+		}
+		wrapper := pii.VaultTransit{Addr: c.VaultAddr, Token: c.VaultToken, Mount: c.PIIVaultMount, Key: c.PIIVaultKey}
+		return wrapper, "master key " + c.PIIVaultKey + " in Vault", nil
+	case c.PIIMasterKey != "":
+		key, err := base64.StdEncoding.DecodeString(c.PIIMasterKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid PII_MASTER_KEY: %w", err)
+		}
+		wrapper, err := pii.NewLocal(key)
+		if err != nil {
+			return nil, "", fmt.Errorf("invalid PII_MASTER_KEY: %w", err)
+		}
+		return wrapper, "local master key", nil
+	default:
+		return nil, "", nil
+	}
+}
+
+// openPII returns the cipher encrypting the emails of users, with a note
+// describing it, or nil when PIIDataKeys isn't set
+func (c Config) openPII() (*pii.Cipher, string, error) {
+	if len(c.PIIDataKeys) == 0 {
+		return nil, "", nil
+	}
+	wrapper, note, err := c.piiWrapper()
+	if err != nil {
+		return nil, "", err
+	}
+	if wrapper == nil {
+		return nil, "", fmt.Errorf("PII_DATA_KEYS needs PII_MASTER_KEY or PII_VAULT_KEY")
+	}
+
+	var dataKeys []pii.DataKey
+	for _, entry := range c.PIIDataKeys {
+		id, value, _ := strings.Cut(entry, ":")
+		wrapped, err := base64.StdEncoding.DecodeString(value)
+		if err != nil || id == "" {
+			return nil, "", fmt.Errorf("invalid PII_DATA_KEYS entry for key %q (expected a key ID, : and a wrapped key)", id)
+		}
+		dataKeys = append(dataKeys, pii.DataKey{ID: id, Wrapped: wrapped})
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(c.PIIIndexKey)
+	if err != nil || c.PIIIndexKey == "" {
+		return nil, "", fmt.Errorf("PII_INDEX_KEY is not set to a wrapped key")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cipher, err := pii.NewCipher(ctx, wrapper, dataKeys, indexKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return cipher, fmt.Sprintf("emails encrypted under data key %s, %s", dataKeys[0].ID, note), nil
+}
+
+// sanitizePolicy returns the policy of SanitizeMode and SanitizeFields
+func (c Config) sanitizePolicy() (sanitize.Policy, error) {
+	mode, err := sanitize.ParseMode(c.SanitizeMode)
+	if err != nil {
+		return sanitize.Policy{}, fmt.Errorf("invalid SANITIZE_MODE: %w", err)
+	}
+	policy := sanitize.Policy{Default: mode, Fields: map[string]sanitize.Mode{}}
+	for _, entry := range c.SanitizeFields {
+		field, value, _ := strings.Cut(entry, "=")
+		field = strings.TrimSpace(field)
+		mode, err := sanitize.ParseMode(value)
+		if err != nil || !slices.Contains(service.SanitizedFields, field) {
+			return policy, fmt.Errorf("invalid SANITIZE_FIELDS entry %q (expected one of %s, = and keep, strip or escape)",
+				entry, strings.Join(service.SanitizedFields, ", "))
+		}
+		policy.Fields[field] = mode
+	}
+	return policy, nil
+}
+
+// ipRules returns the IP rules of each route group, from IPAllow and IPDeny
+func (c Config) ipRules() (map[string]handler.IPRules, error) {
+	rules := map[string]handler.IPRules{}
+	for _, list := range []struct {
+		key     string
+		entries []string
+		deny    bool
+	}{{"IP_ALLOW", c.IPAllow, false}, {"IP_DENY", c.IPDeny, true}} {
+		for _, entry := range list.entries {
+			group, value, ok := strings.Cut(entry, "=")
+			group = strings.TrimSpace(group)
+			network, err := parseNetwork(value)
+			if !ok || group == "" || err != nil {
+				return nil, fmt.Errorf("invalid %s entry %q (expected a route group, = and an IP or CIDR)", list.key, entry)
+			}
+			groupRules := rules[group]
+			if list.deny {
+				groupRules.Deny = append(groupRules.Deny, network)
+			} else {
+				groupRules.Allow = append(groupRules.Allow, network)
+			}
+			rules[group] = groupRules
+		}
+	}
+	return rules, nil
+}
+
+// maxInFlight returns the cap on requests in flight of each route group,
+// from MaxInFlight for every route and MaxInFlightGroups
+func (c Config) maxInFlight() (map[string]int, error) {
+	limits := map[string]int{}
+	if c.MaxInFlight > 0 {
+		limits[handler.AllRoutes] = c.MaxInFlight
+	}
+	for _, entry := range c.MaxInFlightGroups {
+		group, value, ok := strings.Cut(entry, "=")
+		group = strings.TrimSpace(group)
+		limit, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || group == "" || err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid MAX_IN_FLIGHT_GROUPS entry %q (expected a route group, = and a number of requests)", entry)
+		}
+		limits[group] = limit
+	}
+	return limits, nil
+}
+
+// featureFlags parses FeatureFlags into the defaults of the flags, by name
+func (c Config) featureFlags() (map[string]bool, error) {
+	defaults := map[string]bool{}
+	for _, entry := range c.FeatureFlags {
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.TrimSpace(name)
+		enabled, err := strconv.ParseBool(strings.TrimSpace(value))
+		if _, known := flags.Lookup(name); !ok || !known || err != nil {
+			names := make([]string, len(flags.Known))
+			for i, flag := range flags.Known {
+				names[i] = flag.Name
+			}
+			return nil, fmt.Errorf("invalid FEATURE_FLAGS entry %q (expected one of %s, = and true or false)", entry, strings.Join(names, ", "))
+		}
+		defaults[name] = enabled
+	}
+	return defaults, nil
+}
+
+// fieldRules parses FieldRules, by field
+func (c Config) fieldRules() (map[string]handler.FieldRule, error) {
+	rules := map[string]handler.FieldRule{}
+	for _, entry := range c.FieldRules {
+		field, value, _ := strings.Cut(entry, "=")
+		field = strings.TrimSpace(field)
+		mode, roles, scoped := strings.Cut(value, ":")
+		rule := handler.FieldRule{Mode: strings.TrimSpace(mode), Roles: c.FieldRuleRoles}
+		if scoped {
+			rule.Roles = nil
+			for _, role := range strings.Split(roles, "|") {
+				if role = strings.TrimSpace(role); role != "" {
+					rule.Roles = append(rule.Roles, role)
+				}
+			}
+		}
+
+		switch {
+		case field == "id" || !slices.Contains(model.UserFields, field):
+			return nil, fmt.Errorf("invalid FIELD_RULES entry %q (expected one of %s before =)", entry, strings.Join(model.UserFields[1:], ", "))
+		case rule.Mode != handler.FieldOmit && rule.Mode != handler.FieldMask:
+			return nil, fmt.Errorf("invalid FIELD_RULES entry %q (expected %s or %s after =)", entry, handler.FieldOmit, handler.FieldMask)
+		case rule.Mode == handler.FieldMask && !slices.Contains(handler.MaskableFields, field):
+			return nil, fmt.Errorf("invalid FIELD_RULES entry %q (only %s can be masked)", entry, strings.Join(handler.MaskableFields, ", "))
+		}
+		rules[field] = rule
+	}
+	return rules, nil
+}
+
+// trustedProxies returns the networks of TrustedProxies
+func (c Config) trustedProxies() ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, entry := range c.TrustedProxies {
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q (expected an IP or CIDR)", entry)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// parseNetwork parses a CIDR such as "10.0.0.0/8", or a single IP
+func parseNetwork(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip, err := netip.ParseAddr(value)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()), nil
+	}
+	network, err := netip.ParsePrefix(value)
+	return network.Masked(), err
+}
+
+// TLSEnabled reports whether the server should serve HTTPS
+func (c Config) TLSEnabled() bool {
+	return c.AutocertEnabled || (c.TLSCertFile != "" && c.TLSKeyFile != "")
+}
+
+// PolicyEnabled reports whether requests should go through the policy engine
+func (c Config) PolicyEnabled() bool {
+	return len(c.PolicyFiles) > 0 || c.PolicyBundleURL != "" || c.PolicyDatabase
+}
+
+// getEnv returns the value of an environment variable or a fallback when unset
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+// getEnvBool parses a boolean environment variable, returning fallback when unset or invalid
+func getEnvBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInt parses an integer environment variable, returning fallback when unset or invalid
+func getEnvInt(key string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvDuration parses a duration environment variable such as "30s", returning fallback when unset or invalid
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvFloat parses a decimal environment variable, returning fallback when unset or invalid
+func getEnvFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getEnvInts parses a comma separated list of positive integers, returning
+// fallback when unset or when any of them is invalid
+func getEnvInts(key string, fallback []int) []int {
+	items := getEnvList(key)
+	if len(items) == 0 {
+		return fallback
+	}
+
+	values := make([]int, len(items))
+	for i, item := range items {
+		value, err := strconv.Atoi(item)
+		if err != nil || value <= 0 {
+			return fallback
+		}
+		values[i] = value
+	}
+	return values
+}
+
+// getEnvStrings is getEnvList returning fallback when the variable is unset or empty
+func getEnvStrings(key string, fallback []string) []string {
+	if items := getEnvList(key); len(items) > 0 {
+		return items
+	}
+	return fallback
+}
+
+// getEnvList splits a comma separated environment variable into its trimmed, non-empty parts
+func getEnvList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/internal/secrets"
+)
+
+// The settings can also come from files of KEY=value lines: the envFiles
+// of the working directory, then CONFIG_FILE, each winning over the ones
+// before, read at startup and again on SIGHUP, see watchReload. The
+// variables of the environment the process started with win over them.
+var (
+	// processEnv are the variables of the environment the process started with
+	processEnv map[string]bool
+	// processSecrets are the references of the variables of processEnv
+	// read from the secrets manager, which replace them with their values
+	processSecrets map[string]string
+	// fileEnv are the variables set from the files
+	fileEnv = map[string]bool{}
+)
+
+// envFiles are read when present, so that local development needs no
+// variables exported by hand; .env.local holds a developer's own settings
+var envFiles = []string{".env", ".env.local"}
+
+// secretPrefix starts the values of the settings read from the secrets
+// manager, see Config.SecretsProvider
+const secretPrefix = "secret:"
+
+// secretsTimeout bounds the reading of the secrets of the configuration
+const secretsTimeout = 30 * time.Second
+
+// readConfig loads the files into the environment, dropping the variables
+// a previous read set that the files no longer have, and replaces the secret
+// references with the values of the secrets, then loads the configuration
+// from the environment
+func readConfig() (Config, error) {
+	if processEnv == nil {
+		processEnv, processSecrets = map[string]bool{}, map[string]string{}
+		for _, entry := range os.Environ() {
+			key, value, _ := strings.Cut(entry, "=")
+			processEnv[key] = true
+			if ref, ok := strings.CutPrefix(value, secretPrefix); ok {
+				processSecrets[key] = ref
+			}
+		}
+	}
+
+	values := map[string]string{}
+	for _, path := range envFiles {
+		file, err := parseEnvFile(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return Config{}, err
+		}
+		maps.Copy(values, file)
+	}
+	// CONFIG_FILE may itself be set in an .env file
+	path := values["CONFIG_FILE"]
+	if processEnv["CONFIG_FILE"] {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		file, err := parseEnvFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		maps.Copy(values, file)
+	}
+
+	for key := range fileEnv {
+		if _, ok := values[key]; !ok {
+			os.Unsetenv(key)
+			delete(fileEnv, key)
+		}
+	}
+	refs := maps.Clone(processSecrets)
+	for key, value := range values {
+		if !processEnv[key] {
+			os.Setenv(key, value)
+			fileEnv[key] = true
+			if ref, ok := strings.CutPrefix(value, secretPrefix); ok {
+				refs[key] = ref
+			}
+		}
+	}
+
+	cfg := loadConfig()
+	if len(refs) == 0 {
+		return cfg, nil
+	}
+	provider, err := cfg.secretsProvider()
+	if err != nil {
+		return Config{}, err
+	}
+	if provider == nil {
+		var settings []string
+		for key := range refs {
+			settings = append(settings, key)
+		}
+		sort.Strings(settings)
+		return Config{}, fmt.Errorf("%s refer to secrets but SECRETS_PROVIDER is not set", strings.Join(settings, ", "))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	resolved, err := secrets.Resolve(ctx, provider, refs)
+	if err != nil {
+		return Config{}, err
+	}
+	for key, value := range resolved {
+		os.Setenv(key, value)
+	}
+	return loadConfig(), nil
+}
+
+// parseEnvFile reads the KEY=value lines of a file. Blank lines and lines
+// starting with # are skipped, as is an "export " before the key. Values
+// may be in double quotes, with Go escapes such as \n, or in single quotes,
+// taken as is; unquoted values end at a " #" comment.
+func parseEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(strings.TrimPrefix(text, "export "), "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=value", path, line)
+		}
+
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			if value, err = strconv.Unquote(value); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid quoted value of %s", path, line, key)
+			}
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			if comment := strings.Index(value, " #"); comment >= 0 {
+				value = strings.TrimSpace(value[:comment])
+			}
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
@@ -0,0 +1,171 @@
+// Package auth issues and verifies the signed tokens users authenticate
+// with, and hashes their passwords.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for tokens that are malformed, signed with
+	// another secret or issued for another purpose
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("token expired")
+	// ErrRevokedToken is returned for tokens issued before their user's
+	// tokens were revoked
+	ErrRevokedToken = errors.New("token revoked")
+)
+
+// Token purposes, so that a token issued for one use can't stand in for another
+const (
+	// PurposeAccess tokens authenticate API requests
+	PurposeAccess = "access"
+	// PurposeVerifyEmail tokens are emailed to verify an address
+	PurposeVerifyEmail = "verify_email"
+	// PurposeResetPassword tokens are emailed to reset a forgotten password
+	PurposeResetPassword = "reset_password"
+	// PurposeCSRF values are the CSRF tokens of cookie sessions, see Derive
+	PurposeCSRF = "csrf"
+)
+
+// Claims are the contents of a token
+type Claims struct {
+	// Subject is the ID of the user the token was issued to
+	Subject string `json:"sub"`
+	Purpose string `json:"purpose"`
+	Email   string `json:"email,omitempty"`
+	Role    string `json:"role,omitempty"`
+	// Org is the ID of the organization the user belongs to
+	Org string `json:"org,omitempty"`
+	// Version is the token version of the user when the token was issued;
+	// the token is revoked once the user's version is incremented
+	Version int `json:"ver"`
+	// Actor is the user acting as the subject when the token was issued to
+	// impersonate it, nil otherwise
+	Actor     *Actor `json:"act,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Actor identifies the user who impersonates the subject of a token, like
+// the act claim of RFC 8693
+type Actor struct {
+	Subject string `json:"sub"`
+	// Version is the token version of the actor, so that revoking the
+	// actor's tokens ends their impersonations too
+	Version int `json:"ver"`
+}
+
+// Signer issues and verifies JSON Web Tokens signed with HMAC-SHA256
+type Signer struct {
+	now func() time.Time
+
+	mu     sync.RWMutex
+	secret []byte
+	// previous is the secret replaced by Rotate, still accepted
+	previous []byte
+}
+
+// NewSigner creates a Signer using secret as the HMAC key and now as the current time
+func NewSigner(secret []byte, now func() time.Time) *Signer {
+	return &Signer{secret: secret, now: now}
+}
+
+// Rotate signs with secret from now on. Tokens signed with the secret it
+// replaces stay valid until they expire, or until the next rotation.
+func (s *Signer) Rotate(secret []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hmac.Equal(secret, s.secret) {
+		return
+	}
+	s.previous, s.secret = s.secret, secret
+}
+
+// secrets returns the secret signing, then the previous one, if any
+func (s *Signer) secrets() [][]byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.previous == nil {
+		return [][]byte{s.secret}
+	}
+	return [][]byte{s.secret, s.previous}
+}
+
+// tokenHeader is the encoded JOSE header of every token
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// Sign issues a token carrying claims, valid for ttl from now
+func (s *Signer) Sign(claims Claims, ttl time.Duration) (string, time.Time, error) {
+	now := s.now()
+	expires := now.Add(ttl)
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = expires.Unix()
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", expires, err
+	}
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signature(s.secrets()[0], unsigned), expires, nil
+}
+
+// Verify checks the signature and expiry of a token issued for purpose and returns its claims
+func (s *Signer) Verify(token, purpose string) (Claims, error) {
+	var claims Claims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return claims, ErrInvalidToken
+	}
+	if !s.signedBy(parts[0]+"."+parts[1], parts[2]) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || json.Unmarshal(payload, &claims) != nil || claims.Purpose != purpose {
+		return Claims{}, ErrInvalidToken
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return Claims{}, ErrExpiredToken
+	}
+	return claims, nil
+}
+
+// Derive returns a value bound to value for purpose, such as the CSRF token
+// of a session. Only holders of the secret can compute it, so it needs no
+// storage: checking it is deriving it again.
+func (s *Signer) Derive(purpose, value string) string {
+	return signature(s.secrets()[0], purpose+":"+value)
+}
+
+// Derived reports whether derived is the value Derive returns for purpose
+// and value, with the secret or the one it rotated from
+func (s *Signer) Derived(purpose, value, derived string) bool {
+	return s.signedBy(purpose+":"+value, derived)
+}
+
+// signedBy reports whether sig is the signature of unsigned under the
+// secret or the previous one
+func (s *Signer) signedBy(unsigned, sig string) bool {
+	for _, secret := range s.secrets() {
+		if hmac.Equal([]byte(sig), []byte(signature(secret, unsigned))) {
+			return true
+		}
+	}
+	return false
+}
+
+// signature is the encoded HMAC-SHA256 of the header and payload
+func signature(secret []byte, unsigned string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,22 @@
+// Package backoff computes the delays between the attempts of the retries
+// of jobs, events and database queries.
+package backoff
+
+import (
+	"math"
+	"time"
+)
+
+// Exponential returns the delay before the retry following the attempt,
+// counting from 1: base after the first, doubling after each next one up
+// to max, or without a cap when max is 0.
+func Exponential(base, max time.Duration, attempt int) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < math.MaxInt64/2 && (max <= 0 || delay < max); i++ {
+		delay *= 2
+	}
+	if max > 0 && delay > max {
+		delay = max
+	}
+	return delay
+}
@@ -0,0 +1,32 @@
+package backoff
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExponential(t *testing.T) {
+	tests := []struct {
+		base, max time.Duration
+		attempt   int
+		want      time.Duration
+	}{
+		{time.Second, time.Minute, 1, time.Second},
+		{time.Second, time.Minute, 2, 2 * time.Second},
+		{time.Second, time.Minute, 4, 8 * time.Second},
+		{time.Second, time.Minute, 7, time.Minute},
+		{time.Second, time.Minute, 1000, time.Minute},
+		{time.Minute, time.Second, 1, time.Second},
+		{time.Second, 0, 4, 8 * time.Second},
+		{0, time.Minute, 5, 0},
+	}
+	for _, tt := range tests {
+		if got := Exponential(tt.base, tt.max, tt.attempt); got != tt.want {
+			t.Errorf("Exponential(%s, %s, %d) = %s, want %s", tt.base, tt.max, tt.attempt, got, tt.want)
+		}
+	}
+	// without a cap, the delay stops doubling before it overflows
+	if got := Exponential(time.Second, 0, 1000); got < Exponential(time.Second, 0, 40) {
+		t.Errorf("Exponential(1s, 0s, 1000) = %s, overflowed", got)
+	}
+}
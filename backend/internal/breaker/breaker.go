@@ -0,0 +1,173 @@
+// Package breaker fails calls to a dependency fast while it is down,
+// instead of letting each of them wait for its own timeout. A breaker
+// counts the calls and failures of every window; once enough of them
+// failed it opens, rejecting calls, and probes the dependency in the
+// background until it answers again, when the breaker closes.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOpen is returned by Allow while the breaker is open
+var ErrOpen = errors.New("circuit breaker open")
+
+// Options tune when a breaker opens and how it probes for recovery
+type Options struct {
+	// FailureRate is the share of failed calls in a window, from 0 to 1,
+	// that opens the breaker; zero never opens it
+	FailureRate float64
+	// MinCalls is how many calls a window needs before its failure rate
+	// counts, so a couple of failures at a quiet time don't open it
+	MinCalls int
+	// Window is how long calls are counted together
+	Window time.Duration
+	// ProbeInterval is how often an open breaker probes the dependency
+	ProbeInterval time.Duration
+	// OnChange, when set, is called as the breaker opens or closes
+	OnChange func(open bool)
+}
+
+// Breaker guards the calls to a dependency
+type Breaker struct {
+	probe func(ctx context.Context) error
+	opts  Options
+	clock func() time.Time
+
+	mu          sync.Mutex
+	open        bool
+	nextProbe   time.Time
+	windowStart time.Time
+	calls       int
+	failures    int
+	stop        chan struct{}
+}
+
+// New creates a closed breaker probing the dependency with probe while it
+// is open
+func New(probe func(ctx context.Context) error, opts Options, clock func() time.Time) *Breaker {
+	if opts.ProbeInterval <= 0 {
+		opts.ProbeInterval = time.Second
+	}
+	return &Breaker{probe: probe, opts: opts, clock: clock, stop: make(chan struct{})}
+}
+
+// Allow returns ErrOpen while the breaker is open, nil when the call may go
+// ahead, after which its outcome is to be given to Record
+func (b *Breaker) Allow() error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open {
+		return ErrOpen
+	}
+	return nil
+}
+
+// Record counts the outcome of a call, opening the breaker when the
+// failures of the window reach the failure rate
+func (b *Breaker) Record(failed bool) {
+	if b == nil || b.opts.FailureRate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	opened := b.record(failed)
+	b.mu.Unlock()
+	if opened && b.opts.OnChange != nil {
+		b.opts.OnChange(true)
+	}
+}
+
+// record counts a call with the breaker locked, reporting whether it opened
+func (b *Breaker) record(failed bool) bool {
+	if b.open {
+		return false
+	}
+
+	now := b.clock()
+	if now.Sub(b.windowStart) >= b.opts.Window {
+		b.windowStart, b.calls, b.failures = now, 0, 0
+	}
+	b.calls++
+	if failed {
+		b.failures++
+	}
+	if b.calls >= b.opts.MinCalls && float64(b.failures) >= b.opts.FailureRate*float64(b.calls) {
+		b.open = true
+		b.nextProbe = now.Add(b.opts.ProbeInterval)
+		go b.probeUntilClosed()
+		return true
+	}
+	return false
+}
+
+// Open reports whether the breaker is open
+func (b *Breaker) Open() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// RetryAfter is how long until the next probe of an open breaker, when
+// the dependency may be back
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if wait := b.nextProbe.Sub(b.clock()); wait > 0 {
+		return wait
+	}
+	return b.opts.ProbeInterval
+}
+
+// Stop ends the probing of an open breaker, which then stays open
+func (b *Breaker) Stop() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+}
+
+// probeUntilClosed probes the dependency every ProbeInterval, closing the
+// breaker once a probe succeeds
+func (b *Breaker) probeUntilClosed() {
+	ticker := time.NewTicker(b.opts.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), b.opts.ProbeInterval)
+		err := b.probe(ctx)
+		cancel()
+
+		b.mu.Lock()
+		if err == nil {
+			b.open = false
+			b.windowStart, b.calls, b.failures = b.clock(), 0, 0
+			b.mu.Unlock()
+			if b.opts.OnChange != nil {
+				b.opts.OnChange(false)
+			}
+			return
+		}
+		b.nextProbe = b.clock().Add(b.opts.ProbeInterval)
+		b.mu.Unlock()
+	}
+}
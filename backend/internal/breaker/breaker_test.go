@@ -0,0 +1,96 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	opts := Options{FailureRate: 0.5, MinCalls: 4, Window: time.Minute, ProbeInterval: time.Hour}
+	tests := []struct {
+		name  string
+		opts  Options
+		calls []bool // whether each call failed
+		// gap passes between the calls
+		gap  time.Duration
+		open bool
+	}{
+		{"no calls", opts, nil, 0, false},
+		{"too few calls", opts, []bool{true, true, true}, 0, false},
+		{"failure rate reached", opts, []bool{false, true, false, true}, 0, true},
+		{"below the failure rate", opts, []bool{false, false, false, true}, 0, false},
+		{"failures of past windows", opts, []bool{true, true, true, false}, 30 * time.Second, false},
+		{"turned off", Options{MinCalls: 1, Window: time.Minute}, []bool{true, true, true, true}, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			b := New(func(ctx context.Context) error { return errors.New("down") }, tt.opts, func() time.Time { return now })
+			defer b.Stop()
+			for _, failed := range tt.calls {
+				b.Record(failed)
+				now = now.Add(tt.gap)
+			}
+			if b.Open() != tt.open {
+				t.Fatalf("open is %v, want %v", b.Open(), tt.open)
+			}
+			if err := b.Allow(); (err != nil) != tt.open || (err != nil && !errors.Is(err, ErrOpen)) {
+				t.Errorf("Allow() = %v, want ErrOpen only while open", err)
+			}
+		})
+	}
+}
+
+func TestProbe(t *testing.T) {
+	var mu sync.Mutex
+	var changes []bool
+	probes := 0
+	changed := make(chan struct{}, 2)
+	b := New(func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		// down for the first probe, back for the second
+		if probes++; probes == 1 {
+			return errors.New("down")
+		}
+		return nil
+	}, Options{FailureRate: 1, MinCalls: 1, Window: time.Minute, ProbeInterval: 10 * time.Millisecond, OnChange: func(open bool) {
+		mu.Lock()
+		changes = append(changes, open)
+		mu.Unlock()
+		changed <- struct{}{}
+	}}, time.Now)
+	defer b.Stop()
+
+	b.Record(true)
+	if !b.Open() {
+		t.Fatal("a failed call didn't open the breaker")
+	}
+	if retryAfter := b.RetryAfter(); retryAfter <= 0 || retryAfter > 10*time.Millisecond {
+		t.Errorf("RetryAfter() = %s, want up to the probe interval", retryAfter)
+	}
+	for range 2 {
+		select {
+		case <-changed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the breaker didn't close once the probe succeeded")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if b.Open() || probes != 2 || len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("open %v after %d probes and changes %v, want closed after 2 and [true false]", b.Open(), probes, changes)
+	}
+}
+
+func TestNil(t *testing.T) {
+	var b *Breaker
+	b.Record(true)
+	if err := b.Allow(); err != nil || b.Open() {
+		t.Errorf("a nil breaker rejected a call: %v", err)
+	}
+	b.Stop()
+}
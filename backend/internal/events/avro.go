@@ -0,0 +1,115 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// avroSchema is the Avro record of a Message. The payload stays JSON text,
+// so the schema doesn't change along with the users.
+const avroSchema = `{
+  "type": "record",
+  "name": "UserEvent",
+  "namespace": "api.events",
+  "fields": [
+    {"name": "id", "type": "long"},
+    {"name": "type", "type": "string"},
+    {"name": "org_id", "type": "int"},
+    {"name": "user_id", "type": "int"},
+    {"name": "created_at", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "payload", "type": "string"}
+  ]
+}`
+
+// avroEncoder encodes messages as avroSchema records in the wire format of
+// the Confluent schema registry: a zero byte, the 4 byte ID of the schema
+// and the record. The schema is registered on first use.
+type avroEncoder struct {
+	registry string
+	subject  string
+	http     *http.Client
+
+	mu       sync.Mutex
+	schemaID int32 // 0 until registered
+}
+
+func newAvroEncoder(registry, subject string) *avroEncoder {
+	return &avroEncoder{registry: strings.TrimSuffix(registry, "/"), subject: subject, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// Encode returns the message in the registry's wire format
+func (e *avroEncoder) Encode(ctx context.Context, msg Message) ([]byte, error) {
+	id, err := e.register(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.WriteByte(0)
+	binary.Write(&b, binary.BigEndian, id)
+	writeLong(&b, msg.ID)
+	writeString(&b, msg.Type)
+	writeLong(&b, int64(msg.OrgID))
+	writeLong(&b, int64(msg.UserID))
+	writeLong(&b, msg.CreatedAt.UnixMilli())
+	writeString(&b, string(msg.Payload))
+	return b.Bytes(), nil
+}
+
+// register registers avroSchema under the subject, unless it did already,
+// and returns its ID; registering the same schema again returns the same ID
+func (e *avroEncoder) register(ctx context.Context) (int32, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.schemaID != 0 {
+		return e.schemaID, nil
+	}
+
+	body, err := json.Marshal(map[string]string{"schema": avroSchema})
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.registry+"/subjects/"+e.subject+"/versions", bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+	resp, err := e.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		text, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return 0, fmt.Errorf("events: schema registry answered %s: %s", resp.Status, strings.TrimSpace(string(text)))
+	}
+
+	var registered struct {
+		ID int32 `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&registered); err != nil {
+		return 0, err
+	}
+	e.schemaID = registered.ID
+	return e.schemaID, nil
+}
+
+// writeLong writes an Avro int or long: zig-zag encoded, as a varint
+func writeLong(b *bytes.Buffer, n int64) {
+	var buf [binary.MaxVarintLen64]byte
+	b.Write(buf[:binary.PutVarint(buf[:], n)])
+}
+
+// writeString writes an Avro string: its length in bytes, then its bytes
+func writeString(b *bytes.Buffer, s string) {
+	writeLong(b, int64(len(s)))
+	b.WriteString(s)
+}
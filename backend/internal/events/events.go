@@ -0,0 +1,172 @@
+// Package events publishes the domain events recorded in the outbox along
+// with the changes of users. The relay reads the outbox in the order the
+// events were recorded and hands them to a Publisher, marking each one
+// delivered once the publisher accepted it; an instance crashing in between
+// publishes it again, so consumers see every event at least once and
+// should skip the IDs they already handled.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"api/internal/backoff"
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// Publisher hands an event to a broker
+type Publisher interface {
+	Publish(ctx context.Context, event model.Event) error
+}
+
+// Message is what publishers send for an event, as JSON: the event without
+// the relay's bookkeeping
+type Message struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	OrgID     int             `json:"org_id"`
+	UserID    int             `json:"user_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Payload   json.RawMessage `json:"payload"`
+}
+
+// NewMessage returns the message of the event
+func NewMessage(event model.Event) Message {
+	return Message{ID: event.ID, Type: event.Type, OrgID: event.OrgID, UserID: event.UserID, CreatedAt: event.CreatedAt, Payload: event.Payload}
+}
+
+// Log writes events to a logger instead of publishing them, for development
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l Log) Publish(ctx context.Context, event model.Event) error {
+	l.Logger.Printf("[events] %s %d of user %d in organization %d: %s", event.Type, event.ID, event.UserID, event.OrgID, event.Payload)
+	return nil
+}
+
+// Options tune a Relay
+type Options struct {
+	// PollInterval is how long the relay waits before looking for new
+	// events once the outbox is drained
+	PollInterval time.Duration
+	// BatchSize is the number of events claimed at once
+	BatchSize int
+	// LockTimeout is how long the relay holds the events it claimed. Events
+	// still undelivered past it are claimed again, by any instance.
+	LockTimeout time.Duration
+	// Backoff is the delay before retrying an event the publisher failed,
+	// doubling for each further retry up to MaxBackoff. The events recorded
+	// after it wait for it, keeping their order.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Relay publishes the events of the outbox in the background
+type Relay struct {
+	repo      repository.OutboxRepository
+	publisher Publisher
+	logger    *log.Logger
+	clock     func() time.Time
+	opts      Options
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRelay creates a Relay publishing the events of repo through publisher
+func NewRelay(repo repository.OutboxRepository, publisher Publisher, logger *log.Logger, clock func() time.Time, opts Options) *Relay {
+	return &Relay{repo: repo, publisher: publisher, logger: logger, clock: clock, opts: opts}
+}
+
+// Start starts relaying events
+func (r *Relay) Start() {
+	r.stop = make(chan struct{})
+	r.wg.Add(1)
+	go r.run()
+}
+
+// Stop stops the relay once it published the event it is publishing
+func (r *Relay) Stop() {
+	if r.stop == nil {
+		return
+	}
+	close(r.stop)
+	r.wg.Wait()
+}
+
+// run publishes batches of events until the relay stops, waiting for new
+// ones whenever the outbox is drained or held by another instance
+func (r *Relay) run() {
+	defer r.wg.Done()
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		if r.relay() {
+			continue
+		}
+		select {
+		case <-r.stop:
+			return
+		case <-time.After(r.opts.PollInterval):
+		}
+	}
+}
+
+// relay publishes the next batch of events in order, stopping at the first
+// failure, and reports whether it published a full batch, so more events
+// may be waiting
+func (r *Relay) relay() bool {
+	ctx := context.Background()
+	now := r.clock()
+	batch, err := r.repo.ClaimEvents(ctx, now, now.Add(r.opts.LockTimeout), r.opts.BatchSize)
+	if err != nil {
+		r.logger.Printf("[events] failed to claim events: %v", err)
+		return false
+	}
+
+	for _, event := range batch {
+		select {
+		case <-r.stop:
+			// the rest of the batch is claimed again once its lock expired
+			return false
+		default:
+		}
+
+		if err := r.publish(ctx, event); err != nil {
+			retryAt := r.clock().Add(r.backoff(event.Attempts + 1))
+			r.logger.Printf("[events] failed to publish %s event %d, retrying at %s: %v", event.Type, event.ID, retryAt.Format(time.RFC3339), err)
+			if err := r.repo.FailEvent(ctx, event.ID, err.Error(), retryAt); err != nil {
+				r.logger.Printf("[events] failed to record the failure of event %d: %v", event.ID, err)
+			}
+			return false
+		}
+		if err := r.repo.MarkEventDelivered(ctx, event.ID, r.clock()); err != nil {
+			// it is published again once its lock expired
+			r.logger.Printf("[events] failed to mark event %d delivered: %v", event.ID, err)
+			return false
+		}
+	}
+	return len(batch) == r.opts.BatchSize
+}
+
+// publish hands the event to the publisher, cancelling it past the lock
+// timeout, when another instance may claim the event
+func (r *Relay) publish(ctx context.Context, event model.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, r.opts.LockTimeout)
+	defer cancel()
+	return r.publisher.Publish(ctx, event)
+}
+
+// backoff is the delay before retrying an event the publisher failed
+func (r *Relay) backoff(attempt int) time.Duration {
+	return backoff.Exponential(r.opts.Backoff, r.opts.MaxBackoff, attempt)
+}
@@ -0,0 +1,121 @@
+package events
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+
+	"api/internal/model"
+)
+
+// KafkaConfig locates the Kafka cluster and the topic events go to
+type KafkaConfig struct {
+	Brokers []string // host:port of the bootstrap brokers
+	Topic   string
+	// Format is "json" for Message as JSON, or "avro" for the Avro record of
+	// avroSchema, registered in the schema registry at SchemaRegistryURL
+	Format            string
+	SchemaRegistryURL string
+	// Username and Password authenticate with SASL/PLAIN when set
+	Username string
+	Password string
+	TLS      bool
+}
+
+// Kafka publishes events to a Kafka topic. Messages are keyed by user, so
+// the events of a user land on one partition and are consumed in order.
+type Kafka struct {
+	writer *kafka.Writer
+	avro   *avroEncoder // nil for JSON
+}
+
+// NewKafka creates a publisher writing to cfg.Topic; the brokers are only
+// connected to when the first event is published
+func NewKafka(cfg KafkaConfig) (*Kafka, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, fmt.Errorf("events: no Kafka brokers")
+	}
+	if cfg.Topic == "" {
+		return nil, fmt.Errorf("events: no Kafka topic")
+	}
+
+	transport := &kafka.Transport{}
+	if cfg.Username != "" {
+		transport.SASL = plain.Mechanism{Username: cfg.Username, Password: cfg.Password}
+	}
+	if cfg.TLS {
+		transport.TLS = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	k := &Kafka{writer: &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        cfg.Topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		// the relay publishes one event at a time and waits for it
+		BatchSize:    1,
+		Transport:    transport,
+		WriteTimeout: 10 * time.Second,
+	}}
+
+	switch cfg.Format {
+	case "json":
+	case "avro":
+		if cfg.SchemaRegistryURL == "" {
+			return nil, fmt.Errorf("events: Avro needs a schema registry")
+		}
+		k.avro = newAvroEncoder(cfg.SchemaRegistryURL, cfg.Topic+"-value")
+	default:
+		return nil, fmt.Errorf("events: unknown Kafka format %q (expected json or avro)", cfg.Format)
+	}
+	return k, nil
+}
+
+func (k *Kafka) Publish(ctx context.Context, event model.Event) error {
+	var value []byte
+	var err error
+	if k.avro != nil {
+		value, err = k.avro.Encode(ctx, NewMessage(event))
+	} else {
+		value, err = json.Marshal(NewMessage(event))
+	}
+	if err != nil {
+		return err
+	}
+
+	return k.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(strconv.Itoa(event.OrgID) + ":" + strconv.Itoa(event.UserID)),
+		Value: value,
+		Headers: []kafka.Header{
+			{Key: "event-id", Value: []byte(strconv.FormatInt(event.ID, 10))},
+			{Key: "event-type", Value: []byte(event.Type)},
+		},
+		Time: event.CreatedAt,
+	})
+}
+
+// Check asks the brokers for the metadata of the topic, failing when they
+// are unreachable or don't know it
+func (k *Kafka) Check(ctx context.Context) error {
+	client := &kafka.Client{Addr: k.writer.Addr, Transport: k.writer.Transport}
+	metadata, err := client.Metadata(ctx, &kafka.MetadataRequest{Topics: []string{k.writer.Topic}})
+	if err != nil {
+		return err
+	}
+	for _, topic := range metadata.Topics {
+		if topic.Error != nil {
+			return fmt.Errorf("events: Kafka topic %s: %w", topic.Name, topic.Error)
+		}
+	}
+	return nil
+}
+
+// Close flushes and closes the connections to the brokers
+func (k *Kafka) Close() error {
+	return k.writer.Close()
+}
@@ -0,0 +1,114 @@
+// Package flags turns experimental behaviors on and off at runtime. Each
+// flag has a default, which the configuration can change, and overrides
+// kept in the database, for every organization or for one, which admins
+// change without redeploying. Overrides for an organization win over the
+// ones for every organization, which win over the default.
+package flags
+
+import "sync"
+
+// Flag is a behavior that can be turned on and off
+type Flag struct {
+	Name        string
+	Description string
+	Default     bool
+}
+
+// Names of the known flags
+const (
+	SearchFullText = "search_full_text"
+)
+
+// Known lists the flags, by name
+var Known = []Flag{
+	{
+		Name:        SearchFullText,
+		Description: "Rank the matches of ?q= with the Postgres full-text index instead of matching them with LIKE",
+		Default:     true,
+	},
+}
+
+// Lookup returns the known flag with that name
+func Lookup(name string) (Flag, bool) {
+	for _, flag := range Known {
+		if flag.Name == name {
+			return flag, true
+		}
+	}
+	return Flag{}, false
+}
+
+// AllOrgs is the organization of overrides applying to every organization
+const AllOrgs = 0
+
+// Override turns a flag on or off, for an organization or for AllOrgs
+type Override struct {
+	Name    string
+	OrgID   int
+	Enabled bool
+}
+
+type key struct {
+	name string
+	org  int
+}
+
+// Set holds the state of the flags
+type Set struct {
+	defaults map[string]bool
+
+	mu        sync.RWMutex
+	overrides map[key]bool
+}
+
+// New creates a set with the Known defaults of the flags, unless
+// defaults, by name, says otherwise
+func New(defaults map[string]bool) *Set {
+	set := &Set{defaults: map[string]bool{}, overrides: map[key]bool{}}
+	for _, flag := range Known {
+		set.defaults[flag.Name] = flag.Default
+	}
+	for name, enabled := range defaults {
+		set.defaults[name] = enabled
+	}
+	return set
+}
+
+// Enabled reports whether a flag is on for an organization. A nil set has
+// every flag as its Known default.
+func (s *Set) Enabled(name string, org int) bool {
+	if s == nil {
+		return s.Default(name)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if enabled, ok := s.overrides[key{name, org}]; ok {
+		return enabled
+	}
+	if enabled, ok := s.overrides[key{name, AllOrgs}]; ok {
+		return enabled
+	}
+	return s.defaults[name]
+}
+
+// Default reports whether a flag is on without overrides
+func (s *Set) Default(name string) bool {
+	if s == nil {
+		flag, _ := Lookup(name)
+		return flag.Default
+	}
+	return s.defaults[name]
+}
+
+// Load replaces the overrides
+func (s *Set) Load(overrides []Override) {
+	loaded := make(map[key]bool, len(overrides))
+	for _, override := range overrides {
+		loaded[key{override.Name, override.OrgID}] = override.Enabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.overrides = loaded
+}
@@ -0,0 +1,75 @@
+// Package frontend serves the web app from the binary, so that a single
+// binary serves the whole app. The static export of the Next.js app is
+// embedded from dist, which `npm run build:embed` fills in the frontend
+// directory before the binary is built; without it the binary has no
+// frontend.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+)
+
+//go:embed all:dist
+var embedded embed.FS
+
+// Files returns the files of the app, or nil when the binary was built
+// without them
+func Files() fs.FS {
+	files, err := fs.Sub(embedded, "dist")
+	if err != nil {
+		return nil
+	}
+	if _, err := fs.Stat(files, "index.html"); err != nil {
+		return nil
+	}
+	return files
+}
+
+// Handler serves the files of a single page app. Paths without a file get
+// the page exported for them, such as about.html for /about, and
+// otherwise index.html, for the app to route them in the browser; missing
+// assets, such as scripts, are not found instead.
+func Handler(files fs.FS) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.NotFound(w, r)
+			return
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+		file, ok := lookup(files, name)
+		if !ok {
+			if ext := path.Ext(name); ext != "" && ext != ".html" {
+				http.NotFound(w, r)
+				return
+			}
+			file = "index.html"
+		}
+
+		// the build hashes the names of its assets, which never change
+		if strings.HasPrefix(file, "_next/static/") {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "no-cache")
+		}
+		http.ServeFileFS(w, r, files, file)
+	})
+}
+
+// lookup returns the file serving name: the file itself, its page or the
+// index of its directory
+func lookup(files fs.FS, name string) (string, bool) {
+	if name == "" {
+		return "index.html", true
+	}
+	for _, candidate := range []string{name, name + ".html", path.Join(name, "index.html")} {
+		if info, err := fs.Stat(files, candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getAddresses handler to list the addresses of a user
+func (s *Server) getAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	addresses, err := s.users.ListAddresses(r.Context(), userID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Addresses fetched successfully", addresses)
+}
+
+// createAddress handler to add an address to a user
+func (s *Server) createAddress(w http.ResponseWriter, r *http.Request) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var input model.AddressInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	address, err := s.users.CreateAddress(r.Context(), userID, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Address created successfully", address)
+}
+
+// updateAddress handler to replace an address of a user
+func (s *Server) updateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := s.addressIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var input model.AddressInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	address, err := s.users.UpdateAddress(r.Context(), userID, id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Address updated successfully", address)
+}
+
+// deleteAddress handler to remove an address of a user
+func (s *Server) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := s.addressIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.users.DeleteAddress(r.Context(), userID, id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Address deleted successfully", nil)
+}
+
+// addressIDs reads the user and address IDs of an address route, sending a
+// 400 and returning false when either is malformed
+func (s *Server) addressIDs(w http.ResponseWriter, r *http.Request) (userID, id int, ok bool) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return 0, 0, false
+	}
+	id, err = atoi(mux.Vars(r)["addressId"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid address ID", nil)
+		return 0, 0, false
+	}
+	return userID, id, true
+}
@@ -0,0 +1,263 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// apiVersion is a version of the API, whose routes are mounted under
+// APIPrefix/name
+type apiVersion struct {
+	name string
+	// routes registers the routes the version adds or changes; it serves
+	// the routes of the version before it otherwise
+	routes func(s *Server, api *mux.Router)
+	// credentialExchanges registers the routes of the version trading a
+	// password for an access token or a session, which are served without
+	// authenticating the caller, see Router
+	credentialExchanges func(s *Server, api *mux.Router)
+	// preview versions are still changing, and only served with
+	// Config.APIPreview
+	preview bool
+}
+
+// apiVersions are the versions of the API, oldest first. A version is
+// frozen once the next one is added: its handlers only get fixes, and
+// breaking changes, such as to the shape of responses, go to a version
+// registering new routes for them, under the same names, so that the
+// policies apply to every version alike.
+var apiVersions = []apiVersion{
+	{name: "v1", routes: (*Server).routesV1, credentialExchanges: (*Server).credentialExchangesV1},
+	{name: "v2", routes: (*Server).routesV2, preview: true},
+}
+
+// routesV2 registers the routes version 2 of the API changes from version 1:
+// listing users a page at a time, in an envelope with the total
+func (s *Server) routesV2(api *mux.Router) {
+	api.HandleFunc("/users", s.getUsersPage).Methods("GET").Name("users:list")
+}
+
+// versionRoutes mounts every version of the API on api, the API prefix, and
+// on the prefix itself for the clients asking for a version in the headers,
+// or from before versions, which get version 1; see NegotiateVersion. The
+// credential exchanges are mounted the same way on exchanges.
+func (s *Server) versionRoutes(api, exchanges *mux.Router) {
+	versions := s.apiVersions()
+	for i, version := range versions {
+		routers := versionRouters(api, version.name, i == 0)
+		exchangeRouters := versionRouters(exchanges, version.name, i == 0)
+		// routes match in the order they are registered, so those a
+		// version changes come before those of the versions before it
+		for j := i; j >= 0; j-- {
+			for k := range routers {
+				versions[j].routes(s, routers[k])
+				if versions[j].credentialExchanges != nil {
+					versions[j].credentialExchanges(s, exchangeRouters[k])
+				}
+			}
+		}
+	}
+}
+
+// versionRouters returns the routers of the version name on api: under
+// its own path, and on api itself for the requests negotiating it
+func versionRouters(api *mux.Router, name string, first bool) [2]*mux.Router {
+	return [2]*mux.Router{
+		api.PathPrefix("/" + name).Subrouter(),
+		api.MatcherFunc(negotiatedVersion(name, first)).Subrouter(),
+	}
+}
+
+// negotiatedVersion matches the requests NegotiateVersion serves with the
+// version name, and those outside of it with the first version
+func negotiatedVersion(name string, first bool) mux.MatcherFunc {
+	return func(r *http.Request, _ *mux.RouteMatch) bool {
+		version := APIVersionFrom(r.Context())
+		return version == name || (version == "" && first)
+	}
+}
+
+// apiVersions returns the versions of the API served
+func (s *Server) apiVersions() []apiVersion {
+	var versions []apiVersion
+	for _, version := range apiVersions {
+		if !version.preview || s.cfg.APIPreview {
+			versions = append(versions, version)
+		}
+	}
+	return versions
+}
+
+// trimAPIPrefix returns the path of a route without the API prefix and the
+// version, e.g. users/{id} for /api/go/v1/users/{id}
+func (s *Server) trimAPIPrefix(path string) string {
+	path = strings.TrimPrefix(path, s.cfg.APIPrefix+"/")
+	if version, rest, ok := strings.Cut(path, "/"); ok && isVersionName(version) {
+		return rest
+	}
+	return path
+}
+
+// isVersionName reports whether name is in the form of the versions of the
+// API, a v and a number. It doesn't look at apiVersions, which routes
+// registered with it would depend on.
+func isVersionName(name string) bool {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "v"))
+	return strings.HasPrefix(name, "v") && err == nil && n > 0
+}
+
+// APIVersionHeader asks for a version of the API on the paths without one,
+// e.g. X-API-Version: 2, as does an Accept header listing the media type of
+// the version, e.g. application/vnd.simplecrud.v2+json. Responses carry the
+// version serving them in it.
+const APIVersionHeader = "X-API-Version"
+
+// versionMediaPrefix and versionMediaSuffix surround the version in the
+// media types asking for one
+const (
+	versionMediaPrefix = "application/vnd.simplecrud."
+	versionMediaSuffix = "+json"
+)
+
+type apiVersionKey struct{}
+
+// APIVersionFrom returns the version of the API serving the request, such
+// as "v1", for handlers to shape their responses by, or "" outside of
+// NegotiateVersion
+func APIVersionFrom(ctx context.Context) string {
+	version, _ := ctx.Value(apiVersionKey{}).(string)
+	return version
+}
+
+// NegotiateVersion middleware picks the version of the API serving each API
+// request, the one in its path or, on the paths without one, the one asked
+// for in the X-API-Version or Accept headers, version 1 when neither asks
+// for one, and records it in the request context, where the routes of the
+// version are looked up by. A version in the headers the API doesn't serve
+// gets a 406, and one in the path a 404.
+func (s *Server) NegotiateVersion(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rest, ok := strings.CutPrefix(r.URL.Path, s.cfg.APIPrefix)
+		if !ok || (rest != "" && rest[0] != '/') {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+		w.Header().Add("Vary", APIVersionHeader)
+		asked, err := requestedVersion(r)
+		if err != nil {
+			s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+			return
+		}
+		if asked != "" && !s.servesVersion(asked) {
+			s.sendError(w, r, http.StatusNotAcceptable, fmt.Sprintf("Unsupported API version %s", asked), map[string]interface{}{
+				"versions": s.versionNames(),
+			})
+			return
+		}
+
+		// the version in the path wins over the headers
+		version, _, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+		switch {
+		case s.servesVersion(version):
+		case isVersionName(version):
+			s.sendError(w, r, http.StatusNotFound, fmt.Sprintf("Unknown API version %s", version), map[string]interface{}{
+				"versions": s.versionNames(),
+			})
+			return
+		case asked != "":
+			version = asked
+		default:
+			version = s.apiVersions()[0].name
+		}
+
+		w.Header().Set(APIVersionHeader, version)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	})
+}
+
+// requestedVersion returns the version the X-API-Version and Accept headers
+// ask for, as in "v2", or "" when they ask for none
+func requestedVersion(r *http.Request) (string, error) {
+	var header string
+	if value := strings.TrimSpace(r.Header.Get(APIVersionHeader)); value != "" {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(value), "v"))
+		if err != nil || n <= 0 {
+			return "", fmt.Errorf("Invalid %s %q, expected a version such as 2", APIVersionHeader, value)
+		}
+		header = "v" + strconv.Itoa(n)
+	}
+
+	accept := acceptedVersion(r.Header.Get("Accept"))
+	if header != "" && accept != "" && header != accept {
+		return "", fmt.Errorf("%s asks for %s but Accept for %s", APIVersionHeader, header, accept)
+	}
+	if header != "" {
+		return header, nil
+	}
+	return accept, nil
+}
+
+// acceptedVersion returns the version whose media type the Accept header
+// ranks highest, or "" when it lists none
+func acceptedVersion(accept string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		version, ok := versionMediaType(mediaType)
+		if !ok {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q > bestQ {
+			best, bestQ = version, q
+		}
+	}
+	return best
+}
+
+// versionMediaType returns the version a media type asks for, such as v2
+// for application/vnd.simplecrud.v2+json
+func versionMediaType(mediaType string) (string, bool) {
+	version, ok := strings.CutPrefix(mediaType, versionMediaPrefix)
+	if !ok {
+		return "", false
+	}
+	version, ok = strings.CutSuffix(version, versionMediaSuffix)
+	return version, ok && version != ""
+}
+
+// servesVersion reports whether name is a version of the API served
+func (s *Server) servesVersion(name string) bool {
+	for _, version := range s.apiVersions() {
+		if version.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// versionNames lists the versions of the API served
+func (s *Server) versionNames() []string {
+	versions := s.apiVersions()
+	names := make([]string, len(versions))
+	for i, version := range versions {
+		names[i] = version.name
+	}
+	return names
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// newTestServer returns a server on the memory store, with version 2 of the
+// API served when preview is set
+func newTestServer(t *testing.T, preview bool) (*Server, repository.UserRepository) {
+	t.Helper()
+	repo, err := repository.Open(repository.Config{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Deps{
+		Repo:   repo,
+		Logger: log.New(io.Discard, "", 0),
+		Config: Config{APIPreview: preview},
+	})
+	return s, repo
+}
+
+// serve sends a GET for path with headers through the version negotiation
+// and the routes of s
+func serve(s *Server, path string, headers map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	w := httptest.NewRecorder()
+	s.NegotiateVersion(s.Routes()).ServeHTTP(w, r)
+	return w
+}
+
+func TestNegotiateVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		preview bool
+		path    string
+		headers map[string]string
+		code    int
+		version string
+	}{
+		{"unversioned", true, "/api/go/users", nil, http.StatusOK, "v1"},
+		{"path", true, "/api/go/v2/users", nil, http.StatusOK, "v2"},
+		{"header", true, "/api/go/users", map[string]string{APIVersionHeader: "2"}, http.StatusOK, "v2"},
+		{"media type", true, "/api/go/users", map[string]string{"Accept": "application/vnd.simplecrud.v2+json"}, http.StatusOK, "v2"},
+		{"path wins", true, "/api/go/v1/users", map[string]string{APIVersionHeader: "2"}, http.StatusOK, "v1"},
+		{"unknown path version", true, "/api/go/v3/users", nil, http.StatusNotFound, ""},
+		{"unsupported media type", true, "/api/go/users", map[string]string{"Accept": "application/vnd.simplecrud.v9+json"}, http.StatusNotAcceptable, ""},
+		{"unsupported media type on a versioned path", true, "/api/go/v1/users", map[string]string{"Accept": "application/vnd.simplecrud.v9+json"}, http.StatusNotAcceptable, ""},
+		{"conflicting headers", true, "/api/go/users", map[string]string{APIVersionHeader: "1", "Accept": "application/vnd.simplecrud.v2+json"}, http.StatusBadRequest, ""},
+		{"invalid header", true, "/api/go/users", map[string]string{APIVersionHeader: "latest"}, http.StatusBadRequest, ""},
+		{"preview path", false, "/api/go/v2/users", nil, http.StatusNotFound, ""},
+		{"preview header", false, "/api/go/users", map[string]string{APIVersionHeader: "2"}, http.StatusNotAcceptable, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestServer(t, tt.preview)
+			w := serve(s, tt.path, tt.headers)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if got := w.Header().Get(APIVersionHeader); got != tt.version {
+				t.Errorf("%s = %q, want %q", APIVersionHeader, got, tt.version)
+			}
+		})
+	}
+}
+
+func TestUsersListingByVersion(t *testing.T) {
+	s, repo := newTestServer(t, true)
+	for _, name := range []string{"Ann", "Bob", "Cid"} {
+		user := model.User{Name: name, Email: name + "@example.com", Role: "user", Birth: model.NewDate(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))}
+		if _, err := repo.Create(context.Background(), user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var v1 struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	decode(t, serve(s, "/api/go/v1/users?limit=2", nil), &v1)
+	if len(v1.Data) != 3 {
+		t.Errorf("version 1 listed %d users, want all 3 in a list", len(v1.Data))
+	}
+
+	// the routes of version 2 are found by the version in the path or the headers
+	for _, w := range []*httptest.ResponseRecorder{
+		serve(s, "/api/go/v2/users?limit=2&offset=1", nil),
+		serve(s, "/api/go/users?limit=2&offset=1", map[string]string{APIVersionHeader: "2"}),
+	} {
+		var v2 struct {
+			Data struct {
+				Items  []map[string]interface{} `json:"items"`
+				Total  int                      `json:"total"`
+				Limit  int                      `json:"limit"`
+				Offset int                      `json:"offset"`
+			} `json:"data"`
+		}
+		decode(t, w, &v2)
+		if len(v2.Data.Items) != 2 || v2.Data.Total != 3 || v2.Data.Limit != 2 || v2.Data.Offset != 1 {
+			t.Errorf("version 2 page = %+v, want 2 items of 3 from offset 1", v2.Data)
+		}
+	}
+}
+
+// decode decodes the JSON body of a 200 response into v
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	if err := json.NewDecoder(w.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
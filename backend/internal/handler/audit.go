@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+	"api/internal/policy"
+)
+
+// AuditMiddleware records in the audit log every request that may change
+// something, along with every request made while impersonating a user,
+// whether it succeeded or not. It runs after the request is scoped to its
+// organization and before it is authorized, so denied attempts are
+// recorded too.
+func (s *Server) AuditMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			principal := policy.PrincipalFrom(r.Context())
+			if route == nil || (r.Method == http.MethodGet || r.Method == http.MethodHead) && principal.Impersonator == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			entry := model.AuditEntry{
+				OccurredAt:   s.clock(),
+				RequestID:    RequestIDFrom(r.Context()),
+				Actor:        principal.ID,
+				Impersonator: principal.Impersonator,
+				Action:       route.GetName(),
+				Resource:     s.routeResource(r, route),
+				Method:       r.Method,
+				Path:         r.URL.Path,
+				Status:       rec.status,
+			}
+			if org, ok := model.OrgFrom(r.Context()); ok {
+				entry.OrgID = &org
+			} else if org, err := strconv.Atoi(principal.Org); err == nil {
+				entry.OrgID = &org
+			}
+			// the request context may be cancelled by now, the entry must still be saved
+			s.users.RecordAudit(context.WithoutCancel(r.Context()), entry)
+		})
+	}
+}
+
+// statusRecorder passes a response through while noting its status
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	return rec.ResponseWriter.Write(p)
+}
+
+// getAuditLog handler to list the audit log of the organization, newest
+// first, optionally only the entries of one user or made while impersonating
+func (s *Server) getAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 50, 500)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params := model.AuditParams{Actor: r.URL.Query().Get("actor"), Limit: limit}
+	if value := r.URL.Query().Get("impersonated"); value != "" {
+		if params.Impersonated, err = strconv.ParseBool(value); err != nil {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter impersonated must be true or false", nil)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("before"); value != "" {
+		if params.Before, err = atoi(value); err != nil || params.Before <= 0 {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter before must be an audit entry ID", nil)
+			return
+		}
+	}
+
+	entries, err := s.users.ListAudit(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Audit log fetched successfully", entries)
+}
@@ -0,0 +1,396 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/auth"
+	"api/internal/model"
+	"api/internal/policy"
+)
+
+// AuthMiddleware authenticates requests carrying an access token in an
+// Authorization: Bearer header, or else a session cookie, making their user
+// the principal policies are evaluated for, and limiting the users they
+// list to their teammates unless teamScoped exempts them. Requests with neither stay
+// anonymous; invalid, expired or revoked credentials are rejected, and the
+// session cookie cleared. Requests changing something with a session cookie
+// must carry its CSRF token too; browsers don't add bearer tokens on their
+// own, so those need none. Router leaves it out of the credential exchanges.
+func (s *Server) AuthMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var identity model.Identity
+			var err error
+			credential := "Access token"
+			header := r.Header.Get("Authorization")
+			cookie, _ := r.Cookie(s.cfg.SessionCookie)
+			switch {
+			case header != "":
+				scheme, token, _ := strings.Cut(header, " ")
+				if !strings.EqualFold(scheme, "Bearer") || token == "" {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_request"`)
+					s.sendError(w, r, http.StatusUnauthorized, "Authorization header must be a Bearer token", nil)
+					return
+				}
+				identity, err = s.users.Authenticate(r.Context(), strings.TrimSpace(token))
+			case cookie != nil && cookie.Value != "":
+				credential = "Session"
+				identity, err = s.users.AuthenticateSession(r.Context(), cookie.Value)
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if err != nil {
+				var message string
+				switch {
+				case errors.Is(err, auth.ErrInvalidToken):
+					message = "Invalid " + strings.ToLower(credential)
+				case errors.Is(err, auth.ErrExpiredToken):
+					message = credential + " expired, log in again"
+				case errors.Is(err, auth.ErrRevokedToken):
+					message = credential + " was revoked, log in again"
+				default:
+					s.sendDomainError(w, r, err)
+					return
+				}
+				if header != "" {
+					w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				} else {
+					s.clearSessionCookie(w)
+				}
+				s.sendError(w, r, http.StatusUnauthorized, message, nil)
+				return
+			}
+			if header == "" && !s.csrfProtected(r, cookie.Value) {
+				s.sendError(w, r, http.StatusForbidden, "Missing or invalid CSRF token", nil)
+				return
+			}
+
+			principal := policy.Principal{
+				ID:    strconv.Itoa(identity.User.ID),
+				Roles: []string{identity.User.Role},
+				Org:   strconv.Itoa(identity.User.OrgID),
+			}
+			if identity.Impersonator != nil {
+				principal.Impersonator = strconv.Itoa(identity.Impersonator.ID)
+			}
+			ctx := policy.WithPrincipal(r.Context(), principal)
+			ctx = model.WithActor(ctx, model.Actor{ID: principal.ID, Impersonator: principal.Impersonator})
+			ctx = context.WithValue(ctx, identityKey{}, identity)
+			if s.teamScoped(identity.User) {
+				ctx = model.WithTeamScope(ctx, identity.User.ID)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// authEnabled sends a 503 and returns false when no token secret is configured
+func (s *Server) authEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.cfg.Users.Tokens == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Authentication is not enabled", nil)
+		return false
+	}
+	return true
+}
+
+// register handler to sign up, creating a user who must verify their email before logging in
+func (s *Server) register(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	if s.cfg.Users.Mailer == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Registration is not enabled", nil)
+		return
+	}
+	var input model.RegisterInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	user, err := s.users.Register(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Registered successfully, check your email to verify your address", user)
+}
+
+// verifyEmail handler to activate a user from the link of their verification email
+func (s *Server) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		s.sendError(w, r, http.StatusBadRequest, "Query parameter token is required", nil)
+		return
+	}
+
+	user, err := s.users.VerifyEmail(r.Context(), token)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Email verified successfully", user)
+}
+
+// login handler to exchange an email and password for an access token
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	var input model.LoginInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+	if s.loginLocked(w, r, input.Email) {
+		return
+	}
+
+	token, err := s.users.Login(r.Context(), input)
+	s.recordLogin(r, input.Email, err)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Logged in successfully", token)
+}
+
+// logout handler to log the caller out everywhere, revoking every access
+// token and session issued to them, and clear the session cookie. Admins
+// logging out of an impersonation revoke their own tokens, not the user's.
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	id := identity.User.ID
+	if identity.Impersonator != nil {
+		id = identity.Impersonator.ID
+	}
+
+	if err := s.users.RevokeTokens(r.Context(), identity, id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	if cookie, err := r.Cookie(s.cfg.SessionCookie); err == nil && cookie.Value != "" {
+		if err := s.users.EndSession(r.Context(), cookie.Value); err != nil {
+			s.logger.Printf("[logout] failed to delete the session of user %d: %v", id, err)
+		}
+		s.clearSessionCookie(w)
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Logged out successfully", nil)
+}
+
+// revokeTokens handler to revoke every access token and session issued to
+// a user, such as when one of them leaked
+func (s *Server) revokeTokens(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := s.users.RevokeTokens(r.Context(), identity, id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Tokens revoked successfully", nil)
+}
+
+// impersonate handler to issue the caller a token acting as another user
+// of their organization, for support staff to see the app as they do
+func (s *Server) impersonate(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	token, err := s.users.Impersonate(r.Context(), identity, id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Impersonation token issued successfully", token)
+}
+
+type identityKey struct{}
+
+// requireUser returns the identity AuthMiddleware authenticated the request
+// as, or sends a 401 and returns false for anonymous requests
+func (s *Server) requireUser(w http.ResponseWriter, r *http.Request) (model.Identity, bool) {
+	identity, ok := r.Context().Value(identityKey{}).(model.Identity)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		s.sendError(w, r, http.StatusUnauthorized, "Log in first", nil)
+	}
+	return identity, ok
+}
+
+// teamScoped reports whether the user listings of the user are limited to
+// themselves and their teammates: with TeamScope set, those of every user
+// without one of the TeamScopeExemptRoles
+func (s *Server) teamScoped(user model.User) bool {
+	return s.cfg.TeamScope && !slices.Contains(s.cfg.TeamScopeExemptRoles, user.Role)
+}
+
+// forgotPassword handler to email a password reset link. It answers the
+// same whether or not the email belongs to an account, so it can't be used
+// to find out who has one; requests are rate limited per client IP, and
+// emails per address.
+func (s *Server) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	if s.cfg.Users.Mailer == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Password reset is not enabled", nil)
+		return
+	}
+	var input struct {
+		Email string `json:"email"`
+	}
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	if ok, retryAfter := s.resetsPerIP.Allow(s.clientIP(r)); !ok {
+		s.sendTooManyRequests(w, r, retryAfter, "Too many password reset requests, try again later")
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(input.Email))
+	if email != "" {
+		if ok, _ := s.resetsPerEmail.Allow(email); ok {
+			s.users.ForgotPassword(r.Context(), email)
+		} else {
+			s.logger.Printf("[forgotPassword] Too many password reset requests for %s, not sending", email)
+		}
+	}
+
+	sendJSONResponse(w, true, http.StatusAccepted, "If the email belongs to an account, a password reset link was sent to it", nil)
+}
+
+// resetPassword handler to set a new password with the token of a password reset email
+func (s *Server) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	if err := s.users.ResetPassword(r.Context(), input.Token, input.Password); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Password reset successfully, log in again", nil)
+}
+
+// loginLocked sends a 429 and returns true when logins from the client IP,
+// or to the account with the email, failed too many times lately. Failures
+// are counted for unknown emails too, so the lockout doesn't tell whether
+// an account exists.
+func (s *Server) loginLocked(w http.ResponseWriter, r *http.Request, email string) bool {
+	if locked, retryAfter := s.failedLoginsPerIP.Exceeded(s.clientIP(r)); locked {
+		s.sendTooManyRequests(w, r, retryAfter, "Too many failed logins, try again later")
+		return true
+	}
+	if locked, retryAfter := s.failedLoginsPerAccount.Exceeded(loginKey(r.Context(), email)); locked {
+		s.sendTooManyRequests(w, r, retryAfter, "Too many failed logins to this account, try again later or ask an admin to unlock it")
+		return true
+	}
+	return false
+}
+
+// recordLogin counts a login failed with wrong credentials towards the
+// lockouts, and clears the failures of the account once it succeeds
+func (s *Server) recordLogin(r *http.Request, email string, err error) {
+	key := loginKey(r.Context(), email)
+	switch {
+	case err == nil:
+		s.failedLoginsPerAccount.Reset(key)
+	case errors.Is(err, model.ErrInvalidCredentials):
+		s.failedLoginsPerIP.Add(s.clientIP(r))
+		s.failedLoginsPerAccount.Add(key)
+		if locked, retryAfter := s.failedLoginsPerAccount.Exceeded(key); locked {
+			s.logger.Printf("[login] Locked out %s for %s after repeated failed logins", key, retryAfter.Round(time.Second))
+		}
+	}
+}
+
+// loginKey identifies an account in the login lockout: its normalized
+// email, within the organization the request is scoped to
+func loginKey(ctx context.Context, email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if org, ok := model.OrgFrom(ctx); ok {
+		return strconv.Itoa(org) + ":" + email
+	}
+	return email
+}
+
+// unlockUser handler to let a user locked out by failed logins try again at once
+func (s *Server) unlockUser(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	user, err := s.users.Get(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	s.failedLoginsPerAccount.Reset(loginKey(r.Context(), user.Email))
+	s.logger.Printf("[login] Unlocked user %d", user.ID)
+
+	sendJSONResponse(w, true, http.StatusOK, "User unlocked successfully", nil)
+}
+
+// sendTooManyRequests sends a 429 telling the client when to retry
+func (s *Server) sendTooManyRequests(w http.ResponseWriter, r *http.Request, retryAfter time.Duration, message string) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	s.sendError(w, r, http.StatusTooManyRequests, message, nil)
+}
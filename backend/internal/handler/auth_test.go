@@ -0,0 +1,272 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"api/internal/auth"
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// password is the password of the user newAuthServer creates
+const password = "correct horse"
+
+// newAuthServer returns a server issuing access tokens and sessions, with
+// a user ann@example.com logging in with password, and the handler serving
+// its routes behind AuthMiddleware as main.go does
+func newAuthServer(t *testing.T, cfg Config) (*Server, http.Handler) {
+	t.Helper()
+	repo, err := repository.Open(repository.Config{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Users.Tokens = auth.NewSigner([]byte("test secret"), time.Now)
+	cfg.Users.AccessTokenTTL = time.Hour
+	cfg.Users.SessionTTL = time.Hour
+	s := NewServer(Deps{
+		Repo:   repo,
+		Logger: log.New(io.Discard, "", 0),
+		Config: cfg,
+	})
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Create(context.Background(), model.User{Name: "Ann", Email: "ann@example.com", Role: "user", Status: model.UserActive, PasswordHash: hash}); err != nil {
+		t.Fatal(err)
+	}
+	router := s.Routes()
+	router.UseAuthentication(s.AuthMiddleware())
+	return s, s.NegotiateVersion(router)
+}
+
+// send serves a request with a JSON body, and the headers and cookies given
+func send(h http.Handler, method, path, body string, headers map[string]string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		r.Header.Set(name, value)
+	}
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCredentialExchanges(t *testing.T) {
+	s, handler := newAuthServer(t, Config{})
+
+	credentials := `{"email": "ann@example.com", "password": "` + password + `"}`
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		// a stale cookie and no CSRF token: the browser is logging in again
+		{"login", http.MethodPost, "/api/go/auth/login", credentials, http.StatusOK},
+		{"versioned login", http.MethodPost, "/api/go/v1/auth/login", credentials, http.StatusOK},
+		{"session login", http.MethodPost, "/api/go/auth/session", credentials, http.StatusOK},
+		{"wrong password", http.MethodPost, "/api/go/auth/session", `{"email": "ann@example.com", "password": "wrong"}`, http.StatusUnauthorized},
+		// the other routes still check the cookie
+		{"session logout", http.MethodDelete, "/api/go/auth/session", "", http.StatusUnauthorized},
+		{"logout", http.MethodPost, "/api/go/auth/logout", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(handler, tt.method, tt.path, tt.body, nil, &http.Cookie{Name: s.cfg.SessionCookie, Value: "stale"})
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
+
+func TestCSRF(t *testing.T) {
+	s, handler := newAuthServer(t, Config{})
+	credentials := `{"email": "ann@example.com", "password": "` + password + `"}`
+	w := send(handler, http.MethodPost, "/api/go/auth/session", credentials, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("logging in got %d: %s", w.Code, w.Body)
+	}
+	var session *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == s.cfg.SessionCookie {
+			session = cookie
+		}
+	}
+	csrf := w.Header().Get(csrfHeader)
+	if session == nil || csrf == "" {
+		t.Fatalf("logging in set no session cookie or CSRF token: %v", w.Header())
+	}
+	var token struct {
+		Data model.AccessToken `json:"data"`
+	}
+	decode(t, send(handler, http.MethodPost, "/api/go/auth/login", credentials, nil), &token)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		cookie  *http.Cookie
+		code    int
+	}{
+		{"read without token", http.MethodGet, nil, session, http.StatusOK},
+		{"change without token", http.MethodPost, nil, session, http.StatusForbidden},
+		{"change with another token", http.MethodPost, map[string]string{csrfHeader: csrf + "x"}, session, http.StatusForbidden},
+		{"change with token", http.MethodPost, map[string]string{csrfHeader: csrf}, session, http.StatusOK},
+		{"change with access token", http.MethodPost, map[string]string{"Authorization": "Bearer " + token.Data.Token}, nil, http.StatusOK},
+		{"change with unknown session", http.MethodPost, map[string]string{csrfHeader: csrf}, &http.Cookie{Name: s.cfg.SessionCookie, Value: "unknown"}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := "/api/go/me/notifications/read-all"
+			if tt.method == http.MethodGet {
+				path = "/api/go/me"
+			}
+			var cookies []*http.Cookie
+			if tt.cookie != nil {
+				cookies = append(cookies, tt.cookie)
+			}
+			if w := send(handler, tt.method, path, "", tt.headers, cookies...); w.Code != tt.code {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s, handler := newAuthServer(t, Config{
+		LoginAccountLimit: 3,
+		LoginIPLimit:      5,
+		LoginWindow:       time.Minute,
+		TrustedProxies:    []netip.Prefix{netip.MustParsePrefix("192.0.2.0/24")},
+	})
+	ann, err := s.repo.GetByEmail(context.Background(), "ann@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the steps run in order, each counting towards the lockouts
+	steps := []struct {
+		name     string
+		email    string
+		password string
+		ip       string
+		code     int
+	}{
+		{"first failure", "ann@example.com", "wrong", "198.51.100.1", http.StatusUnauthorized},
+		{"second failure", "ann@example.com", "wrong", "198.51.100.2", http.StatusUnauthorized},
+		{"third failure", "Ann@Example.com ", "wrong", "198.51.100.3", http.StatusUnauthorized},
+		{"account locked", "ann@example.com", password, "198.51.100.4", http.StatusTooManyRequests},
+		{"unknown email", "bob@example.com", "wrong", "203.0.113.1", http.StatusUnauthorized},
+		{"unknown email again", "bob@example.com", "wrong", "203.0.113.2", http.StatusUnauthorized},
+		{"unknown email a third time", "bob@example.com", "wrong", "203.0.113.3", http.StatusUnauthorized},
+		{"unknown email locked like the others", "bob@example.com", "wrong", "203.0.113.4", http.StatusTooManyRequests},
+		{"unlock", "", "", "", http.StatusOK},
+		{"unlocked", "ann@example.com", password, "198.51.100.4", http.StatusOK},
+		{"failure from the ip to carol", "carol@example.com", "wrong", "203.0.113.9", http.StatusUnauthorized},
+		{"failure from the ip to dave", "dave@example.com", "wrong", "203.0.113.9", http.StatusUnauthorized},
+		{"failure from the ip to erin", "erin@example.com", "wrong", "203.0.113.9", http.StatusUnauthorized},
+		{"failure from the ip to frank", "frank@example.com", "wrong", "203.0.113.9", http.StatusUnauthorized},
+		{"failure from the ip to grace", "grace@example.com", "wrong", "203.0.113.9", http.StatusUnauthorized},
+		{"ip locked", "ann@example.com", password, "203.0.113.9", http.StatusTooManyRequests},
+	}
+	for _, step := range steps {
+		var w *httptest.ResponseRecorder
+		if step.email == "" {
+			w = send(handler, http.MethodPost, "/api/go/users/"+strconv.Itoa(ann.ID)+"/unlock", "", nil)
+		} else {
+			body, _ := json.Marshal(model.LoginInput{Email: step.email, Password: step.password})
+			w = send(handler, http.MethodPost, "/api/go/auth/login", string(body), map[string]string{"X-Forwarded-For": step.ip})
+		}
+		if w.Code != step.code {
+			t.Fatalf("%s: got %d, want %d: %s", step.name, w.Code, step.code, w.Body)
+		}
+		if step.code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+			t.Errorf("%s: no Retry-After", step.name)
+		}
+	}
+}
+
+func TestAccessTokens(t *testing.T) {
+	s, handler := newAuthServer(t, Config{})
+	credentials := `{"email": "ann@example.com", "password": "` + password + `"}`
+	login := func() string {
+		var token struct {
+			Data model.AccessToken `json:"data"`
+		}
+		decode(t, send(handler, http.MethodPost, "/api/go/auth/login", credentials, nil), &token)
+		return token.Data.Token
+	}
+	token := login()
+	signer := auth.NewSigner([]byte("other secret"), time.Now)
+	forged, _, err := signer.Sign(auth.Claims{Subject: "1", Purpose: auth.PurposeAccess}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _, err := s.cfg.Users.Tokens.Sign(auth.Claims{Subject: "1", Purpose: auth.PurposeAccess}, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		code          int
+	}{
+		{"anonymous", "", http.StatusUnauthorized},
+		{"token", "Bearer " + token, http.StatusOK},
+		{"scheme in lowercase", "bearer " + token, http.StatusOK},
+		{"other scheme", "Basic " + token, http.StatusUnauthorized},
+		{"no token", "Bearer", http.StatusUnauthorized},
+		{"tampered", "Bearer " + token + "x", http.StatusUnauthorized},
+		{"signed with another secret", "Bearer " + forged, http.StatusUnauthorized},
+		{"expired", "Bearer " + expired, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{}
+			if tt.authorization != "" {
+				headers["Authorization"] = tt.authorization
+			}
+			w := send(handler, http.MethodGet, "/api/go/me", "", headers)
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code == http.StatusUnauthorized && tt.authorization != "" && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("no WWW-Authenticate")
+			}
+		})
+	}
+
+	t.Run("logout", func(t *testing.T) {
+		other := login()
+		bearer := map[string]string{"Authorization": "Bearer " + token}
+		if w := send(handler, http.MethodPost, "/api/go/auth/logout", "", bearer); w.Code != http.StatusOK {
+			t.Fatalf("logging out got %d: %s", w.Code, w.Body)
+		}
+		// every token issued before is revoked, not only the one logging out
+		for _, revoked := range []string{token, other} {
+			if w := send(handler, http.MethodGet, "/api/go/me", "", map[string]string{"Authorization": "Bearer " + revoked}); w.Code != http.StatusUnauthorized {
+				t.Errorf("a revoked token got %d: %s", w.Code, w.Body)
+			}
+		}
+		if w := send(handler, http.MethodGet, "/api/go/me", "", map[string]string{"Authorization": "Bearer " + login()}); w.Code != http.StatusOK {
+			t.Errorf("a token issued after logging out got %d: %s", w.Code, w.Body)
+		}
+	})
+}
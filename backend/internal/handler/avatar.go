@@ -0,0 +1,182 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// multipartOverhead is the room left in an upload's body for the multipart
+// boundaries and headers around the file
+const multipartOverhead = 64 << 10
+
+// uploadAvatar handler to store the image in the "avatar" field of a
+// multipart/form-data body as the user's avatar
+func (s *Server) uploadAvatar(w http.ResponseWriter, r *http.Request) {
+	if !s.storageEnabled(w, r) {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	image, ok := s.readUpload(w, r, "avatar", "an avatar file", s.cfg.Users.AvatarMaxBytes)
+	if !ok {
+		return
+	}
+
+	if err := s.users.SetAvatar(r.Context(), id, image); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	user, err := s.users.Get(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUser(w, r, http.StatusOK, "Avatar uploaded successfully", user, nil)
+}
+
+// storageEnabled sends a 503 and returns false when no file storage is configured
+func (s *Server) storageEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.cfg.Users.Storage == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "File storage is not enabled", nil)
+		return false
+	}
+	return true
+}
+
+// readUpload reads the file in the field of a multipart/form-data body,
+// described as what in errors, answering the request and returning false
+// when there is none or it can't be read. With a limit, it reads one byte
+// past it, so the service can reject oversized files; without one, the
+// body is capped by MaxBytes alone.
+func (s *Server) readUpload(w http.ResponseWriter, r *http.Request, field, what string, limit int64) ([]byte, bool) {
+	if limit > 0 {
+		setBodyLimit(w, r, limit+multipartOverhead)
+	}
+
+	reader, err := r.MultipartReader()
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Expected a multipart/form-data body with "+what, nil)
+		return nil, false
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			s.sendError(w, r, http.StatusBadRequest, "Expected a multipart/form-data body with "+what, nil)
+			return nil, false
+		}
+		if err != nil {
+			s.sendUploadError(w, r, err, field, limit)
+			return nil, false
+		}
+		if part.FormName() != field {
+			continue
+		}
+
+		var body io.Reader = part
+		if limit > 0 {
+			body = io.LimitReader(part, limit+1)
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			s.sendUploadError(w, r, err, field, limit)
+			return nil, false
+		}
+		return data, true
+	}
+}
+
+// sendUploadError answers a failure reading the file in the field of an
+// upload, 413 when the body was too large
+func (s *Server) sendUploadError(w http.ResponseWriter, r *http.Request, err error, field string, limit int64) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.sendError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s must not exceed %d bytes", capitalize(field), limit), nil)
+		return
+	}
+	s.sendError(w, r, http.StatusBadRequest, "Invalid multipart body", nil)
+}
+
+// getAvatar handler to serve the avatar image of a user
+func (s *Server) getAvatar(w http.ResponseWriter, r *http.Request) {
+	if !s.storageEnabled(w, r) {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	size := 0
+	if value := r.URL.Query().Get("size"); value != "" {
+		if size, err = strconv.Atoi(value); err != nil {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter size must be a whole number", nil)
+			return
+		}
+	}
+
+	// stores like S3 serve the file themselves
+	url, err := s.users.AvatarRedirect(r.Context(), id, size)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	if url != "" {
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, url, http.StatusFound)
+		return
+	}
+
+	object, err := s.users.Avatar(r.Context(), id, size)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	defer object.Body.Close()
+
+	// the URL stays the same when the avatar changes, so clients revalidate
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	if seeker, ok := object.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", object.ModTime, seeker)
+		return
+	}
+
+	if !object.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if object.Size > 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(object.Size))
+	}
+	io.Copy(w, object.Body)
+}
+
+// deleteAvatar handler to remove the avatar of a user
+func (s *Server) deleteAvatar(w http.ResponseWriter, r *http.Request) {
+	if !s.storageEnabled(w, r) {
+		return
+	}
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := s.users.DeleteAvatar(r.Context(), id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Avatar deleted successfully", nil)
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig is the policy of CORS middleware: which other sites' scripts
+// may call the API, and how
+type CORSConfig struct {
+	// AllowedOrigins are the origins allowed, e.g. https://app.example.com;
+	// one may have a * for a subdomain, as in https://*.example.com, and "*"
+	// alone allows every origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders are the request headers allowed; "*" allows those
+	// asked for
+	AllowedHeaders []string
+	// ExposedHeaders are the response headers scripts may read
+	ExposedHeaders []string
+	// AllowCredentials lets scripts send cookies, such as the session
+	// cookie, and read the responses; it is ignored when every origin is
+	// allowed, which browsers refuse along with credentials
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the answer to a preflight; zero
+	// leaves it to them
+	MaxAge time.Duration
+}
+
+// Defaults of CORSConfig, for the settings left empty
+var (
+	DefaultCORSMethods        = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+	DefaultCORSHeaders        = []string{"Content-Type", "Authorization", "X-Request-ID", "Idempotency-Key", "X-Org-ID", "X-CSRF-Token", "X-API-Version"}
+	DefaultCORSExposedHeaders = []string{"X-Request-ID", "X-Total-Count", "X-CSRF-Token", "X-API-Version", "Deprecation", "Sunset", "Link"}
+)
+
+// CORS middleware answers the preflights of cross-origin requests and adds
+// the CORS headers to the responses to allowed origins. Responses to other
+// origins carry none, so browsers keep them from their scripts. Every
+// response varies by Origin, so caches don't hand one origin's to another.
+func CORS(cfg CORSConfig) func(http.Handler) http.Handler {
+	if len(cfg.AllowedMethods) == 0 {
+		cfg.AllowedMethods = DefaultCORSMethods
+	}
+	if len(cfg.AllowedHeaders) == 0 {
+		cfg.AllowedHeaders = DefaultCORSHeaders
+	}
+	if cfg.ExposedHeaders == nil {
+		cfg.ExposedHeaders = DefaultCORSExposedHeaders
+	}
+	anyOrigin := slices.Contains(cfg.AllowedOrigins, "*")
+	credentials := cfg.AllowCredentials && !anyOrigin
+	methods := strings.Join(cfg.AllowedMethods, ", ")
+	anyHeader := slices.Contains(cfg.AllowedHeaders, "*")
+	headers := strings.Join(cfg.AllowedHeaders, ", ")
+	exposed := strings.Join(cfg.ExposedHeaders, ", ")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" || !(anyOrigin || allowedOrigin(cfg.AllowedOrigins, origin)) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if anyOrigin && !credentials {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+			if credentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposed)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if anyHeader {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					w.Header().Set("Access-Control-Allow-Headers", requested)
+				}
+			} else {
+				w.Header().Set("Access-Control-Allow-Headers", headers)
+			}
+			if cfg.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// allowedOrigin reports whether origin matches one of the allowed origins,
+// compared case-insensitively, a * standing for one or more subdomains
+func allowedOrigin(allowed []string, origin string) bool {
+	origin = strings.ToLower(origin)
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSuffix(pattern, "/"))
+		prefix, suffix, wildcard := strings.Cut(pattern, "*")
+		if !wildcard {
+			if origin == pattern {
+				return true
+			}
+			continue
+		}
+		// the subdomain can't reach into the scheme or past the host
+		if len(origin) > len(prefix)+len(suffix) && strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) &&
+			!strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:@") {
+			return true
+		}
+	}
+	return false
+}
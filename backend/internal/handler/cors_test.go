@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCORS(t *testing.T) {
+	apps := CORSConfig{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org"}, AllowCredentials: true, MaxAge: time.Hour}
+	everyone := CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}
+	tests := []struct {
+		name        string
+		cfg         CORSConfig
+		method      string
+		origin      string
+		preflight   bool
+		code        int
+		allowOrigin string
+		credentials bool
+		served      bool
+	}{
+		{"same origin", apps, http.MethodGet, "", false, http.StatusOK, "", false, true},
+		{"allowed origin", apps, http.MethodGet, "https://app.example.com", false, http.StatusOK, "https://app.example.com", true, true},
+		{"case of the origin", apps, http.MethodGet, "HTTPS://APP.example.com", false, http.StatusOK, "HTTPS://APP.example.com", true, true},
+		{"subdomain", apps, http.MethodPost, "https://a.b.example.org", false, http.StatusOK, "https://a.b.example.org", true, true},
+		{"bare wildcard domain", apps, http.MethodGet, "https://example.org", false, http.StatusOK, "", false, true},
+		{"wildcard past the host", apps, http.MethodGet, "https://evil.com/.example.org", false, http.StatusOK, "", false, true},
+		{"other scheme", apps, http.MethodGet, "http://app.example.com", false, http.StatusOK, "", false, true},
+		{"other origin", apps, http.MethodGet, "https://evil.com", false, http.StatusOK, "", false, true},
+		{"preflight", apps, http.MethodOptions, "https://app.example.com", true, http.StatusNoContent, "https://app.example.com", true, false},
+		{"refused preflight", apps, http.MethodOptions, "https://evil.com", true, http.StatusNoContent, "", false, false},
+		{"options without preflight", apps, http.MethodOptions, "https://app.example.com", false, http.StatusOK, "https://app.example.com", true, true},
+		{"any origin", everyone, http.MethodGet, "https://evil.com", false, http.StatusOK, "*", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := false
+			h := CORS(tt.cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+			r := httptest.NewRequest(tt.method, "/api/go/users", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", http.MethodDelete)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if w.Code != tt.code || served != tt.served {
+				t.Errorf("got %d, served %v, want %d, served %v", w.Code, served, tt.code, tt.served)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.allowOrigin)
+			}
+			if got := w.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.credentials {
+				t.Errorf("credentials allowed is %v, want %v", got, tt.credentials)
+			}
+			if w.Header().Get("Vary") == "" {
+				t.Error("the response doesn't vary by Origin")
+			}
+			allowed := tt.preflight && tt.allowOrigin != ""
+			if got := w.Header().Get("Access-Control-Allow-Methods") != ""; got != allowed {
+				t.Errorf("methods allowed is %v, want %v", got, allowed)
+			}
+			if allowed && w.Header().Get("Access-Control-Max-Age") != "3600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 3600", w.Header().Get("Access-Control-Max-Age"))
+			}
+		})
+	}
+}
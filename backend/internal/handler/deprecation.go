@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/metrics"
+)
+
+// Deprecation describes an endpoint or a field being phased out, announced
+// to the clients using it with the Deprecation (RFC 9745), Sunset (RFC 8594)
+// and Link rel="deprecation" headers
+type Deprecation struct {
+	// Surface names what is deprecated in the metric, such as "users.age";
+	// routes default to their method and path, such as "GET /users/{id}"
+	Surface string
+	// Since is when it was deprecated
+	Since time.Time
+	// Sunset is when it is removed, zero while not decided
+	Sunset time.Time
+	// Link is the URL of its documentation, such as what to use instead
+	Link string
+}
+
+// deprecated declares the route of next deprecated, e.g.
+//
+//	api.HandleFunc("/users/{id}/history", s.deprecated(Deprecation{
+//		Since:  time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+//		Sunset: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC),
+//		Link:   "https://example.com/changelog#history",
+//	}, s.getUserHistory)).Methods("GET").Name("users:history")
+func (s *Server) deprecated(d Deprecation, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		d := d
+		if d.Surface == "" {
+			d.Surface = r.Method + " " + r.URL.Path
+			if route := mux.CurrentRoute(r); route != nil {
+				if tmpl, err := route.GetPathTemplate(); err == nil {
+					d.Surface = r.Method + " /" + s.trimAPIPrefix(tmpl)
+				}
+			}
+		}
+		s.markDeprecated(w, r, d)
+		next(w, r)
+	}
+}
+
+// markDeprecated announces that the request uses d, for handlers to call
+// when it uses a deprecated field or parameter, and counts it. A response
+// using several deprecated surfaces carries the earliest dates and every
+// link.
+func (s *Server) markDeprecated(w http.ResponseWriter, r *http.Request, d Deprecation) {
+	h := w.Header()
+	if since, ok := deprecationTime(h.Get("Deprecation")); !ok || d.Since.Before(since) {
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.Since.Unix(), 10))
+	}
+	if !d.Sunset.IsZero() {
+		if sunset, err := http.ParseTime(h.Get("Sunset")); err != nil || d.Sunset.Before(sunset) {
+			h.Set("Sunset", d.Sunset.UTC().Format(http.TimeFormat))
+		}
+	}
+	if d.Link != "" {
+		link := "<" + d.Link + `>; rel="deprecation"; type="text/html"`
+		if !slices.Contains(h.Values("Link"), link) {
+			h.Add("Link", link)
+		}
+	}
+	s.deprecatedCalls.add(d.Surface, APIVersionFrom(r.Context()))
+}
+
+// deprecationTime parses a Deprecation header, an @ and Unix seconds
+func deprecationTime(value string) (time.Time, bool) {
+	if len(value) < 2 || value[0] != '@' {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value[1:], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0), true
+}
+
+// deprecatedCalls counts the requests using each deprecated surface, by
+// version of the API, so it's known when nobody uses it anymore
+type deprecatedCalls struct {
+	mu     sync.Mutex
+	counts map[[2]string]int64
+}
+
+func (c *deprecatedCalls) add(surface, version string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[[2]string]int64{}
+	}
+	c.counts[[2]string{surface, version}]++
+}
+
+// collect reports the counts, sorted by surface and version
+func (c *deprecatedCalls) collect() []metrics.Sample {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys := make([][2]string, 0, len(c.counts))
+	for key := range c.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+
+	samples := make([]metrics.Sample, len(keys))
+	for i, key := range keys {
+		samples[i] = metrics.Sample{
+			Name: "http_deprecated_requests_total", Help: "Requests using deprecated endpoints or fields, by surface and API version.", Type: metrics.Counter,
+			Labels: map[string]string{"surface": key[0], "version": key[1]}, Value: float64(c.counts[key]),
+		}
+	}
+	return samples
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDeprecatedRoute(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	w := serve(s, "/api/go/v1/healthdb", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+
+	since := time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC)
+	if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(since.Unix(), 10); got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if got := w.Header().Get("Sunset"); got != "" {
+		t.Errorf("Sunset = %q, want none until it is decided", got)
+	}
+	if got, want := w.Header().Get("Link"), `<https://github.com/nandaiqbalh/simple-crud#health-checks>; rel="deprecation"; type="text/html"`; got != want {
+		t.Errorf("Link = %q, want %q", got, want)
+	}
+
+	samples := s.deprecatedCalls.collect()
+	if len(samples) != 1 || samples[0].Labels["surface"] != "GET /healthdb" || samples[0].Labels["version"] != "v1" || samples[0].Value != 1 {
+		t.Errorf("samples = %+v, want one call of GET /healthdb in v1", samples)
+	}
+}
+
+func TestMarkDeprecatedKeepsEarliestDates(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	r := httptest.NewRequest(http.MethodGet, "/api/go/users", nil)
+	w := httptest.NewRecorder()
+
+	early := Deprecation{Surface: "users.age", Since: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Sunset: time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC), Link: "https://example.com/age"}
+	late := Deprecation{Surface: "users.role", Since: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), Sunset: time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC), Link: "https://example.com/role"}
+	s.markDeprecated(w, r, late)
+	s.markDeprecated(w, r, early)
+	s.markDeprecated(w, r, early)
+
+	if got, want := w.Header().Get("Deprecation"), "@"+strconv.FormatInt(early.Since.Unix(), 10); got != want {
+		t.Errorf("Deprecation = %q, want %q", got, want)
+	}
+	if got, want := w.Header().Get("Sunset"), early.Sunset.Format(http.TimeFormat); got != want {
+		t.Errorf("Sunset = %q, want %q", got, want)
+	}
+	if links := w.Header().Values("Link"); len(links) != 2 {
+		t.Errorf("Link = %q, want each link once", links)
+	}
+}
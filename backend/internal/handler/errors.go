@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/internal/model"
+	"api/internal/service"
+)
+
+// errorResponse maps an error from the service or repository layer to an
+// HTTP status, a message safe to show to clients and optional details.
+// Unknown errors become a generic 500 so driver messages never leak.
+func errorResponse(err error) (int, string, map[string]interface{}) {
+	var validationErr *service.ValidationError
+	var notFoundErr *model.NotFoundError
+	var conflictErr *model.ConflictError
+	var forbiddenErr *model.ForbiddenError
+	switch {
+	case errors.As(err, &validationErr):
+		return http.StatusUnprocessableEntity, "Validation failed", map[string]interface{}{
+			"errors": validationErr.Fields,
+		}
+	case errors.Is(err, model.ErrEncryptedSort):
+		return http.StatusBadRequest, "Users can't be sorted by email while emails are encrypted", nil
+	case errors.Is(err, model.ErrValidation):
+		return http.StatusUnprocessableEntity, "Validation failed", nil
+	case errors.As(err, &forbiddenErr):
+		fields := map[string]string{}
+		for _, field := range forbiddenErr.Fields {
+			fields[field] = "you are not allowed to change it"
+		}
+		return http.StatusForbidden, "Access denied", map[string]interface{}{"errors": fields}
+	case errors.Is(err, model.ErrImpersonation):
+		return http.StatusForbidden, "You can't impersonate yourself, or anyone while impersonating", nil
+	case errors.Is(err, model.ErrForbidden):
+		return http.StatusForbidden, "Access denied", nil
+	case errors.As(err, &notFoundErr):
+		return http.StatusNotFound, capitalize(notFoundErr.Resource) + " not found", nil
+	case errors.Is(err, model.ErrNotFound):
+		return http.StatusNotFound, "Not found", nil
+	case errors.As(err, &conflictErr):
+		// name the field in both the message and the field errors, so forms can highlight it
+		return http.StatusConflict, capitalize(conflictErr.Field) + " is already in use", map[string]interface{}{
+			"errors": map[string]string{conflictErr.Field: "is already in use"},
+		}
+	case errors.Is(err, model.ErrVersionConflict):
+		return http.StatusConflict, "The record was changed by someone else, reload it and try again", nil
+	case errors.Is(err, model.ErrRoleInUse):
+		return http.StatusConflict, "The role is still given to users, change their role first", nil
+	case errors.Is(err, model.ErrOrganizationInUse):
+		return http.StatusConflict, "The organization still has users or teams, delete them first", nil
+	case errors.Is(err, model.ErrInvitationAccepted):
+		return http.StatusConflict, "The invitation was already accepted", nil
+	case errors.Is(err, model.ErrAlreadyAnonymized):
+		return http.StatusConflict, "The user was anonymized", nil
+	case errors.Is(err, model.ErrConflict):
+		return http.StatusConflict, "Conflict", nil
+	case errors.Is(err, model.ErrInvalidCredentials):
+		return http.StatusUnauthorized, "Invalid email or password", nil
+	case errors.Is(err, model.ErrEmailNotVerified):
+		return http.StatusForbidden, "Verify your email address before logging in", nil
+	case errors.Is(err, model.ErrInvalidToken):
+		return http.StatusBadRequest, "The link is invalid or has expired", nil
+	case errors.Is(err, model.ErrInvitationExpired):
+		return http.StatusGone, "The invitation has expired, ask for a new one", nil
+	case errors.Is(err, model.ErrUnavailable):
+		return http.StatusServiceUnavailable, "Service temporarily unavailable, retry later", nil
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable, "Request timed out", nil
+	case errors.Is(err, context.Canceled):
+		return http.StatusServiceUnavailable, "Request cancelled", nil
+	default:
+		return http.StatusInternalServerError, "Internal server error", nil
+	}
+}
+
+// sendDomainError sends the response errorResponse maps err to, logging
+// the underlying error of unexpected failures
+func (s *Server) sendDomainError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message, data := errorResponse(err)
+	var unavailable *model.UnavailableError
+	if errors.As(err, &unavailable) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(unavailable.RetryAfter.Seconds()))))
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		// the client went away, nobody will read the response
+	case code == http.StatusInternalServerError, errors.Is(err, context.DeadlineExceeded):
+		s.logger.Printf("[error] request_id=%s %s %s: %v", RequestIDFrom(r.Context()), r.Method, r.URL.Path, err)
+	}
+	s.sendError(w, r, code, message, data)
+}
+
+// capitalize upper-cases the first letter of a resource or field name
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
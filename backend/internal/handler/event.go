@@ -0,0 +1,62 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"api/internal/model"
+)
+
+// getEvents handler to list the domain events of the organization recorded
+// after ?since=, oldest first, optionally only those of a type
+func (s *Server) getEvents(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 100, 1000)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params := model.EventParams{Type: r.URL.Query().Get("type"), Limit: limit}
+	if value := r.URL.Query().Get("since"); value != "" {
+		if params.Since, err = strconv.ParseInt(value, 10, 64); err != nil || params.Since < 0 {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter since must be an event ID", nil)
+			return
+		}
+	}
+
+	events, err := s.users.ListEvents(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	for i := range events {
+		if events[i], err = s.shapeEvent(r, events[i]); err != nil {
+			s.sendDomainError(w, r, err)
+			return
+		}
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Events fetched successfully", events)
+}
+
+// replayEvents handler to publish a range of delivered events again
+func (s *Server) replayEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.subsystems.Enabled("events") {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Replays need an event publisher, which is not enabled", nil)
+		return
+	}
+	var input struct {
+		From int64 `json:"from"`
+		To   int64 `json:"to"`
+	}
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	replayed, err := s.users.ReplayEvents(r.Context(), input.From, input.To)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusAccepted, "Events queued for replay", map[string]int{"replayed": replayed})
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/internal/model"
+)
+
+// parseFilter reads the listing filters from the query string. The returned
+// map holds a message for every malformed parameter.
+func parseFilter(query url.Values) (model.UserFilter, map[string]string) {
+	var filter model.UserFilter
+	invalid := map[string]string{}
+
+	for _, role := range strings.Split(query.Get("role"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			filter.Roles = append(filter.Roles, role)
+		}
+	}
+
+	for _, team := range strings.Split(query.Get("team"), ",") {
+		if team = strings.TrimSpace(team); team == "" {
+			continue
+		}
+		id, err := strconv.Atoi(team)
+		if err != nil {
+			invalid["team"] = "must be a comma-separated list of team IDs"
+			continue
+		}
+		filter.Teams = append(filter.Teams, id)
+	}
+
+	intParam := func(name string) *int {
+		value := query.Get(name)
+		if value == "" {
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			invalid[name] = "must be a whole number"
+			return nil
+		}
+		return &n
+	}
+	filter.AgeMin = intParam("age_min")
+	filter.AgeMax = intParam("age_max")
+
+	dateParam := func(name string) *model.Date {
+		value := query.Get(name)
+		if value == "" {
+			return nil
+		}
+		date, err := model.ParseDate(value)
+		if err != nil {
+			invalid[name] = "must be a date in YYYY-MM-DD format"
+			return nil
+		}
+		return &date
+	}
+	filter.BirthAfter = dateParam("birth_after")
+	filter.BirthBefore = dateParam("birth_before")
+
+	// creation bounds take a day or a full RFC 3339 timestamp
+	timeParam := func(name string) *time.Time {
+		value := query.Get(name)
+		if value == "" {
+			return nil
+		}
+		if date, err := model.ParseDate(value); err == nil {
+			return &date.Time
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			invalid[name] = "must be a date (YYYY-MM-DD) or an RFC 3339 timestamp"
+			return nil
+		}
+		return &t
+	}
+	filter.CreatedAfter = timeParam("created_after")
+	filter.CreatedBefore = timeParam("created_before")
+
+	// metadata.<key>=<value> matches a metadata value exactly
+	for name, values := range query {
+		key, ok := strings.CutPrefix(name, "metadata.")
+		if !ok {
+			continue
+		}
+		if !model.MetadataKeyPattern.MatchString(key) {
+			invalid[name] = "must name a metadata key of letters, digits, '_' or '-'"
+			continue
+		}
+		if filter.Metadata == nil {
+			filter.Metadata = map[string]string{}
+		}
+		filter.Metadata[key] = values[0]
+	}
+
+	if len(invalid) == 0 {
+		invalid = nil
+	}
+	return filter, invalid
+}
@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/flags"
+	"api/internal/model"
+)
+
+// featureFlag is a known flag along with its overrides
+type featureFlag struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Default     bool   `json:"default"`
+	// Enabled is whether the flag is on for organizations without an
+	// override of their own
+	Enabled   bool                `json:"enabled"`
+	Overrides []model.FeatureFlag `json:"overrides"`
+}
+
+// getFeatureFlags handler to list the feature flags, with their overrides
+func (s *Server) getFeatureFlags(w http.ResponseWriter, r *http.Request) {
+	overrides, err := s.users.ListFeatureFlags(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	list := make([]featureFlag, len(flags.Known))
+	for i, flag := range flags.Known {
+		list[i] = featureFlag{Name: flag.Name, Description: flag.Description, Default: s.cfg.Users.Flags.Default(flag.Name), Overrides: []model.FeatureFlag{}}
+		list[i].Enabled = list[i].Default
+		for _, override := range overrides {
+			if override.Name != flag.Name {
+				continue
+			}
+			if override.OrgID == flags.AllOrgs {
+				list[i].Enabled = override.Enabled
+			}
+			list[i].Overrides = append(list[i].Overrides, override)
+		}
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Feature flags fetched successfully", list)
+}
+
+// setFeatureFlag handler to turn a feature flag on or off, for every
+// organization or for one
+func (s *Server) setFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	var input model.FeatureFlagInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	flag, err := s.users.SetFeatureFlag(r.Context(), mux.Vars(r)["name"], input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.reloadFeatureFlags(r.Context())
+	sendJSONResponse(w, true, http.StatusOK, "Feature flag updated successfully", flag)
+}
+
+// deleteFeatureFlag handler to remove the override of a feature flag, for
+// the organization of ?org_id= or, without it, for every organization
+func (s *Server) deleteFeatureFlag(w http.ResponseWriter, r *http.Request) {
+	orgID := flags.AllOrgs
+	if value := r.URL.Query().Get("org_id"); value != "" {
+		id, err := atoi(value)
+		if err != nil {
+			s.sendError(w, r, http.StatusBadRequest, "Invalid organization ID", nil)
+			return
+		}
+		orgID = id
+	}
+
+	if err := s.users.DeleteFeatureFlag(r.Context(), mux.Vars(r)["name"], orgID); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.reloadFeatureFlags(r.Context())
+	sendJSONResponse(w, true, http.StatusOK, "Feature flag override deleted successfully", nil)
+}
+
+// LoadFeatureFlags loads the overrides stored in the database into the
+// feature flags
+func (s *Server) LoadFeatureFlags(ctx context.Context) error {
+	overrides, err := s.users.ListFeatureFlags(ctx)
+	if err != nil {
+		return err
+	}
+
+	loaded := make([]flags.Override, len(overrides))
+	for i, override := range overrides {
+		loaded[i] = flags.Override{Name: override.Name, OrgID: override.OrgID, Enabled: override.Enabled}
+	}
+	s.cfg.Users.Flags.Load(loaded)
+	return nil
+}
+
+// WatchFeatureFlags loads the stored overrides, then reloads them every
+// interval until ctx is cancelled, picking up changes made through other
+// instances. The first load happens synchronously.
+func (s *Server) WatchFeatureFlags(ctx context.Context, interval time.Duration) error {
+	if err := s.LoadFeatureFlags(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// keep the last loaded overrides when the database is unavailable
+				if err := s.LoadFeatureFlags(ctx); err != nil {
+					s.logger.Printf("[flags] Feature flags refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reloadFeatureFlags applies a change to the overrides right away on this
+// instance; failures are left to the next refresh
+func (s *Server) reloadFeatureFlags(ctx context.Context) {
+	if s.cfg.Users.Flags == nil {
+		return
+	}
+	if err := s.LoadFeatureFlags(context.WithoutCancel(ctx)); err != nil {
+		s.logger.Printf("[flags] Feature flags reload failed: %v", err)
+	}
+}
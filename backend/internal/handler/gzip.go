@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// DefaultGzipTypes are the content types compressed when Gzip is given none
+var DefaultGzipTypes = []string{"application/json", "application/problem+json", "application/xml", "text/*"}
+
+// Gzip middleware compresses responses for clients sending Accept-Encoding: gzip.
+// Only bodies of at least minSize bytes whose Content-Type matches one of types
+// are compressed; a type may end in /* to match a whole family, like text/*.
+func Gzip(minSize int, types []string) func(http.Handler) http.Handler {
+	if len(types) == 0 {
+		types = DefaultGzipTypes
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipResponseWriter{ResponseWriter: w, minSize: minSize, types: types}
+			defer gw.finish()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header lists gzip with a non-zero quality
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			return strings.ReplaceAll(params, " ", "") != "q=0"
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter buffers the start of the body until it knows whether
+// the response is worth compressing
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	minSize int
+	types   []string
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer // set once compression was chosen
+}
+
+func (g *gzipResponseWriter) WriteHeader(status int) {
+	if g.status == 0 {
+		g.status = status
+	}
+}
+
+func (g *gzipResponseWriter) Write(p []byte) (int, error) {
+	if g.decided {
+		if g.gz != nil {
+			return g.gz.Write(p)
+		}
+		return g.ResponseWriter.Write(p)
+	}
+
+	g.buf = append(g.buf, p...)
+	if len(g.buf) >= g.minSize {
+		if err := g.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// decide writes the header, compressing when big is set and the response
+// qualifies, then flushes the buffered body
+func (g *gzipResponseWriter) decide(big bool) error {
+	g.decided = true
+	if g.status == 0 {
+		g.status = http.StatusOK
+	}
+
+	header := g.Header()
+	if big && header.Get("Content-Encoding") == "" && g.compressible(header.Get("Content-Type")) {
+		header.Set("Content-Encoding", "gzip")
+		header.Del("Content-Length")
+		g.gz = gzip.NewWriter(g.ResponseWriter)
+	}
+	g.ResponseWriter.WriteHeader(g.status)
+
+	if len(g.buf) == 0 {
+		return nil
+	}
+	var err error
+	if g.gz != nil {
+		_, err = g.gz.Write(g.buf)
+	} else {
+		_, err = g.ResponseWriter.Write(g.buf)
+	}
+	g.buf = nil
+	return err
+}
+
+// compressible reports whether the content type matches the configured types
+func (g *gzipResponseWriter) compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range g.types {
+		if t == mediaType || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// finish sends a body that stayed under the minimum size uncompressed and
+// closes the gzip stream
+func (g *gzipResponseWriter) finish() {
+	if !g.decided {
+		if g.status == 0 && len(g.buf) == 0 {
+			return // nothing was written, let net/http send its default response
+		}
+		g.decide(false)
+	}
+	if g.gz != nil {
+		g.gz.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+
+	"api/internal/health"
+	"api/internal/repository"
+)
+
+// healthCheck handler checks every dependency, reporting the status and
+// latency of each along with the overall status: 503 when a critical one
+// is down, 200 otherwise, even when the API is degraded
+func (s *Server) healthCheck(w http.ResponseWriter, r *http.Request) {
+	report := s.health.Check(r.Context())
+	for _, component := range report.Components {
+		if component.Status != health.StatusUp {
+			s.logger.Printf("[error] health check of %s failed: %s", component.Name, component.Error)
+		}
+	}
+
+	switch report.Status {
+	case health.StatusDown:
+		s.sendError(w, r, http.StatusServiceUnavailable, "Unhealthy", map[string]interface{}{
+			"status":     report.Status,
+			"components": report.Components,
+		})
+	case health.StatusDegraded:
+		sendJSONResponse(w, true, http.StatusOK, "Degraded", report)
+	default:
+		sendJSONResponse(w, true, http.StatusOK, "Healthy", report)
+	}
+}
+
+// healthDB handler to check database connection
+func (s *Server) healthDB(w http.ResponseWriter, r *http.Request) {
+	// include connection pool statistics when the repository exposes them
+	var stats map[string]interface{}
+	if reporter, ok := s.repo.(repository.PoolStatsReporter); ok {
+		stats = reporter.PoolStats()
+	}
+
+	if err := s.repo.Ping(r.Context()); err != nil {
+		s.logger.Printf("[error] database ping failed: %v", err)
+		s.sendError(w, r, http.StatusInternalServerError, "Database connection failed", stats)
+		return
+	}
+	sendJSONResponse(w, true, http.StatusOK, "Database connection healthy", stats)
+}
+
+// getMetrics handler exposes the metrics of the subsystems to Prometheus
+func (s *Server) getMetrics(w http.ResponseWriter, r *http.Request) {
+	if s.metrics == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Metrics are not enabled", nil)
+		return
+	}
+	s.metrics.ServeHTTP(w, r)
+}
+
+// BuildInfo describes the binary serving the API
+type BuildInfo struct {
+	Version string `json:"version"`
+	Commit  string `json:"commit,omitempty"`
+	// CommitTime is when the commit was made, known when the binary was
+	// built in a git checkout
+	CommitTime string `json:"commit_time,omitempty"`
+	// Modified is set when the checkout had uncommitted changes
+	Modified  bool   `json:"modified,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// version handler reports what is deployed
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, true, http.StatusOK, "Version fetched successfully", s.cfg.Build)
+}
+
+// livez handler reports that the process is alive and serving requests.
+// It checks no dependency, so a database outage makes instances unready
+// rather than restarting them.
+func (s *Server) livez(w http.ResponseWriter, r *http.Request) {
+	sendJSONResponse(w, true, http.StatusOK, "Alive", nil)
+}
+
+// readyz handler reports whether the API can serve traffic: its critical
+// dependencies, the database and its migrations, are checked, and the
+// state of every optional subsystem is listed along
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	report := s.health.Ready(r.Context())
+	data := map[string]interface{}{
+		"database":   "ok",
+		"components": report.Components,
+		"subsystems": s.subsystems.Statuses(),
+	}
+
+	if report.Status != health.StatusUp {
+		for _, component := range report.Components {
+			if component.Status == health.StatusUp {
+				continue
+			}
+			s.logger.Printf("[error] readiness check of %s failed: %s", component.Name, component.Error)
+			if component.Name == "database" {
+				data["database"] = "unavailable"
+			}
+		}
+		s.sendError(w, r, http.StatusServiceUnavailable, "Not ready", data)
+		return
+	}
+	sendJSONResponse(w, true, http.StatusOK, "Ready", data)
+}
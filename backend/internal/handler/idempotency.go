@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// IdempotencyKeyHeader lets clients retry a POST without repeating its effect
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// idempotent makes next replay the stored response when a request repeats
+// an Idempotency-Key seen within the configured window. Requests without
+// the header, or a repository without idempotency support, pass through.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	store, ok := s.repo.(repository.IdempotencyStore)
+	if !ok || s.cfg.IdempotencyWindow <= 0 {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next(w, r)
+			return
+		}
+		if len(key) > 255 {
+			s.sendError(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters", nil)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			// over the body size limit; let the handler report it
+			next(w, r)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// keys are namespaced by caller, so nobody replays or blocks the
+		// requests of others by guessing their keys, and the same key must
+		// come with the same request
+		key = s.idempotencyKey(r, key)
+		hash := sha256.New()
+		io.WriteString(hash, r.Method+" "+r.URL.Path+"\n")
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		now := s.clock()
+		record, err := store.ReserveIdempotencyKey(r.Context(), key, fingerprint, now, now.Add(-s.cfg.IdempotencyWindow))
+		if err != nil {
+			s.sendDomainError(w, r, err)
+			return
+		}
+
+		switch {
+		case record == nil:
+			s.recordIdempotent(store, key, next, w, r)
+		case record.Fingerprint != fingerprint:
+			s.sendError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request", nil)
+		case record.Status == 0:
+			s.sendError(w, r, http.StatusConflict, "A request with this Idempotency-Key is still being processed", nil)
+		default:
+			w.Header().Set("Content-Type", record.ContentType)
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Status)
+			w.Write(record.Body)
+		}
+	}
+}
+
+// idempotencyKey returns the key the client sent as it is stored: hashed
+// along with the actor of the request, who it impersonates and its
+// organization
+func (s *Server) idempotencyKey(r *http.Request, key string) string {
+	actor := model.ActorFrom(r.Context())
+	hash := sha256.New()
+	fmt.Fprintf(hash, "actor %s\nimpersonator %s\n", actor.ID, actor.Impersonator)
+	if org, ok := model.OrgFrom(r.Context()); ok {
+		fmt.Fprintf(hash, "org %d\n", org)
+	}
+	io.WriteString(hash, key)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// recordIdempotent runs the request holding key and stores its response.
+// Server errors and panics release the key instead, so the client can retry.
+func (s *Server) recordIdempotent(store repository.IdempotencyStore, key string, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	// the request context may be cancelled by now, the outcome must still be saved
+	ctx := context.WithoutCancel(r.Context())
+	defer func() {
+		if p := recover(); p != nil {
+			if err := store.ReleaseIdempotencyKey(ctx, key); err != nil {
+				s.logger.Printf("[error] request_id=%s failed to release idempotency key: %v", RequestIDFrom(r.Context()), err)
+			}
+			// for the Recover middleware to answer
+			panic(p)
+		}
+	}()
+
+	rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+	next(rec, r)
+
+	var err error
+	if rec.status >= 500 {
+		err = store.ReleaseIdempotencyKey(ctx, key)
+	} else {
+		err = store.CompleteIdempotencyKey(ctx, key, rec.status, w.Header().Get("Content-Type"), rec.body.Bytes())
+	}
+	if err != nil {
+		s.logger.Printf("[error] request_id=%s failed to store idempotency key: %v", RequestIDFrom(r.Context()), err)
+	}
+}
+
+// responseRecorder passes a response through while keeping a copy of it
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(p []byte) (int, error) {
+	rec.wroteHeader = true
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
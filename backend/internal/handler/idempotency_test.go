@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"api/internal/model"
+)
+
+// postIdempotent sends a POST with the Idempotency-Key to h as actor
+func postIdempotent(h http.Handler, actor, key string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/api/go/users", strings.NewReader(`{"name":"Ann"}`))
+	r.Header.Set(IdempotencyKeyHeader, key)
+	r = r.WithContext(model.WithActor(r.Context(), model.Actor{ID: actor}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestIdempotentKeysPerActor(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	s.cfg.IdempotencyWindow = time.Hour
+	calls := 0
+	h := s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		sendJSONResponse(w, true, http.StatusCreated, "Created", calls)
+	})
+
+	postIdempotent(h, "1", "key")
+	if w := postIdempotent(h, "1", "key"); w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("the retry of the same actor wasn't replayed")
+	}
+	if w := postIdempotent(h, "2", "key"); w.Header().Get("Idempotent-Replayed") != "" || calls != 2 {
+		t.Errorf("the same key from another actor was replayed")
+	}
+}
+
+func TestIdempotentReleasesKeyOnPanic(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	s.cfg.IdempotencyWindow = time.Hour
+	panicking := true
+	h := s.Recover(s.idempotent(func(w http.ResponseWriter, r *http.Request) {
+		if panicking {
+			panic("boom")
+		}
+		sendJSONResponse(w, true, http.StatusCreated, "Created", nil)
+	}))
+
+	if w := postIdempotent(h, "1", "key"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	panicking = false
+	if w := postIdempotent(h, "1", "key"); w.Code != http.StatusCreated {
+		t.Errorf("the retry after the panic got %d, want 201: %s", w.Code, w.Body)
+	}
+}
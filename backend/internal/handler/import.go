@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// createImport handler to import the users of the CSV in the "file" field
+// of a multipart/form-data body in the background, answering at once with
+// the import to poll
+func (s *Server) createImport(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Users.Jobs == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Imports need the job queue, which is not enabled", nil)
+		return
+	}
+	data, ok := s.readUpload(w, r, "file", "a CSV file", s.cfg.Users.ImportMaxBytes)
+	if !ok {
+		return
+	}
+
+	imp, err := s.users.CreateImport(r.Context(), data)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusAccepted, "Import queued", imp)
+}
+
+// getImport handler to report the progress of an import, and the rows that
+// failed so far
+func (s *Server) getImport(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid import ID", nil)
+		return
+	}
+
+	imp, err := s.users.GetImport(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Import fetched successfully", imp)
+}
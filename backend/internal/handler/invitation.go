@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// invitationsEnabled sends a 503 and returns false when no mailer or invitation secret is configured
+func (s *Server) invitationsEnabled(w http.ResponseWriter, r *http.Request) bool {
+	if s.cfg.Users.Mailer == nil || len(s.cfg.Users.InviteSecret) == 0 {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Invitations are not enabled", nil)
+		return false
+	}
+	return true
+}
+
+// getInvitations handler to list the invitations of the organization
+func (s *Server) getInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := s.users.ListInvitations(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Invitations fetched successfully", invitations)
+}
+
+// createInvitation handler to email someone a link to join with a role
+func (s *Server) createInvitation(w http.ResponseWriter, r *http.Request) {
+	if !s.invitationsEnabled(w, r) {
+		return
+	}
+	var input model.InvitationInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	invitation, err := s.users.CreateInvitation(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Invitation sent successfully", invitation)
+}
+
+// acceptInvitation handler to create the invited user from the token of an invitation link
+func (s *Server) acceptInvitation(w http.ResponseWriter, r *http.Request) {
+	if !s.invitationsEnabled(w, r) {
+		return
+	}
+	var input model.AcceptInvitationInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	user, err := s.users.AcceptInvitation(r.Context(), mux.Vars(r)["token"], input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Invitation accepted successfully", user)
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// AllRoutes is the route group whose IPRules apply to every route
+const AllRoutes = "*"
+
+// IPRules are the networks allowed to reach a group of routes, and those
+// denied. Denied networks win; when Allow is empty every network not denied
+// is allowed.
+type IPRules struct {
+	Allow []netip.Prefix
+	Deny  []netip.Prefix
+}
+
+// allows reports whether the rules let ip through
+func (rules IPRules) allows(ip netip.Addr) bool {
+	if containsIP(rules.Deny, ip) {
+		return false
+	}
+	return len(rules.Allow) == 0 || containsIP(rules.Allow, ip)
+}
+
+// IPFilter middleware refuses the requests from client IPs the rules of
+// the route's group, or of AllRoutes, don't allow. The group of a route is
+// the resource of its name, e.g. "admin" for admin:tasks.
+func (s *Server) IPFilter() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			groups := []string{AllRoutes}
+			if route := mux.CurrentRoute(r); route != nil {
+				group, _, _ := strings.Cut(route.GetName(), ":")
+				groups = append(groups, group)
+			}
+
+			client := s.clientIP(r)
+			ip, err := netip.ParseAddr(client)
+			for _, group := range groups {
+				rules, ok := s.cfg.IPRules[group]
+				if !ok {
+					continue
+				}
+				if err != nil || !rules.allows(ip.Unmap()) {
+					s.logger.Printf("IP %s denied access to %s %s", client, r.Method, r.URL.Path)
+					s.sendError(w, r, http.StatusForbidden, "Access denied from your IP address", nil)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the IP address the request came from. Behind TrustedProxies
+// it is the last address of X-Forwarded-For that isn't one of them, as the
+// addresses before it were sent by the client, who could make them up.
+// Requests over a unix socket, which has no addresses, come from a process
+// of the host, such as a reverse proxy: it is trusted like TrustedProxies,
+// and stands for the loopback address.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip, err := netip.ParseAddr(host)
+	if host == "" || host == "@" {
+		ip = netip.AddrFrom4([4]byte{127, 0, 0, 1})
+	} else if err != nil || !containsIP(s.cfg.TrustedProxies, ip.Unmap()) {
+		return host
+	}
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	client := ip
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = hop.Unmap()
+		if !containsIP(s.cfg.TrustedProxies, client) {
+			break
+		}
+	}
+	return client.String()
+}
+
+// containsIP reports whether one of the networks contains ip
+func containsIP(networks []netip.Prefix, ip netip.Addr) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
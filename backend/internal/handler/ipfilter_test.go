@@ -0,0 +1,53 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	s.cfg.IPRules = map[string]IPRules{
+		AllRoutes: {Deny: []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}},
+		"health":  {Allow: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+	}
+	s.cfg.TrustedProxies = []netip.Prefix{netip.MustParsePrefix("192.0.2.1/32")}
+	router := s.Routes()
+	router.Use(s.IPFilter())
+
+	tests := []struct {
+		name         string
+		method, path string
+		remote       string
+		forwardedFor string
+		code         int
+	}{
+		{"allowed", http.MethodGet, "/api/go/users", "198.51.100.7:1234", "", http.StatusOK},
+		{"denied", http.MethodGet, "/api/go/users", "203.0.113.5:1234", "", http.StatusForbidden},
+		{"denied mapped to IPv6", http.MethodGet, "/api/go/users", "[::ffff:203.0.113.5]:1234", "", http.StatusForbidden},
+		{"denied login", http.MethodPost, "/api/go/auth/login", "203.0.113.5:1234", "", http.StatusForbidden},
+		{"group allowed", http.MethodGet, "/livez", "10.1.2.3:1234", "", http.StatusOK},
+		{"group not allowed", http.MethodGet, "/livez", "198.51.100.7:1234", "", http.StatusForbidden},
+		{"group denied for all routes", http.MethodGet, "/livez", "203.0.113.5:1234", "", http.StatusForbidden},
+		{"behind a trusted proxy", http.MethodGet, "/livez", "192.0.2.1:1234", "10.1.2.3", http.StatusOK},
+		{"denied behind a trusted proxy", http.MethodGet, "/api/go/users", "192.0.2.1:1234", "203.0.113.5", http.StatusForbidden},
+		{"made up hop", http.MethodGet, "/livez", "192.0.2.1:1234", "10.1.2.3, 198.51.100.7", http.StatusForbidden},
+		{"untrusted proxy", http.MethodGet, "/livez", "198.51.100.9:1234", "10.1.2.3", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = tt.remote
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			s.NegotiateVersion(router).ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Fatalf("got %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
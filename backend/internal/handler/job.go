@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getJobs handler to list the background jobs of the organization, newest
+// first, optionally only those of a status or type
+func (s *Server) getJobs(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 50, 500)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params := model.JobParams{Type: r.URL.Query().Get("type"), Limit: limit}
+	switch status := model.JobStatus(r.URL.Query().Get("status")); status {
+	case "", model.JobPending, model.JobRunning, model.JobDead:
+		params.Status = status
+	default:
+		s.sendError(w, r, http.StatusBadRequest, "Query parameter status must be pending, running or dead", nil)
+		return
+	}
+	if value := r.URL.Query().Get("before"); value != "" {
+		if params.Before, err = atoi(value); err != nil || params.Before <= 0 {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter before must be a job ID", nil)
+			return
+		}
+	}
+
+	jobs, err := s.users.ListJobs(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Jobs fetched successfully", jobs)
+}
+
+// retryJob handler to run a dead job again
+func (s *Server) retryJob(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid job ID", nil)
+		return
+	}
+
+	job, err := s.users.RetryJob(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Job queued again", job)
+}
@@ -0,0 +1,114 @@
+package handler
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/metrics"
+)
+
+// unshedGroups are the route groups never shed, so health probes and
+// metric scrapes still answer while the API is saturated
+var unshedGroups = map[string]bool{"health": true, "metrics": true}
+
+// inFlight is the gate of a route group: a slot per request it may serve
+// at once
+type inFlight struct {
+	slots chan struct{}
+	shed  atomic.Int64
+}
+
+// acquire takes a slot, reporting false when none is free
+func (g *inFlight) acquire() bool {
+	select {
+	case g.slots <- struct{}{}:
+		return true
+	default:
+		g.shed.Add(1)
+		return false
+	}
+}
+
+func (g *inFlight) release() {
+	<-g.slots
+}
+
+// LoadShed middleware caps the requests served at once by each route
+// group in MaxInFlight, AllRoutes covering them all, and answers those past
+// the cap with 503 and a Retry-After of LoadShedRetryAfter right away,
+// instead of queueing them for database connections. The group of a route
+// is the resource of its name, as for IPFilter.
+func (s *Server) LoadShed() mux.MiddlewareFunc {
+	gates := map[string]*inFlight{}
+	for group, limit := range s.cfg.MaxInFlight {
+		if limit > 0 {
+			gates[group] = &inFlight{slots: make(chan struct{}, limit)}
+		}
+	}
+	if s.metrics != nil {
+		s.metrics.Register(loadShedMetrics(gates))
+	}
+	retryAfter := strconv.Itoa(int(math.Ceil(s.cfg.LoadShedRetryAfter.Seconds())))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			group := ""
+			if route := mux.CurrentRoute(r); route != nil {
+				group, _, _ = strings.Cut(route.GetName(), ":")
+			}
+			if unshedGroups[group] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			for _, name := range []string{AllRoutes, group} {
+				gate, ok := gates[name]
+				if !ok {
+					continue
+				}
+				if !gate.acquire() {
+					s.logger.Printf("Shed %s %s: %d requests in flight for %s", r.Method, r.URL.Path, cap(gate.slots), name)
+					w.Header().Set("Retry-After", retryAfter)
+					s.sendError(w, r, http.StatusServiceUnavailable, "Service temporarily unavailable, retry later", nil)
+					return
+				}
+				defer gate.release()
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loadShedMetrics reports the requests in flight and shed of each gated
+// route group
+func loadShedMetrics(gates map[string]*inFlight) metrics.Collector {
+	groups := make([]string, 0, len(gates))
+	for group := range gates {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	return func() []metrics.Sample {
+		samples := make([]metrics.Sample, 0, 2*len(groups))
+		for _, group := range groups {
+			samples = append(samples, metrics.Sample{
+				Name: "http_in_flight_requests", Help: "Requests being served, by route group.", Type: metrics.Gauge,
+				Labels: map[string]string{"group": group}, Value: float64(len(gates[group].slots)),
+			})
+		}
+		for _, group := range groups {
+			samples = append(samples, metrics.Sample{
+				Name: "http_shed_requests_total", Help: "Requests refused with 503 as their route group was saturated.", Type: metrics.Counter,
+				Labels: map[string]string{"group": group}, Value: float64(gates[group].shed.Load()),
+			})
+		}
+		return samples
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net/http"
+
+	"api/internal/model"
+)
+
+// getMe handler to fetch the logged in user
+func (s *Server) getMe(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	user, err := s.users.Get(r.Context(), identity.User.ID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUser(w, r, http.StatusOK, "User fetched successfully", user, fields)
+}
+
+// patchMe handler to update the profile of the logged in user
+func (s *Server) patchMe(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var patch model.UserPatch
+	if !s.decodeJSON(w, r, &patch) {
+		return
+	}
+
+	user, err := s.users.UpdateProfile(r.Context(), identity.User.ID, patch)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Profile updated successfully", user)
+}
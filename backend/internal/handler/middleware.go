@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+	"api/internal/policy"
+	"api/internal/repository"
+)
+
+// JSONContentTypeMiddleware to set Content-Type as application/json
+func JSONContentTypeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Swappable serves through the handler last stored in it, so the
+// middleware around the routes can be rebuilt with new settings while
+// serving
+type Swappable struct {
+	current atomic.Pointer[http.Handler]
+}
+
+// Store makes h serve the requests from now on
+func (s *Swappable) Store(h http.Handler) {
+	s.current.Store(&h)
+}
+
+func (s *Swappable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.current.Load()).ServeHTTP(w, r)
+}
+
+// PolicyMiddleware asks the policy engine whether the caller may perform the
+// route's action on the requested resource
+func (s *Server) PolicyMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			decision := s.policy.Decide(policy.Input{
+				Principal: policy.PrincipalFrom(r.Context()),
+				Action:    route.GetName(),
+				Resource:  s.routeResource(r, route),
+				Tenant:    policy.TenantFrom(r.Context()),
+			})
+			if !decision.Allowed && s.policy.Enforcing() {
+				s.sendError(w, r, http.StatusForbidden, "Access denied: "+decision.Reason, nil)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// routeResource is the resource a request acts on: the collection name,
+// followed by the id (or the name of roles) when present
+func (s *Server) routeResource(r *http.Request, route *mux.Route) string {
+	tmpl, _ := route.GetPathTemplate()
+	resource := strings.Split(s.trimAPIPrefix(tmpl), "/")[0]
+	if id := mux.Vars(r)["id"]; id != "" {
+		resource += "/" + id
+	} else if name := mux.Vars(r)["name"]; name != "" {
+		resource += "/" + name
+	}
+	return resource
+}
+
+// Timeout middleware gives every request a deadline. Database calls run with
+// the request context, so they are cancelled once it passes or the client
+// disconnects, instead of piling up.
+func Timeout(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Languages middleware records the locales of the Accept-Language header in
+// the request context, so emails sent while serving it use the language of
+// the client when there is a template in it
+func Languages(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Accept-Language"); header != "" {
+			r = r.WithContext(model.WithLocales(r.Context(), acceptLanguages(header)))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type rawBodyKey struct{}
+
+// MaxBytes middleware caps request bodies at limit bytes; reading past it
+// fails with *http.MaxBytesError, which decodeJSON answers with a 413.
+// The upload handlers know their own limits and set them with
+// setBodyLimit, whatever the Content-Type of other requests claims.
+func MaxBytes(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r = r.WithContext(context.WithValue(r.Context(), rawBodyKey{}, r.Body))
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setBodyLimit caps the body of a request not read yet at limit bytes
+// instead of the limit of MaxBytes
+func setBodyLimit(w http.ResponseWriter, r *http.Request, limit int64) {
+	body := r.Body
+	if raw, ok := r.Context().Value(rawBodyKey{}).(io.ReadCloser); ok {
+		body = raw
+	}
+	r.Body = http.MaxBytesReader(w, body, limit)
+}
+
+// ReplicaReads middleware lets the reads of GET and HEAD requests go to the
+// read replica. The writes some of them make still go to the primary, and so
+// do the reads after them, see repository.WithReplica.
+func ReplicaReads(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			r = r.WithContext(repository.WithReplica(r.Context()))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+type requestIDKey struct{}
+
+// RequestIDHeader carries the id identifying a request in logs and responses
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID middleware tags each request with an id, reusing the one sent by
+// the client or proxy when it is a validRequestID, and echoes it in the
+// response
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+// RequestIDFrom returns the id RequestID gave the request, or "" outside of it
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// maxRequestIDLength is the length of the longest request id reused
+const maxRequestIDLength = 128
+
+// validRequestID reports whether a request id sent by a client can be
+// reused: it is at most maxRequestIDLength letters, digits, dots,
+// underscores and hyphens, so that it can't forge lines or fields in logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// newRequestID returns 16 random bytes, hex encoded
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Recover middleware turns a panic in a handler into a 500 response and logs
+// its stack trace, so one bad request can't take down the connection
+func (s *Server) Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// the server aborts the response itself on this sentinel
+			if rec == http.ErrAbortHandler {
+				panic(rec)
+			}
+
+			s.logger.Printf("[panic] request_id=%s %s %s: %v\n%s", RequestIDFrom(r.Context()), r.Method, r.URL.Path, rec, debug.Stack())
+			s.sendError(w, r, http.StatusInternalServerError, "Internal server error", nil)
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
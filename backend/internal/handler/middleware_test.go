@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name, id string
+		reused   bool
+	}{
+		{"missing", "", false},
+		{"uuid", "3f2b8c1e-7a4d-4e5f-9b6a-0c1d2e3f4a5b", true},
+		{"dotted", "web.1_req-42", true},
+		{"longest", strings.Repeat("a", maxRequestIDLength), true},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"newline", "abc\nrequest_id=forged", false},
+		{"space", "abc def", false},
+		{"quote", `abc"`, false},
+		{"non-ascii", "abcé", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = RequestIDFrom(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(RequestIDHeader, tt.id)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if header := w.Header().Get(RequestIDHeader); header != got {
+				t.Errorf("%s = %q, want the id of the request %q", RequestIDHeader, header, got)
+			}
+			if tt.reused && got != tt.id {
+				t.Errorf("id = %q, want %q reused", got, tt.id)
+			}
+			if !tt.reused && (got == tt.id || !validRequestID(got)) {
+				t.Errorf("id = %q, want a new one", got)
+			}
+		})
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	s, _ := newTestServer(t, false)
+	const limit, uploadLimit = 64, 1024
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		if data, ok := s.readUpload(w, r, "file", "a file", uploadLimit); ok {
+			sendJSONResponse(w, true, http.StatusOK, "Uploaded", len(data))
+		}
+	}
+	decode := func(w http.ResponseWriter, r *http.Request) {
+		var v interface{}
+		if s.decodeJSON(w, r, &v) {
+			sendJSONResponse(w, true, http.StatusOK, "Decoded", nil)
+		}
+	}
+	multipartBody := func(size int) (string, string) {
+		var b strings.Builder
+		writer := multipart.NewWriter(&b)
+		part, _ := writer.CreateFormFile("file", "file.csv")
+		part.Write([]byte(strings.Repeat("a", size)))
+		writer.Close()
+		return b.String(), writer.FormDataContentType()
+	}
+	small, smallType := multipartBody(limit * 2)
+	json := `"` + strings.Repeat("a", limit*2) + `"`
+
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		body        string
+		contentType string
+		code        int
+	}{
+		{"json over the limit", decode, json, "application/json", http.StatusRequestEntityTooLarge},
+		{"json claiming to be multipart", decode, json, smallType, http.StatusRequestEntityTooLarge},
+		{"upload over the limit but within its own", upload, small, smallType, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			MaxBytes(limit)(tt.handler).ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"api/internal/model"
+	"api/internal/usercsv"
+)
+
+// Media types the user endpoints can respond with, JSON being the default
+const (
+	mediaJSON = "application/json"
+	mediaXML  = "application/xml"
+	mediaCSV  = "text/csv"
+)
+
+// xmlResponse is the XML form of APIResponse; data holds one user element
+// per user, so single users and lists share the same shape
+type xmlResponse struct {
+	XMLName xml.Name  `xml:"response"`
+	Success bool      `xml:"success"`
+	Code    int       `xml:"code"`
+	Message string    `xml:"message"`
+	Users   []xmlUser `xml:"data>user"`
+}
+
+// xmlUser encodes the selected fields of a user, or all of them when none
+// are selected, but those left out
+type xmlUser struct {
+	user   model.User
+	fields []string
+	omit   map[string]bool
+}
+
+func (u xmlUser) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if len(u.fields) == 0 {
+		if len(u.omit) == 0 {
+			return enc.EncodeElement(u.user, start)
+		}
+		var buf bytes.Buffer
+		full := xml.NewEncoder(&buf)
+		if err := full.EncodeElement(u.user, start); err != nil {
+			return err
+		}
+		if err := full.Flush(); err != nil {
+			return err
+		}
+		return omitXML(enc, buf.Bytes(), u.omit)
+	}
+
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, field := range u.fields {
+		if u.omit[field] {
+			continue
+		}
+		if err := enc.EncodeElement(u.user.Field(field), xml.StartElement{Name: xml.Name{Local: field}}); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// sendUsers sends a user list encoded in the format the client asked for,
+// limited to fields when any are given, and shaped by the field rules
+func (s *Server) sendUsers(w http.ResponseWriter, r *http.Request, code int, message string, users []model.User, fields []string) {
+	shaped := make([]shapedUser, len(users))
+	items := make([]interface{}, len(users))
+	for i, user := range users {
+		shaped[i] = s.shapeUser(r, user)
+		items[i] = shaped[i].data(fields)
+	}
+	var data interface{} = items
+	if users == nil {
+		data = users
+	}
+	sendNegotiated(w, r, code, message, data, shaped, fields)
+}
+
+// sendUserPage sends a page of a user list like sendUsers, in an envelope
+// with the total and the page's limit and offset when sent as JSON
+func (s *Server) sendUserPage(w http.ResponseWriter, r *http.Request, code int, message string, users []model.User, params model.ListParams, total int) {
+	shaped := make([]shapedUser, len(users))
+	items := make([]interface{}, len(users))
+	for i, user := range users {
+		shaped[i] = s.shapeUser(r, user)
+		items[i] = shaped[i].data(params.Fields)
+	}
+	data := map[string]interface{}{"items": items, "total": total, "limit": params.Limit, "offset": params.Offset}
+	sendNegotiated(w, r, code, message, data, shaped, params.Fields)
+}
+
+// sendUser sends a single user encoded in the format the client asked for,
+// limited to fields when any are given, and shaped by the field rules
+func (s *Server) sendUser(w http.ResponseWriter, r *http.Request, code int, message string, user model.User, fields []string) {
+	shaped := s.shapeUser(r, user)
+	sendNegotiated(w, r, code, message, shaped.data(fields), []shapedUser{shaped}, fields)
+}
+
+// project returns the given fields of user keyed by their JSON name
+func project(user model.User, fields []string) map[string]interface{} {
+	projected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		projected[field] = user.Field(field)
+	}
+	return projected
+}
+
+// sendNegotiated sends data as JSON, or users as XML or CSV when the Accept
+// header prefers one of those
+func sendNegotiated(w http.ResponseWriter, r *http.Request, code int, message string, data interface{}, users []shapedUser, fields []string) {
+	w.Header().Add("Vary", "Accept")
+
+	switch negotiate(r.Header.Get("Accept"), mediaJSON, mediaXML, mediaCSV) {
+	case mediaXML:
+		xmlUsers := make([]xmlUser, len(users))
+		for i, user := range users {
+			xmlUsers[i] = xmlUser{user: user.user, fields: fields, omit: user.omit}
+		}
+
+		w.Header().Set("Content-Type", mediaXML+"; charset=utf-8")
+		w.WriteHeader(code)
+		w.Write([]byte(xml.Header))
+		xml.NewEncoder(w).Encode(xmlResponse{Success: true, Code: code, Message: message, Users: xmlUsers})
+	case mediaCSV:
+		if len(fields) == 0 {
+			fields = usercsv.Header
+		}
+		rows := make([]model.User, len(users))
+		for i, user := range users {
+			rows[i] = user.user
+		}
+
+		w.Header().Set("Content-Type", mediaCSV+"; charset=utf-8")
+		w.WriteHeader(code)
+		usercsv.WriteFieldsHiding(w, rows, fields, func(i int, field string) bool {
+			return users[i].omit[field]
+		})
+	default:
+		sendJSONResponse(w, true, code, message, data)
+	}
+}
+
+// parseFields reads the comma-separated ?fields= parameter, rejecting names
+// that aren't model.UserFields. It returns nil when the parameter is absent.
+func parseFields(r *http.Request) ([]string, error) {
+	value := r.URL.Query().Get("fields")
+	if value == "" {
+		return nil, nil
+	}
+
+	var fields []string
+	seen := map[string]bool{}
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" || seen[field] {
+			continue
+		}
+		if (model.User{}).Field(field) == nil {
+			return nil, fmt.Errorf("Unknown field %q, expected some of %s", field, strings.Join(model.UserFields, ", "))
+		}
+		seen[field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// acceptLanguages returns the language tags of an Accept-Language header,
+// highest q first, leaving out the wildcard and those with q=0
+func acceptLanguages(header string) []string {
+	type language struct {
+		tag string
+		q   float64
+	}
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if tag == "" || tag == "*" || q <= 0 {
+			continue
+		}
+		languages = append(languages, language{tag, q})
+	}
+	sort.SliceStable(languages, func(i, j int) bool { return languages[i].q > languages[j].q })
+
+	tags := make([]string, len(languages))
+	for i, language := range languages {
+		tags[i] = language.tag
+	}
+	return tags
+}
+
+// negotiate picks the offer the Accept header ranks highest, falling back
+// to the first offer when the header is empty or matches none of them.
+// text/xml counts as application/xml, and the media types of the API
+// versions as application/json.
+func negotiate(accept string, offers ...string) string {
+	best, bestQ := offers[0], 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if mediaType == "text/xml" {
+			mediaType = mediaXML
+		} else if _, ok := versionMediaType(mediaType); ok {
+			mediaType = mediaJSON
+		}
+
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+		if q <= bestQ {
+			continue
+		}
+
+		for _, offer := range offers {
+			if mediaType == offer || mediaType == "*/*" || (strings.HasSuffix(mediaType, "/*") && strings.HasPrefix(offer, strings.TrimSuffix(mediaType, "*"))) {
+				best, bestQ = offer, q
+				break
+			}
+		}
+	}
+	return best
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getNotifications handler to list the notifications of the logged in
+// user, newest first, optionally only the unread ones
+func (s *Server) getNotifications(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	limit, err := parseLimit(r, 20, 100)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	params := model.NotificationParams{Limit: limit}
+	if value := r.URL.Query().Get("unread"); value != "" {
+		if params.Unread, err = strconv.ParseBool(value); err != nil {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter unread must be true or false", nil)
+			return
+		}
+	}
+	if value := r.URL.Query().Get("before"); value != "" {
+		if params.Before, err = strconv.ParseInt(value, 10, 64); err != nil || params.Before <= 0 {
+			s.sendError(w, r, http.StatusBadRequest, "Query parameter before must be a notification ID", nil)
+			return
+		}
+	}
+
+	notifications, err := s.users.Notifications(r.Context(), identity.User.ID, params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Notifications fetched successfully", notifications)
+}
+
+// getUnreadNotifications handler to count the unread notifications of the
+// logged in user, for the badge of the bell icon
+func (s *Server) getUnreadNotifications(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := s.users.UnreadNotifications(r.Context(), identity.User.ID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Unread notifications counted successfully", map[string]int{"unread": count})
+}
+
+// readNotification handler to mark a notification of the logged in user read
+func (s *Server) readNotification(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["notificationId"], 10, 64)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid notification ID", nil)
+		return
+	}
+
+	if err := s.users.MarkNotificationRead(r.Context(), identity.User.ID, id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Notification marked read", nil)
+}
+
+// readAllNotifications handler to mark every notification of the logged in
+// user read
+func (s *Server) readAllNotifications(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	marked, err := s.users.MarkAllNotificationsRead(r.Context(), identity.User.ID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Notifications marked read", map[string]int{"marked": marked})
+}
+
+// getNotificationPreferences handler to fetch which channels and types of
+// notifications the logged in user receives
+func (s *Server) getNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefs, err := s.users.NotificationPreferences(r.Context(), identity.User.ID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Notification preferences fetched successfully", prefs)
+}
+
+// putNotificationPreferences handler to replace the notification
+// preferences of the logged in user
+func (s *Server) putNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	identity, ok := s.requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var prefs model.NotificationPreferences
+	if !s.decodeJSON(w, r, &prefs) {
+		return
+	}
+
+	prefs, err := s.users.SetNotificationPreferences(r.Context(), identity.User.ID, prefs)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Notification preferences updated successfully", prefs)
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+	"api/internal/policy"
+)
+
+// OrgHeader names the organization a request is scoped to
+const OrgHeader = "X-Org-ID"
+
+// unscopedActions are the route action prefixes TenantMiddleware leaves
+// unscoped: managing the organizations themselves, health checks, metrics,
+// the version, and accepting invitations, verifying emails and resetting
+// passwords, which are scoped to the organization of the invitation or user
+var unscopedActions = []string{"organizations:", "health:", "metrics:", "version:", "invitations:accept", "auth:verify", "auth:reset-password"}
+
+// TenantMiddleware scopes every request to an organization, so that the
+// repository only sees that tenant's users and teams. The organization is
+// the one of the caller's principal when it belongs to one, as set from its
+// token, and the X-Org-ID header otherwise; a header naming another
+// organization than the principal's is denied.
+func (s *Server) TenantMiddleware() mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := mux.CurrentRoute(r)
+			if route == nil || !tenantScoped(route.GetName()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			header := strings.TrimSpace(r.Header.Get(OrgHeader))
+			value := policy.PrincipalFrom(r.Context()).Org
+			switch {
+			case value != "" && header != "" && header != value:
+				s.sendError(w, r, http.StatusForbidden, "Access denied: you don't belong to organization "+header, nil)
+				return
+			case value == "":
+				value = header
+			}
+			if value == "" {
+				s.sendError(w, r, http.StatusBadRequest, "Header "+OrgHeader+" is required", nil)
+				return
+			}
+
+			id, err := atoi(value)
+			if err != nil || id <= 0 {
+				s.sendError(w, r, http.StatusBadRequest, "Header "+OrgHeader+" must be an organization ID", nil)
+				return
+			}
+			if _, err := s.users.GetOrganization(r.Context(), id); err != nil {
+				s.sendDomainError(w, r, err)
+				return
+			}
+
+			ctx := model.WithOrg(r.Context(), id)
+			ctx = policy.WithTenant(ctx, strconv.Itoa(id))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// tenantScoped reports whether requests for the route action must be scoped to an organization
+func tenantScoped(action string) bool {
+	for _, prefix := range unscopedActions {
+		if strings.HasPrefix(action, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// getOrganizations handler to list every organization
+func (s *Server) getOrganizations(w http.ResponseWriter, r *http.Request) {
+	orgs, err := s.users.ListOrganizations(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Organizations fetched successfully", orgs)
+}
+
+// getOrganization handler to get a single organization by ID
+func (s *Server) getOrganization(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid organization ID", nil)
+		return
+	}
+
+	org, err := s.users.GetOrganization(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Organization fetched successfully", org)
+}
+
+// createOrganization handler to add an organization
+func (s *Server) createOrganization(w http.ResponseWriter, r *http.Request) {
+	var input model.OrganizationInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	org, err := s.users.CreateOrganization(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Organization created successfully", org)
+}
+
+// updateOrganization handler to rename an organization
+func (s *Server) updateOrganization(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid organization ID", nil)
+		return
+	}
+
+	var input model.OrganizationInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	org, err := s.users.UpdateOrganization(r.Context(), id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Organization updated successfully", org)
+}
+
+// deleteOrganization handler to remove an organization without users or teams
+func (s *Server) deleteOrganization(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid organization ID", nil)
+		return
+	}
+
+	if err := s.users.DeleteOrganization(r.Context(), id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Organization deleted successfully", nil)
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+	"api/internal/policy"
+)
+
+// getPermissions handler to list the permissions stored in the database
+func (s *Server) getPermissions(w http.ResponseWriter, r *http.Request) {
+	permissions, err := s.users.ListPermissions(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Permissions fetched successfully", permissions)
+}
+
+// getPermission handler to get a single permission by ID
+func (s *Server) getPermission(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid permission ID", nil)
+		return
+	}
+
+	permission, err := s.users.GetPermission(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Permission fetched successfully", permission)
+}
+
+// createPermission handler to add a permission
+func (s *Server) createPermission(w http.ResponseWriter, r *http.Request) {
+	var input model.PermissionInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	permission, err := s.users.CreatePermission(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.reloadPermissions(r.Context())
+	sendJSONResponse(w, true, http.StatusCreated, "Permission created successfully", permission)
+}
+
+// updatePermission handler to replace a permission
+func (s *Server) updatePermission(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid permission ID", nil)
+		return
+	}
+
+	var input model.PermissionInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	permission, err := s.users.UpdatePermission(r.Context(), id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.reloadPermissions(r.Context())
+	sendJSONResponse(w, true, http.StatusOK, "Permission updated successfully", permission)
+}
+
+// deletePermission handler to remove a permission
+func (s *Server) deletePermission(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid permission ID", nil)
+		return
+	}
+
+	if err := s.users.DeletePermission(r.Context(), id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.reloadPermissions(r.Context())
+	sendJSONResponse(w, true, http.StatusOK, "Permission deleted successfully", nil)
+}
+
+// LoadPermissions loads the permissions stored in the database into the
+// policy engine, as its "database" source
+func (s *Server) LoadPermissions(ctx context.Context) error {
+	permissions, err := s.users.ListPermissions(ctx)
+	if err != nil {
+		return err
+	}
+
+	policies := make([]policy.Policy, len(permissions))
+	for i, permission := range permissions {
+		policies[i] = permissionPolicy(permission)
+	}
+	s.policy.Load("database", policies)
+	return nil
+}
+
+// WatchPermissions loads the stored permissions, then reloads them every
+// interval until ctx is cancelled, picking up changes made through other
+// instances. The first load happens synchronously.
+func (s *Server) WatchPermissions(ctx context.Context, interval time.Duration) error {
+	if err := s.LoadPermissions(ctx); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// keep the last loaded permissions when the database is unavailable
+				if err := s.LoadPermissions(ctx); err != nil {
+					s.logger.Printf("[policy] Permissions refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// reloadPermissions applies a change to the permissions right away on this
+// instance, when they are evaluated; failures are left to the next refresh
+func (s *Server) reloadPermissions(ctx context.Context) {
+	if s.policy == nil || !s.cfg.PolicyDatabase {
+		return
+	}
+	if err := s.LoadPermissions(context.WithoutCancel(ctx)); err != nil {
+		s.logger.Printf("[policy] Permissions reload failed: %v", err)
+	}
+}
+
+// permissionPolicy turns a stored permission into a policy
+func permissionPolicy(permission model.Permission) policy.Policy {
+	return policy.Policy{
+		ID:         "permission:" + strconv.Itoa(permission.ID),
+		Effect:     policy.Effect(permission.Effect),
+		Principals: []string{permission.Principal},
+		Actions:    []string{permission.Action},
+		Resources:  []string{permission.Resource},
+		Fields:     permission.Fields,
+	}
+}
+
+// fieldAuthorizer asks the policy engine whether the caller may change the
+// fields of a user, as the users:update action. Like the route-level check,
+// denials only block the request in enforce mode.
+func fieldAuthorizer(engine *policy.Engine) func(ctx context.Context, id int, fields []string) error {
+	return func(ctx context.Context, id int, fields []string) error {
+		decision := engine.Decide(policy.Input{
+			Principal: policy.PrincipalFrom(ctx),
+			Action:    "users:update",
+			Resource:  fmt.Sprintf("users/%d", id),
+			Tenant:    policy.TenantFrom(ctx),
+			Fields:    fields,
+		})
+		if decision.Allowed || !engine.Enforcing() {
+			return nil
+		}
+		return &model.ForbiddenError{Fields: []string{decision.Field}}
+	}
+}
@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getPhones handler to list the phone numbers of a user
+func (s *Server) getPhones(w http.ResponseWriter, r *http.Request) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	phones, err := s.users.ListPhones(r.Context(), userID)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Phones fetched successfully", phones)
+}
+
+// createPhone handler to add a phone number to a user
+func (s *Server) createPhone(w http.ResponseWriter, r *http.Request) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var input model.PhoneInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	phone, err := s.users.CreatePhone(r.Context(), userID, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Phone created successfully", phone)
+}
+
+// updatePhone handler to replace a phone number of a user
+func (s *Server) updatePhone(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := s.phoneIDs(w, r)
+	if !ok {
+		return
+	}
+
+	var input model.PhoneInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	phone, err := s.users.UpdatePhone(r.Context(), userID, id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Phone updated successfully", phone)
+}
+
+// deletePhone handler to remove a phone number of a user
+func (s *Server) deletePhone(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := s.phoneIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.users.DeletePhone(r.Context(), userID, id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Phone deleted successfully", nil)
+}
+
+// phoneIDs reads the user and phone IDs of a phone route, sending a
+// 400 and returning false when either is malformed
+func (s *Server) phoneIDs(w http.ResponseWriter, r *http.Request) (userID, id int, ok bool) {
+	userID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return 0, 0, false
+	}
+	id, err = atoi(mux.Vars(r)["phoneId"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid phone ID", nil)
+		return 0, 0, false
+	}
+	return userID, id, true
+}
@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const problemContentType = "application/problem+json"
+
+// Error formats selectable through Config.ErrorFormat
+const (
+	ErrorFormatEnvelope = "envelope" // APIResponse with success=false (default)
+	ErrorFormatProblem  = "problem"  // RFC 7807 Problem Details
+)
+
+// sendError sends an error response, as RFC 7807 Problem Details when the
+// server is configured for it or the client asks for it in Accept, and as
+// the usual APIResponse envelope otherwise
+func (s *Server) sendError(w http.ResponseWriter, r *http.Request, code int, message string, data map[string]interface{}) {
+	if s.cfg.ErrorFormat != ErrorFormatProblem && !acceptsProblem(r) {
+		sendJSONResponse(w, false, code, message, data)
+		return
+	}
+
+	// extension members come first so they can't override the standard ones
+	problem := map[string]interface{}{}
+	for key, value := range data {
+		problem[key] = value
+	}
+	problem["type"] = "about:blank"
+	problem["title"] = http.StatusText(code)
+	problem["status"] = code
+	problem["detail"] = message
+	problem["instance"] = r.URL.RequestURI()
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// acceptsProblem reports whether the Accept header lists application/problem+json
+func acceptsProblem(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err == nil && mediaType == problemContentType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Package handler contains the HTTP layer: routing, middleware and the
+// handlers translating requests into service calls.
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+type APIResponse struct {
+	Success bool        `json:"success"`
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data"`
+}
+
+// sendJSONResponse is a helper function to send structured API responses
+func sendJSONResponse(w http.ResponseWriter, success bool, code int, message string, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	response := APIResponse{
+		Success: success,
+		Code:    code,
+		Message: message,
+		Data:    data,
+	}
+
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		// Fallback error response
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(APIResponse{
+			Success: false,
+			Code:    http.StatusInternalServerError,
+			Message: "Failed to encode response",
+			Data:    nil,
+		})
+	}
+}
+
+// decodeJSON decodes the request body into v, sending a 413 when the body is
+// over the size limit and a 400 when it isn't valid JSON. It reports whether
+// decoding succeeded.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.sendError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("Request body must not exceed %d bytes", tooLarge.Limit), nil)
+		return false
+	}
+	s.sendError(w, r, http.StatusBadRequest, "Invalid JSON body", nil)
+	return false
+}
+
+// atoi is a helper function to convert string to int
+func atoi(s string) (int, error) {
+	return strconv.Atoi(s)
+}
@@ -0,0 +1,73 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getRoles handler to list the roles users can be given
+func (s *Server) getRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := s.users.ListRoles(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Roles fetched successfully", roles)
+}
+
+// getRole handler to get a single role by name
+func (s *Server) getRole(w http.ResponseWriter, r *http.Request) {
+	role, err := s.users.GetRole(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Role fetched successfully", role)
+}
+
+// createRole handler to add a role
+func (s *Server) createRole(w http.ResponseWriter, r *http.Request) {
+	var input model.RoleInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	role, err := s.users.CreateRole(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Role created successfully", role)
+}
+
+// updateRole handler to replace the description of a role
+func (s *Server) updateRole(w http.ResponseWriter, r *http.Request) {
+	var input model.RoleInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	role, err := s.users.UpdateRole(r.Context(), mux.Vars(r)["name"], input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Role updated successfully", role)
+}
+
+// deleteRole handler to remove a role no user has
+func (s *Server) deleteRole(w http.ResponseWriter, r *http.Request) {
+	if err := s.users.DeleteRole(r.Context(), mux.Vars(r)["name"]); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Role deleted successfully", nil)
+}
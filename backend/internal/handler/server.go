@@ -0,0 +1,360 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/health"
+	"api/internal/metrics"
+	"api/internal/policy"
+	"api/internal/ratelimit"
+	"api/internal/repository"
+	"api/internal/scheduler"
+	"api/internal/search"
+	"api/internal/service"
+	"api/internal/subsystem"
+)
+
+// Config holds the settings of the HTTP layer
+type Config struct {
+	// APIPrefix is the path every API route is mounted under, followed by
+	// the version, such as /api/go/v1; the prefix alone serves the version
+	// the headers ask for, version 1 by default
+	APIPrefix string
+	// APIPreview serves the versions of the API still changing, see
+	// apiVersions
+	APIPreview bool
+	// ErrorFormat is ErrorFormatEnvelope or ErrorFormatProblem; clients can
+	// always opt into Problem Details with Accept: application/problem+json
+	ErrorFormat string
+	// Users tunes the user business rules
+	Users service.Options
+	// IdempotencyWindow is how long responses to requests with an
+	// Idempotency-Key are replayed; zero disables idempotency keys
+	IdempotencyWindow time.Duration
+	// PolicyDatabase evaluates the permissions stored in the database along
+	// with the other policies; see WatchPermissions
+	PolicyDatabase bool
+	// PasswordResetEmailLimit and PasswordResetIPLimit cap the password
+	// reset requests per email and per client IP within PasswordResetWindow;
+	// zero means no limit
+	PasswordResetEmailLimit int
+	PasswordResetIPLimit    int
+	PasswordResetWindow     time.Duration
+	// LoginAccountLimit and LoginIPLimit are the failed logins per account
+	// and per client IP within LoginWindow after which logging in is
+	// refused until the oldest failure leaves the window; zero means no limit
+	LoginAccountLimit int
+	LoginIPLimit      int
+	LoginWindow       time.Duration
+	// SessionCookie is the name of the cookie identifying sessions, sent
+	// only over HTTPS when SessionCookieSecure is set. CSRFCookie holds the
+	// CSRF token of the session, readable by scripts, see csrfProtected.
+	SessionCookie       string
+	SessionCookieSecure bool
+	CSRFCookie          string
+	// IPRules filter the client IPs of route groups, see IPFilter, and
+	// TrustedProxies are the proxies whose X-Forwarded-For is believed
+	IPRules        map[string]IPRules
+	TrustedProxies []netip.Prefix
+	// MaxInFlight caps the requests each route group serves at once, see
+	// LoadShed, and LoadShedRetryAfter is when those past the cap are told
+	// to retry (default 1s)
+	MaxInFlight        map[string]int
+	LoadShedRetryAfter time.Duration
+	// TeamScope limits the users authenticated callers list, count, suggest,
+	// search and export to themselves and the members of their teams,
+	// unless they have one of the TeamScopeExemptRoles
+	TeamScope            bool
+	TeamScopeExemptRoles []string
+	// FieldRules hide user fields, by their JSON name, from the callers
+	// they don't let see them, see FieldRule
+	FieldRules map[string]FieldRule
+	// Build is the metadata of the binary reported by /version
+	Build BuildInfo
+}
+
+// Deps are the dependencies a Server is built from. Only Repo is required;
+// the others fall back to sensible defaults.
+type Deps struct {
+	Repo       repository.UserRepository
+	Logger     *log.Logger
+	Clock      func() time.Time
+	Config     Config
+	Subsystems *subsystem.Registry
+	// Search backs /users/search; nil disables the endpoint
+	Search *search.Client
+	// Policy authorizes requests, see PolicyMiddleware; nil allows everything
+	// but the /admin routes, which are then not served
+	Policy *policy.Engine
+	// Scheduler runs the recurring tasks listed by /admin/tasks; nil disables the endpoint
+	Scheduler *scheduler.Scheduler
+	// Health checks the dependencies for /health; nil only checks the database
+	Health *health.Registry
+	// Metrics backs /metrics; nil disables the endpoint
+	Metrics *metrics.Registry
+}
+
+// Server holds everything the HTTP handlers need; handlers are its methods
+type Server struct {
+	repo       repository.UserRepository
+	users      *service.UserService
+	logger     *log.Logger
+	clock      func() time.Time
+	cfg        Config
+	subsystems *subsystem.Registry
+	search     *search.Client
+	policy     *policy.Engine
+	scheduler  *scheduler.Scheduler
+	health     *health.Registry
+	metrics    *metrics.Registry
+	// resetsPerEmail and resetsPerIP rate limit forgotPassword
+	resetsPerEmail *ratelimit.Limiter
+	resetsPerIP    *ratelimit.Limiter
+	// failedLoginsPerAccount and failedLoginsPerIP lock out logins
+	failedLoginsPerAccount *ratelimit.Limiter
+	failedLoginsPerIP      *ratelimit.Limiter
+	// deprecatedCalls counts the requests using deprecated endpoints and fields
+	deprecatedCalls *deprecatedCalls
+}
+
+// NewServer creates a Server from its dependencies
+func NewServer(deps Deps) *Server {
+	if deps.Logger == nil {
+		deps.Logger = log.Default()
+	}
+	if deps.Clock == nil {
+		deps.Clock = time.Now
+	}
+	if deps.Config.APIPrefix == "" {
+		deps.Config.APIPrefix = "/api/go"
+	}
+	if deps.Config.SessionCookie == "" {
+		deps.Config.SessionCookie = "session"
+	}
+	if deps.Config.CSRFCookie == "" {
+		deps.Config.CSRFCookie = "csrf_token"
+	}
+	if deps.Config.LoadShedRetryAfter <= 0 {
+		deps.Config.LoadShedRetryAfter = time.Second
+	}
+	if deps.Subsystems == nil {
+		deps.Subsystems = subsystem.NewRegistry()
+	}
+	if deps.Health == nil {
+		deps.Health = health.NewRegistry(0)
+		deps.Health.Register("database", health.CheckFunc(deps.Repo.Ping), true)
+	}
+
+	if deps.Config.Users.AvatarURL == nil {
+		prefix := deps.Config.APIPrefix
+		deps.Config.Users.AvatarURL = func(id, size int) string {
+			if size != 0 {
+				return fmt.Sprintf("%s/users/%d/avatar?size=%d", prefix, id, size)
+			}
+			return fmt.Sprintf("%s/users/%d/avatar", prefix, id)
+		}
+	}
+
+	if deps.Policy != nil && deps.Config.Users.AuthorizeFields == nil {
+		deps.Config.Users.AuthorizeFields = fieldAuthorizer(deps.Policy)
+	}
+
+	deprecated := &deprecatedCalls{}
+	if deps.Metrics != nil {
+		deps.Metrics.Register(deprecated.collect)
+	}
+
+	return &Server{
+		repo:       deps.Repo,
+		users:      service.NewUserService(deps.Repo, deps.Logger, deps.Clock, deps.Config.Users),
+		logger:     deps.Logger,
+		clock:      deps.Clock,
+		cfg:        deps.Config,
+		subsystems: deps.Subsystems,
+		search:     deps.Search,
+		policy:     deps.Policy,
+		scheduler:  deps.Scheduler,
+		health:     deps.Health,
+		metrics:    deps.Metrics,
+
+		resetsPerEmail: ratelimit.New(deps.Config.PasswordResetEmailLimit, deps.Config.PasswordResetWindow, deps.Clock),
+		resetsPerIP:    ratelimit.New(deps.Config.PasswordResetIPLimit, deps.Config.PasswordResetWindow, deps.Clock),
+
+		failedLoginsPerAccount: ratelimit.New(deps.Config.LoginAccountLimit, deps.Config.LoginWindow, deps.Clock),
+		failedLoginsPerIP:      ratelimit.New(deps.Config.LoginIPLimit, deps.Config.LoginWindow, deps.Clock),
+
+		deprecatedCalls: deprecated,
+	}
+}
+
+// SetRateLimits applies the password reset and login limits of cfg, its
+// other settings being left as they are
+func (s *Server) SetRateLimits(cfg Config) {
+	s.resetsPerEmail.SetLimit(cfg.PasswordResetEmailLimit, cfg.PasswordResetWindow)
+	s.resetsPerIP.SetLimit(cfg.PasswordResetIPLimit, cfg.PasswordResetWindow)
+	s.failedLoginsPerAccount.SetLimit(cfg.LoginAccountLimit, cfg.LoginWindow)
+	s.failedLoginsPerIP.SetLimit(cfg.LoginIPLimit, cfg.LoginWindow)
+}
+
+// Users returns the service the handlers call, for the background jobs
+// running its work
+func (s *Server) Users() *service.UserService {
+	return s.users
+}
+
+// Router serves the API routes. The credential exchanges, the routes
+// trading a password for an access token or a session, are matched first on
+// a router of their own, which UseAuthentication leaves out: callers use
+// them without credentials, and a stale session cookie mustn't keep its
+// browser from logging in again.
+type Router struct {
+	*mux.Router
+	exchanges *mux.Router
+	routes    *mux.Router
+}
+
+// Use adds middleware to every route
+func (r *Router) Use(mwf ...mux.MiddlewareFunc) {
+	r.exchanges.Use(mwf...)
+	r.routes.Use(mwf...)
+}
+
+// UseAuthentication adds middleware authenticating the caller, such as
+// AuthMiddleware, to every route but the credential exchanges
+func (r *Router) UseAuthentication(mwf ...mux.MiddlewareFunc) {
+	r.routes.Use(mwf...)
+}
+
+// Routes registers every API route on a new router
+func (s *Server) Routes() *Router {
+	// create a new router
+	router := &Router{Router: mux.NewRouter()}
+	router.exchanges = router.NewRoute().Subrouter()
+	router.routes = router.NewRoute().Subrouter()
+	s.versionRoutes(router.routes.PathPrefix(s.cfg.APIPrefix).Subrouter(), router.exchanges.PathPrefix(s.cfg.APIPrefix).Subrouter())
+	router.routes.HandleFunc("/livez", s.livez).Methods("GET").Name("health:live")
+	router.routes.HandleFunc("/readyz", s.readyz).Methods("GET").Name("health:ready")
+	router.routes.HandleFunc("/metrics", s.getMetrics).Methods("GET").Name("metrics:read")
+
+	return router
+}
+
+// credentialExchangesV1 registers the credential exchanges of version 1 of
+// the API, see Router
+func (s *Server) credentialExchangesV1(api *mux.Router) {
+	api.HandleFunc("/auth/login", s.login).Methods("POST").Name("auth:login")
+	api.HandleFunc("/auth/session", s.createSession).Methods("POST").Name("auth:session-login")
+}
+
+// routesV1 registers the routes of version 1 of the API, which is frozen:
+// breaking changes go to a later version, see apiVersions
+func (s *Server) routesV1(api *mux.Router) {
+	// route names double as the action evaluated by the policy engine
+	api.HandleFunc("/users", s.getUsers).Methods("GET").Name("users:list")
+	api.HandleFunc("/users", s.idempotent(s.createUser)).Methods("POST").Name("users:create")
+	api.HandleFunc("/users/count", s.countUsers).Methods("GET").Name("users:count")
+	api.HandleFunc("/users/search", s.searchUsers).Methods("GET").Name("users:search")
+	api.HandleFunc("/users/suggest", s.suggestUsers).Methods("GET").Name("users:suggest")
+	api.HandleFunc("/users/{id}", s.getUser).Methods("GET").Name("users:read")
+	api.HandleFunc("/users/{id}", s.updateUser).Methods("PUT").Name("users:update")
+	api.HandleFunc("/users/{id}", s.patchUser).Methods("PATCH").Name("users:update")
+	api.HandleFunc("/users/{id}", s.deleteUser).Methods("DELETE").Name("users:delete")
+	api.HandleFunc("/users/{id}/history", s.getUserHistory).Methods("GET").Name("users:history")
+	api.HandleFunc("/users/{id}/revert", s.revertUser).Methods("POST").Name("users:revert")
+	api.HandleFunc("/users/{id}/anonymize", s.anonymizeUser).Methods("POST").Name("users:anonymize")
+	api.HandleFunc("/users/{id}/revoke-tokens", s.revokeTokens).Methods("POST").Name("users:revoke-tokens")
+	api.HandleFunc("/users/{id}/unlock", s.unlockUser).Methods("POST").Name("users:unlock")
+	api.HandleFunc("/users/{id}/avatar", s.getAvatar).Methods("GET").Name("avatars:read")
+	api.HandleFunc("/users/{id}/avatar", s.uploadAvatar).Methods("POST").Name("avatars:update")
+	api.HandleFunc("/users/{id}/avatar", s.deleteAvatar).Methods("DELETE").Name("avatars:delete")
+	api.HandleFunc("/users/{id}/addresses", s.getAddresses).Methods("GET").Name("addresses:list")
+	api.HandleFunc("/users/{id}/addresses", s.createAddress).Methods("POST").Name("addresses:create")
+	api.HandleFunc("/users/{id}/addresses/{addressId}", s.updateAddress).Methods("PUT").Name("addresses:update")
+	api.HandleFunc("/users/{id}/addresses/{addressId}", s.deleteAddress).Methods("DELETE").Name("addresses:delete")
+	api.HandleFunc("/users/{id}/phones", s.getPhones).Methods("GET").Name("phones:list")
+	api.HandleFunc("/users/{id}/phones", s.createPhone).Methods("POST").Name("phones:create")
+	api.HandleFunc("/users/{id}/phones/{phoneId}", s.updatePhone).Methods("PUT").Name("phones:update")
+	api.HandleFunc("/users/{id}/phones/{phoneId}", s.deletePhone).Methods("DELETE").Name("phones:delete")
+	api.HandleFunc("/me", s.getMe).Methods("GET").Name("me:read")
+	api.HandleFunc("/me", s.patchMe).Methods("PATCH").Name("me:update")
+	api.HandleFunc("/me/notifications", s.getNotifications).Methods("GET").Name("me:notifications")
+	api.HandleFunc("/me/notifications/unread-count", s.getUnreadNotifications).Methods("GET").Name("me:notifications")
+	api.HandleFunc("/me/notifications/read-all", s.readAllNotifications).Methods("POST").Name("me:notifications-read")
+	api.HandleFunc("/me/notifications/{notificationId}/read", s.readNotification).Methods("POST").Name("me:notifications-read")
+	api.HandleFunc("/me/notification-preferences", s.getNotificationPreferences).Methods("GET").Name("me:read")
+	api.HandleFunc("/me/notification-preferences", s.putNotificationPreferences).Methods("PUT").Name("me:update")
+	api.HandleFunc("/roles", s.getRoles).Methods("GET").Name("roles:list")
+	api.HandleFunc("/roles", s.createRole).Methods("POST").Name("roles:create")
+	api.HandleFunc("/roles/{name}", s.getRole).Methods("GET").Name("roles:read")
+	api.HandleFunc("/roles/{name}", s.updateRole).Methods("PUT").Name("roles:update")
+	api.HandleFunc("/roles/{name}", s.deleteRole).Methods("DELETE").Name("roles:delete")
+	api.HandleFunc("/teams", s.getTeams).Methods("GET").Name("teams:list")
+	api.HandleFunc("/teams", s.createTeam).Methods("POST").Name("teams:create")
+	api.HandleFunc("/teams/{id}", s.getTeam).Methods("GET").Name("teams:read")
+	api.HandleFunc("/teams/{id}", s.updateTeam).Methods("PUT").Name("teams:update")
+	api.HandleFunc("/teams/{id}", s.deleteTeam).Methods("DELETE").Name("teams:delete")
+	api.HandleFunc("/teams/{id}/members", s.getTeamMembers).Methods("GET").Name("teams:read")
+	api.HandleFunc("/teams/{id}/members/{userID}", s.addTeamMember).Methods("POST").Name("teams:update")
+	api.HandleFunc("/teams/{id}/members/{userID}", s.removeTeamMember).Methods("DELETE").Name("teams:update")
+	api.HandleFunc("/permissions", s.getPermissions).Methods("GET").Name("permissions:list")
+	api.HandleFunc("/permissions", s.createPermission).Methods("POST").Name("permissions:create")
+	api.HandleFunc("/permissions/{id}", s.getPermission).Methods("GET").Name("permissions:read")
+	api.HandleFunc("/permissions/{id}", s.updatePermission).Methods("PUT").Name("permissions:update")
+	api.HandleFunc("/permissions/{id}", s.deletePermission).Methods("DELETE").Name("permissions:delete")
+	api.HandleFunc("/organizations", s.getOrganizations).Methods("GET").Name("organizations:list")
+	api.HandleFunc("/organizations", s.createOrganization).Methods("POST").Name("organizations:create")
+	api.HandleFunc("/organizations/{id}", s.getOrganization).Methods("GET").Name("organizations:read")
+	api.HandleFunc("/organizations/{id}", s.updateOrganization).Methods("PUT").Name("organizations:update")
+	api.HandleFunc("/organizations/{id}", s.deleteOrganization).Methods("DELETE").Name("organizations:delete")
+	api.HandleFunc("/invitations", s.getInvitations).Methods("GET").Name("invitations:list")
+	api.HandleFunc("/invitations", s.idempotent(s.createInvitation)).Methods("POST").Name("invitations:create")
+	api.HandleFunc("/invitations/{token}/accept", s.acceptInvitation).Methods("POST").Name("invitations:accept")
+	api.HandleFunc("/auth/register", s.register).Methods("POST").Name("auth:register")
+	// without policies every caller would be allowed, so the admin routes
+	// are only served along with them
+	if s.policy != nil {
+		api.HandleFunc("/admin/impersonate/{id}", s.impersonate).Methods("POST").Name("admin:impersonate")
+		api.HandleFunc("/admin/tasks", s.getTasks).Methods("GET").Name("admin:tasks")
+		api.HandleFunc("/admin/flags", s.getFeatureFlags).Methods("GET").Name("admin:flags")
+		api.HandleFunc("/admin/flags/{name}", s.setFeatureFlag).Methods("PUT").Name("admin:flags-update")
+		api.HandleFunc("/admin/flags/{name}", s.deleteFeatureFlag).Methods("DELETE").Name("admin:flags-update")
+	}
+	api.HandleFunc("/audit-log", s.getAuditLog).Methods("GET").Name("audit-log:list")
+	api.HandleFunc("/jobs", s.getJobs).Methods("GET").Name("jobs:list")
+	api.HandleFunc("/jobs/{id}/retry", s.retryJob).Methods("POST").Name("jobs:retry")
+	api.HandleFunc("/events", s.getEvents).Methods("GET").Name("events:list")
+	api.HandleFunc("/events/replay", s.replayEvents).Methods("POST").Name("events:replay")
+	api.HandleFunc("/imports", s.createImport).Methods("POST").Name("imports:create")
+	api.HandleFunc("/imports/{id}", s.getImport).Methods("GET").Name("imports:read")
+	api.HandleFunc("/auth/logout", s.logout).Methods("POST").Name("auth:logout")
+	api.HandleFunc("/auth/session", s.deleteSession).Methods("DELETE").Name("auth:session-logout")
+	api.HandleFunc("/auth/forgot-password", s.forgotPassword).Methods("POST").Name("auth:forgot-password")
+	api.HandleFunc("/auth/reset-password", s.resetPassword).Methods("POST").Name("auth:reset-password")
+	api.HandleFunc("/verify", s.verifyEmail).Methods("GET").Name("auth:verify")
+	api.HandleFunc("/version", s.version).Methods("GET").Name("version:read")
+	api.HandleFunc("/health", s.healthCheck).Methods("GET").Name("health:read")
+	api.HandleFunc("/healthdb", s.deprecated(Deprecation{
+		Since: time.Date(2026, 10, 16, 0, 0, 0, 0, time.UTC),
+		Link:  "https://github.com/nandaiqbalh/simple-crud#health-checks",
+	}, s.healthDB)).Methods("GET").Name("health:read")
+}
+
+// ServeFrontend serves app, the web app, on the paths no route of router
+// matches; those under the API prefix stay not found. The middleware of
+// the routes, such as authentication, doesn't apply to it.
+func (s *Server) ServeFrontend(router *Router, app http.Handler) {
+	router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == s.cfg.APIPrefix || strings.HasPrefix(r.URL.Path, s.cfg.APIPrefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		app.ServeHTTP(w, r)
+	})
+}
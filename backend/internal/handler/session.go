@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"api/internal/model"
+)
+
+// createSession handler to log in with an email and password, answering
+// with the user and a session cookie instead of an access token
+func (s *Server) createSession(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	var input model.LoginInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+	if s.loginLocked(w, r, input.Email) {
+		return
+	}
+
+	session, user, err := s.users.CreateSession(r.Context(), input)
+	s.recordLogin(r, input.Email, err)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	maxAge := int(session.ExpiresAt.Sub(s.clock()).Seconds())
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.SessionCookie,
+		Value:    session.Token,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.SessionCookieSecure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	// scripts of the app read the token from the cookie, or the header, to
+	// send it back; those of other sites can read neither
+	csrf := s.users.CSRFToken(session.Token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.CSRFCookie,
+		Value:    csrf,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		MaxAge:   maxAge,
+		Secure:   s.cfg.SessionCookieSecure,
+		SameSite: http.SameSiteLaxMode,
+	})
+	w.Header().Set(csrfHeader, csrf)
+	sendJSONResponse(w, true, http.StatusOK, "Logged in successfully", user)
+}
+
+// deleteSession handler to log out of the session of the cookie and clear it
+func (s *Server) deleteSession(w http.ResponseWriter, r *http.Request) {
+	if !s.authEnabled(w, r) {
+		return
+	}
+	if cookie, err := r.Cookie(s.cfg.SessionCookie); err == nil && cookie.Value != "" {
+		if err := s.users.EndSession(r.Context(), cookie.Value); err != nil {
+			s.sendDomainError(w, r, err)
+			return
+		}
+	}
+
+	s.clearSessionCookie(w)
+	sendJSONResponse(w, true, http.StatusOK, "Logged out successfully", nil)
+}
+
+// clearSessionCookie tells the browser to forget the session cookie, and
+// the CSRF token along with it
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	for _, name := range []string{s.cfg.SessionCookie, s.cfg.CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			Expires:  time.Unix(0, 0),
+			MaxAge:   -1,
+			Secure:   s.cfg.SessionCookieSecure,
+			HttpOnly: name == s.cfg.SessionCookie,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+}
+
+// csrfHeader carries the CSRF token of the session cookie, see csrfProtected
+const csrfHeader = "X-CSRF-Token"
+
+// csrfProtected reports whether a request made with the session cookie is
+// safe from cross-site request forgery: it only reads, or it carries the
+// session's CSRF token in the X-CSRF-Token header. Other sites can make
+// browsers send the cookie, but can't read the token to send it back.
+func (s *Server) csrfProtected(r *http.Request, session string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	token := r.Header.Get(csrfHeader)
+	return token != "" && s.users.ValidCSRFToken(session, token)
+}
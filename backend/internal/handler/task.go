@@ -0,0 +1,20 @@
+package handler
+
+import "net/http"
+
+// getTasks handler to list the recurring tasks with their next run on this
+// instance and their latest run on any instance
+func (s *Server) getTasks(w http.ResponseWriter, r *http.Request) {
+	if s.scheduler == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "The task scheduler is not enabled", nil)
+		return
+	}
+
+	tasks, err := s.scheduler.Status(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Tasks fetched successfully", tasks)
+}
@@ -0,0 +1,161 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+)
+
+// getTeams handler to list every team
+func (s *Server) getTeams(w http.ResponseWriter, r *http.Request) {
+	teams, err := s.users.ListTeams(r.Context())
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Teams fetched successfully", teams)
+}
+
+// getTeam handler to get a single team by ID
+func (s *Server) getTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid team ID", nil)
+		return
+	}
+
+	team, err := s.users.GetTeam(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Team fetched successfully", team)
+}
+
+// createTeam handler to add a team
+func (s *Server) createTeam(w http.ResponseWriter, r *http.Request) {
+	var input model.TeamInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	team, err := s.users.CreateTeam(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "Team created successfully", team)
+}
+
+// updateTeam handler to replace a team
+func (s *Server) updateTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid team ID", nil)
+		return
+	}
+
+	var input model.TeamInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	team, err := s.users.UpdateTeam(r.Context(), id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Team updated successfully", team)
+}
+
+// deleteTeam handler to remove a team, keeping its members
+func (s *Server) deleteTeam(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid team ID", nil)
+		return
+	}
+
+	if err := s.users.DeleteTeam(r.Context(), id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Team deleted successfully", nil)
+}
+
+// getTeamMembers handler to list the members of a team, taking the same
+// search, filter and sort parameters as getUsers
+func (s *Server) getTeamMembers(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid team ID", nil)
+		return
+	}
+	params, ok := s.listParams(w, r)
+	if !ok {
+		return
+	}
+
+	users, err := s.users.ListTeamMembers(r.Context(), id, params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(users)))
+	s.sendUsers(w, r, http.StatusOK, "Team members fetched successfully", users, params.Fields)
+}
+
+// addTeamMember handler to make a user a member of a team
+func (s *Server) addTeamMember(w http.ResponseWriter, r *http.Request) {
+	teamID, userID, ok := s.memberIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.users.AddTeamMember(r.Context(), teamID, userID); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Team member added successfully", nil)
+}
+
+// removeTeamMember handler to remove a user from a team
+func (s *Server) removeTeamMember(w http.ResponseWriter, r *http.Request) {
+	teamID, userID, ok := s.memberIDs(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.users.RemoveTeamMember(r.Context(), teamID, userID); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "Team member removed successfully", nil)
+}
+
+// memberIDs reads the team and user IDs of a membership route, sending a
+// 400 and returning false when either is malformed
+func (s *Server) memberIDs(w http.ResponseWriter, r *http.Request) (teamID, userID int, ok bool) {
+	teamID, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid team ID", nil)
+		return 0, 0, false
+	}
+	userID, err = atoi(mux.Vars(r)["userID"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return 0, 0, false
+	}
+	return teamID, userID, true
+}
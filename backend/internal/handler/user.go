@@ -0,0 +1,382 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// getUsers handler to fetch all users with search, filters and sorting
+func (s *Server) getUsers(w http.ResponseWriter, r *http.Request) {
+	// Get query parameters
+	params, ok := s.listParams(w, r)
+	if !ok {
+		return
+	}
+
+	// a CSV listing is an export, whose queries get the export timeout
+	ctx := r.Context()
+	if negotiate(r.Header.Get("Accept"), mediaJSON, mediaXML, mediaCSV) == mediaCSV {
+		ctx = repository.WithExport(ctx)
+	}
+
+	users, err := s.users.List(ctx, params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(users)))
+	s.sendUsers(w, r, http.StatusOK, "Users fetched successfully", users, params.Fields)
+}
+
+// getUsersPage handler returns a page of the users getUsers would return,
+// ?limit= of them after skipping ?offset=, with the total matching. It lists
+// the users of version 2 of the API.
+func (s *Server) getUsersPage(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.listParams(w, r)
+	if !ok {
+		return
+	}
+	var err error
+	if params.Limit, err = parseLimit(r, 20, 100); err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if params.Offset, err = parseOffset(r); err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	total, err := s.users.Count(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	users, err := s.users.List(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	s.sendUserPage(w, r, http.StatusOK, "Users fetched successfully", users, params, total)
+}
+
+// countUsers reports how many users getUsers would return for the same query
+func (s *Server) countUsers(w http.ResponseWriter, r *http.Request) {
+	params, ok := s.listParams(w, r)
+	if !ok {
+		return
+	}
+
+	count, err := s.users.Count(r.Context(), params)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(count))
+	sendJSONResponse(w, true, http.StatusOK, "Users counted successfully", map[string]int{"count": count})
+}
+
+// listParams reads the search, filter, sort and field parameters of a user
+// listing, sending a 400 and returning false when any of them is malformed
+func (s *Server) listParams(w http.ResponseWriter, r *http.Request) (model.ListParams, bool) {
+	fields, err := parseFields(r)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return model.ListParams{}, false
+	}
+
+	filter, invalid := parseFilter(r.URL.Query())
+	if invalid != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid filter", map[string]interface{}{"errors": invalid})
+		return model.ListParams{}, false
+	}
+
+	params := model.ListParams{
+		Search: r.URL.Query().Get("search"),
+		Query:  r.URL.Query().Get("q"),
+		Filter: filter,
+		Sort:   r.URL.Query().Get("sort"),
+		Order:  r.URL.Query().Get("order"),
+		Fields: fields,
+	}
+	if param, field := s.hiddenParam(r, params); param != "" {
+		s.sendHiddenParam(w, r, param, field)
+		return model.ListParams{}, false
+	}
+	return params, true
+}
+
+// searchUsers handler to query the search index
+func (s *Server) searchUsers(w http.ResponseWriter, r *http.Request) {
+	if s.search == nil {
+		s.sendError(w, r, http.StatusServiceUnavailable, "Search is not enabled", nil)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		s.sendError(w, r, http.StatusBadRequest, "Query parameter q is required", nil)
+		return
+	}
+	if field := s.hiddenField(r, searchedFields...); field != "" {
+		s.sendHiddenParam(w, r, "q", field)
+		return
+	}
+	limit, err := parseLimit(r, 20, 100)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	users, err := s.search.Search(r.Context(), query, limit)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+	if users, err = s.teamHits(r, users); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUsers(w, r, http.StatusOK, "Users fetched successfully", users, nil)
+}
+
+// teamHits drops the search hits the caller may not list when it is team
+// scoped, as the search index doesn't know the members of teams
+func (s *Server) teamHits(r *http.Request, users []model.User) ([]model.User, error) {
+	if _, ok := model.TeamScopeFrom(r.Context()); !ok || len(users) == 0 {
+		return users, nil
+	}
+	visible, err := s.users.List(r.Context(), model.ListParams{Fields: []string{"id"}})
+	if err != nil {
+		return nil, err
+	}
+	ids := make(map[int]bool, len(visible))
+	for _, user := range visible {
+		ids[user.ID] = true
+	}
+	hits := users[:0]
+	for _, user := range users {
+		if ids[user.ID] {
+			hits = append(hits, user)
+		}
+	}
+	return hits, nil
+}
+
+// suggestUsers handler returns the id, name and email of users matching a
+// typed prefix, for autocomplete
+func (s *Server) suggestUsers(w http.ResponseWriter, r *http.Request) {
+	limit, err := parseLimit(r, 10, 50)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if field := s.hiddenField(r, "name", "email"); field != "" {
+		s.sendHiddenParam(w, r, "q", field)
+		return
+	}
+
+	users, err := s.users.Suggest(r.Context(), r.URL.Query().Get("q"), limit)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUsers(w, r, http.StatusOK, "Suggestions fetched successfully", users, []string{"id", "name", "email"})
+}
+
+// getUser handler to get user by id
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+	fields, err := parseFields(r)
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	user, err := s.users.Get(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUser(w, r, http.StatusOK, "User fetched successfully", user, fields)
+}
+
+// createUser handler to create a new user
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var input model.UserInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	user, err := s.users.Create(r.Context(), input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusCreated, "User created successfully", user)
+}
+
+// updateUser handler to update an existing user
+func (s *Server) updateUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var input model.UserInput
+	if !s.decodeJSON(w, r, &input) {
+		return
+	}
+
+	user, err := s.users.Update(r.Context(), id, input)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "User updated successfully", user)
+}
+
+// patchUser handler to apply a JSON merge patch to a user, merging its metadata
+func (s *Server) patchUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	var patch model.UserPatch
+	if !s.decodeJSON(w, r, &patch) {
+		return
+	}
+
+	user, err := s.users.Patch(r.Context(), id, patch)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	// the patch may leave out fields the caller doesn't see
+	s.sendUser(w, r, http.StatusOK, "User updated successfully", user, nil)
+}
+
+// deleteUser handler to delete a user
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	if err := s.users.Delete(r.Context(), id); err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "User deleted successfully", nil)
+}
+
+// getUserHistory handler to list the edits of a user, oldest first
+func (s *Server) getUserHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	revisions, err := s.users.History(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	for i := range revisions {
+		revisions[i].Changes = s.shapeChanges(r, id, revisions[i].Changes)
+	}
+	sendJSONResponse(w, true, http.StatusOK, "History fetched successfully", revisions)
+}
+
+// revertUser handler to restore a user to one of its revisions, given by ?revision=
+func (s *Server) revertUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+	revision, err := atoi(r.URL.Query().Get("revision"))
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Query parameter revision must be the ID of a revision", nil)
+		return
+	}
+
+	user, err := s.users.Revert(r.Context(), id, revision)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	s.sendUser(w, r, http.StatusOK, "User reverted successfully", user, nil)
+}
+
+// anonymizeUser handler to scrub the personal data of a user for good,
+// keeping the user itself for statistics and the audit log
+func (s *Server) anonymizeUser(w http.ResponseWriter, r *http.Request) {
+	id, err := atoi(mux.Vars(r)["id"])
+	if err != nil {
+		s.sendError(w, r, http.StatusBadRequest, "Invalid user ID", nil)
+		return
+	}
+
+	user, err := s.users.Anonymize(r.Context(), id)
+	if err != nil {
+		s.sendDomainError(w, r, err)
+		return
+	}
+
+	sendJSONResponse(w, true, http.StatusOK, "User anonymized successfully", user)
+}
+
+// parseLimit reads the ?limit= parameter, between 1 and max, defaulting to fallback
+func parseLimit(r *http.Request, fallback, max int) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return fallback, nil
+	}
+	limit, err := atoi(value)
+	if err != nil || limit < 1 || limit > max {
+		return 0, fmt.Errorf("Query parameter limit must be between 1 and %d", max)
+	}
+	return limit, nil
+}
+
+// parseOffset reads the ?offset= parameter, 0 or more, defaulting to 0
+func parseOffset(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("offset")
+	if value == "" {
+		return 0, nil
+	}
+	offset, err := atoi(value)
+	if err != nil || offset < 0 {
+		return 0, fmt.Errorf("Query parameter offset must be 0 or more")
+	}
+	return offset, nil
+}
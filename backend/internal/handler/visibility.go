@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"api/internal/logmask"
+	"api/internal/model"
+)
+
+// Field visibility modes: hidden fields are left out of responses, or
+// masked, which only text fields can be
+const (
+	FieldOmit = "omit"
+	FieldMask = "mask"
+)
+
+// MaskableFields are the user fields FieldMask applies to
+var MaskableFields = []string{"name", "email", "role"}
+
+// FieldRule hides a user field from callers without one of its Roles,
+// except in responses about themselves
+type FieldRule struct {
+	Mode  string
+	Roles []string
+}
+
+// searchedFields are the fields the search and q parameters of listings
+// match, as do /users/search and /users/suggest
+var searchedFields = []string{"name", "email", "role"}
+
+// callerHiddenFields returns the fields of other users hidden from the
+// caller with their mode, and the ID of the caller. Anonymous requests,
+// allowed when authentication is off or by the policies, have ID 0 and
+// are subject to every rule, as if they had no role.
+func (s *Server) callerHiddenFields(r *http.Request) (map[string]string, int) {
+	identity, ok := r.Context().Value(identityKey{}).(model.Identity)
+	var hidden map[string]string
+	for field, rule := range s.cfg.FieldRules {
+		if ok && slices.Contains(rule.Roles, identity.User.Role) {
+			continue
+		}
+		if hidden == nil {
+			hidden = map[string]string{}
+		}
+		hidden[field] = rule.Mode
+	}
+	return hidden, identity.User.ID
+}
+
+// hiddenFields returns the fields of the user with the ID hidden from the
+// caller with their mode, or nil when it may see all of them
+func (s *Server) hiddenFields(r *http.Request, userID int) map[string]string {
+	hidden, caller := s.callerHiddenFields(r)
+	if caller != 0 && caller == userID {
+		return nil
+	}
+	return hidden
+}
+
+// hiddenField returns the first of the fields hidden from the caller in
+// the users of others, or ""
+func (s *Server) hiddenField(r *http.Request, fields ...string) string {
+	hidden, _ := s.callerHiddenFields(r)
+	for _, field := range fields {
+		if _, ok := hidden[field]; ok {
+			return field
+		}
+	}
+	return ""
+}
+
+// hiddenParam returns a query parameter of the listing that reads a field
+// hidden from the caller, along with the field, or "" when none does:
+// filtering, sorting or searching by a field tells its values as surely as
+// showing them
+func (s *Server) hiddenParam(r *http.Request, params model.ListParams) (string, string) {
+	type read struct{ param, field string }
+	var reads []read
+	f := params.Filter
+	if params.Sort != "" {
+		reads = append(reads, read{"sort", params.Sort})
+	}
+	if len(f.Roles) > 0 {
+		reads = append(reads, read{"role", "role"})
+	}
+	if f.AgeMin != nil || f.AgeMax != nil {
+		reads = append(reads, read{"age_min/age_max", "age"})
+	}
+	if f.BirthAfter != nil || f.BirthBefore != nil {
+		reads = append(reads, read{"birth_after/birth_before", "birth"})
+	}
+	if f.CreatedAfter != nil || f.CreatedBefore != nil {
+		reads = append(reads, read{"created_after/created_before", "timestamp"})
+	}
+	if len(f.Metadata) > 0 {
+		reads = append(reads, read{"metadata.*", "metadata"})
+	}
+	for _, field := range searchedFields {
+		if params.Search != "" {
+			reads = append(reads, read{"search", field})
+		}
+		if params.Query != "" {
+			reads = append(reads, read{"q", field})
+		}
+	}
+
+	for _, read := range reads {
+		if s.hiddenField(r, read.field) != "" {
+			return read.param, read.field
+		}
+	}
+	return "", ""
+}
+
+// sendHiddenParam answers a request whose query parameter reads a field
+// hidden from the caller
+func (s *Server) sendHiddenParam(w http.ResponseWriter, r *http.Request, param, field string) {
+	s.sendError(w, r, http.StatusForbidden, fmt.Sprintf("Query parameter %s reads the %s field, which is hidden from you", param, field), nil)
+}
+
+// shapedUser is a user with the fields hidden from the caller masked, and
+// those left out listed in omit
+type shapedUser struct {
+	user model.User
+	omit map[string]bool
+}
+
+// shapeUser applies the field rules the caller is subject to to user
+func (s *Server) shapeUser(r *http.Request, user model.User) shapedUser {
+	shaped := shapedUser{user: user}
+	for field, mode := range s.hiddenFields(r, user.ID) {
+		if mode == FieldMask {
+			maskField(&shaped.user, field)
+			continue
+		}
+		if shaped.omit == nil {
+			shaped.omit = map[string]bool{}
+		}
+		shaped.omit[field] = true
+	}
+	return shaped
+}
+
+// maskField masks the value of one of the MaskableFields of user
+func maskField(user *model.User, field string) {
+	switch field {
+	case "name":
+		user.Name = logmask.MaskWord(user.Name)
+	case "email":
+		user.Email = logmask.MaskEmail(user.Email)
+	case "role":
+		user.Role = logmask.MaskWord(user.Role)
+	}
+}
+
+// shapeChanges applies the field rules the caller is subject to to the
+// changes of the fields of the user with the ID, leaving out the changes of
+// the fields omitted and masking the values of those masked
+func (s *Server) shapeChanges(r *http.Request, userID int, changes []model.FieldChange) []model.FieldChange {
+	hidden := s.hiddenFields(r, userID)
+	if len(hidden) == 0 {
+		return changes
+	}
+	shaped := make([]model.FieldChange, 0, len(changes))
+	for _, change := range changes {
+		switch hidden[change.Field] {
+		case FieldOmit:
+			continue
+		case FieldMask:
+			change.Old, change.New = maskValue(change.Field, change.Old), maskValue(change.Field, change.New)
+		}
+		shaped = append(shaped, change)
+	}
+	return shaped
+}
+
+// maskValue masks the value of one of the MaskableFields
+func maskValue(field string, value interface{}) interface{} {
+	text, ok := value.(string)
+	switch {
+	case !ok:
+		return value
+	case field == "email":
+		return logmask.MaskEmail(text)
+	}
+	return logmask.MaskWord(text)
+}
+
+// shapeEvent applies the field rules the caller is subject to to the user
+// and changes in the payload of an event
+func (s *Server) shapeEvent(r *http.Request, event model.Event) (model.Event, error) {
+	if len(event.Payload) == 0 || len(s.hiddenFields(r, event.UserID)) == 0 {
+		return event, nil
+	}
+	var payload model.EventPayload
+	if err := json.Unmarshal(event.Payload, &payload); err != nil {
+		return event, err
+	}
+	shaped := struct {
+		User    interface{}         `json:"user,omitempty"`
+		Actor   string              `json:"actor,omitempty"`
+		Changes []model.FieldChange `json:"changes,omitempty"`
+	}{Actor: payload.Actor, Changes: s.shapeChanges(r, event.UserID, payload.Changes)}
+	if payload.User != nil {
+		shaped.User = s.shapeUser(r, *payload.User).data(nil)
+	}
+	var err error
+	event.Payload, err = json.Marshal(shaped)
+	return event, err
+}
+
+// data returns what the JSON response holds for the user: the user itself,
+// the given fields of it, or its fields but those left out
+func (u shapedUser) data(fields []string) interface{} {
+	if len(fields) > 0 {
+		projected := project(u.user, fields)
+		for field := range u.omit {
+			delete(projected, field)
+		}
+		return projected
+	}
+	if len(u.omit) == 0 {
+		return u.user
+	}
+
+	var all map[string]interface{}
+	data, _ := json.Marshal(u.user)
+	json.Unmarshal(data, &all)
+	for field := range u.omit {
+		delete(all, field)
+	}
+	return all
+}
+
+// omitXML copies the XML element of a user from src to enc, leaving out
+// its child elements named in omit
+func omitXML(enc *xml.Encoder, src []byte, omit map[string]bool) error {
+	dec := xml.NewDecoder(bytes.NewReader(src))
+	depth, skip := 0, 0
+	for {
+		token, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if skip == 0 && depth == 2 && omit[t.Name.Local] {
+				skip = depth
+			}
+		case xml.EndElement:
+			depth--
+			if skip > depth {
+				skip = 0
+				continue
+			}
+		}
+		if skip == 0 {
+			if err := enc.EncodeToken(xml.CopyToken(token)); err != nil {
+				return err
+			}
+		}
+	}
+}
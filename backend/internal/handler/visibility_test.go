@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"api/internal/model"
+)
+
+func TestFieldVisibility(t *testing.T) {
+	s, repo := newTestServer(t, false)
+	s.cfg.FieldRules = map[string]FieldRule{
+		"email": {Mode: FieldMask, Roles: []string{"admin"}},
+		"birth": {Mode: FieldOmit, Roles: []string{"admin"}},
+	}
+	ctx := context.Background()
+	ann, err := repo.Create(ctx, model.User{Name: "Ann", Email: "ann@example.com", Role: "user", Birth: model.NewDate(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := ann
+	changed.Email = "ann@example.org"
+	if _, err := repo.Update(ctx, ann.ID, changed, model.Revision{Changes: ann.Changes(changed)}); err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := (*model.Identity)(nil)
+	user := &model.Identity{User: model.User{ID: ann.ID + 1, Role: "user"}}
+	admin := &model.Identity{User: model.User{ID: ann.ID + 2, Role: "admin"}}
+	self := &model.Identity{User: ann}
+	tests := []struct {
+		name     string
+		identity *model.Identity
+		path     string
+		code     int
+		// email is the email shown of Ann, and birth whether her birth is
+		email string
+		birth bool
+	}{
+		{"anonymous", anonymous, "/api/go/users/" + strconv.Itoa(ann.ID), http.StatusOK, "a***@e***.org", false},
+		{"user", user, "/api/go/users/" + strconv.Itoa(ann.ID), http.StatusOK, "a***@e***.org", false},
+		{"admin", admin, "/api/go/users/" + strconv.Itoa(ann.ID), http.StatusOK, "ann@example.org", true},
+		{"self", self, "/api/go/users/" + strconv.Itoa(ann.ID), http.StatusOK, "ann@example.org", true},
+		{"anonymous listing", anonymous, "/api/go/users", http.StatusOK, "a***@e***.org", false},
+		{"anonymous sort", anonymous, "/api/go/users?sort=email", http.StatusForbidden, "", false},
+		{"anonymous filter", anonymous, "/api/go/users?birth_after=1989-01-01", http.StatusForbidden, "", false},
+		{"anonymous search", anonymous, "/api/go/users?search=ann@", http.StatusForbidden, "", false},
+		{"anonymous full-text search", anonymous, "/api/go/users?q=example", http.StatusForbidden, "", false},
+		{"anonymous count", anonymous, "/api/go/users/count?sort=email", http.StatusForbidden, "", false},
+		{"anonymous suggestion", anonymous, "/api/go/users/suggest?q=ann", http.StatusForbidden, "", false},
+		{"user filter", user, "/api/go/users?birth_before=1991-01-01", http.StatusForbidden, "", false},
+		{"user visible filter", user, "/api/go/users?role=user&sort=name", http.StatusOK, "a***@e***.org", false},
+		{"admin sort", admin, "/api/go/users?sort=email&birth_after=1989-01-01", http.StatusOK, "ann@example.org", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveAs(s, tt.identity, tt.path)
+			if w.Code != tt.code {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.code, w.Body)
+			}
+			if tt.code != http.StatusOK {
+				return
+			}
+			var got map[string]interface{}
+			var body struct {
+				Data interface{} `json:"data"`
+			}
+			decode(t, w, &body)
+			switch data := body.Data.(type) {
+			case []interface{}:
+				got = data[0].(map[string]interface{})
+			case map[string]interface{}:
+				got = data
+			}
+			if got["email"] != tt.email {
+				t.Errorf("email = %v, want %q", got["email"], tt.email)
+			}
+			if _, birth := got["birth"]; birth != tt.birth {
+				t.Errorf("birth shown = %v, want %v", birth, tt.birth)
+			}
+		})
+	}
+
+	t.Run("history", func(t *testing.T) {
+		var body struct {
+			Data []model.Revision `json:"data"`
+		}
+		decode(t, serveAs(s, anonymous, "/api/go/users/"+strconv.Itoa(ann.ID)+"/history"), &body)
+		for _, rev := range body.Data {
+			for _, change := range rev.Changes {
+				if change.Field == "email" && (change.Old != "a***@e***.com" || change.New != "a***@e***.org") {
+					t.Errorf("email change = %v to %v, want them masked", change.Old, change.New)
+				}
+			}
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		var body struct {
+			Data []model.Event `json:"data"`
+		}
+		decode(t, serveAs(s, anonymous, "/api/go/events"), &body)
+		if len(body.Data) == 0 {
+			t.Fatal("no events listed")
+		}
+		for _, event := range body.Data {
+			payload := string(event.Payload)
+			for _, hidden := range []string{"ann@example.com", "ann@example.org", "1990-01-01"} {
+				if strings.Contains(payload, hidden) {
+					t.Errorf("event %d payload %s shows %s", event.ID, payload, hidden)
+				}
+			}
+		}
+	})
+}
+
+// serveAs sends a GET for path through the version negotiation and the
+// routes of s, authenticated as identity unless it is nil
+func serveAs(s *Server, identity *model.Identity, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	if identity != nil {
+		r = r.WithContext(context.WithValue(r.Context(), identityKey{}, *identity))
+	}
+	w := httptest.NewRecorder()
+	s.NegotiateVersion(s.Routes()).ServeHTTP(w, r)
+	return w
+}
@@ -0,0 +1,178 @@
+// Package health checks the dependencies of the API. Each subsystem
+// registers a checker for what it depends on, and a check runs them all
+// at once, reporting the status and latency of every component along with
+// an overall verdict.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Checker is implemented by the clients of dependencies that can tell
+// whether they work, returning why not
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to a Checker
+type CheckFunc func(ctx context.Context) error
+
+func (f CheckFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Detailer is implemented by checkers reporting more about their
+// component, such as the usage of a connection pool
+type Detailer interface {
+	Details() map[string]interface{}
+}
+
+// WithDetails adds the details returned by details to the component
+// checked by checker
+func WithDetails(checker Checker, details func() map[string]interface{}) Checker {
+	return detailed{checker, details}
+}
+
+type detailed struct {
+	Checker
+	details func() map[string]interface{}
+}
+
+func (d detailed) Details() map[string]interface{} {
+	return d.details()
+}
+
+// Statuses of components and of the whole API. The API is down when a
+// critical component is, and degraded when any other one is.
+const (
+	StatusUp       = "up"
+	StatusDegraded = "degraded"
+	StatusDown     = "down"
+)
+
+// Component is the result of checking a dependency
+type Component struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Critical components are those the API can't serve requests without
+	Critical  bool    `json:"critical"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// Details are reported by checkers implementing Detailer
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Report is the result of checking every registered dependency
+type Report struct {
+	Status     string      `json:"status"`
+	Components []Component `json:"components"`
+}
+
+type check struct {
+	name     string
+	checker  Checker
+	critical bool
+}
+
+// Registry holds the checkers of the dependencies
+type Registry struct {
+	timeout time.Duration
+
+	mu     sync.RWMutex
+	checks []check
+}
+
+// NewRegistry creates an empty registry whose checks each fail after
+// timeout; zero leaves them to the deadline of the caller
+func NewRegistry(timeout time.Duration) *Registry {
+	return &Registry{timeout: timeout}
+}
+
+// Register adds the checker of a dependency, replacing any registered
+// under the same name
+func (r *Registry) Register(name string, checker Checker, critical bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.checks {
+		if c.name == name {
+			r.checks[i] = check{name, checker, critical}
+			return
+		}
+	}
+	r.checks = append(r.checks, check{name, checker, critical})
+}
+
+// Check runs every checker concurrently, reporting the components in
+// registration order
+func (r *Registry) Check(ctx context.Context) Report {
+	return r.check(ctx, false)
+}
+
+// Ready runs the checkers of the critical components only, which the API
+// needs to serve requests
+func (r *Registry) Ready(ctx context.Context) Report {
+	return r.check(ctx, true)
+}
+
+func (r *Registry) check(ctx context.Context, criticalOnly bool) Report {
+	r.mu.RLock()
+	var checks []check
+	for _, c := range r.checks {
+		if c.critical || !criticalOnly {
+			checks = append(checks, c)
+		}
+	}
+	r.mu.RUnlock()
+
+	report := Report{Status: StatusUp, Components: make([]Component, len(checks))}
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Components[i] = r.run(ctx, c)
+		}()
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		switch {
+		case component.Status == StatusUp:
+		case component.Critical:
+			report.Status = StatusDown
+		case report.Status == StatusUp:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// run checks a dependency within the timeout, turning panics into failures
+func (r *Registry) run(ctx context.Context, c check) (component Component) {
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+
+	component = Component{Name: c.name, Status: StatusUp, Critical: c.critical}
+	start := time.Now()
+	defer func() {
+		component.LatencyMS = float64(time.Since(start).Microseconds()) / 1000
+		if p := recover(); p != nil {
+			component.Status, component.Error = StatusDown, fmt.Sprint("check panicked: ", p)
+		}
+	}()
+
+	if err := c.checker.Check(ctx); err != nil {
+		component.Status, component.Error = StatusDown, err.Error()
+	}
+	if detailer, ok := c.checker.(Detailer); ok {
+		component.Details = detailer.Details()
+	}
+	return component
+}
@@ -0,0 +1,215 @@
+// Package jobs runs work queued in the database in the background, so HTTP
+// handlers can enqueue slow work, such as sending emails, instead of doing
+// it inline. Workers of every instance share the queue.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"api/internal/backoff"
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// Handler runs a job of one type. Returning an error retries the job with
+// backoff, unless the error is Permanent.
+type Handler func(ctx context.Context, job model.Job) error
+
+// Options tune a Queue
+type Options struct {
+	// Workers is the number of jobs run concurrently by this instance; with
+	// zero it only enqueues jobs, for other instances to run
+	Workers int
+	// PollInterval is how long idle workers wait before looking for due jobs again
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a job may run. A job still running past
+	// it is cancelled, and runs again if its worker died.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is how many times a job runs before it is dead
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubling for each
+	// further one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// Queue enqueues jobs and runs them on its workers
+type Queue struct {
+	repo     repository.JobRepository
+	logger   *log.Logger
+	clock    func() time.Time
+	opts     Options
+	handlers map[string]Handler
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New creates a Queue; register the handlers of its job types before Start
+func New(repo repository.JobRepository, logger *log.Logger, clock func() time.Time, opts Options) *Queue {
+	return &Queue{repo: repo, logger: logger, clock: clock, opts: opts, handlers: map[string]Handler{}}
+}
+
+// Handle registers the handler running the jobs of a type
+func (q *Queue) Handle(jobType string, handler Handler) {
+	q.handlers[jobType] = handler
+}
+
+// Enqueue queues a job of the type with payload encoded as JSON, to run as
+// soon as a worker is free, scoped to the organization of the context
+func (q *Queue) Enqueue(ctx context.Context, jobType string, payload interface{}) (model.Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return model.Job{}, err
+	}
+	now := q.clock()
+	job, err := q.repo.EnqueueJob(ctx, model.Job{
+		Type:        jobType,
+		Payload:     data,
+		MaxAttempts: q.opts.MaxAttempts,
+		RunAt:       now,
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return job, fmt.Errorf("failed to enqueue a %s job: %w", jobType, err)
+	}
+	return job, nil
+}
+
+// Start starts the workers
+func (q *Queue) Start() {
+	q.stop = make(chan struct{})
+	for i := 0; i < q.opts.Workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+}
+
+// Stop stops the workers once they finished the jobs they are running
+func (q *Queue) Stop() {
+	if q.stop == nil {
+		return
+	}
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// Check fails when the workers of the queue aren't running, or its jobs
+// can't be read
+func (q *Queue) Check(ctx context.Context) error {
+	if q.opts.Workers > 0 && q.stop == nil {
+		return fmt.Errorf("jobs: workers not started")
+	}
+	_, err := q.repo.ListJobs(ctx, model.JobParams{Limit: 1})
+	return err
+}
+
+// work runs due jobs one after the other until the queue stops
+func (q *Queue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		now := q.clock()
+		job, err := q.repo.ClaimJob(context.Background(), now, now.Add(q.opts.VisibilityTimeout))
+		if err != nil {
+			if !errors.Is(err, model.ErrNotFound) {
+				q.logger.Printf("[jobs] failed to claim a job: %v", err)
+			}
+			select {
+			case <-q.stop:
+				return
+			case <-time.After(q.opts.PollInterval):
+			}
+			continue
+		}
+		q.run(job)
+	}
+}
+
+// run runs a claimed job and settles it: deleted once it succeeds, retried
+// later when it fails, dead when it failed for good or too many times
+func (q *Queue) run(job model.Job) {
+	// a job claimed again past its last attempt outlived the visibility timeout
+	err := fmt.Errorf("still running after %s on its last attempt", q.opts.VisibilityTimeout)
+	if job.Attempts <= job.MaxAttempts {
+		err = q.call(job)
+	}
+
+	ctx := context.Background()
+	if err == nil {
+		if err := q.repo.CompleteJob(ctx, job.ID, job.Attempts); err != nil {
+			q.logger.Printf("[jobs] failed to complete %s job %d: %v", job.Type, job.ID, err)
+		}
+		return
+	}
+
+	var retryAt *time.Time
+	var permanent *permanentError
+	if !errors.As(err, &permanent) && job.Attempts < job.MaxAttempts {
+		at := q.clock().Add(q.backoff(job.Attempts))
+		retryAt = &at
+		q.logger.Printf("[jobs] %s job %d failed, retrying at %s: %v", job.Type, job.ID, at.Format(time.RFC3339), err)
+	} else {
+		q.logger.Printf("[jobs] %s job %d is dead after %d attempts: %v", job.Type, job.ID, job.Attempts, err)
+	}
+	if err := q.repo.FailJob(ctx, job.ID, job.Attempts, err.Error(), retryAt); err != nil {
+		q.logger.Printf("[jobs] failed to record the failure of %s job %d: %v", job.Type, job.ID, err)
+	}
+}
+
+// call runs the handler of the job, scoped to its organization, and
+// cancels it past the visibility timeout. A panic fails the job.
+func (q *Queue) call(job model.Job) (err error) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return Permanent(fmt.Errorf("no handler for %s jobs", job.Type))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), q.opts.VisibilityTimeout)
+	defer cancel()
+	if job.OrgID != nil {
+		ctx = model.WithOrg(ctx, *job.OrgID)
+	}
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return handler(ctx, job)
+}
+
+// backoff is the delay before retrying a job that failed its attempt
+func (q *Queue) backoff(attempt int) time.Duration {
+	return backoff.Exponential(q.opts.Backoff, q.opts.MaxBackoff, attempt)
+}
+
+// permanentError is a failure retrying won't fix
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks a handler error as one retrying won't fix, such as an
+// invalid payload, so the job is dead at once
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
@@ -0,0 +1,99 @@
+// Package logmask masks the personal data in log output, so logs shipped
+// to other systems or kept for long don't become a copy of it. It works on
+// the text of each entry, catching the data however it was logged.
+package logmask
+
+import (
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// phone numbers in E.164 form, as they are stored
+	phonePattern = regexp.MustCompile(`\+[1-9][0-9]{6,14}\b`)
+	// sensitive fields of structs logged with %+v, e.g. {ID:1 Name:Ann Lee ...}
+	fieldPattern = regexp.MustCompile(`\b(Name|Birth|Street|City|Number|Body|Title):`)
+	// the next field of a struct, or its end, closing a field's value
+	nextFieldPattern = regexp.MustCompile(` [A-Z][A-Za-z]*:|[}\]]`)
+	// sensitive keys of JSON objects
+	jsonPattern = regexp.MustCompile(`"(name|birth|street|city|number|body|title)":"((?:[^"\\]|\\.)*)"`)
+)
+
+// Writer masks the entries written through it before passing them on. The
+// log package writes each entry at once, so every Write is a whole entry.
+type Writer struct {
+	w io.Writer
+}
+
+// NewWriter returns a Writer writing to w, for log.SetOutput
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+func (m *Writer) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(m.w, Mask(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Mask returns the text with its emails, phone numbers, names, birth dates
+// and addresses masked, e.g. ann@example.com as a***@e***.com
+func Mask(text string) string {
+	text = emailPattern.ReplaceAllStringFunc(text, MaskEmail)
+	text = phonePattern.ReplaceAllStringFunc(text, func(phone string) string {
+		return phone[:3] + "***" + phone[len(phone)-2:]
+	})
+	text = jsonPattern.ReplaceAllStringFunc(text, func(pair string) string {
+		m := jsonPattern.FindStringSubmatch(pair)
+		return `"` + m[1] + `":"` + MaskWord(m[2]) + `"`
+	})
+	return maskFields(text)
+}
+
+// maskFields masks the values of the sensitive fields of structs, which
+// run up to the next field as they may hold spaces
+func maskFields(text string) string {
+	var b strings.Builder
+	for {
+		loc := fieldPattern.FindStringIndex(text)
+		if loc == nil {
+			b.WriteString(text)
+			return b.String()
+		}
+		b.WriteString(text[:loc[1]])
+		text = text[loc[1]:]
+		end := len(text)
+		if next := nextFieldPattern.FindStringIndex(text); next != nil {
+			end = next[0]
+		}
+		b.WriteString(MaskWord(text[:end]))
+		text = text[end:]
+	}
+}
+
+// MaskEmail masks an email, keeping the first letter of the local part
+// and of the domain, and the top-level domain
+func MaskEmail(email string) string {
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok {
+		return MaskWord(email)
+	}
+	var tld string
+	if dot := strings.LastIndex(domain, "."); dot >= 0 {
+		domain, tld = domain[:dot], domain[dot:]
+	}
+	return MaskWord(local) + "@" + MaskWord(domain) + tld
+}
+
+// MaskWord masks text, keeping its first letter
+func MaskWord(text string) string {
+	if text == "" {
+		return text
+	}
+	first, _ := utf8.DecodeRuneInString(text)
+	return string(first) + "***"
+}
@@ -0,0 +1,16 @@
+package mailer
+
+import (
+	"context"
+	"log"
+)
+
+// Log writes emails to a logger instead of sending them, for development
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l Log) Send(ctx context.Context, msg Message) error {
+	l.Logger.Printf("[mail] To: %s, Subject: %s, HTML: %d bytes\n%s", msg.To, msg.Subject, len(msg.HTML), msg.Text)
+	return nil
+}
@@ -0,0 +1,42 @@
+// Package mailer delivers the emails the API sends, such as invitations,
+// verification links and reports, through an SMTP server or the HTTP API
+// of an email service, and renders them from templates.
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Message is an email with a plain text body and, optionally, an HTML
+// alternative to it
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Sender delivers an email
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// client sends the requests of the HTTP API providers
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// checkResponse closes resp, returning an error with the start of its body
+// unless it succeeded
+func checkResponse(provider string, resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("mailer: %s answered %s: %s", provider, resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,84 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// sendGridURL is the endpoint of the SendGrid v3 mail send API
+const sendGridURL = "https://api.sendgrid.com/v3/mail/send"
+
+// sendGridScopesURL lists the permissions of the API key, which Check uses
+// to make sure it is valid
+const sendGridScopesURL = "https://api.sendgrid.com/v3/scopes"
+
+// SendGrid sends emails through the SendGrid API
+type SendGrid struct {
+	APIKey string
+	From   string
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridPersonalization struct {
+	To []sendGridAddress `json:"to"`
+}
+
+type sendGridMessage struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+}
+
+func (s SendGrid) Send(ctx context.Context, msg Message) error {
+	content := []sendGridContent{{Type: "text/plain", Value: msg.Text}}
+	if msg.HTML != "" {
+		content = append(content, sendGridContent{Type: "text/html", Value: msg.HTML})
+	}
+	payload, err := json.Marshal(sendGridMessage{
+		Personalizations: []sendGridPersonalization{{To: []sendGridAddress{{Email: msg.To}}}},
+		From:             sendGridAddress{Email: s.From},
+		Subject:          msg.Subject,
+		Content:          content,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendGridURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse("SendGrid", resp)
+}
+
+// Check makes sure SendGrid is reachable and accepts the API key
+func (s SendGrid) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sendGridScopesURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.APIKey)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse("SendGrid", resp)
+}
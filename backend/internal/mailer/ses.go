@@ -0,0 +1,140 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SES sends emails through the Amazon SES v2 API
+type SES struct {
+	// Endpoint defaults to https://email.<region>.amazonaws.com
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	From      string
+}
+
+type sesContent struct {
+	Data    string `json:"Data"`
+	Charset string `json:"Charset"`
+}
+
+type sesMessage struct {
+	FromEmailAddress string `json:"FromEmailAddress"`
+	Destination      struct {
+		ToAddresses []string `json:"ToAddresses"`
+	} `json:"Destination"`
+	Content struct {
+		Simple struct {
+			Subject sesContent `json:"Subject"`
+			Body    struct {
+				Text sesContent  `json:"Text"`
+				HTML *sesContent `json:"Html,omitempty"`
+			} `json:"Body"`
+		} `json:"Simple"`
+	} `json:"Content"`
+}
+
+const amzDateLayout = "20060102T150405Z"
+
+func (s SES) Send(ctx context.Context, msg Message) error {
+	email := sesMessage{FromEmailAddress: s.From}
+	email.Destination.ToAddresses = []string{msg.To}
+	email.Content.Simple.Subject = sesContent{Data: msg.Subject, Charset: "UTF-8"}
+	email.Content.Simple.Body.Text = sesContent{Data: msg.Text, Charset: "UTF-8"}
+	if msg.HTML != "" {
+		email.Content.Simple.Body.HTML = &sesContent{Data: msg.HTML, Charset: "UTF-8"}
+	}
+	payload, err := json.Marshal(email)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint()+"/v2/email/outbound-emails", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, payload, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse("SES", resp)
+}
+
+// Check reads the SES account, making sure SES is reachable and accepts the keys
+func (s SES) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.endpoint()+"/v2/email/account", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	s.sign(req, nil, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse("SES", resp)
+}
+
+// endpoint returns the base URL of the SES API
+func (s SES) endpoint() string {
+	if s.Endpoint == "" {
+		return "https://email." + s.Region + ".amazonaws.com"
+	}
+	return strings.TrimSuffix(s.Endpoint, "/")
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to req,
+// whose body is payload, covering its host, content type and date
+func (s SES) sign(req *http.Request, payload []byte, now time.Time) {
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateLayout))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "content-type;host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payloadHash,
+		"x-amz-date:" + now.Format(amzDateLayout) + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + s.Region + "/ses/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format(amzDateLayout), scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "ses")
+	key = hmacSHA256(key, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
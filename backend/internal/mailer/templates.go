@@ -0,0 +1,155 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// embedded holds the default templates, templates/<locale>/<name>.html
+//
+//go:embed templates
+var embedded embed.FS
+
+// DefaultLocale is the locale every email has a template in
+const DefaultLocale = "en"
+
+// funcs are the functions available to templates
+var funcs = map[string]interface{}{
+	"date":     func(t time.Time) string { return t.UTC().Format("2006-01-02") },
+	"datetime": func(t time.Time) string { return t.UTC().Format(time.RFC1123) },
+}
+
+// template is an email in one locale. Its file defines the "subject",
+// "text" and "html" templates; the first two are parsed as text templates,
+// the last one as an HTML template escaping what it is given.
+type template struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Templates renders emails from the embedded templates, some of which may
+// be overridden, or added, from a directory
+type Templates struct {
+	byLocale map[string]map[string]template
+	fallback string
+}
+
+// NewTemplates parses the embedded templates and those of dir, if not
+// empty, which replace the embedded ones of the same locale and name.
+// Emails are rendered in fallback when no preferred locale has a template.
+func NewTemplates(dir, fallback string) (*Templates, error) {
+	t := &Templates{byLocale: map[string]map[string]template{}, fallback: strings.ToLower(fallback)}
+
+	root, err := fs.Sub(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	if err := t.parseDir(root); err != nil {
+		return nil, err
+	}
+	if dir != "" {
+		if err := t.parseDir(os.DirFS(dir)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// parseDir parses every <locale>/<name>.html file of fsys
+func (t *Templates) parseDir(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*/*.html")
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		locale, name := path.Split(file)
+		locale = strings.ToLower(strings.TrimSuffix(locale, "/"))
+		name = strings.TrimSuffix(name, ".html")
+
+		tmpl, err := parseTemplate(name, string(data))
+		if err != nil {
+			return fmt.Errorf("mailer: template %s: %w", file, err)
+		}
+		if t.byLocale[locale] == nil {
+			t.byLocale[locale] = map[string]template{}
+		}
+		t.byLocale[locale][name] = tmpl
+	}
+	return nil
+}
+
+func parseTemplate(name, data string) (template, error) {
+	text, err := texttemplate.New(name).Funcs(funcs).Parse(data)
+	if err != nil {
+		return template{}, err
+	}
+	html, err := htmltemplate.New(name).Funcs(funcs).Parse(data)
+	if err != nil {
+		return template{}, err
+	}
+	for _, block := range []string{"subject", "text", "html"} {
+		if text.Lookup(block) == nil {
+			return template{}, fmt.Errorf("%q is not defined", block)
+		}
+	}
+	return template{text: text, html: html}, nil
+}
+
+// Render renders the email called name with data, in the first of the
+// preferred locales it has a template in. Regional locales like "pt-BR"
+// fall back to their language, and all of them to the fallback locale and
+// then DefaultLocale. The message has no recipient yet.
+func (t *Templates) Render(name string, locales []string, data interface{}) (Message, error) {
+	tmpl, ok := t.lookup(name, locales)
+	if !ok {
+		return Message{}, fmt.Errorf("mailer: no template %q", name)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, fmt.Errorf("mailer: template %s: %w", name, err)
+	}
+	if err := tmpl.text.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, fmt.Errorf("mailer: template %s: %w", name, err)
+	}
+	if err := tmpl.html.ExecuteTemplate(&html, "html", data); err != nil {
+		return Message{}, fmt.Errorf("mailer: template %s: %w", name, err)
+	}
+	return Message{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+		HTML:    strings.TrimSpace(html.String()) + "\n",
+	}, nil
+}
+
+// lookup returns the template of the email in the best available locale
+func (t *Templates) lookup(name string, locales []string) (template, bool) {
+	candidates := make([]string, 0, 2*len(locales)+2)
+	for _, locale := range locales {
+		locale = strings.ToLower(locale)
+		candidates = append(candidates, locale)
+		if language, _, ok := strings.Cut(locale, "-"); ok {
+			candidates = append(candidates, language)
+		}
+	}
+	candidates = append(candidates, t.fallback, DefaultLocale)
+
+	for _, locale := range candidates {
+		if tmpl, ok := t.byLocale[locale][name]; ok {
+			return tmpl, true
+		}
+	}
+	return template{}, false
+}
@@ -0,0 +1,104 @@
+// Package metrics exposes gauges and counters in the Prometheus text
+// format. Subsystems register collectors reading their current values, so
+// nothing is recorded between scrapes.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric types
+const (
+	Gauge   = "gauge"
+	Counter = "counter"
+)
+
+// Sample is the value of a metric, for one set of labels
+type Sample struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Collector returns the current samples of a subsystem; samples of the
+// same metric must be next to each other
+type Collector func() []Sample
+
+// Registry holds the collectors of the subsystems
+type Registry struct {
+	mu         sync.RWMutex
+	collectors []Collector
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a collector
+func (r *Registry) Register(c Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// ServeHTTP writes the samples of every collector in the Prometheus text
+// format, in registration order
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.RLock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	out := bufio.NewWriter(w)
+	defer out.Flush()
+
+	described := map[string]bool{}
+	for _, collect := range collectors {
+		for _, sample := range collect() {
+			if !described[sample.Name] {
+				described[sample.Name] = true
+				fmt.Fprintf(out, "# HELP %s %s\n", sample.Name, escape(sample.Help, false))
+				fmt.Fprintf(out, "# TYPE %s %s\n", sample.Name, sample.Type)
+			}
+			fmt.Fprintf(out, "%s%s %s\n", sample.Name, labels(sample.Labels), strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		}
+	}
+}
+
+// labels formats a label set, sorted by name
+func labels(set map[string]string) string {
+	if len(set) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escape(set[name], true) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// escape escapes backslashes and newlines in help texts, and double quotes
+// too in label values
+func escape(s string, quotes bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quotes {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,244 @@
+// Package migrate applies versioned SQL migrations and records which
+// versions have been applied in a schema_migrations table.
+//
+// Migrations are files named <version>_<name>.up.sql and
+// <version>_<name>.down.sql, for example 0001_create_users.up.sql.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Migration is one schema change with its rollback
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status describes whether a migration has been applied
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// Migrator runs migrations against a database
+type Migrator struct {
+	ctx        context.Context
+	db         *sql.DB
+	rebind     func(string) string
+	migrations []Migration
+}
+
+// Load reads the migrations stored in dir, ordered by version
+func Load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		prefix, rest, found := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil {
+			return nil, fmt.Errorf("migration %s: file name must start with <version>_", name)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: strings.TrimSuffix(strings.TrimSuffix(rest, ".up.sql"), ".down.sql")}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// New creates a migrator. rebind converts ? placeholders to the database's style.
+func New(db *sql.DB, rebind func(string) string, migrations []Migration) *Migrator {
+	return &Migrator{ctx: context.Background(), db: db, rebind: rebind, migrations: migrations}
+}
+
+// WithContext returns a copy of the migrator running its statements with ctx
+func (m *Migrator) WithContext(ctx context.Context) *Migrator {
+	copied := *m
+	copied.ctx = ctx
+	return &copied
+}
+
+// ensureTable creates the bookkeeping table when it doesn't exist yet
+func (m *Migrator) ensureTable() error {
+	_, err := m.db.ExecContext(m.ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	return err
+}
+
+// applied returns the applied versions with the time they were applied
+func (m *Migrator) applied() (map[int]time.Time, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(m.ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		applied[version] = at
+	}
+	return applied, rows.Err()
+}
+
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		status := Status{Version: mig.Version, Name: mig.Name}
+		if at, ok := applied[mig.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the number of migrations not applied yet
+func (m *Migrator) Pending() (int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return 0, err
+	}
+
+	pending := 0
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Up applies every pending migration in version order and returns the versions it applied
+func (m *Migrator) Up() ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for _, mig := range m.migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+
+		log.Printf("[migrate] Applying %04d_%s", mig.Version, mig.Name)
+		err := m.run(mig.Up, "INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+			mig.Version, mig.Name, time.Now().UTC())
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations
+func (m *Migrator) Down(steps int) ([]int, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var done []int
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == "" {
+			return done, fmt.Errorf("migration %d_%s has no down file", mig.Version, mig.Name)
+		}
+
+		log.Printf("[migrate] Reverting %04d_%s", mig.Version, mig.Name)
+		if err := m.run(mig.Down, "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		done = append(done, mig.Version)
+	}
+	return done, nil
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) run(script, bookkeeping string, args ...interface{}) error {
+	tx, err := m.db.BeginTx(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(m.ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(m.ctx, m.rebind(bookkeeping), args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// RegisterInput is the data people sign up with
+type RegisterInput struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Birth    string `json:"birth"` // YYYY-MM-DD
+	Password string `json:"password"`
+}
+
+// LoginInput is the credentials a user logs in with
+type LoginInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AccessToken authenticates the requests of a logged in user, sent as
+// Authorization: Bearer <token>
+type AccessToken struct {
+	Token     string    `json:"token" xml:"token"`
+	ExpiresAt time.Time `json:"expires_at" xml:"expires_at"`
+	User      User      `json:"user" xml:"user"`
+}
+
+// Identity is who a request is authenticated as: a user, along with the
+// user impersonating them when an admin acts on their behalf
+type Identity struct {
+	User         User
+	Impersonator *User
+}
@@ -0,0 +1,19 @@
+package model
+
+// Address is a postal address of a user; at most one per user is primary
+type Address struct {
+	ID        int    `json:"id" xml:"id"`
+	UserID    int    `json:"user_id" xml:"user_id"`
+	Street    string `json:"street" xml:"street"`
+	City      string `json:"city" xml:"city"`
+	Country   string `json:"country" xml:"country"` // ISO 3166-1 alpha-2 code
+	IsPrimary bool   `json:"is_primary" xml:"is_primary"`
+}
+
+// AddressInput is the client-supplied data used to create or replace an address
+type AddressInput struct {
+	Street    string `json:"street"`
+	City      string `json:"city"`
+	Country   string `json:"country"`
+	IsPrimary bool   `json:"is_primary"`
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// AuditEntry records a request made through the API: who made it, on whose
+// behalf, what it did and how it ended
+type AuditEntry struct {
+	ID         int       `json:"id" xml:"id"`
+	OccurredAt time.Time `json:"occurred_at" xml:"occurred_at"`
+	RequestID  string    `json:"request_id" xml:"request_id"`
+	OrgID      *int      `json:"org_id,omitempty" xml:"org_id,omitempty"`
+	// Actor is the ID of the user the request was authenticated as, or anonymous
+	Actor string `json:"actor" xml:"actor"`
+	// Impersonator is the ID of the admin who acted as Actor, empty unless
+	// the request was made while impersonating
+	Impersonator string `json:"impersonator,omitempty" xml:"impersonator,omitempty"`
+	Action       string `json:"action" xml:"action"`
+	Resource     string `json:"resource" xml:"resource"`
+	Method       string `json:"method" xml:"method"`
+	Path         string `json:"path" xml:"path"`
+	Status       int    `json:"status" xml:"status"`
+}
+
+// AuditParams filters the audit log, newest entries first
+type AuditParams struct {
+	// Actor keeps the entries of one user, whether they acted or were impersonated
+	Actor string
+	// Impersonated keeps only the entries made while impersonating
+	Impersonated bool
+	// Before keeps the entries older than this ID, to page through the log
+	Before int
+	Limit  int
+}
@@ -0,0 +1,99 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DateLayout is the YYYY-MM-DD format dates are exchanged in
+const DateLayout = "2006-01-02"
+
+// Date is a calendar day without a time of day, exchanged as "YYYY-MM-DD"
+// in JSON, XML and CSV. The embedded time is midnight UTC.
+type Date struct {
+	time.Time
+}
+
+// NewDate returns the day of t, dropping the time of day
+func NewDate(t time.Time) Date {
+	return Date{time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)}
+}
+
+// ParseDate parses a YYYY-MM-DD string
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(DateLayout, s)
+	if err != nil {
+		return Date{}, err
+	}
+	return Date{t}, nil
+}
+
+// String returns the date as YYYY-MM-DD
+func (d Date) String() string {
+	return d.Format(DateLayout)
+}
+
+func (d Date) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts YYYY-MM-DD, as well as the RFC 3339 timestamps older clients send
+func (d *Date) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return d.UnmarshalText([]byte(s))
+}
+
+func (d Date) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Date) UnmarshalText(text []byte) error {
+	if parsed, err := ParseDate(string(text)); err == nil {
+		*d = parsed
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, string(text))
+	if err != nil {
+		return fmt.Errorf("invalid date %q, expected YYYY-MM-DD", text)
+	}
+	*d = NewDate(t)
+	return nil
+}
+
+// Scan reads DATE columns, which drivers return as time.Time or as text
+func (d *Date) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = NewDate(v)
+		return nil
+	case string:
+		return d.scanText(v)
+	case []byte:
+		return d.scanText(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into Date", src)
+	}
+}
+
+// scanText parses a date stored as text, ignoring any time part
+func (d *Date) scanText(s string) error {
+	if len(s) < len(DateLayout) {
+		return fmt.Errorf("invalid date %q", s)
+	}
+	parsed, err := ParseDate(s[:len(DateLayout)])
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value stores the date as a midnight UTC time, which every driver maps to DATE
+func (d Date) Value() (driver.Value, error) {
+	return d.Time, nil
+}
@@ -0,0 +1,126 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Domain errors returned by the repository and service layers. Callers
+// match them with errors.Is; the handler layer maps each one to an HTTP
+// status and a message that is safe to show to clients.
+var (
+	// ErrNotFound is matched by every NotFoundError
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is matched by every ConflictError
+	ErrConflict = errors.New("conflict")
+	// ErrDuplicateEmail is returned when another user already has the email
+	ErrDuplicateEmail = Conflict("email")
+	// ErrVersionConflict is returned when an update is based on a stale version
+	ErrVersionConflict = fmt.Errorf("version conflict: %w", ErrConflict)
+	// ErrRoleInUse is returned when deleting a role users still have
+	ErrRoleInUse = fmt.Errorf("role in use: %w", ErrConflict)
+	// ErrOrganizationInUse is returned when deleting an organization that still has users or teams
+	ErrOrganizationInUse = fmt.Errorf("organization in use: %w", ErrConflict)
+	// ErrInvitationAccepted is returned when accepting an invitation a second time
+	ErrInvitationAccepted = fmt.Errorf("invitation already accepted: %w", ErrConflict)
+	// ErrAlreadyAnonymized is returned when anonymizing a user a second time,
+	// or reverting an anonymized user
+	ErrAlreadyAnonymized = fmt.Errorf("user already anonymized: %w", ErrConflict)
+	// ErrInvitationExpired is returned when accepting an invitation past its expiry
+	ErrInvitationExpired = errors.New("invitation expired")
+	// ErrInvalidCredentials is returned when logging in with an unknown email or a wrong password
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrEmailNotVerified is returned when logging in before verifying the email
+	ErrEmailNotVerified = errors.New("email not verified")
+	// ErrInvalidToken is returned for emailed tokens that are tampered with or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrValidation is matched by every error describing invalid input
+	ErrValidation = errors.New("validation failed")
+	// ErrEncryptedSort is returned when listing users sorted by their
+	// emails while those are encrypted
+	ErrEncryptedSort = fmt.Errorf("can't sort by encrypted emails: %w", ErrValidation)
+	// ErrForbidden is matched by every ForbiddenError
+	ErrForbidden = errors.New("forbidden")
+	// ErrImpersonation is returned when impersonating oneself, or from an impersonation
+	ErrImpersonation = fmt.Errorf("impersonation not allowed: %w", ErrForbidden)
+	// ErrUnavailable is matched by every UnavailableError
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// NotFoundError is returned when the requested record of a resource doesn't exist
+type NotFoundError struct {
+	Resource string // e.g. "user"
+}
+
+// NotFound returns a NotFoundError for the resource
+func NotFound(resource string) error {
+	return &NotFoundError{Resource: resource}
+}
+
+func (e *NotFoundError) Error() string {
+	return e.Resource + " not found"
+}
+
+// Unwrap lets callers match any NotFoundError with errors.Is(err, ErrNotFound)
+func (e *NotFoundError) Unwrap() error {
+	return ErrNotFound
+}
+
+// ConflictError is returned when a value must be unique but is already taken
+type ConflictError struct {
+	Field string // e.g. "email"
+}
+
+// Conflict returns a ConflictError for the field
+func Conflict(field string) error {
+	return &ConflictError{Field: field}
+}
+
+func (e *ConflictError) Error() string {
+	return e.Field + " already in use"
+}
+
+// Is makes conflicts on the same field match each other, so callers can
+// compare against ErrDuplicateEmail with errors.Is
+func (e *ConflictError) Is(target error) bool {
+	other, ok := target.(*ConflictError)
+	return ok && other.Field == e.Field
+}
+
+// Unwrap lets callers match any ConflictError with errors.Is(err, ErrConflict)
+func (e *ConflictError) Unwrap() error {
+	return ErrConflict
+}
+
+// ForbiddenError is returned when the caller may not change some fields of a record
+type ForbiddenError struct {
+	Fields []string
+}
+
+func (e *ForbiddenError) Error() string {
+	return "not allowed to change " + strings.Join(e.Fields, ", ")
+}
+
+// Unwrap lets callers match any ForbiddenError with errors.Is(err, ErrForbidden)
+func (e *ForbiddenError) Unwrap() error {
+	return ErrForbidden
+}
+
+// UnavailableError is returned while a dependency is known to be down, so
+// calls fail at once rather than waiting for it
+type UnavailableError struct {
+	Dependency string // e.g. "database"
+	// RetryAfter is when the dependency may be back
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return e.Dependency + " unavailable"
+}
+
+// Unwrap lets callers match any UnavailableError with errors.Is(err, ErrUnavailable)
+func (e *UnavailableError) Unwrap() error {
+	return ErrUnavailable
+}
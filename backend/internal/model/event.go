@@ -0,0 +1,48 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The types of the domain events, published when users change
+const (
+	EventUserCreated    = "user.created"
+	EventUserUpdated    = "user.updated"
+	EventUserDeleted    = "user.deleted"
+	EventUserAnonymized = "user.anonymized"
+)
+
+// Event is a change of a user, recorded in the outbox in the transaction
+// of the change and published from there once it committed
+type Event struct {
+	ID     int64  `json:"id" xml:"id"`
+	Type   string `json:"type" xml:"type"`
+	OrgID  int    `json:"org_id" xml:"org_id"`
+	UserID int    `json:"user_id" xml:"user_id"`
+	// Payload is the JSON encoded EventPayload
+	Payload   json.RawMessage `json:"payload" xml:"-"`
+	CreatedAt time.Time       `json:"created_at" xml:"created_at"`
+	// Attempts counts the failed publications of the event
+	Attempts    int        `json:"attempts" xml:"attempts"`
+	LastError   string     `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty" xml:"delivered_at,omitempty"`
+}
+
+// EventPayload is what an event says of the user: the user as the change
+// left it, or as it was before it was deleted, along with the changed
+// fields of updates and anonymizations. The payloads of a user's events
+// are emptied when it is anonymized.
+type EventPayload struct {
+	User    *User         `json:"user,omitempty"`
+	Actor   string        `json:"actor,omitempty"`
+	Changes []FieldChange `json:"changes,omitempty"`
+}
+
+// EventParams pages through the outbox, oldest events first
+type EventParams struct {
+	// Since keeps the events recorded after the one with this ID
+	Since int64
+	Type  string
+	Limit int
+}
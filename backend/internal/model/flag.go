@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// FeatureFlag is an override turning a feature flag on or off, for one
+// organization or, with OrgID 0, for every organization
+type FeatureFlag struct {
+	Name      string    `json:"name" xml:"name"`
+	OrgID     int       `json:"org_id" xml:"org_id"`
+	Enabled   bool      `json:"enabled" xml:"enabled"`
+	UpdatedAt time.Time `json:"updated_at" xml:"updated_at"`
+}
+
+// FeatureFlagInput is the client-supplied data used to override a feature
+// flag; OrgID limits the override to one organization
+type FeatureFlagInput struct {
+	Enabled *bool `json:"enabled"`
+	OrgID   int   `json:"org_id"`
+}
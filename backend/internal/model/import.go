@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// ImportStatus is where a CSV import of users is in its life
+type ImportStatus string
+
+const (
+	// ImportPending imports wait for a worker of the job queue
+	ImportPending ImportStatus = "pending"
+	// ImportRunning imports are creating their users, one row after the other
+	ImportRunning ImportStatus = "running"
+	// ImportDone imports went through every row; the rows that failed are in Errors
+	ImportDone ImportStatus = "done"
+	// ImportFailed imports stopped before their last row, see Error
+	ImportFailed ImportStatus = "failed"
+)
+
+// Import is a CSV of users being created in the background. Processed
+// counts the rows gone through so far, of which Created became users and
+// Failed did not.
+type Import struct {
+	ID        int          `json:"id" xml:"id"`
+	OrgID     *int         `json:"org_id,omitempty" xml:"org_id,omitempty"`
+	Status    ImportStatus `json:"status" xml:"status"`
+	Total     int          `json:"total" xml:"total"`
+	Processed int          `json:"processed" xml:"processed"`
+	Created   int          `json:"created" xml:"created"`
+	Failed    int          `json:"failed" xml:"failed"`
+	// Errors are the first rows that failed, in the order of the CSV
+	Errors []ImportError `json:"errors" xml:"errors>error"`
+	// Error is why a failed import stopped
+	Error      string     `json:"error,omitempty" xml:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at" xml:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty" xml:"finished_at,omitempty"`
+}
+
+// ImportError is why a row of an import did not become a user
+type ImportError struct {
+	// Row is the line of the CSV the row starts on, the header being line 1
+	Row     int    `json:"row" xml:"row"`
+	Message string `json:"message" xml:"message"`
+	// Fields has a message per invalid field, when the row was invalid
+	Fields map[string]string `json:"fields,omitempty" xml:"-"`
+}
@@ -0,0 +1,39 @@
+package model
+
+import "time"
+
+// Invitation statuses
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationExpired  = "expired"
+)
+
+// Invitation asks someone to join an organization with a role. It is
+// emailed as a signed link; accepting it creates their user.
+type Invitation struct {
+	ID        int       `json:"id" xml:"id"`
+	Email     string    `json:"email" xml:"email"`
+	Role      string    `json:"role" xml:"role"`
+	OrgID     int       `json:"org_id" xml:"org_id"`
+	Status    string    `json:"status" xml:"status"`
+	ExpiresAt time.Time `json:"expires_at" xml:"expires_at"`
+	CreatedAt time.Time `json:"created_at" xml:"created_at"`
+	// AcceptedAt and UserID are set once the invitation is accepted
+	AcceptedAt *time.Time `json:"accepted_at,omitempty" xml:"accepted_at,omitempty"`
+	UserID     *int       `json:"user_id,omitempty" xml:"user_id,omitempty"`
+}
+
+// InvitationInput is the client-supplied data used to invite someone
+type InvitationInput struct {
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
+
+// AcceptInvitationInput is the data the invitee completes their user with;
+// the email and role come from the invitation
+type AcceptInvitationInput struct {
+	Name     string   `json:"name"`
+	Birth    string   `json:"birth"` // YYYY-MM-DD
+	Metadata Metadata `json:"metadata,omitempty"`
+}
@@ -0,0 +1,49 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// JobStatus is where a background job is in its life. Jobs that ran
+// successfully are deleted, so there is no status for them.
+type JobStatus string
+
+const (
+	// JobPending jobs run once RunAt is past
+	JobPending JobStatus = "pending"
+	// JobRunning jobs are being run by a worker until LockedUntil; past it
+	// the worker is presumed dead and the job runs again
+	JobRunning JobStatus = "running"
+	// JobDead jobs failed MaxAttempts times, or for good, and wait for an
+	// admin to retry them
+	JobDead JobStatus = "dead"
+)
+
+// Job is work queued to run in the background, outside of the request
+// that queued it
+type Job struct {
+	ID   int    `json:"id" xml:"id"`
+	Type string `json:"type" xml:"type"`
+	// Payload is never sent to clients, as it may hold secrets such as the
+	// links of the emails being sent
+	Payload json.RawMessage `json:"-" xml:"-"`
+	// OrgID is the organization the job was queued for; it runs scoped to it
+	OrgID       *int       `json:"org_id,omitempty" xml:"org_id,omitempty"`
+	Status      JobStatus  `json:"status" xml:"status"`
+	Attempts    int        `json:"attempts" xml:"attempts"`
+	MaxAttempts int        `json:"max_attempts" xml:"max_attempts"`
+	RunAt       time.Time  `json:"run_at" xml:"run_at"`
+	LockedUntil *time.Time `json:"locked_until,omitempty" xml:"locked_until,omitempty"`
+	LastError   string     `json:"last_error,omitempty" xml:"last_error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at" xml:"created_at"`
+}
+
+// JobParams filters the job queue, newest jobs first
+type JobParams struct {
+	Status JobStatus
+	Type   string
+	// Before keeps the jobs older than this ID, to page through the queue
+	Before int
+	Limit  int
+}
@@ -0,0 +1,17 @@
+package model
+
+import "context"
+
+type localesKey struct{}
+
+// WithLocales returns a context carrying the locales the client prefers,
+// best first, such as "pt-BR", used to pick the language of emails
+func WithLocales(ctx context.Context, locales []string) context.Context {
+	return context.WithValue(ctx, localesKey{}, locales)
+}
+
+// LocalesFrom returns the locales the client prefers, best first, or nil
+func LocalesFrom(ctx context.Context) []string {
+	locales, _ := ctx.Value(localesKey{}).([]string)
+	return locales
+}
@@ -0,0 +1,125 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Metadata holds arbitrary client-defined attributes of a user, such as an
+// employee ID or a department, stored as a JSON object
+type Metadata map[string]interface{}
+
+// MetadataKeyPattern is the shape of metadata keys, which keeps them usable
+// as query parameters and JSON paths
+var MetadataKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Merge returns a copy of m with patch applied as a JSON merge patch
+// (RFC 7386): null values remove keys, objects are merged recursively and
+// anything else replaces the existing value
+func (m Metadata) Merge(patch Metadata) Metadata {
+	return Metadata(mergeObject(m, patch))
+}
+
+func mergeObject(target, patch map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(target)+len(patch))
+	for key, value := range target {
+		merged[key] = value
+	}
+	for key, value := range patch {
+		switch value := value.(type) {
+		case nil:
+			delete(merged, key)
+		case map[string]interface{}:
+			existing, _ := merged[key].(map[string]interface{})
+			merged[key] = mergeObject(existing, value)
+		default:
+			merged[key] = value
+		}
+	}
+	return merged
+}
+
+// Text returns the value of key as it is compared by metadata filters:
+// strings as is, numbers and booleans in their JSON form. Missing keys and
+// nested values report false.
+func (m Metadata) Text(key string) (string, bool) {
+	switch value := m[key].(type) {
+	case string:
+		return value, true
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(value), true
+	}
+	return "", false
+}
+
+// Scan reads the JSON object stored in the metadata column; NULL is empty
+func (m *Metadata) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*m = Metadata{}
+		return nil
+	case string:
+		data = []byte(v)
+	case []byte:
+		data = v
+	default:
+		return fmt.Errorf("cannot scan %T into Metadata", src)
+	}
+
+	*m = Metadata{}
+	return json.Unmarshal(data, m)
+}
+
+// Value stores the metadata as a JSON object; nil metadata is NULL, which
+// updates treat as "leave unchanged"
+func (m Metadata) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// MarshalXML encodes each key as an entry element holding its JSON value,
+// since keys aren't necessarily valid element names
+func (m Metadata) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(m) {
+		value, ok := m.Text(key)
+		if !ok {
+			data, err := json.Marshal(m[key])
+			if err != nil {
+				return err
+			}
+			value = string(data)
+		}
+		entry := xml.StartElement{Name: xml.Name{Local: "entry"}, Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}}}
+		if err := enc.EncodeElement(value, entry); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
+}
+
+// sortedKeys returns the keys of m in alphabetical order
+func sortedKeys(m Metadata) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
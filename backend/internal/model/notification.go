@@ -0,0 +1,81 @@
+package model
+
+import "time"
+
+// The types of the notifications users get
+const (
+	NotificationProfileUpdated  = "profile.updated"
+	NotificationSessionsRevoked = "sessions.revoked"
+	NotificationBirthday        = "birthday"
+)
+
+// NotificationTypes are the types users can turn off, in the order they are listed
+var NotificationTypes = []string{NotificationProfileUpdated, NotificationSessionsRevoked, NotificationBirthday}
+
+// CriticalNotificationTypes are the types also sent by text message, to the
+// primary phone number of users
+var CriticalNotificationTypes = []string{NotificationSessionsRevoked}
+
+// The channels notifications are delivered through
+const (
+	ChannelEmail = "email"
+	ChannelInApp = "in_app"
+	ChannelSMS   = "sms"
+)
+
+// NotificationChannels are the channels users can turn off
+var NotificationChannels = []string{ChannelEmail, ChannelInApp, ChannelSMS}
+
+// Notification tells a user, in the app, of something that happened to
+// their account, such as an admin editing their profile
+type Notification struct {
+	ID        int64      `json:"id" xml:"id"`
+	UserID    int        `json:"user_id" xml:"user_id"`
+	Type      string     `json:"type" xml:"type"`
+	Title     string     `json:"title" xml:"title"`
+	Body      string     `json:"body,omitempty" xml:"body,omitempty"`
+	CreatedAt time.Time  `json:"created_at" xml:"created_at"`
+	ReadAt    *time.Time `json:"read_at,omitempty" xml:"read_at,omitempty"`
+}
+
+// NotificationParams pages through the notifications of a user, newest first
+type NotificationParams struct {
+	// Unread keeps the notifications not read yet
+	Unread bool
+	// Before keeps the notifications older than the one with this ID
+	Before int64
+	Limit  int
+}
+
+// NotificationPreferences are the channels and types of notifications a
+// user receives. A notification reaches them through a channel only when
+// both its type and the channel are on; those missing from the maps are.
+// Emails users can't do without, such as password resets, ignore them.
+type NotificationPreferences struct {
+	Channels map[string]bool `json:"channels"`
+	Types    map[string]bool `json:"types"`
+}
+
+// Allows reports whether notifications of the type reach the user through the channel
+func (p NotificationPreferences) Allows(typ, channel string) bool {
+	return enabled(p.Types, typ) && enabled(p.Channels, channel)
+}
+
+// Complete returns the preferences listing every channel and type, those
+// missing being on
+func (p NotificationPreferences) Complete() NotificationPreferences {
+	complete := NotificationPreferences{Channels: map[string]bool{}, Types: map[string]bool{}}
+	for _, channel := range NotificationChannels {
+		complete.Channels[channel] = enabled(p.Channels, channel)
+	}
+	for _, typ := range NotificationTypes {
+		complete.Types[typ] = enabled(p.Types, typ)
+	}
+	return complete
+}
+
+// enabled reports whether the key is on, keys missing being on
+func enabled(switches map[string]bool, key string) bool {
+	on, ok := switches[key]
+	return on || !ok
+}
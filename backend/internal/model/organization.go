@@ -0,0 +1,33 @@
+package model
+
+import "context"
+
+// Organization is a tenant. Its users and teams are only visible to
+// requests scoped to it; roles and permissions are shared by every tenant.
+type Organization struct {
+	ID   int    `json:"id" xml:"id"`
+	Name string `json:"name" xml:"name"`
+}
+
+// OrganizationInput is the client-supplied data used to create or rename an organization
+type OrganizationInput struct {
+	Name string `json:"name"`
+}
+
+// DefaultOrgID is the organization owning the users and teams created
+// before multi-tenancy, and those created by unscoped requests
+const DefaultOrgID = 1
+
+type orgKey struct{}
+
+// WithOrg returns a context scoping repository calls to the organization
+func WithOrg(ctx context.Context, id int) context.Context {
+	return context.WithValue(ctx, orgKey{}, id)
+}
+
+// OrgFrom returns the organization the context is scoped to; ok is false
+// for unscoped contexts, such as CLI commands, which see every tenant
+func OrgFrom(ctx context.Context) (id int, ok bool) {
+	id, ok = ctx.Value(orgKey{}).(int)
+	return id, ok
+}
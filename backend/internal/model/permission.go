@@ -0,0 +1,24 @@
+package model
+
+// Permission is a policy stored in the database, one principal, action and
+// resource pattern per row in the style of Casbin. Fields optionally limits
+// it to changes of those fields of the resource.
+type Permission struct {
+	ID          int      `json:"id" xml:"id"`
+	Effect      string   `json:"effect" xml:"effect"` // permit or forbid
+	Principal   string   `json:"principal" xml:"principal"`
+	Action      string   `json:"action" xml:"action"`
+	Resource    string   `json:"resource" xml:"resource"`
+	Fields      []string `json:"fields" xml:"fields>field"`
+	Description string   `json:"description" xml:"description"`
+}
+
+// PermissionInput is the client-supplied data used to create or replace a permission
+type PermissionInput struct {
+	Effect      string   `json:"effect"`
+	Principal   string   `json:"principal"`
+	Action      string   `json:"action"`
+	Resource    string   `json:"resource"`
+	Fields      []string `json:"fields"`
+	Description string   `json:"description"`
+}
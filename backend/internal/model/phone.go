@@ -0,0 +1,19 @@
+package model
+
+// Phone is a phone number of a user in E.164 form, unique per user; at most
+// one per user is primary
+type Phone struct {
+	ID        int    `json:"id" xml:"id"`
+	UserID    int    `json:"user_id" xml:"user_id"`
+	Number    string `json:"number" xml:"number"` // e.g. +6281234567890
+	IsPrimary bool   `json:"is_primary" xml:"is_primary"`
+}
+
+// PhoneInput is the client-supplied data used to create or replace a phone number
+type PhoneInput struct {
+	Number string `json:"number"`
+	// Region is the ISO 3166-1 alpha-2 code of the country numbers written
+	// without a +country prefix belong to
+	Region    string `json:"region,omitempty"`
+	IsPrimary bool   `json:"is_primary"`
+}
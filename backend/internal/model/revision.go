@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+// Revision is an edit of a user: who made it, and how the fields it changed
+// went from their old value to the new one
+type Revision struct {
+	ID     int `json:"id" xml:"id"`
+	UserID int `json:"user_id" xml:"user_id"`
+	// Version is the version of the user the edit made
+	Version int `json:"version" xml:"version"`
+	// Actor and Impersonator are who made the edit, like in the audit log
+	Actor        string        `json:"actor" xml:"actor"`
+	Impersonator string        `json:"impersonator,omitempty" xml:"impersonator,omitempty"`
+	Changes      []FieldChange `json:"changes" xml:"change"`
+	CreatedAt    time.Time     `json:"created_at" xml:"created_at"`
+}
+
+// FieldChange is the change of one field of a user. The values of every
+// revision are dropped when the user is anonymized, leaving only the field.
+type FieldChange struct {
+	Field string      `json:"field" xml:"field"`
+	Old   interface{} `json:"old,omitempty" xml:"-"`
+	New   interface{} `json:"new,omitempty" xml:"-"`
+}
+
+// Changes returns the changes of the editable fields whose value differs
+// in other, in the order of EditableUserFields
+func (u User) Changes(other User) []FieldChange {
+	var changes []FieldChange
+	for _, field := range u.ChangedFields(other) {
+		changes = append(changes, FieldChange{Field: field, Old: u.Field(field), New: other.Field(field)})
+	}
+	return changes
+}
+
+// Actor is who a change is made by: the user a request is authenticated
+// as, and the admin impersonating them, if any
+type Actor struct {
+	ID           string
+	Impersonator string
+}
+
+// AnonymousActor makes the changes of requests carrying no identity
+var AnonymousActor = Actor{ID: "anonymous"}
+
+type actorKey struct{}
+
+// WithActor returns a context attributing the changes made with it to actor
+func WithActor(ctx context.Context, actor Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns who the changes made with the context are attributed
+// to, AnonymousActor when nobody is
+func ActorFrom(ctx context.Context) Actor {
+	if actor, ok := ctx.Value(actorKey{}).(Actor); ok {
+		return actor
+	}
+	return AnonymousActor
+}
@@ -0,0 +1,19 @@
+package model
+
+import "regexp"
+
+// Role is a role users can be given, identified by its name
+type Role struct {
+	Name        string `json:"name" xml:"name"`
+	Description string `json:"description" xml:"description"`
+}
+
+// RoleInput is the client-supplied data used to create or replace a role
+type RoleInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// RoleNamePattern is the shape of role names, which keeps them usable in
+// policies ("role:<name>") and URLs
+var RoleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]{0,63}$`)
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// Session is a login kept on the server and identified by a cookie, for
+// clients that would rather not handle access tokens. Only a hash of the
+// cookie value is stored.
+type Session struct {
+	ID           string    `json:"-" xml:"-"` // SHA-256 of the cookie value, hex encoded
+	Token        string    `json:"-" xml:"-"` // the cookie value, only known when the session is created
+	UserID       int       `json:"user_id" xml:"user_id"`
+	OrgID        int       `json:"org_id" xml:"org_id"`
+	TokenVersion int       `json:"-" xml:"-"` // the user's token version at login
+	CreatedAt    time.Time `json:"created_at" xml:"created_at"`
+	ExpiresAt    time.Time `json:"expires_at" xml:"expires_at"`
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// TaskRun is the latest run of a recurring task, by whichever instance
+// performed it
+type TaskRun struct {
+	Task string `json:"-" xml:"-"`
+	// ScheduledAt is the time the run was due, StartedAt the time it started
+	// after its jitter
+	ScheduledAt time.Time `json:"scheduled_at" xml:"scheduled_at"`
+	StartedAt   time.Time `json:"started_at" xml:"started_at"`
+	// FinishedAt is nil while the run goes on
+	FinishedAt *time.Time `json:"finished_at,omitempty" xml:"finished_at,omitempty"`
+	// Error is why the run failed, empty when it succeeded
+	Error string `json:"error,omitempty" xml:"error,omitempty"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "context"
+
+// Team groups users, each of whom can belong to any number of teams
+type Team struct {
+	ID          int    `json:"id" xml:"id"`
+	Name        string `json:"name" xml:"name"`
+	Description string `json:"description" xml:"description"`
+	MemberCount int    `json:"member_count" xml:"member_count"`
+	// OrgID is the organization owning the team
+	OrgID int `json:"org_id" xml:"org_id"`
+}
+
+// TeamInput is the client-supplied data used to create or replace a team
+type TeamInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type teamScopeKey struct{}
+
+// WithTeamScope returns a context limiting user listings to the user with
+// the ID and the users sharing a team with them
+func WithTeamScope(ctx context.Context, userID int) context.Context {
+	return context.WithValue(ctx, teamScopeKey{}, userID)
+}
+
+// TeamScopeFrom returns the user whose teams the listings of the context
+// are limited to; ok is false for contexts listing every user
+func TeamScopeFrom(ctx context.Context) (userID int, ok bool) {
+	userID, ok = ctx.Value(teamScopeKey{}).(int)
+	return userID, ok
+}
@@ -0,0 +1,199 @@
+// Package model holds the domain types shared by the service, repository
+// and handler layers.
+package model
+
+import (
+	"reflect"
+	"time"
+)
+
+type User struct {
+	ID        int       `json:"id" xml:"id"`
+	Name      string    `json:"name" xml:"name"`
+	Email     string    `json:"email" xml:"email"`
+	Role      string    `json:"role" xml:"role"`
+	Birth     Date      `json:"birth" xml:"birth"`
+	Age       int       `json:"age" xml:"age"`
+	Timestamp time.Time `json:"timestamp" xml:"timestamp"`
+	Version   int       `json:"version" xml:"version"` // incremented on every update
+	Metadata  Metadata  `json:"metadata" xml:"metadata"`
+	// OrgID is the organization owning the user
+	OrgID int `json:"org_id" xml:"org_id"`
+	// Status is UserPending until a self-registered user verifies their email
+	Status string `json:"status" xml:"status"`
+	// PasswordHash is the bcrypt hash of the user's password, empty without
+	// one. It is never sent to clients, and only GetByEmail is sure to load it.
+	PasswordHash string `json:"-" xml:"-"`
+	// CanonicalEmail is Email without its +tag, set by the service when
+	// plus-addressed aliases are rejected and empty otherwise; no two users
+	// share one
+	CanonicalEmail string `json:"-" xml:"-"`
+	// TokenVersion is incremented to revoke the tokens issued to the user
+	TokenVersion int `json:"-" xml:"-"`
+	// Avatar is the storage key of the user's avatar, empty without one
+	Avatar string `json:"-" xml:"-"`
+	// AvatarURL is where clients download the avatar from, set by the service
+	AvatarURL string `json:"avatar_url,omitempty" xml:"avatar_url,omitempty"`
+	// AvatarThumbnails are the URLs of scaled down avatars, keyed by their size in pixels
+	AvatarThumbnails map[string]string `json:"avatar_thumbnails,omitempty" xml:"-"`
+	// AnonymizedAt is when the personal data of the user was replaced with
+	// placeholders, nil unless it was
+	AnonymizedAt *time.Time `json:"anonymized_at,omitempty" xml:"anonymized_at,omitempty"`
+}
+
+// User statuses
+const (
+	UserActive  = "active"
+	UserPending = "pending"
+)
+
+// UserInput is the client-supplied data used to create or update a user
+type UserInput struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+	Birth string `json:"birth"` // YYYY-MM-DD
+	// Version is the version an update is based on; required on update, ignored on create
+	Version int `json:"version,omitempty"`
+	// Metadata replaces the stored metadata; omitted, an update keeps it
+	Metadata Metadata `json:"metadata,omitempty"`
+}
+
+// UserPatch is a JSON merge patch of a user: omitted fields are left as
+// they are and metadata is merged key by key
+type UserPatch struct {
+	Name     *string  `json:"name"`
+	Email    *string  `json:"email"`
+	Role     *string  `json:"role"`
+	Birth    *string  `json:"birth"`
+	Metadata Metadata `json:"metadata"`
+	// Version is the version the patch is based on, required like that of
+	// a UserInput updating a user
+	Version *int `json:"version"`
+}
+
+// ListParams holds the search, filter and sorting options of a user listing
+type ListParams struct {
+	Search string
+	// Query is a full-text search, ranked by relevance where the database
+	// supports it, unless PlainSearch matches it like Search
+	Query       string
+	PlainSearch bool
+	Filter      UserFilter
+	Sort        string
+	Order       string
+	// Fields limits the columns loaded to these UserFields; empty loads all of them
+	Fields []string
+	// Limit caps the number of users returned, 0 returning all of them, after
+	// skipping the first Offset
+	Limit  int
+	Offset int
+}
+
+// UserFilter narrows a listing down to users matching every set condition.
+// Minimums and "after" bounds are inclusive, maximums inclusive and
+// "before" bounds exclusive.
+type UserFilter struct {
+	Roles         []string
+	AgeMin        *int
+	AgeMax        *int
+	BirthAfter    *Date
+	BirthBefore   *Date
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	// Metadata requires each key to hold the given value, compared as text
+	Metadata map[string]string
+	// Teams requires membership of at least one of the teams with these IDs
+	Teams []int
+}
+
+// Matches reports whether user meets every condition of the filter but
+// Teams, which repositories check as users don't carry their memberships
+func (f UserFilter) Matches(user User) bool {
+	if len(f.Roles) > 0 {
+		found := false
+		for _, role := range f.Roles {
+			found = found || user.Role == role
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case f.AgeMin != nil && user.Age < *f.AgeMin,
+		f.AgeMax != nil && user.Age > *f.AgeMax,
+		f.BirthAfter != nil && user.Birth.Before(f.BirthAfter.Time),
+		f.BirthBefore != nil && !user.Birth.Before(f.BirthBefore.Time),
+		f.CreatedAfter != nil && user.Timestamp.Before(*f.CreatedAfter),
+		f.CreatedBefore != nil && !user.Timestamp.Before(*f.CreatedBefore):
+		return false
+	}
+	for key, want := range f.Metadata {
+		if value, ok := user.Metadata.Text(key); !ok || value != want {
+			return false
+		}
+	}
+	return true
+}
+
+// UserFields are the fields of a user, by their JSON name, in display order
+var UserFields = []string{"id", "name", "email", "role", "birth", "age", "timestamp", "version", "metadata"}
+
+// EditableUserFields are the fields clients set, the others being derived
+var EditableUserFields = []string{"name", "email", "role", "birth", "metadata"}
+
+// ChangedFields returns the editable fields whose value differs in other.
+// Nil metadata in other means it is left unchanged.
+func (u User) ChangedFields(other User) []string {
+	var fields []string
+	if u.Name != other.Name {
+		fields = append(fields, "name")
+	}
+	if u.Email != other.Email {
+		fields = append(fields, "email")
+	}
+	if u.Role != other.Role {
+		fields = append(fields, "role")
+	}
+	if !u.Birth.Equal(other.Birth.Time) {
+		fields = append(fields, "birth")
+	}
+	if other.Metadata != nil && !reflect.DeepEqual(u.Metadata, other.Metadata) {
+		fields = append(fields, "metadata")
+	}
+	return fields
+}
+
+// Field returns the value of the field with the given JSON name, or nil for unknown names
+func (u User) Field(name string) interface{} {
+	switch name {
+	case "id":
+		return u.ID
+	case "name":
+		return u.Name
+	case "email":
+		return u.Email
+	case "role":
+		return u.Role
+	case "birth":
+		return u.Birth
+	case "age":
+		return u.Age
+	case "timestamp":
+		return u.Timestamp
+	case "version":
+		return u.Version
+	case "metadata":
+		return u.Metadata
+	}
+	return nil
+}
+
+// AgeAt calculates the age in whole years of someone born on birth at the given time
+func AgeAt(birth, now time.Time) int {
+	age := now.Year() - birth.Year()
+	if now.YearDay() < birth.YearDay() {
+		age--
+	}
+	return age
+}
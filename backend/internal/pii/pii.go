@@ -0,0 +1,163 @@
+// Package pii encrypts personal data, such as emails, before it is stored,
+// so a copy of the database doesn't give it away. Values are encrypted with
+// AES-GCM under data keys which are themselves encrypted, or wrapped, by a
+// master key kept out of the database: in the configuration, or in a KMS.
+// Encrypted values can't be searched, so a blind index, a keyed hash of the
+// value, is stored along with them for exact lookups.
+package pii
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// prefix starts every encrypted value, followed by the ID of its data key
+const prefix = "pii:v1:"
+
+// KeySize is the size of data keys and index keys, for AES-256
+const KeySize = 32
+
+// ErrUnknownKey is returned for the values encrypted under a data key the
+// Cipher wasn't given
+var ErrUnknownKey = errors.New("pii: value encrypted under an unknown key")
+
+// Wrapper encrypts and decrypts data keys with a master key
+type Wrapper interface {
+	Wrap(ctx context.Context, key []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// DataKey is a data key as configured: its ID and its wrapped form
+type DataKey struct {
+	ID      string
+	Wrapped []byte
+}
+
+// Cipher encrypts values under the first of its data keys, decrypts those
+// encrypted under any of them, and computes blind indexes
+type Cipher struct {
+	current string
+	keys    map[string]cipher.AEAD
+	index   []byte
+}
+
+// NewCipher unwraps the data keys and the index key with wrapper. The first
+// data key encrypts; the others, older ones, only decrypt, until every
+// value is encrypted again under the first. The index key must never
+// change, as the blind indexes computed with it would no longer match.
+func NewCipher(ctx context.Context, wrapper Wrapper, dataKeys []DataKey, indexKey []byte) (*Cipher, error) {
+	if len(dataKeys) == 0 {
+		return nil, errors.New("pii: no data key")
+	}
+	c := &Cipher{current: dataKeys[0].ID, keys: map[string]cipher.AEAD{}}
+	for _, dataKey := range dataKeys {
+		if dataKey.ID == "" || strings.Contains(dataKey.ID, ":") {
+			return nil, fmt.Errorf("pii: invalid data key ID %q", dataKey.ID)
+		}
+		key, err := wrapper.Unwrap(ctx, dataKey.Wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("pii: failed to unwrap data key %s: %w", dataKey.ID, err)
+		}
+		if c.keys[dataKey.ID], err = newAEAD(key); err != nil {
+			return nil, fmt.Errorf("pii: data key %s: %w", dataKey.ID, err)
+		}
+	}
+	key, err := wrapper.Unwrap(ctx, indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("pii: failed to unwrap the index key: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("pii: the index key has %d bytes, not %d", len(key), KeySize)
+	}
+	c.index = key
+	return c, nil
+}
+
+// GenerateKey returns a new random key, wrapped with wrapper, to be used as
+// a data key or the index key
+func GenerateKey(ctx context.Context, wrapper Wrapper) ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return wrapper.Wrap(ctx, key)
+}
+
+// Encrypt encrypts the value of the field, e.g. "users.email", under the
+// current data key. The field is authenticated along with the value, so an
+// encrypted value can't be passed off as another field's.
+func (c *Cipher) Encrypt(field, value string) (string, error) {
+	aead := c.keys[c.current]
+	sealed := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(sealed); err != nil {
+		return "", err
+	}
+	sealed = aead.Seal(sealed, sealed, []byte(value), []byte(field))
+	return prefix + c.current + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the value of the field Encrypt encrypted. Values that
+// aren't encrypted, stored before encryption was turned on, are returned
+// as they are.
+func (c *Cipher) Decrypt(field, value string) (string, error) {
+	if !Encrypted(value) {
+		return value, nil
+	}
+	id, data, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	aead, ok := c.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("pii: malformed encrypted value")
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("pii: failed to decrypt %s: %w", field, err)
+	}
+	return string(plain), nil
+}
+
+// Index returns the blind index of the value of the field: equal values
+// have equal indexes, from which the values can't be recovered without the
+// index key
+func (c *Cipher) Index(field, value string) string {
+	mac := hmac.New(sha256.New, c.index)
+	mac.Write([]byte(field))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Current returns the prefix of the values encrypted under the current data
+// key; values without it are to be encrypted again, see Encrypted
+func (c *Cipher) Current() string {
+	return prefix + c.current + ":"
+}
+
+// Encrypted reports whether value was encrypted by a Cipher
+func Encrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// newAEAD returns AES-GCM with the 256-bit key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key has %d bytes, not %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
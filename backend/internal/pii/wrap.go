@@ -0,0 +1,120 @@
+package pii
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Local wraps data keys with a master key held by the application, such as
+// one read from the configuration
+type Local struct {
+	aead cipher.AEAD
+}
+
+// NewLocal returns a Wrapper using the 256-bit master key
+func NewLocal(masterKey []byte) (*Local, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("pii: master key: %w", err)
+	}
+	return &Local{aead: aead}, nil
+}
+
+func (l *Local) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	wrapped := make([]byte, l.aead.NonceSize(), l.aead.NonceSize()+len(key)+l.aead.Overhead())
+	if _, err := rand.Read(wrapped); err != nil {
+		return nil, err
+	}
+	return l.aead.Seal(wrapped, wrapped, key, nil), nil
+}
+
+func (l *Local) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < l.aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	key, err := l.aead.Open(nil, wrapped[:l.aead.NonceSize()], wrapped[l.aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("wrapped key doesn't match the master key")
+	}
+	return key, nil
+}
+
+// VaultTransit wraps data keys with a key of the transit secrets engine of
+// HashiCorp Vault, which never leaves Vault
+type VaultTransit struct {
+	// Addr is the address of Vault, e.g. https://vault.example.com:8200
+	Addr  string
+	Token string
+	// Mount is the path the transit engine is mounted at, "transit" unless set
+	Mount string
+	// Key is the name of the transit key
+	Key string
+}
+
+// client sends the requests to Vault
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Wrap returns the ciphertext of Vault, such as "vault:v1:..."
+func (v VaultTransit) Wrap(ctx context.Context, key []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &out); err != nil {
+		return nil, err
+	}
+	return []byte(out.Data.Ciphertext), nil
+}
+
+func (v VaultTransit) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := v.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &out); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Data.Plaintext)
+}
+
+// call posts in to the transit operation and decodes the answer into out
+func (v VaultTransit) call(ctx context.Context, operation string, in, out interface{}) error {
+	mount := v.Mount
+	if mount == "" {
+		mount = "transit"
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", strings.TrimSuffix(v.Addr, "/"), mount, operation, v.Key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("vault answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
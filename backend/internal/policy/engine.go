@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+)
+
+// Mode controls whether denials are enforced or only recorded
+type Mode string
+
+const (
+	// Enforce rejects requests the policies deny
+	Enforce Mode = "enforce"
+	// DryRun evaluates and logs decisions but lets every request through
+	DryRun Mode = "dry-run"
+)
+
+// Engine holds the active policy set and evaluates requests against it.
+// Policies come from named sources, such as files, a remote bundle or the
+// database, each of which can be swapped at runtime with Load.
+type Engine struct {
+	mode        Mode
+	decisionLog bool
+
+	mu       sync.RWMutex
+	sources  map[string][]Policy
+	order    []string
+	policies []Policy // every source's policies, in the order sources were first loaded
+}
+
+// NewEngine creates an engine with no policies loaded
+func NewEngine(mode Mode, decisionLog bool) *Engine {
+	if mode != DryRun {
+		mode = Enforce
+	}
+	return &Engine{mode: mode, decisionLog: decisionLog, sources: map[string][]Policy{}}
+}
+
+// Load replaces the policies of a source, leaving the other sources' alone
+func (e *Engine) Load(source string, policies []Policy) {
+	e.mu.Lock()
+	if _, ok := e.sources[source]; !ok {
+		e.order = append(e.order, source)
+	}
+	e.sources[source] = policies
+
+	var all []Policy
+	for _, name := range e.order {
+		all = append(all, e.sources[name]...)
+	}
+	e.policies = all
+	e.mu.Unlock()
+
+	log.Printf("[policy] Loaded %d policies from %s", len(policies), source)
+}
+
+// Enforcing reports whether denied decisions should block the request
+func (e *Engine) Enforcing() bool {
+	return e.mode == Enforce
+}
+
+// Decide evaluates the input against the active policies, writing the
+// decision to the log when decision logging or dry-run mode is on
+func (e *Engine) Decide(in Input) Decision {
+	e.mu.RLock()
+	decision := Evaluate(e.policies, in)
+	e.mu.RUnlock()
+
+	if e.decisionLog || e.mode == DryRun {
+		entry, _ := json.Marshal(struct {
+			Mode     Mode     `json:"mode"`
+			Input    Input    `json:"input"`
+			Decision Decision `json:"decision"`
+		}{e.mode, in, decision})
+		log.Printf("[policy] decision %s", entry)
+	}
+
+	return decision
+}
+
+type contextKey int
+
+const (
+	principalKey contextKey = iota
+	tenantKey
+)
+
+// WithPrincipal returns a context carrying the authenticated principal
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFrom returns the principal stored in the context, or Anonymous
+func PrincipalFrom(ctx context.Context) Principal {
+	if p, ok := ctx.Value(principalKey).(Principal); ok {
+		return p
+	}
+	return Anonymous
+}
+
+// WithTenant returns a context carrying the tenant the request is scoped to
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantFrom returns the tenant stored in the context, or an empty string
+func TenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey).(string)
+	return tenant
+}
@@ -0,0 +1,179 @@
+// Package policy evaluates authorization requests against declarative
+// permit/forbid policies, in the spirit of OPA and Cedar.
+//
+// A request is allowed when at least one permit policy matches it and no
+// forbid policy does; with no matching policy the request is denied.
+package policy
+
+import (
+	"path"
+	"strings"
+)
+
+// Effect is the outcome a policy produces when it matches a request
+type Effect string
+
+const (
+	Permit Effect = "permit"
+	Forbid Effect = "forbid"
+)
+
+// Policy is a single rule. Each list holds glob patterns (see path.Match);
+// an empty list matches anything.
+//
+// Principal patterns are "user:<id>", "role:<name>" or "*".
+//
+// Fields narrows the policy to requests changing only those fields of the
+// resource, such as letting support staff edit names but not roles. Such a
+// permit lets requests through the route-level check, whose fields aren't
+// known yet; such a forbid only applies once they are.
+type Policy struct {
+	ID         string   `json:"id"`
+	Effect     Effect   `json:"effect"`
+	Principals []string `json:"principals"`
+	Actions    []string `json:"actions"`
+	Resources  []string `json:"resources"`
+	Tenants    []string `json:"tenants"`
+	Fields     []string `json:"fields"`
+}
+
+// Bundle is the on-disk and over-the-wire format of a set of policies
+type Bundle struct {
+	Policies []Policy `json:"policies"`
+}
+
+// Principal identifies who is making a request
+type Principal struct {
+	ID    string   `json:"id"`
+	Roles []string `json:"roles"`
+	// Org is the ID of the organization the principal belongs to, empty
+	// when it isn't bound to one
+	Org string `json:"org,omitempty"`
+	// Impersonator is the ID of the user acting as the principal, empty
+	// unless an admin impersonates it
+	Impersonator string `json:"impersonator,omitempty"`
+}
+
+// Anonymous is the principal used when a request carries no identity
+var Anonymous = Principal{ID: "anonymous", Roles: []string{"anonymous"}}
+
+// Input is everything a policy decision is based on
+type Input struct {
+	Principal Principal `json:"principal"`
+	Action    string    `json:"action"`
+	Resource  string    `json:"resource"`
+	Tenant    string    `json:"tenant"`
+	// Fields are the fields of the resource the request changes, when known
+	Fields []string `json:"fields,omitempty"`
+}
+
+// Decision is the result of evaluating an Input
+type Decision struct {
+	Allowed  bool   `json:"allowed"`
+	PolicyID string `json:"policy_id,omitempty"`
+	Reason   string `json:"reason"`
+	// Field is the field the request was denied on, for field-level decisions
+	Field string `json:"field,omitempty"`
+}
+
+// Evaluate applies the policies to the input, forbid taking precedence over
+// permit. When the input lists fields, each of them must be allowed.
+func Evaluate(policies []Policy, in Input) Decision {
+	if len(in.Fields) == 0 {
+		return evaluateField(policies, in, "")
+	}
+
+	var decision Decision
+	for _, field := range in.Fields {
+		if decision = evaluateField(policies, in, field); !decision.Allowed {
+			decision.Field = field
+			return decision
+		}
+	}
+	return decision
+}
+
+// evaluateField evaluates the input for a change of a single field, or for
+// the request as a whole when field is empty
+func evaluateField(policies []Policy, in Input, field string) Decision {
+	var permitted *Policy
+
+	for i := range policies {
+		p := &policies[i]
+		if !p.matches(in, field) {
+			continue
+		}
+		if p.Effect == Forbid {
+			return Decision{Allowed: false, PolicyID: p.ID, Reason: "forbidden by policy"}
+		}
+		if p.Effect == Permit && permitted == nil {
+			permitted = p
+		}
+	}
+
+	if permitted != nil {
+		return Decision{Allowed: true, PolicyID: permitted.ID, Reason: "permitted by policy"}
+	}
+	return Decision{Allowed: false, Reason: "no policy permits the request"}
+}
+
+// matches reports whether every dimension of the policy matches the input
+// and the changed field, empty for the request as a whole
+func (p *Policy) matches(in Input, field string) bool {
+	return matchPrincipal(p.Principals, in.Principal) &&
+		matchAny(p.Actions, in.Action) &&
+		matchAny(p.Resources, in.Resource) &&
+		matchAny(p.Tenants, in.Tenant) &&
+		p.matchField(field)
+}
+
+// matchField matches the changed field against the policy's fields. With
+// the field unknown only permits match, see Policy.
+func (p *Policy) matchField(field string) bool {
+	if len(p.Fields) == 0 {
+		return true
+	}
+	if field == "" {
+		return p.Effect == Permit
+	}
+	return matchAny(p.Fields, field)
+}
+
+// matchPrincipal matches the principal's id and roles against the patterns
+func matchPrincipal(patterns []string, principal Principal) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	candidates := []string{"user:" + principal.ID}
+	for _, role := range principal.Roles {
+		candidates = append(candidates, "role:"+role)
+	}
+
+	for _, candidate := range candidates {
+		if matchAny(patterns, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchAny reports whether value matches one of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == value {
+			return true
+		}
+		if ok, err := path.Match(pattern, value); err == nil && ok {
+			return true
+		}
+		// "users/*" should also cover nested resources like "users/1/avatar"
+		if prefix, found := strings.CutSuffix(pattern, "/*"); found && strings.HasPrefix(value, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
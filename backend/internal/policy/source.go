@@ -0,0 +1,128 @@
+package policy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// LoadFiles reads policy bundles from the given paths. A directory path
+// loads every *.json file inside it.
+func LoadFiles(paths []string) ([]Policy, error) {
+	var policies []Policy
+
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+
+		files := []string{p}
+		if info.IsDir() {
+			if files, err = filepath.Glob(filepath.Join(p, "*.json")); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			bundle, err := parseBundle(data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			policies = append(policies, bundle.Policies...)
+		}
+	}
+
+	return policies, nil
+}
+
+// parseBundle decodes and validates a policy bundle
+func parseBundle(data []byte) (Bundle, error) {
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return bundle, err
+	}
+	for _, p := range bundle.Policies {
+		if p.Effect != Permit && p.Effect != Forbid {
+			return bundle, fmt.Errorf("policy %q: effect must be %q or %q", p.ID, Permit, Forbid)
+		}
+	}
+	return bundle, nil
+}
+
+// WatchBundle polls a remote bundle endpoint and loads it into the engine
+// as the "bundle" source whenever it changes until the context is
+// cancelled. The first fetch happens synchronously so the engine starts
+// with policies in place.
+func WatchBundle(ctx context.Context, engine *Engine, url string, interval time.Duration) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	etag := ""
+
+	fetch := func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			return nil
+		case http.StatusOK:
+		default:
+			return fmt.Errorf("bundle endpoint returned %s", resp.Status)
+		}
+
+		var raw json.RawMessage
+		if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+			return err
+		}
+		bundle, err := parseBundle(raw)
+		if err != nil {
+			return err
+		}
+
+		engine.Load("bundle", bundle.Policies)
+		etag = resp.Header.Get("ETag")
+		return nil
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				// keep serving the last good bundle when a refresh fails
+				if err := fetch(); err != nil {
+					log.Printf("[policy] Bundle refresh failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,129 @@
+// Package ratelimit counts events per key, such as a client IP or an
+// email, over a sliding window to slow down abuse.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter allows up to limit events per key within window. It lives in
+// memory, so each server instance counts on its own.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	events    map[string][]time.Time
+	lastSweep time.Time
+}
+
+// New creates a Limiter allowing limit events per key within window, using
+// now as the current time. A limit of zero allows everything.
+func New(limit int, window time.Duration, now func() time.Time) *Limiter {
+	return &Limiter{limit: limit, window: window, now: now, events: map[string][]time.Time{}}
+}
+
+// Allow records an event for key and reports whether it is within the
+// limit. Rejected events aren't recorded; retryAfter is then how long until
+// the oldest event leaves the window.
+func (l *Limiter) Allow(key string) (ok bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return true, 0
+	}
+
+	now := l.now()
+	l.sweep(now)
+
+	if retryAfter := l.exceeded(key, now); retryAfter > 0 {
+		return false, retryAfter
+	}
+	l.events[key] = append(l.events[key], now)
+	return true, 0
+}
+
+// Exceeded reports whether key reached the limit, without recording an
+// event; retryAfter is then how long until the oldest event leaves the
+// window. Use it with Add to count only some events, such as failures.
+func (l *Limiter) Exceeded(key string) (exceeded bool, retryAfter time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return false, 0
+	}
+
+	retryAfter = l.exceeded(key, l.now())
+	return retryAfter > 0, retryAfter
+}
+
+// Add records an event for key, even past the limit
+func (l *Limiter) Add(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limit <= 0 {
+		return
+	}
+
+	now := l.now()
+	l.sweep(now)
+	l.events[key] = append(recent(l.events[key], now.Add(-l.window)), now)
+}
+
+// SetLimit changes the limit and window, keeping the events counted so far
+func (l *Limiter) SetLimit(limit int, window time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.limit, l.window = limit, window
+}
+
+// Reset forgets the events of key
+func (l *Limiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.events, key)
+}
+
+// exceeded drops the events of key that left the window and returns how
+// long until the key is within the limit again, zero when it already is
+func (l *Limiter) exceeded(key string, now time.Time) time.Duration {
+	events := recent(l.events[key], now.Add(-l.window))
+	if len(events) == 0 {
+		delete(l.events, key)
+		return 0
+	}
+	l.events[key] = events
+	if len(events) < l.limit {
+		return 0
+	}
+	return events[len(events)-l.limit].Add(l.window).Sub(now)
+}
+
+// sweep forgets the keys without events in the window, once per window, so
+// that memory doesn't grow with every key ever seen
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, events := range l.events {
+		if len(recent(events, now.Add(-l.window))) == 0 {
+			delete(l.events, key)
+		}
+	}
+}
+
+// recent drops the events, oldest first, that happened before since
+func recent(events []time.Time, since time.Time) []time.Time {
+	for len(events) > 0 && !events[0].After(since) {
+		events = events[1:]
+	}
+	return events
+}
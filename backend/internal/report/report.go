@@ -0,0 +1,49 @@
+// Package report builds the user summary emailed to admins and sends it on
+// a cron schedule.
+package report
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api/internal/model"
+)
+
+// Period is how far back a summary counts new users
+const Period = 7 * 24 * time.Hour
+
+// Stats runs the aggregate queries a summary is built from
+type Stats interface {
+	Count(ctx context.Context, params model.ListParams) (int, error)
+	CountByRole(ctx context.Context, params model.ListParams) (map[string]int, error)
+}
+
+// Summary is a snapshot of the user base
+type Summary struct {
+	GeneratedAt time.Time
+	Since       time.Time
+	Total       int
+	New         int // users created since Since
+	ByRole      map[string]int
+}
+
+// Build collects the summary as of now
+func Build(ctx context.Context, stats Stats, now time.Time) (Summary, error) {
+	summary := Summary{GeneratedAt: now, Since: now.Add(-Period)}
+
+	byRole, err := stats.CountByRole(ctx, model.ListParams{})
+	if err != nil {
+		return Summary{}, fmt.Errorf("counting users by role: %w", err)
+	}
+	summary.ByRole = byRole
+	for _, count := range byRole {
+		summary.Total += count
+	}
+
+	summary.New, err = stats.Count(ctx, model.ListParams{Filter: model.UserFilter{CreatedAfter: &summary.Since}})
+	if err != nil {
+		return Summary{}, fmt.Errorf("counting new users: %w", err)
+	}
+	return summary, nil
+}
@@ -0,0 +1,92 @@
+package report
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"api/internal/mailer"
+	"api/internal/scheduler"
+)
+
+// Recipient is an admin receiving the report on their own schedule
+type Recipient struct {
+	Email    string
+	Schedule string // standard 5-field cron spec, descriptors like @daily or CRON_TZ= prefixes
+}
+
+// ParseRecipients reads a semicolon separated list of recipients. Each one
+// is an email, optionally followed by "=" and its own cron schedule; the
+// others get defaultSchedule. For example:
+//
+//	admin@example.com; ops@example.com=0 9 * * 1-5
+func ParseRecipients(value, defaultSchedule string) ([]Recipient, error) {
+	var recipients []Recipient
+	for _, item := range strings.Split(value, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		recipient := Recipient{Email: item, Schedule: defaultSchedule}
+		if email, schedule, ok := strings.Cut(item, "="); ok {
+			recipient.Email, recipient.Schedule = strings.TrimSpace(email), strings.TrimSpace(schedule)
+		}
+		if _, err := cron.ParseStandard(recipient.Schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule %q for %s: %w", recipient.Schedule, recipient.Email, err)
+		}
+		recipients = append(recipients, recipient)
+	}
+	return recipients, nil
+}
+
+// Reporter builds the summary and emails it, rendered from the "report" template
+type Reporter struct {
+	Stats     Stats
+	Sender    mailer.Sender
+	Templates *mailer.Templates
+	Clock     func() time.Time
+	Logger    *log.Logger
+}
+
+// Send builds a fresh summary and emails it to each address
+func (r *Reporter) Send(ctx context.Context, to ...string) error {
+	summary, err := Build(ctx, r.Stats, r.Clock())
+	if err != nil {
+		return err
+	}
+	msg, err := r.Templates.Render("report", nil, summary)
+	if err != nil {
+		return err
+	}
+
+	for _, email := range to {
+		msg.To = email
+		if err := r.Sender.Send(ctx, msg); err != nil {
+			return fmt.Errorf("sending report to %s: %w", email, err)
+		}
+		r.Logger.Printf("[report] sent to %s", email)
+	}
+	return nil
+}
+
+// Tasks returns the tasks sending the report to every recipient on their
+// schedule, named "report:<email>". A failed report is sent on the next run.
+func (r *Reporter) Tasks(recipients []Recipient) []scheduler.Task {
+	tasks := make([]scheduler.Task, 0, len(recipients))
+	for _, recipient := range recipients {
+		email := recipient.Email
+		tasks = append(tasks, scheduler.Task{
+			Name:     "report:" + email,
+			Schedule: recipient.Schedule,
+			Run: func(ctx context.Context) error {
+				return r.Send(ctx, email)
+			},
+		})
+	}
+	return tasks
+}
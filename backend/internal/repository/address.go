@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"api/internal/model"
+)
+
+// AddressRepository persists the addresses of users. Addresses are always
+// looked up through their user, so an address of another user is not found.
+// Saving a primary address makes the user's other addresses non-primary.
+type AddressRepository interface {
+	ListAddresses(ctx context.Context, userID int) ([]model.Address, error)
+	GetAddress(ctx context.Context, userID, id int) (model.Address, error)
+	CreateAddress(ctx context.Context, address model.Address) (model.Address, error)
+	UpdateAddress(ctx context.Context, address model.Address) (model.Address, error)
+	DeleteAddress(ctx context.Context, userID, id int) error
+}
+
+const addressColumns = "id, user_id, street, city, country, is_primary"
+
+func scanAddress(row scanner) (model.Address, error) {
+	var address model.Address
+	err := row.Scan(&address.ID, &address.UserID, &address.Street, &address.City, &address.Country, &address.IsPrimary)
+	return address, err
+}
+
+func (s *sqlRepository) ListAddresses(ctx context.Context, userID int) ([]model.Address, error) {
+	query := s.d.rebind("SELECT " + addressColumns + " FROM addresses WHERE user_id = ? ORDER BY is_primary DESC, id")
+	logQuery(query, userID)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := []model.Address{}
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+	return addresses, rows.Err()
+}
+
+func (s *sqlRepository) GetAddress(ctx context.Context, userID, id int) (model.Address, error) {
+	query := s.d.rebind("SELECT " + addressColumns + " FROM addresses WHERE id = ? AND user_id = ?")
+	logQuery(query, id, userID)
+
+	address, err := scanAddress(s.conn(ctx).QueryRowContext(ctx, query, id, userID))
+	if err == sql.ErrNoRows {
+		return address, model.NotFound("address")
+	}
+	return address, err
+}
+
+func (s *sqlRepository) CreateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	return retryValue(ctx, s.queries, func() (model.Address, error) { return s.createAddressOnce(ctx, address) })
+}
+
+func (s *sqlRepository) createAddressOnce(ctx context.Context, address model.Address) (model.Address, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return address, err
+	}
+	defer s.rollback(ctx, tx)
+
+	if address.IsPrimary {
+		if err := s.clearPrimary(ctx, tx, address.UserID, 0); err != nil {
+			return address, err
+		}
+	}
+
+	query := "INSERT INTO addresses (user_id, street, city, country, is_primary) VALUES (?, ?, ?, ?, ?)"
+	args := []interface{}{address.UserID, address.Street, address.City, address.Country, address.IsPrimary}
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&address.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			address.ID = int(id)
+		}
+	}
+	if err != nil {
+		return address, err
+	}
+	return address, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) UpdateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	return retryValue(ctx, s.queries, func() (model.Address, error) { return s.updateAddressOnce(ctx, address) })
+}
+
+func (s *sqlRepository) updateAddressOnce(ctx context.Context, address model.Address) (model.Address, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return address, err
+	}
+	defer s.rollback(ctx, tx)
+
+	if address.IsPrimary {
+		if err := s.clearPrimary(ctx, tx, address.UserID, address.ID); err != nil {
+			return address, err
+		}
+	}
+
+	query := s.d.rebind("UPDATE addresses SET street = ?, city = ?, country = ?, is_primary = ? WHERE id = ? AND user_id = ?")
+	args := []interface{}{address.Street, address.City, address.Country, address.IsPrimary, address.ID, address.UserID}
+	logQuery(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return address, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return address, err
+	}
+	if rowsAffected == 0 {
+		return address, model.NotFound("address")
+	}
+	return address, s.commit(ctx, tx)
+}
+
+// clearPrimary makes every address of the user but exceptID non-primary
+func (s *sqlRepository) clearPrimary(ctx context.Context, tx *sql.Tx, userID, exceptID int) error {
+	query := s.d.rebind("UPDATE addresses SET is_primary = ? WHERE user_id = ? AND id <> ? AND is_primary = ?")
+	_, err := tx.ExecContext(ctx, query, false, userID, exceptID, true)
+	return err
+}
+
+func (s *sqlRepository) DeleteAddress(ctx context.Context, userID, id int) error {
+	query := s.d.rebind("DELETE FROM addresses WHERE id = ? AND user_id = ?")
+	logQuery(query, id, userID)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("address")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListAddresses(ctx context.Context, userID int) ([]model.Address, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	addresses := []model.Address{}
+	for _, address := range m.addresses {
+		if address.UserID == userID {
+			addresses = append(addresses, address)
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if addresses[i].IsPrimary != addresses[j].IsPrimary {
+			return addresses[i].IsPrimary
+		}
+		return addresses[i].ID < addresses[j].ID
+	})
+	return addresses, nil
+}
+
+func (m *memoryRepository) GetAddress(ctx context.Context, userID, id int) (model.Address, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	address, ok := m.addresses[id]
+	if !ok || address.UserID != userID {
+		return model.Address{}, model.NotFound("address")
+	}
+	return address, nil
+}
+
+func (m *memoryRepository) CreateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[address.UserID]; !ok {
+		return address, model.NotFound("user")
+	}
+	address.ID = m.nextAddressID
+	m.nextAddressID++
+	m.saveAddress(address)
+	return address, nil
+}
+
+func (m *memoryRepository) UpdateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.addresses[address.ID]; !ok || existing.UserID != address.UserID {
+		return address, model.NotFound("address")
+	}
+	m.saveAddress(address)
+	return address, nil
+}
+
+// saveAddress stores address, keeping it the only primary one of its user
+func (m *memoryRepository) saveAddress(address model.Address) {
+	if address.IsPrimary {
+		for id, other := range m.addresses {
+			if other.UserID == address.UserID && other.IsPrimary {
+				other.IsPrimary = false
+				m.addresses[id] = other
+			}
+		}
+	}
+	m.addresses[address.ID] = address
+}
+
+func (m *memoryRepository) DeleteAddress(ctx context.Context, userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if address, ok := m.addresses[id]; !ok || address.UserID != userID {
+		return model.NotFound("address")
+	}
+	delete(m.addresses, id)
+	return nil
+}
@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"api/internal/model"
+)
+
+// AuditRepository persists the audit log. Entries live in the shared
+// schema; contexts scoped to an organization only see its entries.
+type AuditRepository interface {
+	AppendAudit(ctx context.Context, entry model.AuditEntry) error
+	// ListAudit returns the entries matching params, newest first
+	ListAudit(ctx context.Context, params model.AuditParams) ([]model.AuditEntry, error)
+	// PurgeAudit deletes the entries of every organization that occurred
+	// before before, or only counts them when dryRun is set
+	PurgeAudit(ctx context.Context, before time.Time, dryRun bool) (int64, error)
+}
+
+func (s *sqlRepository) AppendAudit(ctx context.Context, entry model.AuditEntry) error {
+	query := s.d.rebind("INSERT INTO audit_log (occurred_at, request_id, org_id, actor, impersonator, action, resource, method, path, status) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+	args := []interface{}{entry.OccurredAt.UTC(), entry.RequestID, entry.OrgID, entry.Actor, entry.Impersonator,
+		entry.Action, entry.Resource, entry.Method, entry.Path, entry.Status}
+	logQuery(query, args...)
+	_, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlRepository) ListAudit(ctx context.Context, params model.AuditParams) ([]model.AuditEntry, error) {
+	var conditions []string
+	var args []interface{}
+	if org, ok := model.OrgFrom(ctx); ok {
+		conditions = append(conditions, "org_id = ?")
+		args = append(args, org)
+	}
+	if params.Actor != "" {
+		conditions = append(conditions, "(actor = ? OR impersonator = ?)")
+		args = append(args, params.Actor, params.Actor)
+	}
+	if params.Impersonated {
+		conditions = append(conditions, "impersonator <> ''")
+	}
+	if params.Before > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, params.Before)
+	}
+
+	query := "SELECT id, occurred_at, request_id, org_id, actor, impersonator, action, resource, method, path, status FROM audit_log"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query = s.d.rebind(query + " ORDER BY id DESC LIMIT ?")
+	args = append(args, params.Limit)
+	logQuery(query, args...)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []model.AuditEntry{}
+	for rows.Next() {
+		var entry model.AuditEntry
+		var orgID sql.NullInt64
+		if err := rows.Scan(&entry.ID, &entry.OccurredAt, &entry.RequestID, &orgID, &entry.Actor, &entry.Impersonator,
+			&entry.Action, &entry.Resource, &entry.Method, &entry.Path, &entry.Status); err != nil {
+			return nil, err
+		}
+		if orgID.Valid {
+			id := int(orgID.Int64)
+			entry.OrgID = &id
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (s *sqlRepository) PurgeAudit(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	if dryRun {
+		query := s.d.rebind("SELECT COUNT(*) FROM audit_log WHERE occurred_at < ?")
+		logQuery(query, before.UTC())
+		var n int64
+		err := s.conn(ctx).QueryRowContext(ctx, query, before.UTC()).Scan(&n)
+		return n, err
+	}
+
+	query := s.d.rebind("DELETE FROM audit_log WHERE occurred_at < ?")
+	logQuery(query, before.UTC())
+	result, err := s.conn(ctx).ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (m *memoryRepository) AppendAudit(ctx context.Context, entry model.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry.ID = m.nextAuditID
+	m.nextAuditID++
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *memoryRepository) ListAudit(ctx context.Context, params model.AuditParams) ([]model.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, scoped := model.OrgFrom(ctx)
+	entries := []model.AuditEntry{}
+	for _, entry := range m.audit {
+		switch {
+		case scoped && (entry.OrgID == nil || *entry.OrgID != org),
+			params.Actor != "" && entry.Actor != params.Actor && entry.Impersonator != params.Actor,
+			params.Impersonated && entry.Impersonator == "",
+			params.Before > 0 && entry.ID >= params.Before:
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID > entries[j].ID })
+	if len(entries) > params.Limit {
+		entries = entries[:params.Limit]
+	}
+	return entries, nil
+}
+
+func (m *memoryRepository) PurgeAudit(ctx context.Context, before time.Time, dryRun bool) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	kept := m.audit[:0:0]
+	for _, entry := range m.audit {
+		if !entry.OccurredAt.Before(before) {
+			kept = append(kept, entry)
+		}
+	}
+	purged := int64(len(m.audit) - len(kept))
+	if !dryRun {
+		m.audit = kept
+	}
+	return purged, nil
+}
@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"api/internal/model"
+)
+
+// BulkCreator is implemented by repositories creating many users at once
+// faster than one after the other, such as for CSV imports
+type BulkCreator interface {
+	// CreateUsers creates the users along with their events, all of them or
+	// none: an email that is taken fails them all with a model.ConflictError
+	CreateUsers(ctx context.Context, users []model.User) ([]model.User, error)
+}
+
+// outboxColumns are set when recording events
+var outboxColumns = []string{"type", "org_id", "user_id", "payload", "created_at", "attempts", "last_error"}
+
+// CreateUsers copies the users on Postgres, see copyUsers, within the
+// transaction of WithTx when there is one, and creates them in a single
+// transaction elsewhere
+func (s *sqlRepository) CreateUsers(ctx context.Context, users []model.User) ([]model.User, error) {
+	return retryValue(ctx, s.queries, func() ([]model.User, error) {
+		if s.pool == nil {
+			return s.createUsersOnce(ctx, users)
+		}
+		if conn := s.txConnFrom(ctx); conn != nil {
+			var created []model.User
+			err := pgxConn(conn, func(conn *pgx.Conn) (err error) {
+				created, err = s.copyUsers(ctx, conn, users)
+				return err
+			})
+			return created, err
+		}
+
+		tx, err := s.pool.Begin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback(ctx)
+		created, err := s.copyUsers(ctx, tx, users)
+		if err != nil {
+			return nil, err
+		}
+		return created, tx.Commit(ctx)
+	})
+}
+
+// pgxConn runs f on the pgx connection underneath conn, whose transaction,
+// if any, the statements of f run in
+func pgxConn(conn *sql.Conn, f func(conn *pgx.Conn) error) error {
+	return conn.Raw(func(driverConn interface{}) error {
+		for {
+			wrapper, ok := driverConn.(interface{ Unwrap() driver.Conn })
+			if !ok {
+				break
+			}
+			driverConn = wrapper.Unwrap()
+		}
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("not a pgx connection: %T", driverConn)
+		}
+		return f(stdlibConn.Conn())
+	})
+}
+
+// pgxQuerier is implemented by pgx.Tx and *pgx.Conn
+type pgxQuerier interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, rows pgx.CopyFromSource) (int64, error)
+}
+
+func (s *sqlRepository) createUsersOnce(ctx context.Context, users []model.User) ([]model.User, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.rollback(ctx, tx)
+
+	created := make([]model.User, len(users))
+	for i, user := range users {
+		if created[i], err = s.createTx(ctx, tx, user); err != nil {
+			return nil, err
+		}
+	}
+	return created, s.commit(ctx, tx)
+}
+
+// copyUsers creates the users with COPY, much faster than an INSERT per
+// user. COPY can't return the rows it creates, so they are copied to a
+// temporary table first, then moved into users by a single INSERT
+// returning them; their events are copied into the outbox. It runs on a
+// pgx connection in a transaction, as database/sql has no COPY; the
+// transaction commits the users.
+func (s *sqlRepository) copyUsers(ctx context.Context, tx pgxQuerier, users []model.User) ([]model.User, error) {
+	if err := s.observer.allow(); err != nil {
+		return nil, err
+	}
+	if err := s.checkPlainEmails(ctx, users); err != nil {
+		return nil, err
+	}
+
+	rows := make([][]interface{}, len(users))
+	for i, user := range users {
+		status := user.Status
+		if status == "" {
+			status = model.UserActive
+		}
+		email, emailIndex, err := s.sealEmail(user.Email)
+		if err != nil {
+			return nil, err
+		}
+		metadata, err := user.Metadata.Value()
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = []interface{}{user.Name, email, emailIndex, s.canonicalKey(user.CanonicalEmail), user.Role, user.Birth.Time, user.Age, metadata, ownerOrg(ctx), status, user.PasswordHash}
+	}
+
+	query := "CREATE TEMPORARY TABLE users_import ON COMMIT DROP AS SELECT " + insertColumns + " FROM users WITH NO DATA"
+	logQuery(query)
+	if _, err := tx.Exec(ctx, query); err != nil {
+		return nil, err
+	}
+	log.Printf("Query: COPY users_import (%s), Rows: %d", insertColumns, len(rows))
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"users_import"}, strings.Split(insertColumns, ", "), pgx.CopyFromRows(rows)); err != nil {
+		return nil, err
+	}
+
+	query = "INSERT INTO users (" + insertColumns + ") SELECT " + insertColumns + " FROM users_import RETURNING " + userColumns
+	logQuery(query)
+	returned, err := tx.Query(ctx, query)
+	if err != nil {
+		return nil, translateError(err)
+	}
+	created := make([]model.User, 0, len(users))
+	events := make([][]interface{}, 0, len(users))
+	for returned.Next() {
+		user, err := s.scanUser(returned)
+		if err != nil {
+			returned.Close()
+			return nil, err
+		}
+		event, err := newEvent(ctx, model.EventUserCreated, user, nil)
+		if err != nil {
+			returned.Close()
+			return nil, err
+		}
+		payload, err := s.seal(payloadField, string(event.Payload))
+		if err != nil {
+			returned.Close()
+			return nil, err
+		}
+		created = append(created, user)
+		events = append(events, []interface{}{event.Type, event.OrgID, event.UserID, payload, event.CreatedAt, 0, ""})
+	}
+	if err := returned.Err(); err != nil {
+		return nil, translateError(err)
+	}
+	// for the transaction to copy users again before it commits
+	logQuery("DROP TABLE users_import")
+	if _, err := tx.Exec(ctx, "DROP TABLE users_import"); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Query: COPY outbox (%s), Rows: %d", strings.Join(outboxColumns, ", "), len(events))
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"outbox"}, outboxColumns, pgx.CopyFromRows(events)); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// checkPlainEmails returns model.ErrDuplicateEmail when a user still has
+// one of the emails in plaintext, like checkPlainEmail
+func (s *sqlRepository) checkPlainEmails(ctx context.Context, users []model.User) error {
+	if s.pii == nil {
+		return nil
+	}
+	emails := make([]string, len(users))
+	for i, user := range users {
+		emails[i] = user.Email
+	}
+	query := "SELECT EXISTS (SELECT 1 FROM users WHERE email = ANY($1))"
+	logQuery(query, "<emails>")
+	var taken bool
+	if err := s.pool.QueryRow(ctx, query, emails).Scan(&taken); err != nil {
+		return err
+	}
+	if taken {
+		return model.ErrDuplicateEmail
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"api/internal/model"
+)
+
+// canonicalEmailField names the canonical email column to the pii.Cipher
+const canonicalEmailField = "users.canonical_email"
+
+// CanonicalEmailFiller is implemented by repositories keeping the canonical
+// emails of users, see model.User.CanonicalEmail
+type CanonicalEmailFiller interface {
+	// FillCanonicalEmails sets, batchSize users at a time, the canonical
+	// email of the users stored without one, as canonical returns it for
+	// their email, and returns how many it set and the IDs of the users
+	// whose canonical email another user already has
+	FillCanonicalEmails(ctx context.Context, canonical func(email string) string, batchSize int) (int, []int, error)
+}
+
+// canonicalKey returns the canonical email as it is stored: its blind index
+// when s.pii is set, as the canonical email is as personal as the email,
+// and NULL when it is empty
+func (s *sqlRepository) canonicalKey(canonical string) interface{} {
+	switch {
+	case canonical == "":
+		return nil
+	case s.pii != nil:
+		return s.pii.Index(canonicalEmailField, canonical)
+	}
+	return canonical
+}
+
+// GetByCanonicalEmail looks the canonical email up in every organization,
+// through its unique index
+func (s *sqlRepository) GetByCanonicalEmail(ctx context.Context, canonical string) (int, error) {
+	query := s.d.rebind("SELECT id FROM users WHERE canonical_email = ?")
+	logQuery(query, canonical)
+
+	var id int
+	err := s.conn(ctx).QueryRowContext(ctx, query, s.canonicalKey(canonical)).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, model.NotFound("user")
+	}
+	return id, err
+}
+
+func (s *sqlRepository) FillCanonicalEmails(ctx context.Context, canonical func(email string) string, batchSize int) (int, []int, error) {
+	filled, duplicates := 0, []int{}
+	for lastID := 0; ; {
+		// anonymized users keep no canonical email
+		query := s.d.rebind("SELECT id, email FROM users WHERE canonical_email IS NULL AND anonymized_at IS NULL AND id > ? ORDER BY id LIMIT ?")
+		logQuery(query, lastID, batchSize)
+		rows, err := s.conn(ctx).QueryContext(ctx, query, lastID, batchSize)
+		if err != nil {
+			return filled, duplicates, err
+		}
+		var users []model.User
+		for rows.Next() {
+			var user model.User
+			if err := rows.Scan(&user.ID, &user.Email); err != nil {
+				rows.Close()
+				return filled, duplicates, err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return filled, duplicates, err
+		}
+		if len(users) == 0 {
+			return filled, duplicates, nil
+		}
+
+		for _, user := range users {
+			lastID = user.ID
+			if err := s.openEmail(&user); err != nil {
+				return filled, duplicates, err
+			}
+			query := s.d.rebind("UPDATE users SET canonical_email = ? WHERE id = ? AND canonical_email IS NULL")
+			logQuery(query, user.ID)
+			result, err := s.conn(ctx).ExecContext(ctx, query, s.canonicalKey(canonical(user.Email)), user.ID)
+			if errors.Is(translateError(err), model.ErrDuplicateEmail) {
+				duplicates = append(duplicates, user.ID)
+				continue
+			} else if err != nil {
+				return filled, duplicates, err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return filled, duplicates, err
+			} else if n > 0 {
+				filled++
+			}
+		}
+	}
+}
+
+func (s *schemaRepository) GetByCanonicalEmail(ctx context.Context, canonical string) (int, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tenant.GetByCanonicalEmail(ctx, canonical)
+}
+
+// FillCanonicalEmails fills the canonical emails of the shared schema, then
+// those of every tenant's schema
+func (s *schemaRepository) FillCanonicalEmails(ctx context.Context, canonical func(email string) string, batchSize int) (int, []int, error) {
+	filled, duplicates, err := s.sqlRepository.FillCanonicalEmails(ctx, canonical, batchSize)
+	if err != nil {
+		return filled, duplicates, err
+	}
+	orgs, err := s.ListOrganizations(ctx)
+	if err != nil {
+		return filled, duplicates, err
+	}
+	for _, org := range orgs {
+		if org.ID == model.DefaultOrgID {
+			continue
+		}
+		repo, err := s.tenant(model.WithOrg(ctx, org.ID))
+		if err != nil {
+			return filled, duplicates, err
+		}
+		n, dups, err := repo.FillCanonicalEmails(ctx, canonical, batchSize)
+		filled, duplicates = filled+n, append(duplicates, dups...)
+		if err != nil {
+			return filled, duplicates, err
+		}
+	}
+	return filled, duplicates, nil
+}
+
+func (m *memoryRepository) GetByCanonicalEmail(ctx context.Context, canonical string) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for id, user := range m.users {
+		if user.CanonicalEmail == canonical {
+			return id, nil
+		}
+	}
+	return 0, model.NotFound("user")
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"time"
+
+	"api/internal/breaker"
+	"api/internal/model"
+)
+
+// guard sets up the circuit breaker failing queries fast while the
+// database is down, probing it through connector. The repositories of the
+// tenant schemas keep the breaker of the shared schema, as it's the same
+// server.
+func (o *queryObserver) guard(connector driver.Connector) {
+	if o.cfg.Breaker.FailureRate <= 0 || o.breaker != nil {
+		return
+	}
+	opts := o.cfg.Breaker
+	opts.OnChange = func(open bool) {
+		if open {
+			log.Printf("WARNING: the database is failing, rejecting queries until it answers again")
+		} else {
+			log.Printf("The database answers again, accepting queries")
+		}
+	}
+	o.breaker = breaker.New(probe(connector), opts, time.Now)
+}
+
+// allow fails with an UnavailableError while the breaker is open
+func (o *queryObserver) allow() error {
+	if o.breaker.Allow() != nil {
+		return &model.UnavailableError{Dependency: "database", RetryAfter: o.breaker.RetryAfter()}
+	}
+	return nil
+}
+
+// record counts the outcome of a call allowed by the breaker. Only
+// failures to reach the database or to hear back in time count: it
+// answered the others. Calls cancelled by the caller don't count at all.
+func (o *queryObserver) record(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	o.breaker.Record(err != nil && connectionError(err))
+}
+
+// probe checks that the database answers, on a connection of its own as
+// the breaker rejects the others
+func probe(connector driver.Connector) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		conn, err := connector.Connect(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		if pinger, ok := conn.(driver.Pinger); ok {
+			return pinger.Ping(ctx)
+		}
+		return nil
+	}
+}
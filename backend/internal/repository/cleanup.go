@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"api/internal/model"
+)
+
+// CleanupRepository deletes the data nobody needs anymore, for every organization
+type CleanupRepository interface {
+	// DeleteStaleData deletes the sessions expired before now, and the
+	// imports finished and jobs dead before before, returning the number of
+	// rows deleted from each table
+	DeleteStaleData(ctx context.Context, now, before time.Time) (map[string]int64, error)
+}
+
+func (s *sqlRepository) DeleteStaleData(ctx context.Context, now, before time.Time) (map[string]int64, error) {
+	deletes := []struct {
+		table, query string
+		at           time.Time
+	}{
+		{"sessions", "DELETE FROM sessions WHERE expires_at < ?", now},
+		{"imports", "DELETE FROM imports WHERE finished_at < ?", before},
+		{"jobs", "DELETE FROM jobs WHERE status = 'dead' AND created_at < ?", before},
+	}
+
+	deleted := map[string]int64{}
+	for _, d := range deletes {
+		query := s.d.rebind(d.query)
+		logQuery(query, d.at.UTC())
+		result, err := s.conn(ctx).ExecContext(ctx, query, d.at.UTC())
+		if err != nil {
+			return deleted, err
+		}
+		if deleted[d.table], err = result.RowsAffected(); err != nil {
+			return deleted, err
+		}
+	}
+	return deleted, nil
+}
+
+func (m *memoryRepository) DeleteStaleData(ctx context.Context, now, before time.Time) (map[string]int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deleted := map[string]int64{}
+	for id, session := range m.sessions {
+		if session.ExpiresAt.Before(now) {
+			delete(m.sessions, id)
+			deleted["sessions"]++
+		}
+	}
+	for id, imp := range m.imports {
+		if imp.FinishedAt != nil && imp.FinishedAt.Before(before) {
+			delete(m.imports, id)
+			delete(m.importData, id)
+			deleted["imports"]++
+		}
+	}
+	for id, job := range m.jobs {
+		if job.Status == model.JobDead && job.CreatedAt.Before(before) {
+			delete(m.jobs, id)
+			deleted["jobs"]++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"api/internal/model"
+)
+
+const (
+	// mysqlDuplicateEntry is MySQL's ER_DUP_ENTRY error number
+	mysqlDuplicateEntry = 1062
+	// mysqlRowIsReferenced and mysqlNoReferencedRow are MySQL's
+	// ER_ROW_IS_REFERENCED_2 and ER_NO_REFERENCED_ROW_2 error numbers
+	mysqlRowIsReferenced = 1451
+	mysqlNoReferencedRow = 1452
+	// mysqlDeadlock and mysqlLockWaitTimeout are MySQL's ER_LOCK_DEADLOCK
+	// and ER_LOCK_WAIT_TIMEOUT error numbers
+	mysqlDeadlock        = 1213
+	mysqlLockWaitTimeout = 1205
+)
+
+var (
+	// Postgres names unique constraints <table>_<column>_key
+	postgresConstraint = regexp.MustCompile(`^[a-z]+_([a-z_]+)_key$`)
+	// SQLite reports "UNIQUE constraint failed: <table>.<column>"
+	sqliteConstraint = regexp.MustCompile(`UNIQUE constraint failed: \w+\.(\w+)`)
+	// MySQL reports "Duplicate entry '...' for key '[<table>.]<column>'"
+	mysqlConstraint = regexp.MustCompile(`for key '(?:\w+\.)?(\w+)'`)
+)
+
+// uniqueViolation reports whether err is a unique constraint violation in any
+// supported database, along with the column it happened on when it is known
+func uniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return submatch(postgresConstraint, pgErr.ConstraintName), pgErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return submatch(sqliteConstraint, sqliteErr.Error()), code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return submatch(mysqlConstraint, mysqlErr.Message), mysqlErr.Number == mysqlDuplicateEntry
+	}
+	return "", false
+}
+
+// foreignKeyViolation reports whether err is a foreign key violation in any
+// supported database, including the triggers standing in for them on SQLite
+func foreignKeyViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23503"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		code := sqliteErr.Code()
+		return code == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY || code == sqlite3.SQLITE_CONSTRAINT_TRIGGER
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlRowIsReferenced || mysqlErr.Number == mysqlNoReferencedRow
+	}
+	return false
+}
+
+// transientError reports whether err is a failure that may not happen
+// again, after which the whole operation can be run again: serialization
+// failures, deadlocks, lock timeouts and lost connections, including the
+// server shutting down or starting up
+func transientError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "40001", "40P01", "55P03", "57P01", "57P02", "57P03":
+			return true
+		}
+		// class 08 is connection exceptions
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	if pgconn.SafeToRetry(err) {
+		return true
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// the primary code, without the extended bits
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == mysqlDeadlock || mysqlErr.Number == mysqlLockWaitTimeout
+	}
+	return false
+}
+
+// connectionError reports whether err means the database couldn't be
+// reached or didn't answer in time, rather than refusing a query
+func connectionError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "57P01", "57P02", "57P03":
+			return true
+		}
+		return strings.HasPrefix(pgErr.Code, "08")
+	}
+	var netErr net.Error
+	return pgconn.Timeout(err) || pgconn.SafeToRetry(err) || errors.As(err, &netErr)
+}
+
+func submatch(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// translateError turns driver errors into domain errors. Unique violations
+// become a ConflictError on the offending column; on users that is the email
+// column unless the database didn't say, or said its blind index or the
+// canonical email.
+func translateError(err error) error {
+	field, ok := uniqueViolation(err)
+	if !ok {
+		return err
+	}
+	if field == "" || field == "email_index" || field == "canonical_email" {
+		field = "email"
+	}
+	return model.Conflict(field)
+}
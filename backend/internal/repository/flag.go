@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"sort"
+
+	"api/internal/model"
+)
+
+// FeatureFlagRepository persists the overrides of feature flags set through
+// the API
+type FeatureFlagRepository interface {
+	// ListFeatureFlags returns the overrides, by name then organization,
+	// leaving out those of deleted organizations
+	ListFeatureFlags(ctx context.Context) ([]model.FeatureFlag, error)
+	// SetFeatureFlag stores an override, replacing the one of the same flag
+	// and organization
+	SetFeatureFlag(ctx context.Context, flag model.FeatureFlag) error
+	// DeleteFeatureFlag removes the override of a flag for an organization
+	DeleteFeatureFlag(ctx context.Context, name string, orgID int) error
+}
+
+func (s *sqlRepository) ListFeatureFlags(ctx context.Context) ([]model.FeatureFlag, error) {
+	query := "SELECT name, org_id, enabled, updated_at FROM feature_flags WHERE org_id = 0 OR org_id IN (SELECT id FROM organizations) ORDER BY name, org_id"
+	logQuery(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flags := []model.FeatureFlag{}
+	for rows.Next() {
+		var flag model.FeatureFlag
+		if err := rows.Scan(&flag.Name, &flag.OrgID, &flag.Enabled, &flag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		flags = append(flags, flag)
+	}
+	return flags, rows.Err()
+}
+
+func (s *sqlRepository) SetFeatureFlag(ctx context.Context, flag model.FeatureFlag) error {
+	return retry(ctx, s.queries, func() error { return s.setFeatureFlagOnce(ctx, flag) })
+}
+
+func (s *sqlRepository) setFeatureFlagOnce(ctx context.Context, flag model.FeatureFlag) error {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.rollback(ctx, tx)
+
+	query := s.d.rebind("DELETE FROM feature_flags WHERE name = ? AND org_id = ?")
+	logQuery(query, flag.Name, flag.OrgID)
+	if _, err := tx.ExecContext(ctx, query, flag.Name, flag.OrgID); err != nil {
+		return err
+	}
+	query = s.d.rebind("INSERT INTO feature_flags (name, org_id, enabled, updated_at) VALUES (?, ?, ?, ?)")
+	args := []interface{}{flag.Name, flag.OrgID, flag.Enabled, flag.UpdatedAt.UTC()}
+	logQuery(query, args...)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+	return s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) DeleteFeatureFlag(ctx context.Context, name string, orgID int) error {
+	query := s.d.rebind("DELETE FROM feature_flags WHERE name = ? AND org_id = ?")
+	logQuery(query, name, orgID)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, name, orgID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("feature flag override")
+	}
+	return nil
+}
+
+// flagKey identifies the override of a flag for an organization
+type flagKey struct {
+	name  string
+	orgID int
+}
+
+func (m *memoryRepository) ListFeatureFlags(ctx context.Context) ([]model.FeatureFlag, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	flags := []model.FeatureFlag{}
+	for _, flag := range m.featureFlags {
+		if _, ok := m.organizations[flag.OrgID]; ok || flag.OrgID == 0 {
+			flags = append(flags, flag)
+		}
+	}
+	sort.Slice(flags, func(i, j int) bool {
+		if flags[i].Name != flags[j].Name {
+			return flags[i].Name < flags[j].Name
+		}
+		return flags[i].OrgID < flags[j].OrgID
+	})
+	return flags, nil
+}
+
+func (m *memoryRepository) SetFeatureFlag(ctx context.Context, flag model.FeatureFlag) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.featureFlags[flagKey{flag.Name, flag.OrgID}] = flag
+	return nil
+}
+
+func (m *memoryRepository) DeleteFeatureFlag(ctx context.Context, name string, orgID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.featureFlags[flagKey{name, orgID}]; !ok {
+		return model.NotFound("feature flag override")
+	}
+	delete(m.featureFlags, flagKey{name, orgID})
+	return nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// IdempotencyRecord is the stored outcome of a request sent with an Idempotency-Key
+type IdempotencyRecord struct {
+	Key         string
+	Fingerprint string // hash of the method, path and body of the first request
+	Status      int    // zero while the first request is still being handled
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// IdempotencyStore is implemented by repositories that can remember the
+// responses to requests carrying an Idempotency-Key header
+type IdempotencyStore interface {
+	// ReserveIdempotencyKey claims key for a new request. When the key was
+	// already claimed it returns the existing record instead, so the caller
+	// can replay it. Records created before expiredBefore are forgotten.
+	ReserveIdempotencyKey(ctx context.Context, key, fingerprint string, now, expiredBefore time.Time) (*IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the response of the request holding key
+	CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte) error
+	// ReleaseIdempotencyKey forgets key, letting a retry run the request again
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+}
+
+func (s *sqlRepository) ReserveIdempotencyKey(ctx context.Context, key, fingerprint string, now, expiredBefore time.Time) (*IdempotencyRecord, error) {
+	purge := s.d.rebind("DELETE FROM idempotency_keys WHERE created_at < ?")
+	if _, err := s.conn(ctx).ExecContext(ctx, purge, expiredBefore.UTC()); err != nil {
+		return nil, err
+	}
+
+	insert := s.d.rebind("INSERT INTO idempotency_keys (idempotency_key, fingerprint, created_at) VALUES (?, ?, ?)")
+	logQuery(insert, key, fingerprint)
+	_, err := s.conn(ctx).ExecContext(ctx, insert, key, fingerprint, now.UTC())
+	if err == nil {
+		return nil, nil
+	}
+	if _, ok := uniqueViolation(err); !ok {
+		return nil, err
+	}
+
+	// someone sent this key before
+	query := s.d.rebind("SELECT idempotency_key, fingerprint, status, content_type, body, created_at FROM idempotency_keys WHERE idempotency_key = ?")
+	var record IdempotencyRecord
+	err = s.conn(ctx).QueryRowContext(ctx, query, key).Scan(&record.Key, &record.Fingerprint, &record.Status, &record.ContentType, &record.Body, &record.CreatedAt)
+	if err == sql.ErrNoRows {
+		// released in the meantime, try again
+		return s.ReserveIdempotencyKey(ctx, key, fingerprint, now, expiredBefore)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *sqlRepository) CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	query := s.d.rebind("UPDATE idempotency_keys SET status = ?, content_type = ?, body = ? WHERE idempotency_key = ?")
+	_, err := s.conn(ctx).ExecContext(ctx, query, status, contentType, body, key)
+	return err
+}
+
+func (s *sqlRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	query := s.d.rebind("DELETE FROM idempotency_keys WHERE idempotency_key = ?")
+	_, err := s.conn(ctx).ExecContext(ctx, query, key)
+	return err
+}
+
+func (m *memoryRepository) ReserveIdempotencyKey(ctx context.Context, key, fingerprint string, now, expiredBefore time.Time) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for k, record := range m.idempotency {
+		if record.CreatedAt.Before(expiredBefore) {
+			delete(m.idempotency, k)
+		}
+	}
+
+	if record, ok := m.idempotency[key]; ok {
+		copied := *record
+		return &copied, nil
+	}
+	m.idempotency[key] = &IdempotencyRecord{Key: key, Fingerprint: fingerprint, CreatedAt: now}
+	return nil, nil
+}
+
+func (m *memoryRepository) CompleteIdempotencyKey(ctx context.Context, key string, status int, contentType string, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if record, ok := m.idempotency[key]; ok {
+		record.Status = status
+		record.ContentType = contentType
+		record.Body = body
+	}
+	return nil
+}
+
+func (m *memoryRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, key)
+	return nil
+}
@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"api/internal/model"
+)
+
+// ImportRepository persists the CSV imports of users. Like jobs, imports
+// live in the shared schema; contexts scoped to an organization only see
+// its imports.
+type ImportRepository interface {
+	// CreateImport stores a pending import of the CSV data, recording the
+	// organization of the context
+	CreateImport(ctx context.Context, imp model.Import, data []byte) (model.Import, error)
+	GetImport(ctx context.Context, id int) (model.Import, error)
+	// ImportData returns the CSV of an import, nil once the import is done
+	ImportData(ctx context.Context, id int) ([]byte, error)
+	// UpdateImport saves the status, progress and errors of an import,
+	// dropping its CSV once it is done. The import must exist.
+	UpdateImport(ctx context.Context, imp model.Import) error
+}
+
+const importColumns = "id, org_id, status, total, processed, created, failed, errors, last_error, created_at, finished_at"
+
+func scanImport(row scanner) (model.Import, error) {
+	var imp model.Import
+	var orgID sql.NullInt64
+	var errs string
+	var finishedAt sql.NullTime
+	if err := row.Scan(&imp.ID, &orgID, &imp.Status, &imp.Total, &imp.Processed, &imp.Created, &imp.Failed,
+		&errs, &imp.Error, &imp.CreatedAt, &finishedAt); err != nil {
+		return imp, err
+	}
+	if orgID.Valid {
+		id := int(orgID.Int64)
+		imp.OrgID = &id
+	}
+	if finishedAt.Valid {
+		imp.FinishedAt = &finishedAt.Time
+	}
+	return imp, json.Unmarshal([]byte(errs), &imp.Errors)
+}
+
+// importErrors encodes the row errors of an import, as an empty array when there are none
+func importErrors(errs []model.ImportError) (string, error) {
+	if errs == nil {
+		errs = []model.ImportError{}
+	}
+	data, err := json.Marshal(errs)
+	return string(data), err
+}
+
+func (s *sqlRepository) CreateImport(ctx context.Context, imp model.Import, data []byte) (model.Import, error) {
+	imp.Status = model.ImportPending
+	if org, ok := model.OrgFrom(ctx); ok {
+		imp.OrgID = &org
+	}
+	if imp.Errors == nil {
+		imp.Errors = []model.ImportError{}
+	}
+
+	query := "INSERT INTO imports (org_id, status, total, processed, created, failed, errors, last_error, data, created_at) VALUES (?, ?, ?, 0, 0, 0, '[]', '', ?, ?)"
+	args := []interface{}{imp.OrgID, imp.Status, imp.Total, string(data), imp.CreatedAt.UTC()}
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, imp.OrgID, imp.Status, imp.Total, "<csv>", imp.CreatedAt)
+		err = s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&imp.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, imp.OrgID, imp.Status, imp.Total, "<csv>", imp.CreatedAt)
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			imp.ID = int(id)
+		}
+	}
+	return imp, err
+}
+
+func (s *sqlRepository) GetImport(ctx context.Context, id int) (model.Import, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("SELECT " + importColumns + " FROM imports WHERE id = ?" + scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	imp, err := scanImport(s.conn(ctx).QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return imp, model.NotFound("import")
+	}
+	return imp, err
+}
+
+func (s *sqlRepository) ImportData(ctx context.Context, id int) ([]byte, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("SELECT data FROM imports WHERE id = ?" + scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	var data sql.NullString
+	if err := s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&data); err == sql.ErrNoRows {
+		return nil, model.NotFound("import")
+	} else if err != nil || !data.Valid {
+		return nil, err
+	}
+	return []byte(data.String), nil
+}
+
+func (s *sqlRepository) UpdateImport(ctx context.Context, imp model.Import) error {
+	errs, err := importErrors(imp.Errors)
+	if err != nil {
+		return err
+	}
+	var finishedAt interface{}
+	if imp.FinishedAt != nil {
+		finishedAt = imp.FinishedAt.UTC()
+	}
+
+	query := "UPDATE imports SET status = ?, processed = ?, created = ?, failed = ?, errors = ?, last_error = ?, finished_at = ?"
+	if imp.Status == model.ImportDone {
+		query += ", data = NULL"
+	}
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query = s.d.rebind(query + " WHERE id = ?" + scope)
+	args := append([]interface{}{imp.Status, imp.Processed, imp.Created, imp.Failed, errs, imp.Error, finishedAt, imp.ID}, scopeArgs...)
+	logQuery(query, args...)
+	_, err = s.conn(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+// visibleImport reports whether ctx may see the import
+func visibleImport(ctx context.Context, imp model.Import) bool {
+	org, scoped := model.OrgFrom(ctx)
+	return !scoped || (imp.OrgID != nil && *imp.OrgID == org)
+}
+
+func (m *memoryRepository) CreateImport(ctx context.Context, imp model.Import, data []byte) (model.Import, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	imp.Status = model.ImportPending
+	if org, ok := model.OrgFrom(ctx); ok {
+		imp.OrgID = &org
+	}
+	if imp.Errors == nil {
+		imp.Errors = []model.ImportError{}
+	}
+	imp.ID = m.nextImportID
+	m.nextImportID++
+	m.imports[imp.ID] = imp
+	m.importData[imp.ID] = data
+	return imp, nil
+}
+
+func (m *memoryRepository) GetImport(ctx context.Context, id int) (model.Import, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	imp, ok := m.imports[id]
+	if !ok || !visibleImport(ctx, imp) {
+		return model.Import{}, model.NotFound("import")
+	}
+	imp.Errors = append([]model.ImportError{}, imp.Errors...)
+	return imp, nil
+}
+
+func (m *memoryRepository) ImportData(ctx context.Context, id int) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	imp, ok := m.imports[id]
+	if !ok || !visibleImport(ctx, imp) {
+		return nil, model.NotFound("import")
+	}
+	return m.importData[id], nil
+}
+
+func (m *memoryRepository) UpdateImport(ctx context.Context, imp model.Import) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.imports[imp.ID]
+	if !ok || !visibleImport(ctx, stored) {
+		return model.NotFound("import")
+	}
+	stored.Status = imp.Status
+	stored.Processed = imp.Processed
+	stored.Created = imp.Created
+	stored.Failed = imp.Failed
+	stored.Errors = append([]model.ImportError{}, imp.Errors...)
+	stored.Error = imp.Error
+	stored.FinishedAt = imp.FinishedAt
+	m.imports[imp.ID] = stored
+	if imp.Status == model.ImportDone {
+		delete(m.importData, imp.ID)
+	}
+	return nil
+}
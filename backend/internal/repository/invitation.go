@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"api/internal/model"
+)
+
+// InvitationRepository persists the invitations to join an organization.
+// Invitations go away with their organization or role; contexts scoped to
+// an organization only see its invitations.
+type InvitationRepository interface {
+	// ListInvitations returns the invitations, newest first
+	ListInvitations(ctx context.Context) ([]model.Invitation, error)
+	GetInvitation(ctx context.Context, id int) (model.Invitation, error)
+	// CreateInvitation stores a pending invitation, expiring the pending
+	// invitations of the same email to the same organization it replaces
+	CreateInvitation(ctx context.Context, invitation model.Invitation) (model.Invitation, error)
+	// AcceptInvitation records that the user was created from a pending
+	// invitation, failing with model.ErrInvitationAccepted when it isn't pending
+	AcceptInvitation(ctx context.Context, id, userID int, at time.Time) error
+}
+
+const invitationColumns = "id, email, role, org_id, status, expires_at, created_at, accepted_at, user_id"
+
+func scanInvitation(row scanner) (model.Invitation, error) {
+	var invitation model.Invitation
+	var acceptedAt sql.NullTime
+	var userID sql.NullInt64
+	err := row.Scan(&invitation.ID, &invitation.Email, &invitation.Role, &invitation.OrgID, &invitation.Status,
+		&invitation.ExpiresAt, &invitation.CreatedAt, &acceptedAt, &userID)
+	if acceptedAt.Valid {
+		invitation.AcceptedAt = &acceptedAt.Time
+	}
+	if userID.Valid {
+		id := int(userID.Int64)
+		invitation.UserID = &id
+	}
+	return invitation, err
+}
+
+func (s *sqlRepository) ListInvitations(ctx context.Context) ([]model.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM invitations"
+	var args []interface{}
+	if org, ok := model.OrgFrom(ctx); ok {
+		query += " WHERE org_id = ?"
+		args = append(args, org)
+	}
+	query = s.d.rebind(query + " ORDER BY id DESC")
+	logQuery(query, args...)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	invitations := []model.Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, invitation)
+	}
+	return invitations, rows.Err()
+}
+
+func (s *sqlRepository) GetInvitation(ctx context.Context, id int) (model.Invitation, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("SELECT " + invitationColumns + " FROM invitations WHERE id = ?" + scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	invitation, err := scanInvitation(s.conn(ctx).QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return invitation, model.NotFound("invitation")
+	}
+	return invitation, err
+}
+
+func (s *sqlRepository) CreateInvitation(ctx context.Context, invitation model.Invitation) (model.Invitation, error) {
+	return retryValue(ctx, s.queries, func() (model.Invitation, error) { return s.createInvitationOnce(ctx, invitation) })
+}
+
+func (s *sqlRepository) createInvitationOnce(ctx context.Context, invitation model.Invitation) (model.Invitation, error) {
+	invitation.OrgID = ownerOrg(ctx)
+	invitation.Status = model.InvitationPending
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return invitation, err
+	}
+	defer s.rollback(ctx, tx)
+
+	expire := s.d.rebind("UPDATE invitations SET status = ? WHERE org_id = ? AND email = ? AND status = ?")
+	logQuery(expire, model.InvitationExpired, invitation.OrgID, invitation.Email, model.InvitationPending)
+	if _, err := tx.ExecContext(ctx, expire, model.InvitationExpired, invitation.OrgID, invitation.Email, model.InvitationPending); err != nil {
+		return invitation, err
+	}
+
+	query := "INSERT INTO invitations (email, role, org_id, status, expires_at, created_at) VALUES (?, ?, ?, ?, ?, ?)"
+	args := []interface{}{invitation.Email, invitation.Role, invitation.OrgID, invitation.Status, invitation.ExpiresAt.UTC(), invitation.CreatedAt.UTC()}
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&invitation.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			invitation.ID = int(id)
+		}
+	}
+	if err != nil {
+		return invitation, err
+	}
+	return invitation, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) AcceptInvitation(ctx context.Context, id, userID int, at time.Time) error {
+	query := s.d.rebind("UPDATE invitations SET status = ?, accepted_at = ?, user_id = ? WHERE id = ? AND status = ?")
+	args := []interface{}{model.InvitationAccepted, at.UTC(), userID, id, model.InvitationPending}
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.ErrInvitationAccepted
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListInvitations(ctx context.Context) ([]model.Invitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invitations := []model.Invitation{}
+	for _, invitation := range m.invitations {
+		if visible(ctx, invitation.OrgID) {
+			invitations = append(invitations, invitation)
+		}
+	}
+	sort.Slice(invitations, func(i, j int) bool { return invitations[i].ID > invitations[j].ID })
+	return invitations, nil
+}
+
+func (m *memoryRepository) GetInvitation(ctx context.Context, id int) (model.Invitation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	invitation, ok := m.invitations[id]
+	if !ok || !visible(ctx, invitation.OrgID) {
+		return model.Invitation{}, model.NotFound("invitation")
+	}
+	return invitation, nil
+}
+
+func (m *memoryRepository) CreateInvitation(ctx context.Context, invitation model.Invitation) (model.Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invitation.OrgID = ownerOrg(ctx)
+	invitation.Status = model.InvitationPending
+	for id, other := range m.invitations {
+		if other.OrgID == invitation.OrgID && other.Email == invitation.Email && other.Status == model.InvitationPending {
+			other.Status = model.InvitationExpired
+			m.invitations[id] = other
+		}
+	}
+
+	invitation.ID = m.nextInvitationID
+	m.nextInvitationID++
+	m.invitations[invitation.ID] = invitation
+	return invitation, nil
+}
+
+func (m *memoryRepository) AcceptInvitation(ctx context.Context, id, userID int, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	invitation, ok := m.invitations[id]
+	if !ok || invitation.Status != model.InvitationPending {
+		return model.ErrInvitationAccepted
+	}
+	invitation.Status = model.InvitationAccepted
+	invitation.AcceptedAt = &at
+	invitation.UserID = &userID
+	m.invitations[id] = invitation
+	return nil
+}
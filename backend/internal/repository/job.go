@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+
+	"api/internal/model"
+)
+
+// JobRepository persists the background job queue. Jobs live in the shared
+// schema; contexts scoped to an organization only list its jobs.
+//
+// A job is claimed by one worker at a time, for an attempt numbered by its
+// Attempts. CompleteJob and FailJob only apply to the attempt given, so a
+// worker that outlived its lock can't settle a job another worker claimed since.
+type JobRepository interface {
+	// EnqueueJob stores a pending job, recording the organization of the context
+	EnqueueJob(ctx context.Context, job model.Job) (model.Job, error)
+	// ClaimJob marks the next due job as running until lockedUntil, one
+	// attempt more; pending jobs are due from their RunAt and running ones
+	// once their lock expired. It fails with model.ErrNotFound when none is due.
+	ClaimJob(ctx context.Context, now, lockedUntil time.Time) (model.Job, error)
+	// CompleteJob deletes a job whose attempt succeeded
+	CompleteJob(ctx context.Context, id, attempt int) error
+	// FailJob records why an attempt failed and makes the job pending again
+	// at retryAt, or dead when retryAt is nil
+	FailJob(ctx context.Context, id, attempt int, lastError string, retryAt *time.Time) error
+	// ListJobs returns the jobs matching params, newest first
+	ListJobs(ctx context.Context, params model.JobParams) ([]model.Job, error)
+	// RetryJob makes a dead job pending again at at, with its attempts reset;
+	// other jobs are model.ErrNotFound
+	RetryJob(ctx context.Context, id int, at time.Time) (model.Job, error)
+}
+
+const jobColumns = "id, type, payload, org_id, status, attempts, max_attempts, run_at, locked_until, last_error, created_at"
+
+func scanJob(row scanner) (model.Job, error) {
+	var job model.Job
+	var payload string
+	var orgID sql.NullInt64
+	var lockedUntil sql.NullTime
+	err := row.Scan(&job.ID, &job.Type, &payload, &orgID, &job.Status, &job.Attempts, &job.MaxAttempts,
+		&job.RunAt, &lockedUntil, &job.LastError, &job.CreatedAt)
+	job.Payload = []byte(payload)
+	if orgID.Valid {
+		id := int(orgID.Int64)
+		job.OrgID = &id
+	}
+	if lockedUntil.Valid {
+		job.LockedUntil = &lockedUntil.Time
+	}
+	return job, err
+}
+
+// jobDue is the condition of the jobs ClaimJob may claim, taking the time
+// it claims at twice
+const jobDue = "((status = 'pending' AND run_at <= ?) OR (status = 'running' AND locked_until <= ?))"
+
+func (s *sqlRepository) EnqueueJob(ctx context.Context, job model.Job) (model.Job, error) {
+	job.Status = model.JobPending
+	if org, ok := model.OrgFrom(ctx); ok {
+		job.OrgID = &org
+	}
+
+	query := "INSERT INTO jobs (type, payload, org_id, status, attempts, max_attempts, run_at, last_error, created_at) VALUES (?, ?, ?, ?, 0, ?, ?, '', ?)"
+	args := []interface{}{job.Type, string(job.Payload), job.OrgID, job.Status, job.MaxAttempts, job.RunAt.UTC(), job.CreatedAt.UTC()}
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, job.Type, "<payload>", job.OrgID, job.Status, job.MaxAttempts, job.RunAt.UTC(), job.CreatedAt.UTC())
+		err = s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&job.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, job.Type, "<payload>", job.OrgID, job.Status, job.MaxAttempts, job.RunAt.UTC(), job.CreatedAt.UTC())
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			job.ID = int(id)
+		}
+	}
+	return job, err
+}
+
+func (s *sqlRepository) ClaimJob(ctx context.Context, now, lockedUntil time.Time) (model.Job, error) {
+	return retryValue(ctx, s.queries, func() (model.Job, error) { return s.claimJobOnce(ctx, now, lockedUntil) })
+}
+
+func (s *sqlRepository) claimJobOnce(ctx context.Context, now, lockedUntil time.Time) (model.Job, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return model.Job{}, err
+	}
+	defer s.rollback(ctx, tx)
+
+	// Postgres and MySQL let concurrent workers skip the rows another one
+	// is claiming; SQLite has a single writer, and the guarded UPDATE below
+	// catches a job claimed in between
+	pick := "SELECT id FROM jobs WHERE " + jobDue + " ORDER BY run_at, id LIMIT 1"
+	if s.d.name != "sqlite" {
+		pick += " FOR UPDATE SKIP LOCKED"
+	}
+	pick = s.d.rebind(pick)
+	logQuery(pick, now.UTC(), now.UTC())
+
+	var id int
+	if err := tx.QueryRowContext(ctx, pick, now.UTC(), now.UTC()).Scan(&id); err == sql.ErrNoRows {
+		return model.Job{}, model.NotFound("job")
+	} else if err != nil {
+		return model.Job{}, err
+	}
+
+	claim := s.d.rebind("UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_until = ? WHERE id = ? AND " + jobDue)
+	args := []interface{}{lockedUntil.UTC(), id, now.UTC(), now.UTC()}
+	logQuery(claim, args...)
+	result, err := tx.ExecContext(ctx, claim, args...)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return model.Job{}, err
+	} else if n == 0 {
+		return model.Job{}, model.NotFound("job")
+	}
+
+	query := s.d.rebind("SELECT " + jobColumns + " FROM jobs WHERE id = ?")
+	logQuery(query, id)
+	job, err := scanJob(tx.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return job, err
+	}
+	return job, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) CompleteJob(ctx context.Context, id, attempt int) error {
+	query := s.d.rebind("DELETE FROM jobs WHERE id = ? AND attempts = ? AND status = 'running'")
+	logQuery(query, id, attempt)
+	_, err := s.conn(ctx).ExecContext(ctx, query, id, attempt)
+	return err
+}
+
+func (s *sqlRepository) FailJob(ctx context.Context, id, attempt int, lastError string, retryAt *time.Time) error {
+	query := "UPDATE jobs SET status = 'dead', locked_until = NULL, last_error = ? WHERE id = ? AND attempts = ? AND status = 'running'"
+	args := []interface{}{lastError, id, attempt}
+	if retryAt != nil {
+		query = "UPDATE jobs SET status = 'pending', run_at = ?, locked_until = NULL, last_error = ? WHERE id = ? AND attempts = ? AND status = 'running'"
+		args = append([]interface{}{retryAt.UTC()}, args...)
+	}
+	query = s.d.rebind(query)
+	logQuery(query, args...)
+	_, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlRepository) ListJobs(ctx context.Context, params model.JobParams) ([]model.Job, error) {
+	var conditions []string
+	var args []interface{}
+	if org, ok := model.OrgFrom(ctx); ok {
+		conditions = append(conditions, "org_id = ?")
+		args = append(args, org)
+	}
+	if params.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, params.Type)
+	}
+	if params.Before > 0 {
+		conditions = append(conditions, "id < ?")
+		args = append(args, params.Before)
+	}
+
+	query := "SELECT " + jobColumns + " FROM jobs"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query = s.d.rebind(query + " ORDER BY id DESC LIMIT ?")
+	args = append(args, params.Limit)
+	logQuery(query, args...)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []model.Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (s *sqlRepository) RetryJob(ctx context.Context, id int, at time.Time) (model.Job, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE jobs SET status = 'pending', attempts = 0, run_at = ?, locked_until = NULL WHERE id = ? AND status = 'dead'" + scope)
+	args := append([]interface{}{at.UTC(), id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return model.Job{}, err
+	} else if n == 0 {
+		return model.Job{}, model.NotFound("job")
+	}
+
+	get := s.d.rebind("SELECT " + jobColumns + " FROM jobs WHERE id = ?")
+	logQuery(get, id)
+	return scanJob(s.conn(ctx).QueryRowContext(ctx, get, id))
+}
+
+// jobDueAt reports whether ClaimJob may claim the job at now
+func jobDueAt(job model.Job, now time.Time) bool {
+	switch job.Status {
+	case model.JobPending:
+		return !job.RunAt.After(now)
+	case model.JobRunning:
+		return job.LockedUntil != nil && !job.LockedUntil.After(now)
+	}
+	return false
+}
+
+func (m *memoryRepository) EnqueueJob(ctx context.Context, job model.Job) (model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job.Status = model.JobPending
+	job.Attempts = 0
+	if org, ok := model.OrgFrom(ctx); ok {
+		job.OrgID = &org
+	}
+	job.ID = m.nextJobID
+	m.nextJobID++
+	m.jobs[job.ID] = job
+	return job, nil
+}
+
+func (m *memoryRepository) ClaimJob(ctx context.Context, now, lockedUntil time.Time) (model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var next *model.Job
+	for _, job := range m.jobs {
+		if !jobDueAt(job, now) {
+			continue
+		}
+		if next == nil || job.RunAt.Before(next.RunAt) || (job.RunAt.Equal(next.RunAt) && job.ID < next.ID) {
+			job := job
+			next = &job
+		}
+	}
+	if next == nil {
+		return model.Job{}, model.NotFound("job")
+	}
+
+	next.Status = model.JobRunning
+	next.Attempts++
+	next.LockedUntil = &lockedUntil
+	m.jobs[next.ID] = *next
+	return *next, nil
+}
+
+func (m *memoryRepository) CompleteJob(ctx context.Context, id, attempt int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, ok := m.jobs[id]; ok && job.Attempts == attempt && job.Status == model.JobRunning {
+		delete(m.jobs, id)
+	}
+	return nil
+}
+
+func (m *memoryRepository) FailJob(ctx context.Context, id, attempt int, lastError string, retryAt *time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	if !ok || job.Attempts != attempt || job.Status != model.JobRunning {
+		return nil
+	}
+	job.Status = model.JobDead
+	if retryAt != nil {
+		job.Status = model.JobPending
+		job.RunAt = *retryAt
+	}
+	job.LockedUntil = nil
+	job.LastError = lastError
+	m.jobs[id] = job
+	return nil
+}
+
+func (m *memoryRepository) ListJobs(ctx context.Context, params model.JobParams) ([]model.Job, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, scoped := model.OrgFrom(ctx)
+	jobs := []model.Job{}
+	for _, job := range m.jobs {
+		switch {
+		case scoped && (job.OrgID == nil || *job.OrgID != org),
+			params.Status != "" && job.Status != params.Status,
+			params.Type != "" && job.Type != params.Type,
+			params.Before > 0 && job.ID >= params.Before:
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID > jobs[j].ID })
+	if len(jobs) > params.Limit {
+		jobs = jobs[:params.Limit]
+	}
+	return jobs, nil
+}
+
+func (m *memoryRepository) RetryJob(ctx context.Context, id int, at time.Time) (model.Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, ok := m.jobs[id]
+	org, scoped := model.OrgFrom(ctx)
+	if !ok || job.Status != model.JobDead || (scoped && (job.OrgID == nil || *job.OrgID != org)) {
+		return model.Job{}, model.NotFound("job")
+	}
+	job.Status = model.JobPending
+	job.Attempts = 0
+	job.RunAt = at
+	job.LockedUntil = nil
+	m.jobs[id] = job
+	return job, nil
+}
@@ -0,0 +1,582 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"api/internal/model"
+)
+
+// memoryRepository keeps users in a map. It needs no database, which makes
+// it handy for demos, offline development and CI; data is lost on restart.
+type memoryRepository struct {
+	mu          sync.RWMutex
+	users       map[int]model.User
+	nextID      int
+	idempotency map[string]*IdempotencyRecord
+
+	addresses     map[int]model.Address
+	nextAddressID int
+
+	phones      map[int]model.Phone
+	nextPhoneID int
+
+	roles map[string]model.Role
+
+	permissions      map[int]model.Permission
+	nextPermissionID int
+	featureFlags     map[flagKey]model.FeatureFlag
+
+	teams       map[int]model.Team
+	nextTeamID  int
+	teamMembers map[int]map[int]bool // team ID to the IDs of its members
+
+	organizations map[int]model.Organization
+	nextOrgID     int
+
+	invitations      map[int]model.Invitation
+	nextInvitationID int
+	sessions         map[string]model.Session
+	audit            []model.AuditEntry
+	revisions        []model.Revision
+	nextRevisionID   int
+	nextAuditID      int
+	events           []model.Event
+	nextEventID      int64
+	eventLocks       map[int64]time.Time // by event ID, until when the relay holds the event
+
+	notifications      []model.Notification
+	nextNotificationID int64
+	notificationPrefs  map[int]model.NotificationPreferences // by user ID
+
+	jobs      map[int]model.Job
+	nextJobID int
+
+	imports      map[int]model.Import
+	importData   map[int][]byte
+	nextImportID int
+
+	taskRuns map[string]model.TaskRun
+}
+
+func newMemoryRepository() *memoryRepository {
+	return &memoryRepository{
+		users:       map[int]model.User{},
+		nextID:      1,
+		idempotency: map[string]*IdempotencyRecord{},
+
+		addresses:     map[int]model.Address{},
+		nextAddressID: 1,
+
+		phones:      map[int]model.Phone{},
+		nextPhoneID: 1,
+
+		roles: map[string]model.Role{
+			"admin":     {Name: "admin"},
+			"moderator": {Name: "moderator"},
+			"user":      {Name: "user"},
+		},
+
+		permissions:      map[int]model.Permission{},
+		nextPermissionID: 1,
+		featureFlags:     map[flagKey]model.FeatureFlag{},
+
+		teams:       map[int]model.Team{},
+		nextTeamID:  1,
+		teamMembers: map[int]map[int]bool{},
+
+		organizations: map[int]model.Organization{
+			model.DefaultOrgID: {ID: model.DefaultOrgID, Name: "default"},
+		},
+		nextOrgID: model.DefaultOrgID + 1,
+
+		invitations:      map[int]model.Invitation{},
+		nextInvitationID: 1,
+		sessions:         map[string]model.Session{},
+		nextAuditID:      1,
+		nextRevisionID:   1,
+		eventLocks:       map[int64]time.Time{},
+
+		notificationPrefs: map[int]model.NotificationPreferences{},
+
+		jobs:      map[int]model.Job{},
+		nextJobID: 1,
+
+		imports:      map[int]model.Import{},
+		importData:   map[int][]byte{},
+		nextImportID: 1,
+
+		taskRuns: map[string]model.TaskRun{},
+	}
+}
+
+func (m *memoryRepository) List(ctx context.Context, params model.ListParams) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []model.User
+	for _, user := range m.users {
+		if m.matches(ctx, user, params) {
+			users = append(users, user)
+		}
+	}
+
+	// Add sorting, defaulting to the newest users first
+	field, desc := "timestamp", true
+	if sortField, exists := sortColumns[params.Sort]; exists {
+		field, desc = sortField, params.Order == "desc"
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		a, b := users[i], users[j]
+		if desc {
+			a, b = b, a
+		}
+		return lessUser(a, b, field)
+	})
+
+	return page(users, params), nil
+}
+
+func (m *memoryRepository) Suggest(ctx context.Context, prefix string, limit int) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []model.User
+	for _, user := range m.users {
+		if !visible(ctx, user.OrgID) || !m.teamVisible(ctx, user.ID) {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(user.Name), prefix) || strings.HasPrefix(user.Email, prefix) {
+			users = append(users, model.User{ID: user.ID, Name: user.Name, Email: user.Email})
+		}
+	}
+
+	sort.SliceStable(users, func(i, j int) bool {
+		return lessUser(users[i], users[j], "name")
+	})
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	return users, nil
+}
+
+func (m *memoryRepository) Birthdays(ctx context.Context, days []string) ([]model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var users []model.User
+	for _, user := range m.users {
+		if !visible(ctx, user.OrgID) || user.Status != model.UserActive || user.AnonymizedAt != nil {
+			continue
+		}
+		for _, day := range days {
+			if user.Birth.Format("01-02") == day {
+				users = append(users, user)
+				break
+			}
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, nil
+}
+
+func (m *memoryRepository) Count(ctx context.Context, params model.ListParams) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, user := range m.users {
+		if m.matches(ctx, user, params) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryRepository) CountByRole(ctx context.Context, params model.ListParams) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, user := range m.users {
+		if m.matches(ctx, user, params) {
+			counts[user.Role]++
+		}
+	}
+	return counts, nil
+}
+
+// matches applies the organization and team scopes, search and filters of
+// a listing to a user. Searches are case-insensitive like ILIKE; full-text
+// queries are matched the same way.
+func (m *memoryRepository) matches(ctx context.Context, user model.User, params model.ListParams) bool {
+	return visible(ctx, user.OrgID) && m.teamVisible(ctx, user.ID) && containsFold(user, params.Search) && containsFold(user, params.Query) &&
+		params.Filter.Matches(user) && m.inTeams(user.ID, params.Filter.Teams)
+}
+
+// visible reports whether a row of the organization can be seen from ctx,
+// which is true of every row for unscoped contexts
+func visible(ctx context.Context, orgID int) bool {
+	org, ok := model.OrgFrom(ctx)
+	return !ok || org == orgID
+}
+
+// teamVisible reports whether the user can be listed from ctx: by anyone
+// for contexts without a team scope, and else by themselves and teammates
+func (m *memoryRepository) teamVisible(ctx context.Context, userID int) bool {
+	viewer, ok := model.TeamScopeFrom(ctx)
+	if !ok || viewer == userID {
+		return true
+	}
+	for _, members := range m.teamMembers {
+		if members[viewer] && members[userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// inTeams reports whether the user belongs to one of the teams, or teams is empty
+func (m *memoryRepository) inTeams(userID int, teams []int) bool {
+	if len(teams) == 0 {
+		return true
+	}
+	for _, team := range teams {
+		if m.teamMembers[team][userID] {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether the user's name, email or role contains search, ignoring case
+func containsFold(user model.User, search string) bool {
+	search = strings.ToLower(search)
+	return search == "" ||
+		strings.Contains(strings.ToLower(user.Name), search) ||
+		strings.Contains(strings.ToLower(user.Email), search) ||
+		strings.Contains(strings.ToLower(user.Role), search)
+}
+
+// lessUser orders two users by the given column, breaking ties by id
+func lessUser(a, b model.User, field string) bool {
+	switch field {
+	case "name":
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+	case "email":
+		if a.Email != b.Email {
+			return a.Email < b.Email
+		}
+	case "role":
+		if a.Role != b.Role {
+			return a.Role < b.Role
+		}
+	case "age":
+		if a.Age != b.Age {
+			return a.Age < b.Age
+		}
+	case "timestamp":
+		if !a.Timestamp.Equal(b.Timestamp) {
+			return a.Timestamp.Before(b.Timestamp)
+		}
+	}
+	return a.ID < b.ID
+}
+
+// page returns the users of a sorted listing within the limit and offset
+// of params
+func page(users []model.User, params model.ListParams) []model.User {
+	if params.Limit <= 0 {
+		return users
+	}
+	start := min(max(params.Offset, 0), len(users))
+	return users[start:min(start+params.Limit, len(users))]
+}
+
+func (m *memoryRepository) Get(ctx context.Context, id int) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.User{}, model.NotFound("user")
+	}
+	return user, nil
+}
+
+func (m *memoryRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, user := range m.users {
+		if user.Email == email && visible(ctx, user.OrgID) {
+			return user, nil
+		}
+	}
+	return model.User{}, model.NotFound("user")
+}
+
+func (m *memoryRepository) Create(ctx context.Context, user model.User) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkEmail(user, 0); err != nil {
+		return user, err
+	}
+
+	user.ID = m.nextID
+	user.OrgID = ownerOrg(ctx)
+	if user.Status == "" {
+		user.Status = model.UserActive
+	}
+	user.Timestamp = time.Now().UTC()
+	user.Version = 1
+	user.Metadata = model.Metadata{}.Merge(user.Metadata)
+	if err := m.addEvent(ctx, model.EventUserCreated, user, nil); err != nil {
+		return user, err
+	}
+	m.nextID++
+	m.users[user.ID] = user
+	return user, nil
+}
+
+func (m *memoryRepository) Update(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.users[id]
+	if !ok || !visible(ctx, existing.OrgID) {
+		return user, model.NotFound("user")
+	}
+	if existing.Version != user.Version {
+		return user, model.ErrVersionConflict
+	}
+	if err := m.checkEmail(user, id); err != nil {
+		return user, err
+	}
+
+	existing.Name = user.Name
+	existing.Email = user.Email
+	existing.CanonicalEmail = user.CanonicalEmail
+	existing.Role = user.Role
+	existing.Birth = user.Birth
+	existing.Age = user.Age
+	if user.Metadata != nil {
+		existing.Metadata = model.Metadata{}.Merge(user.Metadata)
+	}
+	existing.Version++
+	if err := m.addEvent(ctx, model.EventUserUpdated, existing, rev.Changes); err != nil {
+		return user, err
+	}
+	m.users[id] = existing
+	rev.UserID = id
+	rev.Version = existing.Version
+	m.addRevision(rev)
+	return existing, nil
+}
+
+// checkEmail enforces the unique email and canonical email constraints of
+// the SQL schema, ignoring the user being updated
+func (m *memoryRepository) checkEmail(user model.User, ignoreID int) error {
+	for id, other := range m.users {
+		if id == ignoreID {
+			continue
+		}
+		if other.Email == user.Email || (user.CanonicalEmail != "" && other.CanonicalEmail == user.CanonicalEmail) {
+			return model.ErrDuplicateEmail
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) SetAvatar(ctx context.Context, id int, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.NotFound("user")
+	}
+	user.Avatar = key
+	m.users[id] = user
+	return nil
+}
+
+func (m *memoryRepository) SetStatus(ctx context.Context, id int, status string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.NotFound("user")
+	}
+	user.Status = status
+	m.users[id] = user
+	return nil
+}
+
+func (m *memoryRepository) SetPassword(ctx context.Context, id int, hash string, tokenVersion int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.NotFound("user")
+	}
+	if user.TokenVersion != tokenVersion {
+		return model.ErrVersionConflict
+	}
+	user.PasswordHash = hash
+	user.Status = model.UserActive
+	user.TokenVersion++
+	m.users[id] = user
+	return nil
+}
+
+func (m *memoryRepository) RevokeTokens(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.NotFound("user")
+	}
+	user.TokenVersion++
+	m.users[id] = user
+	return nil
+}
+
+func (m *memoryRepository) Anonymize(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.users[id]
+	if !ok || !visible(ctx, existing.OrgID) {
+		return user, model.NotFound("user")
+	}
+	if existing.AnonymizedAt != nil {
+		return user, model.ErrAlreadyAnonymized
+	}
+	if err := m.checkEmail(user, id); err != nil {
+		return user, err
+	}
+
+	email := existing.Email
+	existing.Name = user.Name
+	existing.Email = user.Email
+	existing.CanonicalEmail = ""
+	existing.Birth = user.Birth
+	existing.Age = user.Age
+	existing.Metadata = model.Metadata{}
+	existing.Avatar = ""
+	existing.PasswordHash = ""
+	anonymizedAt := *user.AnonymizedAt
+	existing.AnonymizedAt = &anonymizedAt
+	existing.Version++
+	existing.TokenVersion++
+	for i, event := range m.events {
+		if event.OrgID == existing.OrgID && event.UserID == id {
+			m.events[i].Payload = json.RawMessage("{}")
+		}
+	}
+	if err := m.addEvent(ctx, model.EventUserAnonymized, existing, rev.Changes); err != nil {
+		return user, err
+	}
+	m.users[id] = existing
+
+	for i, old := range m.revisions {
+		if old.UserID == id {
+			m.revisions[i].Changes = scrubChanges(old.Changes)
+		}
+	}
+	rev.UserID = id
+	rev.Version = existing.Version
+	m.addRevision(rev)
+
+	// like the deletes of the SQL repositories
+	for addressID, address := range m.addresses {
+		if address.UserID == id {
+			delete(m.addresses, addressID)
+		}
+	}
+	for phoneID, phone := range m.phones {
+		if phone.UserID == id {
+			delete(m.phones, phoneID)
+		}
+	}
+	for invitationID, invitation := range m.invitations {
+		if invitation.OrgID == existing.OrgID && ((invitation.UserID != nil && *invitation.UserID == id) || invitation.Email == email) {
+			delete(m.invitations, invitationID)
+		}
+	}
+	return existing, nil
+}
+
+func (m *memoryRepository) Delete(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.users[id]
+	if !ok || !visible(ctx, user.OrgID) {
+		return model.NotFound("user")
+	}
+	if err := m.addEvent(ctx, model.EventUserDeleted, user, nil); err != nil {
+		return err
+	}
+	delete(m.users, id)
+	// like ON DELETE CASCADE
+	for addressID, address := range m.addresses {
+		if address.UserID == id {
+			delete(m.addresses, addressID)
+		}
+	}
+	for phoneID, phone := range m.phones {
+		if phone.UserID == id {
+			delete(m.phones, phoneID)
+		}
+	}
+	for _, members := range m.teamMembers {
+		delete(members, id)
+	}
+	kept := m.revisions[:0:0]
+	for _, rev := range m.revisions {
+		if rev.UserID != id {
+			kept = append(kept, rev)
+		}
+	}
+	m.revisions = kept
+	m.dropNotifications(id)
+	return nil
+}
+
+func (m *memoryRepository) Truncate(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.users = map[int]model.User{}
+	m.nextID = 1
+	m.addresses = map[int]model.Address{}
+	m.nextAddressID = 1
+	m.phones = map[int]model.Phone{}
+	m.nextPhoneID = 1
+	m.sessions = map[string]model.Session{}
+	for team := range m.teamMembers {
+		m.teamMembers[team] = map[int]bool{}
+	}
+	return nil
+}
+
+func (m *memoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *memoryRepository) Close() error {
+	return nil
+}
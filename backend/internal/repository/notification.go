@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"api/internal/model"
+)
+
+// NotificationRepository persists the in-app notifications of users and
+// their notification preferences. Every call but CreateNotification is
+// scoped to the user the notifications belong to, so users never see or
+// read those of others.
+type NotificationRepository interface {
+	// CreateNotification records the notification for notification.UserID
+	// and returns it with its ID; it fails with model.ErrNotFound when the
+	// user doesn't exist
+	CreateNotification(ctx context.Context, notification model.Notification) (model.Notification, error)
+	// ListNotifications returns the notifications of the user matching
+	// params, newest first
+	ListNotifications(ctx context.Context, userID int, params model.NotificationParams) ([]model.Notification, error)
+	// CountUnreadNotifications returns the number of notifications of the
+	// user not read yet
+	CountUnreadNotifications(ctx context.Context, userID int) (int, error)
+	// MarkNotificationRead marks the notification of the user read at, unless
+	// it was read before; it fails with model.ErrNotFound when the user has
+	// no such notification
+	MarkNotificationRead(ctx context.Context, userID int, id int64, at time.Time) error
+	// MarkAllNotificationsRead marks every unread notification of the user
+	// read at and returns how many there were
+	MarkAllNotificationsRead(ctx context.Context, userID int, at time.Time) (int, error)
+	// GetNotificationPreferences returns the notification preferences of
+	// the user, empty ones when they never set any
+	GetNotificationPreferences(ctx context.Context, userID int) (model.NotificationPreferences, error)
+	// SetNotificationPreferences replaces the notification preferences of
+	// the user; it fails with model.ErrNotFound when the user doesn't exist
+	SetNotificationPreferences(ctx context.Context, userID int, prefs model.NotificationPreferences, at time.Time) error
+}
+
+const notificationColumns = "id, user_id, type, title, body, created_at, read_at"
+
+func scanNotification(row scanner) (model.Notification, error) {
+	var notification model.Notification
+	var readAt sql.NullTime
+	if err := row.Scan(&notification.ID, &notification.UserID, &notification.Type, &notification.Title, &notification.Body,
+		&notification.CreatedAt, &readAt); err != nil {
+		return notification, err
+	}
+	if readAt.Valid {
+		notification.ReadAt = &readAt.Time
+	}
+	return notification, nil
+}
+
+func (s *sqlRepository) CreateNotification(ctx context.Context, notification model.Notification) (model.Notification, error) {
+	query := "INSERT INTO notifications (user_id, type, title, body, created_at) VALUES (?, ?, ?, ?, ?)"
+	args := []interface{}{notification.UserID, notification.Type, notification.Title, notification.Body, notification.CreatedAt.UTC()}
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&notification.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, args...); err == nil {
+			notification.ID, err = result.LastInsertId()
+		}
+	}
+	if foreignKeyViolation(err) {
+		return notification, model.NotFound("user")
+	}
+	return notification, err
+}
+
+func (s *sqlRepository) ListNotifications(ctx context.Context, userID int, params model.NotificationParams) ([]model.Notification, error) {
+	query := "SELECT " + notificationColumns + " FROM notifications WHERE user_id = ?"
+	args := []interface{}{userID}
+	if params.Unread {
+		query += " AND read_at IS NULL"
+	}
+	if params.Before > 0 {
+		query += " AND id < ?"
+		args = append(args, params.Before)
+	}
+	query = s.d.rebind(query + " ORDER BY id DESC LIMIT ?")
+	args = append(args, params.Limit)
+	logQuery(query, args...)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []model.Notification{}
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *sqlRepository) CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+	query := s.d.rebind("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read_at IS NULL")
+	logQuery(query, userID)
+	var count int
+	err := s.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+func (s *sqlRepository) MarkNotificationRead(ctx context.Context, userID int, id int64, at time.Time) error {
+	// COALESCE keeps when a notification read before was first read, and
+	// still matches it, unlike a read_at IS NULL condition
+	query := s.d.rebind("UPDATE notifications SET read_at = COALESCE(read_at, ?) WHERE id = ? AND user_id = ?")
+	args := []interface{}{at.UTC(), id, userID}
+	logQuery(query, args...)
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	// MySQL counts the rows changed, not matched, so a notification read
+	// before is told apart from a missing one by looking it up
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+	query = s.d.rebind("SELECT 1 FROM notifications WHERE id = ? AND user_id = ?")
+	logQuery(query, id, userID)
+	var found int
+	if err := s.conn(ctx).QueryRowContext(ctx, query, id, userID).Scan(&found); err == sql.ErrNoRows {
+		return model.NotFound("notification")
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *sqlRepository) MarkAllNotificationsRead(ctx context.Context, userID int, at time.Time) (int, error) {
+	query := s.d.rebind("UPDATE notifications SET read_at = ? WHERE user_id = ? AND read_at IS NULL")
+	logQuery(query, at.UTC(), userID)
+	result, err := s.conn(ctx).ExecContext(ctx, query, at.UTC(), userID)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+func (s *sqlRepository) GetNotificationPreferences(ctx context.Context, userID int) (model.NotificationPreferences, error) {
+	var prefs model.NotificationPreferences
+	query := s.d.rebind("SELECT preferences FROM notification_preferences WHERE user_id = ?")
+	logQuery(query, userID)
+	var data string
+	if err := s.conn(ctx).QueryRowContext(ctx, query, userID).Scan(&data); err == sql.ErrNoRows {
+		return prefs, nil
+	} else if err != nil {
+		return prefs, err
+	}
+	err := json.Unmarshal([]byte(data), &prefs)
+	return prefs, err
+}
+
+func (s *sqlRepository) SetNotificationPreferences(ctx context.Context, userID int, prefs model.NotificationPreferences, at time.Time) error {
+	return retry(ctx, s.queries, func() error { return s.setNotificationPreferencesOnce(ctx, userID, prefs, at) })
+}
+
+func (s *sqlRepository) setNotificationPreferencesOnce(ctx context.Context, userID int, prefs model.NotificationPreferences, at time.Time) error {
+	data, err := json.Marshal(prefs)
+	if err != nil {
+		return err
+	}
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.rollback(ctx, tx)
+
+	query := s.d.rebind("DELETE FROM notification_preferences WHERE user_id = ?")
+	logQuery(query, userID)
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+	query = s.d.rebind("INSERT INTO notification_preferences (user_id, preferences, updated_at) VALUES (?, ?, ?)")
+	args := []interface{}{userID, string(data), at.UTC()}
+	logQuery(query, args...)
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		if foreignKeyViolation(err) {
+			return model.NotFound("user")
+		}
+		return err
+	}
+	return s.commit(ctx, tx)
+}
+
+func (m *memoryRepository) CreateNotification(ctx context.Context, notification model.Notification) (model.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[notification.UserID]; !ok {
+		return notification, model.NotFound("user")
+	}
+	m.nextNotificationID++
+	notification.ID = m.nextNotificationID
+	m.notifications = append(m.notifications, notification)
+	return notification, nil
+}
+
+func (m *memoryRepository) ListNotifications(ctx context.Context, userID int, params model.NotificationParams) ([]model.Notification, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	notifications := []model.Notification{}
+	for i := len(m.notifications) - 1; i >= 0 && len(notifications) < params.Limit; i-- {
+		notification := m.notifications[i]
+		switch {
+		case notification.UserID != userID,
+			params.Unread && notification.ReadAt != nil,
+			params.Before > 0 && notification.ID >= params.Before:
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, nil
+}
+
+func (m *memoryRepository) CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := 0
+	for _, notification := range m.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryRepository) MarkNotificationRead(ctx context.Context, userID int, id int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, notification := range m.notifications {
+		if notification.ID == id && notification.UserID == userID {
+			if notification.ReadAt == nil {
+				m.notifications[i].ReadAt = &at
+			}
+			return nil
+		}
+	}
+	return model.NotFound("notification")
+}
+
+func (m *memoryRepository) MarkAllNotificationsRead(ctx context.Context, userID int, at time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	marked := 0
+	for i, notification := range m.notifications {
+		if notification.UserID == userID && notification.ReadAt == nil {
+			m.notifications[i].ReadAt = &at
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (m *memoryRepository) GetNotificationPreferences(ctx context.Context, userID int) (model.NotificationPreferences, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.notificationPrefs[userID], nil
+}
+
+func (m *memoryRepository) SetNotificationPreferences(ctx context.Context, userID int, prefs model.NotificationPreferences, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[userID]; !ok {
+		return model.NotFound("user")
+	}
+	m.notificationPrefs[userID] = prefs
+	return nil
+}
+
+// dropNotifications deletes the notifications and preferences of the user,
+// like ON DELETE CASCADE; m.mu must be held
+func (m *memoryRepository) dropNotifications(userID int) {
+	delete(m.notificationPrefs, userID)
+	kept := m.notifications[:0:0]
+	for _, notification := range m.notifications {
+		if notification.UserID != userID {
+			kept = append(kept, notification)
+		}
+	}
+	m.notifications = kept
+}
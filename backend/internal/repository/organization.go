@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"api/internal/model"
+)
+
+// OrganizationRepository persists the tenants users and teams belong to.
+// An organization can't be deleted while it still owns users or teams.
+type OrganizationRepository interface {
+	ListOrganizations(ctx context.Context) ([]model.Organization, error)
+	GetOrganization(ctx context.Context, id int) (model.Organization, error)
+	CreateOrganization(ctx context.Context, org model.Organization) (model.Organization, error)
+	UpdateOrganization(ctx context.Context, org model.Organization) (model.Organization, error)
+	DeleteOrganization(ctx context.Context, id int) error
+}
+
+// errDuplicateOrganization is returned when an organization of the same name already exists
+var errDuplicateOrganization = model.Conflict("name")
+
+func (s *sqlRepository) ListOrganizations(ctx context.Context) ([]model.Organization, error) {
+	query := "SELECT id, name FROM organizations ORDER BY name"
+	logQuery(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []model.Organization{}
+	for rows.Next() {
+		var org model.Organization
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+func (s *sqlRepository) GetOrganization(ctx context.Context, id int) (model.Organization, error) {
+	query := s.d.rebind("SELECT id, name FROM organizations WHERE id = ?")
+	logQuery(query, id)
+
+	var org model.Organization
+	err := s.conn(ctx).QueryRowContext(ctx, query, id).Scan(&org.ID, &org.Name)
+	if err == sql.ErrNoRows {
+		return org, model.NotFound("organization")
+	}
+	return org, err
+}
+
+func (s *sqlRepository) CreateOrganization(ctx context.Context, org model.Organization) (model.Organization, error) {
+	query := "INSERT INTO organizations (name) VALUES (?)"
+
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, org.Name)
+		err = s.conn(ctx).QueryRowContext(ctx, query, org.Name).Scan(&org.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, org.Name)
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, org.Name); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			org.ID = int(id)
+		}
+	}
+	if _, ok := uniqueViolation(err); ok {
+		return org, errDuplicateOrganization
+	}
+	return org, err
+}
+
+func (s *sqlRepository) UpdateOrganization(ctx context.Context, org model.Organization) (model.Organization, error) {
+	query := s.d.rebind("UPDATE organizations SET name = ? WHERE id = ?")
+	logQuery(query, org.Name, org.ID)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, org.Name, org.ID)
+	if _, ok := uniqueViolation(err); ok {
+		return org, errDuplicateOrganization
+	}
+	if err != nil {
+		return org, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return org, err
+	}
+	if rowsAffected == 0 {
+		return org, model.NotFound("organization")
+	}
+	return org, nil
+}
+
+func (s *sqlRepository) DeleteOrganization(ctx context.Context, id int) error {
+	query := s.d.rebind("DELETE FROM organizations WHERE id = ?")
+	logQuery(query, id)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, id)
+	if foreignKeyViolation(err) {
+		return model.ErrOrganizationInUse
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("organization")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListOrganizations(ctx context.Context) ([]model.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orgs := make([]model.Organization, 0, len(m.organizations))
+	for _, org := range m.organizations {
+		orgs = append(orgs, org)
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].Name < orgs[j].Name })
+	return orgs, nil
+}
+
+func (m *memoryRepository) GetOrganization(ctx context.Context, id int) (model.Organization, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, ok := m.organizations[id]
+	if !ok {
+		return model.Organization{}, model.NotFound("organization")
+	}
+	return org, nil
+}
+
+func (m *memoryRepository) CreateOrganization(ctx context.Context, org model.Organization) (model.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkOrganization(org); err != nil {
+		return org, err
+	}
+	org.ID = m.nextOrgID
+	m.nextOrgID++
+	m.organizations[org.ID] = org
+	return org, nil
+}
+
+func (m *memoryRepository) UpdateOrganization(ctx context.Context, org model.Organization) (model.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.organizations[org.ID]; !ok {
+		return org, model.NotFound("organization")
+	}
+	if err := m.checkOrganization(org); err != nil {
+		return org, err
+	}
+	m.organizations[org.ID] = org
+	return org, nil
+}
+
+// checkOrganization enforces the unique name constraint of the SQL schema
+func (m *memoryRepository) checkOrganization(org model.Organization) error {
+	for id, other := range m.organizations {
+		if id != org.ID && other.Name == org.Name {
+			return errDuplicateOrganization
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) DeleteOrganization(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.organizations[id]; !ok {
+		return model.NotFound("organization")
+	}
+	for _, user := range m.users {
+		if user.OrgID == id {
+			return model.ErrOrganizationInUse
+		}
+	}
+	for _, team := range m.teams {
+		if team.OrgID == id {
+			return model.ErrOrganizationInUse
+		}
+	}
+	delete(m.organizations, id)
+	for invitationID, invitation := range m.invitations {
+		if invitation.OrgID == id {
+			delete(m.invitations, invitationID)
+		}
+	}
+	return nil
+}
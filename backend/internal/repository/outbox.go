@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"api/internal/model"
+)
+
+// OutboxRepository hands the domain events recorded along with the changes
+// of users to the relay publishing them. Events are published in the order
+// they were recorded: whoever claims the oldest undelivered event holds the
+// whole outbox until it delivered it, or its lock expired.
+type OutboxRepository interface {
+	// ClaimEvents locks up to limit of the oldest undelivered events until
+	// lockedUntil and returns them, oldest first. It returns none while the
+	// oldest one is locked, by another relay or until it may be retried.
+	ClaimEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]model.Event, error)
+	// MarkEventDelivered records that the event was published at
+	MarkEventDelivered(ctx context.Context, id int64, at time.Time) error
+	// FailEvent records a failed publication of the event, which is retried
+	// at retryAt
+	FailEvent(ctx context.Context, id int64, lastError string, retryAt time.Time) error
+	// ListEvents returns the events matching params, oldest first
+	ListEvents(ctx context.Context, params model.EventParams) ([]model.Event, error)
+	// ReplayEvents marks the delivered events with IDs from from to to,
+	// both included, undelivered, for the relay to publish them again, and
+	// returns how many there were
+	ReplayEvents(ctx context.Context, from, to int64) (int, error)
+}
+
+const eventColumns = "id, type, org_id, user_id, payload, created_at, attempts, last_error, delivered_at"
+
+func (s *sqlRepository) scanEvent(row scanner) (model.Event, error) {
+	var event model.Event
+	var payload string
+	var deliveredAt sql.NullTime
+	if err := row.Scan(&event.ID, &event.Type, &event.OrgID, &event.UserID, &payload, &event.CreatedAt,
+		&event.Attempts, &event.LastError, &deliveredAt); err != nil {
+		return event, err
+	}
+	payload, err := s.open(payloadField, payload)
+	if err != nil {
+		return event, err
+	}
+	event.Payload = json.RawMessage(payload)
+	if deliveredAt.Valid {
+		event.DeliveredAt = &deliveredAt.Time
+	}
+	return event, nil
+}
+
+// newEvent returns the event of type typ about the user, attributed to the
+// actor of ctx
+func newEvent(ctx context.Context, typ string, user model.User, changes []model.FieldChange) (model.Event, error) {
+	payload, err := json.Marshal(model.EventPayload{User: &user, Actor: model.ActorFrom(ctx).ID, Changes: changes})
+	if err != nil {
+		return model.Event{}, err
+	}
+	return model.Event{Type: typ, OrgID: user.OrgID, UserID: user.ID, Payload: payload, CreatedAt: time.Now().UTC()}, nil
+}
+
+// addEvent records the event about the user in the outbox within the
+// transaction of the change it describes, so it is published if and only
+// if the change commits
+func (s *sqlRepository) addEvent(ctx context.Context, tx *sql.Tx, typ string, user model.User, changes []model.FieldChange) error {
+	event, err := newEvent(ctx, typ, user, changes)
+	if err != nil {
+		return err
+	}
+	payload, err := s.seal(payloadField, string(event.Payload))
+	if err != nil {
+		return err
+	}
+	query := s.d.rebind("INSERT INTO outbox (type, org_id, user_id, payload, created_at, attempts, last_error) VALUES (?, ?, ?, ?, ?, 0, '')")
+	// the payload repeats the values logged with the change
+	logQuery(query, event.Type, event.OrgID, event.UserID, "<payload>", event.CreatedAt)
+	_, err = tx.ExecContext(ctx, query, event.Type, event.OrgID, event.UserID, payload, event.CreatedAt)
+	return err
+}
+
+// scrubEvents empties the payloads of the events about the user
+func (s *sqlRepository) scrubEvents(ctx context.Context, tx *sql.Tx, orgID, userID int) error {
+	query := s.d.rebind("UPDATE outbox SET payload = '{}' WHERE org_id = ? AND user_id = ?")
+	logQuery(query, orgID, userID)
+	_, err := tx.ExecContext(ctx, query, orgID, userID)
+	return err
+}
+
+func (s *sqlRepository) ClaimEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]model.Event, error) {
+	return retryValue(ctx, s.queries, func() ([]model.Event, error) { return s.claimEventsOnce(ctx, now, lockedUntil, limit) })
+}
+
+func (s *sqlRepository) claimEventsOnce(ctx context.Context, now, lockedUntil time.Time, limit int) ([]model.Event, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.rollback(ctx, tx)
+
+	query := "SELECT id FROM outbox WHERE delivered_at IS NULL ORDER BY id LIMIT 1"
+	logQuery(query)
+	var head int64
+	if err := tx.QueryRowContext(ctx, query).Scan(&head); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// the guard makes relays racing for the head of the outbox claim it once
+	lock := s.d.rebind("UPDATE outbox SET locked_until = ? WHERE id = ? AND delivered_at IS NULL AND (locked_until IS NULL OR locked_until <= ?)")
+	args := []interface{}{lockedUntil.UTC(), head, now.UTC()}
+	logQuery(lock, args...)
+	result, err := tx.ExecContext(ctx, lock, args...)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return nil, err
+	}
+
+	query = s.d.rebind("SELECT " + eventColumns + " FROM outbox WHERE delivered_at IS NULL ORDER BY id LIMIT ?")
+	logQuery(query, limit)
+	rows, err := tx.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	var events []model.Event
+	for rows.Next() {
+		event, err := s.scanEvent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the rest of the batch is locked too, so the event after the head
+	// isn't claimed by another relay once the head is delivered
+	if len(events) > 1 {
+		lock = s.d.rebind("UPDATE outbox SET locked_until = ? WHERE id > ? AND id <= ? AND delivered_at IS NULL")
+		args = []interface{}{lockedUntil.UTC(), head, events[len(events)-1].ID}
+		logQuery(lock, args...)
+		if _, err := tx.ExecContext(ctx, lock, args...); err != nil {
+			return nil, err
+		}
+	}
+	return events, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) MarkEventDelivered(ctx context.Context, id int64, at time.Time) error {
+	query := s.d.rebind("UPDATE outbox SET delivered_at = ?, locked_until = NULL, last_error = '' WHERE id = ?")
+	logQuery(query, at.UTC(), id)
+	_, err := s.conn(ctx).ExecContext(ctx, query, at.UTC(), id)
+	return err
+}
+
+func (s *sqlRepository) FailEvent(ctx context.Context, id int64, lastError string, retryAt time.Time) error {
+	query := s.d.rebind("UPDATE outbox SET attempts = attempts + 1, last_error = ?, locked_until = ? WHERE id = ?")
+	args := []interface{}{lastError, retryAt.UTC(), id}
+	logQuery(query, args...)
+	_, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlRepository) ListEvents(ctx context.Context, params model.EventParams) ([]model.Event, error) {
+	conditions := []string{"id > ?"}
+	args := []interface{}{params.Since}
+	if org, ok := model.OrgFrom(ctx); ok {
+		conditions = append(conditions, "org_id = ?")
+		args = append(args, org)
+	}
+	if params.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, params.Type)
+	}
+
+	query := s.d.rebind("SELECT " + eventColumns + " FROM outbox WHERE " + strings.Join(conditions, " AND ") + " ORDER BY id LIMIT ?")
+	args = append(args, params.Limit)
+	logQuery(query, args...)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.Event{}
+	for rows.Next() {
+		event, err := s.scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+func (s *sqlRepository) ReplayEvents(ctx context.Context, from, to int64) (int, error) {
+	// undelivered events are left alone: they are published anyway, and may
+	// be held by a relay right now
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE outbox SET delivered_at = NULL, locked_until = NULL, attempts = 0, last_error = '' WHERE id >= ? AND id <= ? AND delivered_at IS NOT NULL" + scope)
+	args := append([]interface{}{from, to}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+// addEvent records the event about the user; m.mu must be held
+func (m *memoryRepository) addEvent(ctx context.Context, typ string, user model.User, changes []model.FieldChange) error {
+	event, err := newEvent(ctx, typ, user, changes)
+	if err != nil {
+		return err
+	}
+	m.nextEventID++
+	event.ID = m.nextEventID
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *memoryRepository) ClaimEvents(ctx context.Context, now, lockedUntil time.Time, limit int) ([]model.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var events []model.Event
+	for i, event := range m.events {
+		if event.DeliveredAt != nil {
+			continue
+		}
+		if len(events) == 0 {
+			if locked, ok := m.eventLocks[event.ID]; ok && locked.After(now) {
+				return nil, nil
+			}
+		}
+		m.eventLocks[event.ID] = lockedUntil
+		events = append(events, m.events[i])
+		if len(events) == limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryRepository) MarkEventDelivered(ctx context.Context, id int64, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].DeliveredAt = &at
+			m.events[i].LastError = ""
+			delete(m.eventLocks, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) FailEvent(ctx context.Context, id int64, lastError string, retryAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range m.events {
+		if m.events[i].ID == id {
+			m.events[i].Attempts++
+			m.events[i].LastError = lastError
+			m.eventLocks[id] = retryAt
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListEvents(ctx context.Context, params model.EventParams) ([]model.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	org, scoped := model.OrgFrom(ctx)
+	events := []model.Event{}
+	for _, event := range m.events {
+		switch {
+		case event.ID <= params.Since,
+			scoped && event.OrgID != org,
+			params.Type != "" && event.Type != params.Type:
+			continue
+		}
+		events = append(events, event)
+		if len(events) == params.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+func (m *memoryRepository) ReplayEvents(ctx context.Context, from, to int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	org, scoped := model.OrgFrom(ctx)
+	replayed := 0
+	for i, event := range m.events {
+		if event.ID < from || event.ID > to || event.DeliveredAt == nil || (scoped && event.OrgID != org) {
+			continue
+		}
+		m.events[i].DeliveredAt = nil
+		m.events[i].Attempts = 0
+		m.events[i].LastError = ""
+		delete(m.eventLocks, event.ID)
+		replayed++
+	}
+	return replayed, nil
+}
@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"strings"
+
+	"api/internal/model"
+)
+
+// PermissionRepository persists the policies managed through the API
+type PermissionRepository interface {
+	ListPermissions(ctx context.Context) ([]model.Permission, error)
+	GetPermission(ctx context.Context, id int) (model.Permission, error)
+	CreatePermission(ctx context.Context, permission model.Permission) (model.Permission, error)
+	UpdatePermission(ctx context.Context, permission model.Permission) (model.Permission, error)
+	DeletePermission(ctx context.Context, id int) error
+}
+
+const permissionColumns = "id, effect, principal, action, resource, fields, description"
+
+func scanPermission(row scanner) (model.Permission, error) {
+	var permission model.Permission
+	var fields string
+	err := row.Scan(&permission.ID, &permission.Effect, &permission.Principal, &permission.Action, &permission.Resource, &fields, &permission.Description)
+	permission.Fields = splitFields(fields)
+	return permission, err
+}
+
+// splitFields parses the comma-separated fields column, empty meaning none
+func splitFields(fields string) []string {
+	if fields == "" {
+		return []string{}
+	}
+	return strings.Split(fields, ",")
+}
+
+func (s *sqlRepository) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	query := "SELECT " + permissionColumns + " FROM permissions ORDER BY id"
+	logQuery(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []model.Permission{}
+	for rows.Next() {
+		permission, err := scanPermission(rows)
+		if err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+	return permissions, rows.Err()
+}
+
+func (s *sqlRepository) GetPermission(ctx context.Context, id int) (model.Permission, error) {
+	query := s.d.rebind("SELECT " + permissionColumns + " FROM permissions WHERE id = ?")
+	logQuery(query, id)
+
+	permission, err := scanPermission(s.conn(ctx).QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return permission, model.NotFound("permission")
+	}
+	return permission, err
+}
+
+func (s *sqlRepository) CreatePermission(ctx context.Context, permission model.Permission) (model.Permission, error) {
+	query := "INSERT INTO permissions (effect, principal, action, resource, fields, description) VALUES (?, ?, ?, ?, ?, ?)"
+	args := []interface{}{permission.Effect, permission.Principal, permission.Action, permission.Resource, strings.Join(permission.Fields, ","), permission.Description}
+
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&permission.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			permission.ID = int(id)
+		}
+	}
+	return permission, err
+}
+
+func (s *sqlRepository) UpdatePermission(ctx context.Context, permission model.Permission) (model.Permission, error) {
+	query := s.d.rebind("UPDATE permissions SET effect = ?, principal = ?, action = ?, resource = ?, fields = ?, description = ? WHERE id = ?")
+	args := []interface{}{permission.Effect, permission.Principal, permission.Action, permission.Resource, strings.Join(permission.Fields, ","), permission.Description, permission.ID}
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return permission, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return permission, err
+	}
+	if rowsAffected == 0 {
+		return permission, model.NotFound("permission")
+	}
+	return permission, nil
+}
+
+func (s *sqlRepository) DeletePermission(ctx context.Context, id int) error {
+	query := s.d.rebind("DELETE FROM permissions WHERE id = ?")
+	logQuery(query, id)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("permission")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	permissions := make([]model.Permission, 0, len(m.permissions))
+	for _, permission := range m.permissions {
+		permissions = append(permissions, permission)
+	}
+	sort.Slice(permissions, func(i, j int) bool { return permissions[i].ID < permissions[j].ID })
+	return permissions, nil
+}
+
+func (m *memoryRepository) GetPermission(ctx context.Context, id int) (model.Permission, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	permission, ok := m.permissions[id]
+	if !ok {
+		return model.Permission{}, model.NotFound("permission")
+	}
+	return permission, nil
+}
+
+func (m *memoryRepository) CreatePermission(ctx context.Context, permission model.Permission) (model.Permission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	permission.ID = m.nextPermissionID
+	m.nextPermissionID++
+	m.permissions[permission.ID] = permission
+	return permission, nil
+}
+
+func (m *memoryRepository) UpdatePermission(ctx context.Context, permission model.Permission) (model.Permission, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.permissions[permission.ID]; !ok {
+		return permission, model.NotFound("permission")
+	}
+	m.permissions[permission.ID] = permission
+	return permission, nil
+}
+
+func (m *memoryRepository) DeletePermission(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.permissions[id]; !ok {
+		return model.NotFound("permission")
+	}
+	delete(m.permissions, id)
+	return nil
+}
@@ -0,0 +1,234 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"api/internal/model"
+)
+
+// PhoneRepository persists the phone numbers of users. Like addresses, they
+// are always looked up through their user, and saving a primary number
+// makes the user's other numbers non-primary.
+type PhoneRepository interface {
+	ListPhones(ctx context.Context, userID int) ([]model.Phone, error)
+	CreatePhone(ctx context.Context, phone model.Phone) (model.Phone, error)
+	UpdatePhone(ctx context.Context, phone model.Phone) (model.Phone, error)
+	DeletePhone(ctx context.Context, userID, id int) error
+}
+
+const phoneColumns = "id, user_id, number, is_primary"
+
+// errDuplicatePhone is returned when a user already has the number
+var errDuplicatePhone = model.Conflict("number")
+
+// translatePhoneError reports unique violations as duplicate numbers; the
+// primary flag can't cause them as other numbers are cleared first
+func translatePhoneError(err error) error {
+	if _, ok := uniqueViolation(err); ok {
+		return errDuplicatePhone
+	}
+	return err
+}
+
+func (s *sqlRepository) ListPhones(ctx context.Context, userID int) ([]model.Phone, error) {
+	query := s.d.rebind("SELECT " + phoneColumns + " FROM phones WHERE user_id = ? ORDER BY is_primary DESC, id")
+	logQuery(query, userID)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	phones := []model.Phone{}
+	for rows.Next() {
+		var phone model.Phone
+		if err := rows.Scan(&phone.ID, &phone.UserID, &phone.Number, &phone.IsPrimary); err != nil {
+			return nil, err
+		}
+		phones = append(phones, phone)
+	}
+	return phones, rows.Err()
+}
+
+func (s *sqlRepository) CreatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	return retryValue(ctx, s.queries, func() (model.Phone, error) { return s.createPhoneOnce(ctx, phone) })
+}
+
+func (s *sqlRepository) createPhoneOnce(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return phone, err
+	}
+	defer s.rollback(ctx, tx)
+
+	if phone.IsPrimary {
+		if err := s.clearPrimaryPhone(ctx, tx, phone.UserID, 0); err != nil {
+			return phone, err
+		}
+	}
+
+	query := "INSERT INTO phones (user_id, number, is_primary) VALUES (?, ?, ?)"
+	args := []interface{}{phone.UserID, phone.Number, phone.IsPrimary}
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = tx.QueryRowContext(ctx, query, args...).Scan(&phone.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = tx.ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			phone.ID = int(id)
+		}
+	}
+	if err != nil {
+		return phone, translatePhoneError(err)
+	}
+	return phone, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) UpdatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	return retryValue(ctx, s.queries, func() (model.Phone, error) { return s.updatePhoneOnce(ctx, phone) })
+}
+
+func (s *sqlRepository) updatePhoneOnce(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return phone, err
+	}
+	defer s.rollback(ctx, tx)
+
+	if phone.IsPrimary {
+		if err := s.clearPrimaryPhone(ctx, tx, phone.UserID, phone.ID); err != nil {
+			return phone, err
+		}
+	}
+
+	query := s.d.rebind("UPDATE phones SET number = ?, is_primary = ? WHERE id = ? AND user_id = ?")
+	args := []interface{}{phone.Number, phone.IsPrimary, phone.ID, phone.UserID}
+	logQuery(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return phone, translatePhoneError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return phone, err
+	}
+	if rowsAffected == 0 {
+		return phone, model.NotFound("phone")
+	}
+	return phone, s.commit(ctx, tx)
+}
+
+// clearPrimaryPhone makes every number of the user but exceptID non-primary
+func (s *sqlRepository) clearPrimaryPhone(ctx context.Context, tx *sql.Tx, userID, exceptID int) error {
+	query := s.d.rebind("UPDATE phones SET is_primary = ? WHERE user_id = ? AND id <> ? AND is_primary = ?")
+	_, err := tx.ExecContext(ctx, query, false, userID, exceptID, true)
+	return err
+}
+
+func (s *sqlRepository) DeletePhone(ctx context.Context, userID, id int) error {
+	query := s.d.rebind("DELETE FROM phones WHERE id = ? AND user_id = ?")
+	logQuery(query, id, userID)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("phone")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListPhones(ctx context.Context, userID int) ([]model.Phone, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	phones := []model.Phone{}
+	for _, phone := range m.phones {
+		if phone.UserID == userID {
+			phones = append(phones, phone)
+		}
+	}
+	sort.Slice(phones, func(i, j int) bool {
+		if phones[i].IsPrimary != phones[j].IsPrimary {
+			return phones[i].IsPrimary
+		}
+		return phones[i].ID < phones[j].ID
+	})
+	return phones, nil
+}
+
+func (m *memoryRepository) CreatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[phone.UserID]; !ok {
+		return phone, model.NotFound("user")
+	}
+	if err := m.checkPhone(phone); err != nil {
+		return phone, err
+	}
+	phone.ID = m.nextPhoneID
+	m.nextPhoneID++
+	m.savePhone(phone)
+	return phone, nil
+}
+
+func (m *memoryRepository) UpdatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.phones[phone.ID]; !ok || existing.UserID != phone.UserID {
+		return phone, model.NotFound("phone")
+	}
+	if err := m.checkPhone(phone); err != nil {
+		return phone, err
+	}
+	m.savePhone(phone)
+	return phone, nil
+}
+
+// checkPhone enforces the unique (user_id, number) constraint of the SQL schema
+func (m *memoryRepository) checkPhone(phone model.Phone) error {
+	for id, other := range m.phones {
+		if id != phone.ID && other.UserID == phone.UserID && other.Number == phone.Number {
+			return errDuplicatePhone
+		}
+	}
+	return nil
+}
+
+// savePhone stores phone, keeping it the only primary number of its user
+func (m *memoryRepository) savePhone(phone model.Phone) {
+	if phone.IsPrimary {
+		for id, other := range m.phones {
+			if other.UserID == phone.UserID && other.IsPrimary {
+				other.IsPrimary = false
+				m.phones[id] = other
+			}
+		}
+	}
+	m.phones[phone.ID] = phone
+}
+
+func (m *memoryRepository) DeletePhone(ctx context.Context, userID, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if phone, ok := m.phones[id]; !ok || phone.UserID != userID {
+		return model.NotFound("phone")
+	}
+	delete(m.phones, id)
+	return nil
+}
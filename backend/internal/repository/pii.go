@@ -0,0 +1,222 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"api/internal/model"
+	"api/internal/pii"
+)
+
+// emailField names the email column to the pii.Cipher
+const emailField = "users.email"
+
+// changesField and payloadField name the columns copying the personal data
+// of users, the changes of revisions and the payloads of events, which are
+// encrypted whole
+const (
+	changesField = "user_revisions.changes"
+	payloadField = "outbox.payload"
+)
+
+// PIIEncrypter is implemented by repositories encrypting personal data
+type PIIEncrypter interface {
+	// EncryptPII encrypts, batchSize rows at a time, the emails of users,
+	// the changes of revisions and the payloads of events stored in
+	// plaintext or under a data key other than the current one, and
+	// returns how many values it encrypted
+	EncryptPII(ctx context.Context, batchSize int) (int, error)
+}
+
+// seal returns the value of the field as it is stored, encrypted when s.pii
+// is set
+func (s *sqlRepository) seal(field, value string) (string, error) {
+	if s.pii == nil {
+		return value, nil
+	}
+	return s.pii.Encrypt(field, value)
+}
+
+// open returns the value of the field loaded from the database, decrypted
+func (s *sqlRepository) open(field, value string) (string, error) {
+	if s.pii == nil || !pii.Encrypted(value) {
+		return value, nil
+	}
+	return s.pii.Decrypt(field, value)
+}
+
+// sealEmail returns the email as it is stored, encrypted when s.pii is set,
+// and its blind index, nil without encryption
+func (s *sqlRepository) sealEmail(email string) (string, interface{}, error) {
+	if s.pii == nil {
+		return email, nil, nil
+	}
+	sealed, err := s.pii.Encrypt(emailField, email)
+	if err != nil {
+		return "", nil, err
+	}
+	return sealed, s.pii.Index(emailField, email), nil
+}
+
+// checkPlainEmail returns model.ErrDuplicateEmail when a user other than
+// the one with id still has the email in plaintext, which the unique blind
+// index can't see until EncryptPII encrypts it
+func (s *sqlRepository) checkPlainEmail(ctx context.Context, tx *sql.Tx, email string, id int) error {
+	if s.pii == nil {
+		return nil
+	}
+	query := s.d.rebind("SELECT id FROM users WHERE email = ? AND id <> ?")
+	logQuery(query, id)
+	var other int
+	err := tx.QueryRowContext(ctx, query, email, id).Scan(&other)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return model.ErrDuplicateEmail
+}
+
+// openEmail decrypts the email of the user loaded from the database
+func (s *sqlRepository) openEmail(user *model.User) error {
+	if s.pii == nil || !pii.Encrypted(user.Email) {
+		return nil
+	}
+	email, err := s.pii.Decrypt(emailField, user.Email)
+	if err != nil {
+		return err
+	}
+	user.Email = email
+	return nil
+}
+
+func (s *sqlRepository) EncryptPII(ctx context.Context, batchSize int) (int, error) {
+	if s.pii == nil {
+		return 0, nil
+	}
+	encrypted, err := s.encryptEmails(ctx, batchSize)
+	if err != nil {
+		return encrypted, err
+	}
+	n, err := s.encryptColumn(ctx, "user_revisions", "changes", changesField, batchSize)
+	encrypted += n
+	if err != nil || s.tenant {
+		// the outbox of the tenants is the shared one
+		return encrypted, err
+	}
+	n, err = s.encryptColumn(ctx, "outbox", "payload", payloadField, batchSize)
+	return encrypted + n, err
+}
+
+// encryptEmails encrypts the emails of users for EncryptPII, updating their
+// blind index along
+func (s *sqlRepository) encryptEmails(ctx context.Context, batchSize int) (int, error) {
+	current := s.pii.Current()
+	encrypted := 0
+	for lastID := 0; ; {
+		// substr rather than LIKE, whose wildcards and escaping differ
+		query := s.d.rebind("SELECT id, email FROM users WHERE substr(email, 1, ?) <> ? AND id > ? ORDER BY id LIMIT ?")
+		logQuery(query, len(current), current, lastID, batchSize)
+		rows, err := s.conn(ctx).QueryContext(ctx, query, len(current), current, lastID, batchSize)
+		if err != nil {
+			return encrypted, err
+		}
+		var users []model.User
+		for rows.Next() {
+			var user model.User
+			if err := rows.Scan(&user.ID, &user.Email); err != nil {
+				rows.Close()
+				return encrypted, err
+			}
+			users = append(users, user)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return encrypted, err
+		}
+		if len(users) == 0 {
+			return encrypted, nil
+		}
+
+		for _, user := range users {
+			lastID = user.ID
+			stored := user.Email
+			if err := s.openEmail(&user); err != nil {
+				return encrypted, err
+			}
+			email, emailIndex, err := s.sealEmail(user.Email)
+			if err != nil {
+				return encrypted, err
+			}
+			// the email condition skips the users whose email changed meanwhile,
+			// already encrypted by the change
+			query := s.d.rebind("UPDATE users SET email = ?, email_index = ? WHERE id = ? AND email = ?")
+			logQuery(query, user.ID)
+			result, err := s.conn(ctx).ExecContext(ctx, query, email, emailIndex, user.ID, stored)
+			if err != nil {
+				return encrypted, translateError(err)
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return encrypted, err
+			} else if n > 0 {
+				encrypted++
+			}
+		}
+	}
+}
+
+// encryptColumn encrypts the values of the column of table for EncryptPII,
+// the field naming it to the pii.Cipher
+func (s *sqlRepository) encryptColumn(ctx context.Context, table, column, field string, batchSize int) (int, error) {
+	current := s.pii.Current()
+	encrypted := 0
+	for lastID := int64(0); ; {
+		query := s.d.rebind("SELECT id, " + column + " FROM " + table + " WHERE substr(" + column + ", 1, ?) <> ? AND id > ? ORDER BY id LIMIT ?")
+		logQuery(query, len(current), current, lastID, batchSize)
+		rows, err := s.conn(ctx).QueryContext(ctx, query, len(current), current, lastID, batchSize)
+		if err != nil {
+			return encrypted, err
+		}
+		ids, values := []int64{}, []string{}
+		for rows.Next() {
+			var id int64
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				return encrypted, err
+			}
+			ids, values = append(ids, id), append(values, value)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return encrypted, err
+		}
+		if len(ids) == 0 {
+			return encrypted, nil
+		}
+
+		for i, id := range ids {
+			lastID = id
+			value, err := s.open(field, values[i])
+			if err != nil {
+				return encrypted, err
+			}
+			if value, err = s.seal(field, value); err != nil {
+				return encrypted, err
+			}
+			// the condition skips the values changed meanwhile, already
+			// encrypted by the change
+			query := s.d.rebind("UPDATE " + table + " SET " + column + " = ? WHERE id = ? AND " + column + " = ?")
+			logQuery(query, id)
+			result, err := s.conn(ctx).ExecContext(ctx, query, value, id, values[i])
+			if err != nil {
+				return encrypted, err
+			}
+			if n, err := result.RowsAffected(); err != nil {
+				return encrypted, err
+			} else if n > 0 {
+				encrypted++
+			}
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"api/internal/model"
+	"api/internal/pii"
+)
+
+// openSQLite opens a migrated SQLite repository in a temporary directory,
+// encrypting the emails with cipher when set
+func openSQLite(tb testing.TB, cipher *pii.Cipher) *sqlRepository {
+	tb.Helper()
+	// the repository logs every query it runs
+	output := log.Writer()
+	log.SetOutput(io.Discard)
+	tb.Cleanup(func() { log.SetOutput(output) })
+
+	repo, err := newSQLRepository(sqliteDialect, filepath.Join(tb.TempDir(), "test.db"), "", PoolConfig{}, QueryConfig{}, cipher)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { repo.Close() })
+	migrator, err := repo.Migrator()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		tb.Fatal(err)
+	}
+	return repo
+}
+
+// newTestCipher returns a cipher under a new data key and index key
+func newTestCipher(t *testing.T) *pii.Cipher {
+	t.Helper()
+	ctx := context.Background()
+	wrapper, err := pii.NewLocal(make([]byte, pii.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataKey, err := pii.GenerateKey(ctx, wrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexKey, err := pii.GenerateKey(ctx, wrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := pii.NewCipher(ctx, wrapper, []pii.DataKey{{ID: "test", Wrapped: dataKey}}, indexKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestEncryptedAtRest(t *testing.T) {
+	repo := openSQLite(t, newTestCipher(t))
+	ctx := context.Background()
+	user, err := repo.Create(ctx, model.User{Name: "Ann", Email: "ann@example.com", Role: "user", Metadata: model.Metadata{}, Birth: model.NewDate(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := user
+	changed.Email = "ann@example.org"
+	if _, err := repo.Update(ctx, user.ID, changed, model.Revision{UserID: user.ID, Changes: user.Changes(changed), CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+	}{
+		{"users", "SELECT email FROM users"},
+		{"revisions", "SELECT changes FROM user_revisions"},
+		{"outbox", "SELECT payload FROM outbox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := repo.db.QueryContext(ctx, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rows.Close()
+			count := 0
+			for rows.Next() {
+				var value string
+				if err := rows.Scan(&value); err != nil {
+					t.Fatal(err)
+				}
+				if !pii.Encrypted(value) || strings.Contains(value, "ann@") {
+					t.Errorf("stored %q, want it encrypted", value)
+				}
+				count++
+			}
+			if err := rows.Err(); err != nil {
+				t.Fatal(err)
+			}
+			if count == 0 {
+				t.Fatal("nothing stored")
+			}
+		})
+	}
+
+	t.Run("read back", func(t *testing.T) {
+		got, err := repo.Get(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Email != "ann@example.org" {
+			t.Errorf("got email %q, want it decrypted", got.Email)
+		}
+		revisions, err := repo.ListRevisions(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(revisions) != 1 || len(revisions[0].Changes) == 0 {
+			t.Fatalf("got revisions %+v, want the email change", revisions)
+		}
+	})
+
+	t.Run("sort by email", func(t *testing.T) {
+		if _, err := repo.List(ctx, model.ListParams{Sort: "email", Limit: 10}); !errors.Is(err, model.ErrEncryptedSort) {
+			t.Fatalf("got %v, want ErrEncryptedSort", err)
+		}
+	})
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"api/internal/model"
+)
+
+// The hot queries, run through prepared statements: getting a user by id,
+// creating, updating and deleting one. Their scope is the org condition of
+// their context, see orgCondition.
+func (s *sqlRepository) getUserQuery(scope string) string {
+	return s.d.rebind("SELECT " + userColumns + " FROM users WHERE id = ?" + scope)
+}
+
+func (s *sqlRepository) createUserQuery() string {
+	query := "INSERT INTO users (" + insertColumns + ") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	if s.d.returning {
+		query += " RETURNING id, timestamp, version"
+	}
+	return s.d.rebind(query)
+}
+
+func (s *sqlRepository) updateUserQuery(scope string) string {
+	return s.d.rebind("UPDATE users SET name = ?, email = ?, email_index = ?, canonical_email = ?, role = ?, birth = ?, age = ?, metadata = COALESCE(?, metadata), version = version + 1 WHERE id = ? AND version = ?" + scope)
+}
+
+func (s *sqlRepository) deleteUserQuery(scope string) string {
+	return s.d.rebind("DELETE FROM users WHERE id = ?" + scope)
+}
+
+// hotQueries lists the hot queries, for requests scoped to an organization
+// and not
+func (s *sqlRepository) hotQueries() []string {
+	scoped, _ := orgCondition(model.WithOrg(context.Background(), model.DefaultOrgID), "org_id")
+	queries := []string{s.createUserQuery()}
+	for _, scope := range []string{"", scoped} {
+		queries = append(queries, s.getUserQuery(scope), s.updateUserQuery(scope), s.deleteUserQuery(scope))
+	}
+	return queries
+}
+
+// prepareStmts prepares the hot queries when the repository is opened.
+// Postgres is left out: pgx prepares the queries on each of its connections
+// the first time they run there and caches them, which database/sql, which
+// keeps none of them idle, couldn't do, and statements prepared as the
+// connections open would break once migrations change the users table.
+// Before the first migrations MySQL has no table to prepare them for; they
+// are prepared when first run then, see prepared. The SQLite driver only
+// compiles statements as they run, so there they save the bookkeeping of
+// database/sql alone.
+func (s *sqlRepository) prepareStmts(ctx context.Context) {
+	if s.pool != nil {
+		return
+	}
+
+	for _, query := range s.hotQueries() {
+		stmt, err := s.db.PrepareContext(ctx, query)
+		if err != nil {
+			// not stored as a failure, the queries may prepare once migrated
+			log.Printf("Preparing the queries when first run instead, as %v", err)
+			return
+		}
+		s.storeStmt(query, stmt)
+	}
+}
+
+// prepared returns the prepared statement of a hot query, preparing it
+// when prepareStmts couldn't. Postgres gets nil, see prepareStmts, and so
+// do queries failing to prepare, which are run unprepared then; the
+// failure is stored, so they aren't prepared again on every call.
+func (s *sqlRepository) prepared(ctx context.Context, query string) *sql.Stmt {
+	if s.pool != nil {
+		return nil
+	}
+
+	s.stmtsMu.Lock()
+	stmt, ok := s.stmts[query]
+	s.stmtsMu.Unlock()
+	if ok {
+		return stmt
+	}
+
+	// prepared outside of the lock, which would otherwise hold up every
+	// hot query for the round trip
+	stmt, err := s.db.PrepareContext(ctx, query)
+	if err != nil {
+		if ctx.Err() != nil {
+			// the request gave up, not the query
+			return nil
+		}
+		log.Printf("Failed to prepare %s, running it unprepared: %v", query, err)
+	}
+	return s.storeStmt(query, stmt)
+}
+
+// storeStmt stores the prepared statement of a query, nil when it failed
+// to prepare, unless another call stored one first, which is returned
+// instead and stmt closed
+func (s *sqlRepository) storeStmt(query string, stmt *sql.Stmt) *sql.Stmt {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	if stored, ok := s.stmts[query]; ok && (stored != nil || stmt == nil) {
+		if stmt != nil {
+			stmt.Close()
+		}
+		return stored
+	}
+	if s.stmts == nil {
+		s.stmts = map[string]*sql.Stmt{}
+	}
+	s.stmts[query] = stmt
+	return stmt
+}
+
+// queryRowPrepared runs a hot query returning a row through its prepared
+// statement, within tx when set, or else the one of WithTx
+func (s *sqlRepository) queryRowPrepared(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) *sql.Row {
+	if tx == nil {
+		tx = s.txFrom(ctx)
+	}
+	stmt := s.prepared(ctx, query)
+	switch {
+	case stmt != nil && tx != nil:
+		return tx.StmtContext(ctx, stmt).QueryRowContext(ctx, args...)
+	case stmt != nil:
+		return stmt.QueryRowContext(ctx, args...)
+	case tx != nil:
+		return tx.QueryRowContext(ctx, query, args...)
+	default:
+		return s.db.QueryRowContext(ctx, query, args...)
+	}
+}
+
+// execPrepared runs a hot statement through its prepared statement, within
+// tx when set, or else the one of WithTx
+func (s *sqlRepository) execPrepared(ctx context.Context, tx *sql.Tx, query string, args ...interface{}) (sql.Result, error) {
+	if tx == nil {
+		tx = s.txFrom(ctx)
+	}
+	stmt := s.prepared(ctx, query)
+	switch {
+	case stmt != nil && tx != nil:
+		return tx.StmtContext(ctx, stmt).ExecContext(ctx, args...)
+	case stmt != nil:
+		return stmt.ExecContext(ctx, args...)
+	case tx != nil:
+		return tx.ExecContext(ctx, query, args...)
+	default:
+		return s.db.ExecContext(ctx, query, args...)
+	}
+}
+
+// closeStmts closes the prepared statements
+func (s *sqlRepository) closeStmts() {
+	s.stmtsMu.Lock()
+	defer s.stmtsMu.Unlock()
+	for _, stmt := range s.stmts {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	s.stmts = nil
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"api/internal/model"
+)
+
+// BenchmarkGet compares getting a user through its prepared statement, as
+// Get does, with running the same query unprepared, on SQLite
+func BenchmarkGet(b *testing.B) {
+	// Get logs every query it runs
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	repo, err := newSQLRepository(sqliteDialect, filepath.Join(b.TempDir(), "bench.db"), "", PoolConfig{}, QueryConfig{}, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer repo.Close()
+	migrator, err := repo.Migrator()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		b.Fatal(err)
+	}
+	// the statements are prepared again now that the table exists
+	repo.prepareStmts(context.Background())
+
+	ctx := context.Background()
+	user, err := repo.Create(ctx, model.User{Name: "Ann", Email: "ann@example.com", Role: "user", Metadata: model.Metadata{}, Birth: model.NewDate(time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC))})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("prepared", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.Get(ctx, user.ID); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("unprepared", func(b *testing.B) {
+		query := repo.getUserQuery("")
+		for i := 0; i < b.N; i++ {
+			if _, err := repo.scanUser(repo.db.QueryRowContext(ctx, query, user.ID)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestPrepared(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+
+	repo, err := newSQLRepository(sqliteDialect, filepath.Join(t.TempDir(), "test.db"), "", PoolConfig{}, QueryConfig{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	ctx := context.Background()
+
+	t.Run("concurrent", func(t *testing.T) {
+		query := "SELECT 1"
+		stmts := make([]*sql.Stmt, 8)
+		var wg sync.WaitGroup
+		for i := range stmts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				stmts[i] = repo.prepared(ctx, query)
+			}()
+		}
+		wg.Wait()
+		for _, stmt := range stmts {
+			if stmt == nil || stmt != stmts[0] {
+				t.Fatalf("got statements %v, want the same one for every call", stmts)
+			}
+		}
+	})
+
+	t.Run("failed", func(t *testing.T) {
+		// the SQLite driver only compiles statements as they run, but
+		// can't prepare any once closed
+		closed, err := newSQLRepository(sqliteDialect, filepath.Join(t.TempDir(), "closed.db"), "", PoolConfig{}, QueryConfig{}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		closed.db.Close()
+		query := "SELECT 1"
+		if stmt := closed.prepared(ctx, query); stmt != nil {
+			t.Fatal("prepared a query on a closed database")
+		}
+		closed.stmtsMu.Lock()
+		stmt, ok := closed.stmts[query]
+		closed.stmtsMu.Unlock()
+		if !ok || stmt != nil {
+			t.Fatalf("got %v, %v stored, want the failure", stmt, ok)
+		}
+	})
+}
@@ -0,0 +1,429 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"api/internal/breaker"
+	"api/internal/metrics"
+)
+
+// QueryConfig tunes how queries are run and watched
+type QueryConfig struct {
+	// SlowThreshold is the duration past which queries are logged as slow;
+	// zero logs none
+	SlowThreshold time.Duration
+	// ReadTimeout, WriteTimeout and ExportTimeout bound each query, by
+	// whether it reads, writes or is part of an export, see WithExport;
+	// zero leaves it to the deadline of the caller
+	ReadTimeout   time.Duration
+	WriteTimeout  time.Duration
+	ExportTimeout time.Duration
+	// MaxAttempts bounds the attempts at an operation failing with a
+	// transient error, see retry; 1 or less runs it once
+	MaxAttempts int
+	// RetryBackoff is the delay before the second attempt, doubled before
+	// each next one up to RetryMaxBackoff
+	RetryBackoff    time.Duration
+	RetryMaxBackoff time.Duration
+	// Breaker tunes the circuit breaker rejecting queries while the
+	// database is down; a zero FailureRate turns it off
+	Breaker breaker.Options
+}
+
+// logArgs is whether logQuery logs the arguments of the queries
+var logArgs atomic.Bool
+
+// SetLogQueryArgs sets whether the queries run are logged with their
+// arguments, which hold personal data and secrets, for debugging; only
+// their text is otherwise
+func SetLogQueryArgs(enabled bool) {
+	logArgs.Store(enabled)
+}
+
+// logQuery logs a query about to run, with its arguments only when
+// SetLogQueryArgs allows
+func logQuery(query string, args ...interface{}) {
+	if logArgs.Load() && len(args) > 0 {
+		log.Printf("Query: %s, Args: %v", query, args)
+		return
+	}
+	log.Printf("Query: %s", query)
+}
+
+// queryObserver times the queries run through the connections it wraps,
+// logging the slow ones, bounds them by their timeouts and rejects them
+// while the database is down. The repositories of the tenant schemas share
+// the one of the shared schema, so the counts cover every pool.
+type queryObserver struct {
+	cfg QueryConfig
+	// breaker is nil when turned off, see guard
+	breaker *breaker.Breaker
+
+	queries atomic.Int64
+	slow    atomic.Int64
+}
+
+// observe records a query that took elapsed. ErrSkip isn't a run but the
+// driver asking database/sql to prepare the statement instead, which is
+// observed then.
+func (o *queryObserver) observe(query string, args []driver.NamedValue, elapsed time.Duration, err error) {
+	if errors.Is(err, driver.ErrSkip) {
+		return
+	}
+	o.queries.Add(1)
+	if o.cfg.SlowThreshold > 0 && elapsed >= o.cfg.SlowThreshold {
+		o.slow.Add(1)
+		// on one line, so migrations don't spread over many entries
+		log.Printf("Slow query (%s): %s, Args: %v", elapsed, strings.Join(strings.Fields(query), " "), redactArgs(args))
+	}
+}
+
+// QueryMetrics reports the counts of queries, of every schema
+func (s *sqlRepository) QueryMetrics() []metrics.Sample {
+	o := s.observer
+	open := 0.0
+	if o.breaker.Open() {
+		open = 1
+	}
+	return []metrics.Sample{
+		{Name: "db_circuit_open", Help: "Whether queries are rejected as the database is failing.", Type: metrics.Gauge, Value: open},
+		{Name: "db_queries_total", Help: "Total number of queries run.", Type: metrics.Counter, Value: float64(o.queries.Load())},
+		{Name: "db_slow_queries_total", Help: "Total number of queries slower than the slow query threshold.", Type: metrics.Counter, Value: float64(o.slow.Load())},
+	}
+}
+
+// redactArgs hides the text arguments of a query, which may hold personal
+// data or secrets, keeping the numbers, booleans, times and nulls that
+// help reproduce it
+func redactArgs(args []driver.NamedValue) []interface{} {
+	redacted := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch arg.Value.(type) {
+		case string, []byte:
+			redacted[i] = "[redacted]"
+		default:
+			redacted[i] = arg.Value
+		}
+	}
+	return redacted
+}
+
+// openConnector returns the connector of a registered database/sql driver
+func openConnector(driverName, dsn string) (driver.Connector, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	// only opened to look up the driver; it has no connections yet
+	defer db.Close()
+
+	if opener, ok := db.Driver().(driver.DriverContext); ok {
+		return opener.OpenConnector(dsn)
+	}
+	return dsnConnector{dsn, db.Driver()}, nil
+}
+
+// dsnConnector connects drivers that have no connector of their own
+type dsnConnector struct {
+	dsn string
+	drv driver.Driver
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.drv.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.drv
+}
+
+// observedConnector wraps the connections of a connector so that their
+// queries, in transactions or not, go through the observer
+type observedConnector struct {
+	driver.Connector
+	observer *queryObserver
+}
+
+func (c observedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := c.observer.allow(); err != nil {
+		return nil, err
+	}
+	conn, err := c.Connector.Connect(ctx)
+	c.observer.record(err)
+	if err != nil {
+		return nil, err
+	}
+	return &observedConn{Conn: conn, observer: c.observer}, nil
+}
+
+// observedConn times the queries of a driver connection. It implements
+// every optional interface database/sql looks for, passing them on when the
+// driver has them and answering like database/sql would otherwise.
+type observedConn struct {
+	driver.Conn
+	observer *queryObserver
+	// inTx is set while a transaction is open, whose statements can't be
+	// retried alone
+	inTx bool
+}
+
+// Unwrap returns the connection of the driver, for sql.Conn.Raw
+func (c *observedConn) Unwrap() driver.Conn {
+	return c.Conn
+}
+
+func (c *observedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if err := c.observer.allow(); err != nil {
+		return nil, err
+	}
+	if !isRead(query) {
+		pinPrimary(ctx)
+	}
+	ctx, timeout, cancel := c.observer.bound(ctx, query)
+	defer cancel()
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.observer.observe(query, args, time.Since(start), err)
+	err = timedOut(ctx, timeout, err)
+	c.observer.record(err)
+	return result, err
+}
+
+// QueryContext runs a query, again when it only reads outside a
+// transaction and fails with a transient error, see retry
+func (c *observedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	if c.inTx || !isRead(query) {
+		return c.queryOnce(ctx, queryer, query, args)
+	}
+	return retryValue(ctx, c.observer.cfg, func() (driver.Rows, error) {
+		return c.queryOnce(ctx, queryer, query, args)
+	})
+}
+
+func (c *observedConn) queryOnce(ctx context.Context, queryer driver.QueryerContext, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := c.observer.allow(); err != nil {
+		return nil, err
+	}
+	ctx, timeout, cancel := c.observer.bound(ctx, query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.observer.observe(query, args, time.Since(start), err)
+	err = timedOut(ctx, timeout, err)
+	c.observer.record(err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return boundRows{rows, cancel}, nil
+}
+
+func (c *observedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *observedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &observedStmt{stmt, c, query}, nil
+}
+
+func (c *observedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if !opts.ReadOnly {
+		pinPrimary(ctx)
+	}
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("sql: driver does not support non-default isolation level or read-only transactions")
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.inTx = true
+	return observedTx{tx, c}, nil
+}
+
+// observedTx tells its connection when the transaction ends
+type observedTx struct {
+	driver.Tx
+	conn *observedConn
+}
+
+func (t observedTx) Commit() error {
+	t.conn.inTx = false
+	return t.Tx.Commit()
+}
+
+func (t observedTx) Rollback() error {
+	t.conn.inTx = false
+	return t.Tx.Rollback()
+}
+
+func (c *observedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *observedConn) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	return driver.ErrSkip
+}
+
+func (c *observedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *observedConn) IsValid() bool {
+	if validator, ok := c.Conn.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+// observedStmt times the runs of a prepared statement
+type observedStmt struct {
+	driver.Stmt
+	conn  *observedConn
+	query string
+}
+
+func (s *observedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if err := s.conn.observer.allow(); err != nil {
+		return nil, err
+	}
+	if !isRead(s.query) {
+		pinPrimary(ctx)
+	}
+	ctx, timeout, cancel := s.conn.observer.bound(ctx, s.query)
+	defer cancel()
+	start := time.Now()
+	var result driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		result, err = execer.ExecContext(ctx, args)
+	} else if values, convErr := namedValues(args); convErr != nil {
+		return nil, convErr
+	} else {
+		result, err = s.Stmt.Exec(values)
+	}
+	s.conn.observer.observe(s.query, args, time.Since(start), err)
+	err = timedOut(ctx, timeout, err)
+	s.conn.observer.record(err)
+	return result, err
+}
+
+// QueryContext runs the statement, again when it only reads outside a
+// transaction and fails with a transient error, see retry
+func (s *observedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.conn.inTx || !isRead(s.query) {
+		return s.queryOnce(ctx, args)
+	}
+	return retryValue(ctx, s.conn.observer.cfg, func() (driver.Rows, error) {
+		return s.queryOnce(ctx, args)
+	})
+}
+
+func (s *observedStmt) queryOnce(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if err := s.conn.observer.allow(); err != nil {
+		return nil, err
+	}
+	ctx, timeout, cancel := s.conn.observer.bound(ctx, s.query)
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else if values, convErr := namedValues(args); convErr != nil {
+		cancel()
+		return nil, convErr
+	} else {
+		rows, err = s.Stmt.Query(values)
+	}
+	s.conn.observer.observe(s.query, args, time.Since(start), err)
+	err = timedOut(ctx, timeout, err)
+	s.conn.observer.record(err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return boundRows{rows, cancel}, nil
+}
+
+// CheckNamedValue checks arguments with the statement, or else its
+// connection, as database/sql would
+func (s *observedStmt) CheckNamedValue(value *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(value)
+	}
+	if converter, ok := s.Stmt.(driver.ColumnConverter); ok {
+		return checkWithConverter(converter.ColumnConverter(value.Ordinal-1), value)
+	}
+	return s.conn.CheckNamedValue(value)
+}
+
+// checkWithConverter converts an argument with the converter of its column
+func checkWithConverter(converter driver.ValueConverter, value *driver.NamedValue) error {
+	if valuer, ok := value.Value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return err
+		}
+		value.Value = v
+	}
+	v, err := converter.ConvertValue(value.Value)
+	if err != nil {
+		return err
+	}
+	if !driver.IsValue(v) {
+		return driver.ErrSkip
+	}
+	value.Value = v
+	return nil
+}
+
+// namedValues turns arguments into the positional values of the legacy
+// driver interface
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("sql: driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,36 @@
+package repository
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestLogQuery(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	defer SetLogQueryArgs(false)
+
+	tests := []struct {
+		name    string
+		logArgs bool
+		args    []interface{}
+		want    string
+	}{
+		{"without arguments", false, []interface{}{"ann@example.com", 1}, "Query: SELECT 1\n"},
+		{"with arguments", true, []interface{}{"ann@example.com", 1}, "Query: SELECT 1, Args: [ann@example.com 1]\n"},
+		{"no arguments", true, nil, "Query: SELECT 1\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			log.SetOutput(&out)
+			SetLogQueryArgs(tt.logArgs)
+			logQuery("SELECT 1", tt.args...)
+			// past the date and time
+			if _, got, _ := strings.Cut(out.String(), "Query:"); "Query:"+got != tt.want {
+				t.Errorf("logged %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
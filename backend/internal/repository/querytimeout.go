@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// queryClass picks the timeout of the queries run with a context
+type queryClass int
+
+const (
+	classDefault   queryClass = iota // reads or writes, told apart by the statement
+	classExport                      // bulk reads, such as exports and reports
+	classUnbounded                   // schema migrations, which take what they take
+)
+
+type queryClassKey struct{}
+
+// WithExport marks the queries run with ctx as part of an export, which
+// reads many rows and gets the export timeout instead of the read one
+func WithExport(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryClassKey{}, classExport)
+}
+
+// withoutQueryTimeout exempts the queries run with ctx from the timeouts
+func withoutQueryTimeout(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryClassKey{}, classUnbounded)
+}
+
+// timeout returns the timeout of a query run with ctx, zero for none
+func (o *queryObserver) timeout(ctx context.Context, query string) time.Duration {
+	switch class, _ := ctx.Value(queryClassKey{}).(queryClass); {
+	case class == classUnbounded:
+		return 0
+	case class == classExport:
+		return o.cfg.ExportTimeout
+	case isRead(query):
+		return o.cfg.ReadTimeout
+	default:
+		return o.cfg.WriteTimeout
+	}
+}
+
+// bound limits ctx to the timeout of query. The cancel is to be called
+// once the query is done with, which for reads is when their rows are
+// closed, see boundRows.
+func (o *queryObserver) bound(ctx context.Context, query string) (context.Context, time.Duration, context.CancelFunc) {
+	timeout := o.timeout(ctx, query)
+	if timeout <= 0 {
+		return ctx, 0, func() {}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	return ctx, timeout, cancel
+}
+
+// timedOut tells drivers that report a cancelled query in their own words,
+// such as SQLite's "interrupted", apart from other failures, so a query
+// past its timeout always fails with context.DeadlineExceeded
+func timedOut(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || timeout <= 0 || !errors.Is(ctx.Err(), context.DeadlineExceeded) || errors.Is(err, driver.ErrSkip) {
+		return err
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return fmt.Errorf("query timed out after %s: %w", timeout, err)
+	}
+	return fmt.Errorf("query timed out after %s: %w: %w", timeout, context.DeadlineExceeded, err)
+}
+
+// isRead reports whether a statement only reads, going by its first
+// keyword past any comments
+func isRead(query string) bool {
+	query = strings.TrimSpace(query)
+	for strings.HasPrefix(query, "--") {
+		_, query, _ = strings.Cut(query, "\n")
+		query = strings.TrimSpace(query)
+	}
+	words := strings.FieldsFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+	if len(words) == 0 {
+		return false
+	}
+	switch strings.ToUpper(words[0]) {
+	case "SELECT", "WITH", "SHOW", "EXPLAIN", "VALUES":
+		return true
+	}
+	return false
+}
+
+// boundRows cancels the timeout of a query once its rows are closed, as
+// they are read after the query returns
+type boundRows struct {
+	driver.Rows
+	cancel context.CancelFunc
+}
+
+func (r boundRows) Close() error {
+	defer r.cancel()
+	return r.Rows.Close()
+}
+
+func (r boundRows) HasNextResultSet() bool {
+	if next, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return next.HasNextResultSet()
+	}
+	return false
+}
+
+func (r boundRows) NextResultSet() error {
+	if next, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return next.NextResultSet()
+	}
+	return io.EOF
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// replicaRoute is the routing of the reads run with a context, on the read
+// replica until a write is run with it
+type replicaRoute struct {
+	pinned atomic.Bool
+}
+
+type replicaRouteKey struct{}
+
+// WithReplica lets the reads run with ctx go to the read replica, when one
+// is configured. Once a write is run with ctx, the reads after it go to the
+// primary, so they see it despite the replication lag.
+func WithReplica(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaRouteKey{}, &replicaRoute{})
+}
+
+// pinPrimary sends the reads run with ctx to the primary from now on
+func pinPrimary(ctx context.Context) {
+	if route, ok := ctx.Value(replicaRouteKey{}).(*replicaRoute); ok {
+		route.pinned.Store(true)
+	}
+}
+
+// reader returns the repository the reads run with ctx go to: the replica
+// when ctx allows it, unless it is failing or ctx runs in a transaction,
+// the primary otherwise
+func (s *sqlRepository) reader(ctx context.Context) *sqlRepository {
+	if s.replica == nil || s.replica.observer.breaker.Open() || s.txFrom(ctx) != nil {
+		return s
+	}
+	if route, ok := ctx.Value(replicaRouteKey{}).(*replicaRoute); ok && !route.pinned.Load() {
+		return s.replica
+	}
+	return s
+}
+
+// PingReplica checks the read replica, when one is configured
+func (s *sqlRepository) PingReplica(ctx context.Context) error {
+	if s.replica == nil {
+		return nil
+	}
+	return s.replica.Ping(ctx)
+}
@@ -0,0 +1,186 @@
+// Package repository persists users. The UserRepository interface hides
+// which database is in use; Open picks the implementation from the config.
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api/internal/metrics"
+	"api/internal/migrate"
+	"api/internal/model"
+	"api/internal/pii"
+)
+
+// UserRepository persists users, their addresses, phone numbers, revisions,
+// roles and teams, the organizations owning them, the invitations to join those, the
+// sessions of logged in users, the permissions and feature flag overrides
+// managed through the API, the audit log of the requests made through it,
+// the background job queue, the CSV imports it runs, the runs of the
+// recurring tasks, the outbox of the events recorded with the changes of
+// users and their in-app notifications along with the preferences of who
+// receives which.
+// Every call takes the context of the request it serves, so its
+// queries are cancelled along with the request; contexts carrying an
+// organization (see model.WithOrg) only see and create that tenant's users
+// and teams.
+type UserRepository interface {
+	AddressRepository
+	PhoneRepository
+	RoleRepository
+	PermissionRepository
+	FeatureFlagRepository
+	TeamRepository
+	OrganizationRepository
+	InvitationRepository
+	SessionRepository
+	AuditRepository
+	JobRepository
+	ImportRepository
+	TaskRepository
+	CleanupRepository
+	RevisionRepository
+	OutboxRepository
+	NotificationRepository
+	Transactor
+
+	List(ctx context.Context, params model.ListParams) ([]model.User, error)
+	// Count returns the number of users List would return for params
+	Count(ctx context.Context, params model.ListParams) (int, error)
+	// CountByRole returns the number of users List would return for params, per role
+	CountByRole(ctx context.Context, params model.ListParams) (map[string]int, error)
+	// Suggest returns up to limit users whose name or email starts with the
+	// lowercase prefix, ordered by name, with only id, name and email loaded
+	Suggest(ctx context.Context, prefix string, limit int) ([]model.User, error)
+	// Birthdays returns the active users born on any of the days, given as MM-DD
+	Birthdays(ctx context.Context, days []string) ([]model.User, error)
+	Get(ctx context.Context, id int) (model.User, error)
+	// GetByEmail returns the user with the normalized email, along with its password hash
+	GetByEmail(ctx context.Context, email string) (model.User, error)
+	// GetByCanonicalEmail returns the ID of the user with the canonical
+	// email, whatever its organization or team
+	GetByCanonicalEmail(ctx context.Context, canonical string) (int, error)
+	Create(ctx context.Context, user model.User) (model.User, error)
+	// Update stores the edit of the user along with its revision rev, which
+	// gets the user ID and the new version; revisions without changes aren't kept
+	Update(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error)
+	// SetAvatar records the storage key of the user's avatar, empty for none;
+	// it is not an edit of the user, so the version stays the same
+	SetAvatar(ctx context.Context, id int, key string) error
+	// SetStatus changes the status of the user, such as when it verifies its
+	// email; like SetAvatar it leaves the version alone
+	SetStatus(ctx context.Context, id int, status string) error
+	// SetPassword replaces the password hash of the user, activates it and
+	// increments its token version, revoking the tokens issued before. It
+	// fails with model.ErrVersionConflict unless tokenVersion is the current one.
+	SetPassword(ctx context.Context, id int, hash string, tokenVersion int) error
+	// RevokeTokens increments the token version of the user, revoking the
+	// access tokens and sessions issued to it so far
+	RevokeTokens(ctx context.Context, id int) error
+	// Anonymize replaces the name, email, birth date and age of the user with
+	// those of user and stamps it with user.AnonymizedAt, at once clearing
+	// its canonical email, metadata, avatar key and password, revoking its tokens, and
+	// deleting its addresses, phone numbers and the invitations sent to it.
+	// The values of the user's revisions are dropped and rev is added.
+	// It fails with model.ErrAlreadyAnonymized for users anonymized before.
+	Anonymize(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error)
+	Delete(ctx context.Context, id int) error
+	Truncate(ctx context.Context) error
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// PoolStatsReporter is implemented by repositories that can report connection pool usage
+type PoolStatsReporter interface {
+	PoolStats() map[string]interface{}
+	// PoolMetrics reports the same as gauges and counters
+	PoolMetrics() []metrics.Sample
+}
+
+// QueryMetricsReporter is implemented by repositories counting their queries,
+// slow ones included
+type QueryMetricsReporter interface {
+	QueryMetrics() []metrics.Sample
+}
+
+// ReplicaPinger is implemented by repositories that may read from a replica
+type ReplicaPinger interface {
+	PingReplica(ctx context.Context) error
+}
+
+// Migratable is implemented by repositories whose schema is managed by migrations
+type Migratable interface {
+	Migrator() (*migrate.Migrator, error)
+}
+
+// Config selects and tunes the database backend
+type Config struct {
+	Driver string // postgres, sqlite, mysql or memory
+	DSN    string
+	// ReadDSN, when set, connects to a read replica serving the reads
+	// allowed by WithReplica
+	ReadDSN string
+	Pool    PoolConfig
+	// Queries tunes how queries are run and watched
+	Queries QueryConfig
+	// SchemaPerTenant keeps each organization's data in a Postgres schema
+	// of its own instead of scoping shared tables by org_id
+	SchemaPerTenant bool
+	// PII, when set, encrypts the emails of users, with a blind index for
+	// finding them; the memory store keeps nothing at rest and ignores it
+	PII *pii.Cipher
+}
+
+// PoolConfig tunes the database connection pool
+type PoolConfig struct {
+	MaxConns          int32
+	MinConns          int32
+	MaxConnLifetime   time.Duration
+	HealthCheckPeriod time.Duration
+	// StartupWait is how long Open waits for the database to accept
+	// connections, retrying from StartupBackoff, doubled each time up to
+	// maxStartupBackoff; zero fails at once
+	StartupWait    time.Duration
+	StartupBackoff time.Duration
+	// CurrentDSN and CurrentReadDSN, when set, return the connection
+	// strings of the primary and of the replica as they are now: new
+	// connections take their user and password from them, so credentials
+	// rotated while running apply without a restart
+	CurrentDSN, CurrentReadDSN func() string
+}
+
+// sortColumns whitelists the columns users can be sorted by
+var sortColumns = map[string]string{
+	"name":      "name",
+	"email":     "email",
+	"role":      "role",
+	"age":       "age",
+	"timestamp": "timestamp",
+}
+
+// Open connects to the database selected by cfg.Driver
+func Open(cfg Config) (UserRepository, error) {
+	if cfg.SchemaPerTenant {
+		if cfg.Driver != "postgres" {
+			return nil, fmt.Errorf("schema per tenant isolation needs STORE=postgres, not %q", cfg.Driver)
+		}
+		return newSchemaRepository(cfg.DSN, cfg.ReadDSN, cfg.Pool, cfg.Queries, cfg.PII)
+	}
+
+	var d dialect
+	switch cfg.Driver {
+	case "postgres":
+		d = postgresDialect
+	case "sqlite":
+		d = sqliteDialect
+	case "mysql":
+		d = mysqlDialect
+	case "memory":
+		return newMemoryRepository(), nil
+	default:
+		return nil, fmt.Errorf("unknown STORE %q (expected postgres, sqlite, mysql or memory)", cfg.Driver)
+	}
+
+	return newSQLRepository(d, cfg.DSN, cfg.ReadDSN, cfg.Pool, cfg.Queries, cfg.PII)
+}
@@ -0,0 +1,43 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"api/internal/backoff"
+)
+
+// retry runs op until it succeeds, fails with an error that isn't
+// transient, or has been attempted cfg.MaxAttempts times, waiting
+// exponentially longer between attempts. Operations running a transaction
+// are retried whole, as a serialization failure or a deadlock rolls it
+// back; reads outside transactions are retried by observedConn. Within
+// WithTx, op isn't retried alone, as the transaction failed with it: WithTx
+// is.
+func retry(ctx context.Context, cfg QueryConfig, op func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt >= cfg.MaxAttempts || !transientError(err) || inTx(ctx) {
+			return err
+		}
+
+		delay := backoff.Exponential(cfg.RetryBackoff, cfg.RetryMaxBackoff, attempt)
+		log.Printf("Retrying in %s after a transient database error (attempt %d of %d): %v", delay, attempt, cfg.MaxAttempts, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryValue is retry for operations returning a value
+func retryValue[T any](ctx context.Context, cfg QueryConfig, op func() (T, error)) (T, error) {
+	var value T
+	err := retry(ctx, cfg, func() (err error) {
+		value, err = op()
+		return err
+	})
+	return value, err
+}
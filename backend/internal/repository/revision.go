@@ -0,0 +1,149 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"api/internal/model"
+)
+
+// RevisionRepository reads the history of edits of users. Revisions are
+// written by Update and Anonymize, along with the edit they record.
+type RevisionRepository interface {
+	// ListRevisions returns the revisions of the user, oldest first
+	ListRevisions(ctx context.Context, userID int) ([]model.Revision, error)
+}
+
+func (s *sqlRepository) ListRevisions(ctx context.Context, userID int) ([]model.Revision, error) {
+	query := s.d.rebind("SELECT id, user_id, version, actor, impersonator, changes, created_at FROM user_revisions WHERE user_id = ? ORDER BY id")
+	logQuery(query, userID)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []model.Revision{}
+	for rows.Next() {
+		var rev model.Revision
+		var changes string
+		if err := rows.Scan(&rev.ID, &rev.UserID, &rev.Version, &rev.Actor, &rev.Impersonator, &changes, &rev.CreatedAt); err != nil {
+			return nil, err
+		}
+		if changes, err = s.open(changesField, changes); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(changes), &rev.Changes); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+// insertRevision records the revision within the transaction of its edit,
+// unless the edit changed nothing
+func (s *sqlRepository) insertRevision(ctx context.Context, tx *sql.Tx, rev model.Revision) error {
+	if len(rev.Changes) == 0 {
+		return nil
+	}
+	encoded, err := json.Marshal(rev.Changes)
+	if err != nil {
+		return err
+	}
+	changes, err := s.seal(changesField, string(encoded))
+	if err != nil {
+		return err
+	}
+	query := s.d.rebind("INSERT INTO user_revisions (user_id, version, actor, impersonator, changes, created_at) VALUES (?, ?, ?, ?, ?, ?)")
+	// the changes repeat the values logged with the edit
+	logQuery(query, rev.UserID, rev.Version, rev.Actor, rev.Impersonator, "<changes>", rev.CreatedAt)
+	_, err = tx.ExecContext(ctx, query, rev.UserID, rev.Version, rev.Actor, rev.Impersonator, changes, rev.CreatedAt.UTC())
+	return err
+}
+
+// scrubRevisions drops the old and new values from the revisions of the
+// user, keeping who changed which fields
+func (s *sqlRepository) scrubRevisions(ctx context.Context, tx *sql.Tx, userID int) error {
+	query := s.d.rebind("SELECT id, changes FROM user_revisions WHERE user_id = ?")
+	logQuery(query, userID)
+	rows, err := tx.QueryContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	scrubbed := map[int]string{}
+	for rows.Next() {
+		var id int
+		var data string
+		if err := rows.Scan(&id, &data); err != nil {
+			rows.Close()
+			return err
+		}
+		if data, err = s.open(changesField, data); err != nil {
+			rows.Close()
+			return err
+		}
+		var changes []model.FieldChange
+		if err := json.Unmarshal([]byte(data), &changes); err != nil {
+			rows.Close()
+			return err
+		}
+		encoded, err := json.Marshal(scrubChanges(changes))
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if scrubbed[id], err = s.seal(changesField, string(encoded)); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	update := s.d.rebind("UPDATE user_revisions SET changes = ? WHERE id = ?")
+	for id, changes := range scrubbed {
+		logQuery(update, "<changes>", id)
+		if _, err := tx.ExecContext(ctx, update, changes, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scrubChanges returns the changes without their values
+func scrubChanges(changes []model.FieldChange) []model.FieldChange {
+	scrubbed := make([]model.FieldChange, len(changes))
+	for i, change := range changes {
+		scrubbed[i] = model.FieldChange{Field: change.Field}
+	}
+	return scrubbed
+}
+
+func (m *memoryRepository) ListRevisions(ctx context.Context, userID int) ([]model.Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revisions := []model.Revision{}
+	for _, rev := range m.revisions {
+		if rev.UserID == userID {
+			rev.Changes = append([]model.FieldChange{}, rev.Changes...)
+			revisions = append(revisions, rev)
+		}
+	}
+	return revisions, nil
+}
+
+// addRevision records the revision of an edit, unless the edit changed
+// nothing; m.mu must be held
+func (m *memoryRepository) addRevision(rev model.Revision) {
+	if len(rev.Changes) == 0 {
+		return
+	}
+	rev.ID = m.nextRevisionID
+	m.nextRevisionID++
+	m.revisions = append(m.revisions, rev)
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"api/internal/model"
+)
+
+// RoleRepository persists the roles users can be given. Users reference
+// roles by name, so a role can't be deleted while users still have it.
+type RoleRepository interface {
+	ListRoles(ctx context.Context) ([]model.Role, error)
+	GetRole(ctx context.Context, name string) (model.Role, error)
+	CreateRole(ctx context.Context, role model.Role) (model.Role, error)
+	UpdateRole(ctx context.Context, role model.Role) (model.Role, error)
+	DeleteRole(ctx context.Context, name string) error
+}
+
+// errDuplicateRole is returned when a role of the same name already exists
+var errDuplicateRole = model.Conflict("name")
+
+func (s *sqlRepository) ListRoles(ctx context.Context) ([]model.Role, error) {
+	query := "SELECT name, description FROM roles ORDER BY name"
+	logQuery(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []model.Role{}
+	for rows.Next() {
+		var role model.Role
+		if err := rows.Scan(&role.Name, &role.Description); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *sqlRepository) GetRole(ctx context.Context, name string) (model.Role, error) {
+	query := s.d.rebind("SELECT name, description FROM roles WHERE name = ?")
+	logQuery(query, name)
+
+	var role model.Role
+	err := s.conn(ctx).QueryRowContext(ctx, query, name).Scan(&role.Name, &role.Description)
+	if err == sql.ErrNoRows {
+		return role, model.NotFound("role")
+	}
+	return role, err
+}
+
+func (s *sqlRepository) CreateRole(ctx context.Context, role model.Role) (model.Role, error) {
+	query := s.d.rebind("INSERT INTO roles (name, description) VALUES (?, ?)")
+	logQuery(query, role.Name, role.Description)
+
+	if _, err := s.conn(ctx).ExecContext(ctx, query, role.Name, role.Description); err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			return role, errDuplicateRole
+		}
+		return role, err
+	}
+	return role, nil
+}
+
+func (s *sqlRepository) UpdateRole(ctx context.Context, role model.Role) (model.Role, error) {
+	query := s.d.rebind("UPDATE roles SET description = ? WHERE name = ?")
+	logQuery(query, role.Description, role.Name)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, role.Description, role.Name)
+	if err != nil {
+		return role, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return role, err
+	}
+	if rowsAffected == 0 {
+		return role, model.NotFound("role")
+	}
+	return role, nil
+}
+
+func (s *sqlRepository) DeleteRole(ctx context.Context, name string) error {
+	query := s.d.rebind("DELETE FROM roles WHERE name = ?")
+	logQuery(query, name)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, name)
+	if foreignKeyViolation(err) {
+		return model.ErrRoleInUse
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("role")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListRoles(ctx context.Context) ([]model.Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	roles := make([]model.Role, 0, len(m.roles))
+	for _, role := range m.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	return roles, nil
+}
+
+func (m *memoryRepository) GetRole(ctx context.Context, name string) (model.Role, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	role, ok := m.roles[name]
+	if !ok {
+		return model.Role{}, model.NotFound("role")
+	}
+	return role, nil
+}
+
+func (m *memoryRepository) CreateRole(ctx context.Context, role model.Role) (model.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[role.Name]; ok {
+		return role, errDuplicateRole
+	}
+	m.roles[role.Name] = role
+	return role, nil
+}
+
+func (m *memoryRepository) UpdateRole(ctx context.Context, role model.Role) (model.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[role.Name]; !ok {
+		return role, model.NotFound("role")
+	}
+	m.roles[role.Name] = role
+	return role, nil
+}
+
+func (m *memoryRepository) DeleteRole(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.roles[name]; !ok {
+		return model.NotFound("role")
+	}
+	for _, user := range m.users {
+		if user.Role == name {
+			return model.ErrRoleInUse
+		}
+	}
+	delete(m.roles, name)
+	for id, invitation := range m.invitations {
+		if invitation.Role == name {
+			delete(m.invitations, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,588 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"api/internal/migrate"
+	"api/internal/model"
+	"api/internal/pii"
+)
+
+// TenantSchema is the Postgres schema holding the data of an organization
+// when tenants are isolated by schema
+func TenantSchema(orgID int) string {
+	return "tenant_" + strconv.Itoa(orgID)
+}
+
+// schemaRepository isolates every organization but the default one in its
+// own Postgres schema, for tenants needing more than the org_id column.
+// Organizations, roles, permissions, invitations, sessions, the audit log
+// and idempotency keys stay in the shared schema, along with the default organization's data and unscoped calls;
+// each tenant's users, addresses, phone numbers and teams are queried
+// through a pool of its own whose connections have search_path set to the
+// tenant's schema, followed by public for the shared tables.
+type schemaRepository struct {
+	*sqlRepository // the shared schema
+
+	dsn     string
+	poolCfg PoolConfig
+
+	mu      sync.Mutex
+	tenants map[int]*sqlRepository // by organization ID, opened on first use
+}
+
+func newSchemaRepository(dsn, readDSN string, poolCfg PoolConfig, queryCfg QueryConfig, cipher *pii.Cipher) (*schemaRepository, error) {
+	shared, err := newSQLRepository(postgresDialect, dsn, readDSN, poolCfg, queryCfg, cipher)
+	if err != nil {
+		return nil, err
+	}
+	return &schemaRepository{sqlRepository: shared, dsn: dsn, poolCfg: poolCfg, tenants: map[int]*sqlRepository{}}, nil
+}
+
+// tenant returns the repository of the organization ctx is scoped to,
+// provisioning its schema when it doesn't exist yet
+func (s *schemaRepository) tenant(ctx context.Context) (*sqlRepository, error) {
+	org, ok := model.OrgFrom(ctx)
+	if !ok || org == model.DefaultOrgID {
+		return s.sqlRepository, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if repo, ok := s.tenants[org]; ok {
+		return repo, nil
+	}
+	repo, err := s.openTenant(ctx, org)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the schema of organization %d: %w", org, err)
+	}
+	s.tenants[org] = repo
+	return repo, nil
+}
+
+// openTenant connects to the schema of an organization. A missing schema
+// is created and migrated; an existing one is only checked for pending
+// migrations, which the migrate command applies.
+func (s *schemaRepository) openTenant(ctx context.Context, org int) (*sqlRepository, error) {
+	schema := TenantSchema(org)
+
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM information_schema.schemata WHERE schema_name = $1)"
+	if err := s.conn(ctx).QueryRowContext(ctx, query, schema).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		query = "CREATE SCHEMA IF NOT EXISTS " + pgx.Identifier{schema}.Sanitize()
+		logQuery(query)
+		if _, err := s.conn(ctx).ExecContext(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	// idle connections would add up over many tenants, so none are kept open
+	poolCfg := s.poolCfg
+	poolCfg.MinConns = 0
+	pool, err := openPostgres(s.dsn, poolCfg, pgx.Identifier{schema}.Sanitize()+", public")
+	if err != nil {
+		return nil, err
+	}
+	repo := &sqlRepository{db: openPoolDB(pool, s.observer), d: postgresDialect, pool: pool, migrations: "postgres_tenant", pii: s.pii, observer: s.observer, queries: s.queries, tenant: true}
+
+	migrator, err := repo.Migrator()
+	if err != nil {
+		repo.Close()
+		return nil, err
+	}
+	if !exists {
+		if _, err := migrator.Up(); err != nil {
+			repo.Close()
+			return nil, err
+		}
+		log.Printf("Provisioned schema %s", schema)
+	} else if pending, err := migrator.Pending(); err != nil {
+		repo.Close()
+		return nil, err
+	} else if pending > 0 {
+		log.Printf("WARNING: %d pending migrations in schema %s, run the migrate command to apply them", pending, schema)
+	}
+	return repo, nil
+}
+
+// TenantMigrator runs the migrations of one tenant's schema
+type TenantMigrator struct {
+	OrgID  int
+	Schema string
+	*migrate.Migrator
+}
+
+// TenantMigratable is implemented by repositories keeping tenants in
+// schemas of their own, migrated apart from the shared schema
+type TenantMigratable interface {
+	TenantMigrators(ctx context.Context) ([]TenantMigrator, error)
+}
+
+// TenantMigrators returns a migrator for the schema of every organization
+// but the default one, provisioning the schemas that are missing
+func (s *schemaRepository) TenantMigrators(ctx context.Context) ([]TenantMigrator, error) {
+	orgs, err := s.ListOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(orgs, func(i, j int) bool { return orgs[i].ID < orgs[j].ID })
+
+	var migrators []TenantMigrator
+	for _, org := range orgs {
+		if org.ID == model.DefaultOrgID {
+			continue
+		}
+		repo, err := s.tenant(model.WithOrg(ctx, org.ID))
+		if err != nil {
+			return nil, err
+		}
+		migrator, err := repo.Migrator()
+		if err != nil {
+			return nil, err
+		}
+		migrators = append(migrators, TenantMigrator{OrgID: org.ID, Schema: TenantSchema(org.ID), Migrator: migrator})
+	}
+	return migrators, nil
+}
+
+// EncryptPII encrypts the personal data of the shared schema, then that of
+// every tenant's schema
+func (s *schemaRepository) EncryptPII(ctx context.Context, batchSize int) (int, error) {
+	encrypted, err := s.sqlRepository.EncryptPII(ctx, batchSize)
+	if err != nil {
+		return encrypted, err
+	}
+	orgs, err := s.ListOrganizations(ctx)
+	if err != nil {
+		return encrypted, err
+	}
+	for _, org := range orgs {
+		if org.ID == model.DefaultOrgID {
+			continue
+		}
+		repo, err := s.tenant(model.WithOrg(ctx, org.ID))
+		if err != nil {
+			return encrypted, err
+		}
+		n, err := repo.EncryptPII(ctx, batchSize)
+		encrypted += n
+		if err != nil {
+			return encrypted, err
+		}
+	}
+	return encrypted, nil
+}
+
+// CreateOrganization stores the organization and provisions its schema
+func (s *schemaRepository) CreateOrganization(ctx context.Context, org model.Organization) (model.Organization, error) {
+	org, err := s.sqlRepository.CreateOrganization(ctx, org)
+	if err != nil {
+		return org, err
+	}
+	_, err = s.tenant(model.WithOrg(ctx, org.ID))
+	return org, err
+}
+
+// DeleteOrganization removes the organization along with its schema. The
+// foreign keys from the schema's users and teams to organizations keep
+// organizations that still have some.
+func (s *schemaRepository) DeleteOrganization(ctx context.Context, id int) error {
+	if id == model.DefaultOrgID {
+		return s.sqlRepository.DeleteOrganization(ctx, id)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := "DELETE FROM organizations WHERE id = $1"
+	logQuery(query, id)
+	result, err := tx.ExecContext(ctx, query, id)
+	if foreignKeyViolation(err) {
+		return model.ErrOrganizationInUse
+	}
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("organization")
+	}
+
+	query = "DROP SCHEMA IF EXISTS " + pgx.Identifier{TenantSchema(id)}.Sanitize() + " CASCADE"
+	logQuery(query)
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	if repo, ok := s.tenants[id]; ok {
+		repo.Close()
+		delete(s.tenants, id)
+	}
+	return nil
+}
+
+func (s *schemaRepository) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, repo := range s.tenants {
+		repo.Close()
+		delete(s.tenants, id)
+	}
+	return s.sqlRepository.Close()
+}
+
+// The calls below run against the schema of the caller's organization.
+
+func (s *schemaRepository) List(ctx context.Context, params model.ListParams) ([]model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.List(ctx, params)
+}
+
+func (s *schemaRepository) Birthdays(ctx context.Context, days []string) ([]model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.Birthdays(ctx, days)
+}
+
+func (s *schemaRepository) Count(ctx context.Context, params model.ListParams) (int, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tenant.Count(ctx, params)
+}
+
+func (s *schemaRepository) CountByRole(ctx context.Context, params model.ListParams) (map[string]int, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.CountByRole(ctx, params)
+}
+
+func (s *schemaRepository) Suggest(ctx context.Context, prefix string, limit int) ([]model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.Suggest(ctx, prefix, limit)
+}
+
+func (s *schemaRepository) Get(ctx context.Context, id int) (model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return model.User{}, err
+	}
+	return tenant.Get(ctx, id)
+}
+
+func (s *schemaRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return model.User{}, err
+	}
+	return tenant.GetByEmail(ctx, email)
+}
+
+func (s *schemaRepository) Create(ctx context.Context, user model.User) (model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return user, err
+	}
+	return tenant.Create(ctx, user)
+}
+
+// WithTx runs fn in a transaction on the schema of the organization in ctx
+func (s *schemaRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.WithTx(ctx, fn)
+}
+
+func (s *schemaRepository) CreateUsers(ctx context.Context, users []model.User) ([]model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.CreateUsers(ctx, users)
+}
+
+func (s *schemaRepository) Update(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return user, err
+	}
+	return tenant.Update(ctx, id, user, rev)
+}
+
+func (s *schemaRepository) SetAvatar(ctx context.Context, id int, key string) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.SetAvatar(ctx, id, key)
+}
+
+func (s *schemaRepository) SetStatus(ctx context.Context, id int, status string) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.SetStatus(ctx, id, status)
+}
+
+func (s *schemaRepository) SetPassword(ctx context.Context, id int, hash string, tokenVersion int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.SetPassword(ctx, id, hash, tokenVersion)
+}
+
+func (s *schemaRepository) RevokeTokens(ctx context.Context, id int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.RevokeTokens(ctx, id)
+}
+
+func (s *schemaRepository) Anonymize(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return user, err
+	}
+	return tenant.Anonymize(ctx, id, user, rev)
+}
+
+func (s *schemaRepository) ListRevisions(ctx context.Context, userID int) ([]model.Revision, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ListRevisions(ctx, userID)
+}
+
+func (s *schemaRepository) CreateNotification(ctx context.Context, notification model.Notification) (model.Notification, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return notification, err
+	}
+	return tenant.CreateNotification(ctx, notification)
+}
+
+func (s *schemaRepository) ListNotifications(ctx context.Context, userID int, params model.NotificationParams) ([]model.Notification, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ListNotifications(ctx, userID, params)
+}
+
+func (s *schemaRepository) CountUnreadNotifications(ctx context.Context, userID int) (int, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tenant.CountUnreadNotifications(ctx, userID)
+}
+
+func (s *schemaRepository) MarkNotificationRead(ctx context.Context, userID int, id int64, at time.Time) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.MarkNotificationRead(ctx, userID, id, at)
+}
+
+func (s *schemaRepository) MarkAllNotificationsRead(ctx context.Context, userID int, at time.Time) (int, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return tenant.MarkAllNotificationsRead(ctx, userID, at)
+}
+
+func (s *schemaRepository) GetNotificationPreferences(ctx context.Context, userID int) (model.NotificationPreferences, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return model.NotificationPreferences{}, err
+	}
+	return tenant.GetNotificationPreferences(ctx, userID)
+}
+
+func (s *schemaRepository) SetNotificationPreferences(ctx context.Context, userID int, prefs model.NotificationPreferences, at time.Time) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.SetNotificationPreferences(ctx, userID, prefs, at)
+}
+
+func (s *schemaRepository) Delete(ctx context.Context, id int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.Delete(ctx, id)
+}
+
+func (s *schemaRepository) ListAddresses(ctx context.Context, userID int) ([]model.Address, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ListAddresses(ctx, userID)
+}
+
+func (s *schemaRepository) GetAddress(ctx context.Context, userID, id int) (model.Address, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return model.Address{}, err
+	}
+	return tenant.GetAddress(ctx, userID, id)
+}
+
+func (s *schemaRepository) CreateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return address, err
+	}
+	return tenant.CreateAddress(ctx, address)
+}
+
+func (s *schemaRepository) UpdateAddress(ctx context.Context, address model.Address) (model.Address, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return address, err
+	}
+	return tenant.UpdateAddress(ctx, address)
+}
+
+func (s *schemaRepository) DeleteAddress(ctx context.Context, userID, id int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.DeleteAddress(ctx, userID, id)
+}
+
+func (s *schemaRepository) ListPhones(ctx context.Context, userID int) ([]model.Phone, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ListPhones(ctx, userID)
+}
+
+func (s *schemaRepository) CreatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return phone, err
+	}
+	return tenant.CreatePhone(ctx, phone)
+}
+
+func (s *schemaRepository) UpdatePhone(ctx context.Context, phone model.Phone) (model.Phone, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return phone, err
+	}
+	return tenant.UpdatePhone(ctx, phone)
+}
+
+func (s *schemaRepository) DeletePhone(ctx context.Context, userID, id int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.DeletePhone(ctx, userID, id)
+}
+
+func (s *schemaRepository) ListTeams(ctx context.Context) ([]model.Team, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return tenant.ListTeams(ctx)
+}
+
+func (s *schemaRepository) GetTeam(ctx context.Context, id int) (model.Team, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return model.Team{}, err
+	}
+	return tenant.GetTeam(ctx, id)
+}
+
+func (s *schemaRepository) CreateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return team, err
+	}
+	return tenant.CreateTeam(ctx, team)
+}
+
+func (s *schemaRepository) UpdateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return team, err
+	}
+	return tenant.UpdateTeam(ctx, team)
+}
+
+func (s *schemaRepository) DeleteTeam(ctx context.Context, id int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.DeleteTeam(ctx, id)
+}
+
+func (s *schemaRepository) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.AddTeamMember(ctx, teamID, userID)
+}
+
+func (s *schemaRepository) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	tenant, err := s.tenant(ctx)
+	if err != nil {
+		return err
+	}
+	return tenant.RemoveTeamMember(ctx, teamID, userID)
+}
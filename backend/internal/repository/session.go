@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"api/internal/model"
+)
+
+// SessionRepository persists the cookie sessions of logged in users. They
+// live in the shared schema and are looked up by the hash of their cookie,
+// whatever the organization of the request.
+type SessionRepository interface {
+	// CreateSession stores a session, forgetting those expired before now
+	CreateSession(ctx context.Context, session model.Session, now time.Time) error
+	GetSession(ctx context.Context, id string) (model.Session, error)
+	// DeleteSession forgets a session; unknown sessions are not an error
+	DeleteSession(ctx context.Context, id string) error
+}
+
+func (s *sqlRepository) CreateSession(ctx context.Context, session model.Session, now time.Time) error {
+	purge := s.d.rebind("DELETE FROM sessions WHERE expires_at < ?")
+	if _, err := s.conn(ctx).ExecContext(ctx, purge, now.UTC()); err != nil {
+		return err
+	}
+
+	query := s.d.rebind("INSERT INTO sessions (id, user_id, org_id, token_version, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)")
+	logQuery(query, session.UserID, session.OrgID, session.TokenVersion, session.CreatedAt, session.ExpiresAt)
+	_, err := s.conn(ctx).ExecContext(ctx, query, session.ID, session.UserID, session.OrgID, session.TokenVersion, session.CreatedAt.UTC(), session.ExpiresAt.UTC())
+	return err
+}
+
+func (s *sqlRepository) GetSession(ctx context.Context, id string) (model.Session, error) {
+	query := s.d.rebind("SELECT id, user_id, org_id, token_version, created_at, expires_at FROM sessions WHERE id = ?")
+	var session model.Session
+	err := s.conn(ctx).QueryRowContext(ctx, query, id).Scan(&session.ID, &session.UserID, &session.OrgID, &session.TokenVersion, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return session, model.NotFound("session")
+	}
+	return session, err
+}
+
+func (s *sqlRepository) DeleteSession(ctx context.Context, id string) error {
+	query := s.d.rebind("DELETE FROM sessions WHERE id = ?")
+	_, err := s.conn(ctx).ExecContext(ctx, query, id)
+	return err
+}
+
+func (m *memoryRepository) CreateSession(ctx context.Context, session model.Session, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, other := range m.sessions {
+		if other.ExpiresAt.Before(now) {
+			delete(m.sessions, id)
+		}
+	}
+	m.sessions[session.ID] = session
+	return nil
+}
+
+func (m *memoryRepository) GetSession(ctx context.Context, id string) (model.Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	session, ok := m.sessions[id]
+	if !ok {
+		return model.Session{}, model.NotFound("session")
+	}
+	return session, nil
+}
+
+func (m *memoryRepository) DeleteSession(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+	return nil
+}
@@ -0,0 +1,1191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+	_ "modernc.org/sqlite"
+
+	"api/internal/backoff"
+	"api/internal/metrics"
+	"api/internal/migrate"
+	"api/internal/model"
+	"api/internal/pii"
+	"api/migrations"
+)
+
+// dialect captures the differences between the supported SQL databases
+type dialect struct {
+	name       string
+	driver     string
+	like       string // case-insensitive match operator
+	returning  bool   // supports INSERT ... RETURNING
+	numberArgs bool   // uses $1, $2 placeholders instead of ?
+	truncate   string // statements removing every user with their addresses, phones and memberships, resetting ids
+	fullText   bool   // has the users.search_vector column
+}
+
+// Postgres connections come from a pgxpool, see openPostgres
+var postgresDialect = dialect{
+	name:       "postgres",
+	driver:     "pgx",
+	like:       "ILIKE",
+	returning:  true,
+	numberArgs: true,
+	truncate:   "TRUNCATE users, addresses, phones, team_members, sessions RESTART IDENTITY",
+	fullText:   true,
+}
+
+// LIKE is case-insensitive for ASCII text in SQLite
+var sqliteDialect = dialect{
+	name:      "sqlite",
+	driver:    "sqlite",
+	like:      "LIKE",
+	returning: true,
+	truncate:  "DELETE FROM users; DELETE FROM sessions; DELETE FROM sqlite_sequence WHERE name IN ('users', 'addresses', 'phones')",
+}
+
+// LIKE is case-insensitive under MySQL's default collations
+var mysqlDialect = dialect{
+	name:     "mysql",
+	driver:   "mysql",
+	like:     "LIKE",
+	truncate: "DELETE FROM users; DELETE FROM sessions; ALTER TABLE users AUTO_INCREMENT = 1; ALTER TABLE addresses AUTO_INCREMENT = 1; ALTER TABLE phones AUTO_INCREMENT = 1",
+}
+
+// rebind rewrites ? placeholders into the dialect's placeholder style
+func (d dialect) rebind(query string) string {
+	if !d.numberArgs {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// sqlRepository is a UserRepository backed by a database/sql connection
+type sqlRepository struct {
+	db   *sql.DB
+	d    dialect
+	pool *pgxpool.Pool // set for postgres only
+	// migrations is the directory of the migrations managing the schema,
+	// the dialect name unless set
+	migrations string
+	// pii, when set, encrypts the emails of users, see sealEmail
+	pii *pii.Cipher
+	// observer times the queries, see observedConn
+	observer *queryObserver
+	// queries tunes the timeouts and retries of queries
+	queries QueryConfig
+	// tenant is set for the repositories of tenant schemas, which share the
+	// observer of the shared schema
+	tenant bool
+	// replica, when set, serves the reads allowed by WithReplica, see reader
+	replica *sqlRepository
+	// stmts are the prepared statements of the hot queries, by query, nil
+	// for those failing to prepare
+	stmts   map[string]*sql.Stmt
+	stmtsMu sync.Mutex
+}
+
+// newSQLRepository opens a connection for the dialect and checks it, along
+// with one to the read replica at readDSN when set. The schema is managed by
+// migrations, see Migrator.
+func newSQLRepository(d dialect, dsn, readDSN string, poolCfg PoolConfig, queryCfg QueryConfig, cipher *pii.Cipher) (*sqlRepository, error) {
+	repo := &sqlRepository{d: d, pii: cipher, observer: &queryObserver{cfg: queryCfg}, queries: queryCfg}
+
+	switch d.name {
+	case "postgres":
+		pool, err := openPostgres(dsn, poolCfg, "")
+		if err != nil {
+			return nil, err
+		}
+		repo.pool = pool
+		// database/sql on top of the pgx pool, so all dialects share the same query code
+		repo.db = openPoolDB(pool, repo.observer)
+	default:
+		var mysqlCfg *mysql.Config
+		if d.name == "mysql" {
+			// scan DATE/TIMESTAMP columns into time.Time and report matched rather
+			// than changed rows, so updates with unchanged values aren't "not found"
+			cfg, err := mysql.ParseDSN(dsn)
+			if err != nil {
+				return nil, err
+			}
+			cfg.ParseTime = true
+			cfg.ClientFoundRows = true
+			cfg.MultiStatements = true // migration files hold several statements
+			if current := poolCfg.CurrentDSN; current != nil {
+				cfg.Apply(mysql.BeforeConnect(func(ctx context.Context, conn *mysql.Config) error {
+					rotated, err := mysql.ParseDSN(current())
+					if err != nil {
+						return err
+					}
+					conn.User, conn.Passwd = rotated.User, rotated.Passwd
+					return nil
+				}))
+			}
+			mysqlCfg = cfg
+		}
+
+		if d.name == "sqlite" {
+			// SQLite ignores foreign keys, and so ON DELETE CASCADE, unless enabled per connection
+			dsn = withSQLitePragma(dsn, "foreign_keys(1)")
+			// wait for the lock held by a concurrent write, such as the audit
+			// log of a request, instead of failing with SQLITE_BUSY at once
+			dsn = withSQLitePragma(dsn, "busy_timeout(5000)")
+		}
+
+		var connector driver.Connector
+		var err error
+		if mysqlCfg != nil {
+			connector, err = mysql.NewConnector(mysqlCfg)
+		} else {
+			connector, err = openConnector(d.driver, dsn)
+		}
+		if err != nil {
+			return nil, err
+		}
+		repo.observer.guard(connector)
+		db := sql.OpenDB(observedConnector{connector, repo.observer})
+		if poolCfg.MaxConns > 0 {
+			db.SetMaxOpenConns(int(poolCfg.MaxConns))
+		}
+		// idle connections keep the statements prepared on them, see prepared;
+		// zero keeps the database/sql default of 2
+		if poolCfg.MinConns > 0 {
+			db.SetMaxIdleConns(int(poolCfg.MinConns))
+		}
+		db.SetConnMaxLifetime(poolCfg.MaxConnLifetime)
+		repo.db = db
+	}
+	if err := repo.waitForDatabase(poolCfg); err != nil {
+		repo.Close()
+		return nil, fmt.Errorf("failed to connect to %s: %w", d.name, err)
+	}
+	repo.prepareStmts(context.Background())
+
+	if readDSN != "" {
+		replicaCfg := poolCfg
+		replicaCfg.CurrentDSN, replicaCfg.CurrentReadDSN = poolCfg.CurrentReadDSN, nil
+		replica, err := newSQLRepository(d, readDSN, "", replicaCfg, queryCfg, cipher)
+		if err != nil {
+			repo.Close()
+			return nil, fmt.Errorf("read replica: %w", err)
+		}
+		repo.replica = replica
+	}
+	return repo, nil
+}
+
+// maxStartupBackoff caps the delay between the pings of waitForDatabase
+const maxStartupBackoff = 5 * time.Second
+
+// waitForDatabase pings the database until it answers, for up to
+// cfg.StartupWait, so the server may start before it, as docker compose
+// does. Errors other than failing to reach it, such as wrong credentials,
+// aren't waited out.
+func (s *sqlRepository) waitForDatabase(cfg PoolConfig) error {
+	deadline := time.Now().Add(cfg.StartupWait)
+	for attempt := 1; ; attempt++ {
+		delay := backoff.Exponential(cfg.StartupBackoff, maxStartupBackoff, attempt)
+		err := s.db.Ping()
+		if err == nil || !(connectionError(err) || errors.Is(err, model.ErrUnavailable)) || time.Now().Add(delay).After(deadline) {
+			return err
+		}
+
+		log.Printf("Waiting %s for the %s database to accept connections (attempt %d): %v", delay, s.d.name, attempt, err)
+		time.Sleep(delay)
+	}
+}
+
+// openPoolDB opens database/sql on top of a pgx pool, which manages the
+// connections: database/sql keeps none idle, like stdlib.OpenDBFromPool
+func openPoolDB(pool *pgxpool.Pool, observer *queryObserver) *sql.DB {
+	connector := stdlib.GetPoolConnector(pool)
+	observer.guard(connector)
+	db := sql.OpenDB(observedConnector{connector, observer})
+	db.SetMaxIdleConns(0)
+	return db
+}
+
+// withSQLitePragma adds a pragma run by the modernc driver on every new connection
+func withSQLitePragma(dsn, pragma string) string {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return dsn + separator + "_pragma=" + pragma
+}
+
+// Migrator returns a migrator for the embedded migrations of the repository's dialect
+func (s *sqlRepository) Migrator() (*migrate.Migrator, error) {
+	dir := s.migrations
+	if dir == "" {
+		dir = s.d.name
+	}
+	list, err := migrate.Load(migrations.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+	// schema changes take what they take, whatever the query timeouts
+	return migrate.New(s.db, s.d.rebind, list).WithContext(withoutQueryTimeout(context.Background())), nil
+}
+
+// openPostgres creates a pgx connection pool, with zero values in poolCfg
+// keeping pgx defaults; a searchPath overrides the DSN's on every connection
+func openPostgres(dsn string, poolCfg PoolConfig, searchPath string) (*pgxpool.Pool, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if searchPath != "" {
+		cfg.ConnConfig.RuntimeParams["search_path"] = searchPath
+	}
+
+	if poolCfg.MaxConns > 0 {
+		cfg.MaxConns = poolCfg.MaxConns
+	}
+	if poolCfg.MinConns > 0 {
+		cfg.MinConns = poolCfg.MinConns
+	}
+	if poolCfg.MaxConnLifetime > 0 {
+		cfg.MaxConnLifetime = poolCfg.MaxConnLifetime
+	}
+	if poolCfg.HealthCheckPeriod > 0 {
+		cfg.HealthCheckPeriod = poolCfg.HealthCheckPeriod
+	}
+	if current := poolCfg.CurrentDSN; current != nil {
+		cfg.BeforeConnect = func(ctx context.Context, conn *pgx.ConnConfig) error {
+			rotated, err := pgx.ParseConfig(current())
+			if err != nil {
+				return err
+			}
+			conn.User, conn.Password = rotated.User, rotated.Password
+			return nil
+		}
+	}
+
+	return pgxpool.NewWithConfig(context.Background(), cfg)
+}
+
+const userColumns = "id, name, email, role, birth, age, timestamp, version, metadata, avatar, org_id, status, token_version, anonymized_at"
+
+// insertColumns are set when creating users
+const insertColumns = "name, email, email_index, canonical_email, role, birth, age, metadata, org_id, status, password_hash"
+
+// listColumns are loaded by listings that don't select fields: the
+// model.UserFields, the avatar, the organization, the status and the
+// anonymization time, which clients can't select
+var listColumns = append(append([]string{}, model.UserFields...), "avatar", "org_id", "status", "anonymized_at")
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (s *sqlRepository) scanUser(row scanner) (model.User, error) {
+	var user model.User
+	if err := row.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Birth, &user.Age, &user.Timestamp, &user.Version, &user.Metadata, &user.Avatar, &user.OrgID, &user.Status, &user.TokenVersion, &user.AnonymizedAt); err != nil {
+		return user, err
+	}
+	return user, s.openEmail(&user)
+}
+
+// knownFields drops the names that aren't model.UserFields, which keeps
+// client input out of the SELECT list
+func knownFields(fields []string) []string {
+	var known []string
+	for _, field := range fields {
+		for _, allowed := range model.UserFields {
+			if field == allowed {
+				known = append(known, field)
+				break
+			}
+		}
+	}
+	return known
+}
+
+// fieldPointers returns the scan destinations in user for the given fields;
+// they must come from model.UserFields, whose names match the columns
+func fieldPointers(user *model.User, fields []string) []interface{} {
+	dest := make([]interface{}, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "id":
+			dest[i] = &user.ID
+		case "name":
+			dest[i] = &user.Name
+		case "email":
+			dest[i] = &user.Email
+		case "role":
+			dest[i] = &user.Role
+		case "birth":
+			dest[i] = &user.Birth
+		case "age":
+			dest[i] = &user.Age
+		case "timestamp":
+			dest[i] = &user.Timestamp
+		case "version":
+			dest[i] = &user.Version
+		case "metadata":
+			dest[i] = &user.Metadata
+		case "avatar":
+			dest[i] = &user.Avatar
+		case "org_id":
+			dest[i] = &user.OrgID
+		case "status":
+			dest[i] = &user.Status
+		case "anonymized_at":
+			dest[i] = &user.AnonymizedAt
+		}
+	}
+	return dest
+}
+
+func (s *sqlRepository) List(ctx context.Context, params model.ListParams) ([]model.User, error) {
+	// load only the requested fields, and the id telling the users apart
+	fields := knownFields(params.Fields)
+	if len(fields) == 0 {
+		fields = listColumns
+	} else if !slices.Contains(fields, "id") {
+		fields = append([]string{"id"}, fields...)
+	}
+	query := "SELECT " + strings.Join(fields, ", ") + " FROM users"
+	where, args := s.where(ctx, params)
+	query += where
+
+	// encrypted emails sort in no useful order, and sorting them once
+	// decrypted would load every user for each page
+	if params.Sort == "email" && s.pii != nil {
+		return nil, model.ErrEncryptedSort
+	}
+
+	// Add sorting, breaking ties by id so that pages don't overlap
+	if sortField, exists := sortColumns[params.Sort]; exists {
+		orderDir := "ASC"
+		if params.Order == "desc" {
+			orderDir = "DESC"
+		}
+		query += " ORDER BY " + sortField + " " + orderDir + ", id " + orderDir
+	} else if tsquery := s.tsquery(params); tsquery != "" {
+		// full-text matches come best first
+		query += " ORDER BY ts_rank(search_vector, to_tsquery('simple', ?)) DESC, timestamp DESC, id DESC"
+		args = append(args, tsquery)
+	} else {
+		query += " ORDER BY timestamp DESC, id DESC" // default sort
+	}
+	if params.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, params.Limit, params.Offset)
+	}
+
+	query = s.d.rebind(query)
+	logQuery(query, args...)
+	rows, err := s.reader(ctx).conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(fieldPointers(&user, fields)...); err != nil {
+			return nil, err
+		}
+		if err := s.openEmail(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlRepository) Count(ctx context.Context, params model.ListParams) (int, error) {
+	where, args := s.where(ctx, params)
+	query := s.d.rebind("SELECT COUNT(*) FROM users" + where)
+	logQuery(query, args...)
+
+	var count int
+	err := s.reader(ctx).conn(ctx).QueryRowContext(ctx, query, args...).Scan(&count)
+	return count, err
+}
+
+func (s *sqlRepository) CountByRole(ctx context.Context, params model.ListParams) (map[string]int, error) {
+	where, args := s.where(ctx, params)
+	query := s.d.rebind("SELECT role, COUNT(*) FROM users" + where + " GROUP BY role")
+	logQuery(query, args...)
+	rows, err := s.reader(ctx).conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var role string
+		var count int
+		if err := rows.Scan(&role, &count); err != nil {
+			return nil, err
+		}
+		counts[role] = count
+	}
+	return counts, rows.Err()
+}
+
+// where builds the WHERE clause of a listing from its search and filters,
+// passing every value as a placeholder argument
+func (s *sqlRepository) where(ctx context.Context, params model.ListParams) (string, []interface{}) {
+	var args []interface{}
+	var conditions []string
+
+	// only list the users of the caller's organization
+	if org, ok := model.OrgFrom(ctx); ok {
+		conditions = append(conditions, "org_id = ?")
+		args = append(args, org)
+	}
+	// and, for callers limited to their teams, those sharing one with them
+	if scope, scopeArgs := teamCondition(ctx, "id"); scope != "" {
+		conditions = append(conditions, strings.TrimPrefix(scope, " AND "))
+		args = append(args, scopeArgs...)
+	}
+
+	// Add search conditions
+	like := func(search string) {
+		pattern := "%" + search + "%"
+		if s.pii != nil {
+			// encrypted emails only match whole, through their blind index
+			conditions = append(conditions, "(name "+s.d.like+" ? OR email_index = ? OR role "+s.d.like+" ?)")
+			args = append(args, pattern, s.pii.Index(emailField, strings.ToLower(strings.TrimSpace(search))), pattern)
+			return
+		}
+		conditions = append(conditions, "(name "+s.d.like+" ? OR email "+s.d.like+" ? OR role "+s.d.like+" ?)")
+		args = append(args, pattern, pattern, pattern)
+	}
+	if params.Search != "" {
+		like(params.Search)
+	}
+	if tsquery := s.tsquery(params); tsquery != "" {
+		conditions = append(conditions, "search_vector @@ to_tsquery('simple', ?)")
+		args = append(args, tsquery)
+	} else if params.Query != "" {
+		like(params.Query)
+	}
+
+	// Add filter conditions
+	f := params.Filter
+	if len(f.Roles) > 0 {
+		conditions = append(conditions, "role IN (?"+strings.Repeat(", ?", len(f.Roles)-1)+")")
+		for _, role := range f.Roles {
+			args = append(args, role)
+		}
+	}
+	add := func(condition string, arg interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, arg)
+	}
+	if f.AgeMin != nil {
+		add("age >= ?", *f.AgeMin)
+	}
+	if f.AgeMax != nil {
+		add("age <= ?", *f.AgeMax)
+	}
+	if f.BirthAfter != nil {
+		add("birth >= ?", *f.BirthAfter)
+	}
+	if f.BirthBefore != nil {
+		add("birth < ?", *f.BirthBefore)
+	}
+	if f.CreatedAfter != nil {
+		add("timestamp >= ?", f.CreatedAfter.UTC())
+	}
+	if f.CreatedBefore != nil {
+		add("timestamp < ?", f.CreatedBefore.UTC())
+	}
+	for _, key := range sortedKeys(f.Metadata) {
+		conditions = append(conditions, s.metadataText()+" = ?")
+		args = append(args, s.metadataKey(key), f.Metadata[key])
+	}
+	if len(f.Teams) > 0 {
+		conditions = append(conditions, "id IN (SELECT user_id FROM team_members WHERE team_id IN (?"+strings.Repeat(", ?", len(f.Teams)-1)+"))")
+		for _, team := range f.Teams {
+			args = append(args, team)
+		}
+	}
+
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// metadataText is the SQL expression of a metadata value as text, the
+// key being its placeholder
+func (s *sqlRepository) metadataText() string {
+	switch s.d.name {
+	case "sqlite":
+		return "CAST(json_extract(metadata, ?) AS TEXT)"
+	case "mysql":
+		return "JSON_UNQUOTE(JSON_EXTRACT(metadata, ?))"
+	default:
+		return "metadata->>?"
+	}
+}
+
+// metadataKey is the argument naming key in metadataText: a JSON path on
+// SQLite and MySQL, the key itself on Postgres. Keys match
+// model.MetadataKeyPattern, so they need no escaping.
+func (s *sqlRepository) metadataKey(key string) string {
+	if s.d.name == "postgres" {
+		return key
+	}
+	return `$."` + key + `"`
+}
+
+// sortedKeys returns the keys of m in alphabetical order, keeping queries
+// and their arguments stable
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// minFullTextLength is the shortest query searched with the full-text
+// index; shorter ones match too much to be worth ranking and use LIKE
+const minFullTextLength = 3
+
+// tsquery turns the full-text query of params into a prefix-matching
+// tsquery such as "ann:* & smith:*", or "" when the query should fall back
+// to LIKE. Only letters and digits are kept, so the result can't contain
+// tsquery syntax.
+func (s *sqlRepository) tsquery(params model.ListParams) string {
+	query := params.Query
+	if !s.d.fullText || params.PlainSearch || utf8.RuneCountInString(strings.TrimSpace(query)) < minFullTextLength {
+		return ""
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = word + ":*"
+	}
+	return strings.Join(words, " & ")
+}
+
+func (s *sqlRepository) Suggest(ctx context.Context, prefix string, limit int) ([]model.User, error) {
+	var condition string
+	var args []interface{}
+	switch s.d.name {
+	case "sqlite":
+		// SQLite only uses the lower(name) index for range scans
+		condition = "(lower(name) >= ? AND lower(name) < ?) OR (email >= ? AND email < ?)"
+		args = []interface{}{prefix, prefix + "\uffff", prefix, prefix + "\uffff"}
+	case "mysql":
+		// MySQL's default collation is case-insensitive
+		condition = "name LIKE ? OR email LIKE ?"
+		args = []interface{}{escapeLike(prefix) + "%", escapeLike(prefix) + "%"}
+	default:
+		condition = "lower(name) LIKE ? OR email LIKE ?"
+		args = []interface{}{escapeLike(prefix) + "%", escapeLike(prefix) + "%"}
+	}
+	if s.pii != nil {
+		// encrypted emails have no prefix to match, the names are suggested alone
+		condition = strings.SplitN(condition, " OR ", 2)[0]
+		args = args[:len(args)/2]
+	}
+
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	teams, teamArgs := teamCondition(ctx, "id")
+	query := s.d.rebind("SELECT id, name, email FROM users WHERE (" + condition + ")" + scope + teams + " ORDER BY name LIMIT ?")
+	args = append(append(append(args, scopeArgs...), teamArgs...), limit)
+	logQuery(query, args...)
+	rows, err := s.reader(ctx).conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		var user model.User
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+			return nil, err
+		}
+		if err := s.openEmail(&user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlRepository) Birthdays(ctx context.Context, days []string) ([]model.User, error) {
+	if len(days) == 0 {
+		return nil, nil
+	}
+	var monthDay string
+	switch s.d.name {
+	case "sqlite":
+		// dates are stored as text starting with YYYY-MM-DD
+		monthDay = "substr(birth, 6, 5)"
+	case "mysql":
+		monthDay = "DATE_FORMAT(birth, '%m-%d')"
+	default:
+		monthDay = "to_char(birth, 'MM-DD')"
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(days)), ", ")
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("SELECT " + userColumns + " FROM users WHERE " + monthDay + " IN (" + placeholders + ") AND status = ? AND anonymized_at IS NULL" + scope + " ORDER BY id")
+	args := make([]interface{}, 0, len(days)+2)
+	for _, day := range days {
+		args = append(args, day)
+	}
+	args = append(append(args, model.UserActive), scopeArgs...)
+	logQuery(query, args...)
+
+	rows, err := s.reader(ctx).conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []model.User
+	for rows.Next() {
+		user, err := s.scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// orgCondition returns " AND <column> = ?" and the organization ctx is
+// scoped to as its argument, or nothing for unscoped contexts
+func orgCondition(ctx context.Context, column string) (string, []interface{}) {
+	if org, ok := model.OrgFrom(ctx); ok {
+		return " AND " + column + " = ?", []interface{}{org}
+	}
+	return "", nil
+}
+
+// teamCondition returns " AND (...)" limiting the user ID column to the
+// user ctx is team scoped to and their teammates, with its arguments, or
+// nothing for contexts listing every user
+func teamCondition(ctx context.Context, column string) (string, []interface{}) {
+	userID, ok := model.TeamScopeFrom(ctx)
+	if !ok {
+		return "", nil
+	}
+	return " AND (" + column + " = ? OR " + column + " IN (SELECT member.user_id FROM team_members member" +
+		" JOIN team_members own ON own.team_id = member.team_id WHERE own.user_id = ?))", []interface{}{userID, userID}
+}
+
+// ownerOrg is the organization new rows belong to: the one ctx is scoped
+// to, or the default organization for unscoped contexts
+func ownerOrg(ctx context.Context) int {
+	if org, ok := model.OrgFrom(ctx); ok {
+		return org
+	}
+	return model.DefaultOrgID
+}
+
+// escapeLike escapes the LIKE wildcards in s with backslashes, the default escape character
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
+
+func (s *sqlRepository) Get(ctx context.Context, id int) (model.User, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.getUserQuery(scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	user, err := s.scanUser(s.reader(ctx).queryRowPrepared(ctx, nil, query, args...))
+	if err == sql.ErrNoRows {
+		return user, model.NotFound("user")
+	}
+	return user, err
+}
+
+// getTx loads the user within tx, seeing the writes made by it
+func (s *sqlRepository) getTx(ctx context.Context, tx *sql.Tx, id int) (model.User, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.getUserQuery(scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	user, err := s.scanUser(s.queryRowPrepared(ctx, tx, query, args...))
+	if err == sql.ErrNoRows {
+		return user, model.NotFound("user")
+	}
+	return user, err
+}
+
+func (s *sqlRepository) GetByEmail(ctx context.Context, email string) (model.User, error) {
+	condition, args := "email = ?", []interface{}{email}
+	if s.pii != nil {
+		// emails not encrypted yet are still found by themselves
+		condition, args = "(email_index = ? OR email = ?)", []interface{}{s.pii.Index(emailField, email), email}
+	}
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("SELECT " + userColumns + ", password_hash FROM users WHERE " + condition + scope)
+	args = append(args, scopeArgs...)
+	logQuery(query, args...)
+
+	var user model.User
+	err := s.reader(ctx).conn(ctx).QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Birth, &user.Age,
+		&user.Timestamp, &user.Version, &user.Metadata, &user.Avatar, &user.OrgID, &user.Status, &user.TokenVersion, &user.AnonymizedAt, &user.PasswordHash)
+	if err == sql.ErrNoRows {
+		return user, model.NotFound("user")
+	}
+	if err != nil {
+		return user, err
+	}
+	return user, s.openEmail(&user)
+}
+
+func (s *sqlRepository) Create(ctx context.Context, user model.User) (model.User, error) {
+	return retryValue(ctx, s.queries, func() (model.User, error) { return s.createOnce(ctx, user) })
+}
+
+func (s *sqlRepository) createOnce(ctx context.Context, user model.User) (model.User, error) {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return user, err
+	}
+	defer s.rollback(ctx, tx)
+
+	if user, err = s.createTx(ctx, tx, user); err != nil {
+		return user, err
+	}
+	return user, s.commit(ctx, tx)
+}
+
+// createTx creates the user within tx, along with its event
+func (s *sqlRepository) createTx(ctx context.Context, tx *sql.Tx, user model.User) (model.User, error) {
+	user.OrgID = ownerOrg(ctx)
+	if user.Status == "" {
+		user.Status = model.UserActive
+	}
+	email, emailIndex, err := s.sealEmail(user.Email)
+	if err != nil {
+		return user, err
+	}
+	query := s.createUserQuery()
+	args := []interface{}{user.Name, email, emailIndex, s.canonicalKey(user.CanonicalEmail), user.Role, user.Birth, user.Age, user.Metadata, user.OrgID, user.Status, user.PasswordHash}
+	logged := args[:len(args)-1] // the password hash stays out of the log
+
+	if err := s.checkPlainEmail(ctx, tx, user.Email, 0); err != nil {
+		return user, err
+	}
+
+	if s.d.returning {
+		logQuery(query, logged...)
+		if err := s.queryRowPrepared(ctx, tx, query, args...).Scan(&user.ID, &user.Timestamp, &user.Version); err != nil {
+			return user, translateError(err)
+		}
+	} else {
+		logQuery(query, logged...)
+		result, err := s.execPrepared(ctx, tx, query, args...)
+		if err != nil {
+			return user, translateError(err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return user, err
+		}
+		if user, err = s.getTx(ctx, tx, int(id)); err != nil {
+			return user, err
+		}
+	}
+
+	return user, s.addEvent(ctx, tx, model.EventUserCreated, user, nil)
+}
+
+func (s *sqlRepository) Update(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	return retryValue(ctx, s.queries, func() (model.User, error) { return s.updateOnce(ctx, id, user, rev) })
+}
+
+func (s *sqlRepository) updateOnce(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	email, emailIndex, err := s.sealEmail(user.Email)
+	if err != nil {
+		return user, err
+	}
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return user, err
+	}
+	defer s.rollback(ctx, tx)
+
+	// the version check makes concurrent edits fail instead of overwriting each other;
+	// nil metadata is NULL and keeps the stored value
+	if err := s.checkPlainEmail(ctx, tx, user.Email, id); err != nil {
+		return user, err
+	}
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.updateUserQuery(scope)
+	args := append([]interface{}{user.Name, email, emailIndex, s.canonicalKey(user.CanonicalEmail), user.Role, user.Birth, user.Age, user.Metadata, id, user.Version}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.execPrepared(ctx, tx, query, args...)
+	if err != nil {
+		return user, translateError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return user, err
+	}
+	if rowsAffected == 0 {
+		// either the user is gone or someone else updated it first
+		s.rollback(ctx, tx)
+		if _, err := s.Get(ctx, id); err != nil {
+			return user, err
+		}
+		return user, model.ErrVersionConflict
+	}
+
+	rev.UserID = id
+	rev.Version = user.Version + 1
+	if err := s.insertRevision(ctx, tx, rev); err != nil {
+		return user, err
+	}
+
+	// Get updated user data
+	updated, err := s.getTx(ctx, tx, id)
+	if err != nil {
+		return user, err
+	}
+	if err := s.addEvent(ctx, tx, model.EventUserUpdated, updated, rev.Changes); err != nil {
+		return user, err
+	}
+	return updated, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) SetAvatar(ctx context.Context, id int, key string) error {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE users SET avatar = ? WHERE id = ?" + scope)
+	args := append([]interface{}{key, id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("user")
+	}
+	return nil
+}
+
+func (s *sqlRepository) SetStatus(ctx context.Context, id int, status string) error {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE users SET status = ? WHERE id = ?" + scope)
+	args := append([]interface{}{status, id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("user")
+	}
+	return nil
+}
+
+func (s *sqlRepository) RevokeTokens(ctx context.Context, id int) error {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE users SET token_version = token_version + 1 WHERE id = ?" + scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("user")
+	}
+	return nil
+}
+
+func (s *sqlRepository) SetPassword(ctx context.Context, id int, hash string, tokenVersion int) error {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE users SET password_hash = ?, status = ?, token_version = token_version + 1 WHERE id = ? AND token_version = ?" + scope)
+	args := append([]interface{}{hash, model.UserActive, id, tokenVersion}, scopeArgs...)
+	logQuery(query, args[1:]...) // the password hash stays out of the log
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		// either the user is gone or its tokens were revoked in the meantime
+		if _, err := s.Get(ctx, id); err != nil {
+			return err
+		}
+		return model.ErrVersionConflict
+	}
+	return nil
+}
+
+func (s *sqlRepository) Anonymize(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	return retryValue(ctx, s.queries, func() (model.User, error) { return s.anonymizeOnce(ctx, id, user, rev) })
+}
+
+func (s *sqlRepository) anonymizeOnce(ctx context.Context, id int, user model.User, rev model.Revision) (model.User, error) {
+	current, err := s.Get(ctx, id)
+	if err != nil {
+		return user, err
+	}
+	if current.AnonymizedAt != nil {
+		return user, model.ErrAlreadyAnonymized
+	}
+	email, emailIndex, err := s.sealEmail(user.Email)
+	if err != nil {
+		return user, err
+	}
+
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return user, err
+	}
+	defer s.rollback(ctx, tx)
+
+	// the version and anonymized_at checks keep concurrent edits and anonymizations out
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE users SET name = ?, email = ?, email_index = ?, canonical_email = NULL, birth = ?, age = ?, metadata = ?, avatar = '', password_hash = '', " +
+		"anonymized_at = ?, version = version + 1, token_version = token_version + 1 WHERE id = ? AND version = ? AND anonymized_at IS NULL" + scope)
+	args := append([]interface{}{user.Name, email, emailIndex, user.Birth, user.Age, model.Metadata{}, user.AnonymizedAt.UTC(), id, current.Version}, scopeArgs...)
+	logQuery(query, args...)
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return user, translateError(err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return user, err
+	}
+	if rowsAffected == 0 {
+		return user, model.ErrVersionConflict
+	}
+
+	if err := s.scrubRevisions(ctx, tx, id); err != nil {
+		return user, err
+	}
+	rev.UserID = id
+	rev.Version = current.Version + 1
+	if err := s.insertRevision(ctx, tx, rev); err != nil {
+		return user, err
+	}
+
+	deletes := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM addresses WHERE user_id = ?", []interface{}{id}},
+		{"DELETE FROM phones WHERE user_id = ?", []interface{}{id}},
+		// user ids are only unique within an organization when tenants have schemas of their own
+		{"DELETE FROM invitations WHERE org_id = ? AND (user_id = ? OR email = ?)", []interface{}{current.OrgID, id, current.Email}},
+	}
+	for _, del := range deletes {
+		query := s.d.rebind(del.query)
+		logQuery(query, del.args...)
+		if _, err := tx.ExecContext(ctx, query, del.args...); err != nil {
+			return user, err
+		}
+	}
+
+	// the earlier events of the user carry the personal data just scrubbed
+	if err := s.scrubEvents(ctx, tx, current.OrgID, id); err != nil {
+		return user, err
+	}
+	anonymized, err := s.getTx(ctx, tx, id)
+	if err != nil {
+		return user, err
+	}
+	if err := s.addEvent(ctx, tx, model.EventUserAnonymized, anonymized, rev.Changes); err != nil {
+		return user, err
+	}
+	return anonymized, s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) Delete(ctx context.Context, id int) error {
+	return retry(ctx, s.queries, func() error { return s.deleteOnce(ctx, id) })
+}
+
+func (s *sqlRepository) deleteOnce(ctx context.Context, id int) error {
+	tx, err := s.beginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer s.rollback(ctx, tx)
+
+	// the event describes the user as it was before it was deleted
+	user, err := s.getTx(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.deleteUserQuery(scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.execPrepared(ctx, tx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("user")
+	}
+	if err := s.addEvent(ctx, tx, model.EventUserDeleted, user, nil); err != nil {
+		return err
+	}
+	return s.commit(ctx, tx)
+}
+
+func (s *sqlRepository) Truncate(ctx context.Context) error {
+	logQuery(s.d.truncate)
+	_, err := s.conn(ctx).ExecContext(ctx, s.d.truncate)
+	return err
+}
+
+func (s *sqlRepository) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqlRepository) Close() error {
+	if !s.tenant {
+		s.observer.breaker.Stop()
+	}
+	s.closeStmts()
+	err := s.db.Close()
+	if s.pool != nil {
+		s.pool.Close()
+	}
+	if s.replica != nil {
+		s.replica.Close()
+	}
+	return err
+}
+
+// PoolStats reports the connection pool usage, from pgxpool for postgres and database/sql otherwise
+func (s *sqlRepository) PoolStats() map[string]interface{} {
+	if s.pool != nil {
+		stat := s.pool.Stat()
+		return map[string]interface{}{
+			"max_conns":              stat.MaxConns(),
+			"total_conns":            stat.TotalConns(),
+			"idle_conns":             stat.IdleConns(),
+			"acquired_conns":         stat.AcquiredConns(),
+			"constructing_conns":     stat.ConstructingConns(),
+			"acquire_count":          stat.AcquireCount(),
+			"empty_acquire_count":    stat.EmptyAcquireCount(),
+			"canceled_acquire_count": stat.CanceledAcquireCount(),
+			"acquire_duration":       stat.AcquireDuration().String(),
+			"new_conns_count":        stat.NewConnsCount(),
+			"max_lifetime_destroys":  stat.MaxLifetimeDestroyCount(),
+			"max_idle_destroys":      stat.MaxIdleDestroyCount(),
+		}
+	}
+
+	stat := s.db.Stats()
+	return map[string]interface{}{
+		"max_open_connections": stat.MaxOpenConnections,
+		"open_connections":     stat.OpenConnections,
+		"in_use":               stat.InUse,
+		"idle":                 stat.Idle,
+		"wait_count":           stat.WaitCount,
+		"wait_duration":        stat.WaitDuration.String(),
+		"max_lifetime_closed":  stat.MaxLifetimeClosed,
+	}
+}
+
+// PoolMetrics reports the database/sql pool every dialect queries through,
+// and for postgres the pgxpool under it, where waits for a connection
+// happen when the pool is exhausted
+func (s *sqlRepository) PoolMetrics() []metrics.Sample {
+	stat := s.db.Stats()
+	samples := []metrics.Sample{
+		{Name: "db_max_open_connections", Help: "Maximum number of open connections to the database, 0 for unlimited.", Type: metrics.Gauge, Value: float64(stat.MaxOpenConnections)},
+		{Name: "db_open_connections", Help: "Number of established connections to the database.", Type: metrics.Gauge, Value: float64(stat.OpenConnections)},
+		{Name: "db_in_use_connections", Help: "Number of connections in use.", Type: metrics.Gauge, Value: float64(stat.InUse)},
+		{Name: "db_idle_connections", Help: "Number of idle connections.", Type: metrics.Gauge, Value: float64(stat.Idle)},
+		{Name: "db_wait_count_total", Help: "Total number of connections waited for.", Type: metrics.Counter, Value: float64(stat.WaitCount)},
+		{Name: "db_wait_duration_seconds_total", Help: "Total time blocked waiting for a connection.", Type: metrics.Counter, Value: stat.WaitDuration.Seconds()},
+		{Name: "db_max_idle_closed_total", Help: "Total number of connections closed due to the idle connection limit.", Type: metrics.Counter, Value: float64(stat.MaxIdleClosed)},
+		{Name: "db_max_idle_time_closed_total", Help: "Total number of connections closed due to their idle time.", Type: metrics.Counter, Value: float64(stat.MaxIdleTimeClosed)},
+		{Name: "db_max_lifetime_closed_total", Help: "Total number of connections closed due to their lifetime.", Type: metrics.Counter, Value: float64(stat.MaxLifetimeClosed)},
+	}
+	if s.pool == nil {
+		return samples
+	}
+
+	pool := s.pool.Stat()
+	return append(samples,
+		metrics.Sample{Name: "db_pgxpool_max_conns", Help: "Maximum size of the pgx pool.", Type: metrics.Gauge, Value: float64(pool.MaxConns())},
+		metrics.Sample{Name: "db_pgxpool_total_conns", Help: "Number of connections in the pgx pool.", Type: metrics.Gauge, Value: float64(pool.TotalConns())},
+		metrics.Sample{Name: "db_pgxpool_acquired_conns", Help: "Number of connections of the pgx pool in use.", Type: metrics.Gauge, Value: float64(pool.AcquiredConns())},
+		metrics.Sample{Name: "db_pgxpool_idle_conns", Help: "Number of idle connections in the pgx pool.", Type: metrics.Gauge, Value: float64(pool.IdleConns())},
+		metrics.Sample{Name: "db_pgxpool_acquire_count_total", Help: "Total number of connections acquired from the pgx pool.", Type: metrics.Counter, Value: float64(pool.AcquireCount())},
+		metrics.Sample{Name: "db_pgxpool_empty_acquire_count_total", Help: "Total number of acquires that waited for a connection because the pgx pool was empty.", Type: metrics.Counter, Value: float64(pool.EmptyAcquireCount())},
+		metrics.Sample{Name: "db_pgxpool_canceled_acquire_count_total", Help: "Total number of acquires canceled while waiting.", Type: metrics.Counter, Value: float64(pool.CanceledAcquireCount())},
+		metrics.Sample{Name: "db_pgxpool_acquire_duration_seconds_total", Help: "Total time spent acquiring connections from the pgx pool.", Type: metrics.Counter, Value: pool.AcquireDuration().Seconds()},
+	)
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"api/internal/model"
+)
+
+// TestStores runs the same cases against every store the tests can open
+// without a server, so that they behave alike
+func TestStores(t *testing.T) {
+	stores := []struct {
+		name string
+		open func(t *testing.T) UserRepository
+	}{
+		{"memory", func(t *testing.T) UserRepository {
+			repo, err := Open(Config{Driver: "memory"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return repo
+		}},
+		{"sqlite", func(t *testing.T) UserRepository { return openSQLite(t, nil) }},
+	}
+
+	newUser := func(name, email, role string, birthYear int) model.User {
+		return model.User{Name: name, Email: email, Role: role, Metadata: model.Metadata{}, Birth: model.NewDate(time.Date(birthYear, 1, 1, 0, 0, 0, 0, time.UTC))}
+	}
+	tests := []struct {
+		name string
+		run  func(t *testing.T, repo UserRepository)
+	}{
+		{"create and get", func(t *testing.T, repo UserRepository) {
+			created, err := repo.Create(context.Background(), newUser("Ann", "ann@example.com", "user", 1990))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := repo.Get(context.Background(), created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Name != "Ann" || got.Email != "ann@example.com" || got.Version != created.Version {
+				t.Errorf("got %+v, want %+v", got, created)
+			}
+		}},
+		{"duplicate email", func(t *testing.T, repo UserRepository) {
+			if _, err := repo.Create(context.Background(), newUser("Ann", "ann@example.com", "user", 1990)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Create(context.Background(), newUser("Other Ann", "ann@example.com", "user", 1991)); !errors.Is(err, model.ErrConflict) {
+				t.Fatalf("got %v, want a conflict", err)
+			}
+		}},
+		{"stale update", func(t *testing.T, repo UserRepository) {
+			ctx := context.Background()
+			created, err := repo.Create(ctx, newUser("Ann", "ann@example.com", "user", 1990))
+			if err != nil {
+				t.Fatal(err)
+			}
+			changed := created
+			changed.Name = "Ann Lee"
+			updated, err := repo.Update(ctx, created.ID, changed, model.Revision{Changes: created.Changes(changed)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Version != created.Version+1 {
+				t.Errorf("got version %d, want %d", updated.Version, created.Version+1)
+			}
+			// changed still has the version before the update
+			if _, err := repo.Update(ctx, created.ID, changed, model.Revision{}); !errors.Is(err, model.ErrVersionConflict) {
+				t.Fatalf("got %v, want a version conflict", err)
+			}
+		}},
+		{"list", func(t *testing.T, repo UserRepository) {
+			ctx := context.Background()
+			for _, user := range []model.User{
+				newUser("Cid", "cid@example.com", "admin", 1980),
+				newUser("Ann", "ann@example.com", "user", 1990),
+				newUser("Bob", "bob@example.com", "user", 2000),
+			} {
+				if _, err := repo.Create(ctx, user); err != nil {
+					t.Fatal(err)
+				}
+			}
+			params := model.ListParams{Filter: model.UserFilter{Roles: []string{"user"}}, Sort: "name", Order: "desc"}
+			users, err := repo.List(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 2 || users[0].Name != "Bob" || users[1].Name != "Ann" {
+				t.Errorf("got %+v, want Bob and Ann", users)
+			}
+			count, err := repo.Count(ctx, params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if count != 2 {
+				t.Errorf("counted %d, want 2", count)
+			}
+			params.Limit, params.Offset = 1, 1
+			if users, err = repo.List(ctx, params); err != nil {
+				t.Fatal(err)
+			}
+			if len(users) != 1 || users[0].Name != "Ann" {
+				t.Errorf("got page %+v, want Ann", users)
+			}
+		}},
+		{"delete", func(t *testing.T, repo UserRepository) {
+			ctx := context.Background()
+			created, err := repo.Create(ctx, newUser("Ann", "ann@example.com", "user", 1990))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := repo.Delete(ctx, created.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := repo.Get(ctx, created.ID); !errors.Is(err, model.ErrNotFound) {
+				t.Fatalf("got %v after deleting, want not found", err)
+			}
+			if err := repo.Delete(ctx, created.ID); !errors.Is(err, model.ErrNotFound) {
+				t.Fatalf("deleting again got %v, want not found", err)
+			}
+		}},
+		{"organizations", func(t *testing.T, repo UserRepository) {
+			created, err := repo.Create(context.Background(), newUser("Ann", "ann@example.com", "user", 1990))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other := model.WithOrg(context.Background(), created.OrgID+1)
+			if _, err := repo.Get(other, created.ID); !errors.Is(err, model.ErrNotFound) {
+				t.Fatalf("got %v from another organization, want not found", err)
+			}
+		}},
+	}
+	for _, store := range stores {
+		for _, tt := range tests {
+			t.Run(store.name+"/"+tt.name, func(t *testing.T) {
+				tt.run(t, store.open(t))
+			})
+		}
+	}
+}
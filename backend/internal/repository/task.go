@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"api/internal/model"
+)
+
+// TaskRepository records the runs of the recurring tasks. Every instance
+// schedules the same tasks; claiming a run first makes sure only one of
+// them performs it.
+type TaskRepository interface {
+	// ClaimTaskRun records that the run of the task due at scheduledAt
+	// started at now, returning false when another instance claimed it, or
+	// a later one, already
+	ClaimTaskRun(ctx context.Context, task string, scheduledAt, now time.Time) (bool, error)
+	// FinishTaskRun records the end of the run due at scheduledAt, with the
+	// error it failed with, empty when it succeeded
+	FinishTaskRun(ctx context.Context, task string, scheduledAt, now time.Time, lastError string) error
+	// ListTaskRuns returns the latest run of every task that ran
+	ListTaskRuns(ctx context.Context) ([]model.TaskRun, error)
+}
+
+func (s *sqlRepository) ClaimTaskRun(ctx context.Context, task string, scheduledAt, now time.Time) (bool, error) {
+	query := s.d.rebind("UPDATE scheduled_tasks SET scheduled_at = ?, started_at = ?, finished_at = NULL, last_error = '' WHERE name = ? AND scheduled_at < ?")
+	args := []interface{}{scheduledAt.UTC(), now.UTC(), task, scheduledAt.UTC()}
+	logQuery(query, args...)
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	if n == 1 {
+		return true, nil
+	}
+
+	// the task never ran, or this run is claimed already
+	insert := s.d.rebind("INSERT INTO scheduled_tasks (name, scheduled_at, started_at, last_error) VALUES (?, ?, ?, '')")
+	logQuery(insert, task, scheduledAt.UTC(), now.UTC())
+	if _, err := s.conn(ctx).ExecContext(ctx, insert, task, scheduledAt.UTC(), now.UTC()); err != nil {
+		if _, ok := uniqueViolation(err); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *sqlRepository) FinishTaskRun(ctx context.Context, task string, scheduledAt, now time.Time, lastError string) error {
+	query := s.d.rebind("UPDATE scheduled_tasks SET finished_at = ?, last_error = ? WHERE name = ? AND scheduled_at = ?")
+	args := []interface{}{now.UTC(), lastError, task, scheduledAt.UTC()}
+	logQuery(query, args...)
+	_, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	return err
+}
+
+func (s *sqlRepository) ListTaskRuns(ctx context.Context) ([]model.TaskRun, error) {
+	query := "SELECT name, scheduled_at, started_at, finished_at, last_error FROM scheduled_tasks ORDER BY name"
+	logQuery(query)
+	rows, err := s.conn(ctx).QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var runs []model.TaskRun
+	for rows.Next() {
+		var run model.TaskRun
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&run.Task, &run.ScheduledAt, &run.StartedAt, &finishedAt, &run.Error); err != nil {
+			return nil, err
+		}
+		if finishedAt.Valid {
+			run.FinishedAt = &finishedAt.Time
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+func (m *memoryRepository) ClaimTaskRun(ctx context.Context, task string, scheduledAt, now time.Time) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if run, ok := m.taskRuns[task]; ok && !run.ScheduledAt.Before(scheduledAt) {
+		return false, nil
+	}
+	m.taskRuns[task] = model.TaskRun{Task: task, ScheduledAt: scheduledAt, StartedAt: now}
+	return true, nil
+}
+
+func (m *memoryRepository) FinishTaskRun(ctx context.Context, task string, scheduledAt, now time.Time, lastError string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if run, ok := m.taskRuns[task]; ok && run.ScheduledAt.Equal(scheduledAt) {
+		run.FinishedAt = &now
+		run.Error = lastError
+		m.taskRuns[task] = run
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListTaskRuns(ctx context.Context) ([]model.TaskRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	runs := make([]model.TaskRun, 0, len(m.taskRuns))
+	for _, run := range m.taskRuns {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Task < runs[j].Task })
+	return runs, nil
+}
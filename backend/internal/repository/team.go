@@ -0,0 +1,284 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"api/internal/model"
+)
+
+// TeamRepository persists teams and their memberships. Users are listed
+// by team through the Teams filter of List.
+type TeamRepository interface {
+	ListTeams(ctx context.Context) ([]model.Team, error)
+	GetTeam(ctx context.Context, id int) (model.Team, error)
+	CreateTeam(ctx context.Context, team model.Team) (model.Team, error)
+	UpdateTeam(ctx context.Context, team model.Team) (model.Team, error)
+	DeleteTeam(ctx context.Context, id int) error
+	// AddTeamMember makes the user a member of the team; it is not an
+	// error for them to be one already
+	AddTeamMember(ctx context.Context, teamID, userID int) error
+	RemoveTeamMember(ctx context.Context, teamID, userID int) error
+}
+
+// errDuplicateTeam is returned when the organization already has a team of the same name
+var errDuplicateTeam = model.Conflict("name")
+
+// teamQuery selects teams with the number of their members
+const teamQuery = "SELECT t.id, t.name, t.description, t.org_id, COUNT(m.user_id) FROM teams t LEFT JOIN team_members m ON m.team_id = t.id"
+
+// teamGroupBy closes teamQuery, counting the members per team
+const teamGroupBy = " GROUP BY t.id, t.name, t.description, t.org_id"
+
+func scanTeam(row scanner) (model.Team, error) {
+	var team model.Team
+	err := row.Scan(&team.ID, &team.Name, &team.Description, &team.OrgID, &team.MemberCount)
+	return team, err
+}
+
+func (s *sqlRepository) ListTeams(ctx context.Context) ([]model.Team, error) {
+	query := teamQuery
+	var args []interface{}
+	if org, ok := model.OrgFrom(ctx); ok {
+		query += " WHERE t.org_id = ?"
+		args = append(args, org)
+	}
+	query = s.d.rebind(query + teamGroupBy + " ORDER BY t.name")
+	logQuery(query, args...)
+	rows, err := s.conn(ctx).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []model.Team{}
+	for rows.Next() {
+		team, err := scanTeam(rows)
+		if err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+func (s *sqlRepository) GetTeam(ctx context.Context, id int) (model.Team, error) {
+	scope, scopeArgs := orgCondition(ctx, "t.org_id")
+	query := s.d.rebind(teamQuery + " WHERE t.id = ?" + scope + teamGroupBy)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	team, err := scanTeam(s.conn(ctx).QueryRowContext(ctx, query, args...))
+	if err == sql.ErrNoRows {
+		return team, model.NotFound("team")
+	}
+	return team, err
+}
+
+func (s *sqlRepository) CreateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	team.OrgID = ownerOrg(ctx)
+	query := "INSERT INTO teams (name, description, org_id) VALUES (?, ?, ?)"
+	args := []interface{}{team.Name, team.Description, team.OrgID}
+
+	var err error
+	if s.d.returning {
+		query = s.d.rebind(query + " RETURNING id")
+		logQuery(query, args...)
+		err = s.conn(ctx).QueryRowContext(ctx, query, args...).Scan(&team.ID)
+	} else {
+		query = s.d.rebind(query)
+		logQuery(query, args...)
+		var result sql.Result
+		if result, err = s.conn(ctx).ExecContext(ctx, query, args...); err == nil {
+			var id int64
+			id, err = result.LastInsertId()
+			team.ID = int(id)
+		}
+	}
+	if _, ok := uniqueViolation(err); ok {
+		return team, errDuplicateTeam
+	}
+	return team, err
+}
+
+func (s *sqlRepository) UpdateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("UPDATE teams SET name = ?, description = ? WHERE id = ?" + scope)
+	args := append([]interface{}{team.Name, team.Description, team.ID}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if _, ok := uniqueViolation(err); ok {
+		return team, errDuplicateTeam
+	}
+	if err != nil {
+		return team, err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return team, err
+	}
+	if rowsAffected == 0 {
+		return team, model.NotFound("team")
+	}
+	return s.GetTeam(ctx, team.ID)
+}
+
+func (s *sqlRepository) DeleteTeam(ctx context.Context, id int) error {
+	scope, scopeArgs := orgCondition(ctx, "org_id")
+	query := s.d.rebind("DELETE FROM teams WHERE id = ?" + scope)
+	args := append([]interface{}{id}, scopeArgs...)
+	logQuery(query, args...)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("team")
+	}
+	return nil
+}
+
+func (s *sqlRepository) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	query := s.d.rebind("INSERT INTO team_members (team_id, user_id) VALUES (?, ?)")
+	logQuery(query, teamID, userID)
+
+	_, err := s.conn(ctx).ExecContext(ctx, query, teamID, userID)
+	if _, ok := uniqueViolation(err); ok {
+		return nil
+	}
+	return err
+}
+
+func (s *sqlRepository) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	query := s.d.rebind("DELETE FROM team_members WHERE team_id = ? AND user_id = ?")
+	logQuery(query, teamID, userID)
+
+	result, err := s.conn(ctx).ExecContext(ctx, query, teamID, userID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return model.NotFound("member")
+	}
+	return nil
+}
+
+func (m *memoryRepository) ListTeams(ctx context.Context) ([]model.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	teams := make([]model.Team, 0, len(m.teams))
+	for _, team := range m.teams {
+		if !visible(ctx, team.OrgID) {
+			continue
+		}
+		team.MemberCount = len(m.teamMembers[team.ID])
+		teams = append(teams, team)
+	}
+	sort.Slice(teams, func(i, j int) bool { return teams[i].Name < teams[j].Name })
+	return teams, nil
+}
+
+func (m *memoryRepository) GetTeam(ctx context.Context, id int) (model.Team, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	team, ok := m.teams[id]
+	if !ok || !visible(ctx, team.OrgID) {
+		return model.Team{}, model.NotFound("team")
+	}
+	team.MemberCount = len(m.teamMembers[id])
+	return team, nil
+}
+
+func (m *memoryRepository) CreateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	team.OrgID = ownerOrg(ctx)
+	if err := m.checkTeam(team); err != nil {
+		return team, err
+	}
+	team.ID = m.nextTeamID
+	m.nextTeamID++
+	team.MemberCount = 0
+	m.teams[team.ID] = team
+	m.teamMembers[team.ID] = map[int]bool{}
+	return team, nil
+}
+
+func (m *memoryRepository) UpdateTeam(ctx context.Context, team model.Team) (model.Team, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.teams[team.ID]
+	if !ok || !visible(ctx, existing.OrgID) {
+		return team, model.NotFound("team")
+	}
+	team.OrgID = existing.OrgID
+	if err := m.checkTeam(team); err != nil {
+		return team, err
+	}
+	team.MemberCount = 0
+	m.teams[team.ID] = team
+	team.MemberCount = len(m.teamMembers[team.ID])
+	return team, nil
+}
+
+// checkTeam enforces the unique (org_id, name) constraint of the SQL schema
+func (m *memoryRepository) checkTeam(team model.Team) error {
+	for id, other := range m.teams {
+		if id != team.ID && other.OrgID == team.OrgID && other.Name == team.Name {
+			return errDuplicateTeam
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) DeleteTeam(ctx context.Context, id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if team, ok := m.teams[id]; !ok || !visible(ctx, team.OrgID) {
+		return model.NotFound("team")
+	}
+	delete(m.teams, id)
+	delete(m.teamMembers, id)
+	return nil
+}
+
+func (m *memoryRepository) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.teams[teamID]; !ok {
+		return model.NotFound("team")
+	}
+	if _, ok := m.users[userID]; !ok {
+		return model.NotFound("user")
+	}
+	m.teamMembers[teamID][userID] = true
+	return nil
+}
+
+func (m *memoryRepository) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.teamMembers[teamID][userID] {
+		return model.NotFound("member")
+	}
+	delete(m.teamMembers[teamID], userID)
+	return nil
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Transactor is implemented by repositories that can run several of their
+// methods in one transaction
+type Transactor interface {
+	// WithTx runs fn in a transaction, committed when fn returns nil and
+	// rolled back otherwise. The methods called with the context given to
+	// fn run in that transaction, so their writes are all made or none is.
+	// fn is run again whole after a transient error, see retry, so it must
+	// not have other effects than its writes to the repository.
+	WithTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// ctxTx is the transaction of WithTx, along with the connection and the
+// repository it runs on
+type ctxTx struct {
+	tx   *sql.Tx
+	conn *sql.Conn
+	repo *sqlRepository
+}
+
+type ctxTxKey struct{}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func (s *sqlRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if s.txFrom(ctx) != nil {
+		return fn(ctx)
+	}
+	return retry(ctx, s.queries, func() error {
+		// the connection is kept for the statements database/sql can't
+		// run, such as COPY, see CreateUsers
+		conn, err := s.db.Conn(ctx)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(context.WithValue(ctx, ctxTxKey{}, ctxTx{tx: tx, conn: conn, repo: s})); err != nil {
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// inTx reports whether ctx runs within WithTx
+func inTx(ctx context.Context) bool {
+	_, ok := ctx.Value(ctxTxKey{}).(ctxTx)
+	return ok
+}
+
+// txConnFrom returns the connection of the transaction of WithTx running
+// with ctx on s, nil outside
+func (s *sqlRepository) txConnFrom(ctx context.Context) *sql.Conn {
+	if t, ok := ctx.Value(ctxTxKey{}).(ctxTx); ok && t.repo == s {
+		return t.conn
+	}
+	return nil
+}
+
+// txFrom returns the transaction of WithTx running with ctx on s, nil outside
+func (s *sqlRepository) txFrom(ctx context.Context) *sql.Tx {
+	if t, ok := ctx.Value(ctxTxKey{}).(ctxTx); ok && t.repo == s {
+		return t.tx
+	}
+	return nil
+}
+
+// conn returns what the statements run with ctx go through: the
+// transaction of WithTx within it, the database otherwise
+func (s *sqlRepository) conn(ctx context.Context) querier {
+	if tx := s.txFrom(ctx); tx != nil {
+		return tx
+	}
+	return s.db
+}
+
+// beginTx begins the transaction of a method, or joins the one of WithTx
+// running with ctx, which then commits or rolls it back: commit and
+// rollback leave it alone
+func (s *sqlRepository) beginTx(ctx context.Context) (*sql.Tx, error) {
+	if tx := s.txFrom(ctx); tx != nil {
+		return tx, nil
+	}
+	return s.db.BeginTx(ctx, nil)
+}
+
+// commit commits a transaction of beginTx
+func (s *sqlRepository) commit(ctx context.Context, tx *sql.Tx) error {
+	if tx == s.txFrom(ctx) {
+		return nil
+	}
+	return tx.Commit()
+}
+
+// rollback rolls back a transaction of beginTx, unless it is committed.
+// Within WithTx, the method failing makes fn fail, which rolls it back.
+func (s *sqlRepository) rollback(ctx context.Context, tx *sql.Tx) {
+	if tx != s.txFrom(ctx) {
+		tx.Rollback()
+	}
+}
+
+func (m *memoryRepository) WithTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	// the memory store can't undo the writes fn makes before failing
+	return fn(ctx)
+}
@@ -0,0 +1,104 @@
+// Package sanitize keeps HTML out of the text clients store, so names and
+// descriptions rendered by a frontend can't carry markup or scripts.
+package sanitize
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Mode is what is done to the HTML in a text
+type Mode string
+
+// The modes of a Policy
+const (
+	// Keep stores the text as it is
+	Keep Mode = "keep"
+	// Strip removes tags, along with the content of script and style
+	// elements, keeping the rest of the text and its character references
+	Strip Mode = "strip"
+	// Escape turns the special characters of HTML into character
+	// references, so the text displays as typed
+	Escape Mode = "escape"
+)
+
+// ParseMode parses the name of a Mode
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(strings.TrimSpace(name))); mode {
+	case Keep, Strip, Escape:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown sanitize mode %q (expected keep, strip or escape)", name)
+	}
+}
+
+// Policy gives the Mode of each field, such as "users.name"; fields it
+// doesn't list get Default, and the zero Policy keeps everything
+type Policy struct {
+	Default Mode
+	Fields  map[string]Mode
+}
+
+// Mode returns the mode of the field
+func (p Policy) Mode(field string) Mode {
+	if mode, ok := p.Fields[field]; ok {
+		return mode
+	}
+	if p.Default == "" {
+		return Keep
+	}
+	return p.Default
+}
+
+// Text sanitizes the value of the field
+func (p Policy) Text(field, value string) string {
+	return Text(p.Mode(field), value)
+}
+
+// Text sanitizes text in the mode. Each mode gives the same text when
+// applied again, so stored values going through it on every update don't
+// change.
+func Text(mode Mode, text string) string {
+	switch mode {
+	case Strip:
+		return strip(text)
+	case Escape:
+		// unescaping first keeps references from being escaped twice
+		return html.EscapeString(html.UnescapeString(text))
+	default:
+		return text
+	}
+}
+
+// strip returns the text outside of tags, comments and doctypes, as typed
+func strip(text string) string {
+	if !strings.Contains(text, "<") {
+		return text
+	}
+
+	var b strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(text))
+	skip := ""
+	for {
+		switch z.Next() {
+		case xhtml.ErrorToken:
+			// io.EOF, or an unterminated tag, which is dropped
+			return b.String()
+		case xhtml.TextToken:
+			if skip == "" {
+				b.Write(z.Raw())
+			}
+		case xhtml.StartTagToken:
+			if name, _ := z.TagName(); skip == "" && (string(name) == "script" || string(name) == "style") {
+				skip = string(name)
+			}
+		case xhtml.EndTagToken:
+			if name, _ := z.TagName(); string(name) == skip {
+				skip = ""
+			}
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package sanitize
+
+import "testing"
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		name string
+		mode Mode
+		text string
+		want string
+	}{
+		{"keep", Keep, "<b>Ann</b>", "<b>Ann</b>"},
+		{"strip tags", Strip, "<b>Ann</b> Lee", "Ann Lee"},
+		{"strip script", Strip, "Ann<script>alert(1)</script> Lee", "Ann Lee"},
+		{"strip style", Strip, "<style>body{}</style>Ann", "Ann"},
+		{"strip comment", Strip, "Ann<!-- note --> Lee", "Ann Lee"},
+		{"strip attributes", Strip, `<img src=x onerror="alert(1)">Ann`, "Ann"},
+		{"strip unterminated tag", Strip, "Ann <b", "Ann "},
+		{"strip keeps references", Strip, "Tom &amp; Ann", "Tom &amp; Ann"},
+		{"strip plain text", Strip, "Tom & Ann < 3", "Tom & Ann < 3"},
+		{"escape", Escape, `<b>"Ann"</b>`, "&lt;b&gt;&#34;Ann&#34;&lt;/b&gt;"},
+		{"escape references once", Escape, "Tom &amp; Ann", "Tom &amp; Ann"},
+		{"escape plain text", Escape, "Ann Lee", "Ann Lee"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Text(tt.mode, tt.text)
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			// stored values go through it again on every update
+			if again := Text(tt.mode, got); again != got {
+				t.Errorf("sanitized again to %q, want %q unchanged", again, got)
+			}
+		})
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	policy := Policy{Default: Escape, Fields: map[string]Mode{"users.name": Strip}}
+	tests := []struct {
+		policy Policy
+		field  string
+		want   Mode
+	}{
+		{policy, "users.name", Strip},
+		{policy, "teams.name", Escape},
+		{Policy{}, "users.name", Keep},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Mode(tt.field); got != tt.want {
+			t.Errorf("mode of %s is %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		name string
+		want Mode
+		ok   bool
+	}{
+		{"strip", Strip, true},
+		{" Escape ", Escape, true},
+		{"KEEP", Keep, true},
+		{"remove", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParseMode(tt.name)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseMode(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
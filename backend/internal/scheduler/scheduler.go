@@ -0,0 +1,193 @@
+// Package scheduler runs recurring tasks on cron schedules, such as
+// birthday greetings, cleanups and reports. Every instance schedules the
+// same tasks, but each run is claimed in the database first, so it happens
+// once however many instances there are.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// Task is work run on a schedule
+type Task struct {
+	// Name identifies the task across instances and restarts
+	Name string
+	// Schedule is a standard 5-field cron spec, a descriptor like @daily or
+	// @every 1h, optionally prefixed with CRON_TZ=
+	Schedule string
+	// Jitter delays every run by a random duration up to it, so tasks due
+	// at the same time don't all start at once
+	Jitter time.Duration
+	Run    func(ctx context.Context) error
+}
+
+// Status is what an admin sees of a task: when it runs next on this
+// instance and how its latest run, on any instance, went
+type Status struct {
+	Name     string `json:"name" xml:"name"`
+	Schedule string `json:"schedule" xml:"schedule"`
+	Enabled  bool   `json:"enabled" xml:"enabled"`
+	// Running is set while this instance runs the task
+	Running bool           `json:"running" xml:"running"`
+	NextRun *time.Time     `json:"next_run,omitempty" xml:"next_run,omitempty"`
+	LastRun *model.TaskRun `json:"last_run,omitempty" xml:"last_run,omitempty"`
+}
+
+// Scheduler runs the tasks added to it until it stops
+type Scheduler struct {
+	repo   repository.TaskRepository
+	logger *log.Logger
+	clock  func() time.Time
+	cron   *cron.Cron
+	stop   chan struct{}
+
+	mu    sync.Mutex
+	tasks []*entry
+}
+
+// entry is a task along with its state on this instance
+type entry struct {
+	task    Task
+	enabled bool
+	id      cron.EntryID
+	running bool
+}
+
+// New creates a Scheduler recording the runs of its tasks in repo
+func New(repo repository.TaskRepository, logger *log.Logger, clock func() time.Time) *Scheduler {
+	return &Scheduler{
+		repo:   repo,
+		logger: logger,
+		clock:  clock,
+		// a run still going on when the next one is due on this instance skips it
+		cron: cron.New(cron.WithChain(cron.SkipIfStillRunning(cron.DiscardLogger))),
+		stop: make(chan struct{}),
+	}
+}
+
+// Add schedules the task, or only lists it in Status when it is disabled
+func (s *Scheduler) Add(task Task, enabled bool) error {
+	schedule, err := cron.ParseStandard(task.Schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule %q for task %s: %w", task.Schedule, task.Name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e := &entry{task: task, enabled: enabled}
+	if enabled {
+		e.id = s.cron.Schedule(schedule, cron.FuncJob(func() { s.run(e) }))
+	}
+	s.tasks = append(s.tasks, e)
+	return nil
+}
+
+// Start starts running the tasks on their schedules
+func (s *Scheduler) Start() {
+	s.cron.Start()
+}
+
+// Stop stops scheduling the tasks and waits for the runs going on
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	<-s.cron.Stop().Done()
+}
+
+// Status returns the status of every task, in the order they were added
+func (s *Scheduler) Status(ctx context.Context) ([]Status, error) {
+	runs, err := s.repo.ListTaskRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastRuns := map[string]model.TaskRun{}
+	for _, run := range runs {
+		lastRuns[run.Task] = run
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]Status, 0, len(s.tasks))
+	for _, e := range s.tasks {
+		status := Status{Name: e.task.Name, Schedule: e.task.Schedule, Enabled: e.enabled, Running: e.running}
+		if e.enabled {
+			if next := s.cron.Entry(e.id).Next; !next.IsZero() {
+				status.NextRun = &next
+			}
+		}
+		if run, ok := lastRuns[e.task.Name]; ok {
+			status.LastRun = &run
+		}
+		statuses = append(statuses, status)
+	}
+	sort.SliceStable(statuses, func(i, j int) bool { return statuses[i].Enabled && !statuses[j].Enabled })
+	return statuses, nil
+}
+
+// run performs the run of the task that is due, unless another instance
+// claimed it first
+func (s *Scheduler) run(e *entry) {
+	// the time the run was due is the same on every instance
+	scheduledAt := s.cron.Entry(e.id).Prev
+	if e.task.Jitter > 0 {
+		select {
+		case <-time.After(time.Duration(rand.Int63n(int64(e.task.Jitter)))):
+		case <-s.stop:
+			return
+		}
+	}
+
+	ctx := context.Background()
+	claimed, err := s.repo.ClaimTaskRun(ctx, e.task.Name, scheduledAt, s.clock())
+	if err != nil {
+		s.logger.Printf("[scheduler] failed to claim the %s run due at %s: %v", e.task.Name, scheduledAt.Format(time.RFC3339), err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	s.setRunning(e, true)
+	started := s.clock()
+	err = s.call(ctx, e.task)
+	s.setRunning(e, false)
+
+	var lastError string
+	if err != nil {
+		lastError = err.Error()
+		s.logger.Printf("[scheduler] %s failed after %s: %v", e.task.Name, s.clock().Sub(started).Round(time.Millisecond), err)
+	} else {
+		s.logger.Printf("[scheduler] %s done in %s", e.task.Name, s.clock().Sub(started).Round(time.Millisecond))
+	}
+	if err := s.repo.FinishTaskRun(ctx, e.task.Name, scheduledAt, s.clock(), lastError); err != nil {
+		s.logger.Printf("[scheduler] failed to record the end of the %s run: %v", e.task.Name, err)
+	}
+}
+
+// call runs the task, turning a panic into an error
+func (s *Scheduler) call(ctx context.Context, task Task) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("panic: %v", rec)
+		}
+	}()
+	return task.Run(ctx)
+}
+
+func (s *Scheduler) setRunning(e *entry, running bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e.running = running
+}
@@ -0,0 +1,254 @@
+// Package search mirrors users into an Elasticsearch or OpenSearch index and
+// queries it. It talks to the REST API directly, which both engines share.
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/internal/model"
+)
+
+// Config locates the search cluster
+type Config struct {
+	URL      string // e.g. http://localhost:9200
+	Index    string
+	Username string
+	Password string
+}
+
+// Client indexes and searches users
+type Client struct {
+	cfg  Config
+	http *http.Client
+}
+
+// NewClient creates a client for the cluster at cfg.URL
+func NewClient(cfg Config) *Client {
+	cfg.URL = strings.TrimSuffix(cfg.URL, "/")
+	return &Client{cfg: cfg, http: &http.Client{Timeout: 10 * time.Second}}
+}
+
+// indexMapping keeps dates and roles exact while names and emails are analyzed
+// text; metadata is kept in the documents but not indexed, its keys being arbitrary
+const indexMapping = `{
+  "mappings": {
+    "properties": {
+      "id":        {"type": "integer"},
+      "name":      {"type": "text", "fields": {"keyword": {"type": "keyword"}}},
+      "email":     {"type": "text", "fields": {"keyword": {"type": "keyword"}}},
+      "role":      {"type": "keyword"},
+      "birth":     {"type": "date", "format": "yyyy-MM-dd"},
+      "age":       {"type": "integer"},
+      "timestamp": {"type": "date"},
+      "version":   {"type": "integer"},
+      "metadata":  {"type": "object", "enabled": false},
+      "org_id":    {"type": "integer"}
+    }
+  }
+}`
+
+// EnsureIndex creates the index with its mapping unless it already exists
+func (c *Client) EnsureIndex(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodHead, "/"+c.cfg.Index, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = c.do(ctx, http.MethodPut, "/"+c.cfg.Index, strings.NewReader(indexMapping))
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, nil)
+}
+
+// IndexUser adds or replaces the user's document
+func (c *Client) IndexUser(ctx context.Context, user model.User) error {
+	body, err := json.Marshal(user)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(ctx, http.MethodPut, "/"+c.cfg.Index+"/_doc/"+strconv.Itoa(user.ID), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return checkResponse(resp, nil)
+}
+
+// DeleteUser removes the user's document; a missing document is not an error
+func (c *Client) DeleteUser(ctx context.Context, id int) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/"+c.cfg.Index+"/_doc/"+strconv.Itoa(id), nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil
+	}
+	return checkResponse(resp, nil)
+}
+
+// Search returns up to limit users matching query, best matches first.
+// Names weigh more than emails, which weigh more than roles, and small
+// typos are tolerated. Contexts scoped to an organization only find its users.
+func (c *Client) Search(ctx context.Context, query string, limit int) ([]model.User, error) {
+	match := map[string]interface{}{
+		"multi_match": map[string]interface{}{
+			"query":     query,
+			"fields":    []string{"name^3", "email^2", "role"},
+			"fuzziness": "AUTO",
+		},
+	}
+	if org, ok := model.OrgFrom(ctx); ok {
+		match = map[string]interface{}{
+			"bool": map[string]interface{}{
+				"must":   match,
+				"filter": map[string]interface{}{"term": map[string]interface{}{"org_id": org}},
+			},
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"size":  limit,
+		"query": match,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/"+c.cfg.Index+"/_search", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Hits struct {
+			Hits []struct {
+				Source model.User `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	if err := checkResponse(resp, &result); err != nil {
+		return nil, err
+	}
+
+	users := make([]model.User, 0, len(result.Hits.Hits))
+	for _, hit := range result.Hits.Hits {
+		users = append(users, hit.Source)
+	}
+	return users, nil
+}
+
+// bulkSize is the number of documents sent per _bulk request when reindexing
+const bulkSize = 500
+
+// Reindex recreates the index from scratch and fills it with users
+func (c *Client) Reindex(ctx context.Context, users []model.User) error {
+	resp, err := c.do(ctx, http.MethodDelete, "/"+c.cfg.Index, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if err := c.EnsureIndex(ctx); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(users); start += bulkSize {
+		end := start + bulkSize
+		if end > len(users) {
+			end = len(users)
+		}
+		if err := c.bulkIndex(ctx, users[start:end]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bulkIndex indexes users in a single _bulk request
+func (c *Client) bulkIndex(ctx context.Context, users []model.User) error {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, user := range users {
+		encoder.Encode(map[string]interface{}{"index": map[string]interface{}{"_id": strconv.Itoa(user.ID)}})
+		encoder.Encode(user)
+	}
+
+	resp, err := c.do(ctx, http.MethodPost, "/"+c.cfg.Index+"/_bulk?refresh=true", &body)
+	if err != nil {
+		return err
+	}
+
+	var result struct {
+		Errors bool `json:"errors"`
+	}
+	if err := checkResponse(resp, &result); err != nil {
+		return err
+	}
+	if result.Errors {
+		return fmt.Errorf("search: some documents failed to index")
+	}
+	return nil
+}
+
+// Check asks the cluster for its health, failing when it is unreachable or red
+func (c *Client) Check(ctx context.Context) error {
+	resp, err := c.do(ctx, http.MethodGet, "/_cluster/health", nil)
+	if err != nil {
+		return err
+	}
+	var health struct {
+		Status string `json:"status"`
+	}
+	if err := checkResponse(resp, &health); err != nil {
+		return err
+	}
+	if health.Status == "red" {
+		return fmt.Errorf("search: cluster status is red")
+	}
+	return nil
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.cfg.URL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		contentType := "application/json"
+		if strings.Contains(path, "/_bulk") {
+			contentType = "application/x-ndjson"
+		}
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.cfg.Username != "" {
+		req.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+	return c.http.Do(req)
+}
+
+// checkResponse closes resp, decoding its body into v when given, and turns
+// error statuses into errors
+func checkResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("search: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,126 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AWSSecretsManager reads secrets from AWS Secrets Manager, the name of a
+// secret being its name or ARN. Secrets stored as JSON objects, as the
+// console stores key/value pairs, hold their keys; others a single value.
+type AWSSecretsManager struct {
+	// Endpoint defaults to https://secretsmanager.<region>.amazonaws.com
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// SessionToken goes with temporary keys, such as those of an IAM role
+	SessionToken string
+}
+
+const amzDateLayout = "20060102T150405Z"
+
+func (a AWSSecretsManager) Read(ctx context.Context, name string) (map[string]string, error) {
+	payload, err := json.Marshal(map[string]string{"SecretId": name})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.endpoint()+"/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, payload, time.Now().UTC())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("secrets manager answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var out struct {
+		SecretString *string `json:"SecretString"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	if out.SecretString == nil {
+		return nil, fmt.Errorf("binary secrets aren't supported")
+	}
+	if values, err := decodeValues([]byte(*out.SecretString)); err == nil {
+		return values, nil
+	}
+	return map[string]string{"": *out.SecretString}, nil
+}
+
+// endpoint returns the base URL of the Secrets Manager API
+func (a AWSSecretsManager) endpoint() string {
+	if a.Endpoint == "" {
+		return "https://secretsmanager." + a.Region + ".amazonaws.com"
+	}
+	return strings.TrimSuffix(a.Endpoint, "/")
+}
+
+// sign adds the Authorization header of AWS Signature Version 4 to req,
+// whose body is payload, covering its host, content type, target and date
+func (a AWSSecretsManager) sign(req *http.Request, payload []byte, now time.Time) {
+	payloadHash := sha256Hex(payload)
+	req.Header.Set("X-Amz-Date", now.Format(amzDateLayout))
+	headers := []string{
+		"content-type:" + req.Header.Get("Content-Type"),
+		"host:" + req.URL.Host,
+		"x-amz-date:" + now.Format(amzDateLayout),
+	}
+	signedHeaders := "content-type;host;x-amz-date"
+	if a.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", a.SessionToken)
+		headers = append(headers, "x-amz-security-token:"+a.SessionToken)
+		signedHeaders += ";x-amz-security-token"
+	}
+	headers = append(headers, "x-amz-target:"+req.Header.Get("X-Amz-Target"))
+	signedHeaders += ";x-amz-target"
+
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		strings.Join(headers, "\n") + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format("20060102") + "/" + a.Region + "/secretsmanager/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", now.Format(amzDateLayout), scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+a.SecretKey), now.Format("20060102"))
+	key = hmacSHA256(key, a.Region)
+	key = hmacSHA256(key, "secretsmanager")
+	key = hmacSHA256(key, "aws4_request")
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.AccessKey, scope, signedHeaders, hex.EncodeToString(hmacSHA256(key, stringToSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
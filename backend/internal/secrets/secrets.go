@@ -0,0 +1,93 @@
+// Package secrets reads settings, such as database credentials and signing
+// keys, from a secrets manager instead of the environment. Settings refer
+// to a secret with a Ref of its name and, for secrets holding several
+// values, "#" and the key of the value, e.g. "app/database#password".
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Provider reads secrets from a secrets manager
+type Provider interface {
+	// Read returns the values of the secret with that name, by key. A
+	// secret holding a single value that isn't JSON has it under "".
+	Read(ctx context.Context, name string) (map[string]string, error)
+}
+
+// client sends the requests to the secrets managers
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// Resolve reads the secrets refs refers to, by setting, and returns their
+// values, by setting. Secrets are read once however many settings refer
+// to them.
+func Resolve(ctx context.Context, p Provider, refs map[string]string) (map[string]string, error) {
+	read := map[string]map[string]string{}
+	values := make(map[string]string, len(refs))
+	for setting, ref := range refs {
+		name, key, hasKey := strings.Cut(ref, "#")
+		if name == "" {
+			return nil, fmt.Errorf("%s: invalid secret reference %q (expected name or name#key)", setting, ref)
+		}
+
+		secret, ok := read[name]
+		if !ok {
+			var err error
+			if secret, err = p.Read(ctx, name); err != nil {
+				return nil, fmt.Errorf("%s: secret %s: %w", setting, name, err)
+			}
+			read[name] = secret
+		}
+
+		if !hasKey {
+			if len(secret) != 1 {
+				return nil, fmt.Errorf("%s: secret %s holds %d values, pick one with %s#key", setting, name, len(secret), name)
+			}
+			for _, value := range secret {
+				values[setting] = value
+			}
+			continue
+		}
+		value, ok := secret[key]
+		if !ok {
+			return nil, fmt.Errorf("%s: secret %s has no key %q (has %s)", setting, name, key, strings.Join(keys(secret), ", "))
+		}
+		values[setting] = value
+	}
+	return values, nil
+}
+
+// keys lists the keys of a secret, sorted, without their values
+func keys(secret map[string]string) []string {
+	list := make([]string, 0, len(secret))
+	for key := range secret {
+		list = append(list, key)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// decodeValues decodes a JSON object into strings, keeping values that
+// aren't strings, such as port numbers, as their JSON text
+func decodeValues(data []byte) (map[string]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for key, value := range raw {
+		var text string
+		if json.Unmarshal(value, &text) != nil {
+			text = string(value)
+		}
+		values[key] = text
+	}
+	return values, nil
+}
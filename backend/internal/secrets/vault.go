@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Vault reads secrets from the KV version 2 secrets engine of HashiCorp
+// Vault, the name of a secret being its path in the engine
+type Vault struct {
+	// Addr is the address of Vault, e.g. https://vault.example.com:8200
+	Addr  string
+	Token string
+	// Mount is the path the KV engine is mounted at, "secret" unless set
+	Mount string
+}
+
+func (v Vault) Read(ctx context.Context, name string) (map[string]string, error) {
+	mount := v.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	url := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(v.Addr, "/"), mount, strings.TrimPrefix(name, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("vault answered %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+
+	var out struct {
+		Data struct {
+			Data json.RawMessage `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, err
+	}
+	return decodeValues(out.Data.Data)
+}
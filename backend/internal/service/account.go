@@ -0,0 +1,414 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"api/internal/auth"
+	"api/internal/model"
+)
+
+// Register creates a pending user with the signup role and emails them a
+// link to verify their address; they can't log in until they do
+func (s *UserService) Register(ctx context.Context, input model.RegisterInput) (model.User, error) {
+	user, err := s.buildUser(ctx, model.UserInput{
+		Name:  input.Name,
+		Email: input.Email,
+		Role:  s.opts.SignupRole,
+		Birth: input.Birth,
+	}, false)
+
+	// report the password along with the other invalid fields
+	var v validator
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		for field, message := range validationErr.Fields {
+			v.add(field, message)
+		}
+	} else if err != nil {
+		return user, err
+	}
+	validatePassword(&v, input.Password)
+	if err := v.err(); err != nil {
+		return user, err
+	}
+	if err := s.checkEmailAlias(ctx, user.Email, 0); err != nil {
+		return user, err
+	}
+
+	user.Status = model.UserPending
+	if user.PasswordHash, err = auth.HashPassword(input.Password); err != nil {
+		return model.User{}, err
+	}
+
+	s.logger.Printf("[register] Received: %s", user.Email)
+	user, err = s.repo.Create(ctx, user)
+	if err != nil {
+		return user, err
+	}
+	user.PasswordHash = ""
+	s.logger.Printf("[register] Inserted: %+v", user)
+	s.index(ctx, user)
+
+	token, expires, err := s.opts.Tokens.Sign(auth.Claims{
+		Subject: strconv.Itoa(user.ID),
+		Purpose: auth.PurposeVerifyEmail,
+		Email:   user.Email,
+		Org:     strconv.Itoa(user.OrgID),
+	}, s.opts.VerifyTTL)
+	if err != nil {
+		return user, err
+	}
+	err = s.sendEmail(ctx, user.Email, "verify", map[string]interface{}{
+		"Name":      user.Name,
+		"Link":      strings.ReplaceAll(s.opts.VerifyURL, "{token}", token),
+		"ExpiresAt": expires,
+	})
+	if err != nil {
+		return user, fmt.Errorf("failed to email the verification link of user %d: %w", user.ID, err)
+	}
+	return user, nil
+}
+
+// VerifyEmail activates the user a verification token was emailed to.
+// Verifying an active user again does nothing; tokens that are tampered
+// with, expired or sent to an email the user no longer has fail with
+// model.ErrInvalidToken.
+func (s *UserService) VerifyEmail(ctx context.Context, token string) (model.User, error) {
+	claims, err := s.opts.Tokens.Verify(token, auth.PurposeVerifyEmail)
+	if err != nil {
+		return model.User{}, model.ErrInvalidToken
+	}
+	user, err := s.tokenUser(ctx, claims)
+	if errors.Is(err, model.ErrNotFound) || err == nil && user.Email != claims.Email {
+		return model.User{}, model.ErrInvalidToken
+	}
+	if err != nil || user.Status == model.UserActive {
+		return user, err
+	}
+
+	ctx = model.WithOrg(ctx, user.OrgID)
+	if err := s.repo.SetStatus(ctx, user.ID, model.UserActive); err != nil {
+		return user, err
+	}
+	user.Status = model.UserActive
+	s.logger.Printf("[verifyEmail] Activated user %d", user.ID)
+	s.index(ctx, user)
+	s.setAvatarURL(&user)
+	return user, nil
+}
+
+// Login checks the credentials and returns an access token for the user,
+// failing like checkCredentials
+func (s *UserService) Login(ctx context.Context, input model.LoginInput) (model.AccessToken, error) {
+	user, err := s.checkCredentials(ctx, input)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+
+	token, expires, err := s.opts.Tokens.Sign(auth.Claims{
+		Subject: strconv.Itoa(user.ID),
+		Purpose: auth.PurposeAccess,
+		Role:    user.Role,
+		Org:     strconv.Itoa(user.OrgID),
+		Version: user.TokenVersion,
+	}, s.opts.AccessTokenTTL)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+
+	s.logger.Printf("[login] User %d logged in", user.ID)
+	return model.AccessToken{Token: token, ExpiresAt: expires, User: user}, nil
+}
+
+// CreateSession checks the credentials like Login, but keeps the login on
+// the server for SessionTTL instead of issuing an access token. The
+// session's Token is the value of the cookie identifying it.
+func (s *UserService) CreateSession(ctx context.Context, input model.LoginInput) (model.Session, model.User, error) {
+	user, err := s.checkCredentials(ctx, input)
+	if err != nil {
+		return model.Session{}, user, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.Session{}, user, err
+	}
+	now := s.clock()
+	session := model.Session{
+		Token:        base64.RawURLEncoding.EncodeToString(secret),
+		UserID:       user.ID,
+		OrgID:        user.OrgID,
+		TokenVersion: user.TokenVersion,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(s.opts.SessionTTL),
+	}
+	session.ID = sessionID(session.Token)
+	if err := s.repo.CreateSession(ctx, session, now); err != nil {
+		return model.Session{}, user, err
+	}
+
+	s.logger.Printf("[login] User %d started a session", user.ID)
+	return session, user, nil
+}
+
+// AuthenticateSession returns the identity of the session a cookie
+// identifies, failing like Authenticate
+func (s *UserService) AuthenticateSession(ctx context.Context, token string) (model.Identity, error) {
+	session, err := s.repo.GetSession(ctx, sessionID(token))
+	if errors.Is(err, model.ErrNotFound) {
+		return model.Identity{}, auth.ErrInvalidToken
+	}
+	if err != nil {
+		return model.Identity{}, err
+	}
+	if !s.clock().Before(session.ExpiresAt) {
+		return model.Identity{}, auth.ErrExpiredToken
+	}
+	user, err := s.accessUser(ctx, auth.Claims{
+		Subject: strconv.Itoa(session.UserID),
+		Org:     strconv.Itoa(session.OrgID),
+		Version: session.TokenVersion,
+	})
+	return model.Identity{User: user}, err
+}
+
+// CSRFToken returns the CSRF token of the session a cookie identifies,
+// which requests changing something with the cookie must echo
+func (s *UserService) CSRFToken(token string) string {
+	return s.opts.Tokens.Derive(auth.PurposeCSRF, token)
+}
+
+// ValidCSRFToken reports whether csrf is the CSRF token of the session a
+// cookie identifies, including the token it had before AUTH_SECRET rotated
+func (s *UserService) ValidCSRFToken(token, csrf string) bool {
+	return s.opts.Tokens.Derived(auth.PurposeCSRF, token, csrf)
+}
+
+// EndSession logs out of the session a cookie identifies; unknown sessions are ignored
+func (s *UserService) EndSession(ctx context.Context, token string) error {
+	return s.repo.DeleteSession(ctx, sessionID(token))
+}
+
+// sessionID is the hash a session is stored under, so that the stored
+// sessions can't be used as cookies
+func sessionID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// checkCredentials returns the user with the email and password of input.
+// Unknown emails and wrong passwords both fail with
+// model.ErrInvalidCredentials; users who haven't verified their email yet
+// fail with model.ErrEmailNotVerified.
+func (s *UserService) checkCredentials(ctx context.Context, input model.LoginInput) (model.User, error) {
+	user, err := s.repo.GetByEmail(ctx, normalizeEmail(input.Email))
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return model.User{}, err
+	}
+	if !auth.CheckPassword(user.PasswordHash, input.Password) {
+		return model.User{}, model.ErrInvalidCredentials
+	}
+	if user.Status == model.UserPending {
+		return model.User{}, model.ErrEmailNotVerified
+	}
+	user.PasswordHash = ""
+	s.setAvatarURL(&user)
+	return user, nil
+}
+
+// Authenticate returns the identity an access token was issued to, failing
+// with auth.ErrInvalidToken, auth.ErrExpiredToken, or auth.ErrRevokedToken
+// once the tokens of its user, or of the impersonator, were revoked. The
+// users are loaded afresh, so deleted users are rejected and role changes
+// apply at once.
+func (s *UserService) Authenticate(ctx context.Context, token string) (model.Identity, error) {
+	claims, err := s.opts.Tokens.Verify(token, auth.PurposeAccess)
+	if err != nil {
+		return model.Identity{}, err
+	}
+	user, err := s.accessUser(ctx, claims)
+	if err != nil || claims.Actor == nil {
+		return model.Identity{User: user}, err
+	}
+
+	impersonator, err := s.accessUser(ctx, auth.Claims{Subject: claims.Actor.Subject, Org: claims.Org, Version: claims.Actor.Version})
+	if err != nil {
+		return model.Identity{}, err
+	}
+	return model.Identity{User: user, Impersonator: &impersonator}, nil
+}
+
+// Impersonate returns an access token to act as a user on behalf of the
+// admin, valid for ImpersonationTTL. Impersonating from an impersonation
+// token or oneself fails with model.ErrImpersonation, and without one of
+// the AdminRoles with model.ErrForbidden, whatever the policies allow.
+func (s *UserService) Impersonate(ctx context.Context, admin model.Identity, id int) (model.AccessToken, error) {
+	if admin.Impersonator != nil || admin.User.ID == id {
+		return model.AccessToken{}, model.ErrImpersonation
+	}
+	if !s.IsAdmin(admin.User) {
+		return model.AccessToken{}, model.ErrForbidden
+	}
+	user, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+
+	token, expires, err := s.opts.Tokens.Sign(auth.Claims{
+		Subject: strconv.Itoa(user.ID),
+		Purpose: auth.PurposeAccess,
+		Role:    user.Role,
+		Org:     strconv.Itoa(user.OrgID),
+		Version: user.TokenVersion,
+		Actor:   &auth.Actor{Subject: strconv.Itoa(admin.User.ID), Version: admin.User.TokenVersion},
+	}, s.opts.ImpersonationTTL)
+	if err != nil {
+		return model.AccessToken{}, err
+	}
+
+	s.setAvatarURL(&user)
+	s.logger.Printf("[impersonate] User %d impersonates user %d until %s", admin.User.ID, user.ID, expires.UTC().Format(time.RFC3339))
+	return model.AccessToken{Token: token, ExpiresAt: expires, User: user}, nil
+}
+
+// IsAdmin reports whether the user has one of the AdminRoles
+func (s *UserService) IsAdmin(user model.User) bool {
+	return slices.Contains(s.opts.AdminRoles, user.Role)
+}
+
+// accessUser returns the user claims grant access as, provided it still
+// exists and its tokens weren't revoked since
+func (s *UserService) accessUser(ctx context.Context, claims auth.Claims) (model.User, error) {
+	user, err := s.tokenUser(ctx, claims)
+	if errors.Is(err, model.ErrNotFound) {
+		return model.User{}, auth.ErrInvalidToken
+	}
+	if err == nil && user.TokenVersion != claims.Version {
+		return model.User{}, auth.ErrRevokedToken
+	}
+	return user, err
+}
+
+// RevokeTokens revokes every access token and session issued to a user so
+// far, such as when they log out everywhere or their token leaked. Callers
+// revoke their own, or the admin impersonating them theirs, and admins
+// anyone's; others get model.ErrForbidden.
+func (s *UserService) RevokeTokens(ctx context.Context, caller model.Identity, id int) error {
+	own := caller.User.ID == id || (caller.Impersonator != nil && caller.Impersonator.ID == id)
+	if !own && !s.IsAdmin(caller.User) {
+		return model.ErrForbidden
+	}
+	if err := s.repo.RevokeTokens(ctx, id); err != nil {
+		return err
+	}
+	s.logger.Printf("[revokeTokens] Revoked the tokens of user %d", id)
+	if s.byOther(ctx, id) {
+		if user, err := s.repo.Get(ctx, id); err != nil {
+			s.logger.Printf("[notify] failed to load user %d: %v", id, err)
+		} else {
+			s.notify(ctx, user, model.NotificationSessionsRevoked, "You were signed out everywhere",
+				"An admin signed you out of every device. Log in again to continue.")
+		}
+	}
+	return nil
+}
+
+// ForgotPassword emails a link to reset the password of the user with the
+// email, if there is one. The email is sent in the background and failures
+// are only logged, so that neither the response nor its timing tell
+// whether the email belongs to an account.
+func (s *UserService) ForgotPassword(ctx context.Context, email string) {
+	go s.sendPasswordReset(context.WithoutCancel(ctx), normalizeEmail(email))
+}
+
+// sendPasswordReset emails the reset link of ForgotPassword
+func (s *UserService) sendPasswordReset(ctx context.Context, email string) {
+	user, err := s.repo.GetByEmail(ctx, email)
+	if errors.Is(err, model.ErrNotFound) {
+		s.logger.Printf("[forgotPassword] No user has the email %s", email)
+		return
+	}
+	if err != nil {
+		s.logger.Printf("[forgotPassword] failed to look up %s: %v", email, err)
+		return
+	}
+
+	token, expires, err := s.opts.Tokens.Sign(auth.Claims{
+		Subject: strconv.Itoa(user.ID),
+		Purpose: auth.PurposeResetPassword,
+		Email:   user.Email,
+		Org:     strconv.Itoa(user.OrgID),
+		Version: user.TokenVersion,
+	}, s.opts.ResetTTL)
+	if err != nil {
+		s.logger.Printf("[forgotPassword] failed to sign the reset token of user %d: %v", user.ID, err)
+		return
+	}
+	err = s.sendEmail(ctx, user.Email, "reset", map[string]interface{}{
+		"Link":      strings.ReplaceAll(s.opts.ResetURL, "{token}", token),
+		"ExpiresAt": expires,
+	})
+	if err != nil {
+		s.logger.Printf("[forgotPassword] failed to email the reset link of user %d: %v", user.ID, err)
+	}
+}
+
+// ResetPassword sets a new password for the user a reset token was emailed
+// to, activating them if they hadn't verified their email yet. It revokes
+// every token issued to the user, the reset token included, so it can only
+// be used once; reused, tampered or expired tokens fail with model.ErrInvalidToken.
+func (s *UserService) ResetPassword(ctx context.Context, token, password string) error {
+	var v validator
+	validatePassword(&v, password)
+	if err := v.err(); err != nil {
+		return err
+	}
+
+	claims, err := s.opts.Tokens.Verify(token, auth.PurposeResetPassword)
+	if err != nil {
+		return model.ErrInvalidToken
+	}
+	user, err := s.tokenUser(ctx, claims)
+	if errors.Is(err, model.ErrNotFound) || err == nil && (user.Email != claims.Email || user.TokenVersion != claims.Version) {
+		return model.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	err = s.repo.SetPassword(model.WithOrg(ctx, user.OrgID), user.ID, hash, claims.Version)
+	if errors.Is(err, model.ErrVersionConflict) || errors.Is(err, model.ErrNotFound) {
+		return model.ErrInvalidToken
+	}
+	if err != nil {
+		return err
+	}
+	s.logger.Printf("[resetPassword] Reset the password of user %d", user.ID)
+	return nil
+}
+
+// tokenUser loads the user a token was issued to, within its organization
+func (s *UserService) tokenUser(ctx context.Context, claims auth.Claims) (model.User, error) {
+	id, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return model.User{}, model.NotFound("user")
+	}
+	if org, err := strconv.Atoi(claims.Org); err == nil {
+		ctx = model.WithOrg(ctx, org)
+	}
+	return s.repo.Get(ctx, id)
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"api/internal/model"
+)
+
+const (
+	maxStreetLength = 200
+	maxCityLength   = 100
+)
+
+// ListAddresses returns the addresses of a user, the primary one first
+func (s *UserService) ListAddresses(ctx context.Context, userID int) ([]model.Address, error) {
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListAddresses(ctx, userID)
+}
+
+// CreateAddress adds an address to a user
+func (s *UserService) CreateAddress(ctx context.Context, userID int, input model.AddressInput) (model.Address, error) {
+	address, err := buildAddress(s.sanitizeAddress(input))
+	if err != nil {
+		return address, err
+	}
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return address, err
+	}
+
+	address.UserID = userID
+	return s.repo.CreateAddress(ctx, address)
+}
+
+// UpdateAddress replaces an address of a user
+func (s *UserService) UpdateAddress(ctx context.Context, userID, id int, input model.AddressInput) (model.Address, error) {
+	address, err := buildAddress(s.sanitizeAddress(input))
+	if err != nil {
+		return address, err
+	}
+
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return address, err
+	}
+
+	address.ID = id
+	address.UserID = userID
+	return s.repo.UpdateAddress(ctx, address)
+}
+
+// DeleteAddress removes an address of a user
+func (s *UserService) DeleteAddress(ctx context.Context, userID, id int) error {
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.DeleteAddress(ctx, userID, id)
+}
+
+// buildAddress validates the input and normalizes it into an address
+func buildAddress(input model.AddressInput) (model.Address, error) {
+	var v validator
+
+	street := strings.TrimSpace(input.Street)
+	switch {
+	case street == "":
+		v.add("street", "is required")
+	case utf8.RuneCountInString(street) > maxStreetLength:
+		v.add("street", "must be at most 200 characters")
+	}
+
+	city := strings.TrimSpace(input.City)
+	switch {
+	case city == "":
+		v.add("city", "is required")
+	case utf8.RuneCountInString(city) > maxCityLength:
+		v.add("city", "must be at most 100 characters")
+	}
+
+	country := strings.ToUpper(strings.TrimSpace(input.Country))
+	switch {
+	case country == "":
+		v.add("country", "is required")
+	case !validCountry(country):
+		v.add("country", "must be an ISO 3166-1 alpha-2 code such as ID or US")
+	}
+
+	address := model.Address{Street: street, City: city, Country: country, IsPrimary: input.IsPrimary}
+	return address, v.err()
+}
+
+// validCountry reports whether code has the shape of an ISO 3166-1 alpha-2 code
+func validCountry(code string) bool {
+	if len(code) != 2 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/model"
+)
+
+// RecordAudit appends an entry to the audit log. The request it records
+// already happened, so failures are only logged.
+func (s *UserService) RecordAudit(ctx context.Context, entry model.AuditEntry) {
+	if err := s.repo.AppendAudit(ctx, entry); err != nil {
+		s.logger.Printf("[audit] failed to record %s %s by %s: %v", entry.Method, entry.Path, entry.Actor, err)
+	}
+}
+
+// ListAudit returns the audit log entries matching params, newest first
+func (s *UserService) ListAudit(ctx context.Context, params model.AuditParams) ([]model.AuditEntry, error) {
+	return s.repo.ListAudit(ctx, params)
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"api/internal/model"
+	"api/internal/storage"
+	"api/internal/thumbnail"
+)
+
+// avatarTypes are the image formats accepted as avatars
+var avatarTypes = map[string]bool{"image/png": true, "image/jpeg": true, "image/gif": true, "image/webp": true}
+
+// avatarKey is the storage key of a user's avatar, or of its thumbnail of
+// the given size when size isn't zero
+func avatarKey(id, size int) string {
+	key := "avatars/" + strconv.Itoa(id)
+	if size != 0 {
+		key += "-" + strconv.Itoa(size)
+	}
+	return key
+}
+
+// SetAvatar stores image as the avatar of a user, replacing any previous
+// one. The format is sniffed from the content, not taken from the client.
+// Thumbnails are generated in the background.
+func (s *UserService) SetAvatar(ctx context.Context, id int, image []byte) error {
+	var v validator
+	contentType := http.DetectContentType(image)
+	switch {
+	case len(image) == 0:
+		v.add("avatar", "is required")
+	case s.opts.AvatarMaxBytes > 0 && int64(len(image)) > s.opts.AvatarMaxBytes:
+		v.add("avatar", "must be at most "+strconv.FormatInt(s.opts.AvatarMaxBytes, 10)+" bytes")
+	case !avatarTypes[contentType]:
+		v.add("avatar", "must be a PNG, JPEG, GIF or WebP image")
+	}
+	if err := v.err(); err != nil {
+		return err
+	}
+	// decoded now, so that images too large to decode are rejected before
+	// they are stored, and the thumbnails are scaled from one decoding
+	decoded, err := thumbnail.Decode(image, s.opts.AvatarMaxPixels)
+	if errors.Is(err, thumbnail.ErrTooLarge) {
+		v.add("avatar", "must be at most "+strconv.Itoa(s.opts.AvatarMaxPixels)+" pixels")
+		return v.err()
+	} else if err != nil {
+		v.add("avatar", "is not a valid image")
+		return v.err()
+	}
+
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return err
+	}
+	if err := s.opts.Storage.Put(ctx, avatarKey(id, 0), bytes.NewReader(image), contentType); err != nil {
+		return err
+	}
+	if err := s.repo.SetAvatar(ctx, id, avatarKey(id, 0)); err != nil {
+		return err
+	}
+
+	upload := s.startAvatarUpload(id)
+	go s.generateThumbnails(context.WithoutCancel(ctx), id, upload, decoded)
+	return nil
+}
+
+// startAvatarUpload numbers a new upload of the user's avatar, so that
+// thumbnails of an older upload still being generated aren't saved over it
+func (s *UserService) startAvatarUpload(id int) uint64 {
+	s.avatarMu.Lock()
+	defer s.avatarMu.Unlock()
+
+	s.avatarUploads[id]++
+	return s.avatarUploads[id]
+}
+
+// currentAvatarUpload reports whether upload is the latest upload of the user's avatar
+func (s *UserService) currentAvatarUpload(id int, upload uint64) bool {
+	s.avatarMu.Lock()
+	defer s.avatarMu.Unlock()
+
+	return s.avatarUploads[id] == upload
+}
+
+// generateThumbnails stores a scaled down copy of image for every
+// configured size. Failures are logged; the original is served instead.
+func (s *UserService) generateThumbnails(ctx context.Context, id int, upload uint64, image thumbnail.Image) {
+	for _, size := range s.opts.AvatarSizes {
+		data, contentType, err := image.Thumbnail(size)
+		if err != nil {
+			s.logger.Printf("[storage] failed to generate the %dpx avatar of user %d: %v", size, id, err)
+			return
+		}
+		if !s.currentAvatarUpload(id, upload) {
+			return
+		}
+		if err := s.opts.Storage.Put(ctx, avatarKey(id, size), bytes.NewReader(data), contentType); err != nil {
+			s.logger.Printf("[storage] failed to store the %dpx avatar of user %d: %v", size, id, err)
+		}
+	}
+}
+
+// checkAvatarSize accepts zero, meaning the original, and the configured thumbnail sizes
+func (s *UserService) checkAvatarSize(size int) error {
+	if size == 0 {
+		return nil
+	}
+	sizes := make([]string, len(s.opts.AvatarSizes))
+	for i, allowed := range s.opts.AvatarSizes {
+		if size == allowed {
+			return nil
+		}
+		sizes[i] = strconv.Itoa(allowed)
+	}
+	return &ValidationError{Fields: map[string]string{"size": "must be one of " + strings.Join(sizes, ", ")}}
+}
+
+// Avatar opens the avatar of a user, or its thumbnail of the given size
+// when size isn't zero; the caller closes its Body. Thumbnails that aren't
+// generated yet fall back to the original.
+func (s *UserService) Avatar(ctx context.Context, id, size int) (storage.Object, error) {
+	if err := s.checkAvatarSize(size); err != nil {
+		return storage.Object{}, err
+	}
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return storage.Object{}, err
+	}
+
+	object, err := s.opts.Storage.Open(ctx, avatarKey(id, size))
+	if errors.Is(err, storage.ErrNotFound) && size != 0 {
+		object, err = s.opts.Storage.Open(ctx, avatarKey(id, 0))
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		return object, model.NotFound("avatar")
+	}
+	return object, err
+}
+
+// DeleteAvatar removes the avatar of a user and its thumbnails
+func (s *UserService) DeleteAvatar(ctx context.Context, id int) error {
+	if err := s.repo.SetAvatar(ctx, id, ""); err != nil {
+		return err
+	}
+	s.startAvatarUpload(id)
+	return s.deleteAvatarFiles(ctx, id)
+}
+
+// deleteAvatarFiles removes the stored avatar of a user and its thumbnails
+func (s *UserService) deleteAvatarFiles(ctx context.Context, id int) error {
+	if err := s.opts.Storage.Delete(ctx, avatarKey(id, 0)); err != nil {
+		return err
+	}
+	for _, size := range s.opts.AvatarSizes {
+		if err := s.opts.Storage.Delete(ctx, avatarKey(id, size)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AvatarRedirect returns a presigned URL downloading the avatar of a user,
+// or its thumbnail of the given size, straight from the storage; it
+// returns "" when the storage can't presign URLs. Thumbnails that aren't
+// generated yet fall back to the original, as in Avatar.
+func (s *UserService) AvatarRedirect(ctx context.Context, id, size int) (string, error) {
+	if err := s.checkAvatarSize(size); err != nil {
+		return "", err
+	}
+	presigner, ok := s.opts.Storage.(storage.Presigner)
+	if !ok {
+		return "", nil
+	}
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return "", err
+	}
+	if size != 0 {
+		exists, err := presigner.Exists(ctx, avatarKey(id, size))
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			size = 0
+		}
+	}
+	return presigner.PresignGet(avatarKey(id, size), s.opts.AvatarURLTTL)
+}
+
+// setAvatarURL tells clients where to download the user's avatar and its
+// thumbnails from: presigned storage URLs when possible, the API otherwise.
+// The thumbnails are always downloaded through the API when it is known,
+// whose redirects fall back to the original until they are generated.
+func (s *UserService) setAvatarURL(user *model.User) {
+	if user.Avatar == "" || s.opts.Storage == nil {
+		return
+	}
+
+	url := func(size int) string {
+		if s.opts.AvatarURL != nil {
+			return s.opts.AvatarURL(user.ID, size)
+		}
+		return ""
+	}
+	if presigner, ok := s.opts.Storage.(storage.Presigner); ok {
+		url = func(size int) string {
+			presigned, err := presigner.PresignGet(avatarKey(user.ID, size), s.opts.AvatarURLTTL)
+			if err != nil {
+				s.logger.Printf("[storage] failed to presign the avatar of user %d: %v", user.ID, err)
+			}
+			return presigned
+		}
+	}
+
+	user.AvatarURL = url(0)
+	thumbnailURL := func(size int) string {
+		if s.opts.AvatarURL != nil {
+			return s.opts.AvatarURL(user.ID, size)
+		}
+		// the thumbnail may not be generated yet
+		return user.AvatarURL
+	}
+	if len(s.opts.AvatarSizes) > 0 {
+		user.AvatarThumbnails = make(map[string]string, len(s.opts.AvatarSizes))
+		for _, size := range s.opts.AvatarSizes {
+			user.AvatarThumbnails[strconv.Itoa(size)] = thumbnailURL(size)
+		}
+	}
+}
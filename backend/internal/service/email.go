@@ -0,0 +1,79 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/mail"
+	"strings"
+
+	"api/internal/jobs"
+	"api/internal/mailer"
+	"api/internal/model"
+)
+
+// JobSendEmail is the type of the jobs sending the emails of the service
+const JobSendEmail = "send-email"
+
+// sendEmail renders the email template called name with data, in the
+// language the client prefers, and sends it to the address, or queues it
+// when there is a job queue
+func (s *UserService) sendEmail(ctx context.Context, to, name string, data interface{}) error {
+	msg, err := s.opts.Templates.Render(name, model.LocalesFrom(ctx), data)
+	if err != nil {
+		return err
+	}
+	msg.To = to
+	if s.opts.Jobs != nil {
+		_, err := s.opts.Jobs.Enqueue(ctx, JobSendEmail, msg)
+		return err
+	}
+	return s.opts.Mailer.Send(ctx, msg)
+}
+
+// DeliverEmails returns the handler of the JobSendEmail jobs, sending their
+// email through sender
+func DeliverEmails(sender mailer.Sender) jobs.Handler {
+	return func(ctx context.Context, job model.Job) error {
+		var msg mailer.Message
+		if err := json.Unmarshal(job.Payload, &msg); err != nil {
+			return jobs.Permanent(err)
+		}
+		return sender.Send(ctx, msg)
+	}
+}
+
+// normalizeEmail trims and lowercases an address, so "Foo@Bar.com" and
+// "foo@bar.com" are the same account
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// validEmail reports whether email is a bare addr-spec with a dotted domain,
+// rejecting display-name forms like "Ann <ann@example.com>" as well as garbage
+func validEmail(email string) bool {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return false
+	}
+	at := strings.LastIndex(email, "@")
+	return strings.Contains(email[at:], ".")
+}
+
+// CanonicalEmail drops the +tag of a normalized address, so
+// "ann+news@example.com" and "ann@example.com" share a canonical form
+func CanonicalEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return email
+	}
+	local, domain := email[:at], email[at:]
+	if plus := strings.IndexByte(local, '+'); plus >= 0 {
+		local = local[:plus]
+	}
+	return local + domain
+}
+
+// emailDomain returns the part of the address after the @
+func emailDomain(email string) string {
+	return email[strings.LastIndex(email, "@")+1:]
+}
@@ -0,0 +1,40 @@
+package service
+
+import "testing"
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		input      string
+		normalized string
+		valid      bool
+		canonical  string
+	}{
+		{"ann@example.com", "ann@example.com", true, "ann@example.com"},
+		{"  Ann@Example.COM ", "ann@example.com", true, "ann@example.com"},
+		{"ann+news@example.com", "ann+news@example.com", true, "ann@example.com"},
+		{"ann.lee@mail.example.com", "ann.lee@mail.example.com", true, "ann.lee@mail.example.com"},
+		{"Ann <ann@example.com>", "ann <ann@example.com>", false, ""},
+		{"ann@localhost", "ann@localhost", false, ""},
+		{"ann@", "ann@", false, ""},
+		{"@example.com", "@example.com", false, ""},
+		{"ann", "ann", false, ""},
+		{"ann@@example.com", "ann@@example.com", false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			normalized := normalizeEmail(tt.input)
+			if normalized != tt.normalized {
+				t.Errorf("normalized to %q, want %q", normalized, tt.normalized)
+			}
+			if valid := validEmail(normalized); valid != tt.valid {
+				t.Fatalf("valid is %v, want %v", valid, tt.valid)
+			}
+			if !tt.valid {
+				return
+			}
+			if canonical := CanonicalEmail(normalized); canonical != tt.canonical {
+				t.Errorf("canonical is %q, want %q", canonical, tt.canonical)
+			}
+		})
+	}
+}
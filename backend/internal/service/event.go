@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/model"
+)
+
+// ListEvents returns the domain events matching params, oldest first
+func (s *UserService) ListEvents(ctx context.Context, params model.EventParams) ([]model.Event, error) {
+	return s.repo.ListEvents(ctx, params)
+}
+
+// ReplayEvents publishes the delivered events with IDs from from to to
+// again, in order, and returns how many there are
+func (s *UserService) ReplayEvents(ctx context.Context, from, to int64) (int, error) {
+	fields := map[string]string{}
+	if from <= 0 {
+		fields["from"] = "must be an event ID"
+	}
+	if to < from {
+		fields["to"] = "must be an event ID no lower than from"
+	}
+	if len(fields) > 0 {
+		return 0, &ValidationError{Fields: fields}
+	}
+
+	replayed, err := s.repo.ReplayEvents(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+	s.logger.Printf("[replayEvents] Replaying %d events from %d to %d", replayed, from, to)
+	return replayed, nil
+}
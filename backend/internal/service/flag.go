@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/flags"
+	"api/internal/model"
+)
+
+// ListFeatureFlags returns the overrides of the feature flags, by name then
+// organization
+func (s *UserService) ListFeatureFlags(ctx context.Context) ([]model.FeatureFlag, error) {
+	return s.repo.ListFeatureFlags(ctx)
+}
+
+// SetFeatureFlag validates the input and overrides a known flag, for every
+// organization or for the one of input.OrgID
+func (s *UserService) SetFeatureFlag(ctx context.Context, name string, input model.FeatureFlagInput) (model.FeatureFlag, error) {
+	flag := model.FeatureFlag{Name: name, OrgID: input.OrgID, UpdatedAt: s.clock().UTC()}
+	if _, ok := flags.Lookup(name); !ok {
+		return flag, model.NotFound("feature flag")
+	}
+
+	var v validator
+	if input.Enabled == nil {
+		v.add("enabled", "is required")
+	}
+	if input.OrgID < 0 {
+		v.add("org_id", "must be an organization ID, or 0 for every organization")
+	}
+	if err := v.err(); err != nil {
+		return flag, err
+	}
+	if input.OrgID != flags.AllOrgs {
+		if _, err := s.repo.GetOrganization(ctx, input.OrgID); err != nil {
+			return flag, err
+		}
+	}
+
+	flag.Enabled = *input.Enabled
+	return flag, s.repo.SetFeatureFlag(ctx, flag)
+}
+
+// DeleteFeatureFlag removes the override of a flag for an organization, or
+// for every organization with flags.AllOrgs
+func (s *UserService) DeleteFeatureFlag(ctx context.Context, name string, orgID int) error {
+	if _, ok := flags.Lookup(name); !ok {
+		return model.NotFound("feature flag")
+	}
+	return s.repo.DeleteFeatureFlag(ctx, name, orgID)
+}
+
+// flagEnabled reports whether a feature flag is on for the organization of ctx
+func (s *UserService) flagEnabled(ctx context.Context, name string) bool {
+	org, _ := model.OrgFrom(ctx)
+	return s.opts.Flags.Enabled(name, org)
+}
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+
+	"api/internal/jobs"
+	"api/internal/model"
+	"api/internal/repository"
+	"api/internal/usercsv"
+)
+
+// JobImportUsers is the type of the jobs running CSV imports, see ImportUsers
+const JobImportUsers = "import-users"
+
+const (
+	// maxImportErrors is how many failed rows an import lists; the others are only counted
+	maxImportErrors = 1000
+	// importBatch is how many rows are created together, then saved in
+	// the progress, see createBatch
+	importBatch = 1000
+)
+
+// importPayload is the payload of the JobImportUsers jobs
+type importPayload struct {
+	ImportID int `json:"import_id"`
+}
+
+// CreateImport checks the header row of a users CSV, stores the CSV and
+// queues its import, returning the pending import without waiting for it
+func (s *UserService) CreateImport(ctx context.Context, data []byte) (model.Import, error) {
+	var v validator
+	if s.opts.ImportMaxBytes > 0 && int64(len(data)) > s.opts.ImportMaxBytes {
+		v.add("file", "must be at most "+strconv.FormatInt(s.opts.ImportMaxBytes, 10)+" bytes")
+		return model.Import{}, v.err()
+	}
+	reader, err := usercsv.NewReader(bytes.NewReader(data))
+	if err != nil {
+		v.add("file", err.Error())
+		return model.Import{}, v.err()
+	}
+	total := 0
+	for {
+		if _, _, err := reader.Read(); err == io.EOF {
+			break
+		}
+		total++
+	}
+	if total == 0 {
+		v.add("file", "the CSV has no rows")
+		return model.Import{}, v.err()
+	}
+
+	imp, err := s.repo.CreateImport(ctx, model.Import{Total: total, CreatedAt: s.clock()}, data)
+	if err != nil {
+		return imp, err
+	}
+	if _, err := s.opts.Jobs.Enqueue(ctx, JobImportUsers, importPayload{ImportID: imp.ID}); err != nil {
+		return imp, s.stopImport(ctx, imp, err, true)
+	}
+
+	s.logger.Printf("[createImport] Queued import %d of %d rows", imp.ID, total)
+	return imp, nil
+}
+
+// GetImport returns an import with its progress
+func (s *UserService) GetImport(ctx context.Context, id int) (model.Import, error) {
+	return s.repo.GetImport(ctx, id)
+}
+
+// ImportUsers is the handler of the JobImportUsers jobs. It creates the
+// users of the CSV in batches, checked like Create does, listing the rows
+// that are invalid or whose email is taken. Progress is saved with each
+// batch, or each row when createBatch creates them one at a time, so a
+// job retried after the database failed carries on where it stopped.
+func (s *UserService) ImportUsers(ctx context.Context, job model.Job) error {
+	var payload importPayload
+	if err := json.Unmarshal(job.Payload, &payload); err != nil {
+		return jobs.Permanent(err)
+	}
+	imp, err := s.repo.GetImport(ctx, payload.ImportID)
+	if errors.Is(err, model.ErrNotFound) {
+		return jobs.Permanent(err)
+	} else if err != nil {
+		return err
+	}
+	if imp.Status == model.ImportDone {
+		return nil
+	}
+
+	data, err := s.repo.ImportData(ctx, imp.ID)
+	if err != nil {
+		return err
+	}
+	// the header was checked when the import was created
+	reader, err := usercsv.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return jobs.Permanent(s.stopImport(ctx, imp, err, true))
+	}
+
+	imp.Status = model.ImportRunning
+	imp.Error = ""
+	if err := s.repo.UpdateImport(ctx, imp); err != nil {
+		return err
+	}
+
+	// skip the rows of the earlier attempts
+	for i := 0; i < imp.Processed; i++ {
+		if _, _, err := reader.Read(); err == io.EOF {
+			break
+		}
+	}
+
+	batch := make([]importRow, 0, importBatch)
+	for {
+		input, row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		// the user is built like Create does, but created along with the
+		// rest of the batch
+		item := importRow{row: row, err: err}
+		if err == nil {
+			if item.user, item.err = s.buildUser(ctx, input, false); item.err == nil {
+				item.err = s.checkEmailAlias(ctx, item.user.Email, 0)
+			}
+		}
+		if batch = append(batch, item); len(batch) < importBatch {
+			continue
+		}
+
+		if err := s.createBatch(ctx, &imp, batch); err != nil {
+			return s.stopImport(ctx, imp, err, job.Attempts >= job.MaxAttempts)
+		}
+		batch = batch[:0]
+		if err := s.repo.UpdateImport(ctx, imp); err != nil {
+			return err
+		}
+	}
+	if err := s.createBatch(ctx, &imp, batch); err != nil {
+		return s.stopImport(ctx, imp, err, job.Attempts >= job.MaxAttempts)
+	}
+
+	now := s.clock()
+	imp.Status = model.ImportDone
+	imp.FinishedAt = &now
+	if err := s.repo.UpdateImport(ctx, imp); err != nil {
+		return err
+	}
+	s.logger.Printf("[importUsers] Import %d done: %d created, %d failed", imp.ID, imp.Created, imp.Failed)
+	return nil
+}
+
+// importRow is a row of an import, with the user it describes or why it
+// is invalid
+type importRow struct {
+	row  int
+	user model.User
+	err  error
+}
+
+// createBatch creates the users of the valid rows of a batch, then counts
+// the rows in the progress of imp. The repositories that can create them
+// all at once do, such as with COPY on Postgres; when one of their emails
+// is taken, which fails them all, they are created one after the other to
+// tell which. The users are created in a transaction saving them in the
+// progress, all at once or each on its own, so that a retry after a
+// failure doesn't create them again and report their emails as taken.
+// Failing otherwise counts none of the rows left, so the job retries them.
+func (s *UserService) createBatch(ctx context.Context, imp *model.Import, batch []importRow) error {
+	var valid []model.User
+	for _, item := range batch {
+		if item.err == nil {
+			valid = append(valid, item.user)
+		}
+	}
+
+	if bulk, ok := s.repo.(repository.BulkCreator); ok && len(valid) > 1 {
+		progress := *imp
+		progress.Errors = slices.Clone(imp.Errors)
+		for _, item := range batch {
+			countImportRow(&progress, item)
+		}
+		var users []model.User
+		err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+			var err error
+			if users, err = bulk.CreateUsers(ctx, valid); err != nil {
+				return err
+			}
+			return s.repo.UpdateImport(ctx, progress)
+		})
+		if err != nil && !errors.Is(err, model.ErrConflict) {
+			return err
+		}
+		if err == nil {
+			for _, user := range users {
+				s.index(ctx, user)
+			}
+			*imp = progress
+			return nil
+		}
+	}
+
+	for _, item := range batch {
+		if item.err != nil {
+			countImportRow(imp, item)
+			continue
+		}
+		// the rows failing before it are saved along with it
+		progress := *imp
+		countImportRow(&progress, item)
+		var user model.User
+		err := s.repo.WithTx(ctx, func(ctx context.Context) error {
+			var err error
+			if user, err = s.repo.Create(ctx, item.user); err != nil {
+				return err
+			}
+			return s.repo.UpdateImport(ctx, progress)
+		})
+		if err != nil && !errors.Is(err, model.ErrValidation) && !errors.Is(err, model.ErrConflict) {
+			return err
+		}
+		if item.err = err; err == nil {
+			s.index(ctx, user)
+		}
+		countImportRow(imp, item)
+	}
+	return nil
+}
+
+// countImportRow counts a row, created unless it has an error, in the
+// progress of imp
+func countImportRow(imp *model.Import, item importRow) {
+	imp.Processed++
+	if item.err != nil {
+		imp.Failed++
+		if len(imp.Errors) < maxImportErrors {
+			imp.Errors = append(imp.Errors, importError(item.row, item.err))
+		}
+	} else {
+		imp.Created++
+	}
+}
+
+// stopImport saves the progress of an import interrupted by err, such as
+// a database failure or the job running out of time, and returns err. The
+// import fails when last is set; otherwise it is pending until its job is retried.
+func (s *UserService) stopImport(ctx context.Context, imp model.Import, err error, last bool) error {
+	imp.Status = model.ImportPending
+	if last {
+		now := s.clock()
+		imp.Status = model.ImportFailed
+		imp.Error = err.Error()
+		imp.FinishedAt = &now
+	}
+	// the context may be the one that ran out of time
+	if err := s.repo.UpdateImport(context.WithoutCancel(ctx), imp); err != nil {
+		s.logger.Printf("[importUsers] Failed to save import %d: %v", imp.ID, err)
+	}
+	return err
+}
+
+// importError describes why a row was not imported, with a message per
+// field when it was invalid
+func importError(row int, err error) model.ImportError {
+	rowErr := model.ImportError{Row: row, Message: err.Error()}
+	var validationErr *ValidationError
+	var conflictErr *model.ConflictError
+	switch {
+	case errors.As(err, &validationErr):
+		rowErr.Fields = validationErr.Fields
+	case errors.As(err, &conflictErr):
+		rowErr.Fields = map[string]string{conflictErr.Field: "is already in use"}
+	}
+	return rowErr
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"api/internal/model"
+)
+
+// ListInvitations returns the invitations of the organization, newest first
+func (s *UserService) ListInvitations(ctx context.Context) ([]model.Invitation, error) {
+	invitations, err := s.repo.ListInvitations(ctx)
+	for i := range invitations {
+		s.setInvitationStatus(&invitations[i])
+	}
+	return invitations, err
+}
+
+// CreateInvitation validates the input, stores a pending invitation and
+// emails its link to the invitee. Inviting the same email again replaces
+// the pending invitation, which is also how a failed email is resent.
+func (s *UserService) CreateInvitation(ctx context.Context, input model.InvitationInput) (model.Invitation, error) {
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return model.Invitation{}, err
+	}
+
+	var v validator
+	email := normalizeEmail(input.Email)
+	validateEmail(&v, email)
+	validateRole(&v, input.Role, roles)
+	if err := v.err(); err != nil {
+		return model.Invitation{}, err
+	}
+	if err := s.checkEmailTaken(ctx, email); err != nil {
+		return model.Invitation{}, err
+	}
+
+	now := s.clock()
+	invitation, err := s.repo.CreateInvitation(ctx, model.Invitation{
+		Email:     email,
+		Role:      input.Role,
+		ExpiresAt: now.Add(s.opts.InviteTTL),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return invitation, err
+	}
+
+	org, err := s.repo.GetOrganization(ctx, invitation.OrgID)
+	if err != nil {
+		return invitation, err
+	}
+	err = s.sendEmail(ctx, invitation.Email, "invitation", map[string]interface{}{
+		"Organization": org.Name,
+		"Role":         invitation.Role,
+		"Link":         strings.ReplaceAll(s.opts.InviteURL, "{token}", s.invitationToken(invitation)),
+		"ExpiresAt":    invitation.ExpiresAt,
+	})
+	if err != nil {
+		return invitation, fmt.Errorf("failed to email invitation %d: %w", invitation.ID, err)
+	}
+
+	s.logger.Printf("[createInvitation] Invited %s as %s to organization %d", invitation.Email, invitation.Role, invitation.OrgID)
+	return invitation, nil
+}
+
+// AcceptInvitation creates the user an invitation was sent for, with its
+// email, role and organization. The token must be the one of the emailed
+// link; expired invitations fail with model.ErrInvitationExpired and those
+// already accepted with model.ErrInvitationAccepted.
+func (s *UserService) AcceptInvitation(ctx context.Context, token string, input model.AcceptInvitationInput) (model.User, error) {
+	invitation, err := s.invitationFromToken(ctx, token)
+	if err != nil {
+		return model.User{}, err
+	}
+	s.setInvitationStatus(&invitation)
+	switch invitation.Status {
+	case model.InvitationAccepted:
+		return model.User{}, model.ErrInvitationAccepted
+	case model.InvitationExpired:
+		return model.User{}, model.ErrInvitationExpired
+	}
+
+	// the user is only created along with the invitation being accepted, so
+	// an invitation accepted concurrently creates no second user
+	ctx = model.WithOrg(ctx, invitation.OrgID)
+	var user model.User
+	err = s.repo.WithTx(ctx, func(ctx context.Context) error {
+		var err error
+		user, err = s.create(ctx, model.UserInput{
+			Name:     input.Name,
+			Email:    invitation.Email,
+			Role:     invitation.Role,
+			Birth:    input.Birth,
+			Metadata: input.Metadata,
+		})
+		if err != nil {
+			return err
+		}
+		return s.repo.AcceptInvitation(ctx, invitation.ID, user.ID, s.clock())
+	})
+	if err != nil {
+		return user, err
+	}
+	s.index(ctx, user)
+	return user, nil
+}
+
+// checkEmailTaken returns model.ErrDuplicateEmail when a user of the
+// organization already has the email, or an alias of it
+func (s *UserService) checkEmailTaken(ctx context.Context, email string) error {
+	users, err := s.repo.List(ctx, model.ListParams{Search: email})
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if normalizeEmail(user.Email) == email {
+			return model.ErrDuplicateEmail
+		}
+	}
+	return s.checkEmailAlias(ctx, email, 0)
+}
+
+// setInvitationStatus reports pending invitations past their expiry as expired
+func (s *UserService) setInvitationStatus(invitation *model.Invitation) {
+	if invitation.Status == model.InvitationPending && !s.clock().Before(invitation.ExpiresAt) {
+		invitation.Status = model.InvitationExpired
+	}
+}
+
+// invitationToken signs the ID, email and expiry of an invitation with
+// InviteSecret, so links can neither be forged nor extended
+func (s *UserService) invitationToken(invitation model.Invitation) string {
+	mac := hmac.New(sha256.New, s.opts.InviteSecret)
+	fmt.Fprintf(mac, "invitation:%d:%s:%d", invitation.ID, invitation.Email, invitation.ExpiresAt.Unix())
+	return strconv.Itoa(invitation.ID) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// invitationFromToken returns the invitation a token was signed for;
+// invalid tokens are reported as an unknown invitation
+func (s *UserService) invitationFromToken(ctx context.Context, token string) (model.Invitation, error) {
+	id, _, _ := strings.Cut(token, ".")
+	invitationID, err := strconv.Atoi(id)
+	if err != nil {
+		return model.Invitation{}, model.NotFound("invitation")
+	}
+
+	invitation, err := s.repo.GetInvitation(ctx, invitationID)
+	if err != nil {
+		return invitation, err
+	}
+	if !hmac.Equal([]byte(token), []byte(s.invitationToken(invitation))) {
+		return model.Invitation{}, model.NotFound("invitation")
+	}
+	return invitation, nil
+}
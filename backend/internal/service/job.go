@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/model"
+)
+
+// ListJobs returns the background jobs matching params, newest first
+func (s *UserService) ListJobs(ctx context.Context, params model.JobParams) ([]model.Job, error) {
+	return s.repo.ListJobs(ctx, params)
+}
+
+// RetryJob runs a dead job again as soon as a worker is free, with all of
+// its attempts; jobs that aren't dead are model.ErrNotFound
+func (s *UserService) RetryJob(ctx context.Context, id int) (model.Job, error) {
+	job, err := s.repo.RetryJob(ctx, id, s.clock())
+	if err != nil {
+		return job, err
+	}
+	s.logger.Printf("[retryJob] Retrying %s job %d", job.Type, job.ID)
+	return job, nil
+}
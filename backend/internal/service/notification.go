@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"api/internal/model"
+)
+
+// Notifications returns the in-app notifications of a user matching params,
+// newest first
+func (s *UserService) Notifications(ctx context.Context, userID int, params model.NotificationParams) ([]model.Notification, error) {
+	return s.repo.ListNotifications(ctx, userID, params)
+}
+
+// UnreadNotifications returns how many notifications of a user are unread
+func (s *UserService) UnreadNotifications(ctx context.Context, userID int) (int, error) {
+	return s.repo.CountUnreadNotifications(ctx, userID)
+}
+
+// MarkNotificationRead marks a notification of a user read
+func (s *UserService) MarkNotificationRead(ctx context.Context, userID int, id int64) error {
+	return s.repo.MarkNotificationRead(ctx, userID, id, s.clock().UTC())
+}
+
+// MarkAllNotificationsRead marks every notification of a user read and
+// returns how many were unread
+func (s *UserService) MarkAllNotificationsRead(ctx context.Context, userID int) (int, error) {
+	return s.repo.MarkAllNotificationsRead(ctx, userID, s.clock().UTC())
+}
+
+// NotificationPreferences returns the notification preferences of a user,
+// listing every channel and type
+func (s *UserService) NotificationPreferences(ctx context.Context, userID int) (model.NotificationPreferences, error) {
+	prefs, err := s.repo.GetNotificationPreferences(ctx, userID)
+	return prefs.Complete(), err
+}
+
+// SetNotificationPreferences replaces the notification preferences of a
+// user; the channels and types prefs leaves out are on
+func (s *UserService) SetNotificationPreferences(ctx context.Context, userID int, prefs model.NotificationPreferences) (model.NotificationPreferences, error) {
+	var v validator
+	for channel := range prefs.Channels {
+		if !slices.Contains(model.NotificationChannels, channel) {
+			v.add("channels."+channel, "must be one of "+strings.Join(model.NotificationChannels, ", "))
+		}
+	}
+	for typ := range prefs.Types {
+		if !slices.Contains(model.NotificationTypes, typ) {
+			v.add("types."+typ, "must be one of "+strings.Join(model.NotificationTypes, ", "))
+		}
+	}
+	if err := v.err(); err != nil {
+		return prefs, err
+	}
+
+	prefs = prefs.Complete()
+	if err := s.repo.SetNotificationPreferences(ctx, userID, prefs, s.clock()); err != nil {
+		return prefs, err
+	}
+	s.logger.Printf("[notificationPreferences] Updated the preferences of user %d: %+v", userID, prefs)
+	return prefs, nil
+}
+
+// notify tells a user of something that happened to their account, through
+// the channels they didn't turn off for its type: in the app, by email when
+// there is a mailer, and by text message for critical types when there is
+// an SMS provider. The change it tells of is done by then, so failures are
+// only logged.
+func (s *UserService) notify(ctx context.Context, user model.User, typ, title, body string) {
+	ctx = context.WithoutCancel(ctx)
+	prefs, err := s.repo.GetNotificationPreferences(ctx, user.ID)
+	if err != nil {
+		s.logger.Printf("[notify] failed to load the notification preferences of user %d: %v", user.ID, err)
+		return
+	}
+
+	if prefs.Allows(typ, model.ChannelInApp) {
+		notification := model.Notification{UserID: user.ID, Type: typ, Title: title, Body: body, CreatedAt: s.clock().UTC()}
+		if _, err := s.repo.CreateNotification(ctx, notification); err != nil {
+			s.logger.Printf("[notify] failed to notify user %d of %s in the app: %v", user.ID, typ, err)
+		}
+	}
+	if prefs.Allows(typ, model.ChannelEmail) && s.opts.Mailer != nil && user.AnonymizedAt == nil {
+		data := map[string]interface{}{"Name": user.Name, "Title": title, "Body": body}
+		if err := s.sendEmail(ctx, user.Email, "notification", data); err != nil {
+			s.logger.Printf("[notify] failed to email user %d of %s: %v", user.ID, typ, err)
+		}
+	}
+	if prefs.Allows(typ, model.ChannelSMS) && s.opts.SMS != nil && user.AnonymizedAt == nil && slices.Contains(model.CriticalNotificationTypes, typ) {
+		if err := s.textUser(ctx, user, title+". "+body); err != nil {
+			s.logger.Printf("[notify] failed to text user %d of %s: %v", user.ID, typ, err)
+		}
+	}
+}
+
+// notifyOthersEdit notifies a user whose profile was changed by someone
+// else, such as an admin, naming the fields they changed
+func (s *UserService) notifyOthersEdit(ctx context.Context, user model.User, changes []model.FieldChange) {
+	if len(changes) == 0 || !s.byOther(ctx, user.ID) {
+		return
+	}
+	fields := make([]string, len(changes))
+	for i, change := range changes {
+		fields[i] = change.Field
+	}
+	s.notify(ctx, user, model.NotificationProfileUpdated, "Your profile was updated by an admin",
+		fmt.Sprintf("Changed: %s.", strings.Join(fields, ", ")))
+}
+
+// byOther reports whether the changes made with ctx to the user are made
+// by someone else, an admin impersonating the user included. Without
+// authentication nobody is, as there is nobody to tell either.
+func (s *UserService) byOther(ctx context.Context, id int) bool {
+	actor := model.ActorFrom(ctx)
+	if actor == model.AnonymousActor {
+		return false
+	}
+	if actor.Impersonator != "" {
+		// the admin acts, on the impersonated user or on their own account
+		return actor.Impersonator != strconv.Itoa(id)
+	}
+	return actor.ID != strconv.Itoa(id)
+}
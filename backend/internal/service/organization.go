@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"api/internal/model"
+)
+
+const maxOrganizationNameLength = 100
+
+// ListOrganizations returns every organization, sorted by name
+func (s *UserService) ListOrganizations(ctx context.Context) ([]model.Organization, error) {
+	return s.repo.ListOrganizations(ctx)
+}
+
+// GetOrganization returns a single organization
+func (s *UserService) GetOrganization(ctx context.Context, id int) (model.Organization, error) {
+	return s.repo.GetOrganization(ctx, id)
+}
+
+// CreateOrganization validates the input and stores a new organization
+func (s *UserService) CreateOrganization(ctx context.Context, input model.OrganizationInput) (model.Organization, error) {
+	org, err := buildOrganization(s.sanitizeOrganization(input))
+	if err != nil {
+		return org, err
+	}
+	return s.repo.CreateOrganization(ctx, org)
+}
+
+// UpdateOrganization validates the input and renames an organization
+func (s *UserService) UpdateOrganization(ctx context.Context, id int, input model.OrganizationInput) (model.Organization, error) {
+	org, err := buildOrganization(s.sanitizeOrganization(input))
+	if err != nil {
+		return org, err
+	}
+
+	org.ID = id
+	return s.repo.UpdateOrganization(ctx, org)
+}
+
+// DeleteOrganization removes an organization, failing with
+// model.ErrOrganizationInUse while it still has users or teams
+func (s *UserService) DeleteOrganization(ctx context.Context, id int) error {
+	return s.repo.DeleteOrganization(ctx, id)
+}
+
+// buildOrganization validates the input and normalizes it into an organization
+func buildOrganization(input model.OrganizationInput) (model.Organization, error) {
+	var v validator
+
+	name := strings.TrimSpace(input.Name)
+	switch {
+	case name == "":
+		v.add("name", "is required")
+	case utf8.RuneCountInString(name) > maxOrganizationNameLength:
+		v.add("name", "must be at most 100 characters")
+	}
+
+	return model.Organization{Name: name}, v.err()
+}
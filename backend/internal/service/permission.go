@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"api/internal/model"
+)
+
+const maxPermissionDescriptionLength = 255
+
+// ListPermissions returns the permissions managed through the API, oldest first
+func (s *UserService) ListPermissions(ctx context.Context) ([]model.Permission, error) {
+	return s.repo.ListPermissions(ctx)
+}
+
+// GetPermission returns a single permission
+func (s *UserService) GetPermission(ctx context.Context, id int) (model.Permission, error) {
+	return s.repo.GetPermission(ctx, id)
+}
+
+// CreatePermission validates the input and stores a new permission
+func (s *UserService) CreatePermission(ctx context.Context, input model.PermissionInput) (model.Permission, error) {
+	permission, err := buildPermission(input)
+	if err != nil {
+		return permission, err
+	}
+	return s.repo.CreatePermission(ctx, permission)
+}
+
+// UpdatePermission validates the input and replaces a permission
+func (s *UserService) UpdatePermission(ctx context.Context, id int, input model.PermissionInput) (model.Permission, error) {
+	permission, err := buildPermission(input)
+	if err != nil {
+		return permission, err
+	}
+
+	permission.ID = id
+	return s.repo.UpdatePermission(ctx, permission)
+}
+
+// DeletePermission removes a permission
+func (s *UserService) DeletePermission(ctx context.Context, id int) error {
+	return s.repo.DeletePermission(ctx, id)
+}
+
+// buildPermission validates the input and normalizes it into a permission
+func buildPermission(input model.PermissionInput) (model.Permission, error) {
+	var v validator
+
+	effect := strings.ToLower(strings.TrimSpace(input.Effect))
+	if effect != "permit" && effect != "forbid" {
+		v.add("effect", "must be permit or forbid")
+	}
+
+	principal := strings.TrimSpace(input.Principal)
+	switch {
+	case principal == "":
+		v.add("principal", "is required")
+	case principal != "*" && !strings.HasPrefix(principal, "user:") && !strings.HasPrefix(principal, "role:"):
+		v.add("principal", "must be *, user:<id> or role:<name>")
+	case !validPattern(principal):
+		v.add("principal", "must be a valid pattern")
+	}
+
+	action := strings.TrimSpace(input.Action)
+	switch {
+	case action == "":
+		v.add("action", "is required")
+	case !validPattern(action):
+		v.add("action", "must be a valid pattern")
+	}
+
+	resource := strings.TrimSpace(input.Resource)
+	if resource == "" {
+		resource = "*"
+	} else if !validPattern(resource) {
+		v.add("resource", "must be a valid pattern")
+	}
+
+	fields := []string{}
+	for _, field := range input.Fields {
+		field = strings.TrimSpace(field)
+		if !validPattern(field) || !matchesAny(field, model.EditableUserFields) {
+			v.add("fields", "must be patterns of "+strings.Join(model.EditableUserFields, ", "))
+			continue
+		}
+		fields = append(fields, field)
+	}
+
+	description := strings.TrimSpace(input.Description)
+	if utf8.RuneCountInString(description) > maxPermissionDescriptionLength {
+		v.add("description", "must be at most 255 characters")
+	}
+
+	permission := model.Permission{
+		Effect:      effect,
+		Principal:   principal,
+		Action:      action,
+		Resource:    resource,
+		Fields:      fields,
+		Description: description,
+	}
+	return permission, v.err()
+}
+
+// validPattern reports whether pattern is a well-formed glob pattern
+func validPattern(pattern string) bool {
+	_, err := path.Match(pattern, "")
+	return pattern != "" && err == nil
+}
+
+// matchesAny reports whether the glob pattern matches one of the names
+func matchesAny(pattern string, names []string) bool {
+	for _, name := range names {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nyaruka/phonenumbers"
+
+	"api/internal/model"
+)
+
+// ListPhones returns the phone numbers of a user, the primary one first
+func (s *UserService) ListPhones(ctx context.Context, userID int) ([]model.Phone, error) {
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return nil, err
+	}
+	return s.repo.ListPhones(ctx, userID)
+}
+
+// CreatePhone adds a phone number to a user
+func (s *UserService) CreatePhone(ctx context.Context, userID int, input model.PhoneInput) (model.Phone, error) {
+	phone, err := buildPhone(input)
+	if err != nil {
+		return phone, err
+	}
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return phone, err
+	}
+
+	phone.UserID = userID
+	return s.repo.CreatePhone(ctx, phone)
+}
+
+// UpdatePhone replaces a phone number of a user
+func (s *UserService) UpdatePhone(ctx context.Context, userID, id int, input model.PhoneInput) (model.Phone, error) {
+	phone, err := buildPhone(input)
+	if err != nil {
+		return phone, err
+	}
+
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return phone, err
+	}
+
+	phone.ID = id
+	phone.UserID = userID
+	return s.repo.UpdatePhone(ctx, phone)
+}
+
+// DeletePhone removes a phone number of a user
+func (s *UserService) DeletePhone(ctx context.Context, userID, id int) error {
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.DeletePhone(ctx, userID, id)
+}
+
+// buildPhone validates the input and normalizes its number to E.164
+func buildPhone(input model.PhoneInput) (model.Phone, error) {
+	var v validator
+
+	number := strings.TrimSpace(input.Number)
+	region := strings.ToUpper(strings.TrimSpace(input.Region))
+	if region != "" && !validCountry(region) {
+		v.add("region", "must be an ISO 3166-1 alpha-2 code such as ID or US")
+	}
+
+	var e164 string
+	if number == "" {
+		v.add("number", "is required")
+	} else if normalized, ok := normalizePhone(number, region); !ok {
+		if region == "" && !strings.HasPrefix(number, "+") {
+			v.add("number", "must start with +country code, or a region must be given")
+		} else {
+			v.add("number", "must be a valid phone number")
+		}
+	} else {
+		e164 = normalized
+	}
+
+	return model.Phone{Number: e164, IsPrimary: input.IsPrimary}, v.err()
+}
+
+// normalizePhone formats number as E.164, reading numbers without a
+// +country prefix as numbers of region
+func normalizePhone(number, region string) (string, bool) {
+	parsed, err := phonenumbers.Parse(number, region)
+	if err != nil || !phonenumbers.IsValidNumber(parsed) {
+		return "", false
+	}
+	return phonenumbers.Format(parsed, phonenumbers.E164), true
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+
+	"api/internal/model"
+)
+
+// History returns the revisions of a user, oldest first
+func (s *UserService) History(ctx context.Context, id int) ([]model.Revision, error) {
+	if _, err := s.repo.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.ListRevisions(ctx, id)
+}
+
+// Revert restores the fields of a user to what they were right after the
+// revision with the given ID, undoing the edits made since. The revert is
+// an update like any other: it is validated, recorded as a new revision,
+// and fails with model.ErrVersionConflict when the user is edited meanwhile.
+// Anonymized users can't be reverted, their revisions hold no values.
+func (s *UserService) Revert(ctx context.Context, id, revisionID int) (model.User, error) {
+	current, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return current, err
+	}
+	if current.AnonymizedAt != nil {
+		return current, model.ErrAlreadyAnonymized
+	}
+	revisions, err := s.repo.ListRevisions(ctx, id)
+	if err != nil {
+		return current, err
+	}
+	target := -1
+	for i, rev := range revisions {
+		if rev.ID == revisionID {
+			target = i
+		}
+	}
+	if target < 0 {
+		return current, model.NotFound("revision")
+	}
+
+	input := model.UserInput{
+		Name:     current.Name,
+		Email:    current.Email,
+		Role:     current.Role,
+		Birth:    current.Birth.String(),
+		Version:  current.Version,
+		Metadata: current.Metadata,
+	}
+	// newest first, so each field ends up with its value before the oldest edit undone
+	for i := len(revisions) - 1; i > target; i-- {
+		for _, change := range revisions[i].Changes {
+			revertField(&input, change.Field, change.Old)
+		}
+	}
+
+	s.logger.Printf("[revertUser] Reverting user %d to revision %d", id, revisionID)
+	return s.update(ctx, id, input, true)
+}
+
+// revision returns the revision of an edit making the changes, made now
+// by the actor of the context
+func (s *UserService) revision(ctx context.Context, changes []model.FieldChange) model.Revision {
+	actor := model.ActorFrom(ctx)
+	return model.Revision{Actor: actor.ID, Impersonator: actor.Impersonator, Changes: changes, CreatedAt: s.clock()}
+}
+
+// revertField sets a field of input back to its value in a revision, as
+// decoded from JSON
+func revertField(input *model.UserInput, field string, value interface{}) {
+	switch field {
+	case "name":
+		input.Name, _ = value.(string)
+	case "email":
+		input.Email, _ = value.(string)
+	case "role":
+		input.Role, _ = value.(string)
+	case "birth":
+		input.Birth, _ = value.(string)
+	case "metadata":
+		// an empty object still replaces the metadata
+		metadata, _ := value.(map[string]interface{})
+		input.Metadata = model.Metadata{}.Merge(metadata)
+	}
+}
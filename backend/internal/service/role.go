@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"api/internal/model"
+)
+
+const maxRoleDescriptionLength = 255
+
+// ListRoles returns the roles users can be given, sorted by name
+func (s *UserService) ListRoles(ctx context.Context) ([]model.Role, error) {
+	return s.repo.ListRoles(ctx)
+}
+
+// GetRole returns a single role
+func (s *UserService) GetRole(ctx context.Context, name string) (model.Role, error) {
+	return s.repo.GetRole(ctx, name)
+}
+
+// CreateRole validates the input and stores a new role
+func (s *UserService) CreateRole(ctx context.Context, input model.RoleInput) (model.Role, error) {
+	role, err := buildRole(s.sanitizeRole(input))
+	if err != nil {
+		return role, err
+	}
+	return s.repo.CreateRole(ctx, role)
+}
+
+// UpdateRole replaces the description of a role. Names can't change, as
+// users and policies refer to roles by name.
+func (s *UserService) UpdateRole(ctx context.Context, name string, input model.RoleInput) (model.Role, error) {
+	input.Name = name
+	role, err := buildRole(s.sanitizeRole(input))
+	if err != nil {
+		return role, err
+	}
+	return s.repo.UpdateRole(ctx, role)
+}
+
+// DeleteRole removes a role, failing with model.ErrRoleInUse while users still have it
+func (s *UserService) DeleteRole(ctx context.Context, name string) error {
+	return s.repo.DeleteRole(ctx, name)
+}
+
+// buildRole validates the input and normalizes it into a role
+func buildRole(input model.RoleInput) (model.Role, error) {
+	var v validator
+
+	name := strings.TrimSpace(input.Name)
+	switch {
+	case name == "":
+		v.add("name", "is required")
+	case !model.RoleNamePattern.MatchString(name):
+		v.add("name", "must be 1 to 64 lowercase letters, digits, '_' or '-', starting with a letter")
+	}
+
+	description := strings.TrimSpace(input.Description)
+	if utf8.RuneCountInString(description) > maxRoleDescriptionLength {
+		v.add("description", "must be at most 255 characters")
+	}
+
+	return model.Role{Name: name, Description: description}, v.err()
+}
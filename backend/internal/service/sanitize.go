@@ -0,0 +1,71 @@
+package service
+
+import (
+	"api/internal/model"
+	"api/internal/sanitize"
+)
+
+// SanitizedFields are the stored text fields Options.Sanitize applies to;
+// the strings of users.metadata are sanitized at any depth
+var SanitizedFields = []string{
+	"users.name", "users.metadata",
+	"teams.name", "teams.description",
+	"organizations.name",
+	"roles.description",
+	"addresses.street", "addresses.city",
+}
+
+// sanitizeUser sanitizes the text of a user input, before it is validated
+// so text left empty is reported
+func (s *UserService) sanitizeUser(input model.UserInput) model.UserInput {
+	input.Name = s.opts.Sanitize.Text("users.name", input.Name)
+	if mode := s.opts.Sanitize.Mode("users.metadata"); mode != sanitize.Keep && input.Metadata != nil {
+		input.Metadata = sanitizeValue(mode, map[string]interface{}(input.Metadata)).(map[string]interface{})
+	}
+	return input
+}
+
+func (s *UserService) sanitizeTeam(input model.TeamInput) model.TeamInput {
+	input.Name = s.opts.Sanitize.Text("teams.name", input.Name)
+	input.Description = s.opts.Sanitize.Text("teams.description", input.Description)
+	return input
+}
+
+func (s *UserService) sanitizeOrganization(input model.OrganizationInput) model.OrganizationInput {
+	input.Name = s.opts.Sanitize.Text("organizations.name", input.Name)
+	return input
+}
+
+func (s *UserService) sanitizeRole(input model.RoleInput) model.RoleInput {
+	input.Description = s.opts.Sanitize.Text("roles.description", input.Description)
+	return input
+}
+
+func (s *UserService) sanitizeAddress(input model.AddressInput) model.AddressInput {
+	input.Street = s.opts.Sanitize.Text("addresses.street", input.Street)
+	input.City = s.opts.Sanitize.Text("addresses.city", input.City)
+	return input
+}
+
+// sanitizeValue returns a copy of a decoded JSON value with its strings
+// sanitized in the mode
+func sanitizeValue(mode sanitize.Mode, value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return sanitize.Text(mode, value)
+	case map[string]interface{}:
+		sanitized := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			sanitized[key] = sanitizeValue(mode, item)
+		}
+		return sanitized
+	case []interface{}:
+		sanitized := make([]interface{}, len(value))
+		for i, item := range value {
+			sanitized[i] = sanitizeValue(mode, item)
+		}
+		return sanitized
+	default:
+		return value
+	}
+}
@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"api/internal/jobs"
+	"api/internal/model"
+	"api/internal/sms"
+)
+
+// JobSendSMS is the type of the jobs sending the text messages of the service
+const JobSendSMS = "send-sms"
+
+// sendSMS sends the text message to the number, or queues it when there is
+// a job queue
+func (s *UserService) sendSMS(ctx context.Context, to, body string) error {
+	msg := sms.Message{To: to, Body: body}
+	if s.opts.Jobs != nil {
+		_, err := s.opts.Jobs.Enqueue(ctx, JobSendSMS, msg)
+		return err
+	}
+	return s.opts.SMS.Send(ctx, msg)
+}
+
+// textUser sends the text message to the primary phone number of the user,
+// if they have one
+func (s *UserService) textUser(ctx context.Context, user model.User, body string) error {
+	phones, err := s.repo.ListPhones(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, phone := range phones {
+		if phone.IsPrimary {
+			return s.sendSMS(ctx, phone.Number, body)
+		}
+	}
+	return nil
+}
+
+// DeliverSMS returns the handler of the JobSendSMS jobs, sending their text
+// message through sender. Messages over the limit of their country aren't
+// retried.
+func DeliverSMS(sender sms.Sender) jobs.Handler {
+	return func(ctx context.Context, job model.Job) error {
+		var msg sms.Message
+		if err := json.Unmarshal(job.Payload, &msg); err != nil {
+			return jobs.Permanent(err)
+		}
+		err := sender.Send(ctx, msg)
+		if errors.Is(err, sms.ErrRateLimited) {
+			return jobs.Permanent(err)
+		}
+		return err
+	}
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"api/internal/model"
+)
+
+// SendBirthdayGreetings emails the active users of every organization whose
+// birthday is today, unless they turned birthday emails off. Those born on
+// February 29 are greeted on February 28 in other years.
+func (s *UserService) SendBirthdayGreetings(ctx context.Context) error {
+	now := s.clock()
+	days := []string{now.Format("01-02")}
+	if now.Month() == time.February && now.Day() == 28 && time.Date(now.Year(), time.February, 29, 0, 0, 0, 0, time.UTC).Day() != 29 {
+		days = append(days, "02-29")
+	}
+
+	orgs, err := s.repo.ListOrganizations(ctx)
+	if err != nil {
+		return err
+	}
+	greeted, failed := 0, 0
+	for _, org := range orgs {
+		orgCtx := model.WithOrg(ctx, org.ID)
+		users, err := s.repo.Birthdays(orgCtx, days)
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			prefs, err := s.repo.GetNotificationPreferences(orgCtx, user.ID)
+			if err != nil {
+				return err
+			}
+			if !prefs.Allows(model.NotificationBirthday, model.ChannelEmail) {
+				continue
+			}
+			data := map[string]interface{}{"Name": user.Name, "Age": now.Year() - user.Birth.Year()}
+			if err := s.sendEmail(orgCtx, user.Email, "birthday", data); err != nil {
+				s.logger.Printf("[birthdayGreetings] Failed to greet user %d: %v", user.ID, err)
+				failed++
+				continue
+			}
+			greeted++
+		}
+	}
+
+	s.logger.Printf("[birthdayGreetings] Greeted %d users", greeted)
+	if failed > 0 {
+		return fmt.Errorf("failed to greet %d of %d users", failed, greeted+failed)
+	}
+	return nil
+}
+
+// DeleteStaleData deletes the expired sessions, and the imports finished
+// and jobs dead for longer than olderThan
+func (s *UserService) DeleteStaleData(ctx context.Context, olderThan time.Duration) error {
+	now := s.clock()
+	deleted, err := s.repo.DeleteStaleData(ctx, now, now.Add(-olderThan))
+	if err != nil {
+		return err
+	}
+	s.logger.Printf("[cleanup] Deleted %d sessions, %d imports and %d jobs", deleted["sessions"], deleted["imports"], deleted["jobs"])
+	return nil
+}
+
+// PurgeExpiredData permanently deletes the audit log entries older than
+// auditDays, or only logs how many it would delete when dryRun is set
+func (s *UserService) PurgeExpiredData(ctx context.Context, auditDays int, dryRun bool) error {
+	before := s.clock().AddDate(0, 0, -auditDays)
+	purged, err := s.repo.PurgeAudit(ctx, before, dryRun)
+	if err != nil {
+		return err
+	}
+	if dryRun {
+		s.logger.Printf("[retention] Dry run: would purge %d audit log entries from before %s", purged, before.Format(time.RFC3339))
+		return nil
+	}
+	s.logger.Printf("[retention] Purged %d audit log entries from before %s", purged, before.Format(time.RFC3339))
+	return nil
+}
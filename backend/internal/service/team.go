@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"api/internal/model"
+)
+
+const (
+	maxTeamNameLength        = 100
+	maxTeamDescriptionLength = 255
+)
+
+// ListTeams returns every team, sorted by name
+func (s *UserService) ListTeams(ctx context.Context) ([]model.Team, error) {
+	return s.repo.ListTeams(ctx)
+}
+
+// GetTeam returns a single team
+func (s *UserService) GetTeam(ctx context.Context, id int) (model.Team, error) {
+	return s.repo.GetTeam(ctx, id)
+}
+
+// CreateTeam validates the input and stores a new team
+func (s *UserService) CreateTeam(ctx context.Context, input model.TeamInput) (model.Team, error) {
+	team, err := buildTeam(s.sanitizeTeam(input))
+	if err != nil {
+		return team, err
+	}
+	return s.repo.CreateTeam(ctx, team)
+}
+
+// UpdateTeam validates the input and replaces a team
+func (s *UserService) UpdateTeam(ctx context.Context, id int, input model.TeamInput) (model.Team, error) {
+	team, err := buildTeam(s.sanitizeTeam(input))
+	if err != nil {
+		return team, err
+	}
+
+	team.ID = id
+	return s.repo.UpdateTeam(ctx, team)
+}
+
+// DeleteTeam removes a team; its members stay, only their membership goes
+func (s *UserService) DeleteTeam(ctx context.Context, id int) error {
+	return s.repo.DeleteTeam(ctx, id)
+}
+
+// ListTeamMembers returns the members of a team, sorted like a user listing
+func (s *UserService) ListTeamMembers(ctx context.Context, id int, params model.ListParams) ([]model.User, error) {
+	if _, err := s.repo.GetTeam(ctx, id); err != nil {
+		return nil, err
+	}
+	params.Filter.Teams = []int{id}
+	return s.List(ctx, params)
+}
+
+// AddTeamMember makes a user a member of a team, doing nothing when they already are
+func (s *UserService) AddTeamMember(ctx context.Context, teamID, userID int) error {
+	if _, err := s.repo.GetTeam(ctx, teamID); err != nil {
+		return err
+	}
+	if _, err := s.repo.Get(ctx, userID); err != nil {
+		return err
+	}
+	return s.repo.AddTeamMember(ctx, teamID, userID)
+}
+
+// RemoveTeamMember removes a user from a team
+func (s *UserService) RemoveTeamMember(ctx context.Context, teamID, userID int) error {
+	if _, err := s.repo.GetTeam(ctx, teamID); err != nil {
+		return err
+	}
+	return s.repo.RemoveTeamMember(ctx, teamID, userID)
+}
+
+// buildTeam validates the input and normalizes it into a team
+func buildTeam(input model.TeamInput) (model.Team, error) {
+	var v validator
+
+	name := strings.TrimSpace(input.Name)
+	switch {
+	case name == "":
+		v.add("name", "is required")
+	case utf8.RuneCountInString(name) > maxTeamNameLength:
+		v.add("name", "must be at most 100 characters")
+	}
+
+	description := strings.TrimSpace(input.Description)
+	if utf8.RuneCountInString(description) > maxTeamDescriptionLength {
+		v.add("description", "must be at most 255 characters")
+	}
+
+	return model.Team{Name: name, Description: description}, v.err()
+}
@@ -0,0 +1,437 @@
+// Package service implements the business rules around users, independent
+// of HTTP and of the database in use.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"api/internal/auth"
+	"api/internal/flags"
+	"api/internal/mailer"
+	"api/internal/model"
+	"api/internal/repository"
+	"api/internal/sanitize"
+	"api/internal/sms"
+	"api/internal/storage"
+)
+
+// Options tune the business rules of a UserService
+type Options struct {
+	// RejectEmailAliases treats plus-addressed variants such as
+	// ann+news@example.com as duplicates of ann@example.com
+	RejectEmailAliases bool
+	// Indexer, when set, mirrors every write into a search index
+	Indexer Indexer
+	// Storage keeps uploaded avatars of at most AvatarMaxBytes, zero meaning no limit
+	Storage        storage.Store
+	AvatarMaxBytes int64
+	// AvatarSizes are the sizes in pixels of the thumbnails generated for avatars
+	AvatarSizes []int
+	// AvatarMaxPixels caps the width times the height of avatars, zero
+	// meaning no limit
+	AvatarMaxPixels int
+	// AvatarURL is the API URL serving the avatar of a user, or its thumbnail
+	// when size isn't zero, used when Storage can't presign URLs valid for AvatarURLTTL
+	AvatarURL    func(id, size int) string
+	AvatarURLTTL time.Duration
+	// AuthorizeFields, when set, is asked whether the caller may change the
+	// given fields of a user and returns a model.ForbiddenError if not
+	AuthorizeFields func(ctx context.Context, id int, fields []string) error
+	// Mailer sends the invitation, verification and password reset emails;
+	// nil disables invitations, registration and password resets
+	Mailer mailer.Sender
+	// Templates renders the emails Mailer sends
+	Templates *mailer.Templates
+	// SMS sends the text messages of critical notifications, see
+	// model.CriticalNotificationTypes; nil disables them
+	SMS sms.Sender
+	// Jobs, when set, queues the emails to be sent in the background, see
+	// DeliverEmails, otherwise sent while serving the request, and runs the
+	// CSV imports of at most ImportMaxBytes, see ImportUsers; nil disables imports
+	Jobs           Enqueuer
+	ImportMaxBytes int64
+	// InviteSecret signs the links of invitations, which are valid for InviteTTL
+	InviteSecret []byte
+	InviteTTL    time.Duration
+	// InviteURL is the link emailed to invitees, with {token} replaced by the invitation token
+	InviteURL string
+	// Tokens signs the access tokens users log in for, valid for
+	// AccessTokenTTL, and the email verification links of self-registered
+	// users, valid for VerifyTTL; nil disables logging in and registration
+	Tokens         *auth.Signer
+	AccessTokenTTL time.Duration
+	VerifyTTL      time.Duration
+	// VerifyURL is the link emailed to new users, with {token} replaced by the verification token
+	VerifyURL string
+	// ResetURL is the link emailed to reset a forgotten password, valid for
+	// ResetTTL, with {token} replaced by the reset token
+	ResetURL string
+	ResetTTL time.Duration
+	// SessionTTL is how long cookie sessions last, see CreateSession
+	SessionTTL time.Duration
+	// ImpersonationTTL is how long the tokens of Impersonate last
+	ImpersonationTTL time.Duration
+	// AdminRoles are the roles allowed to impersonate users and revoke the
+	// tokens of others, whatever the policies allow
+	AdminRoles []string
+	// SignupRole is the role of self-registered users
+	SignupRole string
+	// Sanitize strips or escapes the HTML of the text fields clients
+	// store, see SanitizedFields; the zero Policy keeps it
+	Sanitize sanitize.Policy
+	// Flags turns experimental behaviors on and off, per organization; nil
+	// leaves every flag at its default
+	Flags *flags.Set
+}
+
+// Indexer keeps a copy of the users outside the database, such as a search index
+type Indexer interface {
+	IndexUser(ctx context.Context, user model.User) error
+	DeleteUser(ctx context.Context, id int) error
+}
+
+// Enqueuer queues jobs to run in the background, such as a jobs.Queue
+type Enqueuer interface {
+	Enqueue(ctx context.Context, jobType string, payload interface{}) (model.Job, error)
+}
+
+// UserService applies the business rules to user operations
+type UserService struct {
+	repo   repository.UserRepository
+	logger *log.Logger
+	clock  func() time.Time
+	opts   Options
+
+	// avatarUploads numbers the avatar uploads of each user, see startAvatarUpload
+	avatarMu      sync.Mutex
+	avatarUploads map[int]uint64
+}
+
+// NewUserService creates a UserService persisting through repo, using clock
+// as the current time when deriving ages
+func NewUserService(repo repository.UserRepository, logger *log.Logger, clock func() time.Time, opts Options) *UserService {
+	return &UserService{repo: repo, logger: logger, clock: clock, opts: opts, avatarUploads: map[int]uint64{}}
+}
+
+// List returns the users matching the search, sorted as requested
+func (s *UserService) List(ctx context.Context, params model.ListParams) ([]model.User, error) {
+	params.PlainSearch = !s.flagEnabled(ctx, flags.SearchFullText)
+	users, err := s.repo.List(ctx, params)
+	for i := range users {
+		s.setAvatarURL(&users[i])
+	}
+	return users, err
+}
+
+// Count returns the number of users matching the search and filters
+func (s *UserService) Count(ctx context.Context, params model.ListParams) (int, error) {
+	params.PlainSearch = !s.flagEnabled(ctx, flags.SearchFullText)
+	return s.repo.Count(ctx, params)
+}
+
+// Suggest returns up to limit users whose name or email starts with prefix, for typeahead pickers
+func (s *UserService) Suggest(ctx context.Context, prefix string, limit int) ([]model.User, error) {
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+	if prefix == "" {
+		return nil, nil
+	}
+	return s.repo.Suggest(ctx, prefix, limit)
+}
+
+// Get returns a single user
+func (s *UserService) Get(ctx context.Context, id int) (model.User, error) {
+	user, err := s.repo.Get(ctx, id)
+	s.setAvatarURL(&user)
+	return user, err
+}
+
+// Create validates the input and stores a new user
+func (s *UserService) Create(ctx context.Context, input model.UserInput) (model.User, error) {
+	user, err := s.create(ctx, input)
+	if err != nil {
+		return user, err
+	}
+	s.index(ctx, user)
+	return user, nil
+}
+
+// create validates the input and stores the user, leaving the search index
+// to the caller, which may run it in a transaction
+func (s *UserService) create(ctx context.Context, input model.UserInput) (model.User, error) {
+	user, err := s.buildUser(ctx, input, false)
+	if err != nil {
+		return user, err
+	}
+	if err := s.checkEmailAlias(ctx, user.Email, 0); err != nil {
+		return user, err
+	}
+
+	s.logger.Printf("[createUser] Received: %+v", user)
+	user, err = s.repo.Create(ctx, user)
+	if err != nil {
+		return user, err
+	}
+	s.logger.Printf("[createUser] Inserted: %+v", user)
+	return user, nil
+}
+
+// Update validates the input and replaces the user's data, failing with
+// model.ErrVersionConflict when input.Version is no longer current
+func (s *UserService) Update(ctx context.Context, id int, input model.UserInput) (model.User, error) {
+	return s.update(ctx, id, input, true)
+}
+
+// update stores the input over the user, checking the fields it changes
+// with AuthorizeFields when authorize is set
+func (s *UserService) update(ctx context.Context, id int, input model.UserInput, authorize bool) (model.User, error) {
+	user, err := s.buildUser(ctx, input, true)
+	if err != nil {
+		return user, err
+	}
+	if err := s.checkEmailAlias(ctx, user.Email, id); err != nil {
+		return user, err
+	}
+
+	// the user is read and updated in one transaction, so the changes
+	// recorded are from the row the update replaces
+	var changes []model.FieldChange
+	err = s.repo.WithTx(ctx, func(ctx context.Context) error {
+		current, err := s.repo.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+		if authorize {
+			if err := s.authorizeFields(ctx, id, current, user); err != nil {
+				return err
+			}
+		}
+
+		s.logger.Printf("[updateUser] Received: %+v", user)
+		// a stale version fails the update, so the changes are from the version it edits
+		changes = current.Changes(user)
+		user, err = s.repo.Update(ctx, id, user, s.revision(ctx, changes))
+		return err
+	})
+	if err != nil {
+		return user, err
+	}
+
+	s.logger.Printf("[updateUser] Updated: %+v", user)
+	s.notifyOthersEdit(ctx, user, changes)
+	s.index(ctx, user)
+	s.setAvatarURL(&user)
+	return user, nil
+}
+
+// Patch applies a merge patch to the user: fields it omits keep their
+// value and its metadata is merged into the stored one
+func (s *UserService) Patch(ctx context.Context, id int, patch model.UserPatch) (model.User, error) {
+	var v validator
+	validatePatch(&v, patch)
+	if err := v.err(); err != nil {
+		return model.User{}, err
+	}
+	return s.patch(ctx, id, patch, true)
+}
+
+// UpdateProfile applies a merge patch to the user's own profile. Users can
+// change their name, birth date and metadata, but neither their role nor
+// the email they log in with; since those are the only fields, the
+// field-level policies of users:update don't apply.
+func (s *UserService) UpdateProfile(ctx context.Context, id int, patch model.UserPatch) (model.User, error) {
+	var v validator
+	if patch.Role != nil {
+		v.add("role", "can't be changed on your own profile")
+	}
+	if patch.Email != nil {
+		v.add("email", "can't be changed on your own profile")
+	}
+	validatePatch(&v, patch)
+	if err := v.err(); err != nil {
+		return model.User{}, err
+	}
+	return s.patch(ctx, id, patch, false)
+}
+
+// patch applies a validated merge patch like Patch, authorizing the changed fields when authorize is set
+func (s *UserService) patch(ctx context.Context, id int, patch model.UserPatch, authorize bool) (model.User, error) {
+	current, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return current, err
+	}
+
+	input := model.UserInput{
+		Name:     current.Name,
+		Email:    current.Email,
+		Role:     current.Role,
+		Birth:    current.Birth.String(),
+		Version:  *patch.Version,
+		Metadata: current.Metadata.Merge(patch.Metadata),
+	}
+	if patch.Name != nil {
+		input.Name = *patch.Name
+	}
+	if patch.Email != nil {
+		input.Email = *patch.Email
+	}
+	if patch.Role != nil {
+		input.Role = *patch.Role
+	}
+	if patch.Birth != nil {
+		input.Birth = *patch.Birth
+	}
+
+	return s.update(ctx, id, input, authorize)
+}
+
+// Delete removes a user
+func (s *UserService) Delete(ctx context.Context, id int) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	if s.opts.Indexer != nil {
+		if err := s.opts.Indexer.DeleteUser(context.WithoutCancel(ctx), id); err != nil {
+			s.logger.Printf("[search] failed to remove user %d from the index: %v", id, err)
+		}
+	}
+	if s.opts.Storage != nil {
+		if err := s.deleteAvatarFiles(context.WithoutCancel(ctx), id); err != nil {
+			s.logger.Printf("[storage] failed to remove the avatar of user %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// Anonymize irreversibly replaces the personal data of a user with
+// placeholders, for when someone asks to be forgotten. The name and email
+// become pseudonyms derived from the ID and only the year of the birth date
+// is kept, so the user still counts in statistics by role, organization or
+// age. Its metadata, avatar, password, addresses, phone numbers and
+// invitations are removed and its tokens revoked; its ID, role, teams and
+// audit log entries stay.
+func (s *UserService) Anonymize(ctx context.Context, id int) (model.User, error) {
+	now := s.clock()
+	current, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return current, err
+	}
+
+	birth := model.NewDate(time.Date(current.Birth.Year(), time.January, 1, 0, 0, 0, 0, time.UTC))
+	user := model.User{
+		Name:         fmt.Sprintf("Anonymized user %d", id),
+		Email:        fmt.Sprintf("anonymized-%d@anonymized.invalid", id),
+		Role:         current.Role,
+		Birth:        birth,
+		Age:          model.AgeAt(birth.Time, now),
+		Metadata:     model.Metadata{},
+		AnonymizedAt: &now,
+	}
+	// the history keeps the placeholders, not the data they replace
+	changes := current.Changes(user)
+	for i := range changes {
+		changes[i].Old = nil
+	}
+	// uploads still scaling down thumbnails drop them
+	s.startAvatarUpload(id)
+	user, err = s.repo.Anonymize(ctx, id, user, s.revision(ctx, changes))
+	if err != nil {
+		return user, err
+	}
+
+	s.logger.Printf("[anonymizeUser] Anonymized user %d", id)
+	s.index(ctx, user)
+	if s.opts.Storage != nil && current.Avatar != "" {
+		if err := s.deleteAvatarFiles(context.WithoutCancel(ctx), id); err != nil {
+			s.logger.Printf("[storage] failed to remove the avatar of user %d: %v", id, err)
+		}
+	}
+	return user, nil
+}
+
+// authorizeFields checks the fields the update of current changes with AuthorizeFields
+func (s *UserService) authorizeFields(ctx context.Context, id int, current, user model.User) error {
+	if s.opts.AuthorizeFields == nil {
+		return nil
+	}
+
+	changed := current.ChangedFields(user)
+	if len(changed) == 0 {
+		return nil
+	}
+	return s.opts.AuthorizeFields(ctx, id, changed)
+}
+
+// index mirrors a written user into the Indexer. The database stays the
+// source of truth, so failures are only logged; a reindex repairs them.
+func (s *UserService) index(ctx context.Context, user model.User) {
+	if s.opts.Indexer == nil {
+		return
+	}
+	if err := s.opts.Indexer.IndexUser(context.WithoutCancel(ctx), user); err != nil {
+		s.logger.Printf("[search] failed to index user %d: %v", user.ID, err)
+	}
+}
+
+// buildUser validates client input and turns it into a user, deriving the age from the birth date
+func (s *UserService) buildUser(ctx context.Context, input model.UserInput, update bool) (model.User, error) {
+	now := s.clock()
+	input = s.sanitizeUser(input)
+
+	roles, err := s.repo.ListRoles(ctx)
+	if err != nil {
+		return model.User{}, err
+	}
+	birth, err := validateUserInput(input, now, update, roles)
+	if err != nil {
+		return model.User{}, err
+	}
+
+	user := model.User{
+		Name:    strings.TrimSpace(input.Name),
+		Email:   normalizeEmail(input.Email),
+		Role:    input.Role,
+		Birth:   birth,
+		Version: input.Version,
+	}
+
+	if s.opts.RejectEmailAliases {
+		user.CanonicalEmail = CanonicalEmail(user.Email)
+	}
+
+	// null values only make sense in patches, drop them; updates without
+	// metadata keep the stored one
+	if input.Metadata != nil || !update {
+		user.Metadata = model.Metadata{}.Merge(input.Metadata)
+	}
+
+	// Calculate age from birth
+	user.Age = model.AgeAt(user.Birth.Time, now)
+	return user, nil
+}
+
+// checkEmailAlias returns model.ErrDuplicateEmail when RejectEmailAliases is
+// set and another user's address only differs from email by its +tag, in
+// any organization, as the unique canonical emails would when storing it
+func (s *UserService) checkEmailAlias(ctx context.Context, email string, ignoreID int) error {
+	if !s.opts.RejectEmailAliases {
+		return nil
+	}
+
+	id, err := s.repo.GetByCanonicalEmail(ctx, CanonicalEmail(email))
+	if errors.Is(err, model.ErrNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if id != ignoreID {
+		return model.ErrDuplicateEmail
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// newUserService returns a UserService on an empty in-memory repository,
+// on the 1st of June 2024
+func newUserService(t *testing.T, opts Options) *UserService {
+	t.Helper()
+	repo, err := repository.Open(repository.Config{Driver: "memory"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := func() time.Time { return time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC) }
+	return NewUserService(repo, log.New(io.Discard, "", 0), clock, opts)
+}
+
+func TestUserService(t *testing.T) {
+	ann := model.UserInput{Name: " Ann ", Email: "Ann@Example.com", Role: "user", Birth: "1990-07-01"}
+	tests := []struct {
+		name string
+		opts Options
+		run  func(t *testing.T, s *UserService)
+	}{
+		{"create", Options{}, func(t *testing.T, s *UserService) {
+			created, err := s.Create(context.Background(), ann)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Get(context.Background(), created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a month before the birthday
+			if got.Name != "Ann" || got.Email != "ann@example.com" || got.Age != 33 {
+				t.Errorf("got %+v, want Ann, ann@example.com, 33 years old", got)
+			}
+		}},
+		{"invalid", Options{}, func(t *testing.T, s *UserService) {
+			input := ann
+			input.Role = "owner"
+			_, err := s.Create(context.Background(), input)
+			var invalid *ValidationError
+			if !errors.As(err, &invalid) || invalid.Fields["role"] == "" {
+				t.Fatalf("got %v, want the role rejected", err)
+			}
+		}},
+		{"duplicate email", Options{}, func(t *testing.T, s *UserService) {
+			if _, err := s.Create(context.Background(), ann); err != nil {
+				t.Fatal(err)
+			}
+			other := ann
+			other.Email = " ann@example.COM"
+			if _, err := s.Create(context.Background(), other); !errors.Is(err, model.ErrConflict) {
+				t.Fatalf("got %v, want a conflict", err)
+			}
+		}},
+		{"email aliases", Options{RejectEmailAliases: true}, func(t *testing.T, s *UserService) {
+			if _, err := s.Create(context.Background(), ann); err != nil {
+				t.Fatal(err)
+			}
+			alias := ann
+			alias.Email = "ann+news@example.com"
+			if _, err := s.Create(context.Background(), alias); !errors.Is(err, model.ErrDuplicateEmail) {
+				t.Fatalf("got %v, want a duplicate email", err)
+			}
+		}},
+		{"update", Options{}, func(t *testing.T, s *UserService) {
+			ctx := context.Background()
+			created, err := s.Create(ctx, ann)
+			if err != nil {
+				t.Fatal(err)
+			}
+			input := ann
+			input.Name, input.Version = "Ann Lee", created.Version
+			updated, err := s.Update(ctx, created.ID, input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if updated.Name != "Ann Lee" || updated.Version != created.Version+1 {
+				t.Errorf("got %+v, want Ann Lee at version %d", updated, created.Version+1)
+			}
+			revisions, err := s.repo.ListRevisions(ctx, created.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(revisions) != 1 || len(revisions[0].Changes) != 1 || revisions[0].Changes[0].Field != "name" {
+				t.Errorf("got revisions %+v, want the name changed", revisions)
+			}
+			// input still has the version before the update
+			if _, err := s.Update(ctx, created.ID, input); !errors.Is(err, model.ErrVersionConflict) {
+				t.Fatalf("got %v, want a version conflict", err)
+			}
+		}},
+		{"patch", Options{}, func(t *testing.T, s *UserService) {
+			ctx := context.Background()
+			created, err := s.Create(ctx, ann)
+			if err != nil {
+				t.Fatal(err)
+			}
+			role := "admin"
+			if _, err := s.Patch(ctx, created.ID, model.UserPatch{Role: &role}); err == nil {
+				t.Fatal("patched without a version")
+			}
+			patched, err := s.Patch(ctx, created.ID, model.UserPatch{Role: &role, Version: &created.Version})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if patched.Role != "admin" || patched.Name != "Ann" || patched.Email != "ann@example.com" {
+				t.Errorf("got %+v, want only the role changed", patched)
+			}
+		}},
+		{"delete", Options{}, func(t *testing.T, s *UserService) {
+			ctx := context.Background()
+			created, err := s.Create(ctx, ann)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(ctx, created.ID); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := s.Get(ctx, created.ID); !errors.Is(err, model.ErrNotFound) {
+				t.Fatalf("got %v after deleting, want not found", err)
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newUserService(t, tt.opts))
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"api/internal/auth"
+	"api/internal/model"
+)
+
+// ValidationError lists the invalid fields of a request with a message for each
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	names := make([]string, 0, len(e.Fields))
+	for name := range e.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+": "+e.Fields[name])
+	}
+	return "validation failed: " + strings.Join(parts, ", ")
+}
+
+// Unwrap lets callers match any ValidationError with errors.Is(err, model.ErrValidation)
+func (e *ValidationError) Unwrap() error {
+	return model.ErrValidation
+}
+
+// validator collects field errors, keeping the first message per field
+type validator struct {
+	fields map[string]string
+}
+
+func (v *validator) add(field, message string) {
+	if v.fields == nil {
+		v.fields = map[string]string{}
+	}
+	if _, exists := v.fields[field]; !exists {
+		v.fields[field] = message
+	}
+}
+
+// err returns the collected errors as a ValidationError, or nil when there are none
+func (v *validator) err() error {
+	if len(v.fields) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: v.fields}
+}
+
+const (
+	maxNameLength  = 100
+	maxEmailLength = 255
+	maxAgeYears    = 150
+	maxMetadata    = 50
+)
+
+// validateUserInput checks the input of a create or update and parses the birth date.
+// The role must be one of roles, and updates must also name the version they are based on.
+func validateUserInput(input model.UserInput, now time.Time, update bool, roles []model.Role) (model.Date, error) {
+	var v validator
+
+	name := strings.TrimSpace(input.Name)
+	switch {
+	case name == "":
+		v.add("name", "is required")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		v.add("name", "must be at most 100 characters")
+	}
+
+	validateEmail(&v, normalizeEmail(input.Email))
+	validateRole(&v, input.Role, roles)
+
+	var birth model.Date
+	if input.Birth == "" {
+		v.add("birth", "is required")
+	} else if parsed, err := model.ParseDate(input.Birth); err != nil {
+		v.add("birth", "must be a date in YYYY-MM-DD format")
+	} else if parsed.After(now) {
+		v.add("birth", "must not be in the future")
+	} else if parsed.Before(now.AddDate(-maxAgeYears, 0, 0)) {
+		v.add("birth", "must be within the last 150 years")
+	} else {
+		birth = parsed
+	}
+
+	if len(input.Metadata) > maxMetadata {
+		v.add("metadata", "must have at most 50 keys")
+	}
+	for key := range input.Metadata {
+		if !model.MetadataKeyPattern.MatchString(key) {
+			v.add("metadata", "keys must be 1 to 64 letters, digits, '_' or '-'")
+		}
+	}
+
+	if update && input.Version < 1 {
+		v.add("version", "is required")
+	}
+
+	return birth, v.err()
+}
+
+// validatePatch checks that a merge patch names the version it is based on,
+// as updates must
+func validatePatch(v *validator, patch model.UserPatch) {
+	if patch.Version == nil || *patch.Version < 1 {
+		v.add("version", "is required")
+	}
+}
+
+// validateEmail checks a normalized email address
+func validateEmail(v *validator, email string) {
+	switch {
+	case email == "":
+		v.add("email", "is required")
+	case len(email) > maxEmailLength:
+		v.add("email", "must be at most 255 characters")
+	case !validEmail(email):
+		v.add("email", "must be a valid email address")
+	}
+}
+
+// validatePassword checks the length of a new password
+func validatePassword(v *validator, password string) {
+	switch {
+	case password == "":
+		v.add("password", "is required")
+	case utf8.RuneCountInString(password) < auth.MinPasswordLength:
+		v.add("password", "must be at least 8 characters")
+	case len(password) > auth.MaxPasswordLength:
+		v.add("password", "must be at most 72 bytes")
+	}
+}
+
+// validateRole checks that role is one of roles
+func validateRole(v *validator, role string, roles []model.Role) {
+	names := make([]string, len(roles))
+	valid := false
+	for i, r := range roles {
+		names[i] = r.Name
+		valid = valid || r.Name == role
+	}
+	switch {
+	case role == "":
+		v.add("role", "is required")
+	case !valid:
+		v.add("role", "must be one of "+strings.Join(names, ", "))
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"api/internal/model"
+)
+
+func TestValidateUserInput(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	roles := []model.Role{{Name: "admin"}, {Name: "user"}}
+	valid := model.UserInput{Name: "Ann", Email: "ann@example.com", Role: "user", Birth: "1990-01-01", Version: 1}
+	tests := []struct {
+		name   string
+		edit   func(input *model.UserInput)
+		update bool
+		fields map[string]string
+	}{
+		{"valid", func(input *model.UserInput) {}, true, nil},
+		{"missing fields", func(input *model.UserInput) { *input = model.UserInput{} }, false, map[string]string{
+			"name":  "is required",
+			"email": "is required",
+			"role":  "is required",
+			"birth": "is required",
+		}},
+		{"blank name", func(input *model.UserInput) { input.Name = "   " }, false, map[string]string{"name": "is required"}},
+		{"long name", func(input *model.UserInput) { input.Name = strings.Repeat("a", 101) }, false, map[string]string{"name": "must be at most 100 characters"}},
+		{"invalid email", func(input *model.UserInput) { input.Email = "ann" }, false, map[string]string{"email": "must be a valid email address"}},
+		{"unknown role", func(input *model.UserInput) { input.Role = "owner" }, false, map[string]string{"role": "must be one of admin, user"}},
+		{"malformed birth", func(input *model.UserInput) { input.Birth = "01/01/1990" }, false, map[string]string{"birth": "must be a date in YYYY-MM-DD format"}},
+		{"future birth", func(input *model.UserInput) { input.Birth = "2024-06-02" }, false, map[string]string{"birth": "must not be in the future"}},
+		{"ancient birth", func(input *model.UserInput) { input.Birth = "1800-01-01" }, false, map[string]string{"birth": "must be within the last 150 years"}},
+		{"metadata key", func(input *model.UserInput) { input.Metadata = model.Metadata{"a b": "c"} }, false, map[string]string{"metadata": "keys must be 1 to 64 letters, digits, '_' or '-'"}},
+		{"update without version", func(input *model.UserInput) { input.Version = 0 }, true, map[string]string{"version": "is required"}},
+		{"create without version", func(input *model.UserInput) { input.Version = 0 }, false, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := valid
+			tt.edit(&input)
+			birth, err := validateUserInput(input, now, tt.update, roles)
+			if tt.fields == nil {
+				if err != nil {
+					t.Fatalf("got %v, want no error", err)
+				}
+				if birth.IsZero() {
+					t.Error("birth not parsed")
+				}
+				return
+			}
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) || !errors.Is(err, model.ErrValidation) {
+				t.Fatalf("got %v, want a ValidationError", err)
+			}
+			if !reflect.DeepEqual(validationErr.Fields, tt.fields) {
+				t.Errorf("got %v, want %v", validationErr.Fields, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,16 @@
+package sms
+
+import (
+	"context"
+	"log"
+)
+
+// Log writes text messages to a logger instead of sending them, for development
+type Log struct {
+	Logger *log.Logger
+}
+
+func (l Log) Send(ctx context.Context, msg Message) error {
+	l.Logger.Printf("[sms] To: %s\n%s", msg.To, msg.Body)
+	return nil
+}
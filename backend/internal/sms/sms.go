@@ -0,0 +1,113 @@
+// Package sms delivers the text messages the API sends, such as critical
+// account alerts, through the HTTP API of an SMS provider, limiting how
+// many go to each country.
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nyaruka/phonenumbers"
+
+	"api/internal/ratelimit"
+)
+
+// Message is a text message to a phone number in E.164 form
+type Message struct {
+	To   string
+	Body string
+}
+
+// Sender delivers a text message
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrRateLimited is returned for the messages to a country over its limit,
+// or to a country messages are blocked to
+var ErrRateLimited = errors.New("sms: too many messages to the country")
+
+// client sends the requests of the HTTP API providers
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// checkResponse closes resp, returning an error with the start of its body
+// unless it succeeded
+func checkResponse(provider string, resp *http.Response) error {
+	defer resp.Body.Close()
+	if resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("sms: %s answered %s: %s", provider, resp.Status, strings.TrimSpace(string(body)))
+}
+
+// Limits caps the messages sent to each country within Window, countries
+// being ISO 3166-1 alpha-2 codes such as "ID". Countries gives the limits
+// of some of them, zero blocking them, and Default those of the others,
+// zero allowing everything. They guard against a flood of messages to
+// expensive destinations, as in SMS pumping fraud.
+type Limits struct {
+	Default   int
+	Countries map[string]int
+	Window    time.Duration
+}
+
+// Limited sends messages through another Sender within Limits. It counts in
+// memory, so each server instance has its own allowance.
+type Limited struct {
+	sender    Sender
+	limits    Limits
+	fallback  *ratelimit.Limiter
+	countries map[string]*ratelimit.Limiter
+}
+
+// NewLimited returns a Sender sending through sender within limits, using
+// now as the current time
+func NewLimited(sender Sender, limits Limits, now func() time.Time) *Limited {
+	l := &Limited{
+		sender:    sender,
+		limits:    limits,
+		fallback:  ratelimit.New(limits.Default, limits.Window, now),
+		countries: map[string]*ratelimit.Limiter{},
+	}
+	for country, limit := range limits.Countries {
+		if limit > 0 {
+			l.countries[country] = ratelimit.New(limit, limits.Window, now)
+		}
+	}
+	return l
+}
+
+func (l *Limited) Send(ctx context.Context, msg Message) error {
+	country := Country(msg.To)
+	limiter := l.fallback
+	if limit, ok := l.limits.Countries[country]; ok {
+		if limit == 0 {
+			return fmt.Errorf("%w: messages to %s are blocked", ErrRateLimited, country)
+		}
+		limiter = l.countries[country]
+	}
+	if ok, retryAfter := limiter.Allow(country); !ok {
+		return fmt.Errorf("%w: %s is over its limit for another %s", ErrRateLimited, country, retryAfter.Round(time.Second))
+	}
+	return l.sender.Send(ctx, msg)
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of the country of the E.164
+// number, or "ZZ" when it can't tell
+func Country(number string) string {
+	parsed, err := phonenumbers.Parse(number, "")
+	if err != nil {
+		return phonenumbers.UNKNOWN_REGION
+	}
+	if region := phonenumbers.GetRegionCodeForNumber(parsed); region != "" {
+		return region
+	}
+	return phonenumbers.UNKNOWN_REGION
+}
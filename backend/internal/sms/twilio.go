@@ -0,0 +1,42 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// twilioURL is the endpoint of the Twilio Messages API, for an account SID
+const twilioURL = "https://api.twilio.com/2010-04-01/Accounts/%s/Messages.json"
+
+// Twilio sends text messages through the Twilio API
+type Twilio struct {
+	AccountSID string
+	AuthToken  string
+	// From is a Twilio phone number in E.164 form, or the SID of a messaging
+	// service, starting with MG
+	From string
+}
+
+func (t Twilio) Send(ctx context.Context, msg Message) error {
+	form := url.Values{"To": {msg.To}, "Body": {msg.Body}}
+	if strings.HasPrefix(t.From, "MG") {
+		form.Set("MessagingServiceSid", t.From)
+	} else {
+		form.Set("From", t.From)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf(twilioURL, url.PathEscape(t.AccountSID)), strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(t.AccountSID, t.AuthToken)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return checkResponse("Twilio", resp)
+}
@@ -0,0 +1,66 @@
+package sms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// vonageURL is the endpoint of the Vonage SMS API
+const vonageURL = "https://rest.nexmo.com/sms/json"
+
+// Vonage sends text messages through the Vonage SMS API
+type Vonage struct {
+	APIKey    string
+	APISecret string
+	// From is a Vonage number, or an alphanumeric sender ID where allowed
+	From string
+}
+
+type vonageResponse struct {
+	Messages []struct {
+		Status    string `json:"status"`
+		ErrorText string `json:"error-text"`
+	} `json:"messages"`
+}
+
+func (v Vonage) Send(ctx context.Context, msg Message) error {
+	form := url.Values{
+		"api_key":    {v.APIKey},
+		"api_secret": {v.APISecret},
+		"from":       {v.From},
+		// Vonage takes the number without the leading +
+		"to":   {strings.TrimPrefix(msg.To, "+")},
+		"text": {msg.Body},
+		"type": {"unicode"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, vonageURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return checkResponse("Vonage", resp)
+	}
+	defer resp.Body.Close()
+
+	// failures are reported per message part, with HTTP 200
+	var result vonageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return err
+	}
+	for _, part := range result.Messages {
+		if part.Status != "0" {
+			return fmt.Errorf("sms: Vonage rejected the message (status %s): %s", part.Status, part.ErrorText)
+		}
+	}
+	return nil
+}
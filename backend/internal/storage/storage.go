@@ -0,0 +1,32 @@
+// Package storage keeps uploaded files, such as avatars, by key.
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when no file is stored under a key
+var ErrNotFound = errors.New("storage: file not found")
+
+// Store keeps files by slash-separated keys like "avatars/12"
+type Store interface {
+	// Put stores data under key, replacing any previous file
+	Put(ctx context.Context, key string, data io.Reader, contentType string) error
+	// Open returns the file stored under key; the caller closes its Body
+	Open(ctx context.Context, key string) (Object, error)
+	// Delete removes the file stored under key; a missing file is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// Object is a stored file being read
+type Object struct {
+	// Body is also an io.ReadSeeker when the store supports it, which lets
+	// handlers answer range requests
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+	ModTime     time.Time
+}
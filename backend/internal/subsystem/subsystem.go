@@ -0,0 +1,76 @@
+// Package subsystem keeps track of which optional subsystems are active.
+//
+// Optional subsystems must never prevent the API from booting because their
+// configuration is missing: they record themselves as disabled instead, so
+// one binary serves both minimal and full-featured deployments.
+package subsystem
+
+import (
+	"log"
+	"sync"
+)
+
+// Status describes whether a subsystem is running and why
+type Status struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Note    string `json:"note,omitempty"`
+}
+
+// Registry collects the status of every optional subsystem
+type Registry struct {
+	mu       sync.RWMutex
+	statuses []Status
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Enable records a subsystem as active
+func (r *Registry) Enable(name, note string) {
+	r.set(Status{Name: name, Enabled: true, Note: note})
+	log.Printf("[startup] %s: enabled (%s)", name, note)
+}
+
+// Disable records a subsystem as inactive, with the reason it was skipped
+func (r *Registry) Disable(name, reason string) {
+	r.set(Status{Name: name, Enabled: false, Note: reason})
+	log.Printf("[startup] %s: disabled (%s)", name, reason)
+}
+
+// Enabled reports whether the named subsystem is active
+func (r *Registry) Enabled(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, s := range r.statuses {
+		if s.Name == name {
+			return s.Enabled
+		}
+	}
+	return false
+}
+
+// Statuses returns a snapshot of all recorded subsystems in registration order
+func (r *Registry) Statuses() []Status {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]Status(nil), r.statuses...)
+}
+
+// set adds or replaces the status of a subsystem
+func (r *Registry) set(status Status) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, s := range r.statuses {
+		if s.Name == status.Name {
+			r.statuses[i] = status
+			return
+		}
+	}
+	r.statuses = append(r.statuses, status)
+}
@@ -0,0 +1,69 @@
+// Package thumbnail scales images down to small variants.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif" // registers the GIF decoder with image.Decode
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // registers the WebP decoder with image.Decode
+)
+
+// ErrTooLarge is returned by Decode for images of more pixels than allowed
+var ErrTooLarge = errors.New("image has too many pixels")
+
+// Image is a decoded image to generate thumbnails of
+type Image struct {
+	img    image.Image
+	format string
+}
+
+// Decode decodes src, unless its header declares more than maxPixels
+// pixels, as the small files of decompression bombs do to exhaust memory;
+// zero allows any number
+func Decode(src []byte, maxPixels int) (Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(src))
+	if err != nil {
+		return Image{}, err
+	}
+	if maxPixels > 0 && (config.Width > maxPixels || config.Height > maxPixels/max(config.Width, 1)) {
+		return Image{}, ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(src))
+	if err != nil {
+		return Image{}, err
+	}
+	return Image{img: img, format: format}, nil
+}
+
+// Thumbnail scales the image down so that its longest side is size pixels,
+// keeping its aspect ratio; smaller images are only re-encoded. JPEGs stay
+// JPEGs, other formats become PNGs to keep their transparency.
+func (i Image) Thumbnail(size int) ([]byte, string, error) {
+	img := i.img
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/width)
+		} else {
+			width, height = max(1, width*size/height), size
+		}
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(scaled, scaled.Bounds(), img, bounds, draw.Over, nil)
+		img = scaled
+	}
+
+	var out bytes.Buffer
+	if i.format == "jpeg" {
+		err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 85})
+		return out.Bytes(), "image/jpeg", err
+	}
+	err := png.Encode(&out, img)
+	return out.Bytes(), "image/png", err
+}
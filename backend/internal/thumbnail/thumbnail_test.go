@@ -0,0 +1,80 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// pngOf encodes an image of width by height pixels as a PNG
+func pngOf(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	img.Set(0, 0, color.White)
+	var out bytes.Buffer
+	if err := png.Encode(&out, img); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// withDimensions rewrites the width and height the IHDR chunk of a PNG
+// declares, as decompression bombs do
+func withDimensions(src []byte, width, height uint32) []byte {
+	data := bytes.Clone(src)
+	// the 8 bytes of the signature, then the length and type of IHDR
+	ihdr := data[16:29]
+	binary.BigEndian.PutUint32(ihdr[0:4], width)
+	binary.BigEndian.PutUint32(ihdr[4:8], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	small := pngOf(t, 300, 200)
+	tests := []struct {
+		name      string
+		src       []byte
+		maxPixels int
+		err       error
+	}{
+		{"within the cap", small, 300 * 200, nil},
+		{"over the cap", small, 300*200 - 1, ErrTooLarge},
+		{"no cap", small, 0, nil},
+		{"declared huge", withDimensions(pngOf(t, 1, 1), 100000, 100000), 4096 * 4096, ErrTooLarge},
+		{"declared wide", withDimensions(pngOf(t, 1, 1), 1<<31-1, 1), 4096 * 4096, ErrTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.src, tt.maxPixels)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	img, err := Decode(pngOf(t, 300, 200), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for size, want := range map[int]image.Point{64: {64, 42}, 256: {256, 170}, 512: {300, 200}} {
+		data, contentType, err := img.Thumbnail(size)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := png.DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if contentType != "image/png" || config.Width != want.X || config.Height != want.Y {
+			t.Errorf("%dpx thumbnail is a %s of %dx%d, want a PNG of %dx%d", size, contentType, config.Width, config.Height, want.X, want.Y)
+		}
+	}
+}
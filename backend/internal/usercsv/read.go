@@ -0,0 +1,84 @@
+package usercsv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"api/internal/model"
+)
+
+// Columns are the columns a CSV must have for its users to be read; a
+// "metadata" column holding JSON objects is optional and any other column,
+// such as the id and age of an export, is ignored
+var Columns = []string{"name", "email", "role", "birth"}
+
+// Reader reads users from a CSV whose header row names its columns, in any order
+type Reader struct {
+	csv     *csv.Reader
+	columns map[string]int
+	width   int
+}
+
+// NewReader reads the header row of the CSV, failing when a column is missing
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := csv.NewReader(r)
+	// rows with too few or too many cells are reported by Read
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("the CSV is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			// spreadsheets often save CSVs with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range Columns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("the CSV has no %s column", name)
+		}
+	}
+	return &Reader{csv: reader, columns: columns, width: len(header)}, nil
+}
+
+// Read returns the user of the next row along with the line it starts on,
+// or io.EOF after the last row. A row that can't be read is an error, but
+// the next call reads the row after it.
+func (r *Reader) Read() (model.UserInput, int, error) {
+	record, err := r.csv.Read()
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return model.UserInput{}, parseErr.StartLine, parseErr.Err
+	}
+	if err != nil {
+		return model.UserInput{}, 0, err
+	}
+	line, _ := r.csv.FieldPos(0)
+	if len(record) != r.width {
+		return model.UserInput{}, line, fmt.Errorf("the row has %d cells instead of %d", len(record), r.width)
+	}
+
+	input := model.UserInput{
+		Name:  record[r.columns["name"]],
+		Email: record[r.columns["email"]],
+		Role:  record[r.columns["role"]],
+		Birth: record[r.columns["birth"]],
+	}
+	if i, ok := r.columns["metadata"]; ok && record[i] != "" {
+		if err := json.Unmarshal([]byte(record[i]), &input.Metadata); err != nil {
+			return input, line, errors.New("metadata must be a JSON object")
+		}
+	}
+	return input, line, nil
+}
@@ -0,0 +1,65 @@
+// Package usercsv converts users to CSV, for the export command and for
+// API clients asking for text/csv, and reads the users of CSV imports.
+package usercsv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+
+	"api/internal/model"
+)
+
+// Header is the first row of every users CSV
+var Header = []string{"id", "name", "email", "role", "birth", "age", "timestamp"}
+
+// Write writes users as CSV with a header row
+func Write(w io.Writer, users []model.User) error {
+	return WriteFields(w, users, Header)
+}
+
+// WriteFields writes the given fields of users as CSV, with the field names as header row
+func WriteFields(w io.Writer, users []model.User, fields []string) error {
+	return WriteFieldsHiding(w, users, fields, nil)
+}
+
+// WriteFieldsHiding writes like WriteFields, leaving empty the cells of the
+// fields hidden reports as hidden from the user at that index; nil hides none
+func WriteFieldsHiding(w io.Writer, users []model.User, fields []string, hidden func(i int, field string) bool) error {
+	writer := csv.NewWriter(w)
+	writer.Write(fields)
+
+	row := make([]string, len(fields))
+	for n, user := range users {
+		for i, field := range fields {
+			row[i] = ""
+			if hidden == nil || !hidden(n, field) {
+				row[i] = format(user.Field(field))
+			}
+		}
+		writer.Write(row)
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// format renders a field value as a CSV cell
+func format(value interface{}) string {
+	switch v := value.(type) {
+	case int:
+		return strconv.Itoa(v)
+	case string:
+		return v
+	case model.Date:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case model.Metadata:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return ""
+}
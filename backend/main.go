@@ -1,378 +1,574 @@
 package main
 
 import (
-	"database/sql"
-	"encoding/json"
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
+	"api/internal/auth"
+	"api/internal/events"
+	featureflags "api/internal/flags"
+	"api/internal/frontend"
+	"api/internal/handler"
+	"api/internal/health"
+	"api/internal/jobs"
+	"api/internal/logmask"
+	"api/internal/mailer"
+	"api/internal/metrics"
+	"api/internal/policy"
+	"api/internal/report"
+	"api/internal/repository"
+	"api/internal/scheduler"
+	"api/internal/search"
+	"api/internal/service"
+	"api/internal/subsystem"
 )
 
-type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	Role      string    `json:"role"`
-	Birth     time.Time `json:"birth"`
-	Age       int       `json:"age"`
-	Timestamp time.Time `json:"timestamp"`
-}
+// main function dispatching to the CLI subcommands, serving the API by default
+func main() {
+	cfg, err := readConfig()
+	if err != nil {
+		log.Fatalf("failed to read the configuration: %v", err)
+	}
+	setLogOutput(cfg.LogPII)
 
-type APIResponse struct {
-	Success bool        `json:"success"`
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data"`
+	if err := runCLI(cfg, os.Args[1:]); err != nil {
+		log.Fatal(err)
+	}
 }
 
-// sendJSONResponse is a helper function to send structured API responses
-func sendJSONResponse(w http.ResponseWriter, success bool, code int, message string, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-
-	response := APIResponse{
-		Success: success,
-		Code:    code,
-		Message: message,
-		Data:    data,
-	}
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		// Fallback error response
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(APIResponse{
-			Success: false,
-			Code:    http.StatusInternalServerError,
-			Message: "Failed to encode response",
-			Data:    nil,
-		})
+// setLogOutput masks the personal data in log output, and leaves the
+// arguments of queries out of it, unless debugging
+func setLogOutput(logPII bool) {
+	repository.SetLogQueryArgs(logPII)
+	if logPII {
+		log.SetOutput(os.Stderr)
+	} else {
+		log.SetOutput(logmask.NewWriter(os.Stderr))
 	}
 }
 
-// main function to set up the server and routes
-func main() {
-	// Database connection with postgres as the driver and connection string from environment variable
+// runServe sets up the server and routes
+func runServe(cfg Config, args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	flags.Parse(args)
 
-	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+	// optional subsystems report here whether they are active, instead of failing the boot
+	subsystems := subsystem.NewRegistry()
+
+	repo, err := connectRepository(cfg)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	defer db.Close()
+	defer repo.Close()
 
-	// Check DB connection
-	if err := db.Ping(); err != nil {
-		log.Fatalf("Failed to connect to DB: %v", err)
-	} else {
-		log.Println("Successfully connected to the database!")
+	if err := migrateOnStart(repo, cfg.MigrateOnStart); err != nil {
+		return fmt.Errorf("migration failed: %w", err)
 	}
 
-	// create table if not exists
-	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		name TEXT NOT NULL,
-		email TEXT NOT NULL UNIQUE,
-		role TEXT NOT NULL DEFAULT 'user',
-		birth DATE NOT NULL,
-		age INTEGER,
-		timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
-	)`)
+	// the dependencies of the subsystems are checked by /health; the API
+	// can't serve anything without the database and its migrations, which
+	// /readyz checks alone
+	checks := health.NewRegistry(cfg.HealthCheckTimeout)
+	database := health.Checker(health.CheckFunc(repo.Ping))
+	if reporter, ok := repo.(repository.PoolStatsReporter); ok {
+		database = health.WithDetails(database, reporter.PoolStats)
+	}
+	checks.Register("database", database, true)
+	// reads fall back to the primary while the replica is failing, so the
+	// API stays ready without it
+	if pinger, ok := repo.(repository.ReplicaPinger); ok && cfg.DatabaseReadURL != "" {
+		checks.Register("database_replica", health.CheckFunc(pinger.PingReplica), false)
+	}
+	if migrations, err := migrationsCheck(repo); err != nil {
+		return err
+	} else if migrations != nil {
+		checks.Register("migrations", migrations, true)
+	}
 
-	if err != nil {
-		log.Fatal(err)
+	// expose the usage of the connection pool and the count of slow queries
+	// to Prometheus, to tell an exhausted pool from a slow database
+	var gauges *metrics.Registry
+	if !cfg.Metrics {
+		subsystems.Disable("metrics", "METRICS is false")
+	} else {
+		gauges = metrics.NewRegistry()
+		if reporter, ok := repo.(repository.PoolStatsReporter); ok {
+			gauges.Register(reporter.PoolMetrics)
+		}
+		if reporter, ok := repo.(repository.QueryMetricsReporter); ok {
+			gauges.Register(reporter.QueryMetrics)
+		}
+		subsystems.Enable("metrics", "served at /metrics")
 	}
 
-	// create a new router
-	router := mux.NewRouter()
+	// GET requests and exports read from the replica, see handler.ReplicaReads
+	switch {
+	case cfg.DatabaseReadURL == "":
+		subsystems.Disable("replica", "DATABASE_READ_URL not set")
+	case cfg.Store == "memory":
+		subsystems.Disable("replica", "the memory store has no replica")
+	default:
+		subsystems.Enable("replica", "GET requests and exports read from the replica")
+	}
 
-	router.HandleFunc("/api/go/users", getUsers(db)).Methods("GET")
-	router.HandleFunc("/api/go/users", createUser(db)).Methods("POST")
-	router.HandleFunc("/api/go/users/{id}", getUser(db)).Methods("GET")
-	router.HandleFunc("/api/go/users/{id}", updateUser(db)).Methods("PUT")
-	router.HandleFunc("/api/go/users/{id}", deleteUser(db)).Methods("DELETE")
-	router.HandleFunc("/api/go/healthdb", healthDB(db)).Methods("GET")
+	// emails are encrypted by the repository, see connectRepository
+	switch {
+	case len(cfg.PIIDataKeys) == 0:
+		subsystems.Disable("pii", "PII_DATA_KEYS not set")
+	case cfg.Store == "memory":
+		subsystems.Disable("pii", "the memory store keeps nothing at rest")
+	default:
+		id, _, _ := strings.Cut(cfg.PIIDataKeys[0], ":")
+		subsystems.Enable("pii", "emails encrypted under data key "+id)
+	}
 
-	// wrap router with CORS and JSON content type middleware
-	enhancedRouter := enableCORS(jsonContentTypeMiddleware(router))
+	// strip or escape the HTML of the text users store
+	users := service.Options{RejectEmailAliases: cfg.RejectEmailAliases}
+	if users.Sanitize, err = cfg.sanitizePolicy(); err != nil {
+		return err
+	}
 
-	// start the server
-	log.Fatal(http.ListenAndServe(":8000", enhancedRouter))
+	// turn experimental behaviors on and off at runtime, per organization
+	flagDefaults, err := cfg.featureFlags()
+	if err != nil {
+		return err
+	}
+	users.Flags = featureflags.New(flagDefaults)
+
+	// mirror users into the search index when one is configured
+	var searchClient *search.Client
+	if cfg.SearchURL == "" {
+		subsystems.Disable("search", "SEARCH_URL not set")
+	} else if client := search.NewClient(cfg.searchConfig()); client.EnsureIndex(context.Background()) != nil {
+		subsystems.Disable("search", "index "+cfg.SearchIndex+" at "+cfg.SearchURL+" is unreachable")
+	} else {
+		searchClient = client
+		users.Indexer = client
+		checks.Register("search", client, false)
+		subsystems.Enable("search", "index "+cfg.SearchIndex+" at "+cfg.SearchURL)
+	}
 
-}
+	// keep uploaded avatars on disk or in a bucket
+	users.AvatarMaxBytes = cfg.AvatarMaxBytes
+	users.AvatarSizes = cfg.AvatarSizes
+	users.AvatarMaxPixels = cfg.AvatarMaxPixels
+	users.AvatarURLTTL = cfg.S3PresignTTL
+	if store, note, err := cfg.openStorage(); err != nil {
+		subsystems.Disable("storage", err.Error())
+	} else {
+		users.Storage = store
+		if checker, ok := store.(health.Checker); ok {
+			checks.Register("storage", checker, false)
+		}
+		subsystems.Enable("storage", note)
+	}
 
-// enableCORS middleware to handle CORS
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// email invitations, verification links and reports through the mail provider
+	if sender, note, err := cfg.openMailer(); err != nil {
+		subsystems.Disable("mail", err.Error())
+	} else if sender == nil {
+		subsystems.Disable("mail", "MAIL_PROVIDER and SMTP_ADDR not set")
+	} else if templates, err := mailer.NewTemplates(cfg.MailTemplatesDir, cfg.MailLocale); err != nil {
+		subsystems.Disable("mail", err.Error())
+	} else {
+		users.Mailer = sender
+		users.Templates = templates
+		if checker, ok := sender.(health.Checker); ok {
+			checks.Register("mail", checker, false)
+		}
+		subsystems.Enable("mail", note)
+	}
 
-		// set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+	// text critical notifications through the SMS provider
+	if sender, note, err := cfg.openSMS(); err != nil {
+		subsystems.Disable("sms", err.Error())
+	} else if sender == nil {
+		subsystems.Disable("sms", "SMS_PROVIDER, TWILIO_ACCOUNT_SID and VONAGE_API_KEY not set")
+	} else {
+		users.SMS = sender
+		subsystems.Enable("sms", note)
+	}
 
-		// handle preflight requests
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+	// run slow work, such as sending emails and imports, in the background;
+	// the workers start once the server exists, as imports run through it
+	var queue *jobs.Queue
+	if !cfg.JobQueue {
+		subsystems.Disable("jobs", "JOB_QUEUE is false")
+		subsystems.Disable("imports", "JOB_QUEUE is false")
+	} else {
+		queue = jobs.New(repo, log.Default(), time.Now, jobs.Options{
+			Workers:           cfg.JobWorkers,
+			PollInterval:      cfg.JobPollInterval,
+			VisibilityTimeout: cfg.JobVisibilityTimeout,
+			MaxAttempts:       cfg.JobMaxAttempts,
+			Backoff:           cfg.JobBackoff,
+			MaxBackoff:        cfg.JobMaxBackoff,
+		})
+		if users.Mailer != nil {
+			queue.Handle(service.JobSendEmail, service.DeliverEmails(users.Mailer))
 		}
+		if users.SMS != nil {
+			queue.Handle(service.JobSendSMS, service.DeliverSMS(users.SMS))
+		}
+		users.Jobs = queue
+		checks.Register("jobs", queue, false)
+		users.ImportMaxBytes = cfg.ImportMaxBytes
+		subsystems.Enable("jobs", fmt.Sprintf("%d workers", cfg.JobWorkers))
+		subsystems.Enable("imports", fmt.Sprintf("CSVs of at most %d bytes", cfg.ImportMaxBytes))
+	}
 
-		// pass to the next handler
-		next.ServeHTTP(w, r)
-	})
-}
-
-// jsonContentTypeMiddleware to set Content-Type as application/json
-func jsonContentTypeMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-	})
-}
+	if cfg.InviteSecret == "" {
+		subsystems.Disable("invitations", "INVITE_SECRET not set")
+	} else if users.Mailer == nil {
+		subsystems.Disable("invitations", "no mail provider")
+	} else {
+		users.InviteSecret = []byte(cfg.InviteSecret)
+		users.InviteTTL = cfg.InviteTTL
+		users.InviteURL = cfg.InviteURL
+		subsystems.Enable("invitations", "links valid for "+cfg.InviteTTL.String())
+	}
 
-// getUsers handler to fetch all users with search and sorting
-func getUsers(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get query parameters
-		search := r.URL.Query().Get("search")
-		sortBy := r.URL.Query().Get("sort")
-		order := r.URL.Query().Get("order")
-
-		// Build query
-		query := "SELECT id, name, email, role, birth, age, timestamp FROM users"
-		var args []interface{}
-		var conditions []string
-
-		// Add search conditions
-		if search != "" {
-			conditions = append(conditions, "(name ILIKE $1 OR email ILIKE $1 OR role ILIKE $1)")
-			args = append(args, "%"+search+"%")
+	// publish the events recorded in the outbox with the changes of users
+	if publisher, note, err := cfg.openPublisher(); err != nil {
+		subsystems.Disable("events", err.Error())
+	} else if publisher == nil {
+		subsystems.Disable("events", "EVENT_PUBLISHER, KAFKA_BROKERS, NATS_URL and RABBITMQ_URL not set")
+	} else {
+		if closer, ok := publisher.(io.Closer); ok {
+			defer closer.Close()
 		}
-
-		if len(conditions) > 0 {
-			query += " WHERE " + strings.Join(conditions, " AND ")
+		if checker, ok := publisher.(health.Checker); ok {
+			checks.Register("events", checker, false)
 		}
+		relay := events.NewRelay(repo, publisher, log.Default(), time.Now, events.Options{
+			PollInterval: cfg.EventPollInterval,
+			BatchSize:    cfg.EventBatchSize,
+			LockTimeout:  cfg.EventLockTimeout,
+			Backoff:      cfg.EventBackoff,
+			MaxBackoff:   cfg.EventMaxBackoff,
+		})
+		relay.Start()
+		defer relay.Stop()
+		subsystems.Enable("events", note)
+	}
 
-		// Add sorting
-		validSorts := map[string]string{
-			"name":      "name",
-			"email":     "email",
-			"role":      "role",
-			"age":       "age",
-			"timestamp": "timestamp",
+	// authenticate requests with the access tokens users log in for
+	if cfg.AuthSecret == "" {
+		subsystems.Disable("auth", "AUTH_SECRET not set")
+	} else {
+		users.Tokens = auth.NewSigner([]byte(cfg.AuthSecret), time.Now)
+		users.AccessTokenTTL = cfg.AccessTokenTTL
+		users.VerifyTTL = cfg.VerifyTTL
+		users.VerifyURL = cfg.VerifyURL
+		users.SignupRole = cfg.SignupRole
+		users.ResetTTL = cfg.PasswordResetTTL
+		users.ResetURL = cfg.ResetURL
+		users.SessionTTL = cfg.SessionTTL
+		users.ImpersonationTTL = cfg.ImpersonationTTL
+		users.AdminRoles = cfg.AdminRoles
+		note := "access tokens valid for " + cfg.AccessTokenTTL.String() + ", sessions for " + cfg.SessionTTL.String()
+		if users.Mailer == nil {
+			note += ", registration and password reset disabled without a mail provider"
 		}
+		subsystems.Enable("auth", note)
+	}
 
-		if sortField, exists := validSorts[sortBy]; exists {
-			orderDir := "ASC"
-			if order == "desc" {
-				orderDir = "DESC"
-			}
-			query += " ORDER BY " + sortField + " " + orderDir
-		} else {
-			query += " ORDER BY timestamp DESC" // default sort
-		}
+	// authorize requests against the policy engine when policies are configured
+	var engine *policy.Engine
+	if cfg.PolicyEnabled() {
+		engine = policy.NewEngine(policy.Mode(cfg.PolicyMode), cfg.PolicyDecisionLog)
 
-		log.Printf("Query: %s, Args: %v", query, args)
-		rows, err := db.Query(query, args...)
+		policies, err := policy.LoadFiles(cfg.PolicyFiles)
 		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
+			return fmt.Errorf("failed to load policies: %w", err)
 		}
-		defer rows.Close()
-
-		var users []User
-		for rows.Next() {
-			var user User
-			if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Birth, &user.Age, &user.Timestamp); err != nil {
-				sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-				return
+		engine.Load("files", policies)
+
+		if cfg.PolicyBundleURL != "" {
+			if err := policy.WatchBundle(context.Background(), engine, cfg.PolicyBundleURL, cfg.PolicyBundleInterval); err != nil {
+				return fmt.Errorf("failed to load policy bundle: %w", err)
 			}
-			users = append(users, user)
 		}
-
-		sendJSONResponse(w, true, http.StatusOK, "Users fetched successfully", users)
 	}
-}
 
-// get user by id
-func getUser(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		id := params["id"]
+	// restrict route groups to the networks allowed, behind trusted proxies
+	ipRules, err := cfg.ipRules()
+	if err != nil {
+		return err
+	}
+	trustedProxies, err := cfg.trustedProxies()
+	if err != nil {
+		return err
+	}
 
-		var user User
-		log.Printf("Query: SELECT id, name, email, role, birth, age, timestamp FROM users WHERE id = %s", id)
-		err := db.QueryRow("SELECT id, name, email, role, birth, age, timestamp FROM users WHERE id = $1", id).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Birth, &user.Age, &user.Timestamp)
-		if err != nil {
-			if err == sql.ErrNoRows {
-				sendJSONResponse(w, false, http.StatusNotFound, "User not found", nil)
-			} else {
-				sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			}
-			return
-		}
+	// shed the requests past the caps of route groups
+	maxInFlight, err := cfg.maxInFlight()
+	if err != nil {
+		return err
+	}
 
-		sendJSONResponse(w, true, http.StatusOK, "User fetched successfully", user)
+	// hide the fields of other users callers mustn't see
+	fieldRules, err := cfg.fieldRules()
+	if err != nil {
+		return err
 	}
-}
 
-// createUser handler to create a new user
-func createUser(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		var raw map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
-			sendJSONResponse(w, false, http.StatusBadRequest, err.Error(), nil)
-			return
-		}
+	// run recurring tasks on their schedules, each run once across instances
+	tasks := scheduler.New(repo, log.Default(), time.Now)
+
+	server := handler.NewServer(handler.Deps{
+		Repo:   repo,
+		Logger: log.Default(),
+		Clock:  time.Now,
+		Config: handler.Config{
+			APIPreview:        cfg.APIPreview,
+			ErrorFormat:       cfg.ErrorFormat,
+			Users:             users,
+			IdempotencyWindow: cfg.IdempotencyWindow,
+			PolicyDatabase:    cfg.PolicyDatabase,
+
+			PasswordResetEmailLimit: cfg.PasswordResetEmailLimit,
+			PasswordResetIPLimit:    cfg.PasswordResetIPLimit,
+			PasswordResetWindow:     cfg.PasswordResetWindow,
+			LoginAccountLimit:       cfg.LoginAccountLimit,
+			LoginIPLimit:            cfg.LoginIPLimit,
+			LoginWindow:             cfg.LoginWindow,
+			SessionCookie:           cfg.SessionCookie,
+			SessionCookieSecure:     cfg.SessionCookieSecure,
+			CSRFCookie:              cfg.CSRFCookie,
+			IPRules:                 ipRules,
+			TrustedProxies:          trustedProxies,
+			MaxInFlight:             maxInFlight,
+			LoadShedRetryAfter:      cfg.LoadShedRetryAfter,
+			TeamScope:               cfg.TeamScope,
+			TeamScopeExemptRoles:    cfg.TeamScopeExemptRoles,
+			FieldRules:              fieldRules,
+			Build:                   buildInfo(),
+		},
+		Subsystems: subsystems,
+		Search:     searchClient,
+		Health:     checks,
+		Metrics:    gauges,
+		Policy:     engine,
+		Scheduler:  tasks,
+	})
+	router := server.Routes()
+	if cfg.APIPreview {
+		subsystems.Enable("preview", "API versions still changing served")
+	} else {
+		subsystems.Disable("preview", "API_PREVIEW not set")
+	}
 
-		// Parse birth date from string
-		birthStr, ok := raw["birth"].(string)
-		if !ok {
-			sendJSONResponse(w, false, http.StatusBadRequest, "Invalid birth format", nil)
-			return
-		}
-		birth, err := time.Parse("2006-01-02", birthStr)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusBadRequest, "Invalid birth date: "+err.Error(), nil)
-			return
-		}
+	// serve the web app built into the binary on the paths of no route
+	switch files := frontend.Files(); {
+	case !cfg.ServeFrontend:
+		subsystems.Disable("frontend", "SERVE_FRONTEND is false")
+	case files == nil:
+		subsystems.Disable("frontend", "not built into the binary, see npm run build:embed")
+	default:
+		server.ServeFrontend(router, frontend.Handler(files))
+		subsystems.Enable("frontend", "web app served at /")
+	}
 
-		user := User{
-			Name:  raw["name"].(string),
-			Email: raw["email"].(string),
-			Role:  raw["role"].(string),
-			Birth: birth,
-		}
+	if queue != nil {
+		queue.Handle(service.JobImportUsers, server.Users().ImportUsers)
+		queue.Start()
+		defer queue.Stop()
+	}
 
-		log.Printf("[createUser] Received: %+v", user)
-		// Calculate age from birth
-		now := time.Now()
-		user.Age = now.Year() - user.Birth.Year()
-		if now.YearDay() < user.Birth.YearDay() {
-			user.Age--
-		}
+	// refuse the networks a route group isn't open to before anything else
+	if len(ipRules) > 0 {
+		router.Use(server.IPFilter())
+		subsystems.Enable("ipfilter", fmt.Sprintf("%d route groups filtered, %d trusted proxies", len(ipRules), len(trustedProxies)))
+	} else {
+		subsystems.Disable("ipfilter", "IP_ALLOW and IP_DENY not set")
+	}
 
-		log.Printf("Query: INSERT INTO users (name, email, role, birth, age) VALUES (%s, %s, %s, %s, %d) RETURNING id, age, timestamp", user.Name, user.Email, user.Role, user.Birth.Format("2006-01-02"), user.Age)
-		err = db.QueryRow("INSERT INTO users (name, email, role, birth, age) VALUES ($1, $2, $3, $4, $5) RETURNING id, age, timestamp", user.Name, user.Email, user.Role, user.Birth, user.Age).Scan(&user.ID, &user.Age, &user.Timestamp)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
-		}
+	// turn away what the API can't serve now before looking up the caller,
+	// which takes a database connection
+	if len(maxInFlight) > 0 {
+		router.Use(server.LoadShed())
+		subsystems.Enable("loadshed", fmt.Sprintf("%d route groups capped", len(maxInFlight)))
+	} else {
+		subsystems.Disable("loadshed", "MAX_IN_FLIGHT and MAX_IN_FLIGHT_GROUPS not set")
+	}
 
-		log.Printf("[createUser] Inserted: %+v", user)
-		sendJSONResponse(w, true, http.StatusCreated, "User created successfully", user)
+	// identify the caller first, so their token can scope and authorize the request
+	if users.Tokens != nil {
+		router.UseAuthentication(server.AuthMiddleware())
 	}
-}
 
-// updateUser handler to update an existing user
-func updateUser(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		id := params["id"]
+	// scope requests to their organization before they are authorized, so
+	// policies can match on the tenant
+	if cfg.MultiTenant {
+		router.Use(server.TenantMiddleware())
+		subsystems.Enable("tenancy", "requests scoped by token or "+handler.OrgHeader+" header")
+	} else {
+		subsystems.Disable("tenancy", "MULTI_TENANT not set")
+	}
 
-		var raw map[string]interface{}
-		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
-			sendJSONResponse(w, false, http.StatusBadRequest, err.Error(), nil)
-			return
-		}
+	// record who did what, denied attempts included
+	if cfg.AuditLog {
+		router.Use(server.AuditMiddleware())
+		subsystems.Enable("audit", "changes and impersonated requests recorded in audit_log")
+	} else {
+		subsystems.Disable("audit", "AUDIT_LOG is false")
+	}
 
-		// Parse birth date from string
-		birthStr, ok := raw["birth"].(string)
-		if !ok {
-			sendJSONResponse(w, false, http.StatusBadRequest, "Invalid birth format", nil)
-			return
-		}
-		birth, err := time.Parse("2006-01-02", birthStr)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusBadRequest, "Invalid birth date: "+err.Error(), nil)
-			return
-		}
+	if err := server.WatchFeatureFlags(context.Background(), cfg.FeatureFlagsInterval); err != nil {
+		return fmt.Errorf("failed to load feature flags: %w", err)
+	}
+	subsystems.Enable("flags", fmt.Sprintf("%d flags, overrides reloaded every %s", len(featureflags.Known), cfg.FeatureFlagsInterval))
 
-		user := User{
-			Name:  raw["name"].(string),
-			Email: raw["email"].(string),
-			Role:  raw["role"].(string),
-			Birth: birth,
+	if engine != nil {
+		if cfg.PolicyDatabase {
+			if err := server.WatchPermissions(context.Background(), cfg.PolicyDatabaseInterval); err != nil {
+				return fmt.Errorf("failed to load permissions: %w", err)
+			}
 		}
 
-		log.Printf("[updateUser] Received: %+v", user)
-		// Calculate age from birth
-		now := time.Now()
-		user.Age = now.Year() - user.Birth.Year()
-		if now.YearDay() < user.Birth.YearDay() {
-			user.Age--
-		}
+		router.Use(server.PolicyMiddleware())
+		subsystems.Enable("policy", cfg.PolicyMode+" mode")
+	} else {
+		subsystems.Disable("policy", "POLICY_FILES, POLICY_BUNDLE_URL and POLICY_DATABASE not set")
+	}
 
-		log.Printf("Query: UPDATE users SET name = %s, email = %s, role = %s, birth = %s, age = %d WHERE id = %s", user.Name, user.Email, user.Role, user.Birth.Format("2006-01-02"), user.Age, id)
-		result, err := db.Exec("UPDATE users SET name = $1, email = $2, role = $3, birth = $4, age = $5 WHERE id = $6", user.Name, user.Email, user.Role, user.Birth, user.Age, id)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
-		}
+	if _, ok := repo.(repository.IdempotencyStore); !ok {
+		subsystems.Disable("idempotency", "the "+cfg.Store+" store can't keep idempotency keys")
+	} else if cfg.IdempotencyWindow <= 0 {
+		subsystems.Disable("idempotency", "IDEMPOTENCY_WINDOW is 0")
+	} else {
+		subsystems.Enable("idempotency", "Idempotency-Key responses replayed for "+cfg.IdempotencyWindow.String())
+	}
 
-		rowsAffected, err := result.RowsAffected()
+	// email admins the user report on their schedules
+	if cfg.ReportRecipients == "" {
+		subsystems.Disable("reports", "REPORT_RECIPIENTS not set")
+	} else if users.Mailer == nil {
+		subsystems.Disable("reports", "no mail provider")
+	} else {
+		recipients, err := report.ParseRecipients(cfg.ReportRecipients, cfg.ReportSchedule)
 		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
-		}
-		if rowsAffected == 0 {
-			sendJSONResponse(w, false, http.StatusNotFound, "User not found", nil)
-			return
+			return fmt.Errorf("invalid REPORT_RECIPIENTS: %w", err)
 		}
-
-		// Get updated user data
-		err = db.QueryRow("SELECT id, name, email, role, birth, age, timestamp FROM users WHERE id = $1", id).Scan(&user.ID, &user.Name, &user.Email, &user.Role, &user.Birth, &user.Age, &user.Timestamp)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
+		reporter := &report.Reporter{Stats: repo, Sender: users.Mailer, Templates: users.Templates, Clock: time.Now, Logger: log.Default()}
+		for _, task := range reporter.Tasks(recipients) {
+			task.Jitter = cfg.TaskJitter
+			if err := tasks.Add(task, true); err != nil {
+				return fmt.Errorf("failed to schedule reports: %w", err)
+			}
 		}
+		subsystems.Enable("reports", fmt.Sprintf("%d recipients", len(recipients)))
+	}
 
-		log.Printf("[updateUser] Updated: %+v", user)
-		sendJSONResponse(w, true, http.StatusOK, "User updated successfully", user)
+	// greet users on their birthday, disabled tasks being only listed
+	greetings := scheduler.Task{
+		Name:     "birthday-greetings",
+		Schedule: cfg.TaskBirthdayGreetingsSchedule,
+		Jitter:   cfg.TaskJitter,
+		Run:      server.Users().SendBirthdayGreetings,
 	}
-}
+	if err := tasks.Add(greetings, cfg.TaskBirthdayGreetings && users.Mailer != nil); err != nil {
+		return fmt.Errorf("invalid TASK_BIRTHDAY_GREETINGS_SCHEDULE: %w", err)
+	}
+	// delete what nobody needs anymore
+	cleanup := scheduler.Task{
+		Name:     "cleanup",
+		Schedule: cfg.TaskCleanupSchedule,
+		Jitter:   cfg.TaskJitter,
+		Run: func(ctx context.Context) error {
+			return server.Users().DeleteStaleData(ctx, cfg.TaskCleanupAfter)
+		},
+	}
+	if err := tasks.Add(cleanup, cfg.TaskCleanup); err != nil {
+		return fmt.Errorf("invalid TASK_CLEANUP_SCHEDULE: %w", err)
+	}
+	// purge what is kept no longer than the retention period
+	retention := scheduler.Task{
+		Name:     "retention",
+		Schedule: cfg.RetentionSchedule,
+		Jitter:   cfg.TaskJitter,
+		Run: func(ctx context.Context) error {
+			return server.Users().PurgeExpiredData(ctx, cfg.RetentionAuditDays, cfg.RetentionDryRun)
+		},
+	}
+	if err := tasks.Add(retention, cfg.RetentionAuditDays > 0); err != nil {
+		return fmt.Errorf("invalid RETENTION_SCHEDULE: %w", err)
+	}
+	if cfg.RetentionAuditDays <= 0 {
+		subsystems.Disable("retention", "RETENTION_AUDIT_DAYS not set")
+	} else if cfg.RetentionDryRun {
+		subsystems.Enable("retention", fmt.Sprintf("audit log kept %d days, dry run", cfg.RetentionAuditDays))
+	} else {
+		subsystems.Enable("retention", fmt.Sprintf("audit log kept %d days", cfg.RetentionAuditDays))
+	}
+	tasks.Start()
+	defer tasks.Stop()
 
-// deleteUser handler to delete a user
-func deleteUser(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		params := mux.Vars(r)
-		id := params["id"]
+	if cfg.TLSEnabled() {
+		subsystems.Enable("tls", "serving HTTPS on "+cfg.TLSAddr)
+	} else {
+		subsystems.Disable("tls", "TLS_CERT_FILE/TLS_KEY_FILE and AUTOCERT_ENABLED not set")
+	}
 
-		log.Printf("Query: DELETE FROM users WHERE id = %s", id)
-		result, err := db.Exec("DELETE FROM users WHERE id = $1", id)
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
+	// the middleware around the routes is rebuilt when its settings are reloaded
+	middleware := func(cfg Config) http.Handler {
+		// pick the version of the API for the paths without one
+		h := server.NegotiateVersion(router)
+		if cfg.RequestTimeout > 0 {
+			h = handler.Timeout(cfg.RequestTimeout)(h)
 		}
-
-		rowsAffected, err := result.RowsAffected()
-		if err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, err.Error(), nil)
-			return
+		if cfg.MaxBodyBytes > 0 {
+			h = handler.MaxBytes(cfg.MaxBodyBytes)(h)
 		}
-		if rowsAffected == 0 {
-			sendJSONResponse(w, false, http.StatusNotFound, "User not found", nil)
-			return
+		if cfg.DatabaseReadURL != "" {
+			h = handler.ReplicaReads(h)
 		}
 
-		sendJSONResponse(w, true, http.StatusOK, "User deleted successfully", nil)
-	}
-}
-
-// healthDB handler to check database connection
-func healthDB(db *sql.DB) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := db.Ping(); err != nil {
-			sendJSONResponse(w, false, http.StatusInternalServerError, "Database connection failed: "+err.Error(), nil)
-			return
+		h = server.Recover(handler.JSONContentTypeMiddleware(h))
+		if cfg.GzipEnabled {
+			h = handler.Gzip(cfg.GzipMinSize, cfg.GzipTypes)(h)
 		}
-		sendJSONResponse(w, true, http.StatusOK, "Database connection healthy", nil)
+
+		// wrap router with CORS, request id, languages, compression, panic recovery and JSON content type middleware
+		return handler.CORS(handler.CORSConfig{
+			AllowedOrigins:   cfg.CORSAllowedOrigins,
+			AllowedMethods:   cfg.CORSAllowedMethods,
+			AllowedHeaders:   cfg.CORSAllowedHeaders,
+			ExposedHeaders:   cfg.CORSExposedHeaders,
+			AllowCredentials: cfg.CORSAllowCredentials,
+			MaxAge:           cfg.CORSMaxAge,
+		})(handler.RequestID(handler.Languages(h)))
 	}
-}
+	var enhancedRouter handler.Swappable
+	enhancedRouter.Store(middleware(cfg))
+
+	// apply the settings that don't take a restart on SIGHUP, and the
+	// rotated secrets
+	go watchReload(cfg, func(cfg Config) {
+		reloaded.Store(&cfg)
+		if users.Tokens != nil {
+			users.Tokens.Rotate([]byte(cfg.AuthSecret))
+		}
+		setLogOutput(cfg.LogPII)
+		server.SetRateLimits(handler.Config{
+			PasswordResetEmailLimit: cfg.PasswordResetEmailLimit,
+			PasswordResetIPLimit:    cfg.PasswordResetIPLimit,
+			PasswordResetWindow:     cfg.PasswordResetWindow,
+			LoginAccountLimit:       cfg.LoginAccountLimit,
+			LoginIPLimit:            cfg.LoginIPLimit,
+			LoginWindow:             cfg.LoginWindow,
+		})
+		enhancedRouter.Store(middleware(cfg))
+	})
 
-// atoi is a helper function to convert string to int
-func atoi(s string) (int, error) {
-	return strconv.Atoi(s)
+	// start the server
+	return serve(cfg, &enhancedRouter)
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"api/internal/health"
+	"api/internal/migrate"
+	"api/internal/repository"
+)
+
+// migrateOnStart applies pending migrations, or only reports them when
+// automatic migration is turned off; tenant schemas come after the shared one
+func migrateOnStart(repo repository.UserRepository, apply bool) error {
+	m, ok := repo.(repository.Migratable)
+	if !ok {
+		return nil
+	}
+	migrator, err := m.Migrator()
+	if err != nil {
+		return err
+	}
+	if err := migrateUpOrReport(migrator, apply, ""); err != nil {
+		return err
+	}
+
+	tm, ok := repo.(repository.TenantMigratable)
+	if !ok {
+		return nil
+	}
+	// tenant schemas reference the shared tables, which must be up to date first
+	if pending, err := migrator.Pending(); err != nil || pending > 0 {
+		return err
+	}
+	tenants, err := tm.TenantMigrators(context.Background())
+	if err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := migrateUpOrReport(tenant.Migrator, apply, " in schema "+tenant.Schema); err != nil {
+			return fmt.Errorf("schema %s: %w", tenant.Schema, err)
+		}
+	}
+	return nil
+}
+
+// migrationsCheck fails while the shared schema has pending migrations, so
+// instances aren't ready before the database is migrated; it is nil for
+// repositories without migrations
+func migrationsCheck(repo repository.UserRepository) (health.Checker, error) {
+	m, ok := repo.(repository.Migratable)
+	if !ok {
+		return nil, nil
+	}
+	migrator, err := m.Migrator()
+	if err != nil {
+		return nil, err
+	}
+	return health.CheckFunc(func(ctx context.Context) error {
+		pending, err := migrator.Pending()
+		if err == nil && pending > 0 {
+			err = fmt.Errorf("%d pending migrations", pending)
+		}
+		return err
+	}), nil
+}
+
+// migrateUpOrReport applies the pending migrations of migrator, or logs how
+// many there are when apply is false; where names the schema in the logs
+func migrateUpOrReport(migrator *migrate.Migrator, apply bool, where string) error {
+	if !apply {
+		pending, err := migrator.Pending()
+		if err != nil {
+			return err
+		}
+		if pending > 0 {
+			log.Printf("WARNING: %d pending migrations%s, run the migrate command to apply them", pending, where)
+		}
+		return nil
+	}
+
+	applied, err := migrator.Up()
+	if err != nil {
+		return err
+	}
+	log.Printf("Migrations up to date%s (%d applied now)", where, len(applied))
+	return nil
+}
+
+// runMigrate handles "migrate up", "migrate down [steps]" and "migrate
+// status", and the same prefixed with "tenants" to run them on every
+// tenant schema when tenants are isolated by schema
+func runMigrate(repo repository.UserRepository, args []string) error {
+	if len(args) > 0 && args[0] == "tenants" {
+		tm, ok := repo.(repository.TenantMigratable)
+		if !ok {
+			return fmt.Errorf("tenants don't have schemas of their own, set TENANT_ISOLATION=schema")
+		}
+		tenants, err := tm.TenantMigrators(context.Background())
+		if err != nil {
+			return err
+		}
+		for _, tenant := range tenants {
+			log.Printf("Schema %s (organization %d)", tenant.Schema, tenant.OrgID)
+			if err := runMigrator(tenant.Migrator, args[1:]); err != nil {
+				return fmt.Errorf("schema %s: %w", tenant.Schema, err)
+			}
+		}
+		return nil
+	}
+
+	m, ok := repo.(repository.Migratable)
+	if !ok {
+		return fmt.Errorf("the configured store does not use migrations")
+	}
+	migrator, err := m.Migrator()
+	if err != nil {
+		return err
+	}
+	return runMigrator(migrator, args)
+}
+
+// runMigrator runs one migrate command, "up" by default, with migrator
+func runMigrator(migrator *migrate.Migrator, args []string) error {
+	var err error
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		applied, err := migrator.Up()
+		log.Printf("Applied migrations: %v", applied)
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of steps %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		log.Printf("Reverted migrations: %v", reverted)
+		return err
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q (expected up, down or status)", command)
+	}
+}
@@ -0,0 +1,11 @@
+// Package migrations embeds the SQL migration files of every supported
+// database, one directory per dialect. postgres_tenant holds the tables
+// created in each tenant's schema when tenants are isolated by schema.
+package migrations
+
+import "embed"
+
+// FS holds the migration files, e.g. postgres/0001_create_users.up.sql
+//
+//go:embed postgres/*.sql postgres_tenant/*.sql sqlite/*.sql mysql/*.sql
+var FS embed.FS
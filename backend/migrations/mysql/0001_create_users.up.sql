@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name TEXT NOT NULL,
+	email VARCHAR(255) NOT NULL UNIQUE,
+	role VARCHAR(64) NOT NULL DEFAULT 'user',
+	birth DATE NOT NULL,
+	age INT,
+	timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
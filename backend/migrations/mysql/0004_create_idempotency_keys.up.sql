@@ -0,0 +1,10 @@
+-- responses to POST requests sent with an Idempotency-Key header, replayed on retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	idempotency_key VARCHAR(255) PRIMARY KEY,
+	fingerprint VARCHAR(64) NOT NULL,
+	status INT NOT NULL DEFAULT 0, -- 0 while the first request is still running
+	content_type VARCHAR(255) NOT NULL DEFAULT '',
+	body LONGBLOB,
+	created_at DATETIME(6) NOT NULL,
+	INDEX idempotency_keys_created_at_idx (created_at)
+);
@@ -0,0 +1,2 @@
+-- serve the prefix matches of /users/suggest; the default collation already ignores case
+CREATE INDEX users_name_prefix_idx ON users (name(64));
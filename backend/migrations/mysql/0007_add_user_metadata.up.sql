@@ -0,0 +1,2 @@
+-- arbitrary client-defined attributes; JSON columns can't have a literal default, NULL reads as empty
+ALTER TABLE users ADD COLUMN metadata JSON;
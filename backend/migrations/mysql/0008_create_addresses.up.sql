@@ -0,0 +1,12 @@
+-- postal addresses of a user, removed along with it; MySQL has no partial
+-- indexes, the single primary address per user is enforced by the application
+CREATE TABLE IF NOT EXISTS addresses (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	street TEXT NOT NULL,
+	city VARCHAR(255) NOT NULL,
+	country CHAR(2) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	INDEX addresses_user_id_idx (user_id),
+	CONSTRAINT addresses_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+-- E.164 phone numbers of a user, removed along with it; the single primary
+-- number per user is enforced by the application
+CREATE TABLE IF NOT EXISTS phones (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	number VARCHAR(16) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	UNIQUE KEY phones_number_key (user_id, number),
+	CONSTRAINT phones_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+-- storage key of the user's avatar, empty without one
+ALTER TABLE users ADD COLUMN avatar VARCHAR(255) NOT NULL DEFAULT '';
@@ -0,0 +1,2 @@
+ALTER TABLE users DROP FOREIGN KEY users_role_fk;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,11 @@
+-- roles users can be given, referenced by name from users.role
+CREATE TABLE IF NOT EXISTS roles (
+	name VARCHAR(64) PRIMARY KEY,
+	description TEXT NOT NULL
+);
+
+-- the built-in roles, then every role already in use
+INSERT IGNORE INTO roles (name, description) VALUES ('admin', ''), ('moderator', ''), ('user', '');
+INSERT IGNORE INTO roles (name, description) SELECT DISTINCT role, '' FROM users;
+
+ALTER TABLE users ADD CONSTRAINT users_role_fk FOREIGN KEY (role) REFERENCES roles (name);
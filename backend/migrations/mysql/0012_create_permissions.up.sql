@@ -0,0 +1,12 @@
+-- policies managed through the API, evaluated along with policy files
+CREATE TABLE IF NOT EXISTS permissions (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	effect VARCHAR(6) NOT NULL,
+	principal VARCHAR(255) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	resource VARCHAR(255) NOT NULL DEFAULT '*',
+	-- comma-separated field patterns, empty for every field
+	fields TEXT NOT NULL,
+	description TEXT NOT NULL,
+	CONSTRAINT permissions_effect_check CHECK (effect IN ('permit', 'forbid'))
+);
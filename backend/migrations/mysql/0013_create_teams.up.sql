@@ -0,0 +1,17 @@
+-- groups of users beyond their single role
+CREATE TABLE IF NOT EXISTS teams (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	description TEXT NOT NULL,
+	UNIQUE KEY name (name)
+);
+
+-- memberships go away with either their team or their user
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id INT NOT NULL,
+	user_id INT NOT NULL,
+	PRIMARY KEY (team_id, user_id),
+	INDEX team_members_user_id_idx (user_id),
+	CONSTRAINT team_members_team_id_fk FOREIGN KEY (team_id) REFERENCES teams (id) ON DELETE CASCADE,
+	CONSTRAINT team_members_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+ALTER TABLE teams
+	DROP FOREIGN KEY teams_org_id_fk,
+	DROP INDEX org_id_name,
+	ADD UNIQUE KEY name (name),
+	DROP COLUMN org_id;
+ALTER TABLE users
+	DROP FOREIGN KEY users_org_id_fk,
+	DROP INDEX users_org_id_idx,
+	DROP COLUMN org_id;
+DROP TABLE IF EXISTS organizations;
@@ -0,0 +1,21 @@
+-- tenants owning users and teams; the default organization owns every
+-- existing row and those created by unscoped requests
+CREATE TABLE IF NOT EXISTS organizations (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	UNIQUE KEY name (name)
+);
+
+INSERT IGNORE INTO organizations (id, name) VALUES (1, 'default');
+
+ALTER TABLE users
+	ADD COLUMN org_id INT NOT NULL DEFAULT 1,
+	ADD INDEX users_org_id_idx (org_id),
+	ADD CONSTRAINT users_org_id_fk FOREIGN KEY (org_id) REFERENCES organizations (id);
+
+-- team names only need to be unique within their organization
+ALTER TABLE teams
+	ADD COLUMN org_id INT NOT NULL DEFAULT 1,
+	DROP INDEX name,
+	ADD UNIQUE KEY org_id_name (org_id, name),
+	ADD CONSTRAINT teams_org_id_fk FOREIGN KEY (org_id) REFERENCES organizations (id);
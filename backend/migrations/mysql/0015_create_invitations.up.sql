@@ -0,0 +1,18 @@
+-- people invited by email to join an organization with a role. The token
+-- of the link is signed, not stored. user_id has no foreign key, as on
+-- Postgres where the user may live in the organization's own schema.
+CREATE TABLE IF NOT EXISTS invitations (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	email VARCHAR(255) NOT NULL,
+	role VARCHAR(64) NOT NULL,
+	org_id INT NOT NULL,
+	status VARCHAR(8) NOT NULL DEFAULT 'pending',
+	expires_at DATETIME(6) NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	accepted_at DATETIME(6),
+	user_id INT,
+	INDEX invitations_org_id_email_idx (org_id, email),
+	CONSTRAINT invitations_status_check CHECK (status IN ('pending', 'accepted', 'expired')),
+	CONSTRAINT invitations_role_fk FOREIGN KEY (role) REFERENCES roles (name) ON DELETE CASCADE,
+	CONSTRAINT invitations_org_id_fk FOREIGN KEY (org_id) REFERENCES organizations (id) ON DELETE CASCADE
+);
@@ -0,0 +1,4 @@
+ALTER TABLE users
+	DROP CHECK users_status_check,
+	DROP COLUMN status,
+	DROP COLUMN password_hash;
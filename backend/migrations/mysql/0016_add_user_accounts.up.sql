@@ -0,0 +1,7 @@
+-- what users sign in with: a bcrypt password hash, empty for users who
+-- never set one, and whether their email is verified. Existing users and
+-- those created through the API are active.
+ALTER TABLE users
+	ADD COLUMN password_hash VARCHAR(255) NOT NULL DEFAULT '',
+	ADD COLUMN status VARCHAR(7) NOT NULL DEFAULT 'active',
+	ADD CONSTRAINT users_status_check CHECK (status IN ('pending', 'active'));
@@ -0,0 +1,3 @@
+-- incremented whenever the tokens issued to a user must stop working, such
+-- as when their password is reset; tokens carry the version they were issued at
+ALTER TABLE users ADD COLUMN token_version INT NOT NULL DEFAULT 0;
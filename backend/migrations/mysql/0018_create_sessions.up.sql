@@ -0,0 +1,16 @@
+-- cookie sessions of logged in users. The id is the SHA-256 of the cookie
+-- value, so a leaked table can't be replayed; token_version is the user's at
+-- login, revoking the session along with the access tokens. user_id has no
+-- foreign key, as on Postgres where the user may live in the organization's
+-- own schema.
+CREATE TABLE IF NOT EXISTS sessions (
+	id CHAR(64) PRIMARY KEY,
+	user_id INT NOT NULL,
+	org_id INT NOT NULL,
+	token_version INT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	expires_at DATETIME(6) NOT NULL,
+	INDEX sessions_user_id_idx (org_id, user_id),
+	INDEX sessions_expires_at_idx (expires_at),
+	CONSTRAINT sessions_org_id_fk FOREIGN KEY (org_id) REFERENCES organizations (id) ON DELETE CASCADE
+);
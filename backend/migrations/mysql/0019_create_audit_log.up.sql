@@ -0,0 +1,18 @@
+-- who did what through the API: every request changing something, and
+-- every request of an admin impersonating a user. Entries outlive the
+-- users and organizations they mention, so nothing references them.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	occurred_at DATETIME(6) NOT NULL,
+	request_id VARCHAR(128) NOT NULL DEFAULT '',
+	org_id INT,
+	actor VARCHAR(64) NOT NULL,
+	impersonator VARCHAR(64) NOT NULL DEFAULT '',
+	action VARCHAR(128) NOT NULL,
+	resource VARCHAR(255) NOT NULL,
+	method VARCHAR(16) NOT NULL,
+	path TEXT NOT NULL,
+	status INT NOT NULL,
+	INDEX audit_log_org_id_idx (org_id, id),
+	INDEX audit_log_occurred_at_idx (occurred_at)
+);
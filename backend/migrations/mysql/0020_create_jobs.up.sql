@@ -0,0 +1,19 @@
+-- background jobs queued by the API and run by its workers. Workers claim
+-- due jobs with FOR UPDATE SKIP LOCKED, so several instances share the
+-- queue; jobs that succeed are deleted and those failing too often stay
+-- dead until retried.
+CREATE TABLE IF NOT EXISTS jobs (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	type VARCHAR(64) NOT NULL,
+	payload MEDIUMTEXT NOT NULL,
+	org_id INT,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	attempts INT NOT NULL DEFAULT 0,
+	max_attempts INT NOT NULL,
+	run_at DATETIME(6) NOT NULL,
+	locked_until DATETIME(6),
+	last_error TEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	INDEX jobs_due_idx (status, run_at),
+	INDEX jobs_org_id_idx (org_id, id)
+);
@@ -0,0 +1,19 @@
+-- CSV imports of users, run by the import-users background job. The CSV
+-- is kept in data until the import is done; errors holds the JSON array of
+-- the rows that could not be imported, and last_error why a failed import
+-- stopped.
+CREATE TABLE IF NOT EXISTS imports (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	org_id INT,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	total INT NOT NULL,
+	processed INT NOT NULL DEFAULT 0,
+	created INT NOT NULL DEFAULT 0,
+	failed INT NOT NULL DEFAULT 0,
+	errors MEDIUMTEXT NOT NULL,
+	last_error TEXT NOT NULL,
+	data LONGTEXT,
+	created_at DATETIME(6) NOT NULL,
+	finished_at DATETIME(6),
+	INDEX imports_org_id_idx (org_id, id)
+);
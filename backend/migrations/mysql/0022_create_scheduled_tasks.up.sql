@@ -0,0 +1,9 @@
+-- the latest run of each recurring task. Every instance schedules the
+-- tasks, and the one moving scheduled_at to the time of a run performs it.
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+	name VARCHAR(255) PRIMARY KEY,
+	scheduled_at DATETIME(6) NOT NULL,
+	started_at DATETIME(6) NOT NULL,
+	finished_at DATETIME(6),
+	last_error TEXT NOT NULL
+);
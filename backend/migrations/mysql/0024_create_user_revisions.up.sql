@@ -0,0 +1,14 @@
+-- the edits of each user: the version the edit made, who made it and the
+-- JSON array of the fields it changed with their old and new values.
+-- Revisions go away with their user.
+CREATE TABLE IF NOT EXISTS user_revisions (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	version INT NOT NULL,
+	actor VARCHAR(64) NOT NULL,
+	impersonator VARCHAR(64) NOT NULL DEFAULT '',
+	changes MEDIUMTEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	INDEX user_revisions_user_id_idx (user_id, id),
+	CONSTRAINT user_revisions_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
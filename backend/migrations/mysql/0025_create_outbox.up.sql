@@ -0,0 +1,19 @@
+-- the transactional outbox: domain events written in the transaction of the
+-- change they describe, and published by the relay in id order. locked_until
+-- is set while a relay publishes the event or waits to retry it, delivered_at
+-- once the broker accepted it. Events are kept after delivery, for replays.
+-- MySQL has no partial indexes, delivered_at leads the undelivered one instead.
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	type VARCHAR(64) NOT NULL,
+	org_id INT NOT NULL,
+	user_id INT NOT NULL,
+	payload MEDIUMTEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	attempts INT NOT NULL DEFAULT 0,
+	locked_until DATETIME(6),
+	last_error TEXT NOT NULL,
+	delivered_at DATETIME(6),
+	INDEX outbox_undelivered_idx (delivered_at, id),
+	INDEX outbox_user_id_idx (org_id, user_id)
+);
@@ -0,0 +1,14 @@
+-- the in-app notifications of each user, such as an admin editing their
+-- profile; read_at stays NULL until the user reads them. Notifications go
+-- away with their user.
+CREATE TABLE IF NOT EXISTS notifications (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	user_id INT NOT NULL,
+	type VARCHAR(64) NOT NULL,
+	title VARCHAR(255) NOT NULL,
+	body TEXT NOT NULL,
+	created_at DATETIME(6) NOT NULL,
+	read_at DATETIME(6) NULL,
+	INDEX notifications_user_id_idx (user_id, id),
+	CONSTRAINT notifications_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+-- the channels and types of notifications each user turned on or off, as
+-- a JSON object; users without a row receive them all. Preferences go away
+-- with their user.
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id INT PRIMARY KEY,
+	preferences TEXT NOT NULL,
+	updated_at DATETIME(6) NOT NULL,
+	CONSTRAINT notification_preferences_user_id_fk FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
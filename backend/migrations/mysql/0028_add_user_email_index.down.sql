@@ -0,0 +1,5 @@
+-- fails while emails are encrypted, decrypt them first
+ALTER TABLE users
+	DROP INDEX email_index,
+	DROP COLUMN email_index,
+	MODIFY email VARCHAR(255) NOT NULL;
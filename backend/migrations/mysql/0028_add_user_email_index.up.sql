@@ -0,0 +1,7 @@
+-- the blind index of the email of users whose email is encrypted, NULL
+-- while it is stored in plaintext; it keeps encrypted emails unique.
+-- Encrypted emails are longer than the emails themselves.
+ALTER TABLE users
+	MODIFY email VARCHAR(512) NOT NULL,
+	ADD COLUMN email_index VARCHAR(64) NULL,
+	ADD UNIQUE INDEX email_index (email_index);
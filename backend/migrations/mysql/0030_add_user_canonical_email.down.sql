@@ -0,0 +1,3 @@
+ALTER TABLE users
+	DROP INDEX canonical_email,
+	DROP COLUMN canonical_email;
@@ -0,0 +1,7 @@
+-- the email of users without its +tag, set while REJECT_EMAIL_ALIASES is
+-- on and NULL otherwise; it keeps plus-addressed aliases out in every
+-- organization, and is the blind index of that email while emails are
+-- encrypted
+ALTER TABLE users
+	ADD COLUMN canonical_email VARCHAR(255) NULL,
+	ADD UNIQUE INDEX canonical_email (canonical_email);
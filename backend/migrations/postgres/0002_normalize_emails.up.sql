@@ -0,0 +1,2 @@
+-- emails are compared case-insensitively from now on
+UPDATE users SET email = LOWER(TRIM(email));
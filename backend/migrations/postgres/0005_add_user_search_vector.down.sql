@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_search_vector_idx;
+DROP TRIGGER IF EXISTS users_search_vector_trigger ON users;
+DROP FUNCTION IF EXISTS users_search_vector_update();
+ALTER TABLE users DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,21 @@
+-- full-text search over users, kept up to date by a trigger; names rank above emails above roles
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION users_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('simple', translate(coalesce(NEW.email, ''), '@.', '  ')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(NEW.role, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER users_search_vector_trigger
+	BEFORE INSERT OR UPDATE OF name, email, role ON users
+	FOR EACH ROW EXECUTE FUNCTION users_search_vector_update();
+
+-- fill the column for existing rows through the trigger
+UPDATE users SET name = name;
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
@@ -0,0 +1,3 @@
+-- serve the prefix matches of /users/suggest; emails are stored lowercased
+CREATE INDEX IF NOT EXISTS users_name_prefix_idx ON users (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_email_prefix_idx ON users (email text_pattern_ops);
@@ -0,0 +1,3 @@
+-- arbitrary client-defined attributes, filtered with metadata->>'key'
+ALTER TABLE users ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}'::jsonb;
+CREATE INDEX IF NOT EXISTS users_metadata_idx ON users USING GIN (metadata);
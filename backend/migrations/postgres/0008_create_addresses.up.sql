@@ -0,0 +1,13 @@
+-- postal addresses of a user, removed along with it
+CREATE TABLE IF NOT EXISTS addresses (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	street TEXT NOT NULL,
+	city TEXT NOT NULL,
+	country CHAR(2) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id);
+-- at most one primary address per user
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_primary_idx ON addresses (user_id) WHERE is_primary;
@@ -0,0 +1,11 @@
+-- E.164 phone numbers of a user, removed along with it
+CREATE TABLE IF NOT EXISTS phones (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	number VARCHAR(16) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	CONSTRAINT phones_number_key UNIQUE (user_id, number)
+);
+
+-- at most one primary number per user
+CREATE UNIQUE INDEX IF NOT EXISTS phones_primary_idx ON phones (user_id) WHERE is_primary;
@@ -0,0 +1,11 @@
+-- roles users can be given, referenced by name from users.role
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+-- the built-in roles, then every role already in use
+INSERT INTO roles (name) VALUES ('admin'), ('moderator'), ('user') ON CONFLICT DO NOTHING;
+INSERT INTO roles (name) SELECT DISTINCT role FROM users ON CONFLICT DO NOTHING;
+
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles (name);
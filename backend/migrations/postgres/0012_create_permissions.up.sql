@@ -0,0 +1,11 @@
+-- policies managed through the API, evaluated along with policy files
+CREATE TABLE IF NOT EXISTS permissions (
+	id SERIAL PRIMARY KEY,
+	effect TEXT NOT NULL CHECK (effect IN ('permit', 'forbid')),
+	principal TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL DEFAULT '*',
+	-- comma-separated field patterns, empty for every field
+	fields TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT ''
+);
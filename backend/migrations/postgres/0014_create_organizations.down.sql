@@ -0,0 +1,5 @@
+ALTER TABLE teams DROP CONSTRAINT IF EXISTS teams_org_id_name_key;
+ALTER TABLE teams ADD CONSTRAINT teams_name_key UNIQUE (name);
+ALTER TABLE teams DROP COLUMN IF EXISTS org_id;
+ALTER TABLE users DROP COLUMN IF EXISTS org_id;
+DROP TABLE IF EXISTS organizations;
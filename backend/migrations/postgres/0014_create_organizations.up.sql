@@ -0,0 +1,20 @@
+-- tenants owning users and teams; the default organization owns every
+-- existing row and those created by unscoped requests
+CREATE TABLE IF NOT EXISTS organizations (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	CONSTRAINT organizations_name_key UNIQUE (name)
+);
+
+INSERT INTO organizations (id, name) VALUES (1, 'default') ON CONFLICT DO NOTHING;
+SELECT setval(pg_get_serial_sequence('organizations', 'id'), (SELECT MAX(id) FROM organizations));
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1
+	CONSTRAINT users_org_id_fkey REFERENCES organizations (id);
+CREATE INDEX IF NOT EXISTS users_org_id_idx ON users (org_id);
+
+-- team names only need to be unique within their organization
+ALTER TABLE teams ADD COLUMN IF NOT EXISTS org_id INTEGER NOT NULL DEFAULT 1
+	CONSTRAINT teams_org_id_fkey REFERENCES organizations (id);
+ALTER TABLE teams DROP CONSTRAINT IF EXISTS teams_name_key;
+ALTER TABLE teams ADD CONSTRAINT teams_org_id_name_key UNIQUE (org_id, name);
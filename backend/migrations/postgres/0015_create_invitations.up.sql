@@ -0,0 +1,16 @@
+-- people invited by email to join an organization with a role. The token
+-- of the link is signed, not stored. user_id has no foreign key, since with
+-- schema-per-tenant isolation the user lives in the organization's schema.
+CREATE TABLE IF NOT EXISTS invitations (
+	id SERIAL PRIMARY KEY,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL CONSTRAINT invitations_role_fkey REFERENCES roles (name) ON DELETE CASCADE,
+	org_id INTEGER NOT NULL CONSTRAINT invitations_org_id_fkey REFERENCES organizations (id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'expired')),
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	accepted_at TIMESTAMP WITH TIME ZONE,
+	user_id INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS invitations_org_id_email_idx ON invitations (org_id, email);
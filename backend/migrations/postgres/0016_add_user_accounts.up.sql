@@ -0,0 +1,6 @@
+-- what users sign in with: a bcrypt password hash, empty for users who
+-- never set one, and whether their email is verified. Existing users and
+-- those created through the API are active.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+	CONSTRAINT users_status_check CHECK (status IN ('pending', 'active'));
@@ -0,0 +1,16 @@
+-- cookie sessions of logged in users. The id is the SHA-256 of the cookie
+-- value, so a leaked table can't be replayed; token_version is the user's at
+-- login, revoking the session along with the access tokens. user_id has no
+-- foreign key, since with schema-per-tenant isolation the user lives in the
+-- organization's schema.
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	org_id INTEGER NOT NULL CONSTRAINT sessions_org_id_fkey REFERENCES organizations (id) ON DELETE CASCADE,
+	token_version INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (org_id, user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
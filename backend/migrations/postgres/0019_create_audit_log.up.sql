@@ -0,0 +1,19 @@
+-- who did what through the API: every request changing something, and
+-- every request of an admin impersonating a user. Entries outlive the
+-- users and organizations they mention, so nothing references them.
+CREATE TABLE IF NOT EXISTS audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	occurred_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	request_id TEXT NOT NULL DEFAULT '',
+	org_id INTEGER,
+	actor TEXT NOT NULL,
+	impersonator TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	method TEXT NOT NULL,
+	path TEXT NOT NULL,
+	status INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_org_id_idx ON audit_log (org_id, id);
+CREATE INDEX IF NOT EXISTS audit_log_occurred_at_idx ON audit_log (occurred_at);
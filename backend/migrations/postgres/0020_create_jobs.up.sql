@@ -0,0 +1,20 @@
+-- background jobs queued by the API and run by its workers. Workers claim
+-- due jobs with FOR UPDATE SKIP LOCKED, so several instances share the
+-- queue; jobs that succeed are deleted and those failing too often stay
+-- dead until retried.
+CREATE TABLE IF NOT EXISTS jobs (
+	id BIGSERIAL PRIMARY KEY,
+	type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	org_id INTEGER,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	locked_until TIMESTAMP WITH TIME ZONE,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (status, run_at);
+CREATE INDEX IF NOT EXISTS jobs_org_id_idx ON jobs (org_id, id);
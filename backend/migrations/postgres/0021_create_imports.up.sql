@@ -0,0 +1,20 @@
+-- CSV imports of users, run by the import-users background job. The CSV
+-- is kept in data until the import is done; errors holds the JSON array of
+-- the rows that could not be imported, and last_error why a failed import
+-- stopped.
+CREATE TABLE IF NOT EXISTS imports (
+	id BIGSERIAL PRIMARY KEY,
+	org_id INTEGER,
+	status TEXT NOT NULL DEFAULT 'pending',
+	total INTEGER NOT NULL,
+	processed INTEGER NOT NULL DEFAULT 0,
+	created INTEGER NOT NULL DEFAULT 0,
+	failed INTEGER NOT NULL DEFAULT 0,
+	errors TEXT NOT NULL DEFAULT '[]',
+	last_error TEXT NOT NULL DEFAULT '',
+	data TEXT,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	finished_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS imports_org_id_idx ON imports (org_id, id);
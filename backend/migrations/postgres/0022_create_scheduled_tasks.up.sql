@@ -0,0 +1,9 @@
+-- the latest run of each recurring task. Every instance schedules the
+-- tasks, and the one moving scheduled_at to the time of a run performs it.
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+	name TEXT PRIMARY KEY,
+	scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	finished_at TIMESTAMP WITH TIME ZONE,
+	last_error TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,14 @@
+-- the edits of each user: the version the edit made, who made it and the
+-- JSON array of the fields it changed with their old and new values.
+-- Revisions go away with their user.
+CREATE TABLE IF NOT EXISTS user_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	actor TEXT NOT NULL,
+	impersonator TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_revisions_user_id_idx ON user_revisions (user_id, id);
@@ -0,0 +1,11 @@
+CREATE OR REPLACE FUNCTION users_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('simple', translate(coalesce(NEW.email, ''), '@.', '  ')), 'B') ||
+		setweight(to_tsvector('simple', coalesce(NEW.role, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+ALTER TABLE users DROP COLUMN IF EXISTS email_index;
@@ -0,0 +1,15 @@
+-- the blind index of the email of users whose email is encrypted, NULL
+-- while it is stored in plaintext; it keeps encrypted emails unique
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index TEXT CONSTRAINT users_email_index_key UNIQUE;
+
+-- encrypted emails are left out of the search vector, which would
+-- otherwise hold pieces of their ciphertext
+CREATE OR REPLACE FUNCTION users_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('simple', coalesce(NEW.name, '')), 'A') ||
+		setweight(to_tsvector('simple', CASE WHEN NEW.email LIKE 'pii:%' THEN '' ELSE translate(coalesce(NEW.email, ''), '@.', '  ') END), 'B') ||
+		setweight(to_tsvector('simple', coalesce(NEW.role, '')), 'C');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,10 @@
+-- the overrides of feature flags set through the API, for one organization
+-- or, with org_id 0, for every organization; flags without one keep their
+-- configured default
+CREATE TABLE IF NOT EXISTS feature_flags (
+	name TEXT NOT NULL,
+	org_id INTEGER NOT NULL DEFAULT 0,
+	enabled BOOLEAN NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	PRIMARY KEY (name, org_id)
+);
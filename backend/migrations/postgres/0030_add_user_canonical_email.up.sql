@@ -0,0 +1,5 @@
+-- the email of users without its +tag, set while REJECT_EMAIL_ALIASES is
+-- on and NULL otherwise; it keeps plus-addressed aliases out in every
+-- organization, and is the blind index of that email while emails are
+-- encrypted
+ALTER TABLE users ADD COLUMN IF NOT EXISTS canonical_email TEXT CONSTRAINT users_canonical_email_key UNIQUE;
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS team_members;
+DROP TABLE IF EXISTS teams;
+DROP TABLE IF EXISTS phones;
+DROP TABLE IF EXISTS addresses;
+DROP TABLE IF EXISTS users;
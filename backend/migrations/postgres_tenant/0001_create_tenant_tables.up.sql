@@ -0,0 +1,65 @@
+-- the tables owned by a tenant, created in its own schema with the shape
+-- the shared ones have after postgres/0014. The search_path of tenant
+-- connections ends with public, where roles, organizations and the search
+-- vector function are found.
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	role TEXT NOT NULL DEFAULT 'user' CONSTRAINT users_role_fkey REFERENCES roles (name),
+	birth DATE NOT NULL,
+	age INTEGER,
+	timestamp TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+	version INTEGER NOT NULL DEFAULT 1,
+	search_vector tsvector,
+	metadata JSONB NOT NULL DEFAULT '{}'::jsonb,
+	avatar TEXT NOT NULL DEFAULT '',
+	org_id INTEGER NOT NULL CONSTRAINT users_org_id_fkey REFERENCES organizations (id)
+);
+
+CREATE TRIGGER users_search_vector_trigger
+	BEFORE INSERT OR UPDATE OF name, email, role ON users
+	FOR EACH ROW EXECUTE FUNCTION users_search_vector_update();
+
+CREATE INDEX IF NOT EXISTS users_search_vector_idx ON users USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS users_name_prefix_idx ON users (lower(name) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_email_prefix_idx ON users (email text_pattern_ops);
+CREATE INDEX IF NOT EXISTS users_metadata_idx ON users USING GIN (metadata);
+
+CREATE TABLE IF NOT EXISTS addresses (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	street TEXT NOT NULL,
+	city TEXT NOT NULL,
+	country CHAR(2) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id);
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_primary_idx ON addresses (user_id) WHERE is_primary;
+
+CREATE TABLE IF NOT EXISTS phones (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	number VARCHAR(16) NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT FALSE,
+	CONSTRAINT phones_number_key UNIQUE (user_id, number)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS phones_primary_idx ON phones (user_id) WHERE is_primary;
+
+CREATE TABLE IF NOT EXISTS teams (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	org_id INTEGER NOT NULL CONSTRAINT teams_org_id_fkey REFERENCES organizations (id),
+	CONSTRAINT teams_org_id_name_key UNIQUE (org_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id);
@@ -0,0 +1,4 @@
+-- the sign-in columns postgres/0016 adds to the shared users table
+ALTER TABLE users ADD COLUMN IF NOT EXISTS password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'active'
+	CONSTRAINT users_status_check CHECK (status IN ('pending', 'active'));
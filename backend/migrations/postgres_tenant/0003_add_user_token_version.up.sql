@@ -0,0 +1,2 @@
+-- the token version postgres/0017 adds to the shared users table
+ALTER TABLE users ADD COLUMN IF NOT EXISTS token_version INTEGER NOT NULL DEFAULT 0;
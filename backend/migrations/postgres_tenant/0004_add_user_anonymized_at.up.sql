@@ -0,0 +1,2 @@
+-- the anonymization time postgres/0023 adds to the shared users table
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMP WITH TIME ZONE;
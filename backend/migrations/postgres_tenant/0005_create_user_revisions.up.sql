@@ -0,0 +1,12 @@
+-- the edits of the tenant's users, like postgres/0024 in the shared schema
+CREATE TABLE IF NOT EXISTS user_revisions (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	version INTEGER NOT NULL,
+	actor TEXT NOT NULL,
+	impersonator TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS user_revisions_user_id_idx ON user_revisions (user_id, id);
@@ -0,0 +1,7 @@
+-- the notification preferences of the tenant's users, like postgres/0027
+-- in the shared schema
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	preferences TEXT NOT NULL,
+	updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,3 @@
+-- the blind index postgres/0028 adds to the shared users table; the search
+-- vector function it updates is the one in public
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_index TEXT CONSTRAINT users_email_index_key UNIQUE;
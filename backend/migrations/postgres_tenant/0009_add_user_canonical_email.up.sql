@@ -0,0 +1,3 @@
+-- the canonical email postgres/0030 adds to the shared users table, unique
+-- within the schema of the organization
+ALTER TABLE users ADD COLUMN IF NOT EXISTS canonical_email TEXT CONSTRAINT users_canonical_email_key UNIQUE;
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS users (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	role TEXT NOT NULL DEFAULT 'user',
+	birth DATE NOT NULL,
+	age INTEGER,
+	timestamp TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
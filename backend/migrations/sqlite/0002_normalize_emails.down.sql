@@ -0,0 +1,2 @@
+-- the original letter case is lost, emails stay lowercased
+SELECT 1;
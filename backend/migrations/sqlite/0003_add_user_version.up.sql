@@ -0,0 +1,2 @@
+-- incremented on every update, for optimistic locking
+ALTER TABLE users ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
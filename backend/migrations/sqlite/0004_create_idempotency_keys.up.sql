@@ -0,0 +1,11 @@
+-- responses to POST requests sent with an Idempotency-Key header, replayed on retries
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	idempotency_key TEXT PRIMARY KEY,
+	fingerprint TEXT NOT NULL,
+	status INTEGER NOT NULL DEFAULT 0, -- 0 while the first request is still running
+	content_type TEXT NOT NULL DEFAULT '',
+	body BLOB,
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS users_name_prefix_idx;
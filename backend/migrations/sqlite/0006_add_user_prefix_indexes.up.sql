@@ -0,0 +1,2 @@
+-- serve the prefix range scans of /users/suggest; the unique email index covers emails
+CREATE INDEX IF NOT EXISTS users_name_prefix_idx ON users (lower(name));
@@ -0,0 +1,2 @@
+-- arbitrary client-defined attributes, stored as a JSON object
+ALTER TABLE users ADD COLUMN metadata TEXT NOT NULL DEFAULT '{}';
@@ -0,0 +1,13 @@
+-- postal addresses of a user, removed along with it (needs PRAGMA foreign_keys, set when connecting)
+CREATE TABLE IF NOT EXISTS addresses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	street TEXT NOT NULL,
+	city TEXT NOT NULL,
+	country TEXT NOT NULL,
+	is_primary BOOLEAN NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS addresses_user_id_idx ON addresses (user_id);
+-- at most one primary address per user
+CREATE UNIQUE INDEX IF NOT EXISTS addresses_primary_idx ON addresses (user_id) WHERE is_primary;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS users_role_insert;
+DROP TRIGGER IF EXISTS users_role_update;
+DROP TRIGGER IF EXISTS roles_delete;
+DROP TABLE IF EXISTS roles;
@@ -0,0 +1,29 @@
+-- roles users can be given, referenced by name from users.role
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+-- the built-in roles, then every role already in use
+INSERT OR IGNORE INTO roles (name) VALUES ('admin'), ('moderator'), ('user');
+INSERT OR IGNORE INTO roles (name) SELECT DISTINCT role FROM users;
+
+-- SQLite can't add a foreign key to an existing table, and rebuilding users
+-- would cascade into its addresses and phones; triggers enforce it instead
+CREATE TRIGGER IF NOT EXISTS users_role_insert BEFORE INSERT ON users
+WHEN NOT EXISTS (SELECT 1 FROM roles WHERE name = NEW.role)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_role_update BEFORE UPDATE OF role ON users
+WHEN NOT EXISTS (SELECT 1 FROM roles WHERE name = NEW.role)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS roles_delete BEFORE DELETE ON roles
+WHEN EXISTS (SELECT 1 FROM users WHERE role = OLD.name)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
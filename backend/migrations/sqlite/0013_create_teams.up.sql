@@ -0,0 +1,15 @@
+-- groups of users beyond their single role
+CREATE TABLE IF NOT EXISTS teams (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT ''
+);
+
+-- memberships go away with either their team or their user (needs PRAGMA foreign_keys, set when connecting)
+CREATE TABLE IF NOT EXISTS team_members (
+	team_id INTEGER NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS team_members_user_id_idx ON team_members (user_id);
@@ -0,0 +1,19 @@
+DROP TRIGGER IF EXISTS organizations_delete;
+DROP TRIGGER IF EXISTS users_org_insert;
+DROP TRIGGER IF EXISTS users_org_update;
+
+CREATE TABLE teams_old (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO teams_old (id, name, description) SELECT id, name, description FROM teams;
+CREATE TEMP TABLE team_members_backup AS SELECT team_id, user_id FROM team_members;
+DROP TABLE teams;
+ALTER TABLE teams_old RENAME TO teams;
+INSERT INTO team_members (team_id, user_id) SELECT team_id, user_id FROM team_members_backup;
+DROP TABLE team_members_backup;
+
+DROP INDEX IF EXISTS users_org_id_idx;
+ALTER TABLE users DROP COLUMN org_id;
+DROP TABLE IF EXISTS organizations;
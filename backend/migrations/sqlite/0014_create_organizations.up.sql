@@ -0,0 +1,48 @@
+-- tenants owning users and teams; the default organization owns every
+-- existing row and those created by unscoped requests
+CREATE TABLE IF NOT EXISTS organizations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL UNIQUE
+);
+
+INSERT OR IGNORE INTO organizations (id, name) VALUES (1, 'default');
+
+-- as with roles, triggers stand in for the foreign key SQLite can't add
+-- to the existing users table
+ALTER TABLE users ADD COLUMN org_id INTEGER NOT NULL DEFAULT 1;
+CREATE INDEX IF NOT EXISTS users_org_id_idx ON users (org_id);
+
+CREATE TRIGGER IF NOT EXISTS users_org_insert BEFORE INSERT ON users
+WHEN NOT EXISTS (SELECT 1 FROM organizations WHERE id = NEW.org_id)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+CREATE TRIGGER IF NOT EXISTS users_org_update BEFORE UPDATE OF org_id ON users
+WHEN NOT EXISTS (SELECT 1 FROM organizations WHERE id = NEW.org_id)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
+
+-- team names only need to be unique within their organization, and the
+-- inline UNIQUE can't be dropped, so teams is rebuilt. Dropping it cascades
+-- to team_members, whose rows are put back afterwards.
+CREATE TABLE teams_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	org_id INTEGER NOT NULL DEFAULT 1 REFERENCES organizations (id),
+	UNIQUE (org_id, name)
+);
+INSERT INTO teams_new (id, name, description) SELECT id, name, description FROM teams;
+CREATE TEMP TABLE team_members_backup AS SELECT team_id, user_id FROM team_members;
+DROP TABLE teams;
+ALTER TABLE teams_new RENAME TO teams;
+INSERT INTO team_members (team_id, user_id) SELECT team_id, user_id FROM team_members_backup;
+DROP TABLE team_members_backup;
+
+CREATE TRIGGER IF NOT EXISTS organizations_delete BEFORE DELETE ON organizations
+WHEN EXISTS (SELECT 1 FROM users WHERE org_id = OLD.id)
+BEGIN
+	SELECT RAISE(ABORT, 'FOREIGN KEY constraint failed');
+END;
@@ -0,0 +1,16 @@
+-- people invited by email to join an organization with a role. The token
+-- of the link is signed, not stored. Invitations go away with their role or
+-- organization (needs PRAGMA foreign_keys, set when connecting).
+CREATE TABLE IF NOT EXISTS invitations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	email TEXT NOT NULL,
+	role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+	org_id INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+	status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'expired')),
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	accepted_at TIMESTAMP,
+	user_id INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS invitations_org_id_email_idx ON invitations (org_id, email);
@@ -0,0 +1,5 @@
+-- what users sign in with: a bcrypt password hash, empty for users who
+-- never set one, and whether their email is verified. Existing users and
+-- those created through the API are active.
+ALTER TABLE users ADD COLUMN password_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN status TEXT NOT NULL DEFAULT 'active' CHECK (status IN ('pending', 'active'));
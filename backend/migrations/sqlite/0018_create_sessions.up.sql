@@ -0,0 +1,15 @@
+-- cookie sessions of logged in users. The id is the SHA-256 of the cookie
+-- value, so a leaked table can't be replayed; token_version is the user's at
+-- login, revoking the session along with the access tokens. Sessions of
+-- deleted users are rejected when used and purged once expired.
+CREATE TABLE IF NOT EXISTS sessions (
+	id TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	org_id INTEGER NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+	token_version INTEGER NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (org_id, user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
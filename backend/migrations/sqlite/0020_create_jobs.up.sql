@@ -0,0 +1,18 @@
+-- background jobs queued by the API and run by its workers. Jobs that
+-- succeed are deleted and those failing too often stay dead until retried.
+CREATE TABLE IF NOT EXISTS jobs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	org_id INTEGER,
+	status TEXT NOT NULL DEFAULT 'pending',
+	attempts INTEGER NOT NULL DEFAULT 0,
+	max_attempts INTEGER NOT NULL,
+	run_at TIMESTAMP NOT NULL,
+	locked_until TIMESTAMP,
+	last_error TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (status, run_at);
+CREATE INDEX IF NOT EXISTS jobs_org_id_idx ON jobs (org_id, id);
@@ -0,0 +1,9 @@
+-- the latest run of each recurring task. Every instance schedules the
+-- tasks, and the one moving scheduled_at to the time of a run performs it.
+CREATE TABLE IF NOT EXISTS scheduled_tasks (
+	name TEXT PRIMARY KEY,
+	scheduled_at TIMESTAMP NOT NULL,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP,
+	last_error TEXT NOT NULL DEFAULT ''
+);
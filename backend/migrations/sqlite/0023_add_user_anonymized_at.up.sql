@@ -0,0 +1,3 @@
+-- when the personal data of a user was scrubbed for good, NULL for users
+-- who were never anonymized
+ALTER TABLE users ADD COLUMN anonymized_at TIMESTAMP;
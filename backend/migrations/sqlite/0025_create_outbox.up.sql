@@ -0,0 +1,19 @@
+-- the transactional outbox: domain events written in the transaction of the
+-- change they describe, and published by the relay in id order. locked_until
+-- is set while a relay publishes the event or waits to retry it, delivered_at
+-- once the broker accepted it. Events are kept after delivery, for replays.
+CREATE TABLE IF NOT EXISTS outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT NOT NULL,
+	org_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	locked_until TIMESTAMP,
+	last_error TEXT NOT NULL DEFAULT '',
+	delivered_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outbox_undelivered_idx ON outbox (id) WHERE delivered_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_user_id_idx ON outbox (org_id, user_id);
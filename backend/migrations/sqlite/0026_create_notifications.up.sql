@@ -0,0 +1,14 @@
+-- the in-app notifications of each user, such as an admin editing their
+-- profile; read_at stays NULL until the user reads them. Notifications go
+-- away with their user (needs PRAGMA foreign_keys, set when connecting).
+CREATE TABLE IF NOT EXISTS notifications (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	type TEXT NOT NULL,
+	title TEXT NOT NULL,
+	body TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL,
+	read_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_id_idx ON notifications (user_id, id);
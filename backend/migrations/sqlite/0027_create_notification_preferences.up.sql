@@ -0,0 +1,8 @@
+-- the channels and types of notifications each user turned on or off, as
+-- a JSON object; users without a row receive them all. Preferences go away
+-- with their user (needs PRAGMA foreign_keys, set when connecting).
+CREATE TABLE IF NOT EXISTS notification_preferences (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	preferences TEXT NOT NULL,
+	updated_at TIMESTAMP NOT NULL
+);
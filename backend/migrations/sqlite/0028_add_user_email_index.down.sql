@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_email_index_key;
+ALTER TABLE users DROP COLUMN email_index;
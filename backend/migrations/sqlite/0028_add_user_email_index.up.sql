@@ -0,0 +1,4 @@
+-- the blind index of the email of users whose email is encrypted, NULL
+-- while it is stored in plaintext; it keeps encrypted emails unique
+ALTER TABLE users ADD COLUMN email_index TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_index_key ON users (email_index);
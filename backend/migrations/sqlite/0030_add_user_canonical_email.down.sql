@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS users_canonical_email_key;
+ALTER TABLE users DROP COLUMN canonical_email;
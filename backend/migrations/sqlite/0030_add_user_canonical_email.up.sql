@@ -0,0 +1,6 @@
+-- the email of users without its +tag, set while REJECT_EMAIL_ALIASES is
+-- on and NULL otherwise; it keeps plus-addressed aliases out in every
+-- organization, and is the blind index of that email while emails are
+-- encrypted
+ALTER TABLE users ADD COLUMN canonical_email TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS users_canonical_email_key ON users (canonical_email);
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// reloadable are the settings applied on SIGHUP without a restart, by
+// Config field; changes to the others, but rotatable, are only logged
+var reloadable = []string{
+	"LogPII",
+	"RequestTimeout",
+	"MaxBodyBytes",
+	"GzipEnabled", "GzipMinSize", "GzipTypes",
+	"CORSAllowedOrigins", "CORSAllowedMethods", "CORSAllowedHeaders", "CORSExposedHeaders", "CORSAllowCredentials", "CORSMaxAge",
+	"PasswordResetEmailLimit", "PasswordResetIPLimit", "PasswordResetWindow",
+	"LoginAccountLimit", "LoginIPLimit", "LoginWindow",
+}
+
+// rotatable are the settings holding credentials, rotated on SIGHUP and
+// every SecretsRefreshInterval without a restart: the connections opened
+// afterwards take the user and password of DatabaseURL and DatabaseReadURL,
+// and SMTPPassword, while tokens are signed with AuthSecret and those signed
+// with the previous one stay valid. Setting or clearing them takes a restart.
+var rotatable = []string{"DatabaseURL", "DatabaseReadURL", "SMTPPassword", "AuthSecret"}
+
+// reloaded is the configuration as last reloaded, see Config.latest
+var reloaded atomic.Pointer[Config]
+
+// latest returns the configuration as last reloaded, c until then
+func (c Config) latest() Config {
+	if cfg := reloaded.Load(); cfg != nil {
+		return *cfg
+	}
+	return c
+}
+
+// watchReload rereads the configuration on every SIGHUP, and the secrets
+// every SecretsRefreshInterval when read from a secrets manager. When the
+// settings applied without a restart are valid and changed, apply is given
+// cfg with them; what changed is logged, along with the other settings
+// changed, which take a restart.
+func watchReload(cfg Config, apply func(Config)) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var refresh <-chan time.Time
+	if cfg.SecretsProvider != "" && cfg.SecretsRefreshInterval > 0 {
+		ticker := time.NewTicker(cfg.SecretsRefreshInterval)
+		defer ticker.Stop()
+		refresh = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			cfg = reload(cfg, apply, true)
+		case <-refresh:
+			cfg = reload(cfg, apply, false)
+		}
+	}
+}
+
+// reload rereads the configuration and applies what changed in it, the
+// rotatable settings alone unless all is set. Refreshes of the secrets,
+// which don't set it, only log the rotations.
+func reload(cfg Config, apply func(Config), all bool) Config {
+	next, err := readConfig()
+	if err == nil {
+		err = next.validateReloadable()
+	}
+	if err != nil {
+		log.Printf("[reload] Configuration not reloaded: %v", err)
+		return cfg
+	}
+
+	updated := cfg
+	current, target := reflect.ValueOf(&updated).Elem(), reflect.ValueOf(next)
+	var applied, rotated, ignored []string
+	if all {
+		for _, name := range reloadable {
+			if field := current.FieldByName(name); !reflect.DeepEqual(field.Interface(), target.FieldByName(name).Interface()) {
+				applied = append(applied, fmt.Sprintf("%s %v -> %v", name, field.Interface(), target.FieldByName(name).Interface()))
+				field.Set(target.FieldByName(name))
+			}
+		}
+	}
+	// the values are credentials, left out of the log
+	for _, name := range rotatable {
+		field, value := current.FieldByName(name), target.FieldByName(name).String()
+		if field.String() != value && field.String() != "" && value != "" {
+			rotated = append(rotated, name)
+			field.SetString(value)
+		}
+	}
+	if all {
+		for i := 0; i < current.NumField(); i++ {
+			if !reflect.DeepEqual(current.Field(i).Interface(), target.Field(i).Interface()) {
+				ignored = append(ignored, current.Type().Field(i).Name)
+			}
+		}
+	}
+
+	if len(applied) > 0 || len(rotated) > 0 {
+		apply(updated)
+	}
+	if len(applied) > 0 {
+		log.Printf("[reload] Applied %s", strings.Join(applied, ", "))
+	}
+	if len(rotated) > 0 {
+		log.Printf("[reload] Rotated %s", strings.Join(rotated, ", "))
+	}
+	if all && len(applied) == 0 && len(rotated) == 0 {
+		log.Printf("[reload] No reloadable setting changed")
+	}
+	if len(ignored) > 0 {
+		log.Printf("[reload] Changed, applied on restart: %s", strings.Join(ignored, ", "))
+	}
+	return updated
+}
+
+// validateReloadable checks the reloadable settings, which loadConfig only
+// falls back from when they can't be parsed
+func (c Config) validateReloadable() error {
+	var errs []error
+	for _, setting := range []struct {
+		name  string
+		value int64
+	}{
+		{"REQUEST_TIMEOUT", int64(c.RequestTimeout)},
+		{"MAX_BODY_BYTES", c.MaxBodyBytes},
+		{"GZIP_MIN_SIZE", int64(c.GzipMinSize)},
+		{"CORS_MAX_AGE", int64(c.CORSMaxAge)},
+		{"PASSWORD_RESET_EMAIL_LIMIT", int64(c.PasswordResetEmailLimit)},
+		{"PASSWORD_RESET_IP_LIMIT", int64(c.PasswordResetIPLimit)},
+		{"LOGIN_ACCOUNT_LIMIT", int64(c.LoginAccountLimit)},
+		{"LOGIN_IP_LIMIT", int64(c.LoginIPLimit)},
+	} {
+		if setting.value < 0 {
+			errs = append(errs, fmt.Errorf("%s can't be negative", setting.name))
+		}
+	}
+	if c.PasswordResetWindow <= 0 || c.LoginWindow <= 0 {
+		errs = append(errs, errors.New("PASSWORD_RESET_WINDOW and LOGIN_WINDOW must be positive"))
+	}
+	return errors.Join(errs...)
+}
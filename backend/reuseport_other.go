@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails: SO_REUSEPORT balances connections across processes on Linux only
+func reusePort(network, address string, conn syscall.RawConn) error {
+	return errors.New("LISTEN_REUSE_PORT is only supported on Linux")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+
+	"api/internal/model"
+	"api/internal/repository"
+)
+
+// seedRoles are the roles fake users are spread across
+var seedRoles = []string{"admin", "moderator", "user", "user", "user"}
+
+// seedUsers inserts count fake users, first emptying the table when truncate is set
+func seedUsers(repo repository.UserRepository, count int, truncate bool) error {
+	ctx := context.Background()
+	if truncate {
+		log.Println("[seed] Truncating users")
+		if err := repo.Truncate(ctx); err != nil {
+			return err
+		}
+	}
+
+	faker := gofakeit.New(0)
+	now := time.Now()
+	created := 0
+
+	for created < count {
+		first, last := faker.FirstName(), faker.LastName()
+		birth := faker.DateRange(now.AddDate(-80, 0, 0), now.AddDate(-16, 0, 0))
+
+		user := model.User{
+			Name: first + " " + last,
+			// the numeric suffix keeps emails unique across large seeds
+			Email: fmt.Sprintf("%s.%s%d@%s", strings.ToLower(first), strings.ToLower(last), faker.Number(1, 9999), faker.DomainName()),
+			Role:  seedRoles[faker.Number(0, len(seedRoles)-1)],
+			Birth: model.NewDate(birth),
+		}
+
+		// Calculate age from birth
+		user.Age = model.AgeAt(user.Birth.Time, now)
+
+		if _, err := repo.Create(ctx, user); err != nil {
+			// a rare email collision only costs one attempt
+			if errors.Is(err, model.ErrDuplicateEmail) {
+				continue
+			}
+			return err
+		}
+		created++
+	}
+
+	log.Printf("[seed] Inserted %d users", created)
+	return nil
+}
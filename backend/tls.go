@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// serve starts the API server, over HTTPS when TLS is configured and plain
+// HTTP otherwise, and over plain HTTP on the unix socket when set, or on
+// the sockets systemd passed when socket activated, see
+// activatedListeners. On SIGTERM or an interrupt it stops accepting
+// connections and waits up to ShutdownTimeout for the requests in flight,
+// then returns nil; otherwise it returns once one of the listeners fails.
+func serve(cfg Config, handler http.Handler) error {
+	if cfg.HTTPWriteTimeout > 0 && cfg.RequestTimeout > 0 && cfg.HTTPWriteTimeout < cfg.RequestTimeout {
+		log.Printf("HTTP_WRITE_TIMEOUT (%s) is shorter than REQUEST_TIMEOUT (%s): slow responses are cut off before their requests time out", cfg.HTTPWriteTimeout, cfg.RequestTimeout)
+	}
+
+	api := cfg.httpServer(handler)
+	var redirect *http.Server
+	if cfg.TLSEnabled() {
+		// redirect handler used for the plain HTTP listener
+		var redirectHandler http.Handler = redirectToHTTPS(cfg.TLSAddr)
+		if cfg.AutocertEnabled {
+			if len(cfg.AutocertHosts) == 0 {
+				return errors.New("AUTOCERT_HOSTS must list at least one host when AUTOCERT_ENABLED is set")
+			}
+
+			manager := &autocert.Manager{
+				Prompt:     autocert.AcceptTOS,
+				HostPolicy: autocert.HostWhitelist(cfg.AutocertHosts...),
+				Cache:      autocert.DirCache(cfg.AutocertCacheDir),
+				Email:      cfg.AutocertEmail,
+			}
+			api.TLSConfig = manager.TLSConfig()
+
+			// the HTTP listener must answer ACME http-01 challenges before redirecting
+			redirectHandler = manager.HTTPHandler(redirectHandler)
+			log.Printf("Autocert enabled for hosts: %v", cfg.AutocertHosts)
+		} else {
+			api.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+		}
+		redirect = cfg.httpServer(redirectHandler)
+	}
+
+	listeners, err := cfg.listeners(api, redirect)
+	if err != nil {
+		return err
+	}
+
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		log.Printf("Serving %s", l.description)
+		go func(l listener) {
+			if l.tls {
+				// with autocert the certificates come from TLSConfig, so the file paths are empty
+				errs <- l.server.ServeTLS(l, cfg.TLSCertFile, cfg.TLSKeyFile)
+			} else {
+				errs <- l.server.Serve(l)
+			}
+		}(l)
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(stop)
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-stop:
+		log.Printf("Received %s, shutting down: waiting up to %s for the requests in flight", sig, cfg.ShutdownTimeout)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, server := range []*http.Server{api, redirect} {
+		if server == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			if err := server.Shutdown(ctx); err != nil {
+				log.Printf("Requests still in flight after SHUTDOWN_TIMEOUT were cut off: %v", err)
+				server.Close()
+			}
+		}(server)
+	}
+	wg.Wait()
+	log.Println("Server stopped")
+	return nil
+}
+
+// listener is a socket served by server, over TLS when tls is set
+type listener struct {
+	net.Listener
+	server      *http.Server
+	tls         bool
+	description string
+}
+
+// listeners opens the sockets to serve api, over TLS when it has a
+// TLSConfig, and redirect, when set, on: those systemd passed when socket
+// activated, and otherwise those of the configuration. Unix sockets serve
+// plain HTTP, as they are for a reverse proxy of the host.
+func (c Config) listeners(api, redirect *http.Server) ([]listener, error) {
+	var listeners []listener
+	fail := func(err error) ([]listener, error) {
+		for _, l := range listeners {
+			l.Close()
+		}
+		return nil, err
+	}
+	add := func(l net.Listener, server *http.Server) {
+		tls := server == api && api.TLSConfig != nil && l.Addr().Network() != "unix"
+		protocol := "HTTP"
+		switch {
+		case tls:
+			protocol = "HTTPS"
+		case server == redirect:
+			protocol = "HTTP redirecting to HTTPS"
+		}
+		listeners = append(listeners, listener{l, server, tls, fmt.Sprintf("%s on %s %s", protocol, l.Addr().Network(), l.Addr())})
+	}
+
+	activated, err := activatedListeners()
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	if activated != nil {
+		for _, l := range activated {
+			if l.name != "redirect" {
+				add(l, api)
+			} else if redirect != nil {
+				add(l, redirect)
+			} else {
+				return fail(errors.New("socket activation: the redirect socket needs TLS to redirect to"))
+			}
+		}
+		return listeners, nil
+	}
+
+	if c.UnixSocket != "" {
+		l, err := c.listenUnix()
+		if err != nil {
+			return fail(fmt.Errorf("failed to listen on UNIX_SOCKET: %w", err))
+		}
+		add(l, api)
+	}
+	bind := func(addr string, server *http.Server) error {
+		if addr == "" {
+			return nil
+		}
+		l, err := c.listenTCP(addr)
+		if err == nil {
+			add(l, server)
+		}
+		return err
+	}
+	if api.TLSConfig == nil {
+		err = bind(c.ListenAddr, api)
+	} else if err = bind(c.TLSAddr, api); err == nil {
+		err = bind(c.TLSRedirectAddr, redirect)
+	}
+	if err != nil {
+		return fail(err)
+	}
+
+	if len(listeners) == 0 {
+		return nil, errors.New("LISTEN_ADDR is empty and UNIX_SOCKET is not set, so there is nothing to serve on")
+	}
+	return listeners, nil
+}
+
+// listenTCP listens on addr, with SO_REUSEPORT when ListenReusePort is set
+func (c Config) listenTCP(addr string) (net.Listener, error) {
+	var lc net.ListenConfig
+	if c.ListenReusePort {
+		lc.Control = reusePort
+	}
+	return lc.Listen(context.Background(), "tcp", addr)
+}
+
+// httpServer returns a server of handler, with the timeouts and header
+// limit of the configuration
+func (c Config) httpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: c.HTTPReadHeaderTimeout,
+		ReadTimeout:       c.HTTPReadTimeout,
+		WriteTimeout:      c.HTTPWriteTimeout,
+		IdleTimeout:       c.HTTPIdleTimeout,
+		MaxHeaderBytes:    c.HTTPMaxHeaderBytes,
+	}
+}
+
+// redirectToHTTPS sends clients to the HTTPS version of the requested URL,
+// keeping the TLS port in the target when it isn't the default 443
+func redirectToHTTPS(tlsAddr string) http.HandlerFunc {
+	_, port, _ := net.SplitHostPort(tlsAddr)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusMovedPermanently)
+	}
+}
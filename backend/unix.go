@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+)
+
+// listenUnix listens on UnixSocket with its mode and group. A socket left
+// behind by a server that didn't stop cleanly is replaced, one that is
+// still served or a file of another kind is not.
+func (c Config) listenUnix() (net.Listener, error) {
+	mode, err := strconv.ParseUint(c.UnixSocketMode, 8, 32)
+	if err != nil || mode > 0o777 {
+		return nil, fmt.Errorf("invalid UNIX_SOCKET_MODE %q (expected octal permissions such as 0660)", c.UnixSocketMode)
+	}
+	gid := -1
+	if c.UnixSocketGroup != "" {
+		group, err := user.LookupGroup(c.UnixSocketGroup)
+		if err != nil {
+			return nil, err
+		}
+		if gid, err = strconv.Atoi(group.Gid); err != nil {
+			return nil, err
+		}
+	}
+
+	if info, err := os.Lstat(c.UnixSocket); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and isn't a socket", c.UnixSocket)
+		}
+		if conn, err := net.DialTimeout("unix", c.UnixSocket, time.Second); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another server", c.UnixSocket)
+		}
+		if err := os.Remove(c.UnixSocket); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", c.UnixSocket)
+	if err != nil {
+		return nil, err
+	}
+	// the listener removes the socket when closed
+	if err := os.Chmod(c.UnixSocket, os.FileMode(mode)); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Chown(c.UnixSocket, -1, gid); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
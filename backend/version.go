@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"api/internal/handler"
+)
+
+// Build metadata, set when building with
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Without them, the commit is the one the Go toolchain records of the git
+// checkout the binary was built in, if any, along with its time.
+var (
+	version   = "dev"
+	commit    string
+	buildTime string
+)
+
+// buildInfo returns the build metadata of the binary
+func buildInfo() handler.BuildInfo {
+	info := handler.BuildInfo{Version: version, Commit: commit, BuildTime: buildTime, GoVersion: runtime.Version()}
+	if build, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range build.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.Commit == "":
+				info.Commit = setting.Value
+			case setting.Key == "vcs.time":
+				info.CommitTime = setting.Value
+			case setting.Key == "vcs.modified" && setting.Value == "true":
+				info.Modified = true
+			}
+		}
+	}
+	return info
+}
+
+// runVersion prints the build metadata
+func runVersion(cfg Config, args []string) error {
+	info := buildInfo()
+	fmt.Printf("version %s\ncommit %s\nbuilt %s\n%s\n", info.Version, info.Commit, info.BuildTime, info.GoVersion)
+	return nil
+}
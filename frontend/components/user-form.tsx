@@ -1,6 +1,6 @@
 'use client';
 
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
@@ -11,6 +11,7 @@ import { format } from 'date-fns';
 import { CalendarIcon } from 'lucide-react';
 import { cn } from '@/lib/utils';
 import { Popover, PopoverContent, PopoverTrigger } from '@/components/ui/popover';
+import { UserService } from '@/services/user.service';
 
 interface UserFormProps {
   initialData?: UpdateUserForm;
@@ -36,6 +37,12 @@ export function UserForm({
   });
 
   const [errors, setErrors] = useState<Record<string, string>>({});
+  const [roles, setRoles] = useState<UserRole[]>(['user', 'admin', 'moderator']);
+
+  useEffect(() => {
+    // keep the defaults when the roles can't be loaded
+    UserService.getRoles().then(setRoles).catch(() => {});
+  }, []);
   const [isCalendarOpen, setIsCalendarOpen] = useState(false);
 
   const handleSubmit = async (e: React.FormEvent) => {
@@ -67,7 +74,7 @@ export function UserForm({
     if (Object.keys(newErrors).length === 0) {
       // Create the proper data structure based on mode
       const submitData = mode === 'edit' && initialData 
-        ? { ...formData, id: initialData.id } as UpdateUserForm
+        ? { ...formData, id: initialData.id, version: initialData.version } as UpdateUserForm
         : formData as CreateUserForm;
         
       const success = await onSubmit(submitData);
@@ -124,9 +131,11 @@ export function UserForm({
             <SelectValue placeholder="Select a role" />
           </SelectTrigger>
           <SelectContent>
-            <SelectItem value="user">User</SelectItem>
-            <SelectItem value="admin">Admin</SelectItem>
-            <SelectItem value="moderator">Moderator</SelectItem>
+            {roles.map((role) => (
+              <SelectItem key={role} value={role}>
+                {role.charAt(0).toUpperCase() + role.slice(1)}
+              </SelectItem>
+            ))}
           </SelectContent>
         </Select>
         {errors.role && <span className="text-red-500 text-sm">{errors.role}</span>}
@@ -4,9 +4,11 @@ export interface UserDto {
   name: string;
   email: string;
   role: string;
-  birth: string; // ISO date string from backend
+  birth: string; // YYYY-MM-DD
   age: number;
   timestamp: string; // ISO datetime string from backend
+  version: number; // incremented on every update
+  metadata: Record<string, unknown>; // client-defined attributes, kept when omitted from updates
 }
 
 export interface ApiResponse<T> {
@@ -19,6 +21,13 @@ export interface ApiResponse<T> {
 export interface UserListResponse extends ApiResponse<UserDto[]> {}
 export interface UserResponse extends ApiResponse<UserDto> {}
 
+export interface RoleDto {
+  name: string;
+  description: string;
+}
+
+export interface RoleListResponse extends ApiResponse<RoleDto[]> {}
+
 export interface CreateUserDto {
   name: string;
   email: string;
@@ -28,4 +37,5 @@ export interface CreateUserDto {
 
 export interface UpdateUserDto extends CreateUserDto {
   id: number;
+  version: number; // the version the edit is based on
 }
\ No newline at end of file
@@ -7,11 +7,14 @@ export interface User {
   birth: Date;
   age: number;
   timestamp: Date;
+  version: number;
+  metadata: Record<string, unknown>;
   formattedBirth: string; // for display
   formattedTimestamp: string; // for display
 }
 
-export type UserRole = 'admin' | 'user' | 'moderator';
+// roles are managed through /api/go/v1/roles, the defaults being admin, moderator and user
+export type UserRole = string;
 
 export interface CreateUserForm {
   name: string;
@@ -22,6 +25,7 @@ export interface CreateUserForm {
 
 export interface UpdateUserForm extends CreateUserForm {
   id: number;
+  version: number;
 }
 
 export interface UserSearchParams {
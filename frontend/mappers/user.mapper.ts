@@ -14,6 +14,8 @@ export class UserMapper {
       birth,
       age: dto.age,
       timestamp,
+      version: dto.version,
+      metadata: dto.metadata ?? {},
       formattedBirth: birth.toLocaleDateString('id-ID', {
         day: '2-digit',
         month: 'long',
@@ -50,7 +52,8 @@ export class UserMapper {
       name: form.name,
       email: form.email,
       role: form.role,
-      birth: form.birth.toISOString().split('T')[0] // Convert to YYYY-MM-DD
+      birth: form.birth.toISOString().split('T')[0], // Convert to YYYY-MM-DD
+      version: form.version
     };
   }
 
@@ -60,7 +63,8 @@ export class UserMapper {
       name: entity.name,
       email: entity.email,
       role: entity.role,
-      birth: entity.birth
+      birth: entity.birth,
+      version: entity.version
     };
   }
 }
\ No newline at end of file
@@ -1,7 +1,9 @@
 import type { NextConfig } from "next";
 
 const nextConfig: NextConfig = {
-  /* config options here */
+  // STATIC_EXPORT=true exports static files into out/, for the backend to
+  // embed and serve, see the build:embed script
+  output: process.env.STATIC_EXPORT === "true" ? "export" : undefined,
 };
 
 export default nextConfig;
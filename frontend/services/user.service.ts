@@ -1,6 +1,6 @@
 import { ApiClient } from '@/utils/apiUtils';
-import { UserListResponse, UserResponse } from '@/dtos/user.dto';
-import { User, CreateUserForm, UpdateUserForm, UserSearchParams } from '@/entities/user.entity';
+import { RoleListResponse, UserListResponse, UserResponse } from '@/dtos/user.dto';
+import { User, CreateUserForm, UpdateUserForm, UserRole, UserSearchParams } from '@/entities/user.entity';
 import { UserMapper } from '@/mappers/user.mapper';
 
 function log(...args: any[]) {
@@ -11,7 +11,7 @@ function log(...args: any[]) {
 }
 
 export class UserService {
-  private static readonly BASE_ENDPOINT = '/api/go/users';
+  private static readonly BASE_ENDPOINT = '/api/go/v1/users';
   
   /**
    * Get all users with optional search and sorting
@@ -105,13 +105,27 @@ export class UserService {
   }
   
   /**
-   * Check database health
+   * Get the names of the roles users can be given
+   */
+  static async getRoles(): Promise<UserRole[]> {
+    log('getRoles called');
+    const response = await ApiClient.get<RoleListResponse>('/api/go/v1/roles');
+    log('getRoles response:', response);
+    if (!response.success) {
+      log('getRoles error:', response.message);
+      throw new Error(response.message);
+    }
+    return response.data.map((role) => role.name);
+  }
+
+  /**
+   * Check the health of the API and its database
    */
   static async checkHealth(): Promise<boolean> {
     log('checkHealth called');
     try {
       const response = await ApiClient.get<{ success: boolean; message: string }>(
-        '/api/go/healthdb'
+        '/api/go/v1/health'
       );
       log('checkHealth response:', response);
       return response.success;
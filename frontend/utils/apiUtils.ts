@@ -1,4 +1,5 @@
-const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8000';
+// empty when the app is served by the backend itself, see the build:embed script
+const API_BASE_URL = process.env.NEXT_PUBLIC_API_URL ?? 'http://localhost:8000';
 
 export class ApiError extends Error {
   constructor(
@@ -20,7 +21,8 @@ interface RequestOptions {
 
 export class ApiClient {
   private static buildUrl(endpoint: string, params?: Record<string, string>): string {
-    const url = new URL(`${API_BASE_URL}${endpoint}`);
+    const base = typeof window === 'undefined' ? undefined : window.location.origin;
+    const url = new URL(`${API_BASE_URL}${endpoint}`, base);
     
     if (params) {
       Object.entries(params).forEach(([key, value]) => {